@@ -2,7 +2,10 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"io"
 	stdlog "log"
 	"net"
 	"net/http"
@@ -14,27 +17,289 @@ import (
 	"syscall"
 	"time"
 
+	"buf.build/go/protovalidate"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/robotlovesyou/fitest/pkg/event"
+	"github.com/robotlovesyou/fitest/pkg/gateway"
 	"github.com/robotlovesyou/fitest/pkg/health"
 	"github.com/robotlovesyou/fitest/pkg/log"
+	"github.com/robotlovesyou/fitest/pkg/notify"
 	"github.com/robotlovesyou/fitest/pkg/password"
 	"github.com/robotlovesyou/fitest/pkg/rpc"
+	"github.com/robotlovesyou/fitest/pkg/secretbox"
+	"github.com/robotlovesyou/fitest/pkg/store/dynamouserstore"
+	"github.com/robotlovesyou/fitest/pkg/store/memuserstore"
+	"github.com/robotlovesyou/fitest/pkg/store/pguserstore"
+	"github.com/robotlovesyou/fitest/pkg/store/sqliteuserstore"
+	"github.com/robotlovesyou/fitest/pkg/store/usercache"
 	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/telemetry"
 	"github.com/robotlovesyou/fitest/pkg/user"
 	"github.com/robotlovesyou/fitest/pkg/validation"
 	"github.com/robotlovesyou/fitest/userspb"
+	userspbv2 "github.com/robotlovesyou/fitest/userspb/v2"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	grpchealth "google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
 	"google.golang.org/grpc/reflection"
 )
 
 const (
-	RpcPortVar     = "RPC_PORT"
-	HealthPortVar  = "HEALTH_PORT"
+	RpcPortVar    = "RPC_PORT"
+	HealthPortVar = "HEALTH_PORT"
+	// GatewayPortVar is the port for the REST/JSON gateway. When it is not set, the gateway is not started
+	GatewayPortVar = "GATEWAY_PORT"
+	// DatabaseURIVar is the URI of the database users are stored in. A postgres:// or postgresql:// URI selects the
+	// PostgreSQL store, a sqlite: URI with the path of the database file, such as sqlite:///var/lib/users/users.db or
+	// sqlite:users.db, selects the SQLite store, a dynamodb:// URI with the name of the table, such as
+	// dynamodb://users?region=eu-west-1, selects the DynamoDB store, memory: selects the in-memory store, and any other
+	// URI the MongoDB store
 	DatabaseURIVar = "DATABASE_URI"
-	JaegerURIVar   = "JAEGER_URI"
+	// BackgroundIndexesVar builds the indexes of the MongoDB store in the background when set to true, so that the
+	// service starts serving before they are built. Changes which rely on the unique indexes fail until they are
+	BackgroundIndexesVar = "BACKGROUND_INDEXES"
+	// StoreFindTimeoutVar, StoreWriteTimeoutVar and StoreEventPollTimeoutVar are the durations, e.g. 30s, allowed for
+	// queries of the MongoDB store, for each change and for claiming each batch of events. StoreMaxRetriesVar is the number of
+	// times a change which conflicts with another, or an operation which fails with a transient error, is retried, or
+	// -1 for none. StoreRetryBackoffVar is the longest wait before the first retry of an operation, and
+	// StoreRetryBudgetVar the number of retries allowed for each operation, e.g. 0.1. When they are not set, the
+	// defaults of the store are used
+	StoreFindTimeoutVar      = "STORE_FIND_TIMEOUT"
+	StoreWriteTimeoutVar     = "STORE_WRITE_TIMEOUT"
+	StoreEventPollTimeoutVar = "STORE_EVENT_POLL_TIMEOUT"
+	StoreMaxRetriesVar       = "STORE_MAX_RETRIES"
+	StoreRetryBackoffVar     = "STORE_RETRY_BACKOFF"
+	StoreRetryBudgetVar      = "STORE_RETRY_BUDGET"
+	// StoreQueryReadPreferenceVar is the read preference of queries of many users, such as FindUsers, e.g.
+	// secondaryPreferred, and StoreQueryReadConcernVar their read concern, one of local, available or majority.
+	// StoreWriteConcernVar is the acknowledgement required of changes, either majority or a number of servers.
+	// When they are not set, those of DatabaseURIVar are used
+	StoreQueryReadPreferenceVar = "STORE_QUERY_READ_PREFERENCE"
+	StoreQueryReadConcernVar    = "STORE_QUERY_READ_CONCERN"
+	StoreWriteConcernVar        = "STORE_WRITE_CONCERN"
+	// StoreTombstoneRetentionVar is the duration, e.g. 720h, for which the records of irrecoverably deleted users are
+	// kept by the MongoDB store once their events have been published. When it is not set, the default of the store is
+	// used
+	StoreTombstoneRetentionVar = "STORE_TOMBSTONE_RETENTION"
+	// StoreEventBatchSizeVar is the largest number of events claimed at once by the MongoDB store for publishing. When
+	// it is not set, the default of the store is used
+	StoreEventBatchSizeVar = "STORE_EVENT_BATCH_SIZE"
+	// StoreMaxPendingEventsVar is the largest number of events waiting to be published which the MongoDB store holds
+	// for each user before changes to the user are refused, or -1 for no limit. When it is not set, the default of the
+	// store is used
+	StoreMaxPendingEventsVar = "STORE_MAX_PENDING_EVENTS"
+	// StoreUUIDRepresentationVar is the representation of the ids of users stored by the MongoDB store, one of generic,
+	// standard, legacy or string. When it is changed, the stored ids are rewritten by MigrateUUIDsCommand. When it is
+	// not set, the default of the store is used
+	StoreUUIDRepresentationVar = "STORE_UUID_REPRESENTATION"
+	// MigrateUUIDsWithoutTransactionsVar allows MigrateUUIDsCommand to rewrite records when set to true, even though
+	// the database does not support transactions. A record may then be missing until the command is run again, if it
+	// stops while rewriting the record
+	MigrateUUIDsWithoutTransactionsVar = "MIGRATE_UUIDS_WITHOUT_TRANSACTIONS"
+	// StoreCollectionVar is the collection the MongoDB store keeps users in, so that several deployments of the service
+	// can share the database of DatabaseURIVar. When it is not set, the default of the store is used
+	StoreCollectionVar = "STORE_COLLECTION"
+	// DumpCredentialsVar includes the password hashes and two factor secrets of users in the dumps written by
+	// DumpCommand when set to true. They are left out by default
+	DumpCredentialsVar = "DUMP_CREDENTIALS"
+	// SeedUsersVar is the number of fake users created by SeedCommand, and SeedPasswordVar the password of each of
+	// them. When they are not set, DefaultSeedUsers users are created with the default password of the service
+	SeedUsersVar    = "SEED_USERS"
+	SeedPasswordVar = "SEED_PASSWORD"
+	// StoreHealthMaxRoundTripVar is the longest duration, e.g. 500ms, the health check of the MongoDB store can take
+	// before the store is reported as unhealthy, and StoreHealthQueryVar makes the check read from the collection of
+	// users as well as pinging the database when set to true. When they are not set, the defaults of the store are used
+	StoreHealthMaxRoundTripVar = "STORE_HEALTH_MAX_ROUND_TRIP"
+	StoreHealthQueryVar        = "STORE_HEALTH_QUERY"
+	// MongoMaxPoolSizeVar and MongoMinPoolSizeVar are the largest and smallest number of connections each instance of
+	// the service keeps to each MongoDB server, MongoMaxConnIdleTimeVar is the duration, e.g. 5m, after which idle
+	// connections are closed, and MongoServerSelectionTimeoutVar the duration allowed for finding a server for an
+	// operation. When they are not set, the options of DatabaseURIVar, or the defaults of the driver, are used
+	MongoMaxPoolSizeVar            = "MONGO_MAX_POOL_SIZE"
+	MongoMinPoolSizeVar            = "MONGO_MIN_POOL_SIZE"
+	MongoMaxConnIdleTimeVar        = "MONGO_MAX_CONN_IDLE_TIME"
+	MongoServerSelectionTimeoutVar = "MONGO_SERVER_SELECTION_TIMEOUT"
+	JaegerURIVar                   = "JAEGER_URI"
+	// JWTKeyVar is the secret used to verify JWT bearer tokens. When it is not set, calls are not authenticated
+	JWTKeyVar      = "JWT_KEY"
+	JWTIssuerVar   = "JWT_ISSUER"
+	JWTAudienceVar = "JWT_AUDIENCE"
+	// APIKeysVar is a comma separated list of name:key pairs used to authenticate service to service callers.
+	// When neither it nor JWTKeyVar are set, calls are not authenticated
+	APIKeysVar = "API_KEYS"
+	// APIKeyRolesVar is a comma separated list of name=roles pairs granting roles, separated by |, to API key clients
+	APIKeyRolesVar = "API_KEY_ROLES"
+	// APIKeyTenantsVar is a comma separated list of name=tenant pairs giving the tenant each API key client acts for.
+	// Clients which are not listed act for the default tenant
+	APIKeyTenantsVar = "API_KEY_TENANTS"
+	// RequiredRolesVar lists the roles, separated by |, allowed to call methods without their own roles.
+	// When it is not set, any authenticated caller may call those methods
+	RequiredRolesVar = "REQUIRED_ROLES"
+	// RequiredRolesMethodsVar is a comma separated list of method=roles pairs which override the default roles
+	RequiredRolesMethodsVar = "REQUIRED_ROLES_METHODS"
+	// AllCountriesRolesVar lists the roles, separated by |, allowed to query users without filtering by country
+	AllCountriesRolesVar = "ALL_COUNTRIES_ROLES"
+	// FullRecordRolesVar lists the roles, separated by |, allowed to receive users with their personal information.
+	// Other callers receive users with their names and email addresses masked. When it is not set, users are not masked
+	FullRecordRolesVar = "FULL_RECORD_ROLES"
+	// RateLimitVar is the default rate:burst limit for calls to each method by each client.
+	// When it is not set, calls are not rate limited
+	RateLimitVar = "RATE_LIMIT"
+	// RateLimitMethodsVar is a comma separated list of method=rate:burst limits which override the default
+	RateLimitMethodsVar = "RATE_LIMIT_METHODS"
+	// QuotaVar is the default daily:monthly quota of calls by each API key client, where 0 is unlimited.
+	// When neither it nor QuotaClientsVar are set, calls are not subject to quotas
+	QuotaVar = "QUOTA"
+	// QuotaClientsVar is a comma separated list of name=daily:monthly quotas which override the default
+	QuotaClientsVar = "QUOTA_CLIENTS"
+	// QuotaRedisAddrVar is the address, e.g. redis:6379, of the redis server used to count calls against quotas.
+	// When it is not set, calls are counted in memory, which is only suitable for a single instance of the service
+	QuotaRedisAddrVar = "QUOTA_REDIS_ADDR"
+	// KeepaliveTimeVar is the duration, e.g. 30s, after which the server pings an idle client to check the connection
+	// is alive. KeepaliveTimeoutVar is how long it waits for a response before closing the connection.
+	// When they are not set, the grpc defaults are used
+	KeepaliveTimeVar    = "KEEPALIVE_TIME"
+	KeepaliveTimeoutVar = "KEEPALIVE_TIMEOUT"
+	// MaxConnectionAgeVar is the duration after which a connection is gracefully closed, so that clients reconnect
+	// and are rebalanced. MaxConnectionAgeGraceVar is the time allowed for in flight calls to finish before the
+	// connection is forcibly closed. When they are not set, connections are not closed because of their age
+	MaxConnectionAgeVar      = "MAX_CONNECTION_AGE"
+	MaxConnectionAgeGraceVar = "MAX_CONNECTION_AGE_GRACE"
+	// ForceCompressionThresholdVar, when set, forces gzip compression of responses of at least this many bytes,
+	// even when the request was not compressed. Callers must support gzip
+	ForceCompressionThresholdVar = "FORCE_COMPRESSION_THRESHOLD"
+	// MaxRecvMsgSizeVar and MaxSendMsgSizeVar are the largest messages, in bytes, the server will receive and send.
+	// When they are not set, DefaultMaxMsgSize is used
+	MaxRecvMsgSizeVar = "MAX_RECV_MSG_SIZE"
+	MaxSendMsgSizeVar = "MAX_SEND_MSG_SIZE"
+	// DefaultTimeoutVar is the timeout applied to unary calls which arrive without a deadline.
+	// When it is not set, DefaultRPCTimeout is used
+	DefaultTimeoutVar = "DEFAULT_TIMEOUT"
+	// MethodTimeoutsVar is a comma separated list of method=timeout pairs which override the default timeout
+	MethodTimeoutsVar = "METHOD_TIMEOUTS"
+	// DrainDelayVar is the duration, e.g. 5s, for which the service reports itself as not ready before it stops
+	// accepting calls on shutdown, so that load balancers stop sending it traffic. When it is not set,
+	// DefaultDrainDelay is used
+	DrainDelayVar = "DRAIN_DELAY"
+	// DrainTimeoutVar is the time allowed for in flight calls to finish on shutdown, after which they are cancelled.
+	// When it is not set, DefaultDrainTimeout is used. It must be greater than zero
+	DrainTimeoutVar = "DRAIN_TIMEOUT"
+	// DeleteRetentionVar is the duration, e.g. 720h, for which deleted users are kept so that they can be restored.
+	// When it is not set, users are deleted irrecoverably
+	DeleteRetentionVar = "DELETE_RETENTION"
+	// UserCacheSizeVar is the number of users cached in memory by each instance of the service, to take the load of
+	// reading frequently requested users off the database. When neither it nor UserCacheRedisAddrVar are set, users
+	// are not cached
+	UserCacheSizeVar = "USER_CACHE_SIZE"
+	// UserCacheRedisAddrVar is the address, e.g. redis:6379, of the redis server used to cache users, so that the
+	// cache is shared by every instance of the service. It takes precedence over UserCacheSizeVar
+	UserCacheRedisAddrVar = "USER_CACHE_REDIS_ADDR"
+	// UserCacheTTLVar is the duration, e.g. 30s, for which users are cached. It bounds how long a user changed by
+	// another instance may be served stale. When it is not set, DefaultUserCacheTTL is used
+	UserCacheTTLVar = "USER_CACHE_TTL"
+	// PublishActionsVar is a comma separated list of the actions, e.g. Created,Deleted, of the change events sent to
+	// the event bus. When it is not set, events with any action are sent
+	PublishActionsVar = "PUBLISH_ACTIONS"
+	// PublishExcludeActionsVar is a comma separated list of the actions of change events which are not sent to the
+	// event bus
+	PublishExcludeActionsVar = "PUBLISH_EXCLUDE_ACTIONS"
+	// PublishOmitDataVar sends change events to the event bus without the user they are for when set to true
+	PublishOmitDataVar = "PUBLISH_OMIT_DATA"
+	// AllowedCountriesVar is a comma separated list of the ISO 3166-1 alpha-2 codes, e.g. DE,FR, of the countries
+	// users can be registered in. When it is not set, users can be registered in any country
+	AllowedCountriesVar = "ALLOWED_COUNTRIES"
+	// DeniedCountriesVar is a comma separated list of the codes of countries users cannot be registered in, even when
+	// they are listed in AllowedCountriesVar
+	DeniedCountriesVar = "DENIED_COUNTRIES"
+	// AvatarHostsVar is a comma separated list of the hosts, e.g. images.example.com, which the https URLs of user
+	// avatars may refer to. When it is not set, users cannot have avatars
+	AvatarHostsVar = "AVATAR_HOSTS"
+	// DormantAfterVar is the duration, e.g. 8760h, after which active users who have not been seen are made dormant.
+	// When it is not set, users are never made dormant
+	DormantAfterVar = "DORMANT_AFTER"
+	// DormancyIntervalVar is the time between the checks the service makes for users who have become dormant. When it
+	// is 0, the service does not check, and the checks can be run with the mark-dormant command instead
+	DormancyIntervalVar = "DORMANCY_INTERVAL"
+	// NicknameCooldownVar is the duration, e.g. 720h, users must wait between changes of their nickname. When it is not
+	// set, user.DefaultNicknameCooldown is used, and when it is 0 nicknames can be changed at any time
+	NicknameCooldownVar = "NICKNAME_COOLDOWN"
+	// MaxEventAttemptsVar is the number of times an event is sent before it is dead lettered. When it is not set,
+	// user.DefaultMaxEventAttempts is used, and when it is 0 events are sent until they are published
+	MaxEventAttemptsVar = "MAX_EVENT_ATTEMPTS"
+	// TwoFactorKeyVar is the base64 encoded 32 byte key used to encrypt the two factor authentication secrets of users.
+	// When it is not set, users cannot enroll in two factor authentication
+	TwoFactorKeyVar = "TWO_FACTOR_KEY"
+	// TwoFactorIssuerVar is the name of the service shown by authenticator apps
+	TwoFactorIssuerVar = "TWO_FACTOR_ISSUER"
+	// SMTPAddressVar is the host and port, e.g. smtp.example.com:587, of the SMTP server which notifications are sent
+	// through. When it is not set, no notifications are sent
+	SMTPAddressVar = "SMTP_ADDRESS"
+	// SMTPUsernameVar is the username used to authenticate with the SMTP server. When it is not set, the service does
+	// not authenticate
+	SMTPUsernameVar = "SMTP_USERNAME"
+	// SMTPPasswordVar is the password used to authenticate with the SMTP server
+	SMTPPasswordVar = "SMTP_PASSWORD"
+	// NotificationsFromVar is the email address notifications are sent from. It must be set when SMTPAddressVar is
+	NotificationsFromVar = "NOTIFICATIONS_FROM"
+	// HealthMinSuccessRatioVar is the minimum proportion, between 0 and 1, of events which must be published
+	// successfully within HealthWindowVar for the service to be healthy. It defaults to user.MinHealthyRatio
+	HealthMinSuccessRatioVar = "HEALTH_MIN_SUCCESS_RATIO"
+	// HealthWindowVar is the period, e.g. 5m, over which the success ratio of publishing events is measured. It
+	// defaults to user.DefaultHealthWindow
+	HealthWindowVar = "HEALTH_WINDOW"
+	// HealthMaxEventAgeVar is the maximum age, e.g. 5m, of the oldest event waiting to be published for the service to
+	// be healthy. It defaults to user.MaxHealthyEventAge
+	HealthMaxEventAgeVar = "HEALTH_MAX_EVENT_AGE"
+	// EnableReflectionVar enables the grpc reflection service when set to true. It should not be enabled in production
+	EnableReflectionVar = "ENABLE_REFLECTION"
+	// EnableExplainVar serves the plans of queries of the MongoDB store at ExplainPath, alongside the healthcheck, when
+	// set to true, so that queries which scan the collection can be found. It should not be enabled in production
+	EnableExplainVar = "ENABLE_EXPLAIN"
+
+	// DefaultMaxMsgSize is the default limit on the size of messages, matching the grpc default receive limit
+	DefaultMaxMsgSize = 4 * 1024 * 1024
+	// DefaultRPCTimeout is the default timeout for unary calls which arrive without a deadline
+	DefaultRPCTimeout = 5 * time.Second
+	// DefaultDrainDelay is the default time for which the service reports itself as not ready before shutting down
+	DefaultDrainDelay = 5 * time.Second
+	// DefaultDrainTimeout is the default time allowed for in flight calls to finish on shutdown
+	DefaultDrainTimeout = 30 * time.Second
+	// DefaultUserCacheTTL is the default time for which users are cached
+	DefaultUserCacheTTL = time.Minute
+	// MarkDormantCommand is the command which makes inactive users dormant once and exits, so that the checks can be
+	// scheduled outside the service, e.g. as a cron job
+	MarkDormantCommand = "mark-dormant"
+	// MigrateCommand is the command which migrates the database and exits, so that migrations can be applied before
+	// a release is deployed rather than while it starts serving traffic
+	MigrateCommand = "migrate"
+	// MigrateUUIDsCommand is the command which rewrites the records of the MongoDB store whose ids are not stored with
+	// StoreUUIDRepresentationVar and exits. It should be run while the service is stopped
+	MigrateUUIDsCommand = "migrate-uuids"
+	// DumpCommand is the command which writes the users of the MongoDB store to stdout as JSON lines and exits, and
+	// RestoreCommand the command which creates the users of a dump read from stdin and exits, so that environments
+	// can be cloned and backups rehearsed
+	DumpCommand    = "dump"
+	RestoreCommand = "restore"
+	// SeedCommand is the command which fills the store with fake users for development and exits
+	SeedCommand = "seed"
+
+	// DefaultTwoFactorIssuer is the default name of the service shown by authenticator apps
+	DefaultTwoFactorIssuer = "Users"
+	// DefaultSeedUsers is the number of users created by SeedCommand when SeedUsersVar is not set
+	DefaultSeedUsers = 100
 
 	// DatabaseConnectionTimeout is the time allowed to make an initial connection to the database.
 	// It should be configurable
@@ -44,6 +309,13 @@ const (
 	InterfaceAddr = "0.0.0.0"
 	//HealthcheckPath is the path for the healthcheck.
 	HealthcheckPath = "/healthy"
+	// MetricsPath is the path for prometheus metrics, which are served alongside the healthcheck
+	MetricsPath = "/metrics"
+	// ExplainPath is the path for the plans of queries, which are served alongside the healthcheck when
+	// EnableExplainVar is set
+	ExplainPath = "/debug/explain"
+	// RPCServiceName is the name of the users service as reported by the grpc health server
+	RPCServiceName = "Users"
 )
 
 func getEnvI32(name string) (int32, error) {
@@ -54,6 +326,22 @@ func getEnvI32(name string) (int32, error) {
 	return int32(port), nil
 }
 
+// getEnvDuration parses the named variable as a duration. It returns 0 if the variable is not set
+func getEnvDuration(name string) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse %s: %w", name, err)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("cannot parse %s: duration must not be negative", name)
+	}
+	return d, nil
+}
+
 func rpcPort() (int32, error) {
 	return getEnvI32(RpcPortVar)
 }
@@ -62,31 +350,712 @@ func healthcheckPort() (int32, error) {
 	return getEnvI32(HealthPortVar)
 }
 
+// gatewayPort returns the port for the REST/JSON gateway, and false if the gateway is not configured
+func gatewayPort() (int32, bool, error) {
+	if os.Getenv(GatewayPortVar) == "" {
+		return 0, false, nil
+	}
+	port, err := getEnvI32(GatewayPortVar)
+	return port, err == nil, err
+}
+
 func databaseURI() string {
 	return os.Getenv(DatabaseURIVar)
 }
 
-func createStore() (*userstore.Store, error) {
+// jwtConfig returns the configuration for JWT authentication, and false if authentication is not configured
+func jwtConfig() (rpc.JWTConfig, bool) {
+	key := os.Getenv(JWTKeyVar)
+	if key == "" {
+		return rpc.JWTConfig{}, false
+	}
+	return rpc.JWTConfig{
+		Key:      []byte(key),
+		Issuer:   os.Getenv(JWTIssuerVar),
+		Audience: os.Getenv(JWTAudienceVar),
+	}, true
+}
+
+// apiKeyStore returns the store of API keys, or nil if API keys are not configured
+func apiKeyStore() (*rpc.StaticKeyStore, error) {
+	config := os.Getenv(APIKeysVar)
+	if config == "" {
+		return nil, nil
+	}
+	store, err := rpc.ParseStaticKeyStore(config)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse %s: %w", APIKeysVar, err)
+	}
+	return store, nil
+}
+
+// authenticator returns the authenticator for RPC calls, or nil if authentication is not configured
+func authenticator() (rpc.Authenticator, error) {
+	var auths []rpc.Authenticator
+	if config, ok := jwtConfig(); ok {
+		auths = append(auths, rpc.NewJWTAuthenticator(config))
+	}
+	keys, err := apiKeyStore()
+	if err != nil {
+		return nil, err
+	}
+	if keys != nil {
+		roles, err := rpc.ParseRoleMap(os.Getenv(APIKeyRolesVar))
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse %s: %w", APIKeyRolesVar, err)
+		}
+		tenants, err := rpc.ParseTenantMap(os.Getenv(APIKeyTenantsVar))
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse %s: %w", APIKeyTenantsVar, err)
+		}
+		auths = append(auths, rpc.NewAPIKeyAuthenticator(keys, roles, tenants))
+	}
+	if len(auths) == 0 {
+		return nil, nil
+	}
+	return rpc.AnyOf(auths...), nil
+}
+
+// rolePolicy returns the policy for authorizing RPC calls, and false if authorization is not configured
+func rolePolicy() (policy rpc.RolePolicy, ok bool, err error) {
+	policy.Default = rpc.ParseRoles(os.Getenv(RequiredRolesVar))
+	policy.AllCountries = rpc.ParseRoles(os.Getenv(AllCountriesRolesVar))
+	if policy.Methods, err = rpc.ParseRoleMap(os.Getenv(RequiredRolesMethodsVar)); err != nil {
+		return policy, false, fmt.Errorf("cannot parse %s: %w", RequiredRolesMethodsVar, err)
+	}
+	ok = len(policy.Default) > 0 || len(policy.AllCountries) > 0 || len(policy.Methods) > 0
+	return policy, ok, nil
+}
+
+// redactionPolicy returns the policy for redacting users in responses, and false if users are not redacted
+func redactionPolicy() (rpc.RedactionPolicy, bool) {
+	policy := rpc.RedactionPolicy{FullRecordRoles: rpc.ParseRoles(os.Getenv(FullRecordRolesVar))}
+	return policy, len(policy.FullRecordRoles) > 0
+}
+
+// rateLimitConfig returns the configuration for rate limiting, and false if rate limiting is not configured
+func rateLimitConfig() (config rpc.RateLimitConfig, ok bool, err error) {
+	def := os.Getenv(RateLimitVar)
+	if def == "" {
+		return config, false, nil
+	}
+	if config.Default, err = rpc.ParseLimit(def); err != nil {
+		return config, false, fmt.Errorf("cannot parse %s: %w", RateLimitVar, err)
+	}
+	if config.Methods, err = rpc.ParseMethodLimits(os.Getenv(RateLimitMethodsVar)); err != nil {
+		return config, false, fmt.Errorf("cannot parse %s: %w", RateLimitMethodsVar, err)
+	}
+	return config, true, nil
+}
+
+// quotaConfig returns the configuration for API key client quotas, and false if quotas are not configured
+func quotaConfig() (config rpc.QuotaConfig, ok bool, err error) {
+	def, clients := os.Getenv(QuotaVar), os.Getenv(QuotaClientsVar)
+	if def == "" && clients == "" {
+		return config, false, nil
+	}
+	if def != "" {
+		if config.Default, err = rpc.ParseQuota(def); err != nil {
+			return config, false, fmt.Errorf("cannot parse %s: %w", QuotaVar, err)
+		}
+	}
+	if config.Clients, err = rpc.ParseClientQuotas(clients); err != nil {
+		return config, false, fmt.Errorf("cannot parse %s: %w", QuotaClientsVar, err)
+	}
+	return config, true, nil
+}
+
+// quotaStore returns the store used to count calls against quotas
+func quotaStore() rpc.QuotaStore {
+	if addr := os.Getenv(QuotaRedisAddrVar); addr != "" {
+		return rpc.NewRedisQuotaStore(addr)
+	}
+	stdlog.Printf("%s is not set. Quotas will be counted separately by each instance", QuotaRedisAddrVar)
+	return rpc.NewMemoryQuotaStore()
+}
+
+// keepaliveParams returns the keepalive parameters for the grpc server.
+// Unset parameters are left as zero, which grpc treats as its default
+func keepaliveParams() (params keepalive.ServerParameters, err error) {
+	if params.Time, err = getEnvDuration(KeepaliveTimeVar); err != nil {
+		return params, err
+	}
+	if params.Timeout, err = getEnvDuration(KeepaliveTimeoutVar); err != nil {
+		return params, err
+	}
+	if params.MaxConnectionAge, err = getEnvDuration(MaxConnectionAgeVar); err != nil {
+		return params, err
+	}
+	if params.MaxConnectionAgeGrace, err = getEnvDuration(MaxConnectionAgeGraceVar); err != nil {
+		return params, err
+	}
+	return params, nil
+}
+
+// forceCompressionThreshold returns the size above which responses are compressed, and false if compression is not forced
+func forceCompressionThreshold() (int, bool, error) {
+	if os.Getenv(ForceCompressionThresholdVar) == "" {
+		return 0, false, nil
+	}
+	threshold, err := getEnvI32(ForceCompressionThresholdVar)
+	if err == nil && threshold < 0 {
+		err = fmt.Errorf("cannot parse %s: threshold must not be negative", ForceCompressionThresholdVar)
+	}
+	return int(threshold), err == nil, err
+}
+
+// maxMsgSize returns the message size limit configured by the named variable, or DefaultMaxMsgSize if it is not set
+func maxMsgSize(name string) (int, error) {
+	if os.Getenv(name) == "" {
+		return DefaultMaxMsgSize, nil
+	}
+	size, err := getEnvI32(name)
+	if err != nil {
+		return 0, err
+	}
+	if size <= 0 {
+		return 0, fmt.Errorf("cannot parse %s: size must be positive", name)
+	}
+	return int(size), nil
+}
+
+// deadlineConfig returns the timeouts applied to calls which arrive without a deadline
+func deadlineConfig() (config rpc.DeadlineConfig, err error) {
+	if config.Default, err = getEnvDuration(DefaultTimeoutVar); err != nil {
+		return config, err
+	}
+	if config.Default == 0 {
+		config.Default = DefaultRPCTimeout
+	}
+	if config.Methods, err = rpc.ParseMethodTimeouts(os.Getenv(MethodTimeoutsVar)); err != nil {
+		return config, fmt.Errorf("cannot parse %s: %w", MethodTimeoutsVar, err)
+	}
+	return config, nil
+}
+
+// drainConfig returns how long to report the service as not ready before shutting down, and how long to allow
+// in flight calls to finish
+func drainConfig() (delay, timeout time.Duration, err error) {
+	delay = DefaultDrainDelay
+	if os.Getenv(DrainDelayVar) != "" {
+		if delay, err = getEnvDuration(DrainDelayVar); err != nil {
+			return 0, 0, err
+		}
+	}
+	timeout = DefaultDrainTimeout
+	if os.Getenv(DrainTimeoutVar) != "" {
+		if timeout, err = getEnvDuration(DrainTimeoutVar); err != nil {
+			return 0, 0, err
+		}
+		if timeout == 0 {
+			return 0, 0, fmt.Errorf("%s must be greater than zero", DrainTimeoutVar)
+		}
+	}
+	return delay, timeout, nil
+}
+
+// backgroundIndexes returns true if the indexes of the MongoDB store should be built in the background. It is false by
+// default
+func backgroundIndexes() (bool, error) {
+	value := os.Getenv(BackgroundIndexesVar)
+	if value == "" {
+		return false, nil
+	}
+	background, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("cannot parse %s '%s' as a boolean: %w", BackgroundIndexesVar, value, err)
+	}
+	return background, nil
+}
+
+// reflectionEnabled returns true if the grpc reflection service should be registered. It is disabled by default
+func reflectionEnabled() (bool, error) {
+	value := os.Getenv(EnableReflectionVar)
+	if value == "" {
+		return false, nil
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("cannot parse %s '%s' as a boolean: %w", EnableReflectionVar, value, err)
+	}
+	return enabled, nil
+}
+
+// explainHandler returns the handler serving the plans of the queries of store, or nil if EnableExplainVar is not set
+func explainHandler(store user.UserStore) (http.Handler, error) {
+	value := os.Getenv(EnableExplainVar)
+	if value == "" {
+		return nil, nil
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse %s '%s' as a boolean: %w", EnableExplainVar, value, err)
+	}
+	if !enabled {
+		return nil, nil
+	}
+	mongoStore, ok := store.(*userstore.Store)
+	if !ok {
+		return nil, fmt.Errorf("only the MongoDB store can explain queries")
+	}
+	return userstore.ExplainHandler(mongoStore), nil
+}
+
+// publishConfig returns the configuration selecting the change events sent to the event bus
+func publishConfig() (config user.PublishConfig, err error) {
+	if config.Actions, err = user.ParseActions(os.Getenv(PublishActionsVar)); err != nil {
+		return config, fmt.Errorf("cannot parse %s: %w", PublishActionsVar, err)
+	}
+	if config.ExcludeActions, err = user.ParseActions(os.Getenv(PublishExcludeActionsVar)); err != nil {
+		return config, fmt.Errorf("cannot parse %s: %w", PublishExcludeActionsVar, err)
+	}
+	if value := os.Getenv(PublishOmitDataVar); value != "" {
+		if config.OmitData, err = strconv.ParseBool(value); err != nil {
+			return config, fmt.Errorf("cannot parse %s '%s' as a boolean: %w", PublishOmitDataVar, value, err)
+		}
+	}
+	return config, nil
+}
+
+// countryPolicy returns the policy deciding which countries users can be registered in
+func countryPolicy() (policy validation.CountryList, err error) {
+	if policy.Allow, err = validation.ParseCountries(os.Getenv(AllowedCountriesVar)); err != nil {
+		return policy, fmt.Errorf("cannot parse %s: %w", AllowedCountriesVar, err)
+	}
+	if policy.Deny, err = validation.ParseCountries(os.Getenv(DeniedCountriesVar)); err != nil {
+		return policy, fmt.Errorf("cannot parse %s: %w", DeniedCountriesVar, err)
+	}
+	return policy, nil
+}
+
+// validationPolicy returns the configurable rules applied to requests by the users service
+func validationPolicy() (policy validation.Policy, err error) {
+	if policy.Countries, err = countryPolicy(); err != nil {
+		return policy, err
+	}
+	if policy.AvatarHosts, err = validation.ParseHosts(os.Getenv(AvatarHostsVar)); err != nil {
+		return policy, fmt.Errorf("cannot parse %s: %w", AvatarHostsVar, err)
+	}
+	return policy, nil
+}
+
+// twoFactorConfig returns the configuration of two factor authentication, if it is enabled
+func twoFactorConfig() (config user.TwoFactorConfig, ok bool, err error) {
+	encoded := os.Getenv(TwoFactorKeyVar)
+	if encoded == "" {
+		return config, false, nil
+	}
+	key, err := secretbox.ParseKey(encoded)
+	if err != nil {
+		return config, false, fmt.Errorf("cannot parse %s: %w", TwoFactorKeyVar, err)
+	}
+	box, err := secretbox.New(key)
+	if err != nil {
+		return config, false, fmt.Errorf("cannot parse %s: %w", TwoFactorKeyVar, err)
+	}
+	config.Sealer = box
+	config.Issuer = os.Getenv(TwoFactorIssuerVar)
+	if config.Issuer == "" {
+		config.Issuer = DefaultTwoFactorIssuer
+	}
+	return config, true, nil
+}
+
+// notifierConfig returns the configuration of the SMTP server notifications are sent through, if notifications are
+// enabled
+func notifierConfig() (config notify.SMTPConfig, ok bool, err error) {
+	config.Address = os.Getenv(SMTPAddressVar)
+	if config.Address == "" {
+		return config, false, nil
+	}
+	if _, _, err := net.SplitHostPort(config.Address); err != nil {
+		return config, false, fmt.Errorf("cannot parse %s: %w", SMTPAddressVar, err)
+	}
+	config.From = os.Getenv(NotificationsFromVar)
+	if config.From == "" {
+		return config, false, fmt.Errorf("%s must be set when %s is set", NotificationsFromVar, SMTPAddressVar)
+	}
+	config.Username = os.Getenv(SMTPUsernameVar)
+	config.Password = os.Getenv(SMTPPasswordVar)
+	return config, true, nil
+}
+
+// nicknameCooldown returns the time users must wait between changes of their nickname, if it is configured
+func nicknameCooldown() (cooldown time.Duration, ok bool, err error) {
+	if os.Getenv(NicknameCooldownVar) == "" {
+		return 0, false, nil
+	}
+	if cooldown, err = getEnvDuration(NicknameCooldownVar); err != nil {
+		return 0, false, err
+	}
+	return cooldown, true, nil
+}
+
+// maxEventAttempts returns the number of times an event is sent before it is dead lettered
+func maxEventAttempts() (int64, error) {
+	value := os.Getenv(MaxEventAttemptsVar)
+	if value == "" {
+		return user.DefaultMaxEventAttempts, nil
+	}
+	attempts, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || attempts < 0 {
+		return 0, fmt.Errorf("cannot parse %s: it must be a number which is not negative", MaxEventAttemptsVar)
+	}
+	return attempts, nil
+}
+
+// healthConfig returns the thresholds the health of the service is checked against, using the defaults of the user
+// package for those which are not set
+func healthConfig() (config user.HealthConfig, err error) {
+	config = user.DefaultHealthConfig()
+	if value := os.Getenv(HealthMinSuccessRatioVar); value != "" {
+		ratio, err := strconv.ParseFloat(value, 64)
+		if err != nil || ratio < 0 || ratio > 1 {
+			return config, fmt.Errorf("cannot parse %s: it must be a number between 0 and 1", HealthMinSuccessRatioVar)
+		}
+		config.MinSuccessRatio = ratio
+	}
+	if os.Getenv(HealthWindowVar) != "" {
+		if config.Window, err = getEnvDuration(HealthWindowVar); err != nil {
+			return config, err
+		}
+		if config.Window == 0 {
+			return config, fmt.Errorf("cannot parse %s: duration must be positive", HealthWindowVar)
+		}
+	}
+	if os.Getenv(HealthMaxEventAgeVar) != "" {
+		if config.MaxEventAge, err = getEnvDuration(HealthMaxEventAgeVar); err != nil {
+			return config, err
+		}
+	}
+	return config, nil
+}
+
+// deleteRetention returns the time deleted users are kept for, or 0 if users are deleted irrecoverably
+func deleteRetention() (time.Duration, error) {
+	return getEnvDuration(DeleteRetentionVar)
+}
+
+// dormancyConfig returns the time after which inactive users are made dormant, or 0 if they never are, and the time
+// between the checks made by the service, or 0 if the service does not check
+func dormancyConfig() (after, interval time.Duration, err error) {
+	if after, err = getEnvDuration(DormantAfterVar); err != nil || after == 0 {
+		return 0, 0, err
+	}
+	interval = user.DormancyInterval
+	if os.Getenv(DormancyIntervalVar) != "" {
+		if interval, err = getEnvDuration(DormancyIntervalVar); err != nil {
+			return 0, 0, err
+		}
+	}
+	return after, interval, nil
+}
+
+// createStore connects to the database at DatabaseURIVar and returns a store for users along with a monitor of the
+// connection. A URI with the postgres or postgresql scheme selects the PostgreSQL store, one with the sqlite scheme the
+// SQLite store, one with the dynamodb scheme the DynamoDB store, the memory: URI the in-memory store, and any other URI
+// the MongoDB store
+// When background is true, the indexes of the MongoDB store are built after it is returned, so that the service can
+// start serving while they are built
+func createStore(retention time.Duration, background bool) (user.UserStore, health.Monitor, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), DatabaseConnectionTimeout)
 	defer cancel()
 
 	uri, err := url.Parse(databaseURI())
 	if err != nil {
-		return nil, fmt.Errorf("cannot parse database conection uri: %w", err)
+		return nil, nil, fmt.Errorf("cannot parse database conection uri: %w", err)
+	}
+
+	switch {
+	case isMemoryURI(uri):
+		return createMemoryStore(retention)
+	case isPostgresURI(uri):
+		return createPostgresStore(ctx, uri, retention)
+	case isSQLiteURI(uri):
+		return createSQLiteStore(ctx, uri, retention)
+	case isDynamoURI(uri):
+		return createDynamoStore(ctx, uri, retention)
+	default:
+		return createMongoStore(ctx, uri, retention, background)
 	}
+}
+
+// isMemoryURI returns true if uri selects the in-memory store
+func isMemoryURI(uri *url.URL) bool {
+	return uri.Scheme == "memory"
+}
 
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri.String()))
+// isPostgresURI returns true if uri is the URI of a PostgreSQL database
+func isPostgresURI(uri *url.URL) bool {
+	return uri.Scheme == "postgres" || uri.Scheme == "postgresql"
+}
+
+// isSQLiteURI returns true if uri is the URI of a SQLite database file
+func isSQLiteURI(uri *url.URL) bool {
+	return uri.Scheme == "sqlite"
+}
+
+// isDynamoURI returns true if uri is the URI of a DynamoDB table
+func isDynamoURI(uri *url.URL) bool {
+	return uri.Scheme == "dynamodb"
+}
+
+// sqlitePath returns the path of the database file of a SQLite URI. The path of sqlite:///var/lib/users.db is
+// absolute, and the path of sqlite:users.db, which has no slashes after the scheme, is relative
+func sqlitePath(uri *url.URL) string {
+	if uri.Opaque != "" {
+		return uri.Opaque
+	}
+	return uri.Path
+}
+
+func createMongoStore(ctx context.Context, uri *url.URL, retention time.Duration, background bool) (user.UserStore, health.Monitor, error) {
+	clientOptions, err := mongoClientOptions(uri)
+	if err != nil {
+		return nil, nil, err
+	}
+	client, err := mongo.Connect(ctx, clientOptions)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot connect to mongo server: %w", err)
+	}
+	storeOptions, err := mongoStoreOptions()
 	if err != nil {
-		return nil, fmt.Errorf("cannot connect to mongo server: %w", err)
+		return nil, nil, err
 	}
 	db := client.Database(strings.TrimLeft(uri.Path, "/"))
-	store := userstore.New(db)
-	err = store.EnsureIndexes(ctx) // This should not really be done at service startup
+	store := userstore.New(db, storeOptions)
+	if retention > 0 {
+		store = userstore.NewWithRetention(db, retention, storeOptions)
+	}
+	if background {
+		// the migrations are not limited by the connection timeout, since building indexes can take much longer
+		done := store.MigrateInBackground(context.Background())
+		go func() {
+			if err := <-done; err != nil {
+				stdlog.Printf("cannot migrate database: %v", err)
+			}
+		}()
+		return store, userstore.NewMonitor(store), nil
+	}
+	// Migrations which have already been applied, e.g. by the migrate command, are not applied again
+	_, err = store.Migrate(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("cannot create indexes: %w", err)
+		return nil, nil, fmt.Errorf("cannot migrate database: %w", err)
 	}
 
-	return store, nil
+	return store, userstore.NewMonitor(store), nil
+}
+
+// mongoClientOptions returns the options of the client for the MongoDB server at uri. The connection pool options
+// which are set override those of uri
+func mongoClientOptions(uri *url.URL) (*options.ClientOptions, error) {
+	clientOptions := options.Client().ApplyURI(uri.String())
+	for name, set := range map[string]func(uint64){
+		MongoMaxPoolSizeVar: func(size uint64) { clientOptions.SetMaxPoolSize(size) },
+		MongoMinPoolSizeVar: func(size uint64) { clientOptions.SetMinPoolSize(size) },
+	} {
+		if value := os.Getenv(name); value != "" {
+			size, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse %s: %w", name, err)
+			}
+			set(size)
+		}
+	}
+	if os.Getenv(MongoMaxConnIdleTimeVar) != "" {
+		idle, err := getEnvDuration(MongoMaxConnIdleTimeVar)
+		if err != nil {
+			return nil, err
+		}
+		clientOptions.SetMaxConnIdleTime(idle)
+	}
+	if os.Getenv(MongoServerSelectionTimeoutVar) != "" {
+		timeout, err := getEnvDuration(MongoServerSelectionTimeoutVar)
+		if err != nil {
+			return nil, err
+		}
+		clientOptions.SetServerSelectionTimeout(timeout)
+	}
+	if clientOptions.MaxPoolSize != nil && clientOptions.MinPoolSize != nil && *clientOptions.MaxPoolSize != 0 &&
+		*clientOptions.MinPoolSize > *clientOptions.MaxPoolSize {
+		return nil, fmt.Errorf("cannot use a minimum pool size of %d larger than the maximum of %d",
+			*clientOptions.MinPoolSize, *clientOptions.MaxPoolSize)
+	}
+	return clientOptions, nil
+}
+
+// mongoStoreOptions returns the timeouts and retries of the MongoDB store. Those which are not set are left as zero, so
+// that the store uses its defaults
+func mongoStoreOptions() (storeOptions userstore.Options, err error) {
+	if storeOptions.FindTimeout, err = getEnvDuration(StoreFindTimeoutVar); err != nil {
+		return storeOptions, err
+	}
+	if storeOptions.WriteTimeout, err = getEnvDuration(StoreWriteTimeoutVar); err != nil {
+		return storeOptions, err
+	}
+	if storeOptions.EventPollTimeout, err = getEnvDuration(StoreEventPollTimeoutVar); err != nil {
+		return storeOptions, err
+	}
+	if value := os.Getenv(StoreMaxRetriesVar); value != "" {
+		if storeOptions.MaxRetries, err = strconv.Atoi(value); err != nil {
+			return storeOptions, fmt.Errorf("cannot parse %s: %w", StoreMaxRetriesVar, err)
+		}
+	}
+	if storeOptions.RetryBackoff, err = getEnvDuration(StoreRetryBackoffVar); err != nil {
+		return storeOptions, err
+	}
+	if storeOptions.TombstoneRetention, err = getEnvDuration(StoreTombstoneRetentionVar); err != nil {
+		return storeOptions, err
+	}
+	if value := os.Getenv(StoreEventBatchSizeVar); value != "" {
+		size, err := strconv.Atoi(value)
+		if err != nil || size <= 0 {
+			return storeOptions, fmt.Errorf("cannot parse %s: batch size must be a positive number", StoreEventBatchSizeVar)
+		}
+		storeOptions.EventBatchSize = size
+	}
+	if value := os.Getenv(StoreMaxPendingEventsVar); value != "" {
+		if storeOptions.MaxPendingEvents, err = strconv.Atoi(value); err != nil {
+			return storeOptions, fmt.Errorf("cannot parse %s: %w", StoreMaxPendingEventsVar, err)
+		}
+	}
+	storeOptions.Collection = os.Getenv(StoreCollectionVar)
+	if value := os.Getenv(StoreUUIDRepresentationVar); value != "" {
+		if storeOptions.UUIDRepresentation, err = userstore.ParseUUIDRepresentation(value); err != nil {
+			return storeOptions, fmt.Errorf("cannot parse %s: %w", StoreUUIDRepresentationVar, err)
+		}
+	}
+	if storeOptions.HealthMaxRoundTrip, err = getEnvDuration(StoreHealthMaxRoundTripVar); err != nil {
+		return storeOptions, err
+	}
+	if value := os.Getenv(StoreHealthQueryVar); value != "" {
+		if storeOptions.HealthQuery, err = strconv.ParseBool(value); err != nil {
+			return storeOptions, fmt.Errorf("cannot parse %s '%s' as a boolean: %w", StoreHealthQueryVar, value, err)
+		}
+	}
+	if value := os.Getenv(StoreRetryBudgetVar); value != "" {
+		budget, err := strconv.ParseFloat(value, 64)
+		if err != nil || budget <= 0 {
+			return storeOptions, fmt.Errorf("cannot parse %s: budget must be a positive number", StoreRetryBudgetVar)
+		}
+		storeOptions.RetryBudget = budget
+	}
+	if value := os.Getenv(StoreQueryReadPreferenceVar); value != "" {
+		mode, err := readpref.ModeFromString(value)
+		if err != nil {
+			return storeOptions, fmt.Errorf("cannot parse %s: %w", StoreQueryReadPreferenceVar, err)
+		}
+		if storeOptions.QueryReadPreference, err = readpref.New(mode); err != nil {
+			return storeOptions, fmt.Errorf("cannot parse %s: %w", StoreQueryReadPreferenceVar, err)
+		}
+	}
+	switch value := os.Getenv(StoreQueryReadConcernVar); value {
+	case "":
+	case "local", "available", "majority":
+		storeOptions.QueryReadConcern = readconcern.New(readconcern.Level(value))
+	default:
+		return storeOptions, fmt.Errorf("cannot parse %s: '%s' is not local, available or majority", StoreQueryReadConcernVar, value)
+	}
+	switch value := os.Getenv(StoreWriteConcernVar); value {
+	case "":
+	case "majority":
+		storeOptions.WriteConcern = writeconcern.New(writeconcern.WMajority())
+	default:
+		servers, err := strconv.Atoi(value)
+		if err != nil || servers < 0 {
+			return storeOptions, fmt.Errorf("cannot parse %s: '%s' is not majority or a number of servers", StoreWriteConcernVar, value)
+		}
+		storeOptions.WriteConcern = writeconcern.New(writeconcern.W(servers))
+	}
+	return storeOptions, nil
+}
+
+// createMemoryStore creates an in-memory store. Users are lost when the service stops, and are not shared with other
+// instances, so it is only suitable for local development and tests
+func createMemoryStore(retention time.Duration) (user.UserStore, health.Monitor, error) {
+	store := memuserstore.New()
+	if retention > 0 {
+		store = memuserstore.NewWithRetention(retention)
+	}
+	return store, memuserstore.NewMonitor(store), nil
+}
+
+func createPostgresStore(ctx context.Context, uri *url.URL, retention time.Duration) (user.UserStore, health.Monitor, error) {
+	db, err := sql.Open("postgres", uri.String())
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot open postgres database: %w", err)
+	}
+	if err = db.PingContext(ctx); err != nil {
+		return nil, nil, fmt.Errorf("cannot connect to postgres server: %w", err)
+	}
+	store := pguserstore.New(db)
+	if retention > 0 {
+		store = pguserstore.NewWithRetention(db, retention)
+	}
+	err = store.EnsureSchema(ctx) // As with the indexes of the mongo store, this should not really be done at service startup
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot create schema: %w", err)
+	}
+
+	return store, pguserstore.NewMonitor(store), nil
+}
+
+// createSQLiteStore creates a store in the SQLite database file of uri, creating the file if it does not exist.
+// The file can only be shared by instances of the service on the same host, so it is only suitable for single node
+// deployments
+func createSQLiteStore(ctx context.Context, uri *url.URL, retention time.Duration) (user.UserStore, health.Monitor, error) {
+	path := sqlitePath(uri)
+	if path == "" {
+		return nil, nil, fmt.Errorf("cannot open sqlite database: %s has no path", uri)
+	}
+	db, err := sqliteuserstore.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot open sqlite database: %w", err)
+	}
+	store := sqliteuserstore.New(db)
+	if retention > 0 {
+		store = sqliteuserstore.NewWithRetention(db, retention)
+	}
+	err = store.EnsureSchema(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot create schema: %w", err)
+	}
+
+	return store, sqliteuserstore.NewMonitor(store), nil
+}
+
+// createDynamoStore creates a store in the DynamoDB table named by the host of uri, creating the table if it does not
+// exist. Credentials and the region are found as they are by the AWS CLI, although the region query parameter takes
+// precedence, and the endpoint query parameter replaces the endpoint of DynamoDB, for example with that of DynamoDB
+// Local
+func createDynamoStore(ctx context.Context, uri *url.URL, retention time.Duration) (user.UserStore, health.Monitor, error) {
+	table := uri.Host
+	if table == "" {
+		return nil, nil, fmt.Errorf("cannot open dynamodb table: %s has no table name", uri)
+	}
+	var opts []func(*config.LoadOptions) error
+	if region := uri.Query().Get("region"); region != "" {
+		opts = append(opts, config.WithRegion(region))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot load aws configuration: %w", err)
+	}
+	client := dynamodb.NewFromConfig(cfg, func(o *dynamodb.Options) {
+		if endpoint := uri.Query().Get("endpoint"); endpoint != "" {
+			o.EndpointResolver = dynamodb.EndpointResolverFromURL(endpoint)
+		}
+	})
+	store := dynamouserstore.New(client, table)
+	if retention > 0 {
+		store = dynamouserstore.NewWithRetention(client, table, retention)
+	}
+	err = store.EnsureTable(ctx) // As with the indexes of the mongo store, this should not really be done at service startup
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot create table: %w", err)
+	}
+
+	return store, dynamouserstore.NewMonitor(store), nil
 }
 
 func createEventBus() event.Bus {
@@ -101,8 +1070,32 @@ func createLogger() (*log.Logger, error) {
 	return logger, nil
 }
 
-func createUserService(store user.UserStore, bus event.Bus, logger *log.Logger) *user.Service {
-	return user.New(store, password.New(), uuid.NewRandom, validation.New(), bus, logger)
+// cacheUsers wraps store with a cache of users, if caching is configured
+func cacheUsers(store user.UserStore, logger *log.Logger) (user.UserStore, error) {
+	var cache usercache.Cache
+	if addr := os.Getenv(UserCacheRedisAddrVar); addr != "" {
+		cache = usercache.NewRedis(addr)
+	} else if os.Getenv(UserCacheSizeVar) != "" {
+		size, err := strconv.Atoi(os.Getenv(UserCacheSizeVar))
+		if err != nil || size <= 0 {
+			return nil, fmt.Errorf("cannot parse %s: size must be a positive integer", UserCacheSizeVar)
+		}
+		cache = usercache.NewLRU(size)
+	} else {
+		return store, nil
+	}
+	ttl, err := getEnvDuration(UserCacheTTLVar)
+	if err != nil {
+		return nil, err
+	}
+	if ttl == 0 {
+		ttl = DefaultUserCacheTTL
+	}
+	return usercache.New(store, cache, ttl, logger), nil
+}
+
+func createUserService(store user.UserStore, policy validation.Policy, bus event.Bus, logger *log.Logger) *user.Service {
+	return user.New(store, password.New(), uuid.NewRandom, validation.NewWithPolicy(policy), bus, logger)
 }
 
 func waitForExitSignal() <-chan bool {
@@ -117,38 +1110,222 @@ func waitForExitSignal() <-chan bool {
 	return done
 }
 
-func startRPC(service *user.Service, logger *log.Logger) (*grpc.Server, error) {
+// createMetricsRegistry creates the registry for the metrics of the service, including the standard go runtime and
+// process metrics
+func createMetricsRegistry() *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(prometheus.NewGoCollector(), prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
+	return registry
+}
+
+// rpcServerOptions returns the options used to create the grpc server
+func rpcServerOptions(logger *log.Logger, registry prometheus.Registerer) ([]grpc.ServerOption, error) {
+	deadlines, err := deadlineConfig()
+	if err != nil {
+		return nil, err
+	}
+	metrics, err := rpc.NewMetrics(registry)
+	if err != nil {
+		return nil, err
+	}
+	// tracing and metrics come first, so that calls rejected by other interceptors are also recorded
+	tracing := otelgrpc.WithPropagators(telemetry.Propagator())
+	unary := []grpc.UnaryServerInterceptor{
+		otelgrpc.UnaryServerInterceptor(tracing),
+		rpc.UnaryMetricsInterceptor(metrics),
+		rpc.UnaryDeadlineInterceptor(deadlines),
+	}
+	stream := []grpc.StreamServerInterceptor{
+		otelgrpc.StreamServerInterceptor(tracing),
+		rpc.StreamMetricsInterceptor(metrics),
+	}
+
+	auth, err := authenticator()
+	if err != nil {
+		return nil, err
+	}
+	if auth != nil {
+		unary = append(unary, rpc.UnaryAuthInterceptor(auth, logger))
+		stream = append(stream, rpc.StreamAuthInterceptor(auth, logger))
+	} else {
+		stdlog.Printf("neither %s nor %s are set. RPC calls will not be authenticated", JWTKeyVar, APIKeysVar)
+	}
+	// the tenant follows authentication, so that callers can only act for their own tenant
+	unary = append(unary, rpc.UnaryTenantInterceptor())
+	stream = append(stream, rpc.StreamTenantInterceptor())
+
+	policy, ok, err := rolePolicy()
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		if auth == nil {
+			return nil, fmt.Errorf("roles are required but neither %s nor %s are set to authenticate callers", JWTKeyVar, APIKeysVar)
+		}
+		unary = append(unary, rpc.UnaryAuthzInterceptor(policy, logger))
+		stream = append(stream, rpc.StreamAuthzInterceptor(policy, logger))
+	}
+
+	if redaction, ok := redactionPolicy(); ok {
+		if auth == nil {
+			return nil, fmt.Errorf("%s is set but neither %s nor %s are set to authenticate callers", FullRecordRolesVar, JWTKeyVar, APIKeysVar)
+		}
+		unary = append(unary, rpc.UnaryRedactionInterceptor(redaction))
+		stream = append(stream, rpc.StreamRedactionInterceptor(redaction))
+	}
+
+	limits, ok, err := rateLimitConfig()
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		unary = append(unary, rpc.UnaryRateLimitInterceptor(rpc.NewRateLimiter(limits), logger))
+	}
+
+	quotas, ok, err := quotaConfig()
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		if os.Getenv(APIKeysVar) == "" {
+			return nil, fmt.Errorf("quotas are configured but %s is not set to authenticate clients", APIKeysVar)
+		}
+		limiter := rpc.NewQuotaLimiter(quotas, quotaStore())
+		unary = append(unary, rpc.UnaryQuotaInterceptor(limiter, logger))
+		stream = append(stream, rpc.StreamQuotaInterceptor(limiter, logger))
+	}
+	validator, err := protovalidate.New()
+	if err != nil {
+		return nil, err
+	}
+	unary = append(unary, rpc.UnaryValidationInterceptor(validator))
+	stream = append(stream, rpc.StreamValidationInterceptor(validator))
+
+	params, err := keepaliveParams()
+	if err != nil {
+		return nil, err
+	}
+
+	maxRecv, err := maxMsgSize(MaxRecvMsgSizeVar)
+	if err != nil {
+		return nil, err
+	}
+	maxSend, err := maxMsgSize(MaxSendMsgSizeVar)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(stream...),
+		grpc.KeepaliveParams(params),
+		grpc.MaxRecvMsgSize(maxRecv),
+		grpc.MaxSendMsgSize(maxSend),
+	}
+
+	threshold, ok, err := forceCompressionThreshold()
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		opts = append(opts, rpc.ForceCompression(threshold))
+	}
+
+	return opts, nil
+}
+
+func startRPC(service *user.Service, healthServer *grpchealth.Server, logger *log.Logger, registry prometheus.Registerer) (*grpc.Server, error) {
 	port, err := rpcPort()
 	if err != nil {
 		return nil, err
 	}
 
+	opts, err := rpcServerOptions(logger, registry)
+	if err != nil {
+		return nil, err
+	}
+
+	withReflection, err := reflectionEnabled()
+	if err != nil {
+		return nil, err
+	}
+
 	// It might be better to make the interface configurable as well as the port
 	lis, err := net.Listen("tcp", fmt.Sprintf("%s:%d", InterfaceAddr, port))
 	if err != nil {
 		return nil, fmt.Errorf("canoot bind to port %d, %w", port, err)
 	}
 	stdlog.Printf("RPC listening on %s:%d", InterfaceAddr, port)
-	grpcServer := grpc.NewServer()
+	grpcServer := grpc.NewServer(opts...)
 	userspb.RegisterUsersServer(grpcServer, rpc.New(service, logger))
-	reflection.Register(grpcServer)
+	userspbv2.RegisterUsersServer(grpcServer, rpc.NewV2(service, logger))
+	grpc_health_v1.RegisterHealthServer(grpcServer, healthServer)
+	if withReflection {
+		reflection.Register(grpcServer)
+	}
 	go grpcServer.Serve(lis)
 
 	return grpcServer, nil
 }
 
-func startpublishingChanges(ctx context.Context, service *user.Service) {
-	go service.PublishChanges(ctx)
+// startGateway starts the REST/JSON gateway, which proxies requests to the RPC server.
+// It returns a nil server if the gateway is not configured
+func startGateway(ctx context.Context) (*http.Server, error) {
+	port, ok, err := gatewayPort()
+	if err != nil || !ok {
+		return nil, err
+	}
+	rpcPort, err := rpcPort()
+	if err != nil {
+		return nil, err
+	}
+	handler, err := gateway.New(ctx, fmt.Sprintf("localhost:%d", rpcPort), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, err
+	}
+	server := &http.Server{
+		Addr:    fmt.Sprintf("%s:%d", InterfaceAddr, port),
+		Handler: handler,
+	}
+	go func() {
+		stdlog.Printf("gateway starting on %s", server.Addr)
+		err := server.ListenAndServe()
+		stdlog.Printf("gateway server has exited: %v", err)
+	}()
+	return server, nil
+}
+
+func startpublishingChanges(ctx context.Context, service *user.Service, config user.PublishConfig) {
+	go service.PublishChanges(ctx, config)
+}
+
+func startPurging(ctx context.Context, service *user.Service) {
+	go service.PurgeEvery(ctx, user.PurgeInterval)
 }
 
-func startHealthcheck(logger *log.Logger, store *userstore.Store, service *user.Service) (*http.Server, error) {
+func startMarkingDormant(ctx context.Context, service *user.Service, interval, after time.Duration) {
+	go service.MarkDormantEvery(ctx, interval, after)
+}
+
+func createHealthService(logger *log.Logger, storeMonitor health.Monitor, service *user.Service) *health.Service {
+	return health.New(logger, storeMonitor, user.NewMonitor(service))
+}
+
+func startReportingHealth(ctx context.Context, svc *health.Service, healthServer *grpchealth.Server) {
+	go svc.ReportEvery(ctx, health.ReportInterval, healthServer, RPCServiceName)
+}
+
+func startHealthcheck(svc *health.Service, registry *prometheus.Registry, explain http.Handler) (*http.Server, error) {
 	port, err := healthcheckPort()
 	if err != nil {
 		return nil, err
 	}
-	svc := health.New(logger, userstore.NewMonitor(store), user.NewMonitor(service))
 	mux := http.NewServeMux()
 	mux.HandleFunc(HealthcheckPath, svc.Handle)
+	mux.Handle(MetricsPath, promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	if explain != nil {
+		mux.Handle(ExplainPath, explain)
+	}
 	server := &http.Server{
 		Addr:    fmt.Sprintf("%s:%d", InterfaceAddr, port),
 		Handler: mux,
@@ -161,9 +1338,286 @@ func startHealthcheck(logger *log.Logger, store *userstore.Store, service *user.
 	return server, nil
 }
 
+// stopRPC gracefully stops the grpc server, waiting for in flight calls to finish. Calls still running after
+// timeout, such as long lived streams, are cancelled
+func stopRPC(server *grpc.Server, timeout time.Duration) {
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(timeout):
+		stdlog.Printf("in flight calls did not finish within %v, cancelling them", timeout)
+		server.Stop()
+	}
+}
+
+// shutdown drains the service before stopping it. The service is first reported as not ready, so that load
+// balancers stop sending it traffic, then the servers stop accepting calls and in flight calls are allowed to finish
+func shutdown(healthService *health.Service, rpcHealthServer *grpchealth.Server, rpcServer *grpc.Server, gatewayServer *http.Server, delay, timeout time.Duration) {
+	healthService.Drain()
+	rpcHealthServer.Shutdown()
+	stdlog.Printf("draining for %v before shutting down", delay)
+	time.Sleep(delay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if gatewayServer != nil {
+		if err := gatewayServer.Shutdown(ctx); err != nil {
+			stdlog.Printf("cannot gracefully shut down gateway: %v", err)
+			gatewayServer.Close()
+		}
+	}
+	// the gateway has stopped, so the rest of the timeout is allowed for calls made directly to the RPC server
+	deadline, _ := ctx.Deadline()
+	stopRPC(rpcServer, time.Until(deadline))
+}
+
+// runCommand runs the named command instead of the service
+func runCommand(name string) error {
+	switch name {
+	case MarkDormantCommand:
+		return markDormant()
+	case MigrateCommand:
+		return migrateStore()
+	case MigrateUUIDsCommand:
+		return migrateUUIDs()
+	case DumpCommand:
+		return dumpUsers(os.Stdout)
+	case RestoreCommand:
+		return restoreUsers(os.Stdin)
+	case SeedCommand:
+		return seedUsers()
+	default:
+		return fmt.Errorf("unknown command %s", name)
+	}
+}
+
+// markDormant makes the users who have not been seen for DormantAfterVar dormant. The events for the changes are
+// published by the service
+func markDormant() error {
+	after, _, err := dormancyConfig()
+	if err != nil {
+		return err
+	}
+	if after == 0 {
+		return fmt.Errorf("%s must be set to make users dormant", DormantAfterVar)
+	}
+	store, _, err := createStore(0, false)
+	if err != nil {
+		return err
+	}
+	logger, err := createLogger()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	service := createUserService(store, validation.Policy{}, createEventBus(), logger)
+	marked, err := service.MarkDormant(ctx, after)
+	if err != nil {
+		return err
+	}
+	logger.Infof(ctx, "made %d inactive users dormant", marked)
+	return nil
+}
+
+// migrateStore applies the migrations of the store at DatabaseURIVar which have not been applied. Stores without
+// versioned migrations create their schema if it does not exist
+func migrateStore() error {
+	logger, err := createLogger()
+	if err != nil {
+		return err
+	}
+	if _, _, err = createStore(0, false); err != nil {
+		return err
+	}
+	logger.Infof(context.Background(), "migrated the database")
+	return nil
+}
+
+// migrateUUIDs rewrites the records of the MongoDB store at DatabaseURIVar whose ids are not stored with
+// StoreUUIDRepresentationVar. The other stores do not store ids in BSON
+func migrateUUIDs() error {
+	logger, err := createLogger()
+	if err != nil {
+		return err
+	}
+	store, _, err := createStore(0, false)
+	if err != nil {
+		return err
+	}
+	mongoStore, ok := store.(*userstore.Store)
+	if !ok {
+		return fmt.Errorf("only the MongoDB store stores ids with a UUID representation")
+	}
+	withoutTransactions, err := migrateUUIDsWithoutTransactions()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	migrated, err := mongoStore.MigrateUUIDs(ctx, withoutTransactions)
+	if errors.Is(err, userstore.ErrTransactionsRequired) {
+		return fmt.Errorf("%w: back up the database and set %s to true to migrate without them",
+			err, MigrateUUIDsWithoutTransactionsVar)
+	}
+	if err != nil {
+		return err
+	}
+	logger.Infof(ctx, "rewrote the ids of %d users", migrated)
+	return nil
+}
+
+// migrateUUIDsWithoutTransactions returns true if MigrateUUIDsCommand may rewrite records without transactions. It
+// may not by default
+func migrateUUIDsWithoutTransactions() (bool, error) {
+	value := os.Getenv(MigrateUUIDsWithoutTransactionsVar)
+	if value == "" {
+		return false, nil
+	}
+	allowed, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("cannot parse %s '%s' as a boolean: %w", MigrateUUIDsWithoutTransactionsVar, value, err)
+	}
+	return allowed, nil
+}
+
+// dumpCredentials returns true if dumps should include the credentials of users. They are left out by default
+func dumpCredentials() (bool, error) {
+	value := os.Getenv(DumpCredentialsVar)
+	if value == "" {
+		return false, nil
+	}
+	include, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("cannot parse %s '%s' as a boolean: %w", DumpCredentialsVar, value, err)
+	}
+	return include, nil
+}
+
+// mongoStore returns the MongoDB store at DatabaseURIVar, or an error naming what for if another store is configured
+func mongoStore(what string) (*userstore.Store, error) {
+	store, _, err := createStore(0, false)
+	if err != nil {
+		return nil, err
+	}
+	mongoStore, ok := store.(*userstore.Store)
+	if !ok {
+		return nil, fmt.Errorf("only the MongoDB store supports %s", what)
+	}
+	return mongoStore, nil
+}
+
+// dumpUsers writes the users of the MongoDB store at DatabaseURIVar to w, with their credentials if
+// DumpCredentialsVar is set
+func dumpUsers(w io.Writer) error {
+	includeCredentials, err := dumpCredentials()
+	if err != nil {
+		return err
+	}
+	logger, err := createLogger()
+	if err != nil {
+		return err
+	}
+	store, err := mongoStore("dumps")
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	dumped, err := store.Dump(ctx, w, userstore.DumpOptions{IncludeCredentials: includeCredentials})
+	if err != nil {
+		return err
+	}
+	logger.Infof(ctx, "dumped %d users", dumped)
+	return nil
+}
+
+// restoreUsers creates the users of the dump read from r in the MongoDB store at DatabaseURIVar
+func restoreUsers(r io.Reader) error {
+	logger, err := createLogger()
+	if err != nil {
+		return err
+	}
+	store, err := mongoStore("dumps")
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	result, err := store.RestoreDump(ctx, r)
+	if err != nil {
+		return err
+	}
+	logger.Infof(ctx, "restored %d users, skipped %d users which already exist", result.Restored, result.Skipped)
+	return nil
+}
+
+// seedConfig returns the number of users created by SeedCommand, and the options they are created with. Seeded users
+// are registered in the countries allowed by AllowedCountriesVar, if it is set
+func seedConfig() (n int, opts user.SeedOptions, err error) {
+	n = DefaultSeedUsers
+	if value := os.Getenv(SeedUsersVar); value != "" {
+		if n, err = strconv.Atoi(value); err != nil || n <= 0 {
+			return 0, opts, fmt.Errorf("cannot parse %s: the number of users must be a positive number", SeedUsersVar)
+		}
+	}
+	opts.Password = os.Getenv(SeedPasswordVar)
+	countries, err := countryPolicy()
+	if err != nil {
+		return 0, opts, err
+	}
+	opts.Countries = countries.Allow
+	return n, opts, nil
+}
+
+// seedUsers creates fake users in the store at DatabaseURIVar. The events for their creation are published by the
+// service
+func seedUsers() error {
+	n, opts, err := seedConfig()
+	if err != nil {
+		return err
+	}
+	policy, err := validationPolicy()
+	if err != nil {
+		return err
+	}
+	store, _, err := createStore(0, false)
+	if err != nil {
+		return err
+	}
+	logger, err := createLogger()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	service := createUserService(store, policy, createEventBus(), logger)
+	created, err := service.Seed(ctx, n, opts)
+	if err != nil {
+		return err
+	}
+	logger.Infof(ctx, "seeded %d users", created)
+	return nil
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1]); err != nil {
+			stdlog.Fatal(err)
+		}
+		return
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
-	store, err := createStore()
+	otel.SetTextMapPropagator(telemetry.Propagator())
+	retention, err := deleteRetention()
+	if err != nil {
+		stdlog.Fatal(err)
+	}
+	background, err := backgroundIndexes()
+	if err != nil {
+		stdlog.Fatal(err)
+	}
+	store, storeMonitor, err := createStore(retention, background)
 	if err != nil {
 		stdlog.Fatal(err)
 	}
@@ -173,22 +1627,114 @@ func main() {
 		stdlog.Fatal(err)
 	}
 
-	service := createUserService(store, createEventBus(), logger)
+	drainDelay, drainTimeout, err := drainConfig()
+	if err != nil {
+		stdlog.Fatal(err)
+	}
+
+	publishing, err := publishConfig()
+	if err != nil {
+		stdlog.Fatal(err)
+	}
+
+	validating, err := validationPolicy()
+	if err != nil {
+		stdlog.Fatal(err)
+	}
+
+	dormantAfter, dormancyInterval, err := dormancyConfig()
+	if err != nil {
+		stdlog.Fatal(err)
+	}
+
+	twoFactor, twoFactorEnabled, err := twoFactorConfig()
+	if err != nil {
+		stdlog.Fatal(err)
+	}
+
+	notifier, notifying, err := notifierConfig()
+	if err != nil {
+		stdlog.Fatal(err)
+	}
+
+	cooldown, cooldownConfigured, err := nicknameCooldown()
+	if err != nil {
+		stdlog.Fatal(err)
+	}
+
+	attempts, err := maxEventAttempts()
+	if err != nil {
+		stdlog.Fatal(err)
+	}
 
-	rpcServer, err := startRPC(service, logger)
+	health, err := healthConfig()
 	if err != nil {
 		stdlog.Fatal(err)
 	}
 
-	startpublishingChanges(ctx, service)
+	explain, err := explainHandler(store)
+	if err != nil {
+		stdlog.Fatal(err)
+	}
+
+	cachedStore, err := cacheUsers(store, logger)
+	if err != nil {
+		stdlog.Fatal(err)
+	}
+
+	service := createUserService(cachedStore, validating, createEventBus(), logger)
+	if twoFactorEnabled {
+		service.UseTwoFactor(twoFactor)
+	}
+	if notifying {
+		service.UseNotifier(notify.NewSMTP(notifier))
+	}
+	if cooldownConfigured {
+		service.UseNicknameCooldown(cooldown)
+	}
+	service.UseMaxEventAttempts(attempts)
+	service.UseHealthConfig(health)
+	healthService := createHealthService(logger, storeMonitor, service)
+	rpcHealthServer := grpchealth.NewServer()
+
+	registry := createMetricsRegistry()
+	if err := registry.Register(user.NewOutboxCollector(service)); err != nil {
+		stdlog.Fatal(fmt.Errorf("cannot register outbox metrics: %w", err))
+	}
+	if mongoStore, ok := store.(*userstore.Store); ok {
+		if err := registry.Register(userstore.NewRetryCollector(mongoStore)); err != nil {
+			stdlog.Fatal(fmt.Errorf("cannot register store metrics: %w", err))
+		}
+		if err := registry.Register(userstore.NewOperationCollector(mongoStore)); err != nil {
+			stdlog.Fatal(fmt.Errorf("cannot register store metrics: %w", err))
+		}
+	}
+	rpcServer, err := startRPC(service, rpcHealthServer, logger, registry)
+	if err != nil {
+		stdlog.Fatal(err)
+	}
+
+	gatewayServer, err := startGateway(ctx)
+	if err != nil {
+		stdlog.Fatal(err)
+	}
+
+	startpublishingChanges(ctx, service, publishing)
+	if retention > 0 {
+		startPurging(ctx, service)
+	}
+	if dormantAfter > 0 && dormancyInterval > 0 {
+		startMarkingDormant(ctx, service, dormancyInterval, dormantAfter)
+	}
+	startReportingHealth(ctx, healthService, rpcHealthServer)
 
-	healthServer, err := startHealthcheck(logger, store, service)
+	healthServer, err := startHealthcheck(healthService, registry, explain)
 	if err != nil {
 		stdlog.Fatal(err)
 	}
 
 	<-waitForExitSignal()
-	rpcServer.Stop()
+	shutdown(healthService, rpcHealthServer, rpcServer, gatewayServer, drainDelay, drainTimeout)
 	healthServer.Close()
 	cancel()
 
@@ -0,0 +1,53 @@
+// package gateway implements a REST/JSON reverse proxy for the users RPC server using grpc-gateway,
+// for clients which cannot use gRPC
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/robotlovesyou/fitest/pkg/rpc"
+	"github.com/robotlovesyou/fitest/userspb"
+	userspbv2 "github.com/robotlovesyou/fitest/userspb/v2"
+	"google.golang.org/grpc"
+)
+
+// traceHeaders are the headers which carry trace context in the W3C Trace Context and Baggage formats
+var traceHeaders = []string{"traceparent", "tracestate", "baggage"}
+
+// headerMatcher forwards the API key, idempotency key, tenant and trace context headers as metadata, along with the headers
+// forwarded by default. Forwarding the trace context allows traces to continue from callers of the gateway
+func headerMatcher(key string) (string, bool) {
+	if strings.EqualFold(key, rpc.APIKeyKey) {
+		return rpc.APIKeyKey, true
+	}
+	if strings.EqualFold(key, rpc.IdempotencyKeyKey) {
+		return rpc.IdempotencyKeyKey, true
+	}
+	if strings.EqualFold(key, rpc.TenantKey) {
+		return rpc.TenantKey, true
+	}
+	for _, header := range traceHeaders {
+		if strings.EqualFold(key, header) {
+			return header, true
+		}
+	}
+	return runtime.DefaultHeaderMatcher(key)
+}
+
+// New creates a handler which transcodes REST/JSON requests into calls to the users RPC server at endpoint.
+// Calls are made over a connection to the server, rather than in process, so that they pass through the same
+// interceptors as any other RPC call. The connection is closed when ctx is done
+func New(ctx context.Context, endpoint string, opts ...grpc.DialOption) (http.Handler, error) {
+	mux := runtime.NewServeMux(runtime.WithIncomingHeaderMatcher(headerMatcher))
+	if err := userspb.RegisterUsersHandlerFromEndpoint(ctx, mux, endpoint, opts); err != nil {
+		return nil, fmt.Errorf("cannot register users gateway: %w", err)
+	}
+	if err := userspbv2.RegisterUsersHandlerFromEndpoint(ctx, mux, endpoint, opts); err != nil {
+		return nil, fmt.Errorf("cannot register users v2 gateway: %w", err)
+	}
+	return mux, nil
+}
@@ -0,0 +1,114 @@
+package gateway_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/robotlovesyou/fitest/pkg/gateway"
+	"github.com/robotlovesyou/fitest/pkg/rpc"
+	"github.com/robotlovesyou/fitest/userspb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// stubUsersServer records the requests and metadata it receives
+type stubUsersServer struct {
+	userspb.UnimplementedUsersServer
+	query *userspb.Query
+	ref   *userspb.Ref
+	md    metadata.MD
+}
+
+func (svr *stubUsersServer) FindUsers(ctx context.Context, query *userspb.Query) (*userspb.Page, error) {
+	svr.query = query
+	svr.md, _ = metadata.FromIncomingContext(ctx)
+	return &userspb.Page{
+		Page:  query.Page,
+		Total: 1,
+		Items: []*userspb.User{{Id: "id", FirstName: "Max", Country: query.Country}},
+	}, nil
+}
+
+func (svr *stubUsersServer) DeleteUser(ctx context.Context, ref *userspb.Ref) (*emptypb.Empty, error) {
+	svr.ref = ref
+	return &emptypb.Empty{}, nil
+}
+
+// withGateway starts an rpc server using svr and a gateway in front of it, and calls f with the base url of the gateway
+func withGateway(svr userspb.UsersServer, f func(string)) {
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		panic(fmt.Sprintf("cannot open random port: %v", err))
+	}
+	grpcServer := grpc.NewServer()
+	userspb.RegisterUsersServer(grpcServer, svr)
+	go grpcServer.Serve(lis)
+	defer grpcServer.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handler, err := gateway.New(ctx, lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		panic(err)
+	}
+	httpServer := httptest.NewServer(handler)
+	defer httpServer.Close()
+	f(httpServer.URL)
+}
+
+func TestFindUsersIsTranscoded(t *testing.T) {
+	svr := &stubUsersServer{}
+	withGateway(svr, func(url string) {
+		var page map[string]interface{}
+		res, err := resty.New().R().
+			SetHeader("Authorization", "Bearer token").
+			SetHeader("X-Api-Key", "key").
+			SetHeader("Idempotency-Key", "idempotent").
+			SetHeader("X-Tenant-Id", "acme").
+			SetHeader("Traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01").
+			SetResult(&page).
+			Get(url + "/v1/users?country=DE&countries=NL&countries=BE&created_before=2022-06-01T12:00:00Z&page=2&length=10")
+		require.NoError(t, err)
+		require.Equal(t, 200, res.StatusCode())
+
+		require.Equal(t, "DE", svr.query.Country)
+		require.Equal(t, []string{"NL", "BE"}, svr.query.Countries)
+		require.Equal(t, "2022-06-01T12:00:00Z", svr.query.CreatedBefore)
+		require.Equal(t, int64(2), svr.query.Page)
+		require.Equal(t, int32(10), svr.query.Length)
+		require.Equal(t, []string{"Bearer token"}, svr.md.Get(rpc.AuthorizationKey))
+		require.Equal(t, []string{"key"}, svr.md.Get(rpc.APIKeyKey))
+		require.Equal(t, []string{"idempotent"}, svr.md.Get(rpc.IdempotencyKeyKey))
+		require.Equal(t, []string{"acme"}, svr.md.Get(rpc.TenantKey))
+		require.Equal(t, []string{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}, svr.md.Get("traceparent"))
+
+		require.Equal(t, "1", page["total"])
+		require.Len(t, page["items"], 1)
+	})
+}
+
+func TestDeleteUserIsTranscoded(t *testing.T) {
+	svr := &stubUsersServer{}
+	withGateway(svr, func(url string) {
+		res, err := resty.New().R().Delete(url + "/v1/users/some-id")
+		require.NoError(t, err)
+		require.Equal(t, 200, res.StatusCode())
+		require.Equal(t, "some-id", svr.ref.Id)
+	})
+}
+
+func TestUnimplementedMethodsReturnErrors(t *testing.T) {
+	svr := &stubUsersServer{}
+	withGateway(svr, func(url string) {
+		res, err := resty.New().R().SetBody(`{"firstName": "Max"}`).Post(url + "/v1/users")
+		require.NoError(t, err)
+		require.Equal(t, 501, res.StatusCode())
+	})
+}
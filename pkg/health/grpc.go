@@ -0,0 +1,52 @@
+package health
+
+import (
+	"context"
+	"time"
+
+	grpchealth "google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const (
+	// ReportInterval is the time between checks when reporting to a grpc health server. Should be configurable
+	ReportInterval = 10 * time.Second
+)
+
+// servingStatus converts the result of a check into a grpc health serving status
+func servingStatus(ok bool) grpc_health_v1.HealthCheckResponse_ServingStatus {
+	if ok {
+		return grpc_health_v1.HealthCheckResponse_SERVING
+	}
+	return grpc_health_v1.HealthCheckResponse_NOT_SERVING
+}
+
+// Report runs the checks once and sets the serving status of each of the named services on the provided
+// grpc health server. The empty service name "" is used for the status of the server as a whole.
+// Once the service is draining, every service is reported as not serving
+func (svc *Service) Report(ctx context.Context, server *grpchealth.Server, services ...string) {
+	ctx, cancel := context.WithTimeout(ctx, CheckTimeout)
+	defer cancel()
+
+	_, ok := svc.collectResults(ctx)
+	status := servingStatus(ok && !svc.Draining())
+	server.SetServingStatus("", status)
+	for _, name := range services {
+		server.SetServingStatus(name, status)
+	}
+}
+
+// ReportEvery runs Report every interval until ctx is done, so that the grpc health server reflects the current
+// results of the monitors. It blocks, so should be run in a separate goroutine
+func (svc *Service) ReportEvery(ctx context.Context, interval time.Duration, server *grpchealth.Server, services ...string) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		svc.Report(ctx, server, services...)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package health_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/robotlovesyou/fitest/pkg/health"
+	"github.com/robotlovesyou/fitest/pkg/log"
+	"github.com/stretchr/testify/require"
+	grpchealth "google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const serviceName = "Users"
+
+func reportedStatus(t *testing.T, monitors ...health.Monitor) map[string]grpc_health_v1.HealthCheckResponse_ServingStatus {
+	logger, err := log.New("health tests")
+	require.NoError(t, err)
+
+	server := grpchealth.NewServer()
+	health.New(logger, monitors...).Report(context.Background(), server, serviceName)
+
+	statuses := make(map[string]grpc_health_v1.HealthCheckResponse_ServingStatus)
+	for _, name := range []string{"", serviceName} {
+		res, err := server.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{Service: name})
+		require.NoError(t, err)
+		statuses[name] = res.Status
+	}
+	return statuses
+}
+
+func TestReportSetsServingWithAllHealthyMonitors(t *testing.T) {
+	for name, status := range reportedStatus(t, happyMonitor("a"), happyMonitor("b")) {
+		require.Equal(t, grpc_health_v1.HealthCheckResponse_SERVING, status, "service %q", name)
+	}
+}
+
+func TestReportSetsNotServingWithAnUnhealthyMonitor(t *testing.T) {
+	for name, status := range reportedStatus(t, happyMonitor("a"), sadMonitor("b", fmt.Errorf("sad"))) {
+		require.Equal(t, grpc_health_v1.HealthCheckResponse_NOT_SERVING, status, "service %q", name)
+	}
+}
+
+func TestReportSetsNotServingWhenDraining(t *testing.T) {
+	logger, err := log.New("health tests")
+	require.NoError(t, err)
+	server := grpchealth.NewServer()
+	service := health.New(logger, happyMonitor("a"))
+	service.Drain()
+	service.Report(context.Background(), server, serviceName)
+
+	res, err := server.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{Service: serviceName})
+	require.NoError(t, err)
+	require.Equal(t, grpc_health_v1.HealthCheckResponse_NOT_SERVING, res.Status)
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/json"
 	"net/http"
+	"sync/atomic"
 	"time"
 
 	"github.com/robotlovesyou/fitest/pkg/log"
@@ -20,9 +21,17 @@ type Monitor interface {
 	Check(ctx context.Context) error
 }
 
+// Describer is implemented by monitors which can describe work in progress which does not make them unhealthy, such
+// as building indexes. The description is empty when there is nothing to describe
+type Describer interface {
+	Describe(ctx context.Context) string
+}
+
 type Service struct {
 	logger   *log.Logger
 	monitors []Monitor
+	// draining is set to 1 once the service has started shutting down
+	draining int32
 }
 
 func New(logger *log.Logger, monitors ...Monitor) *Service {
@@ -33,13 +42,26 @@ func New(logger *log.Logger, monitors ...Monitor) *Service {
 }
 
 type CheckResult struct {
-	Name string `json:"name"`
-	OK   bool   `json:"ok"`
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
 }
 
 type Result struct {
-	OK      bool          `json:"ok"`
-	Results []CheckResult `json:"results"`
+	OK       bool          `json:"ok"`
+	Draining bool          `json:"draining,omitempty"`
+	Results  []CheckResult `json:"results"`
+}
+
+// Drain marks the service as shutting down. From then on it is reported as unhealthy, whatever the results of
+// the monitors, so that load balancers stop sending it traffic while in flight calls finish
+func (svc *Service) Drain() {
+	atomic.StoreInt32(&svc.draining, 1)
+}
+
+// Draining returns true once Drain has been called
+func (svc *Service) Draining() bool {
+	return atomic.LoadInt32(&svc.draining) == 1
 }
 
 func (svc *Service) collectResults(ctx context.Context) ([]CheckResult, bool) {
@@ -71,6 +93,9 @@ func (svc *Service) collectResult(ctx context.Context, monitor Monitor, out chan
 		svc.logger.Errorf(ctx, err, "error collecting health check for %s", result.Name)
 		result.OK = false
 	}
+	if describer, ok := monitor.(Describer); ok {
+		result.Detail = describer.Describe(ctx)
+	}
 	select {
 	case <-ctx.Done():
 	case out <- result:
@@ -89,11 +114,14 @@ func (svc *Service) Handle(w http.ResponseWriter, r *http.Request) {
 	defer cancel()
 
 	results, ok := svc.collectResults(ctx)
+	draining := svc.Draining()
+	ok = ok && !draining
 	w.Header().Add("Content-Type", "application/json")
 	w.WriteHeader(getStatus(ok))
 	enc := json.NewEncoder(w)
 	enc.Encode(&Result{
-		OK:      ok,
-		Results: results,
+		OK:       ok,
+		Draining: draining,
+		Results:  results,
 	})
 }
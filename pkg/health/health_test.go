@@ -2,9 +2,11 @@ package health_test
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -32,6 +34,16 @@ func (sm *stubMonitor) Check(context.Context) error {
 	return sm.result
 }
 
+// describingMonitor is a healthy monitor which describes work in progress
+type describingMonitor struct {
+	stubMonitor
+	description string
+}
+
+func (dm *describingMonitor) Describe(context.Context) string {
+	return dm.description
+}
+
 func happyMonitor(name string) *stubMonitor {
 	return &stubMonitor{name: name}
 }
@@ -92,3 +104,33 @@ func TestHealthReturnsNotOKWithAnUnHealthyMonitor(t *testing.T) {
 		require.False(t, r.Results[0].OK == r.Results[1].OK)
 	})
 }
+
+func TestHealthReturnsNotOKWhenDraining(t *testing.T) {
+	logger, err := log.New("health tests")
+	require.NoError(t, err)
+	service := health.New(logger, happyMonitor("a"))
+	service.Drain()
+
+	rec := httptest.NewRecorder()
+	service.Handle(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	var r health.Result
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&r))
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+	require.False(t, r.OK)
+	require.True(t, r.Draining)
+	require.True(t, r.Results[0].OK)
+}
+
+func TestHealthIncludesDescriptionsOfWorkInProgress(t *testing.T) {
+	logger, err := log.New("health tests")
+	require.NoError(t, err)
+	service := health.New(logger, &describingMonitor{stubMonitor: stubMonitor{name: "a"}, description: "building indexes"})
+
+	rec := httptest.NewRecorder()
+	service.Handle(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	var r health.Result
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&r))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.True(t, r.OK)
+	require.Equal(t, "building indexes", r.Results[0].Detail)
+}
@@ -14,8 +14,11 @@ type Key string
 const (
 	// The key for the request ID in the context
 	RequestIDKey Key = "RequestID"
+	// The key for the identity of the caller in the context
+	CallerKey Key = "Caller"
 
 	DefaultRequestID = "None"
+	DefaultCaller    = "Anonymous"
 )
 
 // Logger provides logging by wrapping zap sugared logger
@@ -34,29 +37,42 @@ func New(name string) (*Logger, error) {
 	}, nil
 }
 
-func getRequestID(ctx context.Context) string {
-	raw := ctx.Value(RequestIDKey)
+func getString(ctx context.Context, key Key, def string) string {
+	raw := ctx.Value(key)
 	if raw == nil {
-		return DefaultRequestID
+		return def
 	}
 	str, ok := raw.(string)
 	if !ok {
-		return DefaultRequestID
+		return def
 	}
 	return str
 }
 
-// Infof logs an info level log which optionally includes information from the context (requestID)
+func getRequestID(ctx context.Context) string {
+	return getString(ctx, RequestIDKey, DefaultRequestID)
+}
+
+func getCaller(ctx context.Context) string {
+	return getString(ctx, CallerKey, DefaultCaller)
+}
+
+// Infof logs an info level log which optionally includes information from the context (requestID and caller)
 func (l *Logger) Infof(ctx context.Context, format string, args ...any) {
-	l.logger.Infow(fmt.Sprintf(format, args...), "request_id", getRequestID(ctx))
+	l.logger.Infow(fmt.Sprintf(format, args...), "request_id", getRequestID(ctx), "caller", getCaller(ctx))
 }
 
-// Errorf logs an error level log which includes the provdided error and optionally includes information from the context (requestID)
+// Errorf logs an error level log which includes the provdided error and optionally includes information from the context (requestID and caller)
 func (l *Logger) Errorf(ctx context.Context, err error, format string, args ...any) {
-	l.logger.Errorw(fmt.Sprintf(format, args...), "error", err.Error(), "request_id", getRequestID(ctx))
+	l.logger.Errorw(fmt.Sprintf(format, args...), "error", err.Error(), "request_id", getRequestID(ctx), "caller", getCaller(ctx))
 }
 
 // WithRequestID returns a context with the provided requestId set as a value
 func WithRequestID(ctx context.Context, requestID string) context.Context {
 	return context.WithValue(ctx, RequestIDKey, requestID)
 }
+
+// WithCaller returns a context with the provided caller identity set as a value
+func WithCaller(ctx context.Context, caller string) context.Context {
+	return context.WithValue(ctx, CallerKey, caller)
+}
@@ -32,3 +32,15 @@ func TestCanCallErrorWithTestID(t *testing.T) {
 	require.NoError(t, err)
 	l.Errorf(log.WithRequestID(context.Background(), "test_request_id"), errors.New("test error"), "test message %d", 123)
 }
+
+func TestCanCallInfoWithCaller(t *testing.T) {
+	l, err := log.New("test")
+	require.NoError(t, err)
+	l.Infof(log.WithCaller(context.Background(), "test_caller"), "test message %d", 123)
+}
+
+func TestCanCallErrorWithCaller(t *testing.T) {
+	l, err := log.New("test")
+	require.NoError(t, err)
+	l.Errorf(log.WithCaller(context.Background(), "test_caller"), errors.New("test error"), "test message %d", 123)
+}
@@ -0,0 +1,68 @@
+package notify
+
+import (
+	"context"
+	"sync"
+
+	"github.com/robotlovesyou/fitest/pkg/user"
+)
+
+// Kind is the kind of a notification
+type Kind string
+
+const (
+	KindWelcome         Kind = "Welcome"
+	KindPasswordChanged Kind = "PasswordChanged"
+	KindDeleted         Kind = "Deleted"
+)
+
+// Notification is a notification recorded by a Recorder
+type Notification struct {
+	Kind  Kind
+	Email string
+	// User is the user the notification is about. It is nil for KindDeleted, since only the email address is known
+	User *user.SanitizedUser
+}
+
+// Recorder is a user.Notifier which records notifications instead of sending them, for use in tests and
+// development. It is safe for concurrent use
+type Recorder struct {
+	mtx           sync.Mutex
+	notifications []Notification
+}
+
+// NewRecorder creates a new Recorder with no notifications
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// Welcome records a KindWelcome notification
+func (r *Recorder) Welcome(_ context.Context, usr *user.SanitizedUser) error {
+	r.record(Notification{Kind: KindWelcome, Email: usr.Email, User: usr})
+	return nil
+}
+
+// PasswordChanged records a KindPasswordChanged notification
+func (r *Recorder) PasswordChanged(_ context.Context, usr *user.SanitizedUser) error {
+	r.record(Notification{Kind: KindPasswordChanged, Email: usr.Email, User: usr})
+	return nil
+}
+
+// Deleted records a KindDeleted notification
+func (r *Recorder) Deleted(_ context.Context, email string) error {
+	r.record(Notification{Kind: KindDeleted, Email: email})
+	return nil
+}
+
+func (r *Recorder) record(n Notification) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.notifications = append(r.notifications, n)
+}
+
+// Notifications returns a copy of the notifications recorded so far, in the order they were recorded
+func (r *Recorder) Notifications() []Notification {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return append([]Notification(nil), r.notifications...)
+}
@@ -0,0 +1,23 @@
+package notify_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/robotlovesyou/fitest/pkg/notify"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecorderRecordsNotificationsInOrder(t *testing.T) {
+	recorder := notify.NewRecorder()
+	usr := fakeUser()
+	require.NoError(t, recorder.Welcome(context.Background(), usr))
+	require.NoError(t, recorder.PasswordChanged(context.Background(), usr))
+	require.NoError(t, recorder.Deleted(context.Background(), "gone@example.com"))
+
+	require.Equal(t, []notify.Notification{
+		{Kind: notify.KindWelcome, Email: usr.Email, User: usr},
+		{Kind: notify.KindPasswordChanged, Email: usr.Email, User: usr},
+		{Kind: notify.KindDeleted, Email: "gone@example.com"},
+	}, recorder.Notifications())
+}
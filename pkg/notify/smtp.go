@@ -0,0 +1,88 @@
+// package notify implements user.Notifier, sending notifications by email
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+
+	"github.com/robotlovesyou/fitest/pkg/user"
+)
+
+// SMTPConfig configures the SMTP server notifications are sent through
+type SMTPConfig struct {
+	// Address is the host and port of the server, e.g. smtp.example.com:587
+	Address string
+	// Username and Password authenticate with the server using PLAIN authentication, when Username is set.
+	// The server must offer TLS unless it is on localhost
+	Username string
+	Password string
+	// From is the address notifications are sent from
+	From string
+}
+
+// SMTP wraps net/smtp in a user.Notifier compliant interface, sending a plain text email for each notification
+type SMTP struct {
+	config SMTPConfig
+	auth   smtp.Auth
+}
+
+// NewSMTP creates a new SMTP notifier
+func NewSMTP(config SMTPConfig) *SMTP {
+	notifier := &SMTP{config: config}
+	if config.Username != "" {
+		host, _, _ := net.SplitHostPort(config.Address)
+		notifier.auth = smtp.PlainAuth("", config.Username, config.Password, host)
+	}
+	return notifier
+}
+
+// Welcome emails a welcome to a user who has been created
+func (s *SMTP) Welcome(ctx context.Context, usr *user.SanitizedUser) error {
+	return s.send(ctx, usr.Email, "Welcome", fmt.Sprintf(
+		"Hello %s,\r\n\r\nWelcome! Your account has been created with the nickname %s.\r\n", usr.FirstName, usr.Nickname))
+}
+
+// PasswordChanged emails a notice to a user whose password has been changed
+func (s *SMTP) PasswordChanged(ctx context.Context, usr *user.SanitizedUser) error {
+	return s.send(ctx, usr.Email, "Your password has been changed", fmt.Sprintf(
+		"Hello %s,\r\n\r\nThe password of your account has been changed. If you did not change it, reset your password now.\r\n", usr.FirstName))
+}
+
+// Deleted emails a confirmation to a user whose account has been deleted
+func (s *SMTP) Deleted(ctx context.Context, email string) error {
+	return s.send(ctx, email, "Your account has been deleted",
+		"Hello,\r\n\r\nYour account has been deleted, as requested.\r\n")
+}
+
+// send sends an email to a single recipient. net/smtp does not take a context, so the email is sent in the background
+// and send returns early if ctx is done first
+func (s *SMTP) send(ctx context.Context, to, subject, body string) error {
+	if strings.ContainsAny(to, "\r\n") {
+		return fmt.Errorf("invalid recipient address %q", to)
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", s.config.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	msg.WriteString(body)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(s.config.Address, s.auth, s.config.From, []string{to}, msg.Bytes())
+	}()
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("cannot send email: %w", ctx.Err())
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("cannot send email: %w", err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,166 @@
+package notify_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/robotlovesyou/fitest/pkg/notify"
+	"github.com/robotlovesyou/fitest/pkg/user"
+	"github.com/stretchr/testify/require"
+)
+
+// email is an email received by fakeSMTPServer
+type email struct {
+	from string
+	to   []string
+	data string
+}
+
+// fakeSMTPServer accepts a single connection on a random local port, speaking just enough SMTP for net/smtp to send
+// an email without authentication, and sends the email it receives to the returned channel
+func fakeSMTPServer(t *testing.T) (string, <-chan email) {
+	lis, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { lis.Close() })
+	received := make(chan email, 1)
+	go func() {
+		conn, err := lis.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(line string) { fmt.Fprintf(conn, "%s\r\n", line) }
+		reply("220 localhost ESMTP")
+		var msg email
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			switch cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0]); cmd {
+			case "EHLO", "HELO":
+				reply("250 localhost")
+			case "MAIL":
+				msg.from = strings.Trim(strings.TrimPrefix(line, "MAIL FROM:"), "<>")
+				reply("250 OK")
+			case "RCPT":
+				msg.to = append(msg.to, strings.Trim(strings.TrimPrefix(line, "RCPT TO:"), "<>"))
+				reply("250 OK")
+			case "DATA":
+				reply("354 go ahead")
+				var data strings.Builder
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					data.WriteString(line)
+				}
+				msg.data = data.String()
+				reply("250 OK")
+				received <- msg
+			case "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+	return lis.Addr().String(), received
+}
+
+func fakeUser() *user.SanitizedUser {
+	return &user.SanitizedUser{FirstName: "Ada", Nickname: "ada", Email: "ada@example.com"}
+}
+
+func TestSMTPSendsNotifications(t *testing.T) {
+	cases := []struct {
+		name    string
+		send    func(*notify.SMTP) error
+		to      string
+		subject string
+		body    string
+	}{
+		{
+			name:    "welcome",
+			send:    func(s *notify.SMTP) error { return s.Welcome(context.Background(), fakeUser()) },
+			to:      "ada@example.com",
+			subject: "Subject: Welcome",
+			body:    "Hello Ada,",
+		},
+		{
+			name:    "password changed",
+			send:    func(s *notify.SMTP) error { return s.PasswordChanged(context.Background(), fakeUser()) },
+			to:      "ada@example.com",
+			subject: "Subject: Your password has been changed",
+			body:    "reset your password now",
+		},
+		{
+			name:    "deleted",
+			send:    func(s *notify.SMTP) error { return s.Deleted(context.Background(), "gone@example.com") },
+			to:      "gone@example.com",
+			subject: "Subject: Your account has been deleted",
+			body:    "Your account has been deleted",
+		},
+	}
+	for _, c := range cases {
+		thisCase := c
+		t.Run(thisCase.name, func(t *testing.T) {
+			address, received := fakeSMTPServer(t)
+			notifier := notify.NewSMTP(notify.SMTPConfig{Address: address, From: "users@example.com"})
+			require.NoError(t, thisCase.send(notifier))
+
+			msg := <-received
+			require.Equal(t, "users@example.com", msg.from)
+			require.Equal(t, []string{thisCase.to}, msg.to)
+			require.Contains(t, msg.data, "To: "+thisCase.to+"\r\n")
+			require.Contains(t, msg.data, thisCase.subject+"\r\n")
+			require.Contains(t, msg.data, thisCase.body)
+		})
+	}
+}
+
+func TestSMTPReturnsErrorWhenServerIsUnavailable(t *testing.T) {
+	lis, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	address := lis.Addr().String()
+	require.NoError(t, lis.Close())
+
+	notifier := notify.NewSMTP(notify.SMTPConfig{Address: address, From: "users@example.com"})
+	require.Error(t, notifier.Welcome(context.Background(), fakeUser()))
+}
+
+func TestSMTPStopsWaitingWhenContextIsDone(t *testing.T) {
+	// a server which accepts connections but never replies
+	lis, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	defer lis.Close()
+	go func() {
+		conn, err := lis.Accept()
+		if err == nil {
+			defer conn.Close()
+			time.Sleep(time.Second)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	notifier := notify.NewSMTP(notify.SMTPConfig{Address: lis.Addr().String(), From: "users@example.com"})
+	require.ErrorIs(t, notifier.Welcome(ctx, fakeUser()), context.DeadlineExceeded)
+}
+
+func TestSMTPRejectsRecipientsWithLineBreaks(t *testing.T) {
+	notifier := notify.NewSMTP(notify.SMTPConfig{Address: "localhost:0", From: "users@example.com"})
+	require.Error(t, notifier.Deleted(context.Background(), "gone@example.com\r\nBcc: someone@example.com"))
+}
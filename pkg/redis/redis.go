@@ -0,0 +1,28 @@
+// Package redis creates the clients used by the service to connect to redis
+package redis
+
+import (
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+const (
+	// DialTimeout is the time allowed to connect to redis. It should be configurable
+	DialTimeout = 5 * time.Second
+	// Timeout is the time allowed to send a command or read its reply. It should be configurable
+	Timeout = time.Second
+)
+
+// New creates a client for the redis server at addr, e.g. redis:6379. The client keeps a pool of connections, which
+// are opened on first use, so that commands from concurrent calls are not sent one at a time. Commands also stop
+// when their context is done
+func New(addr string) *goredis.Client {
+	return goredis.NewClient(&goredis.Options{
+		Addr:                  addr,
+		DialTimeout:           DialTimeout,
+		ReadTimeout:           Timeout,
+		WriteTimeout:          Timeout,
+		ContextTimeoutEnabled: true,
+	})
+}
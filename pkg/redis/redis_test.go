@@ -0,0 +1,48 @@
+package redis_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/robotlovesyou/fitest/pkg/redis"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientSendsConcurrentCommands(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.New(server.Addr())
+	defer client.Close()
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			require.NoError(t, client.Incr(ctx, "counter").Err())
+		}()
+	}
+	wg.Wait()
+
+	count, err := client.Get(ctx, "counter").Int64()
+	require.NoError(t, err)
+	require.Equal(t, int64(20), count)
+}
+
+func TestClientReconnectsAfterConnectionErrors(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.New(server.Addr())
+	defer client.Close()
+	ctx := context.Background()
+	require.NoError(t, client.Incr(ctx, "counter").Err())
+
+	server.Close()
+	require.Error(t, client.Incr(ctx, "counter").Err())
+
+	require.NoError(t, server.Restart())
+	count, err := client.Incr(ctx, "counter").Result()
+	require.NoError(t, err)
+	require.Equal(t, int64(2), count)
+}
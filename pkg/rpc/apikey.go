@@ -0,0 +1,117 @@
+package rpc
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+
+	"github.com/robotlovesyou/fitest/pkg/tenant"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// APIKeyKey is the metadata key used to send an API key
+	APIKeyKey = "x-api-key"
+)
+
+// KeyStore looks up the name of the client an API key was issued to.
+// Implementations should return ErrInvalidCredentials for unknown keys
+type KeyStore interface {
+	Lookup(ctx context.Context, key string) (name string, err error)
+}
+
+// StaticKeyStore is a KeyStore with a fixed set of keys, for example loaded from configuration.
+// Keys are held as SHA-256 hashes so that lookups do not leak timing information about the keys
+type StaticKeyStore struct {
+	names map[[sha256.Size]byte]string
+}
+
+// NewStaticKeyStore creates a StaticKeyStore from a map of client name to API key
+func NewStaticKeyStore(keys map[string]string) *StaticKeyStore {
+	names := make(map[[sha256.Size]byte]string, len(keys))
+	for name, key := range keys {
+		names[sha256.Sum256([]byte(key))] = name
+	}
+	return &StaticKeyStore{names: names}
+}
+
+// ParseStaticKeyStore creates a StaticKeyStore from a comma separated list of name:key pairs
+func ParseStaticKeyStore(config string) (*StaticKeyStore, error) {
+	keys := make(map[string]string)
+	for i, pair := range strings.Split(config, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, key, found := strings.Cut(pair, ":")
+		if !found || name == "" || key == "" {
+			// the pair is not included in the error since it may contain the key
+			return nil, fmt.Errorf("cannot parse api key %d, expected name:key", i+1)
+		}
+		if _, ok := keys[name]; ok {
+			return nil, fmt.Errorf("duplicate api key name '%s'", name)
+		}
+		keys[name] = key
+	}
+	return NewStaticKeyStore(keys), nil
+}
+
+// Lookup implements KeyStore
+func (store *StaticKeyStore) Lookup(_ context.Context, key string) (string, error) {
+	name, ok := store.names[sha256.Sum256([]byte(key))]
+	if !ok {
+		return "", ErrInvalidCredentials
+	}
+	return name, nil
+}
+
+// APIKeyAuthenticator implements Authenticator using API keys sent in the x-api-key metadata.
+// It is intended for service to service callers which cannot obtain a JWT
+type APIKeyAuthenticator struct {
+	store   KeyStore
+	roles   map[string][]string
+	tenants map[string]string
+}
+
+// NewAPIKeyAuthenticator creates an APIKeyAuthenticator which checks keys using the provided KeyStore.
+// roles are the roles granted to each client, and tenants the tenant each client acts for, both keyed by client name.
+// Either may be nil. Clients without a tenant act for tenant.Default
+func NewAPIKeyAuthenticator(store KeyStore, roles map[string][]string, tenants map[string]string) *APIKeyAuthenticator {
+	return &APIKeyAuthenticator{store: store, roles: roles, tenants: tenants}
+}
+
+// ParseTenantMap parses a comma separated list of name=tenant pairs, e.g. billing=acme,reporting=globex
+func ParseTenantMap(str string) (map[string]string, error) {
+	tenants := make(map[string]string)
+	for _, pair := range strings.Split(str, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, id, found := strings.Cut(pair, "=")
+		if !found || name == "" || !tenant.Valid(id) {
+			return nil, fmt.Errorf("cannot parse tenant '%s', expected name=tenant", pair)
+		}
+		tenants[name] = id
+	}
+	return tenants, nil
+}
+
+// Authenticate implements Authenticator. The name of the client the key was issued to is used as the subject of
+// the caller identity, and the roles granted to that client and the tenant it acts for as its roles and tenant
+func (auth *APIKeyAuthenticator) Authenticate(ctx context.Context) (Identity, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return Identity{}, ErrNoCredentials
+	}
+	keys := md.Get(APIKeyKey)
+	if len(keys) == 0 {
+		return Identity{}, ErrNoCredentials
+	}
+	name, err := auth.store.Lookup(ctx, keys[0])
+	if err != nil {
+		return Identity{}, err
+	}
+	return Identity{Subject: name, Scheme: SchemeAPIKey, Roles: auth.roles[name], Tenant: auth.tenants[name]}, nil
+}
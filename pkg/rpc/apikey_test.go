@@ -0,0 +1,92 @@
+package rpc_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/robotlovesyou/fitest/pkg/rpc"
+	"github.com/robotlovesyou/fitest/pkg/user"
+	"github.com/robotlovesyou/fitest/userspb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func withAPIKey(ctx context.Context, key string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, rpc.APIKeyKey, key)
+}
+
+func apiKeyServerOptions(t *testing.T) []grpc.ServerOption {
+	logger := nopLogger{}
+	keys, err := rpc.ParseStaticKeyStore("billing:billing-key, reporting:reporting-key")
+	require.NoError(t, err)
+	auth := rpc.AnyOf(rpc.NewJWTAuthenticator(testJWTConfig), rpc.NewAPIKeyAuthenticator(keys, nil, nil))
+	return []grpc.ServerOption{
+		grpc.UnaryInterceptor(rpc.UnaryAuthInterceptor(auth, logger)),
+	}
+}
+
+func TestCannotParseMalformedKeyStoreConfig(t *testing.T) {
+	for _, config := range []string{"no separator", ":key", "name:", "a:one,a:two"} {
+		_, err := rpc.ParseStaticKeyStore(config)
+		require.Error(t, err, config)
+	}
+}
+
+func TestStaticKeyStoreIdentifiesKeys(t *testing.T) {
+	keys := rpc.NewStaticKeyStore(map[string]string{"billing": "billing-key"})
+	name, err := keys.Lookup(context.Background(), "billing-key")
+	require.NoError(t, err)
+	require.Equal(t, "billing", name)
+
+	_, err = keys.Lookup(context.Background(), "unknown-key")
+	require.ErrorIs(t, err, rpc.ErrInvalidCredentials)
+}
+
+func TestCallersCanAuthenticateWithAPIKeyOrJWT(t *testing.T) {
+	token := signedToken(t, jwt.SigningMethodHS256, testJWTConfig.Key, validClaims("caller"))
+	cases := []struct {
+		name     string
+		ctx      context.Context
+		expected rpc.Identity
+	}{
+		{
+			name:     "API key",
+			ctx:      withAPIKey(context.Background(), "reporting-key"),
+			expected: rpc.Identity{Subject: "reporting", Scheme: rpc.SchemeAPIKey},
+		},
+		{
+			name:     "JWT",
+			ctx:      withBearerToken(context.Background(), token),
+			expected: rpc.Identity{Subject: "caller", Scheme: rpc.SchemeJWT},
+		},
+	}
+	for _, testCase := range cases {
+		t.Run(testCase.name, func(t *testing.T) {
+			stubService := newStubService()
+			request := fakeUserRef()
+			withClient(stubService, func(client userspb.UsersClient) {
+				stubService.delete = func(ctx context.Context, _ *user.Ref) error {
+					identity, ok := rpc.IdentityFromContext(ctx)
+					require.True(t, ok)
+					require.Equal(t, testCase.expected, identity)
+					return nil
+				}
+				_, err := client.DeleteUser(testCase.ctx, &request)
+				require.NoError(t, err)
+			}, apiKeyServerOptions(t)...)
+		})
+	}
+}
+
+func TestUnknownAPIKeyIsRejected(t *testing.T) {
+	stubService := newStubService()
+	request := fakeUserRef()
+	withClient(stubService, func(client userspb.UsersClient) {
+		_, err := client.DeleteUser(withAPIKey(context.Background(), "unknown-key"), &request)
+		require.Equal(t, codes.Unauthenticated.String(), status.Code(err).String())
+	}, apiKeyServerOptions(t)...)
+}
@@ -0,0 +1,163 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/robotlovesyou/fitest/pkg/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// AuthorizationKey is the metadata key used to send credentials
+	AuthorizationKey = "authorization"
+	// bearerScheme is the authorization scheme used for bearer tokens
+	bearerScheme = "bearer"
+	// Error message sent when a call cannot be authenticated
+	msgUnauthenticated = "Unauthenticated"
+	// healthServicePrefix is the method prefix of the grpc health service. It is not authenticated, so that
+	// probes and load balancers can check the health of the server
+	healthServicePrefix = "/grpc.health.v1.Health/"
+)
+
+var (
+	// ErrNoCredentials is returned by an Authenticator when the call does not carry any credentials
+	ErrNoCredentials = errors.New("no credentials provided")
+	// ErrInvalidCredentials is returned by an Authenticator when the credentials provided with the call are not valid
+	ErrInvalidCredentials = errors.New("credentials are invalid")
+)
+
+// Scheme is the means by which a caller was authenticated
+type Scheme string
+
+const (
+	SchemeJWT    Scheme = "jwt"
+	SchemeAPIKey Scheme = "api-key"
+)
+
+// Identity describes the authenticated caller of an RPC
+type Identity struct {
+	// Subject uniquely identifies the caller
+	Subject string
+	// Scheme is the means by which the caller was authenticated
+	Scheme Scheme
+	// Roles are the roles granted to the caller, which are used to authorize calls
+	Roles []string
+	// Tenant is the tenant the caller acts for. Calls by the caller can only be made for this tenant
+	Tenant string
+}
+
+// String returns a description of the identity suitable for logging
+func (identity Identity) String() string {
+	return fmt.Sprintf("%s:%s", identity.Scheme, identity.Subject)
+}
+
+type identityKey struct{}
+
+// WithIdentity returns a context carrying the provided caller identity.
+// The identity is also set as the caller for the logger
+func WithIdentity(ctx context.Context, identity Identity) context.Context {
+	ctx = log.WithCaller(ctx, identity.String())
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// IdentityFromContext returns the caller identity carried by ctx, if there is one
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(Identity)
+	return identity, ok
+}
+
+// Authenticator authenticates the caller of an RPC using the incoming metadata carried by ctx
+type Authenticator interface {
+	Authenticate(ctx context.Context) (Identity, error)
+}
+
+// firstAuthenticator implements Authenticator by trying each of its authenticators in turn
+type firstAuthenticator []Authenticator
+
+// AnyOf returns an Authenticator which accepts calls authenticated by any of the provided authenticators.
+// Each is tried in turn until one succeeds. Calls which carry no credentials for any of them fail with ErrNoCredentials
+func AnyOf(auths ...Authenticator) Authenticator {
+	return firstAuthenticator(auths)
+}
+
+func (auths firstAuthenticator) Authenticate(ctx context.Context) (Identity, error) {
+	err := ErrNoCredentials
+	for _, auth := range auths {
+		identity, authErr := auth.Authenticate(ctx)
+		if authErr == nil {
+			return identity, nil
+		}
+		// prefer reporting invalid credentials over missing ones
+		if !errors.Is(authErr, ErrNoCredentials) {
+			err = authErr
+		}
+	}
+	return Identity{}, err
+}
+
+// bearerToken extracts a bearer token from the authorization metadata carried by ctx
+func bearerToken(ctx context.Context) (string, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", ErrNoCredentials
+	}
+	for _, value := range md.Get(AuthorizationKey) {
+		scheme, token, found := strings.Cut(value, " ")
+		if found && strings.EqualFold(scheme, bearerScheme) {
+			return strings.TrimSpace(token), nil
+		}
+	}
+	return "", ErrNoCredentials
+}
+
+// authenticate authenticates the call using auth, returning a context carrying the caller identity
+func authenticate(ctx context.Context, auth Authenticator, logger Logger, method string) (context.Context, error) {
+	if strings.HasPrefix(method, healthServicePrefix) {
+		return ctx, nil
+	}
+	identity, err := auth.Authenticate(ctx)
+	if err != nil {
+		logger.Errorf(ctx, err, "cannot authenticate call to %s", method)
+		return ctx, status.Error(codes.Unauthenticated, msgUnauthenticated)
+	}
+	return WithIdentity(ctx, identity), nil
+}
+
+// UnaryAuthInterceptor returns an interceptor which rejects unary calls which cannot be authenticated by auth with
+// codes.Unauthenticated. The context passed to the handler carries the Identity of the caller
+func UnaryAuthInterceptor(auth Authenticator, logger Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := authenticate(ctx, auth, logger, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// contextStream wraps a grpc.ServerStream to replace its context
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+// StreamAuthInterceptor is the streaming equivalent of UnaryAuthInterceptor
+func StreamAuthInterceptor(auth Authenticator, logger Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(stream.Context(), auth, logger, info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &contextStream{ServerStream: stream, ctx: ctx})
+	}
+}
@@ -0,0 +1,162 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/robotlovesyou/fitest/userspb"
+	userspbv2 "github.com/robotlovesyou/fitest/userspb/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// Error message sent when the caller does not have a role allowed to make a call
+	msgPermissionDenied = "Permission denied"
+)
+
+// RolePolicy configures the roles a caller must have to call each method.
+// A caller is allowed to make a call if they have any of the roles listed for it. When no roles are listed, any
+// authenticated caller is allowed
+type RolePolicy struct {
+	// Default are the roles allowed to call methods without their own roles
+	Default []string
+	// Methods are the roles allowed to call individual methods, keyed by full method name, e.g. /Users/DeleteUser
+	Methods map[string][]string
+	// AllCountries are the roles allowed to find, count or export users without filtering them by country
+	AllCountries []string
+}
+
+// ParseRoles parses a list of roles separated by |, e.g. admin|support
+func ParseRoles(str string) []string {
+	var roles []string
+	for _, role := range strings.Split(str, "|") {
+		if role = strings.TrimSpace(role); role != "" {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// ParseRoleMap parses a comma separated list of name=roles pairs, where roles are separated by |,
+// e.g. /Users/DeleteUser=admin,/Users/FindUsers=admin|support
+func ParseRoleMap(str string) (map[string][]string, error) {
+	roleMap := make(map[string][]string)
+	for _, pair := range strings.Split(str, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, rolesStr, found := strings.Cut(pair, "=")
+		roles := ParseRoles(rolesStr)
+		if !found || name == "" || len(roles) == 0 {
+			return nil, fmt.Errorf("cannot parse roles '%s', expected name=role|role", pair)
+		}
+		roleMap[name] = roles
+	}
+	return roleMap, nil
+}
+
+func (policy RolePolicy) rolesFor(method string) []string {
+	if roles, ok := policy.Methods[method]; ok {
+		return roles
+	}
+	return policy.Default
+}
+
+// hasAnyRole returns true if allowed is empty, or if identity has any of the allowed roles
+func hasAnyRole(identity Identity, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, role := range identity.Roles {
+		for _, allowedRole := range allowed {
+			if role == allowedRole {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// allCountries returns true if req is a query for users which is not filtered by country
+func allCountries(req interface{}) bool {
+	switch query := req.(type) {
+	case *userspb.Query:
+		return query.Country == "" && len(query.Countries) == 0
+	case *userspbv2.Query:
+		return query.Country == "" && len(query.Countries) == 0
+	case *userspb.StatsQuery:
+		return query.Country == "" && len(query.Countries) == 0
+	case *userspbv2.StatsQuery:
+		return query.Country == "" && len(query.Countries) == 0
+	default:
+		return false
+	}
+}
+
+// authorize checks that the caller identified by ctx is allowed to call method
+func authorize(ctx context.Context, policy RolePolicy, logger Logger, method string) error {
+	if strings.HasPrefix(method, healthServicePrefix) {
+		return nil
+	}
+	identity, ok := IdentityFromContext(ctx)
+	if !ok || !hasAnyRole(identity, policy.rolesFor(method)) {
+		logger.Infof(ctx, "caller does not have a role allowed to call %s", method)
+		return status.Error(codes.PermissionDenied, msgPermissionDenied)
+	}
+	return nil
+}
+
+// authorizeRequest checks that the caller identified by ctx is allowed to make the request req
+func authorizeRequest(ctx context.Context, policy RolePolicy, logger Logger, req interface{}) error {
+	if !allCountries(req) {
+		return nil
+	}
+	identity, _ := IdentityFromContext(ctx)
+	if !hasAnyRole(identity, policy.AllCountries) {
+		logger.Infof(ctx, "caller does not have a role allowed to query users in all countries")
+		return status.Error(codes.PermissionDenied, msgPermissionDenied)
+	}
+	return nil
+}
+
+// UnaryAuthzInterceptor returns an interceptor which rejects unary calls by callers without a role allowed by policy
+// with codes.PermissionDenied. It must follow an auth interceptor, which identifies the caller
+func UnaryAuthzInterceptor(policy RolePolicy, logger Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := authorize(ctx, policy, logger, info.FullMethod); err != nil {
+			return nil, err
+		}
+		if err := authorizeRequest(ctx, policy, logger, req); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// authorizedStream wraps a grpc.ServerStream to authorize each message received from the caller
+type authorizedStream struct {
+	grpc.ServerStream
+	policy RolePolicy
+	logger Logger
+}
+
+func (s *authorizedStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return authorizeRequest(s.Context(), s.policy, s.logger, m)
+}
+
+// StreamAuthzInterceptor is the streaming equivalent of UnaryAuthzInterceptor
+func StreamAuthzInterceptor(policy RolePolicy, logger Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := authorize(stream.Context(), policy, logger, info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, &authorizedStream{ServerStream: stream, policy: policy, logger: logger})
+	}
+}
@@ -0,0 +1,157 @@
+package rpc_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/robotlovesyou/fitest/pkg/rpc"
+	"github.com/robotlovesyou/fitest/pkg/user"
+	"github.com/robotlovesyou/fitest/userspb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var testRolePolicy = rpc.RolePolicy{
+	Default:      []string{"reader", "admin"},
+	Methods:      map[string][]string{"/Users/DeleteUser": {"admin"}},
+	AllCountries: []string{"admin"},
+}
+
+// tokenWithRoles creates a token which will be accepted with testJWTConfig, granting the provided roles
+func tokenWithRoles(t *testing.T, roles ...string) string {
+	claims := rpc.Claims{RegisteredClaims: validClaims("caller"), Roles: roles}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(testJWTConfig.Key)
+	require.NoError(t, err)
+	return token
+}
+
+func authzServerOptions(t *testing.T) []grpc.ServerOption {
+	logger := nopLogger{}
+	keys, err := rpc.ParseStaticKeyStore("billing:billing-key")
+	require.NoError(t, err)
+	auth := rpc.AnyOf(
+		rpc.NewJWTAuthenticator(testJWTConfig),
+		rpc.NewAPIKeyAuthenticator(keys, map[string][]string{"billing": {"admin"}}, nil),
+	)
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(
+			rpc.UnaryAuthInterceptor(auth, logger),
+			rpc.UnaryAuthzInterceptor(testRolePolicy, logger),
+		),
+		grpc.ChainStreamInterceptor(
+			rpc.StreamAuthInterceptor(auth, logger),
+			rpc.StreamAuthzInterceptor(testRolePolicy, logger),
+		),
+	}
+}
+
+func TestCannotParseMalformedRoleMaps(t *testing.T) {
+	for _, str := range []string{"no separator", "=admin", "/Users/DeleteUser=", "/Users/DeleteUser=|"} {
+		_, err := rpc.ParseRoleMap(str)
+		require.Error(t, err, str)
+	}
+}
+
+func TestMethodsCanOnlyBeCalledByAllowedRoles(t *testing.T) {
+	cases := []struct {
+		name         string
+		ctx          context.Context
+		expectedCode codes.Code
+	}{
+		{
+			name:         "Admin",
+			ctx:          withBearerToken(context.Background(), tokenWithRoles(t, "admin")),
+			expectedCode: codes.OK,
+		},
+		{
+			name:         "API key with admin role",
+			ctx:          withAPIKey(context.Background(), "billing-key"),
+			expectedCode: codes.OK,
+		},
+		{
+			name:         "Reader",
+			ctx:          withBearerToken(context.Background(), tokenWithRoles(t, "reader")),
+			expectedCode: codes.PermissionDenied,
+		},
+		{
+			name:         "No roles",
+			ctx:          withBearerToken(context.Background(), tokenWithRoles(t)),
+			expectedCode: codes.PermissionDenied,
+		},
+	}
+	for _, testCase := range cases {
+		t.Run(testCase.name, func(t *testing.T) {
+			stubService := newStubService()
+			request := fakeUserRef()
+			withClient(stubService, func(client userspb.UsersClient) {
+				stubService.delete = func(context.Context, *user.Ref) error {
+					return nil
+				}
+				_, err := client.DeleteUser(testCase.ctx, &request)
+				require.Equal(t, testCase.expectedCode.String(), status.Code(err).String())
+			}, authzServerOptions(t)...)
+		})
+	}
+}
+
+func TestOnlyAllowedRolesCanFindUsersInAllCountries(t *testing.T) {
+	stubService := newStubService()
+	ctx := withBearerToken(context.Background(), tokenWithRoles(t, "reader"))
+	withClient(stubService, func(client userspb.UsersClient) {
+		stubService.find = func(context.Context, *user.Query) (user.Page, error) {
+			return user.Page{}, nil
+		}
+		query := fakeUsersQuery()
+		_, err := client.FindUsers(ctx, &query)
+		require.NoError(t, err)
+
+		query.Country = ""
+		_, err = client.FindUsers(ctx, &query)
+		require.NoError(t, err)
+
+		query.Countries = nil
+		_, err = client.FindUsers(ctx, &query)
+		require.Equal(t, codes.PermissionDenied.String(), status.Code(err).String())
+
+		adminCtx := withBearerToken(context.Background(), tokenWithRoles(t, "admin"))
+		_, err = client.FindUsers(adminCtx, &query)
+		require.NoError(t, err)
+	}, authzServerOptions(t)...)
+}
+
+func TestOnlyAllowedRolesCanGetStatsOfUsersInAllCountries(t *testing.T) {
+	stubService := newStubService()
+	ctx := withBearerToken(context.Background(), tokenWithRoles(t, "reader"))
+	withClient(stubService, func(client userspb.UsersClient) {
+		stubService.stats = func(context.Context, *user.StatsQuery) (user.Stats, error) {
+			return user.Stats{}, nil
+		}
+		_, err := client.GetUserStats(ctx, &userspb.StatsQuery{Countries: []string{"NL"}})
+		require.NoError(t, err)
+
+		_, err = client.GetUserStats(ctx, &userspb.StatsQuery{})
+		require.Equal(t, codes.PermissionDenied.String(), status.Code(err).String())
+
+		adminCtx := withBearerToken(context.Background(), tokenWithRoles(t, "admin"))
+		_, err = client.GetUserStats(adminCtx, &userspb.StatsQuery{})
+		require.NoError(t, err)
+	}, authzServerOptions(t)...)
+}
+
+func TestOnlyAllowedRolesCanExportUsersInAllCountries(t *testing.T) {
+	stubService := newStubService()
+	ctx := withBearerToken(context.Background(), tokenWithRoles(t, "reader"))
+	withClient(stubService, func(client userspb.UsersClient) {
+		query := fakeUsersQuery()
+		query.Country = ""
+		query.Countries = nil
+		// the stub service panics if it is called
+		stream, err := client.ExportUsers(ctx, &query)
+		require.NoError(t, err)
+		_, err = stream.Recv()
+		require.Equal(t, codes.PermissionDenied.String(), status.Code(err).String())
+	}, authzServerOptions(t)...)
+}
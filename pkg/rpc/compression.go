@@ -0,0 +1,64 @@
+package rpc
+
+import (
+	"compress/gzip"
+	"io"
+	"sync"
+
+	"google.golang.org/grpc"
+	// Registers the gzip compressor, so that responses to callers which compress their requests are also compressed
+	_ "google.golang.org/grpc/encoding/gzip"
+)
+
+// ThresholdCompressor gzips messages of at least threshold bytes. Smaller messages are sent in gzip format without
+// compression, since compressing them costs more than it saves
+type ThresholdCompressor struct {
+	threshold int
+	writers   sync.Pool
+}
+
+// NewThresholdCompressor creates a new ThresholdCompressor which compresses messages of at least threshold bytes
+func NewThresholdCompressor(threshold int) *ThresholdCompressor {
+	return &ThresholdCompressor{
+		threshold: threshold,
+		writers: sync.Pool{
+			New: func() interface{} {
+				return gzip.NewWriter(io.Discard)
+			},
+		},
+	}
+}
+
+// Do implements grpc.Compressor
+func (c *ThresholdCompressor) Do(w io.Writer, p []byte) error {
+	if len(p) < c.threshold {
+		z, err := gzip.NewWriterLevel(w, gzip.NoCompression)
+		if err != nil {
+			return err
+		}
+		return writeAndClose(z, p)
+	}
+	z := c.writers.Get().(*gzip.Writer)
+	defer c.writers.Put(z)
+	z.Reset(w)
+	return writeAndClose(z, p)
+}
+
+func writeAndClose(z *gzip.Writer, p []byte) error {
+	if _, err := z.Write(p); err != nil {
+		return err
+	}
+	return z.Close()
+}
+
+// Type implements grpc.Compressor
+func (c *ThresholdCompressor) Type() string {
+	return "gzip"
+}
+
+// ForceCompression returns a server option which gzips every response, whether or not the request was compressed.
+// Responses smaller than threshold bytes are not compressed. All callers must support gzip.
+// grpc.RPCCompressor is deprecated, but it is the only way for a server to choose to compress its responses
+func ForceCompression(threshold int) grpc.ServerOption {
+	return grpc.RPCCompressor(NewThresholdCompressor(threshold))
+}
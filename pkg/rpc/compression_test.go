@@ -0,0 +1,68 @@
+package rpc_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/robotlovesyou/fitest/pkg/rpc"
+	"github.com/robotlovesyou/fitest/pkg/user"
+	"github.com/robotlovesyou/fitest/userspb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	grpcgzip "google.golang.org/grpc/encoding/gzip"
+)
+
+func gunzip(t *testing.T, compressed []byte) []byte {
+	r, err := gzip.NewReader(bytes.NewReader(compressed))
+	require.NoError(t, err)
+	decompressed, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return decompressed
+}
+
+func TestThresholdCompressorOnlyCompressesLargeMessages(t *testing.T) {
+	compressor := rpc.NewThresholdCompressor(100)
+	small := bytes.Repeat([]byte("a"), 99)
+	large := bytes.Repeat([]byte("a"), 1000)
+
+	var buf bytes.Buffer
+	require.NoError(t, compressor.Do(&buf, small))
+	require.Greater(t, buf.Len(), len(small))
+	require.Equal(t, small, gunzip(t, buf.Bytes()))
+
+	buf.Reset()
+	require.NoError(t, compressor.Do(&buf, large))
+	require.Less(t, buf.Len(), len(large))
+	require.Equal(t, large, gunzip(t, buf.Bytes()))
+}
+
+func TestFindUsersResponsesCanBeCompressed(t *testing.T) {
+	cases := []struct {
+		name     string
+		opts     []grpc.ServerOption
+		callOpts []grpc.CallOption
+	}{
+		{name: "negotiated", callOpts: []grpc.CallOption{grpc.UseCompressor(grpcgzip.Name)}},
+		{name: "forced", opts: []grpc.ServerOption{rpc.ForceCompression(1024)}},
+	}
+	for _, testCase := range cases {
+		t.Run(testCase.name, func(t *testing.T) {
+			stubService := newStubService()
+			request := fakeUsersQuery()
+			request.Length = 100
+			withClient(stubService, func(client userspb.UsersClient) {
+				var response user.Page
+				stubService.find = func(ctx context.Context, query *user.Query) (user.Page, error) {
+					response = usersPageFromQuery(*query)
+					return response, nil
+				}
+				page, err := client.FindUsers(context.Background(), &request, testCase.callOpts...)
+				require.NoError(t, err)
+				require.Len(t, page.Items, len(response.Items))
+			}, testCase.opts...)
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// Error message sent when a call does not complete within its default timeout
+	msgDeadlineExceeded = "The call did not complete in time"
+)
+
+// DeadlineConfig configures the timeouts applied to calls which arrive without a deadline
+type DeadlineConfig struct {
+	// Default is the timeout for methods without their own timeout. When it is zero, calls to those methods are
+	// not given a deadline
+	Default time.Duration
+	// Methods are timeouts for individual methods, keyed by full method name, e.g. /Users/FindUsers
+	Methods map[string]time.Duration
+}
+
+// ParseMethodTimeouts parses a comma separated list of method=timeout pairs, e.g. /Users/CreateUser=2s
+func ParseMethodTimeouts(str string) (map[string]time.Duration, error) {
+	timeouts := make(map[string]time.Duration)
+	for _, pair := range strings.Split(str, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		method, timeoutStr, found := strings.Cut(pair, "=")
+		if !found || method == "" {
+			return nil, fmt.Errorf("cannot parse method timeout '%s', expected method=timeout", pair)
+		}
+		timeout, err := time.ParseDuration(timeoutStr)
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("cannot parse timeout '%s' for %s as a positive duration", timeoutStr, method)
+		}
+		timeouts[method] = timeout
+	}
+	return timeouts, nil
+}
+
+func (config DeadlineConfig) timeoutFor(method string) time.Duration {
+	if timeout, ok := config.Methods[method]; ok {
+		return timeout
+	}
+	return config.Default
+}
+
+// UnaryDeadlineInterceptor returns an interceptor which applies the configured timeout to calls whose context has no
+// deadline, so that a caller which does not set a deadline cannot hold a handler indefinitely.
+// Deadlines set by callers are left unchanged
+func UnaryDeadlineInterceptor(config DeadlineConfig) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if _, ok := ctx.Deadline(); ok {
+			return handler(ctx, req)
+		}
+		timeout := config.timeoutFor(info.FullMethod)
+		if timeout <= 0 {
+			return handler(ctx, req)
+		}
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		resp, err := handler(ctx, req)
+		if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			// the handler reports a failure caused by the deadline as an internal error
+			return nil, status.Error(codes.DeadlineExceeded, msgDeadlineExceeded)
+		}
+		return resp, err
+	}
+}
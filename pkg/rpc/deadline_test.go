@@ -0,0 +1,73 @@
+package rpc_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/robotlovesyou/fitest/pkg/rpc"
+	"github.com/robotlovesyou/fitest/pkg/user"
+	"github.com/robotlovesyou/fitest/userspb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCannotParseMalformedMethodTimeouts(t *testing.T) {
+	for _, str := range []string{"/Users/FindUsers", "=1s", "/Users/FindUsers=x", "/Users/FindUsers=0s", "/Users/FindUsers=-1s"} {
+		_, err := rpc.ParseMethodTimeouts(str)
+		require.Error(t, err, str)
+	}
+}
+
+func TestCanParseMethodTimeouts(t *testing.T) {
+	timeouts, err := rpc.ParseMethodTimeouts("/Users/CreateUser=2s, /Users/FindUsers=5s")
+	require.NoError(t, err)
+	require.Equal(t, map[string]time.Duration{
+		"/Users/CreateUser": 2 * time.Second,
+		"/Users/FindUsers":  5 * time.Second,
+	}, timeouts)
+}
+
+func deadlineServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.UnaryInterceptor(rpc.UnaryDeadlineInterceptor(rpc.DeadlineConfig{
+			Default: time.Hour,
+			Methods: map[string]time.Duration{"/Users/DeleteUser": 10 * time.Millisecond},
+		})),
+	}
+}
+
+func TestMethodTimeoutIsAppliedWithoutADeadline(t *testing.T) {
+	stubService := newStubService()
+	request := fakeUserRef()
+	withClient(stubService, func(client userspb.UsersClient) {
+		stubService.delete = func(ctx context.Context, _ *user.Ref) error {
+			deadline, ok := ctx.Deadline()
+			require.True(t, ok)
+			require.WithinDuration(t, time.Now().Add(10*time.Millisecond), deadline, 10*time.Millisecond)
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		_, err := client.DeleteUser(context.Background(), &request)
+		require.Equal(t, codes.DeadlineExceeded.String(), status.Code(err).String())
+	}, deadlineServerOptions()...)
+}
+
+func TestCallerDeadlineIsNotChanged(t *testing.T) {
+	stubService := newStubService()
+	request := fakeUserRef()
+	withClient(stubService, func(client userspb.UsersClient) {
+		stubService.delete = func(ctx context.Context, _ *user.Ref) error {
+			deadline, ok := ctx.Deadline()
+			require.True(t, ok)
+			require.WithinDuration(t, time.Now().Add(time.Minute), deadline, time.Second)
+			return nil
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		_, err := client.DeleteUser(ctx, &request)
+		require.NoError(t, err)
+	}, deadlineServerOptions()...)
+}
@@ -0,0 +1,89 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/robotlovesyou/fitest/pkg/tenant"
+)
+
+// jwtMethods are the signing methods accepted by JWTAuthenticator.
+// Restricting them prevents a token signed with "none", or with a different algorithm, being accepted
+var jwtMethods = []string{
+	jwt.SigningMethodHS256.Alg(),
+	jwt.SigningMethodHS384.Alg(),
+	jwt.SigningMethodHS512.Alg(),
+}
+
+// JWTConfig configures a JWTAuthenticator
+type JWTConfig struct {
+	// Key is the secret used to verify HMAC signed tokens
+	Key []byte
+	// Issuer, when set, must match the iss claim of the token
+	Issuer string
+	// Audience, when set, must be included in the aud claim of the token
+	Audience string
+}
+
+// Claims are the JWT claims understood by JWTAuthenticator
+type Claims struct {
+	jwt.RegisteredClaims
+	// Roles are the roles granted to the subject of the token
+	Roles []string `json:"roles,omitempty"`
+	// Tenant is the tenant the subject of the token acts for. Subjects of tokens without one act for tenant.Default
+	Tenant string `json:"tenant,omitempty"`
+}
+
+// JWTAuthenticator implements Authenticator by validating JWT bearer tokens
+type JWTAuthenticator struct {
+	config JWTConfig
+	parser *jwt.Parser
+}
+
+// NewJWTAuthenticator creates a new JWTAuthenticator with the provided config
+func NewJWTAuthenticator(config JWTConfig) *JWTAuthenticator {
+	return &JWTAuthenticator{
+		config: config,
+		parser: jwt.NewParser(jwt.WithValidMethods(jwtMethods)),
+	}
+}
+
+func (auth *JWTAuthenticator) key(*jwt.Token) (interface{}, error) {
+	return auth.config.Key, nil
+}
+
+// validate checks the token and returns its claims
+func (auth *JWTAuthenticator) validate(token string) (*Claims, error) {
+	var claims Claims
+	if _, err := auth.parser.ParseWithClaims(token, &claims, auth.key); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+	if auth.config.Issuer != "" && !claims.VerifyIssuer(auth.config.Issuer, true) {
+		return nil, fmt.Errorf("%w: unexpected issuer %s", ErrInvalidCredentials, claims.Issuer)
+	}
+	if auth.config.Audience != "" && !claims.VerifyAudience(auth.config.Audience, true) {
+		return nil, fmt.Errorf("%w: unexpected audience %v", ErrInvalidCredentials, claims.Audience)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidCredentials)
+	}
+	if claims.Tenant != tenant.Default && !tenant.Valid(claims.Tenant) {
+		return nil, fmt.Errorf("%w: invalid tenant", ErrInvalidCredentials)
+	}
+	return &claims, nil
+}
+
+// Authenticate implements Authenticator. The subject, roles and tenant of the token are used as the subject, roles and
+// tenant of the caller identity
+func (auth *JWTAuthenticator) Authenticate(ctx context.Context) (Identity, error) {
+	token, err := bearerToken(ctx)
+	if err != nil {
+		return Identity{}, err
+	}
+	claims, err := auth.validate(token)
+	if err != nil {
+		return Identity{}, err
+	}
+	return Identity{Subject: claims.Subject, Scheme: SchemeJWT, Roles: claims.Roles, Tenant: claims.Tenant}, nil
+}
@@ -0,0 +1,117 @@
+package rpc_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/robotlovesyou/fitest/pkg/rpc"
+	"github.com/robotlovesyou/fitest/pkg/user"
+	"github.com/robotlovesyou/fitest/userspb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var testJWTConfig = rpc.JWTConfig{
+	Key:      []byte("a super secret signing key"),
+	Issuer:   "test-issuer",
+	Audience: "users",
+}
+
+// signedToken creates a token signed with key, with the provided claims
+func signedToken(t *testing.T, method jwt.SigningMethod, key interface{}, claims jwt.RegisteredClaims) string {
+	token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	require.NoError(t, err)
+	return token
+}
+
+// validClaims returns claims which will be accepted with testJWTConfig
+func validClaims(subject string) jwt.RegisteredClaims {
+	return jwt.RegisteredClaims{
+		Subject:   subject,
+		Issuer:    testJWTConfig.Issuer,
+		Audience:  jwt.ClaimStrings{testJWTConfig.Audience},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}
+}
+
+func withBearerToken(ctx context.Context, token string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, rpc.AuthorizationKey, "Bearer "+token)
+}
+
+func jwtServerOptions() []grpc.ServerOption {
+	logger := nopLogger{}
+	auth := rpc.NewJWTAuthenticator(testJWTConfig)
+	return []grpc.ServerOption{
+		grpc.UnaryInterceptor(rpc.UnaryAuthInterceptor(auth, logger)),
+		grpc.StreamInterceptor(rpc.StreamAuthInterceptor(auth, logger)),
+	}
+}
+
+func TestValidJWTIsAcceptedAndIdentityIsInjected(t *testing.T) {
+	stubService := newStubService()
+	request := fakeUserRef()
+	withClient(stubService, func(client userspb.UsersClient) {
+		stubService.delete = func(ctx context.Context, _ *user.Ref) error {
+			identity, ok := rpc.IdentityFromContext(ctx)
+			require.True(t, ok)
+			require.Equal(t, "caller", identity.Subject)
+			return nil
+		}
+
+		token := signedToken(t, jwt.SigningMethodHS256, testJWTConfig.Key, validClaims("caller"))
+		_, err := client.DeleteUser(withBearerToken(context.Background(), token), &request)
+		require.NoError(t, err)
+	}, jwtServerOptions()...)
+}
+
+func TestInvalidJWTsAreRejected(t *testing.T) {
+	expired := validClaims("caller")
+	expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-1 * time.Hour))
+	wrongIssuer := validClaims("caller")
+	wrongIssuer.Issuer = "someone else"
+	wrongAudience := validClaims("caller")
+	wrongAudience.Audience = jwt.ClaimStrings{"another service"}
+
+	cases := []struct {
+		name  string
+		token string
+	}{
+		{name: "Missing", token: ""},
+		{name: "Malformed", token: "not a jwt"},
+		{name: "Wrong key", token: signedToken(t, jwt.SigningMethodHS256, []byte("wrong key"), validClaims("caller"))},
+		{name: "Unsigned", token: signedToken(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, validClaims("caller"))},
+		{name: "Expired", token: signedToken(t, jwt.SigningMethodHS256, testJWTConfig.Key, expired)},
+		{name: "Wrong issuer", token: signedToken(t, jwt.SigningMethodHS256, testJWTConfig.Key, wrongIssuer)},
+		{name: "Wrong audience", token: signedToken(t, jwt.SigningMethodHS256, testJWTConfig.Key, wrongAudience)},
+		{name: "Missing subject", token: signedToken(t, jwt.SigningMethodHS256, testJWTConfig.Key, validClaims(""))},
+	}
+	for _, testCase := range cases {
+		t.Run(testCase.name, func(t *testing.T) {
+			stubService := newStubService()
+			request := fakeUserRef()
+			withClient(stubService, func(client userspb.UsersClient) {
+				ctx := context.Background()
+				if testCase.token != "" {
+					ctx = withBearerToken(ctx, testCase.token)
+				}
+				_, err := client.DeleteUser(ctx, &request)
+				require.Equal(t, codes.Unauthenticated.String(), status.Code(err).String())
+			}, jwtServerOptions()...)
+		})
+	}
+}
+
+func TestWatchUsersRequiresValidJWT(t *testing.T) {
+	stubService := newStubService()
+	withClient(stubService, func(client userspb.UsersClient) {
+		stream, err := client.WatchUsers(context.Background(), &userspb.WatchRequest{})
+		require.NoError(t, err)
+		_, err = stream.Recv()
+		require.Equal(t, codes.Unauthenticated.String(), status.Code(err).String())
+	}, jwtServerOptions()...)
+}
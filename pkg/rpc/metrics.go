@@ -0,0 +1,74 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// metricsNamespace prefixes the names of the metrics recorded for RPC calls
+	metricsNamespace = "users"
+)
+
+// Metrics records the count, status code and latency of RPC calls for each method
+type Metrics struct {
+	requests *prometheus.CounterVec
+	latency  *prometheus.HistogramVec
+}
+
+// NewMetrics creates Metrics and registers them with registerer
+func NewMetrics(registerer prometheus.Registerer) (*Metrics, error) {
+	m := &Metrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "rpc",
+			Name:      "requests_total",
+			Help:      "Count of RPC calls by method and status code",
+		}, []string{"method", "code"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "rpc",
+			Name:      "request_duration_seconds",
+			Help:      "Latency of RPC calls by method. For streams, this is the lifetime of the stream",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method"}),
+	}
+	for _, c := range []prometheus.Collector{m.requests, m.latency} {
+		if err := registerer.Register(c); err != nil {
+			return nil, fmt.Errorf("cannot register rpc metrics: %w", err)
+		}
+	}
+	return m, nil
+}
+
+// observe records a call to method which started at start and returned err
+func (m *Metrics) observe(method string, start time.Time, err error) {
+	m.requests.WithLabelValues(method, status.Code(err).String()).Inc()
+	m.latency.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
+
+// UnaryMetricsInterceptor returns an interceptor which records the metrics of each call. It should be chained
+// before any interceptor which can reject calls, so that rejected calls are also recorded
+func UnaryMetricsInterceptor(m *Metrics) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		res, err := handler(ctx, req)
+		m.observe(info.FullMethod, start, err)
+		return res, err
+	}
+}
+
+// StreamMetricsInterceptor is the streaming equivalent of UnaryMetricsInterceptor
+func StreamMetricsInterceptor(m *Metrics) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, stream)
+		m.observe(info.FullMethod, start, err)
+		return err
+	}
+}
@@ -0,0 +1,57 @@
+package rpc_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/robotlovesyou/fitest/pkg/rpc"
+	"github.com/robotlovesyou/fitest/pkg/user"
+	"github.com/robotlovesyou/fitest/userspb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+func TestMetricsAreRecordedForEachMethodAndCode(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	metrics, err := rpc.NewMetrics(registry)
+	require.NoError(t, err)
+
+	stubService := newStubService()
+	request := fakeUserRef()
+	withClient(stubService, func(client userspb.UsersClient) {
+		stubService.delete = func(context.Context, *user.Ref) error {
+			return nil
+		}
+		_, err := client.DeleteUser(context.Background(), &request)
+		require.NoError(t, err)
+
+		stubService.delete = func(context.Context, *user.Ref) error {
+			return user.ErrNotFound
+		}
+		_, err = client.DeleteUser(context.Background(), &request)
+		require.Error(t, err)
+	}, grpc.UnaryInterceptor(rpc.UnaryMetricsInterceptor(metrics)))
+
+	expected := `
+# HELP users_rpc_requests_total Count of RPC calls by method and status code
+# TYPE users_rpc_requests_total counter
+users_rpc_requests_total{code="NotFound",method="/Users/DeleteUser"} 1
+users_rpc_requests_total{code="OK",method="/Users/DeleteUser"} 1
+`
+	require.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected), "users_rpc_requests_total"))
+
+	count, err := testutil.GatherAndCount(registry, "users_rpc_request_duration_seconds")
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+}
+
+func TestMetricsCannotBeRegisteredTwice(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	_, err := rpc.NewMetrics(registry)
+	require.NoError(t, err)
+	_, err = rpc.NewMetrics(registry)
+	require.Error(t, err)
+}
@@ -0,0 +1,212 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// Error message sent when a client has used its quota of calls
+	msgQuotaExceeded = "Quota exceeded, retry in the next period"
+	// quotaKeyPrefix is the prefix of the keys used to count calls in a QuotaStore
+	quotaKeyPrefix = "quota"
+)
+
+// Quota is the number of calls a client can make each day and each month. A zero value means unlimited
+type Quota struct {
+	Daily   int64
+	Monthly int64
+}
+
+// ParseQuota parses a quota in the form daily:monthly. Either may be 0 for unlimited
+func ParseQuota(str string) (Quota, error) {
+	dailyStr, monthlyStr, found := strings.Cut(str, ":")
+	if !found {
+		return Quota{}, fmt.Errorf("cannot parse quota '%s', expected daily:monthly", str)
+	}
+	daily, err := strconv.ParseInt(dailyStr, 10, 64)
+	if err != nil || daily < 0 {
+		return Quota{}, fmt.Errorf("cannot parse daily quota '%s' as a non negative integer", dailyStr)
+	}
+	monthly, err := strconv.ParseInt(monthlyStr, 10, 64)
+	if err != nil || monthly < 0 {
+		return Quota{}, fmt.Errorf("cannot parse monthly quota '%s' as a non negative integer", monthlyStr)
+	}
+	return Quota{Daily: daily, Monthly: monthly}, nil
+}
+
+// ParseClientQuotas parses a comma separated list of name=daily:monthly quotas
+func ParseClientQuotas(str string) (map[string]Quota, error) {
+	quotas := make(map[string]Quota)
+	for _, pair := range strings.Split(str, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, quotaStr, found := strings.Cut(pair, "=")
+		if !found || name == "" {
+			return nil, fmt.Errorf("cannot parse client quota '%s', expected name=daily:monthly", pair)
+		}
+		quota, err := ParseQuota(quotaStr)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse quota for %s: %w", name, err)
+		}
+		quotas[name] = quota
+	}
+	return quotas, nil
+}
+
+// QuotaConfig configures the quotas of API key clients
+type QuotaConfig struct {
+	// Default is the quota of clients without their own quota
+	Default Quota
+	// Clients are the quotas of individual clients, keyed by the name their API key was issued to
+	Clients map[string]Quota
+}
+
+func (config QuotaConfig) quotaFor(client string) Quota {
+	if quota, ok := config.Clients[client]; ok {
+		return quota
+	}
+	return config.Default
+}
+
+// QuotaStore counts the calls made by clients. Counts must be shared by every instance of the service for quotas
+// to be enforced across them
+type QuotaStore interface {
+	// Increment adds one to the count for key and returns the new count.
+	// The count is discarded at expiresAt, so that the next call to Increment returns 1
+	Increment(ctx context.Context, key string, expiresAt time.Time) (int64, error)
+}
+
+type counter struct {
+	count     int64
+	expiresAt time.Time
+}
+
+// MemoryQuotaStore is a QuotaStore which keeps counts in memory. Counts are not shared between instances of the
+// service, or kept when it restarts, so it is only suitable when a single instance is run
+type MemoryQuotaStore struct {
+	mtx      sync.Mutex
+	counters map[string]*counter
+}
+
+// NewMemoryQuotaStore creates a new MemoryQuotaStore
+func NewMemoryQuotaStore() *MemoryQuotaStore {
+	return &MemoryQuotaStore{counters: make(map[string]*counter)}
+}
+
+// sweep discards expired counters. It must be called with the mutex held
+func (store *MemoryQuotaStore) sweep(now time.Time) {
+	for key, c := range store.counters {
+		if !now.Before(c.expiresAt) {
+			delete(store.counters, key)
+		}
+	}
+}
+
+// Increment implements QuotaStore
+func (store *MemoryQuotaStore) Increment(_ context.Context, key string, expiresAt time.Time) (int64, error) {
+	store.mtx.Lock()
+	defer store.mtx.Unlock()
+
+	now := time.Now()
+	c, ok := store.counters[key]
+	if !ok || !now.Before(c.expiresAt) {
+		if len(store.counters) >= limiterSweepSize {
+			store.sweep(now)
+		}
+		c = &counter{expiresAt: expiresAt}
+		store.counters[key] = c
+	}
+	c.count++
+	return c.count, nil
+}
+
+// QuotaLimiter enforces the daily and monthly quotas of API key clients. Days and months are in UTC
+type QuotaLimiter struct {
+	config QuotaConfig
+	store  QuotaStore
+}
+
+// NewQuotaLimiter creates a new QuotaLimiter which counts calls in store
+func NewQuotaLimiter(config QuotaConfig, store QuotaStore) *QuotaLimiter {
+	return &QuotaLimiter{config: config, store: store}
+}
+
+// within increments the count for a period and reports whether it is within limit
+func (ql *QuotaLimiter) within(ctx context.Context, key string, expiresAt time.Time, limit int64) (bool, error) {
+	if limit == 0 {
+		return true, nil
+	}
+	count, err := ql.store.Increment(ctx, key, expiresAt)
+	if err != nil {
+		return false, err
+	}
+	return count <= limit, nil
+}
+
+// Allow reports whether client may make another call, counting the call against its quota if it can.
+// The monthly count is not incremented by calls rejected because of the daily quota
+func (ql *QuotaLimiter) Allow(ctx context.Context, client string) (bool, error) {
+	quota := ql.config.quotaFor(client)
+	now := time.Now().UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	ok, err := ql.within(ctx, fmt.Sprintf("%s:%s:%s", quotaKeyPrefix, client, day.Format("2006-01-02")), day.AddDate(0, 0, 1), quota.Daily)
+	if err != nil || !ok {
+		return ok, err
+	}
+	return ql.within(ctx, fmt.Sprintf("%s:%s:%s", quotaKeyPrefix, client, month.Format("2006-01")), month.AddDate(0, 1, 0), quota.Monthly)
+}
+
+// checkQuota rejects the call with codes.ResourceExhausted if the API key client identified by ctx has used its
+// quota. Other callers do not have quotas. If the quota store fails the call is allowed, so that an outage of the
+// store does not also take down the service
+func checkQuota(ctx context.Context, limiter *QuotaLimiter, logger Logger, method string) error {
+	identity, ok := IdentityFromContext(ctx)
+	if !ok || identity.Scheme != SchemeAPIKey {
+		return nil
+	}
+	allowed, err := limiter.Allow(ctx, identity.Subject)
+	if err != nil {
+		logger.Errorf(ctx, err, "cannot check quota of %s, allowing call to %s", identity, method)
+		return nil
+	}
+	if !allowed {
+		err = status.Error(codes.ResourceExhausted, msgQuotaExceeded)
+		logger.Errorf(ctx, err, "quota exceeded by %s calling %s", identity, method)
+		return err
+	}
+	return nil
+}
+
+// UnaryQuotaInterceptor returns an interceptor which rejects calls by API key clients which have used their quota
+// with codes.ResourceExhausted. It must follow an auth interceptor, which identifies the caller
+func UnaryQuotaInterceptor(limiter *QuotaLimiter, logger Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := checkQuota(ctx, limiter, logger, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamQuotaInterceptor is the streaming equivalent of UnaryQuotaInterceptor. Each stream counts as one call
+func StreamQuotaInterceptor(limiter *QuotaLimiter, logger Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := checkQuota(stream.Context(), limiter, logger, info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, stream)
+	}
+}
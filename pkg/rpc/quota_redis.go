@@ -0,0 +1,43 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/robotlovesyou/fitest/pkg/redis"
+)
+
+// incrementScript increments a counter, setting its expiry when it is created, in a single atomic step
+var incrementScript = goredis.NewScript(`local count = redis.call('INCR', KEYS[1])
+if count == 1 then
+	redis.call('EXPIREAT', KEYS[1], ARGV[1])
+end
+return count`)
+
+// RedisQuotaStore is a QuotaStore which keeps counts in redis, so that they are shared by every instance of the
+// service
+type RedisQuotaStore struct {
+	client *goredis.Client
+}
+
+// NewRedisQuotaStore creates a RedisQuotaStore for the redis server at addr, e.g. redis:6379.
+// Connections are opened on first use
+func NewRedisQuotaStore(addr string) *RedisQuotaStore {
+	return &RedisQuotaStore{client: redis.New(addr)}
+}
+
+// Increment implements QuotaStore
+func (store *RedisQuotaStore) Increment(ctx context.Context, key string, expiresAt time.Time) (int64, error) {
+	count, err := incrementScript.Run(ctx, store.client, []string{key}, expiresAt.Unix()).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("cannot increment quota counter: %w", err)
+	}
+	return count, nil
+}
+
+// Close closes the connections to redis
+func (store *RedisQuotaStore) Close() error {
+	return store.client.Close()
+}
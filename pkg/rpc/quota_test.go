@@ -0,0 +1,155 @@
+package rpc_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/robotlovesyou/fitest/pkg/rpc"
+	"github.com/robotlovesyou/fitest/pkg/user"
+	"github.com/robotlovesyou/fitest/userspb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type failingQuotaStore struct{}
+
+func (failingQuotaStore) Increment(context.Context, string, time.Time) (int64, error) {
+	return 0, errors.New("store is down")
+}
+
+func quotaServerOptions(t *testing.T, limiter *rpc.QuotaLimiter) []grpc.ServerOption {
+	logger := nopLogger{}
+	keys, err := rpc.ParseStaticKeyStore("billing:billing-key")
+	require.NoError(t, err)
+	auth := rpc.AnyOf(rpc.NewJWTAuthenticator(testJWTConfig), rpc.NewAPIKeyAuthenticator(keys, nil, nil))
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(
+			rpc.UnaryAuthInterceptor(auth, logger),
+			rpc.UnaryQuotaInterceptor(limiter, logger),
+		),
+	}
+}
+
+func TestCannotParseMalformedQuotas(t *testing.T) {
+	for _, str := range []string{"", "10", "x:1", "1:x", "-1:1", "1:-1"} {
+		_, err := rpc.ParseQuota(str)
+		require.Error(t, err, str)
+	}
+	_, err := rpc.ParseClientQuotas("billing=1")
+	require.Error(t, err)
+	_, err = rpc.ParseClientQuotas("=1:1")
+	require.Error(t, err)
+}
+
+func TestCanParseClientQuotas(t *testing.T) {
+	quotas, err := rpc.ParseClientQuotas("billing=100:0, crm=0:1000")
+	require.NoError(t, err)
+	require.Equal(t, map[string]rpc.Quota{
+		"billing": {Daily: 100},
+		"crm":     {Monthly: 1000},
+	}, quotas)
+}
+
+func TestMemoryQuotaStoreDiscardsExpiredCounts(t *testing.T) {
+	store := rpc.NewMemoryQuotaStore()
+	future := time.Now().Add(time.Hour)
+
+	count, err := store.Increment(context.Background(), "a", future)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), count)
+	count, err = store.Increment(context.Background(), "a", future)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), count)
+
+	past := time.Now().Add(-time.Hour)
+	for i := 0; i < 2; i++ {
+		count, err = store.Increment(context.Background(), "b", past)
+		require.NoError(t, err)
+		require.Equal(t, int64(1), count)
+	}
+}
+
+func TestQuotaLimiterLimitsEachClientSeparately(t *testing.T) {
+	limiter := rpc.NewQuotaLimiter(rpc.QuotaConfig{
+		Default: rpc.Quota{Daily: 2},
+		Clients: map[string]rpc.Quota{"crm": {Monthly: 1}},
+	}, rpc.NewMemoryQuotaStore())
+
+	for _, expected := range []bool{true, true, false} {
+		allowed, err := limiter.Allow(context.Background(), "billing")
+		require.NoError(t, err)
+		require.Equal(t, expected, allowed)
+	}
+	for _, expected := range []bool{true, false} {
+		allowed, err := limiter.Allow(context.Background(), "crm")
+		require.NoError(t, err)
+		require.Equal(t, expected, allowed)
+	}
+}
+
+func TestCallsByAPIKeyClientsOverQuotaAreRejected(t *testing.T) {
+	limiter := rpc.NewQuotaLimiter(rpc.QuotaConfig{Default: rpc.Quota{Daily: 1}}, rpc.NewMemoryQuotaStore())
+	stubService := newStubService()
+	stubService.delete = func(context.Context, *user.Ref) error {
+		return nil
+	}
+	request := fakeUserRef()
+	withClient(stubService, func(client userspb.UsersClient) {
+		_, err := client.DeleteUser(withAPIKey(context.Background(), "billing-key"), &request)
+		require.NoError(t, err)
+
+		_, err = client.DeleteUser(withAPIKey(context.Background(), "billing-key"), &request)
+		require.Equal(t, codes.ResourceExhausted.String(), status.Code(err).String())
+
+		// callers authenticated with a JWT do not have quotas
+		for i := 0; i < 2; i++ {
+			_, err = client.DeleteUser(withBearerToken(context.Background(), tokenWithRoles(t)), &request)
+			require.NoError(t, err)
+		}
+	}, quotaServerOptions(t, limiter)...)
+}
+
+func TestCallsAreAllowedWhenTheQuotaStoreFails(t *testing.T) {
+	limiter := rpc.NewQuotaLimiter(rpc.QuotaConfig{Default: rpc.Quota{Daily: 1}}, failingQuotaStore{})
+	stubService := newStubService()
+	stubService.delete = func(context.Context, *user.Ref) error {
+		return nil
+	}
+	request := fakeUserRef()
+	withClient(stubService, func(client userspb.UsersClient) {
+		_, err := client.DeleteUser(withAPIKey(context.Background(), "billing-key"), &request)
+		require.NoError(t, err)
+	}, quotaServerOptions(t, limiter)...)
+}
+
+func TestRedisQuotaStoreIncrementsCounts(t *testing.T) {
+	server := miniredis.RunT(t)
+	server.SetTime(time.Unix(1699990000, 0))
+	store := rpc.NewRedisQuotaStore(server.Addr())
+	defer store.Close()
+	expiresAt := time.Unix(1700000000, 0)
+
+	count, err := store.Increment(context.Background(), "quota:billing:2023-11-14", expiresAt)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), count)
+	require.Equal(t, 10000*time.Second, server.TTL("quota:billing:2023-11-14"))
+
+	count, err = store.Increment(context.Background(), "quota:billing:2023-11-14", expiresAt)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), count)
+}
+
+func TestRedisQuotaStoreReturnsRedisErrors(t *testing.T) {
+	server := miniredis.RunT(t)
+	store := rpc.NewRedisQuotaStore(server.Addr())
+	defer store.Close()
+	server.SetError("ERR something went wrong")
+
+	_, err := store.Increment(context.Background(), "key", time.Now())
+	require.ErrorContains(t, err, "something went wrong")
+}
@@ -0,0 +1,175 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// Error message sent when a call is rate limited
+	msgRateLimited = "Rate limit exceeded, retry later"
+	// LimiterIdleTimeout is the time after which the bucket for an idle client is discarded. It should be configurable
+	LimiterIdleTimeout = 10 * time.Minute
+	// limiterSweepSize is the number of buckets above which idle buckets are discarded
+	limiterSweepSize = 10000
+	// anonymousClient is used as the client identity for calls without an identity or peer
+	anonymousClient = "anonymous"
+)
+
+// Limit is the rate at which a client can call a method
+type Limit struct {
+	// Rate is the number of calls allowed per second
+	Rate float64
+	// Burst is the number of calls which can be made at once
+	Burst int
+}
+
+// ParseLimit parses a limit in the form rate:burst
+func ParseLimit(str string) (Limit, error) {
+	rateStr, burstStr, found := strings.Cut(str, ":")
+	if !found {
+		return Limit{}, fmt.Errorf("cannot parse limit '%s', expected rate:burst", str)
+	}
+	r, err := strconv.ParseFloat(rateStr, 64)
+	if err != nil || r <= 0 {
+		return Limit{}, fmt.Errorf("cannot parse rate '%s' as a positive number", rateStr)
+	}
+	burst, err := strconv.Atoi(burstStr)
+	if err != nil || burst <= 0 {
+		return Limit{}, fmt.Errorf("cannot parse burst '%s' as a positive integer", burstStr)
+	}
+	return Limit{Rate: r, Burst: burst}, nil
+}
+
+// RateLimitConfig configures a RateLimiter
+type RateLimitConfig struct {
+	// Default is the limit applied to methods without their own limit
+	Default Limit
+	// Methods are limits for individual methods, keyed by full method name, e.g. /Users/FindUsers
+	Methods map[string]Limit
+}
+
+// ParseMethodLimits parses a comma separated list of method=rate:burst limits
+func ParseMethodLimits(str string) (map[string]Limit, error) {
+	limits := make(map[string]Limit)
+	for _, pair := range strings.Split(str, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		method, limitStr, found := strings.Cut(pair, "=")
+		if !found || method == "" {
+			return nil, fmt.Errorf("cannot parse method limit '%s', expected method=rate:burst", pair)
+		}
+		limit, err := ParseLimit(limitStr)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse limit for %s: %w", method, err)
+		}
+		limits[method] = limit
+	}
+	return limits, nil
+}
+
+type bucketKey struct {
+	client string
+	method string
+}
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// RateLimiter limits the rate of calls to each method by each client using a token bucket per client and method
+type RateLimiter struct {
+	config  RateLimitConfig
+	mtx     sync.Mutex
+	buckets map[bucketKey]*bucket
+}
+
+// NewRateLimiter creates a new RateLimiter with the provided config
+func NewRateLimiter(config RateLimitConfig) *RateLimiter {
+	return &RateLimiter{
+		config:  config,
+		buckets: make(map[bucketKey]*bucket),
+	}
+}
+
+func (rl *RateLimiter) limitFor(method string) Limit {
+	if limit, ok := rl.config.Methods[method]; ok {
+		return limit
+	}
+	return rl.config.Default
+}
+
+// sweep discards the buckets of clients which have been idle for longer than LimiterIdleTimeout.
+// It must be called with the mutex held
+func (rl *RateLimiter) sweep(now time.Time) {
+	for key, b := range rl.buckets {
+		if now.Sub(b.lastSeen) > LimiterIdleTimeout {
+			delete(rl.buckets, key)
+		}
+	}
+}
+
+// Allow reports whether client may call method now, consuming a token if it can
+func (rl *RateLimiter) Allow(client, method string) bool {
+	rl.mtx.Lock()
+	defer rl.mtx.Unlock()
+
+	now := time.Now()
+	key := bucketKey{client: client, method: method}
+	b, ok := rl.buckets[key]
+	if !ok {
+		if len(rl.buckets) >= limiterSweepSize {
+			rl.sweep(now)
+		}
+		limit := rl.limitFor(method)
+		b = &bucket{limiter: rate.NewLimiter(rate.Limit(limit.Rate), limit.Burst)}
+		rl.buckets[key] = b
+	}
+	b.lastSeen = now
+	return b.limiter.AllowN(now, 1)
+}
+
+// clientFromContext identifies the client making a call. Authenticated callers are identified by their identity,
+// and others by their address
+func clientFromContext(ctx context.Context) string {
+	if identity, ok := IdentityFromContext(ctx); ok {
+		return identity.String()
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		host := p.Addr.String()
+		// ignore the port, since a client can make calls from many
+		if idx := strings.LastIndex(host, ":"); idx > 0 {
+			host = host[:idx]
+		}
+		return host
+	}
+	return anonymousClient
+}
+
+// UnaryRateLimitInterceptor returns an interceptor which rejects calls exceeding the limits of limiter with
+// codes.ResourceExhausted. It should be chained after any authentication interceptor so that callers are
+// identified by their identity rather than their address
+func UnaryRateLimitInterceptor(limiter *RateLimiter, logger Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		client := clientFromContext(ctx)
+		if !limiter.Allow(client, info.FullMethod) {
+			err := status.Error(codes.ResourceExhausted, msgRateLimited)
+			logger.Errorf(ctx, err, "rate limited call to %s by %s", info.FullMethod, client)
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
@@ -0,0 +1,62 @@
+package rpc_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/robotlovesyou/fitest/pkg/rpc"
+	"github.com/robotlovesyou/fitest/pkg/user"
+	"github.com/robotlovesyou/fitest/userspb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// a rate so low that no tokens are replenished during a test
+const slowRate = 0.0001
+
+func TestRateLimiterLimitsEachClientAndMethodSeparately(t *testing.T) {
+	limiter := rpc.NewRateLimiter(rpc.RateLimitConfig{
+		Default: rpc.Limit{Rate: slowRate, Burst: 2},
+		Methods: map[string]rpc.Limit{"/Users/FindUsers": {Rate: slowRate, Burst: 1}},
+	})
+
+	require.True(t, limiter.Allow("a", "/Users/DeleteUser"))
+	require.True(t, limiter.Allow("a", "/Users/DeleteUser"))
+	require.False(t, limiter.Allow("a", "/Users/DeleteUser"))
+
+	// another client has its own bucket
+	require.True(t, limiter.Allow("b", "/Users/DeleteUser"))
+
+	// another method has its own bucket and limit
+	require.True(t, limiter.Allow("a", "/Users/FindUsers"))
+	require.False(t, limiter.Allow("a", "/Users/FindUsers"))
+}
+
+func TestCannotParseMalformedLimits(t *testing.T) {
+	for _, str := range []string{"", "10", "x:1", "10:x", "0:1", "1:0", "-1:1"} {
+		_, err := rpc.ParseLimit(str)
+		require.Error(t, err, str)
+	}
+	_, err := rpc.ParseMethodLimits("/Users/FindUsers=1")
+	require.Error(t, err)
+}
+
+func TestRateLimitedCallsAreRejected(t *testing.T) {
+	logger := nopLogger{}
+	limiter := rpc.NewRateLimiter(rpc.RateLimitConfig{Default: rpc.Limit{Rate: slowRate, Burst: 1}})
+
+	stubService := newStubService()
+	request := fakeUserRef()
+	withClient(stubService, func(client userspb.UsersClient) {
+		stubService.delete = func(context.Context, *user.Ref) error {
+			return nil
+		}
+		_, err := client.DeleteUser(context.Background(), &request)
+		require.NoError(t, err)
+
+		_, err = client.DeleteUser(context.Background(), &request)
+		require.Equal(t, codes.ResourceExhausted.String(), status.Code(err).String())
+	}, grpc.UnaryInterceptor(rpc.UnaryRateLimitInterceptor(limiter, logger)))
+}
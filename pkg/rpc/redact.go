@@ -0,0 +1,87 @@
+package rpc
+
+import (
+	"context"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/robotlovesyou/fitest/userspb"
+	"google.golang.org/grpc"
+)
+
+const (
+	// mask replaces the redacted part of a value
+	mask = "***"
+)
+
+// RedactionPolicy configures which callers receive users with their personal information masked
+type RedactionPolicy struct {
+	// FullRecordRoles are the roles allowed to receive full records. Callers without any of them receive redacted
+	// records. When it is empty, records are not redacted
+	FullRecordRoles []string
+}
+
+type redactKey struct{}
+
+// redacting returns true if users sent in response to the call carrying ctx must be redacted
+func redacting(ctx context.Context) bool {
+	redact, _ := ctx.Value(redactKey{}).(bool)
+	return redact
+}
+
+// withRedaction returns a context which records whether the caller identified by ctx must receive redacted users
+func withRedaction(ctx context.Context, policy RedactionPolicy) context.Context {
+	if len(policy.FullRecordRoles) == 0 {
+		return ctx
+	}
+	identity, _ := IdentityFromContext(ctx)
+	return context.WithValue(ctx, redactKey{}, !hasAnyRole(identity, policy.FullRecordRoles))
+}
+
+// maskName keeps the first letter of a name, e.g. Jane becomes J***
+func maskName(name string) string {
+	if name == "" {
+		return ""
+	}
+	r, _ := utf8.DecodeRuneInString(name)
+	return string(r) + mask
+}
+
+// maskEmail keeps the first letter and the domain of an email address, e.g. jane@example.com becomes j***@example.com
+func maskEmail(email string) string {
+	local, domain, found := strings.Cut(email, "@")
+	if !found {
+		return maskName(email)
+	}
+	return maskName(local) + "@" + domain
+}
+
+// redact masks the personal information of usr if the caller identified by ctx must receive redacted users.
+// The names and email address are masked. The id, nickname and country are kept so that users can still be
+// referred to and filtered
+func redact(ctx context.Context, usr *userspb.User) *userspb.User {
+	if usr == nil || !redacting(ctx) {
+		return usr
+	}
+	usr.FirstName = maskName(usr.FirstName)
+	usr.LastName = maskName(usr.LastName)
+	usr.Email = maskEmail(usr.Email)
+	return usr
+}
+
+// UnaryRedactionInterceptor returns an interceptor which causes users to be redacted in responses to callers without
+// a role allowed to receive full records by policy. It must follow an auth interceptor, which identifies the caller.
+// Users are not redacted in responses to CreateUser or Authenticate, since the caller already knows their details,
+// or AnonymizeUser, since anonymized users have no personal information left to redact
+func UnaryRedactionInterceptor(policy RedactionPolicy) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return handler(withRedaction(ctx, policy), req)
+	}
+}
+
+// StreamRedactionInterceptor is the streaming equivalent of UnaryRedactionInterceptor
+func StreamRedactionInterceptor(policy RedactionPolicy) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &contextStream{ServerStream: stream, ctx: withRedaction(stream.Context(), policy)})
+	}
+}
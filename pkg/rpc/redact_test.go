@@ -0,0 +1,113 @@
+package rpc_test
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/robotlovesyou/fitest/pkg/rpc"
+	"github.com/robotlovesyou/fitest/pkg/user"
+	"github.com/robotlovesyou/fitest/userspb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func redactionServerOptions(t *testing.T) []grpc.ServerOption {
+	logger := nopLogger{}
+	auth := rpc.NewJWTAuthenticator(testJWTConfig)
+	policy := rpc.RedactionPolicy{FullRecordRoles: []string{"admin"}}
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(
+			rpc.UnaryAuthInterceptor(auth, logger),
+			rpc.UnaryRedactionInterceptor(policy),
+		),
+		grpc.ChainStreamInterceptor(
+			rpc.StreamAuthInterceptor(auth, logger),
+			rpc.StreamRedactionInterceptor(policy),
+		),
+	}
+}
+
+// requireRedacted checks that the personal information of expected is masked in actual
+func requireRedacted(t *testing.T, expected user.SanitizedUser, actual *userspb.User) {
+	require.Equal(t, expected.ID, actual.Id)
+	require.Equal(t, expected.Nickname, actual.Nickname)
+	require.Equal(t, expected.Country, actual.Country)
+	require.Equal(t, expected.FirstName[:1]+"***", actual.FirstName)
+	require.Equal(t, expected.LastName[:1]+"***", actual.LastName)
+	_, domain, _ := strings.Cut(expected.Email, "@")
+	require.Equal(t, expected.Email[:1]+"***@"+domain, actual.Email)
+}
+
+func TestFoundUsersAreRedactedForCallersWithoutAFullRecordRole(t *testing.T) {
+	stubService := newStubService()
+	found := fakeSanitizedUser()
+	query := fakeUsersQuery()
+	withClient(stubService, func(client userspb.UsersClient) {
+		stubService.find = func(context.Context, *user.Query) (user.Page, error) {
+			return user.Page{Page: 1, Total: 1, Items: []user.SanitizedUser{found}}, nil
+		}
+
+		page, err := client.FindUsers(withBearerToken(context.Background(), tokenWithRoles(t, "reader")), &query)
+		require.NoError(t, err)
+		requireRedacted(t, found, page.Items[0])
+
+		page, err = client.FindUsers(withBearerToken(context.Background(), tokenWithRoles(t, "admin")), &query)
+		require.NoError(t, err)
+		compareSanitizedUserToPBUser(t, found, page.Items[0])
+	}, redactionServerOptions(t)...)
+}
+
+func TestExportedUsersAreRedactedForCallersWithoutAFullRecordRole(t *testing.T) {
+	stubService := newStubService()
+	exported := fakeSanitizedUser()
+	query := fakeUsersQuery()
+	withClient(stubService, func(client userspb.UsersClient) {
+		stubService.export = func(_ context.Context, _ *user.Query, send func(*user.SanitizedUser) error) error {
+			usr := exported
+			return send(&usr)
+		}
+
+		stream, err := client.ExportUsers(withBearerToken(context.Background(), tokenWithRoles(t, "reader")), &query)
+		require.NoError(t, err)
+		usr, err := stream.Recv()
+		require.NoError(t, err)
+		requireRedacted(t, exported, usr)
+		_, err = stream.Recv()
+		require.ErrorIs(t, err, io.EOF)
+	}, redactionServerOptions(t)...)
+}
+
+func TestAuthenticatedUserIsNotRedacted(t *testing.T) {
+	stubService := newStubService()
+	authenticated := fakeSanitizedUser()
+	withClient(stubService, func(client userspb.UsersClient) {
+		stubService.auth = func(context.Context, string, string, string) (user.SanitizedUser, error) {
+			return authenticated, nil
+		}
+		ctx := withBearerToken(context.Background(), tokenWithRoles(t, "reader"))
+		res, err := client.Authenticate(ctx, &userspb.Credentials{Email: authenticated.Email, Password: "password"})
+		require.NoError(t, err)
+		compareSanitizedUserToPBUser(t, authenticated, res.User)
+	}, redactionServerOptions(t)...)
+}
+
+func TestUserDataCannotBeExportedByCallersWithoutAFullRecordRole(t *testing.T) {
+	stubService := newStubService()
+	exported := fakeSanitizedUser()
+	request := userspb.Ref{Id: exported.ID}
+	withClient(stubService, func(client userspb.UsersClient) {
+		stubService.exportData = func(context.Context, *user.Ref) (user.DataExport, error) {
+			return user.DataExport{User: &exported}, nil
+		}
+
+		_, err := client.ExportUserData(withBearerToken(context.Background(), tokenWithRoles(t, "reader")), &request)
+		require.Equal(t, codes.PermissionDenied.String(), status.Code(err).String())
+
+		_, err = client.ExportUserData(withBearerToken(context.Background(), tokenWithRoles(t, "admin")), &request)
+		require.NoError(t, err)
+	}, redactionServerOptions(t)...)
+}
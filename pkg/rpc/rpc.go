@@ -4,73 +4,153 @@ package rpc
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"strings"
 	"time"
+	"unicode"
 
-	"github.com/robotlovesyou/fitest/pkg/log"
-	"github.com/robotlovesyou/fitest/pkg/telemetry"
 	"github.com/robotlovesyou/fitest/pkg/user"
 	"github.com/robotlovesyou/fitest/userspb"
-	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
 )
 
 const (
 	// Error message sent for internal errors
 	msgInternalServerError = "Internal Server Error"
+	// Error message sent when the service closes a watch subscription
+	msgWatchClosed = "Watch subscription closed, reconnect to continue watching"
+
+	// IdempotencyKeyKey is the metadata key used to send an idempotency key with CreateUser
+	IdempotencyKeyKey = "idempotency-key"
+
+	// ErrorDomain is the domain of the google.rpc.ErrorInfo details sent with errors
+	ErrorDomain = "users"
+	// ReasonEmailInUse is the reason sent when the email address of a user is used by another user
+	ReasonEmailInUse = "EMAIL_IN_USE"
+	// ReasonNicknameInUse is the reason sent when the nickname of a user is used by another user
+	ReasonNicknameInUse = "NICKNAME_IN_USE"
+	// ReasonInvalidFields is the reason sent with validation failures. The metadata maps the name of each invalid
+	// field to the rule it breaks, e.g. required or min
+	ReasonInvalidFields = "INVALID_FIELDS"
+	// ReasonTwoFactorRequired is the reason sent when the password of a user with two factor authentication enabled is
+	// correct, but no code was given. Clients should ask the user for a code and authenticate again
+	ReasonTwoFactorRequired = "TWO_FACTOR_REQUIRED"
+	// ReasonRejected is the reason sent when a hook rejects a change without giving a reason of its own
+	ReasonRejected = "REJECTED"
+	// ReasonNicknameChangeTooSoon is the reason sent when a user changes their nickname before the cooldown since
+	// their last change has passed
+	ReasonNicknameChangeTooSoon = "NICKNAME_CHANGE_TOO_SOON"
 )
 
 // UsersService defines the interface for the service RPCServer delegates its implementation logic to
 type UsersService interface {
 	Create(context.Context, *user.NewUser) (user.User, error)
 	Update(context.Context, *user.Update) (user.User, error)
+	ChangePassword(context.Context, *user.PasswordChange) (user.User, error)
+	Get(context.Context, *user.Ref) (user.SanitizedUser, error)
 	Delete(context.Context, *user.Ref) error
+	TouchLastSeen(context.Context, *user.Ref) error
+	BatchDelete(context.Context, *user.Refs) ([]user.DeleteResult, error)
+	BatchGet(context.Context, *user.Refs) ([]user.GetResult, error)
+	Restore(context.Context, *user.Ref) (user.User, error)
+	ReplayUserEvents(context.Context, *user.Ref) (user.User, error)
+	DeadLetters(context.Context) ([]user.DeadLetter, error)
+	RequeueDeadLetter(context.Context, *user.Ref) error
+	Anonymize(context.Context, *user.Ref) (user.User, error)
+	ExportData(context.Context, *user.Ref) (user.DataExport, error)
+	Suspend(context.Context, *user.Ref) (user.User, error)
+	Reactivate(context.Context, *user.Ref) (user.User, error)
+	Ban(context.Context, *user.Ref) (user.User, error)
+	CheckAvailability(context.Context, *user.AvailabilityCheck) (user.Availability, error)
 	Find(context.Context, *user.Query) (user.Page, error)
+	Count(context.Context, *user.Query) (int64, error)
+	Stats(context.Context, *user.StatsQuery) (user.Stats, error)
+	Export(context.Context, *user.Query, func(*user.SanitizedUser) error) error
+	Lookup(context.Context, *user.Lookup) (user.SanitizedUser, error)
+	Authenticate(ctx context.Context, email, password, code string) (user.SanitizedUser, error)
+	EnrollTwoFactor(context.Context, *user.Ref) (user.TwoFactorEnrollment, error)
+	ConfirmTwoFactor(context.Context, *user.TwoFactorCode) ([]string, error)
+	DisableTwoFactor(context.Context, *user.TwoFactorCode) (user.User, error)
+	RequestPasswordReset(ctx context.Context, email string) error
+	ResetPassword(context.Context, *user.PasswordReset) (user.User, error)
+	ChangeEmail(context.Context, *user.EmailChange) error
+	ChangeNickname(context.Context, *user.NicknameChange) (user.User, error)
+	ConfirmEmailChange(context.Context, *user.EmailConfirmation) (user.User, error)
+	Watch(context.Context) <-chan user.Event
+}
+
+// Logger represents the logging functions used by the RPC server and its interceptors
+type Logger interface {
+	Infof(ctx context.Context, format string, args ...any)
+	Errorf(ctx context.Context, err error, format string, args ...any)
 }
 
 // RPCServer is an impementation of userspb.UsersService.
 // It delegates all call handling logic to its UsersService, and is only responsible for converting
-// back and forth between the types used by generated.UsersService and UsersService
+// back and forth between the types used by generated.UsersService and UsersService.
+// Handlers record errors on the span in their context, which is expected to be started by otelgrpc interceptors
 type RPCServer struct {
 	userspb.UnimplementedUsersServer
 	service UsersService
-	// In a production setting I would declare this as an interface to allow for stub implementations for testing
-	logger *log.Logger
+	logger  Logger
 }
 
 // New creates a new RPCServer which will delegate processing to its UsersService dependency
-func New(service UsersService, logger *log.Logger) *RPCServer {
+func New(service UsersService, logger Logger) *RPCServer {
 	return &RPCServer{service: service, logger: logger}
 }
 
+// activityTime formats the time of some user activity, which is zero if it has never happened
+func activityTime(at time.Time) string {
+	if at.IsZero() {
+		return ""
+	}
+	return at.Format(time.RFC3339)
+}
+
 // pbUserFromUser converts a user.User into a userspb.User
 func pbUserFromUser(user *user.User) *userspb.User {
 	return &userspb.User{
-		Id:        user.ID.String(),
-		FirstName: user.FirstName,
-		LastName:  user.LastName,
-		Nickname:  user.Nickname,
-		Email:     user.Email,
-		Country:   user.Country,
-		CreatedAt: user.CreatedAt.Format(time.RFC3339),
-		UpdatedAt: user.UpdatedAt.Format(time.RFC3339),
-		Version:   user.Version,
+		Id:               user.ID.String(),
+		FirstName:        user.FirstName,
+		LastName:         user.LastName,
+		Nickname:         user.Nickname,
+		Email:            user.Email,
+		Country:          user.Country,
+		AvatarUrl:        user.AvatarURL,
+		CreatedAt:        user.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:        user.UpdatedAt.Format(time.RFC3339),
+		Version:          user.Version,
+		Status:           user.Status,
+		LastLoginAt:      activityTime(user.LastLoginAt),
+		LastSeenAt:       activityTime(user.LastSeenAt),
+		TwoFactorEnabled: user.TwoFactorEnabled,
 	}
 }
 
 func pbUserFromSanitizedUser(user *user.SanitizedUser) *userspb.User {
 	return &userspb.User{
-		Id:        user.ID,
-		FirstName: user.FirstName,
-		LastName:  user.LastName,
-		Nickname:  user.Nickname,
-		Email:     user.Email,
-		Country:   user.Country,
-		CreatedAt: user.CreatedAt,
-		UpdatedAt: user.UpdatedAt,
-		Version:   user.Version,
+		Id:               user.ID,
+		FirstName:        user.FirstName,
+		LastName:         user.LastName,
+		Nickname:         user.Nickname,
+		Email:            user.Email,
+		Country:          user.Country,
+		AvatarUrl:        user.AvatarURL,
+		CreatedAt:        user.CreatedAt,
+		UpdatedAt:        user.UpdatedAt,
+		Version:          user.Version,
+		Status:           user.Status,
+		LastLoginAt:      user.LastLoginAt,
+		LastSeenAt:       user.LastSeenAt,
+		TwoFactorEnabled: user.TwoFactorEnabled,
 	}
 }
 
@@ -81,17 +161,218 @@ func pbPageFromPage(page *user.Page) *userspb.Page {
 		items = append(items, pbUserFromSanitizedUser(&itm))
 	}
 	return &userspb.Page{
-		Page:  page.Page,
-		Total: page.Total,
-		Items: items,
+		Page:       page.Page,
+		Total:      page.Total,
+		Items:      items,
+		HasNext:    page.HasNext,
+		TotalPages: page.TotalPages,
+	}
+}
+
+// pbUserEventFromEvent converts a user.Event into a userspb.UserEvent
+func pbUserEventFromEvent(evt *user.Event) *userspb.UserEvent {
+	pbEvt := &userspb.UserEvent{
+		Id:        evt.ID,
+		Version:   evt.Version,
+		Action:    evt.Action,
+		CreatedAt: evt.CreatedAt,
+		SentAt:    evt.SentAt,
+	}
+	if evt.Data != nil {
+		pbEvt.Data = pbUserFromSanitizedUser(evt.Data)
+	}
+	return pbEvt
+}
+
+// pbFieldNames maps the names of fields in the user package to the names of fields in userspb messages,
+// where they are not simply the snake case equivalent
+var pbFieldNames = map[string]string{
+	"ConfirmPassword": "confirmPassword",
+	"Fields":          "update_mask",
+}
+
+// maskFields maps the paths which can be used in the update_mask of a userspb.Update to user package fields
+var maskFields = map[string]string{
+	"first_name":      user.FieldFirstName,
+	"last_name":       user.FieldLastName,
+	"password":        user.FieldPassword,
+	"confirmPassword": user.FieldPassword,
+	"country":         user.FieldCountry,
+	"avatar_url":      user.FieldAvatarURL,
+}
+
+// updateFieldsFromMask converts the update mask of a userspb.Update into the fields of a user.Update.
+// Paths which cannot be updated are passed on unchanged, so that they are reported by the service
+func updateFieldsFromMask(mask *fieldmaskpb.FieldMask) []string {
+	fields := make([]string, 0, len(mask.GetPaths()))
+	seen := make(map[string]bool)
+	for _, path := range mask.GetPaths() {
+		field, ok := maskFields[path]
+		if !ok {
+			field = path
+		}
+		if !seen[field] {
+			seen[field] = true
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// pbFieldName converts the name of a field in the user package into the name of the field in userspb messages
+func pbFieldName(field string) string {
+	if name, ok := pbFieldNames[field]; ok {
+		return name
+	}
+	var b strings.Builder
+	runes := []rune(field)
+	for i, r := range runes {
+		// start a new word at an upper case rune, unless it continues an acronym such as ID
+		if i > 0 && unicode.IsUpper(r) && !unicode.IsUpper(runes[i-1]) {
+			b.WriteRune('_')
+		}
+		b.WriteRune(unicode.ToLower(r))
 	}
+	return b.String()
+}
+
+// invalidArgumentError converts an error wrapping user.ErrInvalid into an InvalidArgument status.
+// When the error describes the invalid fields, they are included as google.rpc.BadRequest details
+func invalidArgumentError(err error) error {
+	st := status.New(codes.InvalidArgument, user.ErrInvalid.Error())
+	var invalid *user.InvalidError
+	if !errors.As(err, &invalid) {
+		return st.Err()
+	}
+	badRequest := &errdetails.BadRequest{}
+	rules := make(map[string]string)
+	for _, v := range invalid.Violations {
+		field := pbFieldName(v.Field)
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       field,
+			Description: v.Description,
+		})
+		if v.Rule != "" {
+			rules[field] = v.Rule
+		}
+	}
+	detailed, detailsErr := st.WithDetails(badRequest)
+	if len(rules) > 0 {
+		detailed, detailsErr = st.WithDetails(badRequest, &errdetails.ErrorInfo{
+			Reason:   ReasonInvalidFields,
+			Domain:   ErrorDomain,
+			Metadata: rules,
+		})
+	}
+	if detailsErr != nil {
+		// fall back to the status without details rather than failing the call
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
+// alreadyExistsError converts a conflict with another user into an AlreadyExists status. When the service reports which
+// field conflicts, a google.rpc.ErrorInfo detail carries a reason naming it, and the field in its metadata
+func alreadyExistsError(err error) error {
+	st := status.New(codes.AlreadyExists, err.Error())
+	var info *errdetails.ErrorInfo
+	switch {
+	case errors.Is(err, user.ErrEmailInUse):
+		info = &errdetails.ErrorInfo{Reason: ReasonEmailInUse, Domain: ErrorDomain, Metadata: map[string]string{"field": "email"}}
+	case errors.Is(err, user.ErrNicknameInUse):
+		info = &errdetails.ErrorInfo{Reason: ReasonNicknameInUse, Domain: ErrorDomain, Metadata: map[string]string{"field": "nickname"}}
+	default:
+		return st.Err()
+	}
+	detailed, detailsErr := st.WithDetails(info)
+	if detailsErr != nil {
+		// fall back to the status without details rather than failing the call
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
+// twoFactorRequiredError converts ErrTwoFactorRequired into an Unauthenticated status with a google.rpc.ErrorInfo
+// detail, so that clients can tell it apart from incorrect credentials
+func twoFactorRequiredError(err error) error {
+	st := status.New(codes.Unauthenticated, err.Error())
+	detailed, detailsErr := st.WithDetails(&errdetails.ErrorInfo{Reason: ReasonTwoFactorRequired, Domain: ErrorDomain})
+	if detailsErr != nil {
+		// fall back to the status without details rather than failing the call
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
+// nicknameChangeTooSoonError converts ErrNicknameChangeTooSoon into a FailedPrecondition status with a
+// google.rpc.ErrorInfo detail, so that clients can tell it apart from a stale version
+func nicknameChangeTooSoonError(err error) error {
+	st := status.New(codes.FailedPrecondition, err.Error())
+	detailed, detailsErr := st.WithDetails(&errdetails.ErrorInfo{Reason: ReasonNicknameChangeTooSoon, Domain: ErrorDomain})
+	if detailsErr != nil {
+		// fall back to the status without details rather than failing the call
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
+// rejectedError converts a change rejected by a hook into a FailedPrecondition status with a google.rpc.ErrorInfo
+// detail carrying the reason given by the hook
+func rejectedError(err error) error {
+	st := status.New(codes.FailedPrecondition, err.Error())
+	reason := ReasonRejected
+	var rejected *user.RejectedError
+	if errors.As(err, &rejected) && rejected.Reason != "" {
+		reason = rejected.Reason
+	}
+	detailed, detailsErr := st.WithDetails(&errdetails.ErrorInfo{Reason: reason, Domain: ErrorDomain})
+	if detailsErr != nil {
+		// fall back to the status without details rather than failing the call
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
+// watching returns true if action is in actions, or if actions is empty
+func watching(actions []string, action string) bool {
+	if len(actions) == 0 {
+		return true
+	}
+	for _, a := range actions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// idempotencyKey returns the idempotency key sent in the incoming metadata carried by ctx, or "" if there is none
+func idempotencyKey(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	keys := md.Get(IdempotencyKeyKey)
+	if len(keys) == 0 {
+		return ""
+	}
+	return keys[0]
+}
+
+// caller returns the description of the authenticated caller of the call carried by ctx, or "" if it was not
+// authenticated
+func caller(ctx context.Context) string {
+	identity, ok := IdentityFromContext(ctx)
+	if !ok {
+		return ""
+	}
+	return identity.String()
 }
 
 // CreateUser implements the userspb.UsersServer.CreateUser function, allowing clients to create new users
 func (svr *RPCServer) CreateUser(ctx context.Context, newUser *userspb.NewUser) (*userspb.User, error) {
 	// placing the email in the logs like this could be a GDPR issue, depending on company policy
-	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "CreateUser")
-	defer span.End()
+	span := trace.SpanFromContext(ctx)
 	svr.logger.Infof(ctx, "creating user %s", newUser.Email)
 
 	usr, err := svr.service.Create(ctx, &user.NewUser{
@@ -102,17 +383,25 @@ func (svr *RPCServer) CreateUser(ctx context.Context, newUser *userspb.NewUser)
 		ConfirmPassword: newUser.ConfirmPassword,
 		Email:           newUser.Email,
 		Country:         newUser.Country,
+		IdempotencyKey:  idempotencyKey(ctx),
+		Caller:          caller(ctx),
 	})
 	if err != nil {
 		svr.logger.Errorf(ctx, err, "error creating user %s", newUser.Email)
 		span.RecordError(err)
-		// For the sake of brevity, I am only going to use grpc error codes when the service fails.
-		// In a real world implementation I would, where appropriate, include detail via status details.
+		// Validation failures include google.rpc.BadRequest details describing each invalid field, and conflicts
+		// include google.rpc.ErrorInfo details naming the field in use.
 		switch {
 		case errors.Is(err, user.ErrAlreadyExists):
-			return nil, status.Error(codes.AlreadyExists, err.Error())
+			return nil, alreadyExistsError(err)
 		case errors.Is(err, user.ErrInvalid):
-			return nil, status.Error(codes.InvalidArgument, err.Error())
+			return nil, invalidArgumentError(err)
+		case errors.Is(err, user.ErrRejected):
+			return nil, rejectedError(err)
+		case errors.Is(err, user.ErrIdempotencyKeyReused):
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		case errors.Is(err, user.ErrUnavailable):
+			return nil, status.Error(codes.Unavailable, err.Error())
 		default:
 			return nil, status.Error(codes.Internal, msgInternalServerError)
 		}
@@ -123,11 +412,9 @@ func (svr *RPCServer) CreateUser(ctx context.Context, newUser *userspb.NewUser)
 
 // UpdateUser implements the userspb.UsersServer.UpdateUser function, allowing clients to update existing users
 func (svr *RPCServer) UpdateUser(ctx context.Context, userUpdate *userspb.Update) (*userspb.User, error) {
-	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "UpdateUser")
-	defer span.End()
+	span := trace.SpanFromContext(ctx)
 	svr.logger.Infof(ctx, "updating user %s", userUpdate.Id)
 
-	defer span.End()
 	usr, err := svr.service.Update(ctx, &user.Update{
 		ID:              userUpdate.Id,
 		FirstName:       userUpdate.FirstName,
@@ -135,43 +422,324 @@ func (svr *RPCServer) UpdateUser(ctx context.Context, userUpdate *userspb.Update
 		Password:        userUpdate.Password,
 		ConfirmPassword: userUpdate.ConfirmPassword,
 		Country:         userUpdate.Country,
+		AvatarURL:       userUpdate.AvatarUrl,
 		Version:         userUpdate.Version,
+		Fields:          updateFieldsFromMask(userUpdate.UpdateMask),
 	})
 	if err != nil {
 		svr.logger.Errorf(ctx, err, "error updating user %s", userUpdate.Id)
 		span.RecordError(err)
-		// For the sake of brevity, I am only going to use grpc error codes when the service fails.
-		// In a real world implementation I would, where appropriate, include detail via status details.
+		// Validation failures include google.rpc.BadRequest details describing each invalid field.
 		switch {
 		case errors.Is(err, user.ErrNotFound):
 			return nil, status.Error(codes.NotFound, err.Error())
 		case errors.Is(err, user.ErrInvalid):
-			return nil, status.Error(codes.InvalidArgument, err.Error())
+			return nil, invalidArgumentError(err)
 		case errors.Is(err, user.ErrInvalidVersion):
 			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		case errors.Is(err, user.ErrRejected):
+			return nil, rejectedError(err)
+		case errors.Is(err, user.ErrUnavailable):
+			return nil, status.Error(codes.Unavailable, err.Error())
 		default:
 			return nil, status.Error(codes.Internal, msgInternalServerError)
 		}
 	}
-	return pbUserFromUser(&usr), nil
+	return redact(ctx, pbUserFromUser(&usr)), nil
+}
+
+// ChangePassword implements the userspb.UsersServer.ChangePassword function, allowing clients to change the password
+// of existing users
+func (svr *RPCServer) ChangePassword(ctx context.Context, change *userspb.PasswordChange) (*userspb.User, error) {
+	span := trace.SpanFromContext(ctx)
+	svr.logger.Infof(ctx, "changing password of user %s", change.Id)
+
+	usr, err := svr.service.ChangePassword(ctx, &user.PasswordChange{
+		ID:              change.Id,
+		CurrentPassword: change.CurrentPassword,
+		Password:        change.Password,
+		ConfirmPassword: change.ConfirmPassword,
+		Version:         change.Version,
+	})
+	if err != nil {
+		svr.logger.Errorf(ctx, err, "error changing password of user %s", change.Id)
+		span.RecordError(err)
+		// Validation failures include google.rpc.BadRequest details describing each invalid field.
+		switch {
+		case errors.Is(err, user.ErrNotFound):
+			return nil, status.Error(codes.NotFound, err.Error())
+		case errors.Is(err, user.ErrInvalid):
+			return nil, invalidArgumentError(err)
+		case errors.Is(err, user.ErrInvalidVersion):
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		case errors.Is(err, user.ErrInvalidCredentials):
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		case errors.Is(err, user.ErrUnavailable):
+			return nil, status.Error(codes.Unavailable, err.Error())
+		default:
+			return nil, status.Error(codes.Internal, msgInternalServerError)
+		}
+	}
+	return redact(ctx, pbUserFromUser(&usr)), nil
+}
+
+// ChangeEmail implements the userspb.UsersServer.ChangeEmail function, allowing clients to request a change to the
+// email address of existing users
+func (svr *RPCServer) ChangeEmail(ctx context.Context, change *userspb.EmailChange) (*emptypb.Empty, error) {
+	span := trace.SpanFromContext(ctx)
+	svr.logger.Infof(ctx, "changing email of user %s", change.Id)
+
+	err := svr.service.ChangeEmail(ctx, &user.EmailChange{
+		ID:              change.Id,
+		Email:           change.Email,
+		CurrentPassword: change.CurrentPassword,
+		Version:         change.Version,
+	})
+	if err != nil {
+		svr.logger.Errorf(ctx, err, "error changing email of user %s", change.Id)
+		span.RecordError(err)
+		// Validation failures include google.rpc.BadRequest details describing each invalid field.
+		switch {
+		case errors.Is(err, user.ErrNotFound):
+			return nil, status.Error(codes.NotFound, err.Error())
+		case errors.Is(err, user.ErrInvalid):
+			return nil, invalidArgumentError(err)
+		case errors.Is(err, user.ErrInvalidVersion):
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		case errors.Is(err, user.ErrInvalidCredentials):
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		case errors.Is(err, user.ErrAlreadyExists):
+			return nil, alreadyExistsError(err)
+		case errors.Is(err, user.ErrUnavailable):
+			return nil, status.Error(codes.Unavailable, err.Error())
+		default:
+			return nil, status.Error(codes.Internal, msgInternalServerError)
+		}
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// ConfirmEmailChange implements the userspb.UsersServer.ConfirmEmailChange function, allowing clients to confirm a
+// change of email address with the token sent to the new address. The token is not logged
+func (svr *RPCServer) ConfirmEmailChange(ctx context.Context, confirmation *userspb.EmailConfirmation) (*userspb.User, error) {
+	span := trace.SpanFromContext(ctx)
+	svr.logger.Infof(ctx, "confirming email change")
+
+	usr, err := svr.service.ConfirmEmailChange(ctx, &user.EmailConfirmation{Token: confirmation.Token})
+	if err != nil {
+		svr.logger.Errorf(ctx, err, "error confirming email change")
+		span.RecordError(err)
+		// Validation failures include google.rpc.BadRequest details describing each invalid field.
+		switch {
+		case errors.Is(err, user.ErrInvalid):
+			return nil, invalidArgumentError(err)
+		case errors.Is(err, user.ErrInvalidEmailChangeToken):
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		case errors.Is(err, user.ErrAlreadyExists):
+			return nil, alreadyExistsError(err)
+		case errors.Is(err, user.ErrUnavailable):
+			return nil, status.Error(codes.Unavailable, err.Error())
+		default:
+			return nil, status.Error(codes.Internal, msgInternalServerError)
+		}
+	}
+	svr.logger.Infof(ctx, "changed email of user %s", usr.ID)
+	return redact(ctx, pbUserFromUser(&usr)), nil
+}
+
+// ChangeNickname implements the userspb.UsersServer.ChangeNickname function, allowing clients to change the nickname
+// of users
+func (svr *RPCServer) ChangeNickname(ctx context.Context, change *userspb.NicknameChange) (*userspb.User, error) {
+	span := trace.SpanFromContext(ctx)
+	svr.logger.Infof(ctx, "changing nickname of user %s", change.Id)
+
+	usr, err := svr.service.ChangeNickname(ctx, &user.NicknameChange{
+		ID:       change.Id,
+		Nickname: change.Nickname,
+		Version:  change.Version,
+	})
+	if err != nil {
+		svr.logger.Errorf(ctx, err, "error changing nickname of user %s", change.Id)
+		span.RecordError(err)
+		// Validation failures include google.rpc.BadRequest details describing each invalid field.
+		switch {
+		case errors.Is(err, user.ErrNotFound):
+			return nil, status.Error(codes.NotFound, err.Error())
+		case errors.Is(err, user.ErrInvalid):
+			return nil, invalidArgumentError(err)
+		case errors.Is(err, user.ErrInvalidVersion):
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		case errors.Is(err, user.ErrNicknameChangeTooSoon):
+			return nil, nicknameChangeTooSoonError(err)
+		case errors.Is(err, user.ErrAlreadyExists):
+			return nil, alreadyExistsError(err)
+		case errors.Is(err, user.ErrUnavailable):
+			return nil, status.Error(codes.Unavailable, err.Error())
+		default:
+			return nil, status.Error(codes.Internal, msgInternalServerError)
+		}
+	}
+	return redact(ctx, pbUserFromUser(&usr)), nil
+}
+
+// GetUser implements the userspb.UsersServer.GetUser function, allowing clients to read a single user by id
+func (svr *RPCServer) GetUser(ctx context.Context, userRef *userspb.Ref) (*userspb.User, error) {
+	span := trace.SpanFromContext(ctx)
+	svr.logger.Infof(ctx, "getting user %s", userRef.Id)
+
+	usr, err := svr.service.Get(ctx, &user.Ref{ID: userRef.Id})
+	if err != nil {
+		svr.logger.Errorf(ctx, err, "error getting user: %s", userRef.Id)
+		span.RecordError(err)
+		switch {
+		case errors.Is(err, user.ErrNotFound):
+			return nil, status.Error(codes.NotFound, err.Error())
+		case errors.Is(err, user.ErrInvalid):
+			return nil, invalidArgumentError(err)
+		default:
+			return nil, status.Error(codes.Internal, msgInternalServerError)
+		}
+	}
+	return redact(ctx, pbUserFromSanitizedUser(&usr)), nil
 }
 
 // DeleteUser implements the userspb.UsersServer.DeleteUser function, allowing clients to delete users
 func (svr *RPCServer) DeleteUser(ctx context.Context, userRef *userspb.Ref) (*emptypb.Empty, error) {
-	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "DeleteUser")
-	defer span.End()
+	span := trace.SpanFromContext(ctx)
 	svr.logger.Infof(ctx, "deleting user %s", userRef.Id)
 
 	if err := svr.service.Delete(ctx, &user.Ref{ID: userRef.Id}); err != nil {
 		svr.logger.Errorf(ctx, err, "error deleting user: %s", userRef.Id)
 		span.RecordError(err)
-		// For the sake of brevity, I am only going to use grpc error codes when the service fails.
-		// In a real world implementation I would, where appropriate, include detail via status details.
+		// Validation failures include google.rpc.BadRequest details describing each invalid field.
+		switch {
+		case errors.Is(err, user.ErrNotFound):
+			return nil, status.Error(codes.NotFound, err.Error())
+		case errors.Is(err, user.ErrInvalid):
+			return nil, invalidArgumentError(err)
+		case errors.Is(err, user.ErrRejected):
+			return nil, rejectedError(err)
+		default:
+			return nil, status.Error(codes.Internal, msgInternalServerError)
+		}
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// TouchLastSeen implements the userspb.UsersServer.TouchLastSeen function, allowing clients to record that a user
+// is active
+func (svr *RPCServer) TouchLastSeen(ctx context.Context, userRef *userspb.Ref) (*emptypb.Empty, error) {
+	span := trace.SpanFromContext(ctx)
+	svr.logger.Infof(ctx, "recording user %s as seen", userRef.Id)
+
+	if err := svr.service.TouchLastSeen(ctx, &user.Ref{ID: userRef.Id}); err != nil {
+		svr.logger.Errorf(ctx, err, "error recording user as seen: %s", userRef.Id)
+		span.RecordError(err)
+		// Validation failures include google.rpc.BadRequest details describing each invalid field.
+		switch {
+		case errors.Is(err, user.ErrNotFound):
+			return nil, status.Error(codes.NotFound, err.Error())
+		case errors.Is(err, user.ErrInvalid):
+			return nil, invalidArgumentError(err)
+		default:
+			return nil, status.Error(codes.Internal, msgInternalServerError)
+		}
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// RestoreUser implements the userspb.UsersServer.RestoreUser function, allowing clients to restore deleted users
+func (svr *RPCServer) RestoreUser(ctx context.Context, userRef *userspb.Ref) (*userspb.User, error) {
+	span := trace.SpanFromContext(ctx)
+	svr.logger.Infof(ctx, "restoring user %s", userRef.Id)
+
+	usr, err := svr.service.Restore(ctx, &user.Ref{ID: userRef.Id})
+	if err != nil {
+		svr.logger.Errorf(ctx, err, "error restoring user: %s", userRef.Id)
+		span.RecordError(err)
+		// Validation failures include google.rpc.BadRequest details describing each invalid field.
+		switch {
+		case errors.Is(err, user.ErrNotFound):
+			return nil, status.Error(codes.NotFound, err.Error())
+		case errors.Is(err, user.ErrInvalid):
+			return nil, invalidArgumentError(err)
+		case errors.Is(err, user.ErrUnavailable):
+			return nil, status.Error(codes.Unavailable, err.Error())
+		default:
+			return nil, status.Error(codes.Internal, msgInternalServerError)
+		}
+	}
+	return redact(ctx, pbUserFromUser(&usr)), nil
+}
+
+// ReplayUserEvents implements the userspb.UsersServer.ReplayUserEvents function, allowing clients to publish the
+// current state of users again
+func (svr *RPCServer) ReplayUserEvents(ctx context.Context, userRef *userspb.Ref) (*userspb.User, error) {
+	span := trace.SpanFromContext(ctx)
+	svr.logger.Infof(ctx, "replaying events for user %s", userRef.Id)
+
+	usr, err := svr.service.ReplayUserEvents(ctx, &user.Ref{ID: userRef.Id})
+	if err != nil {
+		svr.logger.Errorf(ctx, err, "error replaying events for user: %s", userRef.Id)
+		span.RecordError(err)
+		// Validation failures include google.rpc.BadRequest details describing each invalid field.
+		switch {
+		case errors.Is(err, user.ErrNotFound):
+			return nil, status.Error(codes.NotFound, err.Error())
+		case errors.Is(err, user.ErrInvalid):
+			return nil, invalidArgumentError(err)
+		case errors.Is(err, user.ErrInvalidVersion):
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		case errors.Is(err, user.ErrUnavailable):
+			return nil, status.Error(codes.Unavailable, err.Error())
+		default:
+			return nil, status.Error(codes.Internal, msgInternalServerError)
+		}
+	}
+	return redact(ctx, pbUserFromUser(&usr)), nil
+}
+
+// ListDeadLetters implements the userspb.UsersServer.ListDeadLetters function, allowing clients to list the events
+// which failed to be published too many times
+func (svr *RPCServer) ListDeadLetters(ctx context.Context, _ *userspb.DeadLettersRequest) (*userspb.DeadLetters, error) {
+	span := trace.SpanFromContext(ctx)
+	svr.logger.Infof(ctx, "listing dead letters")
+
+	deadLetters, err := svr.service.DeadLetters(ctx)
+	if err != nil {
+		svr.logger.Errorf(ctx, err, "error listing dead letters")
+		span.RecordError(err)
+		return nil, status.Error(codes.Internal, msgInternalServerError)
+	}
+	response := &userspb.DeadLetters{DeadLetters: make([]*userspb.DeadLetter, 0, len(deadLetters))}
+	for _, deadLetter := range deadLetters {
+		response.DeadLetters = append(response.DeadLetters, &userspb.DeadLetter{
+			Id:             deadLetter.ID.String(),
+			Version:        deadLetter.Version,
+			Action:         deadLetter.Action,
+			CreatedAt:      deadLetter.CreatedAt.Format(user.TimeFormat),
+			DeadLetteredAt: deadLetter.DeadLetteredAt.Format(user.TimeFormat),
+			Attempts:       deadLetter.Attempts,
+		})
+	}
+	return response, nil
+}
+
+// RequeueDeadLetter implements the userspb.UsersServer.RequeueDeadLetter function, allowing clients to publish the
+// dead lettered events of users again
+func (svr *RPCServer) RequeueDeadLetter(ctx context.Context, userRef *userspb.Ref) (*emptypb.Empty, error) {
+	span := trace.SpanFromContext(ctx)
+	svr.logger.Infof(ctx, "requeueing dead letter for user %s", userRef.Id)
+
+	if err := svr.service.RequeueDeadLetter(ctx, &user.Ref{ID: userRef.Id}); err != nil {
+		svr.logger.Errorf(ctx, err, "error requeueing dead letter for user: %s", userRef.Id)
+		span.RecordError(err)
+		// Validation failures include google.rpc.BadRequest details describing each invalid field.
 		switch {
 		case errors.Is(err, user.ErrNotFound):
 			return nil, status.Error(codes.NotFound, err.Error())
 		case errors.Is(err, user.ErrInvalid):
-			return nil, status.Error(codes.InvalidArgument, err.Error())
+			return nil, invalidArgumentError(err)
 		default:
 			return nil, status.Error(codes.Internal, msgInternalServerError)
 		}
@@ -179,22 +747,500 @@ func (svr *RPCServer) DeleteUser(ctx context.Context, userRef *userspb.Ref) (*em
 	return &emptypb.Empty{}, nil
 }
 
+// AnonymizeUser implements the userspb.UsersServer.AnonymizeUser function, allowing clients to replace the personal
+// information of users with placeholders
+func (svr *RPCServer) AnonymizeUser(ctx context.Context, userRef *userspb.Ref) (*userspb.User, error) {
+	span := trace.SpanFromContext(ctx)
+	svr.logger.Infof(ctx, "anonymizing user %s", userRef.Id)
+
+	usr, err := svr.service.Anonymize(ctx, &user.Ref{ID: userRef.Id})
+	if err != nil {
+		svr.logger.Errorf(ctx, err, "error anonymizing user: %s", userRef.Id)
+		span.RecordError(err)
+		// Validation failures include google.rpc.BadRequest details describing each invalid field.
+		switch {
+		case errors.Is(err, user.ErrNotFound):
+			return nil, status.Error(codes.NotFound, err.Error())
+		case errors.Is(err, user.ErrInvalid):
+			return nil, invalidArgumentError(err)
+		case errors.Is(err, user.ErrInvalidVersion):
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		case errors.Is(err, user.ErrUnavailable):
+			return nil, status.Error(codes.Unavailable, err.Error())
+		default:
+			return nil, status.Error(codes.Internal, msgInternalServerError)
+		}
+	}
+	return pbUserFromUser(&usr), nil
+}
+
+// SuspendUser implements the userspb.UsersServer.SuspendUser function, allowing clients to suspend active users
+func (svr *RPCServer) SuspendUser(ctx context.Context, userRef *userspb.Ref) (*userspb.User, error) {
+	return svr.changeUserStatus(ctx, userRef, "suspending", svr.service.Suspend)
+}
+
+// ReactivateUser implements the userspb.UsersServer.ReactivateUser function, allowing clients to make suspended or
+// dormant users active again
+func (svr *RPCServer) ReactivateUser(ctx context.Context, userRef *userspb.Ref) (*userspb.User, error) {
+	return svr.changeUserStatus(ctx, userRef, "reactivating", svr.service.Reactivate)
+}
+
+// BanUser implements the userspb.UsersServer.BanUser function, allowing clients to ban users
+func (svr *RPCServer) BanUser(ctx context.Context, userRef *userspb.Ref) (*userspb.User, error) {
+	return svr.changeUserStatus(ctx, userRef, "banning", svr.service.Ban)
+}
+
+// changeUserStatus changes the status of the user identified by userRef with change, and responds with the changed
+// user. verb describes the change in logs
+func (svr *RPCServer) changeUserStatus(ctx context.Context, userRef *userspb.Ref, verb string, change func(context.Context, *user.Ref) (user.User, error)) (*userspb.User, error) {
+	span := trace.SpanFromContext(ctx)
+	svr.logger.Infof(ctx, "%s user %s", verb, userRef.Id)
+
+	usr, err := change(ctx, &user.Ref{ID: userRef.Id})
+	if err != nil {
+		svr.logger.Errorf(ctx, err, "error %s user: %s", verb, userRef.Id)
+		span.RecordError(err)
+		switch {
+		case errors.Is(err, user.ErrNotFound):
+			return nil, status.Error(codes.NotFound, err.Error())
+		case errors.Is(err, user.ErrInvalid):
+			return nil, invalidArgumentError(err)
+		case errors.Is(err, user.ErrInvalidVersion), errors.Is(err, user.ErrInvalidTransition):
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		case errors.Is(err, user.ErrUnavailable):
+			return nil, status.Error(codes.Unavailable, err.Error())
+		default:
+			return nil, status.Error(codes.Internal, msgInternalServerError)
+		}
+	}
+	return redact(ctx, pbUserFromUser(&usr)), nil
+}
+
+// ExportUserData implements the userspb.UsersServer.ExportUserData function, allowing clients to read everything
+// held about a user. Since the export cannot be redacted usefully, callers who may only receive redacted users are
+// refused
+func (svr *RPCServer) ExportUserData(ctx context.Context, userRef *userspb.Ref) (*userspb.UserData, error) {
+	span := trace.SpanFromContext(ctx)
+	svr.logger.Infof(ctx, "exporting data of user %s", userRef.Id)
+
+	if redacting(ctx) {
+		return nil, status.Error(codes.PermissionDenied, msgPermissionDenied)
+	}
+
+	export, err := svr.service.ExportData(ctx, &user.Ref{ID: userRef.Id})
+	if err != nil {
+		svr.logger.Errorf(ctx, err, "error exporting data of user: %s", userRef.Id)
+		span.RecordError(err)
+		switch {
+		case errors.Is(err, user.ErrNotFound):
+			return nil, status.Error(codes.NotFound, err.Error())
+		case errors.Is(err, user.ErrInvalid):
+			return nil, invalidArgumentError(err)
+		default:
+			return nil, status.Error(codes.Internal, msgInternalServerError)
+		}
+	}
+	doc, err := json.Marshal(export)
+	if err != nil {
+		svr.logger.Errorf(ctx, err, "error encoding data of user: %s", userRef.Id)
+		span.RecordError(err)
+		return nil, status.Error(codes.Internal, msgInternalServerError)
+	}
+	return &userspb.UserData{Document: string(doc)}, nil
+}
+
+// BatchDeleteUsers implements the userspb.UsersServer.BatchDeleteUsers function, allowing clients to delete a batch of
+// users in a single call
+func (svr *RPCServer) BatchDeleteUsers(ctx context.Context, refs *userspb.Refs) (*userspb.BatchDeleteResult, error) {
+	span := trace.SpanFromContext(ctx)
+	svr.logger.Infof(ctx, "deleting a batch of %d users", len(refs.Ids))
+
+	results, err := svr.service.BatchDelete(ctx, &user.Refs{IDs: refs.Ids})
+	if err != nil {
+		svr.logger.Errorf(ctx, err, "error deleting a batch of %d users", len(refs.Ids))
+		span.RecordError(err)
+		switch {
+		case errors.Is(err, user.ErrInvalid):
+			return nil, invalidArgumentError(err)
+		case errors.Is(err, user.ErrRejected):
+			return nil, rejectedError(err)
+		default:
+			return nil, status.Error(codes.Internal, msgInternalServerError)
+		}
+	}
+	pbResults := make([]*userspb.DeleteResult, 0, len(results))
+	for _, result := range results {
+		pbResults = append(pbResults, &userspb.DeleteResult{Id: result.ID, Deleted: result.Deleted})
+	}
+	return &userspb.BatchDeleteResult{Results: pbResults}, nil
+}
+
+// BatchGetUsers implements the userspb.UsersServer.BatchGetUsers function, allowing clients to read a batch of users
+// in a single call
+func (svr *RPCServer) BatchGetUsers(ctx context.Context, refs *userspb.Refs) (*userspb.BatchGetResult, error) {
+	span := trace.SpanFromContext(ctx)
+	svr.logger.Infof(ctx, "getting a batch of %d users", len(refs.Ids))
+
+	results, err := svr.service.BatchGet(ctx, &user.Refs{IDs: refs.Ids})
+	if err != nil {
+		svr.logger.Errorf(ctx, err, "error getting a batch of %d users", len(refs.Ids))
+		span.RecordError(err)
+		if errors.Is(err, user.ErrInvalid) {
+			return nil, invalidArgumentError(err)
+		}
+		return nil, status.Error(codes.Internal, msgInternalServerError)
+	}
+	pbResults := make([]*userspb.GetResult, 0, len(results))
+	for i := range results {
+		pbResult := &userspb.GetResult{Id: results[i].ID, Found: results[i].Found}
+		if results[i].Found {
+			pbResult.User = redact(ctx, pbUserFromSanitizedUser(&results[i].User))
+		}
+		pbResults = append(pbResults, pbResult)
+	}
+	return &userspb.BatchGetResult{Results: pbResults}, nil
+}
+
+func sortDirectionFromPB(direction userspb.SortDirection) user.SortDirection {
+	if direction == userspb.SortDirection_SORT_DESCENDING {
+		return user.SortDescending
+	}
+	return user.SortAscending
+}
+
+// userQueryFromPB converts a userspb.Query into a user.Query
+func userQueryFromPB(query *userspb.Query) *user.Query {
+	return &user.Query{
+		CreatedAfter:  query.CreatedAfter,
+		CreatedBefore: query.CreatedBefore,
+		Country:       query.Country,
+		Countries:     query.Countries,
+		Length:        query.Length,
+		Page:          query.Page,
+		SortBy:        query.SortBy,
+		SortDirection: sortDirectionFromPB(query.SortDirection),
+		Status:        query.Status,
+		Search:        query.Search,
+		InactiveSince: query.InactiveSince,
+		SkipTotal:     query.SkipTotal,
+	}
+}
+
 // FindUsers implements the userspb.UsersServer.FindUsers function, allowing clients to find users and page through results
 func (svr *RPCServer) FindUsers(ctx context.Context, query *userspb.Query) (*userspb.Page, error) {
-	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "FindUsers")
-	defer span.End()
+	span := trace.SpanFromContext(ctx)
 	svr.logger.Infof(ctx, "finding page %d of users with country '%s' created after '%s'", query.Page, query.Country, query.CreatedAfter)
 
-	page, err := svr.service.Find(ctx, &user.Query{
-		CreatedAfter: query.CreatedAfter,
-		Country:      query.Country,
-		Length:       query.Length,
-		Page:         query.Page,
-	})
+	page, err := svr.service.Find(ctx, userQueryFromPB(query))
 	if err != nil {
 		span.RecordError(err)
 		svr.logger.Errorf(ctx, err, "error finding page %d of users with country '%s' created after '%s'", query.Page, query.Country, query.CreatedAfter)
+		if errors.Is(err, user.ErrInvalid) {
+			return nil, invalidArgumentError(err)
+		}
 		return nil, status.Error(codes.Internal, msgInternalServerError)
 	}
-	return pbPageFromPage(&page), nil
+	pbPage := pbPageFromPage(&page)
+	for _, itm := range pbPage.Items {
+		redact(ctx, itm)
+	}
+	return pbPage, nil
+}
+
+// ExportUsers implements the userspb.UsersServer.ExportUsers function, allowing clients to stream every matching user
+// without paging
+func (svr *RPCServer) ExportUsers(query *userspb.Query, stream userspb.Users_ExportUsersServer) error {
+	ctx := stream.Context()
+	span := trace.SpanFromContext(ctx)
+	svr.logger.Infof(ctx, "exporting users with country '%s' created after '%s'", query.Country, query.CreatedAfter)
+
+	var sendErr error
+	err := svr.service.Export(ctx, userQueryFromPB(query), func(usr *user.SanitizedUser) error {
+		sendErr = stream.Send(redact(ctx, pbUserFromSanitizedUser(usr)))
+		return sendErr
+	})
+	if err != nil {
+		span.RecordError(err)
+		svr.logger.Errorf(ctx, err, "error exporting users with country '%s' created after '%s'", query.Country, query.CreatedAfter)
+		switch {
+		case sendErr != nil:
+			return sendErr
+		case errors.Is(err, user.ErrInvalid):
+			return invalidArgumentError(err)
+		default:
+			return status.Error(codes.Internal, msgInternalServerError)
+		}
+	}
+	return nil
+}
+
+// CountUsers implements the userspb.UsersServer.CountUsers function, allowing clients to count users without
+// fetching them
+func (svr *RPCServer) CountUsers(ctx context.Context, query *userspb.Query) (*userspb.Count, error) {
+	span := trace.SpanFromContext(ctx)
+	svr.logger.Infof(ctx, "counting users with country '%s' created after '%s'", query.Country, query.CreatedAfter)
+
+	total, err := svr.service.Count(ctx, userQueryFromPB(query))
+	if err != nil {
+		span.RecordError(err)
+		svr.logger.Errorf(ctx, err, "error counting users with country '%s' created after '%s'", query.Country, query.CreatedAfter)
+		if errors.Is(err, user.ErrInvalid) {
+			return nil, invalidArgumentError(err)
+		}
+		return nil, status.Error(codes.Internal, msgInternalServerError)
+	}
+	return &userspb.Count{Total: total}, nil
+}
+
+// pbStatsFromStats converts user.Stats into userspb.Stats
+func pbStatsFromStats(stats *user.Stats) *userspb.Stats {
+	countries := make([]*userspb.CountryCount, 0, len(stats.Countries))
+	for _, c := range stats.Countries {
+		countries = append(countries, &userspb.CountryCount{Country: c.Country, Total: c.Total})
+	}
+	signups := make([]*userspb.SignupCount, 0, len(stats.Signups))
+	for _, s := range stats.Signups {
+		signups = append(signups, &userspb.SignupCount{Start: s.Start, Total: s.Total})
+	}
+	return &userspb.Stats{Total: stats.Total, Countries: countries, Signups: signups}
+}
+
+// GetUserStats implements the userspb.UsersServer.GetUserStats function, allowing clients to count users by country
+// and signup period without fetching them
+func (svr *RPCServer) GetUserStats(ctx context.Context, query *userspb.StatsQuery) (*userspb.Stats, error) {
+	span := trace.SpanFromContext(ctx)
+	svr.logger.Infof(ctx, "getting stats of users with country '%s' created after '%s' per %s", query.Country, query.CreatedAfter, query.Interval)
+
+	stats, err := svr.service.Stats(ctx, &user.StatsQuery{
+		CreatedAfter:  query.CreatedAfter,
+		CreatedBefore: query.CreatedBefore,
+		Country:       query.Country,
+		Countries:     query.Countries,
+		Status:        query.Status,
+		Interval:      query.Interval,
+	})
+	if err != nil {
+		span.RecordError(err)
+		svr.logger.Errorf(ctx, err, "error getting stats of users with country '%s' created after '%s' per %s", query.Country, query.CreatedAfter, query.Interval)
+		if errors.Is(err, user.ErrInvalid) {
+			return nil, invalidArgumentError(err)
+		}
+		return nil, status.Error(codes.Internal, msgInternalServerError)
+	}
+	return pbStatsFromStats(&stats), nil
+}
+
+// LookupUser implements the userspb.UsersServer.LookupUser function, allowing clients to find a single user by email
+// address or nickname
+func (svr *RPCServer) LookupUser(ctx context.Context, lookup *userspb.Lookup) (*userspb.User, error) {
+	span := trace.SpanFromContext(ctx)
+	svr.logger.Infof(ctx, "looking up user with email '%s' or nickname '%s'", lookup.GetEmail(), lookup.GetNickname())
+
+	usr, err := svr.service.Lookup(ctx, &user.Lookup{
+		Email:    lookup.GetEmail(),
+		Nickname: lookup.GetNickname(),
+	})
+	if err != nil {
+		svr.logger.Errorf(ctx, err, "error looking up user with email '%s' or nickname '%s'", lookup.GetEmail(), lookup.GetNickname())
+		span.RecordError(err)
+		switch {
+		case errors.Is(err, user.ErrNotFound):
+			return nil, status.Error(codes.NotFound, err.Error())
+		case errors.Is(err, user.ErrInvalid):
+			return nil, invalidArgumentError(err)
+		default:
+			return nil, status.Error(codes.Internal, msgInternalServerError)
+		}
+	}
+	return redact(ctx, pbUserFromSanitizedUser(&usr)), nil
+}
+
+// CheckAvailability implements the userspb.UsersServer.CheckAvailability function, allowing clients to check whether
+// a nickname or email address is taken before creating a user
+func (svr *RPCServer) CheckAvailability(ctx context.Context, check *userspb.AvailabilityCheck) (*userspb.Availability, error) {
+	span := trace.SpanFromContext(ctx)
+	svr.logger.Infof(ctx, "checking availability of nickname '%s' and email '%s'", check.Nickname, check.Email)
+
+	availability, err := svr.service.CheckAvailability(ctx, &user.AvailabilityCheck{
+		Nickname: check.Nickname,
+		Email:    check.Email,
+	})
+	if err != nil {
+		svr.logger.Errorf(ctx, err, "error checking availability of nickname '%s' and email '%s'", check.Nickname, check.Email)
+		span.RecordError(err)
+		if errors.Is(err, user.ErrInvalid) {
+			return nil, invalidArgumentError(err)
+		}
+		return nil, status.Error(codes.Internal, msgInternalServerError)
+	}
+	return &userspb.Availability{
+		NicknameAvailable: availability.NicknameAvailable,
+		EmailAvailable:    availability.EmailAvailable,
+	}, nil
+}
+
+// Authenticate implements the userspb.UsersServer.Authenticate function, allowing clients to check the credentials of a user
+func (svr *RPCServer) Authenticate(ctx context.Context, credentials *userspb.Credentials) (*userspb.AuthResult, error) {
+	span := trace.SpanFromContext(ctx)
+	svr.logger.Infof(ctx, "authenticating user %s", credentials.Email)
+
+	usr, err := svr.service.Authenticate(ctx, credentials.Email, credentials.Password, credentials.Code)
+	if err != nil {
+		svr.logger.Errorf(ctx, err, "error authenticating user %s", credentials.Email)
+		span.RecordError(err)
+		switch {
+		case errors.Is(err, user.ErrTwoFactorRequired):
+			return nil, twoFactorRequiredError(err)
+		case errors.Is(err, user.ErrInvalidCredentials), errors.Is(err, user.ErrInvalidTwoFactorCode):
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		default:
+			return nil, status.Error(codes.Internal, msgInternalServerError)
+		}
+	}
+	return &userspb.AuthResult{User: pbUserFromSanitizedUser(&usr)}, nil
+}
+
+// twoFactorStatusError converts an error returned by the two factor authentication functions of the service into a
+// status
+func twoFactorStatusError(err error) error {
+	switch {
+	case errors.Is(err, user.ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, user.ErrInvalid):
+		return invalidArgumentError(err)
+	case errors.Is(err, user.ErrInvalidTwoFactorCode):
+		return status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, user.ErrTwoFactorUnavailable),
+		errors.Is(err, user.ErrTwoFactorEnabled),
+		errors.Is(err, user.ErrTwoFactorNotEnabled),
+		errors.Is(err, user.ErrTwoFactorNotEnrolled),
+		errors.Is(err, user.ErrInvalidVersion):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, user.ErrUnavailable):
+		return status.Error(codes.Unavailable, err.Error())
+	default:
+		return status.Error(codes.Internal, msgInternalServerError)
+	}
+}
+
+// EnrollTwoFactor implements the userspb.UsersServer.EnrollTwoFactor function, allowing clients to start the
+// enrollment of users in two factor authentication. The secret is not logged
+func (svr *RPCServer) EnrollTwoFactor(ctx context.Context, userRef *userspb.Ref) (*userspb.TwoFactorEnrollment, error) {
+	span := trace.SpanFromContext(ctx)
+	svr.logger.Infof(ctx, "enrolling user %s in two factor authentication", userRef.Id)
+
+	enrollment, err := svr.service.EnrollTwoFactor(ctx, &user.Ref{ID: userRef.Id})
+	if err != nil {
+		svr.logger.Errorf(ctx, err, "error enrolling user %s in two factor authentication", userRef.Id)
+		span.RecordError(err)
+		return nil, twoFactorStatusError(err)
+	}
+	return &userspb.TwoFactorEnrollment{Secret: enrollment.Secret, Uri: enrollment.URI}, nil
+}
+
+// ConfirmTwoFactor implements the userspb.UsersServer.ConfirmTwoFactor function, allowing clients to enable two
+// factor authentication for enrolled users. Neither the code nor the recovery codes are logged
+func (svr *RPCServer) ConfirmTwoFactor(ctx context.Context, code *userspb.TwoFactorCode) (*userspb.RecoveryCodes, error) {
+	span := trace.SpanFromContext(ctx)
+	svr.logger.Infof(ctx, "confirming two factor authentication of user %s", code.Id)
+
+	recoveryCodes, err := svr.service.ConfirmTwoFactor(ctx, &user.TwoFactorCode{ID: code.Id, Code: code.Code})
+	if err != nil {
+		svr.logger.Errorf(ctx, err, "error confirming two factor authentication of user %s", code.Id)
+		span.RecordError(err)
+		return nil, twoFactorStatusError(err)
+	}
+	return &userspb.RecoveryCodes{Codes: recoveryCodes}, nil
+}
+
+// DisableTwoFactor implements the userspb.UsersServer.DisableTwoFactor function, allowing clients to turn two factor
+// authentication off. The code is not logged
+func (svr *RPCServer) DisableTwoFactor(ctx context.Context, code *userspb.TwoFactorCode) (*userspb.User, error) {
+	span := trace.SpanFromContext(ctx)
+	svr.logger.Infof(ctx, "disabling two factor authentication of user %s", code.Id)
+
+	usr, err := svr.service.DisableTwoFactor(ctx, &user.TwoFactorCode{ID: code.Id, Code: code.Code})
+	if err != nil {
+		svr.logger.Errorf(ctx, err, "error disabling two factor authentication of user %s", code.Id)
+		span.RecordError(err)
+		return nil, twoFactorStatusError(err)
+	}
+	return redact(ctx, pbUserFromUser(&usr)), nil
+}
+
+// RequestPasswordReset implements the userspb.UsersServer.RequestPasswordReset function, allowing clients to have a
+// password reset token sent to a user
+func (svr *RPCServer) RequestPasswordReset(ctx context.Context, req *userspb.PasswordResetRequest) (*emptypb.Empty, error) {
+	span := trace.SpanFromContext(ctx)
+	svr.logger.Infof(ctx, "requesting password reset for %s", req.Email)
+
+	if err := svr.service.RequestPasswordReset(ctx, req.Email); err != nil {
+		svr.logger.Errorf(ctx, err, "error requesting password reset for %s", req.Email)
+		span.RecordError(err)
+		if errors.Is(err, user.ErrUnavailable) {
+			return nil, status.Error(codes.Unavailable, err.Error())
+		}
+		return nil, status.Error(codes.Internal, msgInternalServerError)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// ResetPassword implements the userspb.UsersServer.ResetPassword function, allowing clients to set the password of
+// a user with a password reset token. The token is not logged
+func (svr *RPCServer) ResetPassword(ctx context.Context, reset *userspb.PasswordReset) (*userspb.User, error) {
+	span := trace.SpanFromContext(ctx)
+	svr.logger.Infof(ctx, "resetting password")
+
+	usr, err := svr.service.ResetPassword(ctx, &user.PasswordReset{
+		Token:           reset.Token,
+		Password:        reset.Password,
+		ConfirmPassword: reset.ConfirmPassword,
+	})
+	if err != nil {
+		svr.logger.Errorf(ctx, err, "error resetting password")
+		span.RecordError(err)
+		// Validation failures include google.rpc.BadRequest details describing each invalid field.
+		switch {
+		case errors.Is(err, user.ErrInvalid):
+			return nil, invalidArgumentError(err)
+		case errors.Is(err, user.ErrInvalidResetToken):
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		case errors.Is(err, user.ErrUnavailable):
+			return nil, status.Error(codes.Unavailable, err.Error())
+		default:
+			return nil, status.Error(codes.Internal, msgInternalServerError)
+		}
+	}
+	svr.logger.Infof(ctx, "reset password of user %s", usr.ID)
+	return redact(ctx, pbUserFromUser(&usr)), nil
+}
+
+// WatchUsers implements the userspb.UsersServer.WatchUsers function, allowing clients to subscribe to change events
+func (svr *RPCServer) WatchUsers(req *userspb.WatchRequest, stream userspb.Users_WatchUsersServer) error {
+	ctx := stream.Context()
+	span := trace.SpanFromContext(ctx)
+	svr.logger.Infof(ctx, "watching users for actions %v", req.Actions)
+
+	events := svr.service.Watch(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case evt, more := <-events:
+			if !more {
+				svr.logger.Infof(ctx, "watch subscription closed by service")
+				return status.Error(codes.Unavailable, msgWatchClosed)
+			}
+			if !watching(req.Actions, evt.Action) {
+				continue
+			}
+			pbEvt := pbUserEventFromEvent(&evt)
+			redact(ctx, pbEvt.Data)
+			if err := stream.Send(pbEvt); err != nil {
+				svr.logger.Errorf(ctx, err, "error sending event with id %s and version %d to watcher", evt.ID, evt.Version)
+				span.RecordError(err)
+				return err
+			}
+		}
+	}
 }
@@ -2,23 +2,29 @@ package rpc_test
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"math"
 	"net"
 	"testing"
+	"time"
 
 	"github.com/bxcodec/faker/v3"
 	"github.com/google/uuid"
-	"github.com/robotlovesyou/fitest/pkg/log"
 	"github.com/robotlovesyou/fitest/pkg/rpc"
 	"github.com/robotlovesyou/fitest/pkg/user"
 	"github.com/robotlovesyou/fitest/pkg/utctime"
 	"github.com/robotlovesyou/fitest/userspb"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
 )
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -31,16 +37,79 @@ import (
 ////////////////////////////////////////////////////////////////////////////////
 ////////////////////////////////////////////////////////////////////////////////
 
+// nopLogger discards everything logged by the code under test
+type nopLogger struct{}
+
+func (nopLogger) Infof(context.Context, string, ...any) {}
+
+func (nopLogger) Errorf(context.Context, error, string, ...any) {}
+
 type stubCreate func(context.Context, *user.NewUser) (user.User, error)
 type stubUpdate func(context.Context, *user.Update) (user.User, error)
+type stubChangePassword func(context.Context, *user.PasswordChange) (user.User, error)
+type stubGet func(context.Context, *user.Ref) (user.SanitizedUser, error)
 type stubDelete func(context.Context, *user.Ref) error
+type stubTouchLastSeen func(context.Context, *user.Ref) error
+type stubRestore func(context.Context, *user.Ref) (user.User, error)
+type stubReplayUserEvents func(context.Context, *user.Ref) (user.User, error)
+type stubDeadLetters func(context.Context) ([]user.DeadLetter, error)
+type stubRequeueDeadLetter func(context.Context, *user.Ref) error
+type stubAnonymize func(context.Context, *user.Ref) (user.User, error)
+type stubExportData func(context.Context, *user.Ref) (user.DataExport, error)
+type stubChangeStatus func(context.Context, *user.Ref) (user.User, error)
+type stubBatchDelete func(context.Context, *user.Refs) ([]user.DeleteResult, error)
+type stubBatchGet func(context.Context, *user.Refs) ([]user.GetResult, error)
 type stubFind func(context.Context, *user.Query) (user.Page, error)
+type stubCount func(context.Context, *user.Query) (int64, error)
+type stubStats func(context.Context, *user.StatsQuery) (user.Stats, error)
+type stubExport func(context.Context, *user.Query, func(*user.SanitizedUser) error) error
+type stubLookup func(context.Context, *user.Lookup) (user.SanitizedUser, error)
+type stubCheckAvailability func(context.Context, *user.AvailabilityCheck) (user.Availability, error)
+type stubWatch func(context.Context) <-chan user.Event
+type stubAuthenticate func(ctx context.Context, email, password, code string) (user.SanitizedUser, error)
+type stubEnrollTwoFactor func(context.Context, *user.Ref) (user.TwoFactorEnrollment, error)
+type stubConfirmTwoFactor func(context.Context, *user.TwoFactorCode) ([]string, error)
+type stubDisableTwoFactor func(context.Context, *user.TwoFactorCode) (user.User, error)
+type stubRequestPasswordReset func(ctx context.Context, email string) error
+type stubResetPassword func(context.Context, *user.PasswordReset) (user.User, error)
+type stubChangeEmail func(context.Context, *user.EmailChange) error
+type stubConfirmEmailChange func(context.Context, *user.EmailConfirmation) (user.User, error)
+type stubChangeNickname func(context.Context, *user.NicknameChange) (user.User, error)
 
 type stubUsersService struct {
-	create stubCreate
-	update stubUpdate
-	delete stubDelete
-	find   stubFind
+	create               stubCreate
+	update               stubUpdate
+	changePassword       stubChangePassword
+	get                  stubGet
+	delete               stubDelete
+	touchLastSeen        stubTouchLastSeen
+	batchDelete          stubBatchDelete
+	batchGet             stubBatchGet
+	anonymize            stubAnonymize
+	exportData           stubExportData
+	suspend              stubChangeStatus
+	reactivate           stubChangeStatus
+	ban                  stubChangeStatus
+	restore              stubRestore
+	replayUserEvents     stubReplayUserEvents
+	deadLetters          stubDeadLetters
+	requeueDeadLetter    stubRequeueDeadLetter
+	find                 stubFind
+	count                stubCount
+	stats                stubStats
+	export               stubExport
+	lookup               stubLookup
+	checkAvailability    stubCheckAvailability
+	watch                stubWatch
+	auth                 stubAuthenticate
+	enrollTwoFactor      stubEnrollTwoFactor
+	confirmTwoFactor     stubConfirmTwoFactor
+	disableTwoFactor     stubDisableTwoFactor
+	requestPasswordReset stubRequestPasswordReset
+	resetPassword        stubResetPassword
+	changeEmail          stubChangeEmail
+	confirmEmailChange   stubConfirmEmailChange
+	changeNickname       stubChangeNickname
 }
 
 func newStubService() *stubUsersService {
@@ -51,12 +120,99 @@ func newStubService() *stubUsersService {
 		update: func(context.Context, *user.Update) (user.User, error) {
 			panic("stub update user")
 		},
+		changePassword: func(context.Context, *user.PasswordChange) (user.User, error) {
+			panic("stub change password")
+		},
+		get: func(context.Context, *user.Ref) (user.SanitizedUser, error) {
+			panic("stub get user")
+		},
 		delete: func(context.Context, *user.Ref) error {
 			panic("stub delete user")
 		},
+		touchLastSeen: func(context.Context, *user.Ref) error {
+			panic("stub touch last seen")
+		},
+		restore: func(context.Context, *user.Ref) (user.User, error) {
+			panic("stub restore user")
+		},
+		replayUserEvents: func(context.Context, *user.Ref) (user.User, error) {
+			panic("stub replay user events")
+		},
+		deadLetters: func(context.Context) ([]user.DeadLetter, error) {
+			panic("stub dead letters")
+		},
+		requeueDeadLetter: func(context.Context, *user.Ref) error {
+			panic("stub requeue dead letter")
+		},
+		anonymize: func(context.Context, *user.Ref) (user.User, error) {
+			panic("stub anonymize user")
+		},
+		exportData: func(context.Context, *user.Ref) (user.DataExport, error) {
+			panic("stub export data")
+		},
+		suspend: func(context.Context, *user.Ref) (user.User, error) {
+			panic("stub suspend user")
+		},
+		reactivate: func(context.Context, *user.Ref) (user.User, error) {
+			panic("stub reactivate user")
+		},
+		ban: func(context.Context, *user.Ref) (user.User, error) {
+			panic("stub ban user")
+		},
+		batchDelete: func(context.Context, *user.Refs) ([]user.DeleteResult, error) {
+			panic("stub batch delete users")
+		},
+		batchGet: func(context.Context, *user.Refs) ([]user.GetResult, error) {
+			panic("stub batch get users")
+		},
 		find: func(context.Context, *user.Query) (user.Page, error) {
 			panic("stub find users")
 		},
+		count: func(context.Context, *user.Query) (int64, error) {
+			panic("stub count users")
+		},
+		stats: func(context.Context, *user.StatsQuery) (user.Stats, error) {
+			panic("stub user stats")
+		},
+		export: func(context.Context, *user.Query, func(*user.SanitizedUser) error) error {
+			panic("stub export users")
+		},
+		lookup: func(context.Context, *user.Lookup) (user.SanitizedUser, error) {
+			panic("stub lookup user")
+		},
+		checkAvailability: func(context.Context, *user.AvailabilityCheck) (user.Availability, error) {
+			panic("stub check availability")
+		},
+		watch: func(context.Context) <-chan user.Event {
+			panic("stub watch users")
+		},
+		auth: func(context.Context, string, string, string) (user.SanitizedUser, error) {
+			panic("stub authenticate")
+		},
+		enrollTwoFactor: func(context.Context, *user.Ref) (user.TwoFactorEnrollment, error) {
+			panic("stub enroll two factor")
+		},
+		confirmTwoFactor: func(context.Context, *user.TwoFactorCode) ([]string, error) {
+			panic("stub confirm two factor")
+		},
+		disableTwoFactor: func(context.Context, *user.TwoFactorCode) (user.User, error) {
+			panic("stub disable two factor")
+		},
+		requestPasswordReset: func(context.Context, string) error {
+			panic("stub request password reset")
+		},
+		resetPassword: func(context.Context, *user.PasswordReset) (user.User, error) {
+			panic("stub reset password")
+		},
+		changeEmail: func(context.Context, *user.EmailChange) error {
+			panic("stub change email")
+		},
+		confirmEmailChange: func(context.Context, *user.EmailConfirmation) (user.User, error) {
+			panic("stub confirm email change")
+		},
+		changeNickname: func(context.Context, *user.NicknameChange) (user.User, error) {
+			panic("stub change nickname")
+		},
 	}
 }
 
@@ -68,14 +224,130 @@ func (svc *stubUsersService) Update(ctx context.Context, userUpdate *user.Update
 	return svc.update(ctx, userUpdate)
 }
 
+func (svc *stubUsersService) ChangePassword(ctx context.Context, change *user.PasswordChange) (user.User, error) {
+	return svc.changePassword(ctx, change)
+}
+
+func (svc *stubUsersService) Get(ctx context.Context, userRef *user.Ref) (user.SanitizedUser, error) {
+	return svc.get(ctx, userRef)
+}
+
 func (svc *stubUsersService) Delete(ctx context.Context, userRef *user.Ref) error {
 	return svc.delete(ctx, userRef)
 }
 
+func (svc *stubUsersService) TouchLastSeen(ctx context.Context, userRef *user.Ref) error {
+	return svc.touchLastSeen(ctx, userRef)
+}
+
+func (svc *stubUsersService) Restore(ctx context.Context, userRef *user.Ref) (user.User, error) {
+	return svc.restore(ctx, userRef)
+}
+
+func (svc *stubUsersService) ReplayUserEvents(ctx context.Context, userRef *user.Ref) (user.User, error) {
+	return svc.replayUserEvents(ctx, userRef)
+}
+
+func (svc *stubUsersService) DeadLetters(ctx context.Context) ([]user.DeadLetter, error) {
+	return svc.deadLetters(ctx)
+}
+
+func (svc *stubUsersService) RequeueDeadLetter(ctx context.Context, userRef *user.Ref) error {
+	return svc.requeueDeadLetter(ctx, userRef)
+}
+
+func (svc *stubUsersService) Anonymize(ctx context.Context, userRef *user.Ref) (user.User, error) {
+	return svc.anonymize(ctx, userRef)
+}
+
+func (svc *stubUsersService) ExportData(ctx context.Context, userRef *user.Ref) (user.DataExport, error) {
+	return svc.exportData(ctx, userRef)
+}
+
+func (svc *stubUsersService) Suspend(ctx context.Context, userRef *user.Ref) (user.User, error) {
+	return svc.suspend(ctx, userRef)
+}
+
+func (svc *stubUsersService) Reactivate(ctx context.Context, userRef *user.Ref) (user.User, error) {
+	return svc.reactivate(ctx, userRef)
+}
+
+func (svc *stubUsersService) Ban(ctx context.Context, userRef *user.Ref) (user.User, error) {
+	return svc.ban(ctx, userRef)
+}
+
+func (svc *stubUsersService) BatchDelete(ctx context.Context, refs *user.Refs) ([]user.DeleteResult, error) {
+	return svc.batchDelete(ctx, refs)
+}
+
+func (svc *stubUsersService) BatchGet(ctx context.Context, refs *user.Refs) ([]user.GetResult, error) {
+	return svc.batchGet(ctx, refs)
+}
+
 func (svc stubUsersService) Find(ctx context.Context, query *user.Query) (user.Page, error) {
 	return svc.find(ctx, query)
 }
 
+func (svc *stubUsersService) Count(ctx context.Context, query *user.Query) (int64, error) {
+	return svc.count(ctx, query)
+}
+
+func (svc *stubUsersService) Stats(ctx context.Context, query *user.StatsQuery) (user.Stats, error) {
+	return svc.stats(ctx, query)
+}
+
+func (svc *stubUsersService) Export(ctx context.Context, query *user.Query, send func(*user.SanitizedUser) error) error {
+	return svc.export(ctx, query, send)
+}
+
+func (svc *stubUsersService) Lookup(ctx context.Context, lookup *user.Lookup) (user.SanitizedUser, error) {
+	return svc.lookup(ctx, lookup)
+}
+
+func (svc *stubUsersService) CheckAvailability(ctx context.Context, check *user.AvailabilityCheck) (user.Availability, error) {
+	return svc.checkAvailability(ctx, check)
+}
+
+func (svc *stubUsersService) Watch(ctx context.Context) <-chan user.Event {
+	return svc.watch(ctx)
+}
+
+func (svc *stubUsersService) Authenticate(ctx context.Context, email, password, code string) (user.SanitizedUser, error) {
+	return svc.auth(ctx, email, password, code)
+}
+
+func (svc *stubUsersService) EnrollTwoFactor(ctx context.Context, ref *user.Ref) (user.TwoFactorEnrollment, error) {
+	return svc.enrollTwoFactor(ctx, ref)
+}
+
+func (svc *stubUsersService) ConfirmTwoFactor(ctx context.Context, code *user.TwoFactorCode) ([]string, error) {
+	return svc.confirmTwoFactor(ctx, code)
+}
+
+func (svc *stubUsersService) DisableTwoFactor(ctx context.Context, code *user.TwoFactorCode) (user.User, error) {
+	return svc.disableTwoFactor(ctx, code)
+}
+
+func (svc *stubUsersService) RequestPasswordReset(ctx context.Context, email string) error {
+	return svc.requestPasswordReset(ctx, email)
+}
+
+func (svc *stubUsersService) ResetPassword(ctx context.Context, reset *user.PasswordReset) (user.User, error) {
+	return svc.resetPassword(ctx, reset)
+}
+
+func (svc *stubUsersService) ChangeEmail(ctx context.Context, change *user.EmailChange) error {
+	return svc.changeEmail(ctx, change)
+}
+
+func (svc *stubUsersService) ConfirmEmailChange(ctx context.Context, confirmation *user.EmailConfirmation) (user.User, error) {
+	return svc.confirmEmailChange(ctx, confirmation)
+}
+
+func (svc *stubUsersService) ChangeNickname(ctx context.Context, change *user.NicknameChange) (user.User, error) {
+	return svc.changeNickname(ctx, change)
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 ////////////////////////////////////////////////////////////////////////////////
 ////
@@ -122,10 +394,18 @@ func fakeUserRef() userspb.Ref {
 // fakeUsersQuery creates a fake query for testing
 func fakeUsersQuery() userspb.Query {
 	return userspb.Query{
-		CreatedAfter: utctime.Now().Format(user.TimeFormat),
-		Country:      "DE",
-		Length:       10,
-		Page:         11,
+		CreatedAfter:  utctime.Now().Format(user.TimeFormat),
+		Country:       "DE",
+		Length:        10,
+		Page:          11,
+		SortBy:        "last_name",
+		SortDirection: userspb.SortDirection_SORT_DESCENDING,
+		Status:        user.StatusActive,
+		Search:        "Max",
+		InactiveSince: utctime.Now().Format(user.TimeFormat),
+		Countries:     []string{"NL", "BE"},
+		CreatedBefore: utctime.Now().Format(user.TimeFormat),
+		SkipTotal:     true,
 	}
 }
 
@@ -168,6 +448,7 @@ func userFromUserUpdate(userUpdate user.Update) user.User {
 		Nickname:     faker.Username(),
 		PasswordHash: "HashOfASuperSecretPassword",
 		Country:      userUpdate.Country,
+		AvatarURL:    userUpdate.AvatarURL,
 		CreatedAt:    utctime.Now(),
 		UpdatedAt:    utctime.Now(),
 	}
@@ -180,9 +461,11 @@ func usersPageFromQuery(query user.Query) user.Page {
 		items = append(items, fakeSanitizedUser())
 	}
 	return user.Page{
-		Page:  query.Page,
-		Total: query.Page * int64(query.Length),
-		Items: items,
+		Page:       query.Page,
+		Total:      (query.Page + 1) * int64(query.Length),
+		Items:      items,
+		HasNext:    true,
+		TotalPages: query.Page + 1,
 	}
 }
 
@@ -196,6 +479,7 @@ func compareUserToPBUser(t *testing.T, usr user.User, pbUser *userspb.User) {
 	require.Equal(t, usr.Country, pbUser.Country)
 	require.Equal(t, usr.CreatedAt.Format(user.TimeFormat), pbUser.CreatedAt)
 	require.Equal(t, usr.UpdatedAt.Format(user.TimeFormat), pbUser.UpdatedAt)
+	require.Equal(t, usr.Status, pbUser.Status)
 }
 
 func compareSanitizedUserToPBUser(t *testing.T, usr user.SanitizedUser, pbUser *userspb.User) {
@@ -207,23 +491,21 @@ func compareSanitizedUserToPBUser(t *testing.T, usr user.SanitizedUser, pbUser *
 	require.Equal(t, usr.Country, pbUser.Country)
 	require.Equal(t, usr.CreatedAt, pbUser.CreatedAt)
 	require.Equal(t, usr.UpdatedAt, pbUser.UpdatedAt)
+	require.Equal(t, usr.Status, pbUser.Status)
 }
 
 // withClient creates and instantiates a grpc server which delegates calls to the provided
 // rpc.UsersService imlementation, and calls the callback f with a client connected to the
-// grpc server
-func withClient(svc rpc.UsersService, f func(userspb.UsersClient)) {
+// grpc server. Any provided options are used when creating the grpc server
+func withClient(svc rpc.UsersService, f func(userspb.UsersClient), opts ...grpc.ServerOption) {
 	lis, err := net.Listen("tcp", "localhost:0")
 	if err != nil {
 		panic(fmt.Sprintf("cannot open random port: %v", err))
 	}
 	serverAddress := lis.Addr().String()
 
-	logger, err := log.New("RPC Tests")
-	if err != nil {
-		panic("cannot create logger")
-	}
-	grpcServer := grpc.NewServer()
+	logger := nopLogger{}
+	grpcServer := grpc.NewServer(opts...)
 	userspb.RegisterUsersServer(grpcServer, rpc.New(svc, logger))
 	go grpcServer.Serve(lis)
 	defer grpcServer.Stop()
@@ -277,6 +559,22 @@ func TestCreateUserRPCCallsUsersServiceWithCorrectValues(t *testing.T) {
 	})
 }
 
+func TestCreateUserRPCPassesIdempotencyKeyAndCallerToService(t *testing.T) {
+	stubService := newStubService()
+	request := fakeNewUser()
+	withClient(stubService, func(client userspb.UsersClient) {
+		stubService.create = func(ctx context.Context, newUser *user.NewUser) (user.User, error) {
+			require.Equal(t, "some key", newUser.IdempotencyKey)
+			require.Equal(t, "api-key:reporting", newUser.Caller)
+			return userFromNewUser(*newUser), nil
+		}
+
+		ctx := metadata.AppendToOutgoingContext(context.Background(), rpc.IdempotencyKeyKey, "some key")
+		_, err := client.CreateUser(withAPIKey(ctx, "reporting-key"), &request)
+		require.NoError(t, err)
+	}, apiKeyServerOptions(t)...)
+}
+
 func TestCorrectErrorCodesSentCreatingUser(t *testing.T) {
 	// For the sake of brevity, I am only going to use grpc error codes when the service fails.
 	// In a real world implementation I would, where appropriate, include detail via status details
@@ -295,6 +593,21 @@ func TestCorrectErrorCodesSentCreatingUser(t *testing.T) {
 			result:       user.ErrInvalid,
 			expectedCode: codes.InvalidArgument,
 		},
+		{
+			name:         "Rejected",
+			result:       &user.RejectedError{Message: "rejected by a hook"},
+			expectedCode: codes.FailedPrecondition,
+		},
+		{
+			name:         "Idempotency key reused",
+			result:       user.ErrIdempotencyKeyReused,
+			expectedCode: codes.FailedPrecondition,
+		},
+		{
+			name:         "Unavailable",
+			result:       user.ErrUnavailable,
+			expectedCode: codes.Unavailable,
+		},
 		{
 			name:         "Internal",
 			result:       errors.New("some unexpected error"),
@@ -317,6 +630,85 @@ func TestCorrectErrorCodesSentCreatingUser(t *testing.T) {
 	}
 }
 
+func TestConflictsCreatingUserNameTheFieldInUse(t *testing.T) {
+	cases := []struct {
+		name   string
+		result error
+		reason string
+		field  string
+	}{
+		{name: "email", result: user.ErrEmailInUse, reason: rpc.ReasonEmailInUse, field: "email"},
+		{name: "nickname", result: user.ErrNicknameInUse, reason: rpc.ReasonNicknameInUse, field: "nickname"},
+	}
+	for _, testCase := range cases {
+		t.Run(testCase.name, func(t *testing.T) {
+			stubService := newStubService()
+			request := fakeNewUser()
+			withClient(stubService, func(client userspb.UsersClient) {
+				stubService.create = func(ctx context.Context, _ *user.NewUser) (usr user.User, err error) {
+					return usr, testCase.result
+				}
+
+				_, err := client.CreateUser(context.Background(), &request)
+				st := status.Convert(err)
+				require.Equal(t, codes.AlreadyExists, st.Code())
+				require.Len(t, st.Details(), 1)
+				info, ok := st.Details()[0].(*errdetails.ErrorInfo)
+				require.True(t, ok)
+				require.Equal(t, testCase.reason, info.Reason)
+				require.Equal(t, rpc.ErrorDomain, info.Domain)
+				require.Equal(t, testCase.field, info.Metadata["field"])
+			})
+		})
+	}
+}
+
+func TestRejectedChangesIncludeTheReason(t *testing.T) {
+	cases := []struct {
+		name   string
+		result error
+		reason string
+	}{
+		{name: "with reason", result: &user.RejectedError{Reason: "SANCTIONED", Message: "sanctioned"}, reason: "SANCTIONED"},
+		{name: "without reason", result: &user.RejectedError{Message: "rejected"}, reason: rpc.ReasonRejected},
+	}
+	for _, testCase := range cases {
+		t.Run(testCase.name, func(t *testing.T) {
+			stubService := newStubService()
+			request := fakeNewUser()
+			withClient(stubService, func(client userspb.UsersClient) {
+				stubService.create = func(context.Context, *user.NewUser) (usr user.User, err error) {
+					return usr, testCase.result
+				}
+
+				_, err := client.CreateUser(context.Background(), &request)
+				st := status.Convert(err)
+				require.Equal(t, codes.FailedPrecondition, st.Code())
+				require.Len(t, st.Details(), 1)
+				info, ok := st.Details()[0].(*errdetails.ErrorInfo)
+				require.True(t, ok)
+				require.Equal(t, testCase.reason, info.Reason)
+				require.Equal(t, rpc.ErrorDomain, info.Domain)
+			})
+		})
+	}
+}
+
+func TestConflictWithoutFieldCreatingUserHasNoDetails(t *testing.T) {
+	stubService := newStubService()
+	request := fakeNewUser()
+	withClient(stubService, func(client userspb.UsersClient) {
+		stubService.create = func(ctx context.Context, _ *user.NewUser) (usr user.User, err error) {
+			return usr, user.ErrAlreadyExists
+		}
+
+		_, err := client.CreateUser(context.Background(), &request)
+		st := status.Convert(err)
+		require.Equal(t, codes.AlreadyExists, st.Code())
+		require.Empty(t, st.Details())
+	})
+}
+
 func TestUpdateUserRPCCallsServiceAndRespondsWithCorrectValues(t *testing.T) {
 	stubService := newStubService()
 	request := fakeUserUpdate()
@@ -365,6 +757,16 @@ func TestCorrectErrorCodesSentUpdatingUser(t *testing.T) {
 			result:       user.ErrInvalidVersion,
 			expectedCode: codes.FailedPrecondition,
 		},
+		{
+			name:         "Rejected",
+			result:       &user.RejectedError{Message: "rejected by a hook"},
+			expectedCode: codes.FailedPrecondition,
+		},
+		{
+			name:         "Unavailable",
+			result:       user.ErrUnavailable,
+			expectedCode: codes.Unavailable,
+		},
 		{
 			name:         "Internal",
 			result:       errors.New("some unexpected error"),
@@ -420,6 +822,11 @@ func TestCorrectErrorCodesSentDeletingUser(t *testing.T) {
 			result:       user.ErrInvalid,
 			expectedCode: codes.InvalidArgument,
 		},
+		{
+			name:         "Rejected",
+			result:       &user.RejectedError{Message: "rejected by a hook"},
+			expectedCode: codes.FailedPrecondition,
+		},
 		{
 			name:         "Internal",
 			result:       errors.New("some unexpected error"),
@@ -442,44 +849,1392 @@ func TestCorrectErrorCodesSentDeletingUser(t *testing.T) {
 	}
 }
 
-func TestFindUsersRPCCallsServiceAndRespondsWithCorrectValues(t *testing.T) {
+func TestTouchLastSeenRPCCallsUsersService(t *testing.T) {
 	stubService := newStubService()
-	request := fakeUsersQuery()
-	var response user.Page
+	request := fakeUserRef()
 	withClient(stubService, func(client userspb.UsersClient) {
-		// check that the request payload has been conveyed correctly to the users service
-		stubService.find = func(ctx context.Context, query *user.Query) (user.Page, error) {
-			require.Equal(t, request.CreatedAfter, query.CreatedAfter)
-			require.Equal(t, request.Country, query.Country)
-			require.Equal(t, request.Page, query.Page)
-			require.Equal(t, request.Length, query.Length)
-
-			response = usersPageFromQuery(*query)
-			return response, nil
+		stubService.touchLastSeen = func(ctx context.Context, ref *user.Ref) error {
+			require.Equal(t, request.Id, ref.ID)
+			return nil
 		}
 
-		// check that the Page has been correctly conveyed by the RPC
-		page, err := client.FindUsers(context.Background(), &request)
+		_, err := client.TouchLastSeen(context.Background(), &request)
 		require.NoError(t, err)
-		require.Len(t, page.Items, len(response.Items))
-		require.Equal(t, page.Total, response.Total)
-		for i, itm := range page.Items {
-			compareSanitizedUserToPBUser(t, response.Items[i], itm)
+	})
+}
+
+func TestCorrectErrorCodesSentTouchingLastSeen(t *testing.T) {
+	cases := []struct {
+		name         string
+		result       error
+		expectedCode codes.Code
+	}{
+		{
+			name:         "NotFound",
+			result:       user.ErrNotFound,
+			expectedCode: codes.NotFound,
+		},
+		{
+			name:         "Invalid",
+			result:       user.ErrInvalid,
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "Internal",
+			result:       errors.New("some unexpected error"),
+			expectedCode: codes.Internal,
+		},
+	}
+	for _, testCase := range cases {
+		t.Run(testCase.name, func(t *testing.T) {
+			stubService := newStubService()
+			request := fakeUserRef()
+			withClient(stubService, func(client userspb.UsersClient) {
+				stubService.touchLastSeen = func(context.Context, *user.Ref) error {
+					return testCase.result
+				}
+
+				_, err := client.TouchLastSeen(context.Background(), &request)
+				require.Equal(t, testCase.expectedCode.String(), status.Code(err).String())
+			})
+		})
+	}
+}
+
+func TestRestoreUserRPCCallsServiceAndRespondsWithUser(t *testing.T) {
+	stubService := newStubService()
+	request := fakeUserRef()
+	var response user.User
+	withClient(stubService, func(client userspb.UsersClient) {
+		stubService.restore = func(_ context.Context, ref *user.Ref) (user.User, error) {
+			require.Equal(t, request.Id, ref.ID)
+			response = userFromNewUser(user.NewUser{FirstName: "Max", LastName: "Mustermann", Country: "DE"})
+			return response, nil
 		}
+		usr, err := client.RestoreUser(context.Background(), &request)
+		require.NoError(t, err)
+		compareUserToPBUser(t, response, usr)
 	})
 }
 
-func TestCorrectErrorCodeSentFindingUsers(t *testing.T) {
-	// For the sake of brevity, I am only going to use grpc error codes when the service fails.
-	// In a real world implementation I would, where appropriate, include detail via status details
+func TestCorrectErrorCodeSentRestoringUser(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		code codes.Code
+	}{
+		{name: "invalid", err: user.ErrInvalid, code: codes.InvalidArgument},
+		{name: "not found", err: user.ErrNotFound, code: codes.NotFound},
+		{name: "unexpected", err: errors.New("some unexpected error"), code: codes.Internal},
+	}
+	for _, testCase := range cases {
+		t.Run(testCase.name, func(t *testing.T) {
+			stubService := newStubService()
+			request := fakeUserRef()
+			withClient(stubService, func(client userspb.UsersClient) {
+				stubService.restore = func(context.Context, *user.Ref) (usr user.User, err error) {
+					return usr, testCase.err
+				}
+				_, err := client.RestoreUser(context.Background(), &request)
+				require.Equal(t, testCase.code.String(), status.Code(err).String())
+			})
+		})
+	}
+}
+
+func TestReplayUserEventsRPCCallsServiceAndRespondsWithUser(t *testing.T) {
 	stubService := newStubService()
-	request := fakeUsersQuery()
+	request := fakeUserRef()
+	var response user.User
 	withClient(stubService, func(client userspb.UsersClient) {
-		stubService.find = func(ctx context.Context, _ *user.Query) (page user.Page, err error) {
-			return page, errors.New("some unexpected error")
+		stubService.replayUserEvents = func(_ context.Context, ref *user.Ref) (user.User, error) {
+			require.Equal(t, request.Id, ref.ID)
+			response = userFromNewUser(user.NewUser{FirstName: "Max", LastName: "Mustermann", Country: "DE"})
+			return response, nil
 		}
+		usr, err := client.ReplayUserEvents(context.Background(), &request)
+		require.NoError(t, err)
+		compareUserToPBUser(t, response, usr)
+	})
+}
 
-		_, err := client.FindUsers(context.Background(), &request)
-		require.Equal(t, codes.Internal.String(), status.Code(err).String())
+func TestCorrectErrorCodeSentReplayingUserEvents(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		code codes.Code
+	}{
+		{name: "invalid", err: user.ErrInvalid, code: codes.InvalidArgument},
+		{name: "not found", err: user.ErrNotFound, code: codes.NotFound},
+		{name: "invalid version", err: user.ErrInvalidVersion, code: codes.FailedPrecondition},
+		{name: "unexpected", err: errors.New("some unexpected error"), code: codes.Internal},
+	}
+	for _, testCase := range cases {
+		t.Run(testCase.name, func(t *testing.T) {
+			stubService := newStubService()
+			request := fakeUserRef()
+			withClient(stubService, func(client userspb.UsersClient) {
+				stubService.replayUserEvents = func(context.Context, *user.Ref) (usr user.User, err error) {
+					return usr, testCase.err
+				}
+				_, err := client.ReplayUserEvents(context.Background(), &request)
+				require.Equal(t, testCase.code.String(), status.Code(err).String())
+			})
+		})
+	}
+}
+
+func TestListDeadLettersRPCRespondsWithDeadLetters(t *testing.T) {
+	stubService := newStubService()
+	deadLetter := user.DeadLetter{
+		ID:             uuid.New(),
+		Version:        2,
+		Action:         "Updated",
+		CreatedAt:      time.Date(2022, 4, 1, 12, 0, 0, 0, time.UTC),
+		DeadLetteredAt: time.Date(2022, 4, 1, 13, 0, 0, 0, time.UTC),
+		Attempts:       10,
+	}
+	withClient(stubService, func(client userspb.UsersClient) {
+		stubService.deadLetters = func(context.Context) ([]user.DeadLetter, error) {
+			return []user.DeadLetter{deadLetter}, nil
+		}
+		res, err := client.ListDeadLetters(context.Background(), &userspb.DeadLettersRequest{})
+		require.NoError(t, err)
+		require.Len(t, res.DeadLetters, 1)
+		require.Equal(t, deadLetter.ID.String(), res.DeadLetters[0].Id)
+		require.Equal(t, deadLetter.Version, res.DeadLetters[0].Version)
+		require.Equal(t, deadLetter.Action, res.DeadLetters[0].Action)
+		require.Equal(t, "2022-04-01T12:00:00Z", res.DeadLetters[0].CreatedAt)
+		require.Equal(t, "2022-04-01T13:00:00Z", res.DeadLetters[0].DeadLetteredAt)
+		require.Equal(t, deadLetter.Attempts, res.DeadLetters[0].Attempts)
+	})
+}
+
+func TestCorrectErrorCodeSentListingDeadLetters(t *testing.T) {
+	stubService := newStubService()
+	withClient(stubService, func(client userspb.UsersClient) {
+		stubService.deadLetters = func(context.Context) ([]user.DeadLetter, error) {
+			return nil, errors.New("some unexpected error")
+		}
+		_, err := client.ListDeadLetters(context.Background(), &userspb.DeadLettersRequest{})
+		require.Equal(t, codes.Internal.String(), status.Code(err).String())
+	})
+}
+
+func TestRequeueDeadLetterRPCCallsService(t *testing.T) {
+	stubService := newStubService()
+	request := fakeUserRef()
+	called := false
+	withClient(stubService, func(client userspb.UsersClient) {
+		stubService.requeueDeadLetter = func(_ context.Context, ref *user.Ref) error {
+			require.Equal(t, request.Id, ref.ID)
+			called = true
+			return nil
+		}
+		_, err := client.RequeueDeadLetter(context.Background(), &request)
+		require.NoError(t, err)
+		require.True(t, called)
+	})
+}
+
+func TestCorrectErrorCodeSentRequeueingDeadLetters(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		code codes.Code
+	}{
+		{name: "invalid", err: user.ErrInvalid, code: codes.InvalidArgument},
+		{name: "not found", err: user.ErrNotFound, code: codes.NotFound},
+		{name: "unexpected", err: errors.New("some unexpected error"), code: codes.Internal},
+	}
+	for _, testCase := range cases {
+		t.Run(testCase.name, func(t *testing.T) {
+			stubService := newStubService()
+			request := fakeUserRef()
+			withClient(stubService, func(client userspb.UsersClient) {
+				stubService.requeueDeadLetter = func(context.Context, *user.Ref) error {
+					return testCase.err
+				}
+				_, err := client.RequeueDeadLetter(context.Background(), &request)
+				require.Equal(t, testCase.code.String(), status.Code(err).String())
+			})
+		})
+	}
+}
+
+func TestAnonymizeUserRPCCallsServiceAndRespondsWithUser(t *testing.T) {
+	stubService := newStubService()
+	request := fakeUserRef()
+	var response user.User
+	withClient(stubService, func(client userspb.UsersClient) {
+		stubService.anonymize = func(_ context.Context, ref *user.Ref) (user.User, error) {
+			require.Equal(t, request.Id, ref.ID)
+			response = userFromNewUser(user.NewUser{FirstName: user.AnonymizedName, LastName: user.AnonymizedName, Country: "DE"})
+			return response, nil
+		}
+		usr, err := client.AnonymizeUser(context.Background(), &request)
+		require.NoError(t, err)
+		compareUserToPBUser(t, response, usr)
+	})
+}
+
+func TestCorrectErrorCodeSentAnonymizingUser(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		code codes.Code
+	}{
+		{name: "invalid", err: user.ErrInvalid, code: codes.InvalidArgument},
+		{name: "not found", err: user.ErrNotFound, code: codes.NotFound},
+		{name: "invalid version", err: user.ErrInvalidVersion, code: codes.FailedPrecondition},
+		{name: "unexpected", err: errors.New("some unexpected error"), code: codes.Internal},
+	}
+	for _, testCase := range cases {
+		t.Run(testCase.name, func(t *testing.T) {
+			stubService := newStubService()
+			request := fakeUserRef()
+			withClient(stubService, func(client userspb.UsersClient) {
+				stubService.anonymize = func(context.Context, *user.Ref) (usr user.User, err error) {
+					return usr, testCase.err
+				}
+				_, err := client.AnonymizeUser(context.Background(), &request)
+				require.Equal(t, testCase.code.String(), status.Code(err).String())
+			})
+		})
+	}
+}
+
+func TestStatusRPCsCallServiceAndRespondWithUser(t *testing.T) {
+	cases := []struct {
+		name   string
+		status string
+		stub   func(*stubUsersService, stubChangeStatus)
+		call   func(userspb.UsersClient, *userspb.Ref) (*userspb.User, error)
+	}{
+		{
+			name:   "suspend",
+			status: user.StatusSuspended,
+			stub:   func(svc *stubUsersService, f stubChangeStatus) { svc.suspend = f },
+			call: func(client userspb.UsersClient, ref *userspb.Ref) (*userspb.User, error) {
+				return client.SuspendUser(context.Background(), ref)
+			},
+		},
+		{
+			name:   "reactivate",
+			status: user.StatusActive,
+			stub:   func(svc *stubUsersService, f stubChangeStatus) { svc.reactivate = f },
+			call: func(client userspb.UsersClient, ref *userspb.Ref) (*userspb.User, error) {
+				return client.ReactivateUser(context.Background(), ref)
+			},
+		},
+		{
+			name:   "ban",
+			status: user.StatusBanned,
+			stub:   func(svc *stubUsersService, f stubChangeStatus) { svc.ban = f },
+			call: func(client userspb.UsersClient, ref *userspb.Ref) (*userspb.User, error) {
+				return client.BanUser(context.Background(), ref)
+			},
+		},
+	}
+	for _, testCase := range cases {
+		t.Run(testCase.name, func(t *testing.T) {
+			stubService := newStubService()
+			request := fakeUserRef()
+			var response user.User
+			withClient(stubService, func(client userspb.UsersClient) {
+				testCase.stub(stubService, func(_ context.Context, ref *user.Ref) (user.User, error) {
+					require.Equal(t, request.Id, ref.ID)
+					response = userFromNewUser(user.NewUser{FirstName: "Jane", LastName: "Doe", Country: "DE"})
+					response.Status = testCase.status
+					return response, nil
+				})
+				usr, err := testCase.call(client, &request)
+				require.NoError(t, err)
+				compareUserToPBUser(t, response, usr)
+				require.Equal(t, testCase.status, usr.Status)
+			})
+		})
+	}
+}
+
+func TestCorrectErrorCodeSentChangingUserStatus(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		code codes.Code
+	}{
+		{name: "invalid", err: user.ErrInvalid, code: codes.InvalidArgument},
+		{name: "not found", err: user.ErrNotFound, code: codes.NotFound},
+		{name: "invalid version", err: user.ErrInvalidVersion, code: codes.FailedPrecondition},
+		{name: "invalid transition", err: user.ErrInvalidTransition, code: codes.FailedPrecondition},
+		{name: "unexpected", err: errors.New("some unexpected error"), code: codes.Internal},
+	}
+	for _, testCase := range cases {
+		t.Run(testCase.name, func(t *testing.T) {
+			stubService := newStubService()
+			request := fakeUserRef()
+			withClient(stubService, func(client userspb.UsersClient) {
+				stubService.suspend = func(context.Context, *user.Ref) (usr user.User, err error) {
+					return usr, testCase.err
+				}
+				_, err := client.SuspendUser(context.Background(), &request)
+				require.Equal(t, testCase.code.String(), status.Code(err).String())
+			})
+		})
+	}
+}
+
+func TestExportUserDataRPCCallsServiceAndRespondsWithJSONDocument(t *testing.T) {
+	stubService := newStubService()
+	request := fakeUserRef()
+	exported := fakeSanitizedUser()
+	withClient(stubService, func(client userspb.UsersClient) {
+		stubService.exportData = func(_ context.Context, ref *user.Ref) (user.DataExport, error) {
+			require.Equal(t, request.Id, ref.ID)
+			return user.DataExport{User: &exported, PendingEvents: []user.Event{{ID: exported.ID, Action: "Created"}}}, nil
+		}
+		data, err := client.ExportUserData(context.Background(), &request)
+		require.NoError(t, err)
+		var export user.DataExport
+		require.NoError(t, json.Unmarshal([]byte(data.Document), &export))
+		require.Equal(t, exported, *export.User)
+		require.Len(t, export.PendingEvents, 1)
+	})
+}
+
+func TestCorrectErrorCodeSentExportingUserData(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		code codes.Code
+	}{
+		{name: "invalid", err: user.ErrInvalid, code: codes.InvalidArgument},
+		{name: "not found", err: user.ErrNotFound, code: codes.NotFound},
+		{name: "unexpected", err: errors.New("some unexpected error"), code: codes.Internal},
+	}
+	for _, testCase := range cases {
+		t.Run(testCase.name, func(t *testing.T) {
+			stubService := newStubService()
+			request := fakeUserRef()
+			withClient(stubService, func(client userspb.UsersClient) {
+				stubService.exportData = func(context.Context, *user.Ref) (export user.DataExport, err error) {
+					return export, testCase.err
+				}
+				_, err := client.ExportUserData(context.Background(), &request)
+				require.Equal(t, testCase.code.String(), status.Code(err).String())
+			})
+		})
+	}
+}
+
+func TestBatchDeleteUsersRPCCallsUsersServiceAndRespondsWithResults(t *testing.T) {
+	stubService := newStubService()
+	request := userspb.Refs{Ids: []string{fakeUserRef().Id, fakeUserRef().Id}}
+	withClient(stubService, func(client userspb.UsersClient) {
+		stubService.batchDelete = func(ctx context.Context, refs *user.Refs) ([]user.DeleteResult, error) {
+			require.Equal(t, request.Ids, refs.IDs)
+			return []user.DeleteResult{
+				{ID: refs.IDs[0], Deleted: true},
+				{ID: refs.IDs[1], Deleted: false},
+			}, nil
+		}
+
+		result, err := client.BatchDeleteUsers(context.Background(), &request)
+		require.NoError(t, err)
+		require.Len(t, result.Results, 2)
+		require.Equal(t, request.Ids[0], result.Results[0].Id)
+		require.True(t, result.Results[0].Deleted)
+		require.Equal(t, request.Ids[1], result.Results[1].Id)
+		require.False(t, result.Results[1].Deleted)
+	})
+}
+
+func TestCorrectErrorCodesSentBatchDeletingUsers(t *testing.T) {
+	cases := []struct {
+		name         string
+		result       error
+		expectedCode codes.Code
+	}{
+		{
+			name:         "Invalid",
+			result:       user.ErrInvalid,
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "Rejected",
+			result:       &user.RejectedError{Message: "rejected by a hook"},
+			expectedCode: codes.FailedPrecondition,
+		},
+		{
+			name:         "Internal",
+			result:       errors.New("some unexpected error"),
+			expectedCode: codes.Internal,
+		},
+	}
+	for _, testCase := range cases {
+		t.Run(testCase.name, func(t *testing.T) {
+			stubService := newStubService()
+			request := userspb.Refs{Ids: []string{fakeUserRef().Id}}
+			withClient(stubService, func(client userspb.UsersClient) {
+				stubService.batchDelete = func(context.Context, *user.Refs) ([]user.DeleteResult, error) {
+					return nil, testCase.result
+				}
+
+				_, err := client.BatchDeleteUsers(context.Background(), &request)
+				require.Equal(t, testCase.expectedCode.String(), status.Code(err).String())
+			})
+		})
+	}
+}
+
+func TestBatchGetUsersRPCCallsUsersServiceAndRespondsWithResults(t *testing.T) {
+	usr := fakeSanitizedUser()
+	stubService := newStubService()
+	request := userspb.Refs{Ids: []string{fakeUserRef().Id, usr.ID}}
+	withClient(stubService, func(client userspb.UsersClient) {
+		stubService.batchGet = func(ctx context.Context, refs *user.Refs) ([]user.GetResult, error) {
+			require.Equal(t, request.Ids, refs.IDs)
+			return []user.GetResult{
+				{ID: refs.IDs[0]},
+				{ID: refs.IDs[1], Found: true, User: usr},
+			}, nil
+		}
+
+		result, err := client.BatchGetUsers(context.Background(), &request)
+		require.NoError(t, err)
+		require.Len(t, result.Results, 2)
+		require.Equal(t, request.Ids[0], result.Results[0].Id)
+		require.False(t, result.Results[0].Found)
+		require.Nil(t, result.Results[0].User)
+		require.Equal(t, usr.ID, result.Results[1].Id)
+		require.True(t, result.Results[1].Found)
+		compareSanitizedUserToPBUser(t, usr, result.Results[1].User)
+	})
+}
+
+func TestCorrectErrorCodesSentBatchGettingUsers(t *testing.T) {
+	cases := []struct {
+		name         string
+		result       error
+		expectedCode codes.Code
+	}{
+		{
+			name:         "Invalid",
+			result:       user.ErrInvalid,
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "Internal",
+			result:       errors.New("some unexpected error"),
+			expectedCode: codes.Internal,
+		},
+	}
+	for _, testCase := range cases {
+		t.Run(testCase.name, func(t *testing.T) {
+			stubService := newStubService()
+			request := userspb.Refs{Ids: []string{fakeUserRef().Id}}
+			withClient(stubService, func(client userspb.UsersClient) {
+				stubService.batchGet = func(context.Context, *user.Refs) ([]user.GetResult, error) {
+					return nil, testCase.result
+				}
+
+				_, err := client.BatchGetUsers(context.Background(), &request)
+				require.Equal(t, testCase.expectedCode.String(), status.Code(err).String())
+			})
+		})
+	}
+}
+
+func TestFindUsersRPCCallsServiceAndRespondsWithCorrectValues(t *testing.T) {
+	stubService := newStubService()
+	request := fakeUsersQuery()
+	var response user.Page
+	withClient(stubService, func(client userspb.UsersClient) {
+		// check that the request payload has been conveyed correctly to the users service
+		stubService.find = func(ctx context.Context, query *user.Query) (user.Page, error) {
+			require.Equal(t, request.CreatedAfter, query.CreatedAfter)
+			require.Equal(t, request.Country, query.Country)
+			require.Equal(t, request.Page, query.Page)
+			require.Equal(t, request.Length, query.Length)
+			require.Equal(t, request.SortBy, query.SortBy)
+			require.Equal(t, user.SortDescending, query.SortDirection)
+			require.Equal(t, request.Status, query.Status)
+			require.Equal(t, request.Search, query.Search)
+			require.Equal(t, request.InactiveSince, query.InactiveSince)
+			require.Equal(t, request.Countries, query.Countries)
+			require.Equal(t, request.CreatedBefore, query.CreatedBefore)
+			require.Equal(t, request.SkipTotal, query.SkipTotal)
+
+			response = usersPageFromQuery(*query)
+			return response, nil
+		}
+
+		// check that the Page has been correctly conveyed by the RPC
+		page, err := client.FindUsers(context.Background(), &request)
+		require.NoError(t, err)
+		require.Len(t, page.Items, len(response.Items))
+		require.Equal(t, page.Total, response.Total)
+		require.Equal(t, response.HasNext, page.HasNext)
+		require.Equal(t, response.TotalPages, page.TotalPages)
+		for i, itm := range page.Items {
+			compareSanitizedUserToPBUser(t, response.Items[i], itm)
+		}
+	})
+}
+
+func TestCorrectErrorCodeSentFindingUsers(t *testing.T) {
+	// For the sake of brevity, I am only going to use grpc error codes when the service fails.
+	// In a real world implementation I would, where appropriate, include detail via status details
+	stubService := newStubService()
+	request := fakeUsersQuery()
+	withClient(stubService, func(client userspb.UsersClient) {
+		stubService.find = func(ctx context.Context, _ *user.Query) (page user.Page, err error) {
+			return page, errors.New("some unexpected error")
+		}
+
+		_, err := client.FindUsers(context.Background(), &request)
+		require.Equal(t, codes.Internal.String(), status.Code(err).String())
+	})
+}
+
+func TestInvalidSortSentFindingUsers(t *testing.T) {
+	stubService := newStubService()
+	request := fakeUsersQuery()
+	withClient(stubService, func(client userspb.UsersClient) {
+		stubService.find = func(ctx context.Context, _ *user.Query) (page user.Page, err error) {
+			return page, &user.InvalidError{Violations: []user.FieldViolation{
+				{Field: "SortBy", Description: "must be one of created_at, updated_at, last_name, nickname"},
+			}}
+		}
+
+		_, err := client.FindUsers(context.Background(), &request)
+		st := status.Convert(err)
+		require.Equal(t, codes.InvalidArgument.String(), st.Code().String())
+		badRequest, ok := st.Details()[0].(*errdetails.BadRequest)
+		require.True(t, ok)
+		require.Equal(t, "sort_by", badRequest.FieldViolations[0].Field)
+	})
+}
+
+func TestExportUsersRPCStreamsEveryUser(t *testing.T) {
+	stubService := newStubService()
+	request := fakeUsersQuery()
+	users := []user.SanitizedUser{fakeSanitizedUser(), fakeSanitizedUser(), fakeSanitizedUser()}
+	withClient(stubService, func(client userspb.UsersClient) {
+		stubService.export = func(ctx context.Context, query *user.Query, send func(*user.SanitizedUser) error) error {
+			require.Equal(t, request.Country, query.Country)
+			for i := range users {
+				if err := send(&users[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		stream, err := client.ExportUsers(context.Background(), &request)
+		require.NoError(t, err)
+		for _, expected := range users {
+			usr, err := stream.Recv()
+			require.NoError(t, err)
+			compareSanitizedUserToPBUser(t, expected, usr)
+		}
+		_, err = stream.Recv()
+		require.ErrorIs(t, err, io.EOF)
+	})
+}
+
+func TestCorrectErrorCodesSentExportingUsers(t *testing.T) {
+	cases := []struct {
+		name         string
+		result       error
+		expectedCode codes.Code
+	}{
+		{
+			name:         "Invalid",
+			result:       user.ErrInvalid,
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name:         "Internal",
+			result:       errors.New("some unexpected error"),
+			expectedCode: codes.Internal,
+		},
+	}
+	for _, testCase := range cases {
+		t.Run(testCase.name, func(t *testing.T) {
+			stubService := newStubService()
+			request := fakeUsersQuery()
+			withClient(stubService, func(client userspb.UsersClient) {
+				stubService.export = func(context.Context, *user.Query, func(*user.SanitizedUser) error) error {
+					return testCase.result
+				}
+
+				stream, err := client.ExportUsers(context.Background(), &request)
+				require.NoError(t, err)
+				_, err = stream.Recv()
+				require.Equal(t, testCase.expectedCode.String(), status.Code(err).String())
+			})
+		})
+	}
+}
+
+func TestCountUsersRPCCallsServiceAndRespondsWithTotal(t *testing.T) {
+	stubService := newStubService()
+	request := fakeUsersQuery()
+	withClient(stubService, func(client userspb.UsersClient) {
+		stubService.count = func(ctx context.Context, query *user.Query) (int64, error) {
+			require.Equal(t, request.CreatedAfter, query.CreatedAfter)
+			require.Equal(t, request.Country, query.Country)
+			return 42, nil
+		}
+		count, err := client.CountUsers(context.Background(), &request)
+		require.NoError(t, err)
+		require.Equal(t, int64(42), count.Total)
+	})
+}
+
+func TestCorrectErrorCodeSentCountingUsers(t *testing.T) {
+	stubService := newStubService()
+	request := fakeUsersQuery()
+	withClient(stubService, func(client userspb.UsersClient) {
+		stubService.count = func(context.Context, *user.Query) (int64, error) {
+			return 0, errors.New("some unexpected error")
+		}
+		_, err := client.CountUsers(context.Background(), &request)
+		require.Equal(t, codes.Internal.String(), status.Code(err).String())
+	})
+}
+
+func TestGetUserStatsRPCCallsServiceAndRespondsWithStats(t *testing.T) {
+	stubService := newStubService()
+	request := &userspb.StatsQuery{
+		CreatedAfter:  "2022-04-01T00:00:00Z",
+		CreatedBefore: "2022-05-01T00:00:00Z",
+		Country:       "DE",
+		Countries:     []string{"NL"},
+		Status:        user.StatusActive,
+		Interval:      "week",
+	}
+	withClient(stubService, func(client userspb.UsersClient) {
+		stubService.stats = func(ctx context.Context, query *user.StatsQuery) (user.Stats, error) {
+			require.Equal(t, &user.StatsQuery{
+				CreatedAfter:  request.CreatedAfter,
+				CreatedBefore: request.CreatedBefore,
+				Country:       request.Country,
+				Countries:     request.Countries,
+				Status:        request.Status,
+				Interval:      request.Interval,
+			}, query)
+			return user.Stats{
+				Total:     3,
+				Countries: []user.CountryCount{{Country: "DE", Total: 1}, {Country: "NL", Total: 2}},
+				Signups:   []user.SignupCount{{Start: "2022-04-04T00:00:00Z", Total: 3}},
+			}, nil
+		}
+		stats, err := client.GetUserStats(context.Background(), request)
+		require.NoError(t, err)
+		require.Equal(t, int64(3), stats.Total)
+		require.Len(t, stats.Countries, 2)
+		require.Equal(t, "NL", stats.Countries[1].Country)
+		require.Equal(t, int64(2), stats.Countries[1].Total)
+		require.Len(t, stats.Signups, 1)
+		require.Equal(t, "2022-04-04T00:00:00Z", stats.Signups[0].Start)
+		require.Equal(t, int64(3), stats.Signups[0].Total)
+	})
+}
+
+func TestCorrectErrorCodeSentGettingUserStats(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		code codes.Code
+	}{
+		{name: "Invalid", err: user.ErrInvalid, code: codes.InvalidArgument},
+		{name: "Other", err: errors.New("some unexpected error"), code: codes.Internal},
+	}
+	for _, c := range cases {
+		thisCase := c
+		t.Run(thisCase.name, func(t *testing.T) {
+			stubService := newStubService()
+			withClient(stubService, func(client userspb.UsersClient) {
+				stubService.stats = func(context.Context, *user.StatsQuery) (user.Stats, error) {
+					return user.Stats{}, thisCase.err
+				}
+				_, err := client.GetUserStats(context.Background(), &userspb.StatsQuery{})
+				require.Equal(t, thisCase.code.String(), status.Code(err).String())
+			})
+		})
+	}
+}
+
+func TestGetUserRPCCallsServiceAndRespondsWithUser(t *testing.T) {
+	usr := fakeSanitizedUser()
+	stubService := newStubService()
+	withClient(stubService, func(client userspb.UsersClient) {
+		stubService.get = func(ctx context.Context, ref *user.Ref) (user.SanitizedUser, error) {
+			require.Equal(t, usr.ID, ref.ID)
+			return usr, nil
+		}
+		found, err := client.GetUser(context.Background(), &userspb.Ref{Id: usr.ID})
+		require.NoError(t, err)
+		compareSanitizedUserToPBUser(t, usr, found)
+	})
+}
+
+func TestCorrectErrorCodeSentGettingUser(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		code codes.Code
+	}{
+		{name: "invalid", err: user.ErrInvalid, code: codes.InvalidArgument},
+		{name: "not found", err: user.ErrNotFound, code: codes.NotFound},
+		{name: "unexpected", err: errors.New("some unexpected error"), code: codes.Internal},
+	}
+	for _, testCase := range cases {
+		t.Run(testCase.name, func(t *testing.T) {
+			stubService := newStubService()
+			request := fakeUserRef()
+			withClient(stubService, func(client userspb.UsersClient) {
+				stubService.get = func(context.Context, *user.Ref) (usr user.SanitizedUser, err error) {
+					return usr, testCase.err
+				}
+				_, err := client.GetUser(context.Background(), &request)
+				require.Equal(t, testCase.code.String(), status.Code(err).String())
+			})
+		})
+	}
+}
+
+func TestLookupUserRPCCallsServiceAndRespondsWithUser(t *testing.T) {
+	usr := fakeSanitizedUser()
+	cases := []struct {
+		name     string
+		request  *userspb.Lookup
+		expected user.Lookup
+	}{
+		{
+			name:     "email",
+			request:  &userspb.Lookup{Key: &userspb.Lookup_Email{Email: usr.Email}},
+			expected: user.Lookup{Email: usr.Email},
+		},
+		{
+			name:     "nickname",
+			request:  &userspb.Lookup{Key: &userspb.Lookup_Nickname{Nickname: usr.Nickname}},
+			expected: user.Lookup{Nickname: usr.Nickname},
+		},
+	}
+	for _, testCase := range cases {
+		t.Run(testCase.name, func(t *testing.T) {
+			stubService := newStubService()
+			withClient(stubService, func(client userspb.UsersClient) {
+				stubService.lookup = func(ctx context.Context, lookup *user.Lookup) (user.SanitizedUser, error) {
+					require.Equal(t, testCase.expected, *lookup)
+					return usr, nil
+				}
+				found, err := client.LookupUser(context.Background(), testCase.request)
+				require.NoError(t, err)
+				compareSanitizedUserToPBUser(t, usr, found)
+			})
+		})
+	}
+}
+
+func TestCorrectErrorCodeSentLookingUpUser(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		code codes.Code
+	}{
+		{name: "invalid", err: user.ErrInvalid, code: codes.InvalidArgument},
+		{name: "not found", err: user.ErrNotFound, code: codes.NotFound},
+		{name: "unexpected", err: errors.New("some unexpected error"), code: codes.Internal},
+	}
+	for _, testCase := range cases {
+		t.Run(testCase.name, func(t *testing.T) {
+			stubService := newStubService()
+			withClient(stubService, func(client userspb.UsersClient) {
+				stubService.lookup = func(context.Context, *user.Lookup) (usr user.SanitizedUser, err error) {
+					return usr, testCase.err
+				}
+				_, err := client.LookupUser(context.Background(), &userspb.Lookup{})
+				require.Equal(t, testCase.code.String(), status.Code(err).String())
+			})
+		})
+	}
+}
+
+func TestCheckAvailabilityRPCCallsServiceAndRespondsWithAvailability(t *testing.T) {
+	stubService := newStubService()
+	request := userspb.AvailabilityCheck{Nickname: "maxmust", Email: "maxmust@example.com"}
+	withClient(stubService, func(client userspb.UsersClient) {
+		stubService.checkAvailability = func(_ context.Context, check *user.AvailabilityCheck) (user.Availability, error) {
+			require.Equal(t, request.Nickname, check.Nickname)
+			require.Equal(t, request.Email, check.Email)
+			return user.Availability{NicknameAvailable: true}, nil
+		}
+		availability, err := client.CheckAvailability(context.Background(), &request)
+		require.NoError(t, err)
+		require.True(t, availability.NicknameAvailable)
+		require.False(t, availability.EmailAvailable)
+	})
+}
+
+func TestCorrectErrorCodeSentCheckingAvailability(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		code codes.Code
+	}{
+		{name: "invalid", err: user.ErrInvalid, code: codes.InvalidArgument},
+		{name: "unexpected", err: errors.New("some unexpected error"), code: codes.Internal},
+	}
+	for _, testCase := range cases {
+		t.Run(testCase.name, func(t *testing.T) {
+			stubService := newStubService()
+			withClient(stubService, func(client userspb.UsersClient) {
+				stubService.checkAvailability = func(context.Context, *user.AvailabilityCheck) (availability user.Availability, err error) {
+					return availability, testCase.err
+				}
+				_, err := client.CheckAvailability(context.Background(), &userspb.AvailabilityCheck{})
+				require.Equal(t, testCase.code.String(), status.Code(err).String())
+			})
+		})
+	}
+}
+
+func TestChangePasswordRPCCallsServiceAndRespondsWithUser(t *testing.T) {
+	stubService := newStubService()
+	request := userspb.PasswordChange{
+		Id:              uuid.Must(uuid.NewRandom()).String(),
+		CurrentPassword: "password123",
+		Password:        "newpassword123",
+		ConfirmPassword: "newpassword123",
+		Version:         3,
+	}
+	var response user.User
+	withClient(stubService, func(client userspb.UsersClient) {
+		stubService.changePassword = func(ctx context.Context, change *user.PasswordChange) (user.User, error) {
+			require.Equal(t, request.Id, change.ID)
+			require.Equal(t, request.CurrentPassword, change.CurrentPassword)
+			require.Equal(t, request.Password, change.Password)
+			require.Equal(t, request.ConfirmPassword, change.ConfirmPassword)
+			require.Equal(t, request.Version, change.Version)
+			response = userFromNewUser(user.NewUser{FirstName: "Max", LastName: "Mustermann", Country: "DE"})
+			return response, nil
+		}
+		usr, err := client.ChangePassword(context.Background(), &request)
+		require.NoError(t, err)
+		compareUserToPBUser(t, response, usr)
+	})
+}
+
+func TestCorrectErrorCodeSentChangingPassword(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		code codes.Code
+	}{
+		{name: "invalid", err: user.ErrInvalid, code: codes.InvalidArgument},
+		{name: "not found", err: user.ErrNotFound, code: codes.NotFound},
+		{name: "invalid version", err: user.ErrInvalidVersion, code: codes.FailedPrecondition},
+		{name: "wrong current password", err: user.ErrInvalidCredentials, code: codes.Unauthenticated},
+		{name: "unexpected", err: errors.New("some unexpected error"), code: codes.Internal},
+	}
+	for _, testCase := range cases {
+		t.Run(testCase.name, func(t *testing.T) {
+			stubService := newStubService()
+			withClient(stubService, func(client userspb.UsersClient) {
+				stubService.changePassword = func(context.Context, *user.PasswordChange) (usr user.User, err error) {
+					return usr, testCase.err
+				}
+				_, err := client.ChangePassword(context.Background(), &userspb.PasswordChange{})
+				require.Equal(t, testCase.code.String(), status.Code(err).String())
+			})
+		})
+	}
+}
+
+func TestChangeEmailRPCCallsService(t *testing.T) {
+	stubService := newStubService()
+	request := userspb.EmailChange{
+		Id:              uuid.Must(uuid.NewRandom()).String(),
+		Email:           "new@example.com",
+		CurrentPassword: "password123",
+		Version:         3,
+	}
+	called := false
+	withClient(stubService, func(client userspb.UsersClient) {
+		stubService.changeEmail = func(_ context.Context, change *user.EmailChange) error {
+			called = true
+			require.Equal(t, request.Id, change.ID)
+			require.Equal(t, request.Email, change.Email)
+			require.Equal(t, request.CurrentPassword, change.CurrentPassword)
+			require.Equal(t, request.Version, change.Version)
+			return nil
+		}
+		_, err := client.ChangeEmail(context.Background(), &request)
+		require.NoError(t, err)
+		require.True(t, called)
+	})
+}
+
+func TestCorrectErrorCodeSentChangingEmail(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		code codes.Code
+	}{
+		{name: "invalid", err: user.ErrInvalid, code: codes.InvalidArgument},
+		{name: "not found", err: user.ErrNotFound, code: codes.NotFound},
+		{name: "invalid version", err: user.ErrInvalidVersion, code: codes.FailedPrecondition},
+		{name: "wrong current password", err: user.ErrInvalidCredentials, code: codes.Unauthenticated},
+		{name: "address taken", err: user.ErrAlreadyExists, code: codes.AlreadyExists},
+		{name: "unexpected", err: errors.New("some unexpected error"), code: codes.Internal},
+	}
+	for _, testCase := range cases {
+		t.Run(testCase.name, func(t *testing.T) {
+			stubService := newStubService()
+			withClient(stubService, func(client userspb.UsersClient) {
+				stubService.changeEmail = func(context.Context, *user.EmailChange) error {
+					return testCase.err
+				}
+				_, err := client.ChangeEmail(context.Background(), &userspb.EmailChange{})
+				require.Equal(t, testCase.code.String(), status.Code(err).String())
+			})
+		})
+	}
+}
+
+func TestConfirmEmailChangeRPCCallsServiceAndRespondsWithUser(t *testing.T) {
+	stubService := newStubService()
+	var response user.User
+	withClient(stubService, func(client userspb.UsersClient) {
+		stubService.confirmEmailChange = func(_ context.Context, confirmation *user.EmailConfirmation) (user.User, error) {
+			require.Equal(t, "token", confirmation.Token)
+			response = userFromNewUser(user.NewUser{FirstName: "Max", LastName: "Mustermann", Email: "new@example.com", Country: "DE"})
+			return response, nil
+		}
+		usr, err := client.ConfirmEmailChange(context.Background(), &userspb.EmailConfirmation{Token: "token"})
+		require.NoError(t, err)
+		compareUserToPBUser(t, response, usr)
+	})
+}
+
+func TestCorrectErrorCodeSentConfirmingEmailChange(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		code codes.Code
+	}{
+		{name: "invalid", err: user.ErrInvalid, code: codes.InvalidArgument},
+		{name: "invalid token", err: user.ErrInvalidEmailChangeToken, code: codes.Unauthenticated},
+		{name: "address taken", err: user.ErrAlreadyExists, code: codes.AlreadyExists},
+		{name: "unexpected", err: errors.New("some unexpected error"), code: codes.Internal},
+	}
+	for _, testCase := range cases {
+		t.Run(testCase.name, func(t *testing.T) {
+			stubService := newStubService()
+			withClient(stubService, func(client userspb.UsersClient) {
+				stubService.confirmEmailChange = func(context.Context, *user.EmailConfirmation) (usr user.User, err error) {
+					return usr, testCase.err
+				}
+				_, err := client.ConfirmEmailChange(context.Background(), &userspb.EmailConfirmation{})
+				require.Equal(t, testCase.code.String(), status.Code(err).String())
+			})
+		})
+	}
+}
+
+func TestChangeNicknameRPCCallsServiceAndRespondsWithUser(t *testing.T) {
+	stubService := newStubService()
+	request := userspb.NicknameChange{
+		Id:       uuid.Must(uuid.NewRandom()).String(),
+		Nickname: "renamed",
+		Version:  3,
+	}
+	var response user.User
+	withClient(stubService, func(client userspb.UsersClient) {
+		stubService.changeNickname = func(_ context.Context, change *user.NicknameChange) (user.User, error) {
+			require.Equal(t, request.Id, change.ID)
+			require.Equal(t, request.Nickname, change.Nickname)
+			require.Equal(t, request.Version, change.Version)
+			response = userFromNewUser(user.NewUser{FirstName: "Max", LastName: "Mustermann", Nickname: "renamed", Country: "DE"})
+			return response, nil
+		}
+		usr, err := client.ChangeNickname(context.Background(), &request)
+		require.NoError(t, err)
+		compareUserToPBUser(t, response, usr)
+	})
+}
+
+func TestCorrectErrorCodeSentChangingNickname(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		code codes.Code
+	}{
+		{name: "invalid", err: user.ErrInvalid, code: codes.InvalidArgument},
+		{name: "not found", err: user.ErrNotFound, code: codes.NotFound},
+		{name: "invalid version", err: user.ErrInvalidVersion, code: codes.FailedPrecondition},
+		{name: "too soon", err: user.ErrNicknameChangeTooSoon, code: codes.FailedPrecondition},
+		{name: "nickname taken", err: user.ErrNicknameInUse, code: codes.AlreadyExists},
+		{name: "unexpected", err: errors.New("some unexpected error"), code: codes.Internal},
+	}
+	for _, testCase := range cases {
+		t.Run(testCase.name, func(t *testing.T) {
+			stubService := newStubService()
+			withClient(stubService, func(client userspb.UsersClient) {
+				stubService.changeNickname = func(context.Context, *user.NicknameChange) (usr user.User, err error) {
+					return usr, testCase.err
+				}
+				_, err := client.ChangeNickname(context.Background(), &userspb.NicknameChange{})
+				require.Equal(t, testCase.code.String(), status.Code(err).String())
+			})
+		})
+	}
+}
+
+func TestNicknameChangeTooSoonHasReason(t *testing.T) {
+	stubService := newStubService()
+	withClient(stubService, func(client userspb.UsersClient) {
+		stubService.changeNickname = func(context.Context, *user.NicknameChange) (usr user.User, err error) {
+			return usr, user.ErrNicknameChangeTooSoon
+		}
+		_, err := client.ChangeNickname(context.Background(), &userspb.NicknameChange{})
+		st := status.Convert(err)
+		require.Equal(t, codes.FailedPrecondition, st.Code())
+		require.Len(t, st.Details(), 1)
+		info, ok := st.Details()[0].(*errdetails.ErrorInfo)
+		require.True(t, ok)
+		require.Equal(t, rpc.ReasonNicknameChangeTooSoon, info.Reason)
+		require.Equal(t, rpc.ErrorDomain, info.Domain)
+	})
+}
+
+func TestAuthenticateRPCCallsServiceAndRespondsWithUser(t *testing.T) {
+	stubService := newStubService()
+	usr := fakeSanitizedUser()
+	withClient(stubService, func(client userspb.UsersClient) {
+		stubService.auth = func(ctx context.Context, email, password, code string) (user.SanitizedUser, error) {
+			require.Equal(t, usr.Email, email)
+			require.Equal(t, "password123", password)
+			require.Equal(t, "123456", code)
+			return usr, nil
+		}
+		result, err := client.Authenticate(context.Background(), &userspb.Credentials{Email: usr.Email, Password: "password123", Code: "123456"})
+		require.NoError(t, err)
+		compareSanitizedUserToPBUser(t, usr, result.User)
+	})
+}
+
+func TestCorrectErrorCodeSentAuthenticating(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		code codes.Code
+	}{
+		{name: "invalid credentials", err: user.ErrInvalidCredentials, code: codes.Unauthenticated},
+		{name: "two factor required", err: user.ErrTwoFactorRequired, code: codes.Unauthenticated},
+		{name: "invalid two factor code", err: user.ErrInvalidTwoFactorCode, code: codes.Unauthenticated},
+		{name: "unexpected", err: errors.New("some unexpected error"), code: codes.Internal},
+	}
+	for _, testCase := range cases {
+		t.Run(testCase.name, func(t *testing.T) {
+			stubService := newStubService()
+			withClient(stubService, func(client userspb.UsersClient) {
+				stubService.auth = func(context.Context, string, string, string) (usr user.SanitizedUser, err error) {
+					return usr, testCase.err
+				}
+				_, err := client.Authenticate(context.Background(), &userspb.Credentials{Email: "max@example.com", Password: "password123"})
+				require.Equal(t, testCase.code.String(), status.Code(err).String())
+			})
+		})
+	}
+}
+
+func TestTwoFactorRequiredAuthenticatingHasReason(t *testing.T) {
+	stubService := newStubService()
+	withClient(stubService, func(client userspb.UsersClient) {
+		stubService.auth = func(context.Context, string, string, string) (usr user.SanitizedUser, err error) {
+			return usr, user.ErrTwoFactorRequired
+		}
+		_, err := client.Authenticate(context.Background(), &userspb.Credentials{Email: "max@example.com", Password: "password123"})
+		st := status.Convert(err)
+		require.Equal(t, codes.Unauthenticated, st.Code())
+		require.Len(t, st.Details(), 1)
+		info, ok := st.Details()[0].(*errdetails.ErrorInfo)
+		require.True(t, ok)
+		require.Equal(t, rpc.ReasonTwoFactorRequired, info.Reason)
+		require.Equal(t, rpc.ErrorDomain, info.Domain)
+	})
+}
+
+func TestEnrollTwoFactorRPCCallsServiceAndRespondsWithEnrollment(t *testing.T) {
+	stubService := newStubService()
+	request := fakeUserRef()
+	withClient(stubService, func(client userspb.UsersClient) {
+		stubService.enrollTwoFactor = func(_ context.Context, ref *user.Ref) (user.TwoFactorEnrollment, error) {
+			require.Equal(t, request.Id, ref.ID)
+			return user.TwoFactorEnrollment{Secret: "SECRET", URI: "otpauth://totp/users:max?secret=SECRET"}, nil
+		}
+		enrollment, err := client.EnrollTwoFactor(context.Background(), &request)
+		require.NoError(t, err)
+		require.Equal(t, "SECRET", enrollment.Secret)
+		require.Equal(t, "otpauth://totp/users:max?secret=SECRET", enrollment.Uri)
+	})
+}
+
+func TestConfirmTwoFactorRPCCallsServiceAndRespondsWithRecoveryCodes(t *testing.T) {
+	stubService := newStubService()
+	id := uuid.Must(uuid.NewRandom()).String()
+	withClient(stubService, func(client userspb.UsersClient) {
+		stubService.confirmTwoFactor = func(_ context.Context, code *user.TwoFactorCode) ([]string, error) {
+			require.Equal(t, id, code.ID)
+			require.Equal(t, "123456", code.Code)
+			return []string{"abcd-efgh", "ijkl-mnop"}, nil
+		}
+		result, err := client.ConfirmTwoFactor(context.Background(), &userspb.TwoFactorCode{Id: id, Code: "123456"})
+		require.NoError(t, err)
+		require.Equal(t, []string{"abcd-efgh", "ijkl-mnop"}, result.Codes)
+	})
+}
+
+func TestDisableTwoFactorRPCCallsServiceAndRespondsWithUser(t *testing.T) {
+	stubService := newStubService()
+	id := uuid.Must(uuid.NewRandom()).String()
+	var response user.User
+	withClient(stubService, func(client userspb.UsersClient) {
+		stubService.disableTwoFactor = func(_ context.Context, code *user.TwoFactorCode) (user.User, error) {
+			require.Equal(t, id, code.ID)
+			require.Equal(t, "123456", code.Code)
+			response = userFromNewUser(user.NewUser{FirstName: "Max", LastName: "Mustermann", Email: "max@example.com", Country: "DE"})
+			return response, nil
+		}
+		usr, err := client.DisableTwoFactor(context.Background(), &userspb.TwoFactorCode{Id: id, Code: "123456"})
+		require.NoError(t, err)
+		compareUserToPBUser(t, response, usr)
+		require.False(t, usr.TwoFactorEnabled)
+	})
+}
+
+func TestCorrectErrorCodeSentManagingTwoFactor(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		code codes.Code
+	}{
+		{name: "not found", err: user.ErrNotFound, code: codes.NotFound},
+		{name: "invalid", err: user.ErrInvalid, code: codes.InvalidArgument},
+		{name: "invalid code", err: user.ErrInvalidTwoFactorCode, code: codes.Unauthenticated},
+		{name: "unavailable", err: user.ErrTwoFactorUnavailable, code: codes.FailedPrecondition},
+		{name: "already enabled", err: user.ErrTwoFactorEnabled, code: codes.FailedPrecondition},
+		{name: "not enabled", err: user.ErrTwoFactorNotEnabled, code: codes.FailedPrecondition},
+		{name: "not enrolled", err: user.ErrTwoFactorNotEnrolled, code: codes.FailedPrecondition},
+		{name: "invalid version", err: user.ErrInvalidVersion, code: codes.FailedPrecondition},
+		{name: "unexpected", err: errors.New("some unexpected error"), code: codes.Internal},
+	}
+	for _, testCase := range cases {
+		t.Run(testCase.name, func(t *testing.T) {
+			stubService := newStubService()
+			request := fakeUserRef()
+			withClient(stubService, func(client userspb.UsersClient) {
+				stubService.enrollTwoFactor = func(context.Context, *user.Ref) (enrollment user.TwoFactorEnrollment, err error) {
+					return enrollment, testCase.err
+				}
+				stubService.confirmTwoFactor = func(context.Context, *user.TwoFactorCode) ([]string, error) {
+					return nil, testCase.err
+				}
+				stubService.disableTwoFactor = func(context.Context, *user.TwoFactorCode) (usr user.User, err error) {
+					return usr, testCase.err
+				}
+				code := &userspb.TwoFactorCode{Id: request.Id, Code: "123456"}
+				_, err := client.EnrollTwoFactor(context.Background(), &request)
+				require.Equal(t, testCase.code.String(), status.Code(err).String())
+				_, err = client.ConfirmTwoFactor(context.Background(), code)
+				require.Equal(t, testCase.code.String(), status.Code(err).String())
+				_, err = client.DisableTwoFactor(context.Background(), code)
+				require.Equal(t, testCase.code.String(), status.Code(err).String())
+			})
+		})
+	}
+}
+
+func TestRequestPasswordResetRPCCallsService(t *testing.T) {
+	stubService := newStubService()
+	called := false
+	withClient(stubService, func(client userspb.UsersClient) {
+		stubService.requestPasswordReset = func(_ context.Context, email string) error {
+			called = true
+			require.Equal(t, "max@example.com", email)
+			return nil
+		}
+		_, err := client.RequestPasswordReset(context.Background(), &userspb.PasswordResetRequest{Email: "max@example.com"})
+		require.NoError(t, err)
+		require.True(t, called)
+	})
+}
+
+func TestResetPasswordRPCCallsServiceAndRespondsWithUser(t *testing.T) {
+	stubService := newStubService()
+	request := userspb.PasswordReset{
+		Token:           "token",
+		Password:        "newpassword123",
+		ConfirmPassword: "newpassword123",
+	}
+	var response user.User
+	withClient(stubService, func(client userspb.UsersClient) {
+		stubService.resetPassword = func(_ context.Context, reset *user.PasswordReset) (user.User, error) {
+			require.Equal(t, request.Token, reset.Token)
+			require.Equal(t, request.Password, reset.Password)
+			require.Equal(t, request.ConfirmPassword, reset.ConfirmPassword)
+			response = userFromNewUser(user.NewUser{FirstName: "Max", LastName: "Mustermann", Country: "DE"})
+			return response, nil
+		}
+		usr, err := client.ResetPassword(context.Background(), &request)
+		require.NoError(t, err)
+		compareUserToPBUser(t, response, usr)
+	})
+}
+
+func TestCorrectErrorCodeSentResettingPassword(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		code codes.Code
+	}{
+		{name: "invalid", err: user.ErrInvalid, code: codes.InvalidArgument},
+		{name: "invalid token", err: user.ErrInvalidResetToken, code: codes.Unauthenticated},
+		{name: "unexpected", err: errors.New("some unexpected error"), code: codes.Internal},
+	}
+	for _, testCase := range cases {
+		t.Run(testCase.name, func(t *testing.T) {
+			stubService := newStubService()
+			withClient(stubService, func(client userspb.UsersClient) {
+				stubService.resetPassword = func(context.Context, *user.PasswordReset) (usr user.User, err error) {
+					return usr, testCase.err
+				}
+				_, err := client.ResetPassword(context.Background(), &userspb.PasswordReset{})
+				require.Equal(t, testCase.code.String(), status.Code(err).String())
+			})
+		})
+	}
+}
+
+func TestWatchUsersRPCStreamsMatchingEvents(t *testing.T) {
+	stubService := newStubService()
+	created := fakeSanitizedUser()
+	events := []user.Event{
+		{ID: created.ID, Version: 1, Action: "Created", Data: &created},
+		{ID: created.ID, Version: 2, Action: "Updated", Data: &created},
+		{ID: created.ID, Version: math.MaxInt64, Action: "Deleted"},
+	}
+	withClient(stubService, func(client userspb.UsersClient) {
+		// send all of the events and then close the channel, as the service does when a watcher falls behind
+		stubService.watch = func(context.Context) <-chan user.Event {
+			out := make(chan user.Event, len(events))
+			for _, evt := range events {
+				out <- evt
+			}
+			close(out)
+			return out
+		}
+
+		stream, err := client.WatchUsers(context.Background(), &userspb.WatchRequest{Actions: []string{"Created", "Deleted"}})
+		require.NoError(t, err)
+
+		evt, err := stream.Recv()
+		require.NoError(t, err)
+		require.Equal(t, events[0].ID, evt.Id)
+		require.Equal(t, events[0].Action, evt.Action)
+		compareSanitizedUserToPBUser(t, created, evt.Data)
+
+		// the Updated event is filtered out
+		evt, err = stream.Recv()
+		require.NoError(t, err)
+		require.Equal(t, events[2].Action, evt.Action)
+		require.Equal(t, events[2].Version, evt.Version)
+		require.Nil(t, evt.Data)
+
+		_, err = stream.Recv()
+		require.Equal(t, codes.Unavailable.String(), status.Code(err).String())
+	})
+}
+
+func TestInvalidArgumentErrorsIncludeFieldViolations(t *testing.T) {
+	stubService := newStubService()
+	request := fakeNewUser()
+	withClient(stubService, func(client userspb.UsersClient) {
+		stubService.create = func(context.Context, *user.NewUser) (usr user.User, err error) {
+			return usr, &user.InvalidError{Violations: []user.FieldViolation{
+				{Field: "FirstName", Description: "is required"},
+				{Field: "ConfirmPassword", Description: "must match Password"},
+			}}
+		}
+
+		_, err := client.CreateUser(context.Background(), &request)
+		st := status.Convert(err)
+		require.Equal(t, codes.InvalidArgument.String(), st.Code().String())
+		require.Len(t, st.Details(), 1)
+		badRequest, ok := st.Details()[0].(*errdetails.BadRequest)
+		require.True(t, ok)
+		require.Len(t, badRequest.FieldViolations, 2)
+		require.Equal(t, "first_name", badRequest.FieldViolations[0].Field)
+		require.Equal(t, "is required", badRequest.FieldViolations[0].Description)
+		require.Equal(t, "confirmPassword", badRequest.FieldViolations[1].Field)
+	})
+}
+
+func TestInvalidArgumentErrorsIncludeTheRulesBroken(t *testing.T) {
+	stubService := newStubService()
+	request := fakeNewUser()
+	withClient(stubService, func(client userspb.UsersClient) {
+		stubService.create = func(context.Context, *user.NewUser) (usr user.User, err error) {
+			return usr, &user.InvalidError{Violations: []user.FieldViolation{
+				{Field: "FirstName", Rule: "required", Description: "is required"},
+				{Field: "Country", Rule: "allowed-country", Description: "is not a country users can be registered in"},
+			}}
+		}
+
+		_, err := client.CreateUser(context.Background(), &request)
+		st := status.Convert(err)
+		require.Equal(t, codes.InvalidArgument.String(), st.Code().String())
+		require.Len(t, st.Details(), 2)
+		info, ok := st.Details()[1].(*errdetails.ErrorInfo)
+		require.True(t, ok)
+		require.Equal(t, rpc.ReasonInvalidFields, info.Reason)
+		require.Equal(t, rpc.ErrorDomain, info.Domain)
+		require.Equal(t, map[string]string{"first_name": "required", "country": "allowed-country"}, info.Metadata)
+	})
+}
+
+func TestUpdateMaskIsConveyedAsFields(t *testing.T) {
+	stubService := newStubService()
+	request := fakeUserUpdate()
+	request.UpdateMask = &fieldmaskpb.FieldMask{Paths: []string{"first_name", "password", "confirmPassword", "email"}}
+	withClient(stubService, func(client userspb.UsersClient) {
+		stubService.update = func(ctx context.Context, userUpdate *user.Update) (user.User, error) {
+			require.Equal(t, []string{user.FieldFirstName, user.FieldPassword, "email"}, userUpdate.Fields)
+			return userFromUserUpdate(*userUpdate), nil
+		}
+		_, err := client.UpdateUser(context.Background(), &request)
+		require.NoError(t, err)
+	})
+}
+
+func TestAvatarURLIsConveyedWhenUpdatingUser(t *testing.T) {
+	stubService := newStubService()
+	request := fakeUserUpdate()
+	request.AvatarUrl = "https://images.example.com/avatars/1.png"
+	request.UpdateMask = &fieldmaskpb.FieldMask{Paths: []string{"avatar_url"}}
+	withClient(stubService, func(client userspb.UsersClient) {
+		stubService.update = func(ctx context.Context, userUpdate *user.Update) (user.User, error) {
+			require.Equal(t, []string{user.FieldAvatarURL}, userUpdate.Fields)
+			require.Equal(t, request.AvatarUrl, userUpdate.AvatarURL)
+			return userFromUserUpdate(*userUpdate), nil
+		}
+		usr, err := client.UpdateUser(context.Background(), &request)
+		require.NoError(t, err)
+		require.Equal(t, request.AvatarUrl, usr.AvatarUrl)
 	})
 }
@@ -0,0 +1,80 @@
+package rpc
+
+import (
+	"context"
+
+	"github.com/robotlovesyou/fitest/pkg/tenant"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// TenantKey is the metadata key used to send the identifier of the tenant a call is made for
+	TenantKey = "x-tenant-id"
+	// Error message sent when the tenant identifier is malformed
+	msgInvalidTenant = "The tenant identifier is invalid"
+	// Error message sent when the caller does not act for the tenant it sent
+	msgForeignTenant = "The caller cannot act for the tenant"
+)
+
+// tenantFromContext returns a context carrying the tenant the call in ctx is made for. Malformed tenants are rejected
+// with codes.InvalidArgument.
+// Calls by authenticated callers are made for the tenant of the caller identity, and are rejected with
+// codes.PermissionDenied if they send a different tenant. Calls which are not authenticated are made for the tenant
+// they send, or for tenant.Default if they do not send one
+func tenantFromContext(ctx context.Context) (context.Context, error) {
+	id, sent, err := sentTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	identity, ok := IdentityFromContext(ctx)
+	if !ok {
+		return tenant.With(ctx, id), nil
+	}
+	if sent && id != identity.Tenant {
+		return nil, status.Error(codes.PermissionDenied, msgForeignTenant)
+	}
+	return tenant.With(ctx, identity.Tenant), nil
+}
+
+// sentTenant returns the tenant sent in the incoming metadata of ctx, and whether one was sent
+func sentTenant(ctx context.Context) (string, bool, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return tenant.Default, false, nil
+	}
+	ids := md.Get(TenantKey)
+	if len(ids) == 0 {
+		return tenant.Default, false, nil
+	}
+	if len(ids) > 1 || !tenant.Valid(ids[0]) {
+		return "", false, status.Error(codes.InvalidArgument, msgInvalidTenant)
+	}
+	return ids[0], true, nil
+}
+
+// UnaryTenantInterceptor returns an interceptor which makes the tenant a call is made for available to the users
+// service through its context. It must follow the authentication interceptor, so that the tenant sent in the
+// x-tenant-id metadata of a call can be checked against the tenant of the caller
+func UnaryTenantInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := tenantFromContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamTenantInterceptor is the streaming equivalent of UnaryTenantInterceptor
+func StreamTenantInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := tenantFromContext(stream.Context())
+		if err != nil {
+			return err
+		}
+		return handler(srv, &contextStream{ServerStream: stream, ctx: ctx})
+	}
+}
@@ -0,0 +1,194 @@
+package rpc_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/robotlovesyou/fitest/pkg/rpc"
+	"github.com/robotlovesyou/fitest/pkg/tenant"
+	"github.com/robotlovesyou/fitest/pkg/user"
+	"github.com/robotlovesyou/fitest/userspb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func withTenant(ctx context.Context, id string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, rpc.TenantKey, id)
+}
+
+func tenantServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.UnaryInterceptor(rpc.UnaryTenantInterceptor()),
+		grpc.StreamInterceptor(rpc.StreamTenantInterceptor()),
+	}
+}
+
+// tokenForTenant creates a token which will be accepted with testJWTConfig, for a caller acting for id
+func tokenForTenant(t *testing.T, id string) string {
+	claims := rpc.Claims{RegisteredClaims: validClaims("caller"), Tenant: id}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(testJWTConfig.Key)
+	require.NoError(t, err)
+	return token
+}
+
+func authenticatedTenantServerOptions(t *testing.T) []grpc.ServerOption {
+	logger := nopLogger{}
+	keys, err := rpc.ParseStaticKeyStore("billing:billing-key,reporting:reporting-key")
+	require.NoError(t, err)
+	tenants, err := rpc.ParseTenantMap("billing=acme")
+	require.NoError(t, err)
+	auth := rpc.AnyOf(rpc.NewJWTAuthenticator(testJWTConfig), rpc.NewAPIKeyAuthenticator(keys, nil, tenants))
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(rpc.UnaryAuthInterceptor(auth, logger), rpc.UnaryTenantInterceptor()),
+		grpc.ChainStreamInterceptor(rpc.StreamAuthInterceptor(auth, logger), rpc.StreamTenantInterceptor()),
+	}
+}
+
+func TestTenantIsPassedToService(t *testing.T) {
+	cases := []struct {
+		name     string
+		ctx      context.Context
+		expected string
+	}{
+		{name: "Tenant", ctx: withTenant(context.Background(), "acme"), expected: "acme"},
+		{name: "No tenant", ctx: context.Background(), expected: tenant.Default},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			stubService := newStubService()
+			request := fakeUserRef()
+			withClient(stubService, func(client userspb.UsersClient) {
+				stubService.delete = func(ctx context.Context, _ *user.Ref) error {
+					require.Equal(t, c.expected, tenant.FromContext(ctx))
+					return nil
+				}
+				_, err := client.DeleteUser(c.ctx, &request)
+				require.NoError(t, err)
+			}, tenantServerOptions()...)
+		})
+	}
+}
+
+func TestTenantIsPassedToServiceForStreams(t *testing.T) {
+	stubService := newStubService()
+	withClient(stubService, func(client userspb.UsersClient) {
+		stubService.watch = func(ctx context.Context) <-chan user.Event {
+			require.Equal(t, "acme", tenant.FromContext(ctx))
+			out := make(chan user.Event)
+			close(out)
+			return out
+		}
+		stream, err := client.WatchUsers(withTenant(context.Background(), "acme"), &userspb.WatchRequest{})
+		require.NoError(t, err)
+		_, err = stream.Recv()
+		require.Equal(t, codes.Unavailable.String(), status.Code(err).String())
+	}, tenantServerOptions()...)
+}
+
+func TestCallsWithMalformedTenantsAreRejected(t *testing.T) {
+	stubService := newStubService()
+	request := fakeUserRef()
+	withClient(stubService, func(client userspb.UsersClient) {
+		_, err := client.DeleteUser(withTenant(context.Background(), "Not A Tenant"), &request)
+		require.Equal(t, codes.InvalidArgument.String(), status.Code(err).String())
+
+		ctx := withTenant(withTenant(context.Background(), "acme"), "other")
+		_, err = client.DeleteUser(ctx, &request)
+		require.Equal(t, codes.InvalidArgument.String(), status.Code(err).String())
+	}, tenantServerOptions()...)
+}
+
+func TestCannotParseMalformedTenantMap(t *testing.T) {
+	for _, config := range []string{"no separator", "=acme", "billing=", "billing=Not A Tenant"} {
+		_, err := rpc.ParseTenantMap(config)
+		require.Error(t, err, config)
+	}
+}
+
+func TestAuthenticatedCallersActForTheirTenant(t *testing.T) {
+	cases := []struct {
+		name     string
+		ctx      context.Context
+		expected string
+	}{
+		{name: "JWT", ctx: withBearerToken(context.Background(), tokenForTenant(t, "acme")), expected: "acme"},
+		{
+			name:     "JWT sending its tenant",
+			ctx:      withTenant(withBearerToken(context.Background(), tokenForTenant(t, "acme")), "acme"),
+			expected: "acme",
+		},
+		{name: "JWT without tenant claim", ctx: withBearerToken(context.Background(), tokenForTenant(t, "")), expected: tenant.Default},
+		{name: "API key", ctx: withAPIKey(context.Background(), "billing-key"), expected: "acme"},
+		{
+			name:     "API key sending its tenant",
+			ctx:      withTenant(withAPIKey(context.Background(), "billing-key"), "acme"),
+			expected: "acme",
+		},
+		{name: "Unlisted API key", ctx: withAPIKey(context.Background(), "reporting-key"), expected: tenant.Default},
+	}
+
+	for _, c := range cases {
+		thisCase := c
+		t.Run(thisCase.name, func(t *testing.T) {
+			stubService := newStubService()
+			request := fakeUserRef()
+			withClient(stubService, func(client userspb.UsersClient) {
+				stubService.delete = func(ctx context.Context, _ *user.Ref) error {
+					require.Equal(t, thisCase.expected, tenant.FromContext(ctx))
+					return nil
+				}
+				_, err := client.DeleteUser(thisCase.ctx, &request)
+				require.NoError(t, err)
+			}, authenticatedTenantServerOptions(t)...)
+		})
+	}
+}
+
+func TestCallsForAnotherTenantAreRejected(t *testing.T) {
+	cases := []struct {
+		name string
+		ctx  context.Context
+	}{
+		{name: "JWT", ctx: withTenant(withBearerToken(context.Background(), tokenForTenant(t, "acme")), "globex")},
+		{name: "JWT without tenant claim", ctx: withTenant(withBearerToken(context.Background(), tokenForTenant(t, "")), "globex")},
+		{name: "API key", ctx: withTenant(withAPIKey(context.Background(), "billing-key"), "globex")},
+		{name: "Unlisted API key", ctx: withTenant(withAPIKey(context.Background(), "reporting-key"), "acme")},
+	}
+
+	for _, c := range cases {
+		thisCase := c
+		t.Run(thisCase.name, func(t *testing.T) {
+			stubService := newStubService()
+			request := fakeUserRef()
+			withClient(stubService, func(client userspb.UsersClient) {
+				_, err := client.DeleteUser(thisCase.ctx, &request)
+				require.Equal(t, codes.PermissionDenied.String(), status.Code(err).String())
+			}, authenticatedTenantServerOptions(t)...)
+		})
+	}
+}
+
+func TestStreamsForAnotherTenantAreRejected(t *testing.T) {
+	stubService := newStubService()
+	withClient(stubService, func(client userspb.UsersClient) {
+		ctx := withTenant(withBearerToken(context.Background(), tokenForTenant(t, "acme")), "globex")
+		stream, err := client.WatchUsers(ctx, &userspb.WatchRequest{})
+		require.NoError(t, err)
+		_, err = stream.Recv()
+		require.Equal(t, codes.PermissionDenied.String(), status.Code(err).String())
+	}, authenticatedTenantServerOptions(t)...)
+}
+
+func TestTokensWithMalformedTenantsAreRejected(t *testing.T) {
+	stubService := newStubService()
+	request := fakeUserRef()
+	withClient(stubService, func(client userspb.UsersClient) {
+		_, err := client.DeleteUser(withBearerToken(context.Background(), tokenForTenant(t, "Not A Tenant")), &request)
+		require.Equal(t, codes.Unauthenticated.String(), status.Code(err).String())
+	}, authenticatedTenantServerOptions(t)...)
+}
@@ -0,0 +1,32 @@
+package rpc_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/robotlovesyou/fitest/pkg/telemetry"
+	"github.com/robotlovesyou/fitest/pkg/user"
+	"github.com/robotlovesyou/fitest/userspb"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const testTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+func TestTraceContextFromCallerIsPropagatedToService(t *testing.T) {
+	stubService := newStubService()
+	request := fakeUserRef()
+	withClient(stubService, func(client userspb.UsersClient) {
+		stubService.delete = func(ctx context.Context, _ *user.Ref) error {
+			require.Equal(t, testTraceID, trace.SpanContextFromContext(ctx).TraceID().String())
+			return nil
+		}
+
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "traceparent", "00-"+testTraceID+"-00f067aa0ba902b7-01")
+		_, err := client.DeleteUser(ctx, &request)
+		require.NoError(t, err)
+	}, grpc.UnaryInterceptor(otelgrpc.UnaryServerInterceptor(otelgrpc.WithPropagators(telemetry.Propagator()))))
+}
@@ -0,0 +1,667 @@
+package rpc
+
+import (
+	"context"
+	"time"
+
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/user"
+	"github.com/robotlovesyou/fitest/userspb"
+	userspbv2 "github.com/robotlovesyou/fitest/userspb/v2"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/runtime/protoiface"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// V2Server is an implementation of userspbv2.UsersServer.
+// It is a shim which converts each call into a call to an RPCServer and converts the result back, so that both
+// versions of the API share the same handling logic while clients migrate from version 1
+type V2Server struct {
+	userspbv2.UnimplementedUsersServer
+	v1 *RPCServer
+}
+
+// NewV2 creates a new V2Server which will delegate processing to its UsersService dependency
+func NewV2(service UsersService, logger Logger) *V2Server {
+	return &V2Server{v1: New(service, logger)}
+}
+
+// v1FieldNames maps the names of userspbv2 fields to the names of userspb fields, where they differ
+var v1FieldNames = map[string]string{
+	"confirm_password": "confirmPassword",
+}
+
+// v2FieldNames maps the names of userspb fields to the names of userspbv2 fields, where they differ
+var v2FieldNames = map[string]string{
+	"confirmPassword": "confirm_password",
+}
+
+var v1Actions = map[userspbv2.Action]string{
+	userspbv2.Action_ACTION_CREATED:             string(userstore.Created),
+	userspbv2.Action_ACTION_UPDATED:             string(userstore.Updated),
+	userspbv2.Action_ACTION_DELETED:             string(userstore.Deleted),
+	userspbv2.Action_ACTION_PASSWORD_CHANGED:    string(userstore.PasswordChanged),
+	userspbv2.Action_ACTION_EMAIL_CHANGED:       string(userstore.EmailChanged),
+	userspbv2.Action_ACTION_RESTORED:            string(userstore.Restored),
+	userspbv2.Action_ACTION_ANONYMIZED:          string(userstore.Anonymized),
+	userspbv2.Action_ACTION_SUSPENDED:           string(userstore.Suspended),
+	userspbv2.Action_ACTION_REACTIVATED:         string(userstore.Reactivated),
+	userspbv2.Action_ACTION_BANNED:              string(userstore.Banned),
+	userspbv2.Action_ACTION_TWO_FACTOR_ENABLED:  string(userstore.TwoFactorEnabled),
+	userspbv2.Action_ACTION_TWO_FACTOR_DISABLED: string(userstore.TwoFactorDisabled),
+	userspbv2.Action_ACTION_MARKED_DORMANT:      string(userstore.MarkedDormant),
+	userspbv2.Action_ACTION_REPLAYED:            string(userstore.Replayed),
+	userspbv2.Action_ACTION_NICKNAME_CHANGED:    string(userstore.NicknameChanged),
+}
+
+var v2Actions = map[string]userspbv2.Action{
+	string(userstore.Created):           userspbv2.Action_ACTION_CREATED,
+	string(userstore.Updated):           userspbv2.Action_ACTION_UPDATED,
+	string(userstore.Deleted):           userspbv2.Action_ACTION_DELETED,
+	string(userstore.PasswordChanged):   userspbv2.Action_ACTION_PASSWORD_CHANGED,
+	string(userstore.EmailChanged):      userspbv2.Action_ACTION_EMAIL_CHANGED,
+	string(userstore.Restored):          userspbv2.Action_ACTION_RESTORED,
+	string(userstore.Anonymized):        userspbv2.Action_ACTION_ANONYMIZED,
+	string(userstore.Suspended):         userspbv2.Action_ACTION_SUSPENDED,
+	string(userstore.Reactivated):       userspbv2.Action_ACTION_REACTIVATED,
+	string(userstore.Banned):            userspbv2.Action_ACTION_BANNED,
+	string(userstore.TwoFactorEnabled):  userspbv2.Action_ACTION_TWO_FACTOR_ENABLED,
+	string(userstore.TwoFactorDisabled): userspbv2.Action_ACTION_TWO_FACTOR_DISABLED,
+	string(userstore.MarkedDormant):     userspbv2.Action_ACTION_MARKED_DORMANT,
+	string(userstore.Replayed):          userspbv2.Action_ACTION_REPLAYED,
+	string(userstore.NicknameChanged):   userspbv2.Action_ACTION_NICKNAME_CHANGED,
+}
+
+var v1SortFields = map[userspbv2.SortField]string{
+	userspbv2.SortField_SORT_FIELD_CREATED_AT: string(userstore.SortCreatedAt),
+	userspbv2.SortField_SORT_FIELD_UPDATED_AT: string(userstore.SortUpdatedAt),
+	userspbv2.SortField_SORT_FIELD_LAST_NAME:  string(userstore.SortLastName),
+	userspbv2.SortField_SORT_FIELD_NICKNAME:   string(userstore.SortNickname),
+}
+
+var v1Statuses = map[userspbv2.UserStatus]string{
+	userspbv2.UserStatus_USER_STATUS_ACTIVE:    user.StatusActive,
+	userspbv2.UserStatus_USER_STATUS_SUSPENDED: user.StatusSuspended,
+	userspbv2.UserStatus_USER_STATUS_BANNED:    user.StatusBanned,
+	userspbv2.UserStatus_USER_STATUS_DORMANT:   user.StatusDormant,
+}
+
+var v2Statuses = map[string]userspbv2.UserStatus{
+	user.StatusActive:    userspbv2.UserStatus_USER_STATUS_ACTIVE,
+	user.StatusSuspended: userspbv2.UserStatus_USER_STATUS_SUSPENDED,
+	user.StatusBanned:    userspbv2.UserStatus_USER_STATUS_BANNED,
+	user.StatusDormant:   userspbv2.UserStatus_USER_STATUS_DORMANT,
+}
+
+// v2Timestamp converts a version 1 timestamp into a version 2 timestamp. Empty or invalid timestamps are converted
+// to nil
+func v2Timestamp(str string) *timestamppb.Timestamp {
+	t, err := time.Parse(user.TimeFormat, str)
+	if err != nil {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+// v1Timestamp converts a version 2 timestamp into a version 1 timestamp. A nil timestamp is converted to ""
+func v1Timestamp(ts *timestamppb.Timestamp) string {
+	if ts == nil {
+		return ""
+	}
+	return ts.AsTime().Format(user.TimeFormat)
+}
+
+func v2User(usr *userspb.User) *userspbv2.User {
+	if usr == nil {
+		return nil
+	}
+	return &userspbv2.User{
+		Id:               usr.Id,
+		FirstName:        usr.FirstName,
+		LastName:         usr.LastName,
+		Nickname:         usr.Nickname,
+		Email:            usr.Email,
+		Country:          usr.Country,
+		AvatarUrl:        usr.AvatarUrl,
+		CreatedAt:        v2Timestamp(usr.CreatedAt),
+		UpdatedAt:        v2Timestamp(usr.UpdatedAt),
+		Version:          usr.Version,
+		Status:           v2Statuses[usr.Status],
+		LastLoginAt:      v2Timestamp(usr.LastLoginAt),
+		LastSeenAt:       v2Timestamp(usr.LastSeenAt),
+		TwoFactorEnabled: usr.TwoFactorEnabled,
+	}
+}
+
+func v2UserEvent(evt *userspb.UserEvent) *userspbv2.UserEvent {
+	return &userspbv2.UserEvent{
+		Id:        evt.Id,
+		Version:   evt.Version,
+		Action:    v2Actions[evt.Action],
+		CreatedAt: v2Timestamp(evt.CreatedAt),
+		SentAt:    v2Timestamp(evt.SentAt),
+		Data:      v2User(evt.Data),
+	}
+}
+
+func v1UpdateMask(mask *fieldmaskpb.FieldMask) *fieldmaskpb.FieldMask {
+	if mask == nil {
+		return nil
+	}
+	paths := make([]string, 0, len(mask.Paths))
+	for _, path := range mask.Paths {
+		if name, ok := v1FieldNames[path]; ok {
+			path = name
+		}
+		paths = append(paths, path)
+	}
+	return &fieldmaskpb.FieldMask{Paths: paths}
+}
+
+// v2Error renames the fields in the google.rpc.BadRequest details, and the invalid fields in the google.rpc.ErrorInfo
+// details, of a version 1 status to their version 2 names
+func v2Error(err error) error {
+	st := status.Convert(err)
+	renamed := false
+	details := st.Details()
+	for _, detail := range details {
+		switch d := detail.(type) {
+		case *errdetails.BadRequest:
+			for _, violation := range d.FieldViolations {
+				if name, ok := v2FieldNames[violation.Field]; ok {
+					violation.Field = name
+					renamed = true
+				}
+			}
+		case *errdetails.ErrorInfo:
+			if d.Reason != ReasonInvalidFields {
+				continue
+			}
+			for field, rule := range d.Metadata {
+				if name, ok := v2FieldNames[field]; ok {
+					delete(d.Metadata, field)
+					d.Metadata[name] = rule
+					renamed = true
+				}
+			}
+		}
+	}
+	if !renamed {
+		return err
+	}
+	converted := status.New(st.Code(), st.Message())
+	for _, detail := range details {
+		var detailsErr error
+		if converted, detailsErr = converted.WithDetails(detail.(protoiface.MessageV1)); detailsErr != nil {
+			return err
+		}
+	}
+	return converted.Err()
+}
+
+// CreateUser implements the userspbv2.UsersServer.CreateUser function, allowing clients to create new users
+func (svr *V2Server) CreateUser(ctx context.Context, newUser *userspbv2.NewUser) (*userspbv2.User, error) {
+	usr, err := svr.v1.CreateUser(ctx, &userspb.NewUser{
+		FirstName:       newUser.FirstName,
+		LastName:        newUser.LastName,
+		Nickname:        newUser.Nickname,
+		Password:        newUser.Password,
+		ConfirmPassword: newUser.ConfirmPassword,
+		Email:           newUser.Email,
+		Country:         newUser.Country,
+	})
+	if err != nil {
+		return nil, v2Error(err)
+	}
+	return v2User(usr), nil
+}
+
+// UpdateUser implements the userspbv2.UsersServer.UpdateUser function, allowing clients to update existing users
+func (svr *V2Server) UpdateUser(ctx context.Context, userUpdate *userspbv2.Update) (*userspbv2.User, error) {
+	usr, err := svr.v1.UpdateUser(ctx, &userspb.Update{
+		Id:              userUpdate.Id,
+		FirstName:       userUpdate.FirstName,
+		LastName:        userUpdate.LastName,
+		Password:        userUpdate.Password,
+		ConfirmPassword: userUpdate.ConfirmPassword,
+		Country:         userUpdate.Country,
+		AvatarUrl:       userUpdate.AvatarUrl,
+		Version:         userUpdate.Version,
+		UpdateMask:      v1UpdateMask(userUpdate.UpdateMask),
+	})
+	if err != nil {
+		return nil, v2Error(err)
+	}
+	return v2User(usr), nil
+}
+
+// ChangePassword implements the userspbv2.UsersServer.ChangePassword function, allowing clients to change the
+// password of existing users
+func (svr *V2Server) ChangePassword(ctx context.Context, change *userspbv2.PasswordChange) (*userspbv2.User, error) {
+	usr, err := svr.v1.ChangePassword(ctx, &userspb.PasswordChange{
+		Id:              change.Id,
+		CurrentPassword: change.CurrentPassword,
+		Password:        change.Password,
+		ConfirmPassword: change.ConfirmPassword,
+		Version:         change.Version,
+	})
+	if err != nil {
+		return nil, v2Error(err)
+	}
+	return v2User(usr), nil
+}
+
+// ChangeEmail implements the userspbv2.UsersServer.ChangeEmail function, allowing clients to request a change to
+// the email address of existing users
+func (svr *V2Server) ChangeEmail(ctx context.Context, change *userspbv2.EmailChange) (*emptypb.Empty, error) {
+	empty, err := svr.v1.ChangeEmail(ctx, &userspb.EmailChange{
+		Id:              change.Id,
+		Email:           change.Email,
+		CurrentPassword: change.CurrentPassword,
+		Version:         change.Version,
+	})
+	if err != nil {
+		return nil, v2Error(err)
+	}
+	return empty, nil
+}
+
+// ConfirmEmailChange implements the userspbv2.UsersServer.ConfirmEmailChange function, allowing clients to confirm
+// a change of email address with the token sent to the new address
+func (svr *V2Server) ConfirmEmailChange(ctx context.Context, confirmation *userspbv2.EmailConfirmation) (*userspbv2.User, error) {
+	usr, err := svr.v1.ConfirmEmailChange(ctx, &userspb.EmailConfirmation{Token: confirmation.Token})
+	if err != nil {
+		return nil, v2Error(err)
+	}
+	return v2User(usr), nil
+}
+
+// ChangeNickname implements the userspbv2.UsersServer.ChangeNickname function, allowing clients to change the
+// nickname of users
+func (svr *V2Server) ChangeNickname(ctx context.Context, change *userspbv2.NicknameChange) (*userspbv2.User, error) {
+	usr, err := svr.v1.ChangeNickname(ctx, &userspb.NicknameChange{
+		Id:       change.Id,
+		Nickname: change.Nickname,
+		Version:  change.Version,
+	})
+	if err != nil {
+		return nil, v2Error(err)
+	}
+	return v2User(usr), nil
+}
+
+// GetUser implements the userspbv2.UsersServer.GetUser function, allowing clients to read a single user by id
+func (svr *V2Server) GetUser(ctx context.Context, userRef *userspbv2.Ref) (*userspbv2.User, error) {
+	usr, err := svr.v1.GetUser(ctx, &userspb.Ref{Id: userRef.Id})
+	if err != nil {
+		return nil, v2Error(err)
+	}
+	return v2User(usr), nil
+}
+
+// DeleteUser implements the userspbv2.UsersServer.DeleteUser function, allowing clients to delete users
+func (svr *V2Server) DeleteUser(ctx context.Context, userRef *userspbv2.Ref) (*emptypb.Empty, error) {
+	empty, err := svr.v1.DeleteUser(ctx, &userspb.Ref{Id: userRef.Id})
+	if err != nil {
+		return nil, v2Error(err)
+	}
+	return empty, nil
+}
+
+// TouchLastSeen implements the userspbv2.UsersServer.TouchLastSeen function, allowing clients to record that a user
+// is active
+func (svr *V2Server) TouchLastSeen(ctx context.Context, userRef *userspbv2.Ref) (*emptypb.Empty, error) {
+	empty, err := svr.v1.TouchLastSeen(ctx, &userspb.Ref{Id: userRef.Id})
+	if err != nil {
+		return nil, v2Error(err)
+	}
+	return empty, nil
+}
+
+// RestoreUser implements the userspbv2.UsersServer.RestoreUser function, allowing clients to restore deleted users
+func (svr *V2Server) RestoreUser(ctx context.Context, userRef *userspbv2.Ref) (*userspbv2.User, error) {
+	usr, err := svr.v1.RestoreUser(ctx, &userspb.Ref{Id: userRef.Id})
+	if err != nil {
+		return nil, v2Error(err)
+	}
+	return v2User(usr), nil
+}
+
+// ReplayUserEvents implements the userspbv2.UsersServer.ReplayUserEvents function, allowing clients to publish the
+// current state of users again
+func (svr *V2Server) ReplayUserEvents(ctx context.Context, userRef *userspbv2.Ref) (*userspbv2.User, error) {
+	usr, err := svr.v1.ReplayUserEvents(ctx, &userspb.Ref{Id: userRef.Id})
+	if err != nil {
+		return nil, v2Error(err)
+	}
+	return v2User(usr), nil
+}
+
+// ListDeadLetters implements the userspbv2.UsersServer.ListDeadLetters function, allowing clients to list the events
+// which failed to be published too many times
+func (svr *V2Server) ListDeadLetters(ctx context.Context, _ *userspbv2.DeadLettersRequest) (*userspbv2.DeadLetters, error) {
+	deadLetters, err := svr.v1.ListDeadLetters(ctx, &userspb.DeadLettersRequest{})
+	if err != nil {
+		return nil, v2Error(err)
+	}
+	response := &userspbv2.DeadLetters{DeadLetters: make([]*userspbv2.DeadLetter, 0, len(deadLetters.DeadLetters))}
+	for _, deadLetter := range deadLetters.DeadLetters {
+		response.DeadLetters = append(response.DeadLetters, &userspbv2.DeadLetter{
+			Id:             deadLetter.Id,
+			Version:        deadLetter.Version,
+			Action:         v2Actions[deadLetter.Action],
+			CreatedAt:      v2Timestamp(deadLetter.CreatedAt),
+			DeadLetteredAt: v2Timestamp(deadLetter.DeadLetteredAt),
+			Attempts:       deadLetter.Attempts,
+		})
+	}
+	return response, nil
+}
+
+// RequeueDeadLetter implements the userspbv2.UsersServer.RequeueDeadLetter function, allowing clients to publish the
+// dead lettered events of users again
+func (svr *V2Server) RequeueDeadLetter(ctx context.Context, userRef *userspbv2.Ref) (*emptypb.Empty, error) {
+	if _, err := svr.v1.RequeueDeadLetter(ctx, &userspb.Ref{Id: userRef.Id}); err != nil {
+		return nil, v2Error(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// AnonymizeUser implements the userspbv2.UsersServer.AnonymizeUser function, allowing clients to replace the
+// personal information of users with placeholders
+func (svr *V2Server) AnonymizeUser(ctx context.Context, userRef *userspbv2.Ref) (*userspbv2.User, error) {
+	usr, err := svr.v1.AnonymizeUser(ctx, &userspb.Ref{Id: userRef.Id})
+	if err != nil {
+		return nil, v2Error(err)
+	}
+	return v2User(usr), nil
+}
+
+// SuspendUser implements the userspbv2.UsersServer.SuspendUser function, allowing clients to suspend active users
+func (svr *V2Server) SuspendUser(ctx context.Context, userRef *userspbv2.Ref) (*userspbv2.User, error) {
+	usr, err := svr.v1.SuspendUser(ctx, &userspb.Ref{Id: userRef.Id})
+	if err != nil {
+		return nil, v2Error(err)
+	}
+	return v2User(usr), nil
+}
+
+// ReactivateUser implements the userspbv2.UsersServer.ReactivateUser function, allowing clients to make suspended
+// or dormant users active again
+func (svr *V2Server) ReactivateUser(ctx context.Context, userRef *userspbv2.Ref) (*userspbv2.User, error) {
+	usr, err := svr.v1.ReactivateUser(ctx, &userspb.Ref{Id: userRef.Id})
+	if err != nil {
+		return nil, v2Error(err)
+	}
+	return v2User(usr), nil
+}
+
+// BanUser implements the userspbv2.UsersServer.BanUser function, allowing clients to ban users
+func (svr *V2Server) BanUser(ctx context.Context, userRef *userspbv2.Ref) (*userspbv2.User, error) {
+	usr, err := svr.v1.BanUser(ctx, &userspb.Ref{Id: userRef.Id})
+	if err != nil {
+		return nil, v2Error(err)
+	}
+	return v2User(usr), nil
+}
+
+// ExportUserData implements the userspbv2.UsersServer.ExportUserData function, allowing clients to read everything
+// held about a user
+func (svr *V2Server) ExportUserData(ctx context.Context, userRef *userspbv2.Ref) (*userspbv2.UserData, error) {
+	data, err := svr.v1.ExportUserData(ctx, &userspb.Ref{Id: userRef.Id})
+	if err != nil {
+		return nil, v2Error(err)
+	}
+	return &userspbv2.UserData{Document: data.Document}, nil
+}
+
+// BatchDeleteUsers implements the userspbv2.UsersServer.BatchDeleteUsers function, allowing clients to delete a batch
+// of users in a single call
+func (svr *V2Server) BatchDeleteUsers(ctx context.Context, refs *userspbv2.Refs) (*userspbv2.BatchDeleteResult, error) {
+	result, err := svr.v1.BatchDeleteUsers(ctx, &userspb.Refs{Ids: refs.Ids})
+	if err != nil {
+		return nil, v2Error(err)
+	}
+	results := make([]*userspbv2.DeleteResult, 0, len(result.Results))
+	for _, r := range result.Results {
+		results = append(results, &userspbv2.DeleteResult{Id: r.Id, Deleted: r.Deleted})
+	}
+	return &userspbv2.BatchDeleteResult{Results: results}, nil
+}
+
+// BatchGetUsers implements the userspbv2.UsersServer.BatchGetUsers function, allowing clients to read a batch of users
+// in a single call
+func (svr *V2Server) BatchGetUsers(ctx context.Context, refs *userspbv2.Refs) (*userspbv2.BatchGetResult, error) {
+	result, err := svr.v1.BatchGetUsers(ctx, &userspb.Refs{Ids: refs.Ids})
+	if err != nil {
+		return nil, v2Error(err)
+	}
+	results := make([]*userspbv2.GetResult, 0, len(result.Results))
+	for _, r := range result.Results {
+		results = append(results, &userspbv2.GetResult{Id: r.Id, Found: r.Found, User: v2User(r.User)})
+	}
+	return &userspbv2.BatchGetResult{Results: results}, nil
+}
+
+func v1Query(query *userspbv2.Query) *userspb.Query {
+	direction := userspb.SortDirection_SORT_ASCENDING
+	if query.SortDirection == userspbv2.SortDirection_SORT_DIRECTION_DESCENDING {
+		direction = userspb.SortDirection_SORT_DESCENDING
+	}
+	return &userspb.Query{
+		CreatedAfter:  v1Timestamp(query.CreatedAfter),
+		CreatedBefore: v1Timestamp(query.CreatedBefore),
+		Country:       query.Country,
+		Countries:     query.Countries,
+		Length:        query.Length,
+		Page:          query.Page,
+		SortBy:        v1SortFields[query.SortBy],
+		SortDirection: direction,
+		Status:        v1Statuses[query.Status],
+		Search:        query.Search,
+		InactiveSince: v1Timestamp(query.InactiveSince),
+		SkipTotal:     query.SkipTotal,
+	}
+}
+
+// FindUsers implements the userspbv2.UsersServer.FindUsers function, allowing clients to find users and page through results
+func (svr *V2Server) FindUsers(ctx context.Context, query *userspbv2.Query) (*userspbv2.Page, error) {
+	page, err := svr.v1.FindUsers(ctx, v1Query(query))
+	if err != nil {
+		return nil, v2Error(err)
+	}
+	items := make([]*userspbv2.User, 0, len(page.Items))
+	for _, itm := range page.Items {
+		items = append(items, v2User(itm))
+	}
+	return &userspbv2.Page{
+		Page:       page.Page,
+		Total:      page.Total,
+		Items:      items,
+		HasNext:    page.HasNext,
+		TotalPages: page.TotalPages,
+	}, nil
+}
+
+// v1ExportStream adapts a userspbv2 export stream so that it can be used by RPCServer.ExportUsers
+type v1ExportStream struct {
+	userspbv2.Users_ExportUsersServer
+}
+
+func (stream v1ExportStream) Send(usr *userspb.User) error {
+	return stream.Users_ExportUsersServer.Send(v2User(usr))
+}
+
+// ExportUsers implements the userspbv2.UsersServer.ExportUsers function, allowing clients to stream every matching
+// user without paging
+func (svr *V2Server) ExportUsers(query *userspbv2.Query, stream userspbv2.Users_ExportUsersServer) error {
+	if err := svr.v1.ExportUsers(v1Query(query), v1ExportStream{stream}); err != nil {
+		return v2Error(err)
+	}
+	return nil
+}
+
+// CountUsers implements the userspbv2.UsersServer.CountUsers function, allowing clients to count users without
+// fetching them
+func (svr *V2Server) CountUsers(ctx context.Context, query *userspbv2.Query) (*userspbv2.Count, error) {
+	count, err := svr.v1.CountUsers(ctx, v1Query(query))
+	if err != nil {
+		return nil, v2Error(err)
+	}
+	return &userspbv2.Count{Total: count.Total}, nil
+}
+
+var v1StatsIntervals = map[userspbv2.StatsInterval]string{
+	userspbv2.StatsInterval_STATS_INTERVAL_DAY:   string(userstore.IntervalDay),
+	userspbv2.StatsInterval_STATS_INTERVAL_WEEK:  string(userstore.IntervalWeek),
+	userspbv2.StatsInterval_STATS_INTERVAL_MONTH: string(userstore.IntervalMonth),
+}
+
+// GetUserStats implements the userspbv2.UsersServer.GetUserStats function, allowing clients to count users by
+// country and signup period without fetching them
+func (svr *V2Server) GetUserStats(ctx context.Context, query *userspbv2.StatsQuery) (*userspbv2.Stats, error) {
+	stats, err := svr.v1.GetUserStats(ctx, &userspb.StatsQuery{
+		CreatedAfter:  v1Timestamp(query.CreatedAfter),
+		CreatedBefore: v1Timestamp(query.CreatedBefore),
+		Country:       query.Country,
+		Countries:     query.Countries,
+		Status:        v1Statuses[query.Status],
+		Interval:      v1StatsIntervals[query.Interval],
+	})
+	if err != nil {
+		return nil, v2Error(err)
+	}
+	countries := make([]*userspbv2.CountryCount, 0, len(stats.Countries))
+	for _, c := range stats.Countries {
+		countries = append(countries, &userspbv2.CountryCount{Country: c.Country, Total: c.Total})
+	}
+	signups := make([]*userspbv2.SignupCount, 0, len(stats.Signups))
+	for _, s := range stats.Signups {
+		signups = append(signups, &userspbv2.SignupCount{Start: v2Timestamp(s.Start), Total: s.Total})
+	}
+	return &userspbv2.Stats{Total: stats.Total, Countries: countries, Signups: signups}, nil
+}
+
+// LookupUser implements the userspbv2.UsersServer.LookupUser function, allowing clients to find a single user by
+// email address or nickname
+func (svr *V2Server) LookupUser(ctx context.Context, lookup *userspbv2.Lookup) (*userspbv2.User, error) {
+	v1Lookup := &userspb.Lookup{}
+	switch key := lookup.Key.(type) {
+	case *userspbv2.Lookup_Email:
+		v1Lookup.Key = &userspb.Lookup_Email{Email: key.Email}
+	case *userspbv2.Lookup_Nickname:
+		v1Lookup.Key = &userspb.Lookup_Nickname{Nickname: key.Nickname}
+	}
+	usr, err := svr.v1.LookupUser(ctx, v1Lookup)
+	if err != nil {
+		return nil, v2Error(err)
+	}
+	return v2User(usr), nil
+}
+
+// CheckAvailability implements the userspbv2.UsersServer.CheckAvailability function, allowing clients to check
+// whether a nickname or email address is taken before creating a user
+func (svr *V2Server) CheckAvailability(ctx context.Context, check *userspbv2.AvailabilityCheck) (*userspbv2.Availability, error) {
+	availability, err := svr.v1.CheckAvailability(ctx, &userspb.AvailabilityCheck{Nickname: check.Nickname, Email: check.Email})
+	if err != nil {
+		return nil, v2Error(err)
+	}
+	return &userspbv2.Availability{
+		NicknameAvailable: availability.NicknameAvailable,
+		EmailAvailable:    availability.EmailAvailable,
+	}, nil
+}
+
+// Authenticate implements the userspbv2.UsersServer.Authenticate function, allowing clients to check the credentials of a user
+func (svr *V2Server) Authenticate(ctx context.Context, credentials *userspbv2.Credentials) (*userspbv2.AuthResult, error) {
+	result, err := svr.v1.Authenticate(ctx, &userspb.Credentials{
+		Email:    credentials.Email,
+		Password: credentials.Password,
+		Code:     credentials.Code,
+	})
+	if err != nil {
+		return nil, v2Error(err)
+	}
+	return &userspbv2.AuthResult{User: v2User(result.User)}, nil
+}
+
+// EnrollTwoFactor implements the userspbv2.UsersServer.EnrollTwoFactor function, allowing clients to start the
+// enrollment of users in two factor authentication
+func (svr *V2Server) EnrollTwoFactor(ctx context.Context, userRef *userspbv2.Ref) (*userspbv2.TwoFactorEnrollment, error) {
+	enrollment, err := svr.v1.EnrollTwoFactor(ctx, &userspb.Ref{Id: userRef.Id})
+	if err != nil {
+		return nil, v2Error(err)
+	}
+	return &userspbv2.TwoFactorEnrollment{Secret: enrollment.Secret, Uri: enrollment.Uri}, nil
+}
+
+// ConfirmTwoFactor implements the userspbv2.UsersServer.ConfirmTwoFactor function, allowing clients to enable two
+// factor authentication for enrolled users
+func (svr *V2Server) ConfirmTwoFactor(ctx context.Context, code *userspbv2.TwoFactorCode) (*userspbv2.RecoveryCodes, error) {
+	recoveryCodes, err := svr.v1.ConfirmTwoFactor(ctx, &userspb.TwoFactorCode{Id: code.Id, Code: code.Code})
+	if err != nil {
+		return nil, v2Error(err)
+	}
+	return &userspbv2.RecoveryCodes{Codes: recoveryCodes.Codes}, nil
+}
+
+// DisableTwoFactor implements the userspbv2.UsersServer.DisableTwoFactor function, allowing clients to turn two factor
+// authentication off
+func (svr *V2Server) DisableTwoFactor(ctx context.Context, code *userspbv2.TwoFactorCode) (*userspbv2.User, error) {
+	usr, err := svr.v1.DisableTwoFactor(ctx, &userspb.TwoFactorCode{Id: code.Id, Code: code.Code})
+	if err != nil {
+		return nil, v2Error(err)
+	}
+	return v2User(usr), nil
+}
+
+// RequestPasswordReset implements the userspbv2.UsersServer.RequestPasswordReset function, allowing clients to have
+// a password reset token sent to a user
+func (svr *V2Server) RequestPasswordReset(ctx context.Context, req *userspbv2.PasswordResetRequest) (*emptypb.Empty, error) {
+	empty, err := svr.v1.RequestPasswordReset(ctx, &userspb.PasswordResetRequest{Email: req.Email})
+	if err != nil {
+		return nil, v2Error(err)
+	}
+	return empty, nil
+}
+
+// ResetPassword implements the userspbv2.UsersServer.ResetPassword function, allowing clients to set the password
+// of a user with a password reset token
+func (svr *V2Server) ResetPassword(ctx context.Context, reset *userspbv2.PasswordReset) (*userspbv2.User, error) {
+	usr, err := svr.v1.ResetPassword(ctx, &userspb.PasswordReset{
+		Token:           reset.Token,
+		Password:        reset.Password,
+		ConfirmPassword: reset.ConfirmPassword,
+	})
+	if err != nil {
+		return nil, v2Error(err)
+	}
+	return v2User(usr), nil
+}
+
+// v1WatchStream adapts a userspbv2 watch stream so that it can be used by RPCServer.WatchUsers
+type v1WatchStream struct {
+	userspbv2.Users_WatchUsersServer
+}
+
+func (stream v1WatchStream) Send(evt *userspb.UserEvent) error {
+	return stream.Users_WatchUsersServer.Send(v2UserEvent(evt))
+}
+
+// WatchUsers implements the userspbv2.UsersServer.WatchUsers function, allowing clients to subscribe to change events
+func (svr *V2Server) WatchUsers(req *userspbv2.WatchRequest, stream userspbv2.Users_WatchUsersServer) error {
+	actions := make([]string, 0, len(req.Actions))
+	for _, action := range req.Actions {
+		v1Action, ok := v1Actions[action]
+		if !ok {
+			// an unknown action would otherwise be sent as no action, which matches no events
+			return status.Errorf(codes.InvalidArgument, "unknown action %s", action)
+		}
+		actions = append(actions, v1Action)
+	}
+	return svr.v1.WatchUsers(&userspb.WatchRequest{Actions: actions}, v1WatchStream{stream})
+}
@@ -0,0 +1,229 @@
+package rpc_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/rpc"
+	"github.com/robotlovesyou/fitest/pkg/user"
+	userspbv2 "github.com/robotlovesyou/fitest/userspb/v2"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// withV2Client starts a version 2 rpc server using svc and calls f with a client connected to it
+func withV2Client(svc rpc.UsersService, f func(userspbv2.UsersClient)) {
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		panic(fmt.Sprintf("cannot open random port: %v", err))
+	}
+
+	logger := nopLogger{}
+	grpcServer := grpc.NewServer()
+	userspbv2.RegisterUsersServer(grpcServer, rpc.NewV2(svc, logger))
+	go grpcServer.Serve(lis)
+	defer grpcServer.Stop()
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		panic(fmt.Sprintf("cannot dial rpc server: %v", err))
+	}
+	defer conn.Close()
+	f(userspbv2.NewUsersClient(conn))
+}
+
+func TestV2FindUsersConvertsTimestampsAndEnums(t *testing.T) {
+	stubService := newStubService()
+	createdAfter := time.Date(2022, 4, 1, 12, 0, 0, 0, time.UTC)
+	inactiveSince := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+	createdBefore := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	withV2Client(stubService, func(client userspbv2.UsersClient) {
+		var response user.Page
+		stubService.find = func(ctx context.Context, query *user.Query) (user.Page, error) {
+			require.Equal(t, createdAfter.Format(user.TimeFormat), query.CreatedAfter)
+			require.Equal(t, "nickname", query.SortBy)
+			require.Equal(t, user.SortDescending, query.SortDirection)
+			require.Equal(t, user.StatusSuspended, query.Status)
+			require.Equal(t, "Max", query.Search)
+			require.Equal(t, inactiveSince.Format(user.TimeFormat), query.InactiveSince)
+			require.Equal(t, createdBefore.Format(user.TimeFormat), query.CreatedBefore)
+			require.Equal(t, []string{"NL", "BE"}, query.Countries)
+			require.True(t, query.SkipTotal)
+			response = usersPageFromQuery(*query)
+			for i := range response.Items {
+				response.Items[i].Status = user.StatusSuspended
+				response.Items[i].LastSeenAt = query.CreatedAfter
+			}
+			return response, nil
+		}
+		page, err := client.FindUsers(context.Background(), &userspbv2.Query{
+			CreatedAfter:  timestamppb.New(createdAfter),
+			Length:        2,
+			Page:          1,
+			SortBy:        userspbv2.SortField_SORT_FIELD_NICKNAME,
+			SortDirection: userspbv2.SortDirection_SORT_DIRECTION_DESCENDING,
+			Status:        userspbv2.UserStatus_USER_STATUS_SUSPENDED,
+			Search:        "Max",
+			InactiveSince: timestamppb.New(inactiveSince),
+			CreatedBefore: timestamppb.New(createdBefore),
+			Countries:     []string{"NL", "BE"},
+			SkipTotal:     true,
+		})
+		require.NoError(t, err)
+		require.Len(t, page.Items, 2)
+		require.True(t, page.HasNext)
+		require.Equal(t, int64(2), page.TotalPages)
+		for i, itm := range page.Items {
+			require.Equal(t, response.Items[i].ID, itm.Id)
+			require.Equal(t, response.Items[i].CreatedAt, itm.CreatedAt.AsTime().Format(user.TimeFormat))
+			require.Equal(t, response.Items[i].UpdatedAt, itm.UpdatedAt.AsTime().Format(user.TimeFormat))
+			require.Equal(t, userspbv2.UserStatus_USER_STATUS_SUSPENDED, itm.Status)
+			require.Equal(t, createdAfter, itm.LastSeenAt.AsTime())
+			require.Nil(t, itm.LastLoginAt)
+		}
+	})
+}
+
+func TestV2UpdateMaskAndFieldViolationsUseV2Names(t *testing.T) {
+	stubService := newStubService()
+	withV2Client(stubService, func(client userspbv2.UsersClient) {
+		stubService.update = func(ctx context.Context, userUpdate *user.Update) (usr user.User, err error) {
+			require.Equal(t, []string{user.FieldPassword}, userUpdate.Fields)
+			return usr, &user.InvalidError{Violations: []user.FieldViolation{
+				{Field: "ConfirmPassword", Rule: "eqfield", Description: "must match Password"},
+			}}
+		}
+		_, err := client.UpdateUser(context.Background(), &userspbv2.Update{
+			Id:         "id",
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"confirm_password"}},
+		})
+		st := status.Convert(err)
+		require.Equal(t, codes.InvalidArgument.String(), st.Code().String())
+		badRequest, ok := st.Details()[0].(*errdetails.BadRequest)
+		require.True(t, ok)
+		require.Equal(t, "confirm_password", badRequest.FieldViolations[0].Field)
+		info, ok := st.Details()[1].(*errdetails.ErrorInfo)
+		require.True(t, ok)
+		require.Equal(t, map[string]string{"confirm_password": "eqfield"}, info.Metadata)
+	})
+}
+
+func TestV2WatchUsersConvertsActions(t *testing.T) {
+	stubService := newStubService()
+	created := fakeSanitizedUser()
+	events := []user.Event{
+		{ID: created.ID, Version: 1, Action: "Created", Data: &created},
+		{ID: created.ID, Version: 2, Action: "Deleted"},
+	}
+	withV2Client(stubService, func(client userspbv2.UsersClient) {
+		stubService.watch = func(context.Context) <-chan user.Event {
+			out := make(chan user.Event, len(events))
+			for _, evt := range events {
+				out <- evt
+			}
+			close(out)
+			return out
+		}
+		stream, err := client.WatchUsers(context.Background(), &userspbv2.WatchRequest{
+			Actions: []userspbv2.Action{userspbv2.Action_ACTION_DELETED},
+		})
+		require.NoError(t, err)
+		evt, err := stream.Recv()
+		require.NoError(t, err)
+		require.Equal(t, userspbv2.Action_ACTION_DELETED, evt.Action)
+		require.Equal(t, int64(2), evt.Version)
+		require.Nil(t, evt.Data)
+
+		_, err = stream.Recv()
+		require.Equal(t, codes.Unavailable.String(), status.Code(err).String())
+	})
+}
+
+func TestV2WatchUsersRejectsUnknownActions(t *testing.T) {
+	cases := []struct {
+		name   string
+		action userspbv2.Action
+	}{
+		{name: "Unspecified", action: userspbv2.Action_ACTION_UNSPECIFIED},
+		{name: "Unknown", action: userspbv2.Action(999)},
+	}
+	for _, c := range cases {
+		thisCase := c
+		t.Run(thisCase.name, func(t *testing.T) {
+			withV2Client(newStubService(), func(client userspbv2.UsersClient) {
+				stream, err := client.WatchUsers(context.Background(), &userspbv2.WatchRequest{
+					Actions: []userspbv2.Action{userspbv2.Action_ACTION_CREATED, thisCase.action},
+				})
+				require.NoError(t, err)
+				_, err = stream.Recv()
+				require.Equal(t, codes.InvalidArgument.String(), status.Code(err).String())
+			})
+		})
+	}
+}
+
+func TestV2GetUserStatsConvertsTimestampsAndEnums(t *testing.T) {
+	stubService := newStubService()
+	createdAfter := time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC)
+	start := time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC)
+	withV2Client(stubService, func(client userspbv2.UsersClient) {
+		stubService.stats = func(ctx context.Context, query *user.StatsQuery) (user.Stats, error) {
+			require.Equal(t, createdAfter.Format(user.TimeFormat), query.CreatedAfter)
+			require.Empty(t, query.CreatedBefore)
+			require.Equal(t, []string{"NL"}, query.Countries)
+			require.Equal(t, user.StatusDormant, query.Status)
+			require.Equal(t, "month", query.Interval)
+			return user.Stats{
+				Total:     2,
+				Countries: []user.CountryCount{{Country: "NL", Total: 2}},
+				Signups:   []user.SignupCount{{Start: start.Format(user.TimeFormat), Total: 2}},
+			}, nil
+		}
+		stats, err := client.GetUserStats(context.Background(), &userspbv2.StatsQuery{
+			CreatedAfter: timestamppb.New(createdAfter),
+			Countries:    []string{"NL"},
+			Status:       userspbv2.UserStatus_USER_STATUS_DORMANT,
+			Interval:     userspbv2.StatsInterval_STATS_INTERVAL_MONTH,
+		})
+		require.NoError(t, err)
+		require.Equal(t, int64(2), stats.Total)
+		require.Equal(t, "NL", stats.Countries[0].Country)
+		require.True(t, start.Equal(stats.Signups[0].Start.AsTime()))
+		require.Equal(t, int64(2), stats.Signups[0].Total)
+	})
+}
+
+func TestV2ListDeadLettersConvertsTimestampsAndEnums(t *testing.T) {
+	stubService := newStubService()
+	deadLetter := user.DeadLetter{
+		ID:             uuid.New(),
+		Version:        2,
+		Action:         "Updated",
+		CreatedAt:      time.Date(2022, 4, 1, 12, 0, 0, 0, time.UTC),
+		DeadLetteredAt: time.Date(2022, 4, 1, 13, 0, 0, 0, time.UTC),
+		Attempts:       10,
+	}
+	withV2Client(stubService, func(client userspbv2.UsersClient) {
+		stubService.deadLetters = func(context.Context) ([]user.DeadLetter, error) {
+			return []user.DeadLetter{deadLetter}, nil
+		}
+		res, err := client.ListDeadLetters(context.Background(), &userspbv2.DeadLettersRequest{})
+		require.NoError(t, err)
+		require.Len(t, res.DeadLetters, 1)
+		require.Equal(t, deadLetter.ID.String(), res.DeadLetters[0].Id)
+		require.Equal(t, userspbv2.Action_ACTION_UPDATED, res.DeadLetters[0].Action)
+		require.Equal(t, timestamppb.New(deadLetter.CreatedAt).AsTime(), res.DeadLetters[0].CreatedAt.AsTime())
+		require.Equal(t, timestamppb.New(deadLetter.DeadLetteredAt).AsTime(), res.DeadLetters[0].DeadLetteredAt.AsTime())
+		require.Equal(t, deadLetter.Attempts, res.DeadLetters[0].Attempts)
+	})
+}
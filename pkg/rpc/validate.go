@@ -0,0 +1,77 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+
+	"buf.build/go/protovalidate"
+	"github.com/robotlovesyou/fitest/pkg/user"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// validateRequest checks req against the buf.validate constraints of its fields.
+// Requests which break them are rejected with InvalidArgument and google.rpc.BadRequest details describing each
+// invalid field, named by its path from req, e.g. update.first_name, or users[1].email for an element of a list
+func validateRequest(validator protovalidate.Validator, req interface{}) error {
+	msg, ok := req.(proto.Message)
+	if !ok {
+		return nil
+	}
+	err := validator.Validate(msg)
+	if err == nil {
+		return nil
+	}
+	var validationErr *protovalidate.ValidationError
+	if !errors.As(err, &validationErr) {
+		// the constraints of the request could not be compiled or evaluated
+		return status.Error(codes.Internal, err.Error())
+	}
+	badRequest := &errdetails.BadRequest{}
+	for _, v := range validationErr.Violations {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       protovalidate.FieldPathString(v.Proto.GetField()),
+			Description: v.Proto.GetMessage(),
+		})
+	}
+	st, err := status.New(codes.InvalidArgument, user.ErrInvalid.Error()).WithDetails(badRequest)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, user.ErrInvalid.Error())
+	}
+	return st.Err()
+}
+
+// UnaryValidationInterceptor returns an interceptor which checks requests against the buf.validate constraints of
+// their fields, so that obviously malformed requests are rejected without calling the users service.
+// Rejected calls fail with InvalidArgument and google.rpc.BadRequest details describing each invalid field
+func UnaryValidationInterceptor(validator protovalidate.Validator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := validateRequest(validator, req); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// validatedStream wraps a grpc.ServerStream to validate each message received from the caller
+type validatedStream struct {
+	grpc.ServerStream
+	validator protovalidate.Validator
+}
+
+func (s *validatedStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return validateRequest(s.validator, m)
+}
+
+// StreamValidationInterceptor is the streaming equivalent of UnaryValidationInterceptor
+func StreamValidationInterceptor(validator protovalidate.Validator) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &validatedStream{ServerStream: stream, validator: validator})
+	}
+}
@@ -0,0 +1,244 @@
+package rpc_test
+
+import (
+	"context"
+	"testing"
+
+	"buf.build/gen/go/bufbuild/protovalidate/protocolbuffers/go/buf/validate"
+	"buf.build/go/protovalidate"
+	"github.com/robotlovesyou/fitest/pkg/rpc"
+	"github.com/robotlovesyou/fitest/pkg/user"
+	"github.com/robotlovesyou/fitest/userspb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// newValidator creates a validator for the buf.validate constraints of requests
+func newValidator(t *testing.T) protovalidate.Validator {
+	validator, err := protovalidate.New()
+	require.NoError(t, err)
+	return validator
+}
+
+func TestValidRequestsReachTheService(t *testing.T) {
+	stubService := newStubService()
+	request := fakeNewUser()
+	request.Password = "password123"
+	request.ConfirmPassword = request.Password
+	withClient(stubService, func(client userspb.UsersClient) {
+		stubService.create = func(_ context.Context, newUser *user.NewUser) (user.User, error) {
+			return userFromNewUser(*newUser), nil
+		}
+		_, err := client.CreateUser(context.Background(), &request)
+		require.NoError(t, err)
+	}, grpc.UnaryInterceptor(rpc.UnaryValidationInterceptor(newValidator(t))))
+}
+
+func TestMalformedRequestsAreRejectedWithFieldViolations(t *testing.T) {
+	stubService := newStubService()
+	request := fakeNewUser()
+	request.FirstName = ""
+	request.Password = "short"
+	request.Email = "not an email"
+	request.Country = "Germany"
+	withClient(stubService, func(client userspb.UsersClient) {
+		// the stub service panics if it is called
+		_, err := client.CreateUser(context.Background(), &request)
+		st := status.Convert(err)
+		require.Equal(t, codes.InvalidArgument.String(), st.Code().String())
+		require.Len(t, st.Details(), 1)
+		badRequest, ok := st.Details()[0].(*errdetails.BadRequest)
+		require.True(t, ok)
+		fields := make(map[string]string)
+		for _, v := range badRequest.FieldViolations {
+			fields[v.Field] = v.Description
+		}
+		require.Equal(t, map[string]string{
+			"first_name": "value is required",
+			"password":   "must be at least 10 characters",
+			"email":      "must be a valid email address",
+			"country":    "must be an ISO 3166-1 alpha-2 country code",
+		}, fields)
+	}, grpc.UnaryInterceptor(rpc.UnaryValidationInterceptor(newValidator(t))))
+}
+
+func TestEmptyFieldsCanBeIgnoredByValidation(t *testing.T) {
+	stubService := newStubService()
+	request := fakeUserUpdate()
+	request.Password = ""
+	request.ConfirmPassword = ""
+	request.Country = ""
+	withClient(stubService, func(client userspb.UsersClient) {
+		stubService.update = func(context.Context, *user.Update) (user.User, error) {
+			return userFromNewUser(user.NewUser{}), nil
+		}
+		_, err := client.UpdateUser(context.Background(), &request)
+		require.NoError(t, err)
+
+		request.Id = "not a uuid"
+		_, err = client.UpdateUser(context.Background(), &request)
+		require.Equal(t, codes.InvalidArgument.String(), status.Code(err).String())
+	}, grpc.UnaryInterceptor(rpc.UnaryValidationInterceptor(newValidator(t))))
+}
+
+// nestedMessage returns an empty dynamic message whose fields hold messages with validation rules, so that the
+// validation of nested messages can be tested without adding them to the API
+func nestedMessage(t *testing.T) *dynamicpb.Message {
+	stringRules := func(r *validate.StringRules) *validate.FieldRules {
+		return &validate.FieldRules{Type: &validate.FieldRules_String_{String_: r}}
+	}
+	rules := func(r *validate.FieldRules) *descriptorpb.FieldOptions {
+		opts := &descriptorpb.FieldOptions{}
+		proto.SetExtension(opts, validate.E_Field, r)
+		return opts
+	}
+	field := func(name string, number int32, label descriptorpb.FieldDescriptorProto_Label, typ descriptorpb.FieldDescriptorProto_Type, typeName string, opts *descriptorpb.FieldOptions) *descriptorpb.FieldDescriptorProto {
+		fd := &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(number),
+			Label:    label.Enum(),
+			Type:     typ.Enum(),
+			Options:  opts,
+		}
+		if typeName != "" {
+			fd.TypeName = proto.String(typeName)
+		}
+		return fd
+	}
+	optional := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+	repeated := descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+	str := descriptorpb.FieldDescriptorProto_TYPE_STRING
+	msg := descriptorpb.FieldDescriptorProto_TYPE_MESSAGE
+	file := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("rpc_test/validate.proto"),
+		Package: proto.String("rpc_test"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("Inner"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("email", 1, optional, str, "", rules(stringRules(&validate.StringRules{WellKnown: &validate.StringRules_Email{Email: true}}))),
+					field("ids", 2, repeated, str, "", rules(&validate.FieldRules{Type: &validate.FieldRules_Repeated{Repeated: &validate.RepeatedRules{
+						Items: stringRules(&validate.StringRules{WellKnown: &validate.StringRules_Uuid{Uuid: true}}),
+					}}})),
+				},
+			},
+			{
+				Name: proto.String("Outer"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("inner", 1, optional, msg, ".rpc_test.Inner", nil),
+					field("inners", 2, repeated, msg, ".rpc_test.Inner", nil),
+					field("by_name", 3, repeated, msg, ".rpc_test.Outer.ByNameEntry", nil),
+				},
+				NestedType: []*descriptorpb.DescriptorProto{{
+					Name: proto.String("ByNameEntry"),
+					Field: []*descriptorpb.FieldDescriptorProto{
+						field("key", 1, optional, str, "", nil),
+						field("value", 2, optional, msg, ".rpc_test.Inner", nil),
+					},
+					Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+				}},
+			},
+		},
+	}
+	fd, err := protodesc.NewFile(file, nil)
+	require.NoError(t, err)
+	return dynamicpb.NewMessage(fd.Messages().ByName("Outer"))
+}
+
+func TestNestedMessagesAreValidated(t *testing.T) {
+	outer := nestedMessage(t)
+	fields := outer.Descriptor().Fields()
+	innerDesc := fields.ByName("inner").Message()
+	inner := func(email string, ids ...string) protoreflect.Value {
+		msg := dynamicpb.NewMessage(innerDesc)
+		msg.Set(innerDesc.Fields().ByName("email"), protoreflect.ValueOfString(email))
+		list := msg.Mutable(innerDesc.Fields().ByName("ids")).List()
+		for _, id := range ids {
+			list.Append(protoreflect.ValueOfString(id))
+		}
+		return protoreflect.ValueOfMessage(msg)
+	}
+	validID := fakeUserRef().Id
+	outer.Set(fields.ByName("inner"), inner("not an email", validID, "not a uuid"))
+	inners := outer.Mutable(fields.ByName("inners")).List()
+	inners.Append(inner("max@example.com"))
+	inners.Append(inner("not an email"))
+	outer.Mutable(fields.ByName("by_name")).Map().Set(protoreflect.ValueOfString("max").MapKey(), inner("max@example.com", "not a uuid"))
+
+	interceptor := rpc.UnaryValidationInterceptor(newValidator(t))
+	_, err := interceptor(context.Background(), outer, &grpc.UnaryServerInfo{}, func(context.Context, interface{}) (interface{}, error) {
+		panic("the handler should not be called for an invalid request")
+	})
+	st := status.Convert(err)
+	require.Equal(t, codes.InvalidArgument.String(), st.Code().String())
+	badRequest, ok := st.Details()[0].(*errdetails.BadRequest)
+	require.True(t, ok)
+	fieldViolations := make(map[string]string)
+	for _, v := range badRequest.FieldViolations {
+		fieldViolations[v.Field] = v.Description
+	}
+	require.Equal(t, map[string]string{
+		"inner.email":           "must be a valid email address",
+		"inner.ids[1]":          "must be a valid UUID",
+		"inners[1].email":       "must be a valid email address",
+		`by_name["max"].ids[0]`: "must be a valid UUID",
+	}, fieldViolations)
+
+	valid := dynamicpb.NewMessage(outer.Descriptor())
+	valid.Set(fields.ByName("inner"), inner("max@example.com", validID))
+	called := false
+	_, err = interceptor(context.Background(), valid, &grpc.UnaryServerInfo{}, func(context.Context, interface{}) (interface{}, error) {
+		called = true
+		return nil, nil
+	})
+	require.NoError(t, err)
+	require.True(t, called)
+}
+
+// recvStream is a grpc.ServerStream which receives a single message
+type recvStream struct {
+	grpc.ServerStream
+	msg proto.Message
+}
+
+func (s *recvStream) Context() context.Context {
+	return context.Background()
+}
+
+func (s *recvStream) RecvMsg(m interface{}) error {
+	proto.Merge(m.(proto.Message), s.msg)
+	return nil
+}
+
+func TestMessagesReceivedFromStreamsAreValidated(t *testing.T) {
+	invalid := nestedMessage(t)
+	fields := invalid.Descriptor().Fields()
+	inner := dynamicpb.NewMessage(fields.ByName("inner").Message())
+	inner.Set(inner.Descriptor().Fields().ByName("email"), protoreflect.ValueOfString("not an email"))
+	invalid.Set(fields.ByName("inner"), protoreflect.ValueOfMessage(inner))
+
+	interceptor := rpc.StreamValidationInterceptor(newValidator(t))
+	recv := func(_ interface{}, stream grpc.ServerStream) error {
+		return stream.RecvMsg(dynamicpb.NewMessage(invalid.Descriptor()))
+	}
+	err := interceptor(nil, &recvStream{msg: invalid}, &grpc.StreamServerInfo{}, recv)
+	st := status.Convert(err)
+	require.Equal(t, codes.InvalidArgument.String(), st.Code().String())
+	badRequest, ok := st.Details()[0].(*errdetails.BadRequest)
+	require.True(t, ok)
+	require.Len(t, badRequest.FieldViolations, 1)
+	require.Equal(t, "inner.email", badRequest.FieldViolations[0].Field)
+
+	err = interceptor(nil, &recvStream{msg: dynamicpb.NewMessage(invalid.Descriptor())}, &grpc.StreamServerInfo{}, recv)
+	require.NoError(t, err)
+}
@@ -0,0 +1,79 @@
+// Package secretbox encrypts secrets which the service must store and read back, such as the secrets of two factor
+// authentication, so that they cannot be read from the database or its backups without the key
+package secretbox
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// KeySize is the size in bytes of keys, which select AES-256
+const KeySize = 32
+
+var (
+	// ErrInvalidKey is returned when a key is not KeySize bytes long
+	ErrInvalidKey = fmt.Errorf("secretbox key must be %d bytes", KeySize)
+	// ErrCannotOpen is returned when a sealed secret was not sealed with the key of the box, or has been tampered with
+	ErrCannotOpen = errors.New("sealed secret cannot be opened")
+)
+
+// Box seals and opens secrets with AES-GCM. It implements user.SecretSealer
+type Box struct {
+	aead cipher.AEAD
+}
+
+// New creates a new Box which seals secrets with key
+func New(key []byte) (*Box, error) {
+	if len(key) != KeySize {
+		return nil, ErrInvalidKey
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create gcm: %w", err)
+	}
+	return &Box{aead: aead}, nil
+}
+
+// ParseKey decodes a base64 encoded key, as generated by e.g. openssl rand -base64 32
+func ParseKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode secretbox key: %w", err)
+	}
+	if len(key) != KeySize {
+		return nil, ErrInvalidKey
+	}
+	return key, nil
+}
+
+// Seal encrypts plain with a random nonce, and returns the nonce and ciphertext base64 encoded
+func (box *Box) Seal(plain string) (string, error) {
+	nonce := make([]byte, box.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("cannot generate nonce: %w", err)
+	}
+	sealed := box.aead.Seal(nonce, nonce, []byte(plain), nil)
+	return base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a secret sealed by Seal
+func (box *Box) Open(sealed string) (string, error) {
+	b, err := base64.RawStdEncoding.DecodeString(sealed)
+	if err != nil || len(b) < box.aead.NonceSize() {
+		return "", ErrCannotOpen
+	}
+	nonce, ciphertext := b[:box.aead.NonceSize()], b[box.aead.NonceSize():]
+	plain, err := box.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", ErrCannotOpen
+	}
+	return string(plain), nil
+}
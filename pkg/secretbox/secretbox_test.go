@@ -0,0 +1,67 @@
+package secretbox_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+
+	"github.com/robotlovesyou/fitest/pkg/secretbox"
+	"github.com/stretchr/testify/require"
+)
+
+func newBox(t *testing.T, fill byte) *secretbox.Box {
+	box, err := secretbox.New(bytes.Repeat([]byte{fill}, secretbox.KeySize))
+	require.NoError(t, err)
+	return box
+}
+
+func TestSealedSecretsCanBeOpened(t *testing.T) {
+	box := newBox(t, 1)
+	sealed, err := box.Seal("JBSWY3DPEHPK3PXP")
+	require.NoError(t, err)
+	require.NotContains(t, sealed, "JBSWY3DPEHPK3PXP")
+
+	plain, err := box.Open(sealed)
+	require.NoError(t, err)
+	require.Equal(t, "JBSWY3DPEHPK3PXP", plain)
+}
+
+func TestSealingTheSameSecretTwiceGivesDifferentResults(t *testing.T) {
+	box := newBox(t, 1)
+	first, err := box.Seal("secret")
+	require.NoError(t, err)
+	second, err := box.Seal("secret")
+	require.NoError(t, err)
+	require.NotEqual(t, first, second)
+}
+
+func TestSecretsCannotBeOpenedWithAnotherKeyOrWhenTamperedWith(t *testing.T) {
+	sealed, err := newBox(t, 1).Seal("secret")
+	require.NoError(t, err)
+
+	_, err = newBox(t, 2).Open(sealed)
+	require.ErrorIs(t, err, secretbox.ErrCannotOpen)
+
+	tampered := []byte(sealed)
+	tampered[len(tampered)-1] ^= 1
+	_, err = newBox(t, 1).Open(string(tampered))
+	require.ErrorIs(t, err, secretbox.ErrCannotOpen)
+
+	_, err = newBox(t, 1).Open("not sealed")
+	require.ErrorIs(t, err, secretbox.ErrCannotOpen)
+}
+
+func TestKeysMustBeTheRightSize(t *testing.T) {
+	_, err := secretbox.New([]byte("too short"))
+	require.ErrorIs(t, err, secretbox.ErrInvalidKey)
+
+	key, err := secretbox.ParseKey(base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, secretbox.KeySize)))
+	require.NoError(t, err)
+	require.Len(t, key, secretbox.KeySize)
+
+	_, err = secretbox.ParseKey(base64.StdEncoding.EncodeToString([]byte("too short")))
+	require.ErrorIs(t, err, secretbox.ErrInvalidKey)
+
+	_, err = secretbox.ParseKey("not base64!")
+	require.Error(t, err)
+}
@@ -0,0 +1,2087 @@
+// Package dynamouserstore implements a store for user details backed by DynamoDB, for serverless deployments which do
+// not run a database of their own.
+// It stores the same records as the userstore package, using the same transactional outbox pattern: the item holding
+// each user also holds the events to be published for changes to them, so that a change and its event are written in a
+// single conditional write, and events are handled in a separate process.
+//
+// Every item is kept in a single table, keyed by the PK and SK attributes:
+//   - the record of each user is held in an item with the PK USER#<id>. Each write of the item is conditional on the
+//     revision it was read at, so that concurrent changes are not lost
+//   - email addresses, nicknames, idempotency keys and the hashes of tokens are unique within a tenant, so each is held
+//     in a lookup item with the PK <kind>#<tenant> and the value as its SK, which is written in the same transaction as
+//     the record and refers to the user holding it
+//   - the records of users who have not been deleted are indexed by tenant with each field users can be sorted by as
+//     the sort key, and by tenant and country with the time they were created as the sort key, and records with events
+//     waiting to be processed are indexed by the time their first event was last updated. The indexes are sparse, so
+//     each only holds the records it is used to find
+//
+// Finding users reads the records of the tenant from the index of the sort of the query, or of the countries queried
+// when users are sorted by the time they were created, a page of items at a time, and filters them as they are read,
+// so that only the users up to the end of the page queried are read
+package dynamouserstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/store/memquery"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/telemetry"
+	"github.com/robotlovesyou/fitest/pkg/tenant"
+	"github.com/robotlovesyou/fitest/pkg/utctime"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// findTimeout is used to ensure that finds and counts will complete.
+	// It should probably be configurable
+	findTimeout = 10 * time.Second
+
+	// maxAttempts is the number of times a change is attempted when the record it changes is changed by another
+	// caller between being read and being written. It should probably be configurable
+	maxAttempts = 5
+
+	// eventBatchSize is the largest number of events claimed at once by Events.
+	// It should probably be configurable
+	eventBatchSize = 100
+
+	// tableTimeout is the time allowed for a new table, or new indexes of an existing table, to become active
+	tableTimeout = 5 * time.Minute
+
+	// indexPollInterval is the time waited between checks of whether new indexes of an existing table are active
+	indexPollInterval = 5 * time.Second
+
+	// queryPageSize is the largest number of items read from an index at once
+	queryPageSize = 100
+
+	// Attributes of the key of the table
+	pkAttr = "PK"
+	skAttr = "SK"
+
+	// Attributes of the items holding records
+	revisionAttr = "Revision"
+	recordAttr   = "Record"
+
+	// userIDAttr is the attribute of lookup items which holds the id of the user holding the value
+	userIDAttr = "UserID"
+
+	// Names and key attributes of the indexes of the table
+	tenantIndex    = "ByTenant"
+	tenantPKAttr   = "TenantPK"
+	tenantSKAttr   = "TenantSK"
+	countryIndex   = "ByCountry"
+	countryPKAttr  = "CountryPK"
+	countrySKAttr  = "CountrySK"
+	updatedIndex   = "ByUpdated"
+	updatedSKAttr  = "UpdatedSK"
+	lastNameIndex  = "ByLastName"
+	lastNameSKAttr = "LastNameSK"
+	nicknameIndex  = "ByNickname"
+	nicknameSKAttr = "NicknameSK"
+	outboxIndex    = "Outbox"
+	outboxPKAttr   = "OutboxPK"
+	outboxSKAttr   = "OutboxSK"
+
+	// userPrefix prefixes the id of a user in the PK of the item holding their record, and userSK is its SK
+	userPrefix = "USER#"
+	userSK     = "USER"
+
+	// tenantPrefix prefixes the tenant in the partition keys of the indexes of users, since the default tenant is the
+	// empty string, which DynamoDB does not allow in keys
+	tenantPrefix = "TENANT#"
+
+	// outboxPartition is the partition of the outbox index which every record with waiting events is in
+	outboxPartition = "OUTBOX"
+
+	// conditionalCheckFailed is the code of the reason a transaction was cancelled when a condition was not met
+	conditionalCheckFailed = "ConditionalCheckFailed"
+
+	// timeLayout is the layout of the times in sort keys, which has a fixed number of digits so that sort keys sort in
+	// time order
+	timeLayout = "2006-01-02T15:04:05.000000000Z07:00"
+
+	// nameSeparator separates the name from the id in sort keys starting with a name. It sorts before every character
+	// of a name, so that a name sorts before the names it is a prefix of, as it does in the order of memquery.Order
+	nameSeparator = "\x00"
+)
+
+// lookupKind is a kind of value which is unique within a tenant, and is held in a lookup item
+type lookupKind string
+
+const (
+	emailLookup       lookupKind = "EMAIL"
+	nicknameLookup    lookupKind = "NICKNAME"
+	keyLookup         lookupKind = "KEY"
+	resetTokenLookup  lookupKind = "RESET"
+	emailChangeLookup lookupKind = "EMAIL_CHANGE"
+)
+
+// lookupKinds are the kinds of lookup items, in the order they are written
+var lookupKinds = []lookupKind{emailLookup, nicknameLookup, keyLookup, resetTokenLookup, emailChangeLookup}
+
+// lookupConflicts are the errors returned when a value of each kind is already held by another user
+var lookupConflicts = map[lookupKind]error{
+	emailLookup:       userstore.ErrEmailInUse,
+	nicknameLookup:    userstore.ErrNicknameInUse,
+	keyLookup:         userstore.ErrAlreadyExists,
+	resetTokenLookup:  userstore.ErrAlreadyExists,
+	emailChangeLookup: userstore.ErrAlreadyExists,
+}
+
+var (
+	// errChanged is returned when a record is changed by another caller between being read and being written
+	errChanged = errors.New("user record was changed concurrently")
+	// errUnchanged is returned by the function applied to a record by modify to leave the record as it is
+	errUnchanged = errors.New("user record was not changed")
+)
+
+// statusActions are the actions of the events for changes to each status
+var statusActions = map[userstore.Status]userstore.Action{
+	userstore.StatusActive:    userstore.Reactivated,
+	userstore.StatusSuspended: userstore.Suspended,
+	userstore.StatusBanned:    userstore.Banned,
+	userstore.StatusDormant:   userstore.MarkedDormant,
+}
+
+// sortIndex is an index holding the records of users in the order of a SortField, with the id of each user as a tie
+// breaker, as in the order of memquery.Order
+type sortIndex struct {
+	name   string
+	pkAttr string
+	skAttr string
+	// byCreation is true for the indexes sorted by the time users were created
+	byCreation bool
+}
+
+var (
+	// sortIndexes are the indexes holding the records of each tenant in the order of each SortField
+	sortIndexes = map[userstore.SortField]sortIndex{
+		userstore.SortCreatedAt: {name: tenantIndex, pkAttr: tenantPKAttr, skAttr: tenantSKAttr, byCreation: true},
+		userstore.SortUpdatedAt: {name: updatedIndex, pkAttr: tenantPKAttr, skAttr: updatedSKAttr},
+		userstore.SortLastName:  {name: lastNameIndex, pkAttr: tenantPKAttr, skAttr: lastNameSKAttr},
+		userstore.SortNickname:  {name: nicknameIndex, pkAttr: tenantPKAttr, skAttr: nicknameSKAttr},
+	}
+	// countrySort is the index holding the records of each country of each tenant in the order they were created
+	countrySort = sortIndex{name: countryIndex, pkAttr: countryPKAttr, skAttr: countrySKAttr, byCreation: true}
+)
+
+// Client is the part of the DynamoDB API used by the store, which is implemented by *dynamodb.Client
+type Client interface {
+	dynamodb.DescribeTableAPIClient
+	CreateTable(context.Context, *dynamodb.CreateTableInput, ...func(*dynamodb.Options)) (*dynamodb.CreateTableOutput, error)
+	UpdateTable(context.Context, *dynamodb.UpdateTableInput, ...func(*dynamodb.Options)) (*dynamodb.UpdateTableOutput, error)
+	GetItem(context.Context, *dynamodb.GetItemInput, ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	Query(context.Context, *dynamodb.QueryInput, ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+	Scan(context.Context, *dynamodb.ScanInput, ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error)
+	TransactWriteItems(context.Context, *dynamodb.TransactWriteItemsInput, ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error)
+}
+
+// Store provides services for storing and retrieving data. It returns the same errors as the userstore package
+type Store struct {
+	client Client
+	table  string
+	// retention is the time soft deleted users are kept for before they are purged. When it is 0, users are deleted
+	// irrecoverably instead
+	retention time.Duration
+}
+
+type Monitor struct {
+	store *Store
+}
+
+func NewMonitor(store *Store) *Monitor {
+	return &Monitor{store: store}
+}
+
+func (m *Monitor) Name() string {
+	return "Datastore"
+}
+
+func (m *Monitor) Check(ctx context.Context) error {
+	_, err := m.store.client.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(m.store.table)})
+	return err
+}
+
+// New creates a new store in the table with the given name, which deletes users irrecoverably
+func New(client Client, table string) *Store {
+	return &Store{client: client, table: table}
+}
+
+// NewWithRetention creates a new store in the table with the given name which soft deletes users. Soft deleted users
+// are excluded from reads, can be restored with Restore until retention has passed, and are then deleted irrecoverably
+// by Purge
+func NewWithRetention(client Client, table string, retention time.Duration) *Store {
+	store := New(client, table)
+	store.retention = retention
+	return store
+}
+
+// globalIndexes are the indexes of the table
+var globalIndexes = []types.GlobalSecondaryIndex{
+	globalIndex(tenantIndex, tenantPKAttr, tenantSKAttr),
+	globalIndex(countryIndex, countryPKAttr, countrySKAttr),
+	globalIndex(updatedIndex, tenantPKAttr, updatedSKAttr),
+	globalIndex(lastNameIndex, tenantPKAttr, lastNameSKAttr),
+	globalIndex(nicknameIndex, tenantPKAttr, nicknameSKAttr),
+	globalIndex(outboxIndex, outboxPKAttr, outboxSKAttr),
+}
+
+// EnsureTable creates the table of the store and its indexes, if it does not exist, and waits for it to become
+// active. Indexes missing from an existing table, which was created by an earlier version of the store, are added to
+// it, and its records are rewritten so that they are held by them. As with userstore.Store.Migrate, creating the table
+// at startup could be problematic for a production service
+func (store *Store) EnsureTable(ctx context.Context) error {
+	attributes := []string{
+		pkAttr, skAttr, tenantPKAttr, tenantSKAttr, countryPKAttr, countrySKAttr, updatedSKAttr, lastNameSKAttr,
+		nicknameSKAttr, outboxPKAttr, outboxSKAttr,
+	}
+	definitions := make([]types.AttributeDefinition, 0, len(attributes))
+	for _, attribute := range attributes {
+		definitions = append(definitions, types.AttributeDefinition{
+			AttributeName: aws.String(attribute),
+			AttributeType: types.ScalarAttributeTypeS,
+		})
+	}
+	_, err := store.client.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName:              aws.String(store.table),
+		BillingMode:            types.BillingModePayPerRequest,
+		AttributeDefinitions:   definitions,
+		KeySchema:              keySchema(pkAttr, skAttr),
+		GlobalSecondaryIndexes: globalIndexes,
+	})
+	var inUse *types.ResourceInUseException
+	if err != nil && !errors.As(err, &inUse) {
+		return fmt.Errorf("cannot create table: %w", err)
+	}
+	waiter := dynamodb.NewTableExistsWaiter(store.client)
+	if err = waiter.Wait(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(store.table)}, tableTimeout); err != nil {
+		return fmt.Errorf("cannot wait for table: %w", err)
+	}
+	return store.addIndexes(ctx)
+}
+
+// addIndexes adds the indexes missing from the table, one at a time as DynamoDB requires, and waits for each to become
+// active. Records written before an index was added do not have its key, so every record is then rewritten
+func (store *Store) addIndexes(ctx context.Context) error {
+	out, err := store.client.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(store.table)})
+	if err != nil {
+		return fmt.Errorf("cannot describe table: %w", err)
+	}
+	existing := make(map[string]bool)
+	for _, index := range out.Table.GlobalSecondaryIndexes {
+		existing[aws.ToString(index.IndexName)] = true
+	}
+	added := false
+	for _, index := range globalIndexes {
+		if existing[aws.ToString(index.IndexName)] {
+			continue
+		}
+		// only the attributes of the keys of the new index are defined, since DynamoDB rejects those of no index
+		var definitions []types.AttributeDefinition
+		for _, key := range index.KeySchema {
+			definitions = append(definitions, types.AttributeDefinition{
+				AttributeName: key.AttributeName,
+				AttributeType: types.ScalarAttributeTypeS,
+			})
+		}
+		_, err = store.client.UpdateTable(ctx, &dynamodb.UpdateTableInput{
+			TableName:            aws.String(store.table),
+			AttributeDefinitions: definitions,
+			GlobalSecondaryIndexUpdates: []types.GlobalSecondaryIndexUpdate{{Create: &types.CreateGlobalSecondaryIndexAction{
+				IndexName:  index.IndexName,
+				KeySchema:  index.KeySchema,
+				Projection: index.Projection,
+			}}},
+		})
+		if err != nil {
+			return fmt.Errorf("cannot add index %s: %w", aws.ToString(index.IndexName), err)
+		}
+		if err = store.waitForIndexes(ctx); err != nil {
+			return err
+		}
+		added = true
+	}
+	if !added {
+		return nil
+	}
+	var ids []uuid.UUID
+	err = store.scanRecords(ctx, func(rec *userstore.Record) bool {
+		if memquery.IsLive(rec, rec.Tenant) {
+			ids = append(ids, rec.ID)
+		}
+		return true
+	})
+	if err == nil {
+		// writing a record unchanged sets the keys of every index it belongs in
+		_, err = store.changeEach(ctx, ids, func(*userstore.Record) error { return nil })
+	}
+	if err != nil {
+		return fmt.Errorf("cannot add records to new indexes: %w", err)
+	}
+	return nil
+}
+
+// waitForIndexes waits for every index of the table to become active, for up to tableTimeout
+func (store *Store) waitForIndexes(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, tableTimeout)
+	defer cancel()
+	for {
+		out, err := store.client.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(store.table)})
+		if err != nil {
+			return fmt.Errorf("cannot wait for indexes: %w", err)
+		}
+		active := true
+		for _, index := range out.Table.GlobalSecondaryIndexes {
+			active = active && index.IndexStatus == types.IndexStatusActive
+		}
+		if active {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("cannot wait for indexes: %w", ctx.Err())
+		case <-time.After(indexPollInterval):
+		}
+	}
+}
+
+// keySchema returns the key schema with the partition key pk and the sort key sk
+func keySchema(pk, sk string) []types.KeySchemaElement {
+	return []types.KeySchemaElement{
+		{AttributeName: aws.String(pk), KeyType: types.KeyTypeHash},
+		{AttributeName: aws.String(sk), KeyType: types.KeyTypeRange},
+	}
+}
+
+// globalIndex returns the index with the given name, keyed by pk and sk, which holds every attribute of the items it
+// indexes, so that records can be read from it
+func globalIndex(name, pk, sk string) types.GlobalSecondaryIndex {
+	return types.GlobalSecondaryIndex{
+		IndexName:  aws.String(name),
+		KeySchema:  keySchema(pk, sk),
+		Projection: &types.Projection{ProjectionType: types.ProjectionTypeAll},
+	}
+}
+
+func str(s string) types.AttributeValue {
+	return &types.AttributeValueMemberS{Value: s}
+}
+
+func num(n int64) types.AttributeValue {
+	return &types.AttributeValueMemberN{Value: strconv.FormatInt(n, 10)}
+}
+
+// stringOf returns the string held by the attribute name of item, or the empty string if it does not hold one
+func stringOf(item map[string]types.AttributeValue, name string) string {
+	if value, ok := item[name].(*types.AttributeValueMemberS); ok {
+		return value.Value
+	}
+	return ""
+}
+
+// timeText returns t as it is written in sort keys
+func timeText(t time.Time) string {
+	return t.UTC().Format(timeLayout)
+}
+
+// userKey returns the key of the item holding the record of the user with the given id
+func userKey(id uuid.UUID) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{pkAttr: str(userPrefix + id.String()), skAttr: str(userSK)}
+}
+
+// lookupKey returns the key of the lookup item holding value, of the given kind, for the tenant tenantID
+func lookupKey(kind lookupKind, tenantID, value string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{pkAttr: str(string(kind) + "#" + tenantID), skAttr: str(value)}
+}
+
+// lookups returns the values of each kind held by rec
+func lookups(rec *userstore.Record) map[lookupKind]string {
+	values := make(map[lookupKind]string)
+	if rec == nil {
+		return values
+	}
+	if rec.Data != nil {
+		// soft deleted users keep their email address and nickname until they are purged
+		values[emailLookup] = rec.Data.Email
+		values[nicknameLookup] = rec.Data.Nickname
+	}
+	if rec.IdempotencyKey != "" {
+		// records deleted irrecoverably keep their keys, so keys are never reused
+		values[keyLookup] = rec.IdempotencyKey
+	}
+	if rec.ResetToken != nil {
+		values[resetTokenLookup] = rec.ResetToken.Hash
+	}
+	if rec.EmailChange != nil {
+		values[emailChangeLookup] = rec.EmailChange.Hash
+	}
+	return values
+}
+
+// encodeRecord returns the item holding rec, written at the given revision. The keys of the indexes are only set on
+// the records each index is used to find
+func encodeRecord(rec *userstore.Record, revision int64) (map[string]types.AttributeValue, error) {
+	encoded, err := json.Marshal(rec)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode user record: %w", err)
+	}
+	item := userKey(rec.ID)
+	item[revisionAttr] = num(revision)
+	item[recordAttr] = str(string(encoded))
+	if memquery.IsLive(rec, rec.Tenant) {
+		created := timeText(rec.Data.CreatedAt) + "#" + rec.ID.String()
+		item[tenantPKAttr] = str(tenantPrefix + rec.Tenant)
+		item[tenantSKAttr] = str(created)
+		item[countryPKAttr] = str(tenantPrefix + rec.Tenant + "#" + rec.Data.Country)
+		item[countrySKAttr] = str(created)
+		item[updatedSKAttr] = str(timeText(rec.Data.UpdatedAt) + "#" + rec.ID.String())
+		item[lastNameSKAttr] = str(rec.Data.LastName + nameSeparator + rec.ID.String())
+		item[nicknameSKAttr] = str(rec.Data.Nickname + nameSeparator + rec.ID.String())
+	}
+	if len(rec.Events) > 0 {
+		item[outboxPKAttr] = str(outboxPartition)
+		item[outboxSKAttr] = str(timeText(rec.Events[0].UpdatedAt) + "#" + rec.ID.String())
+	}
+	return item, nil
+}
+
+// decodeRecord returns the record held by item, and the revision it was written at
+func decodeRecord(item map[string]types.AttributeValue) (*userstore.Record, int64, error) {
+	var rec userstore.Record
+	if err := json.Unmarshal([]byte(stringOf(item, recordAttr)), &rec); err != nil {
+		return nil, 0, fmt.Errorf("cannot decode user record: %w", err)
+	}
+	revision, ok := item[revisionAttr].(*types.AttributeValueMemberN)
+	if !ok {
+		return nil, 0, errors.New("cannot decode user record: it has no revision")
+	}
+	n, err := strconv.ParseInt(revision.Value, 10, 64)
+	if err != nil {
+		return nil, 0, fmt.Errorf("cannot decode revision of user record: %w", err)
+	}
+	for i := range rec.Events {
+		rec.Events[i].Tenant = rec.Tenant
+	}
+	return &rec, n, nil
+}
+
+// eventFor returns a pending event for a change to the user with the given id. The user is copied, so that later
+// changes to the record do not change the event
+func eventFor(action userstore.Action, id uuid.UUID, version int64, user *userstore.User) userstore.Event {
+	var data *userstore.User
+	if user != nil {
+		copied := *user
+		data = &copied
+	}
+	return userstore.Event{
+		ID:        id,
+		State:     userstore.Pending,
+		Action:    action,
+		Version:   version,
+		CreatedAt: utctime.Now(),
+		UpdatedAt: utctime.Now(),
+		Data:      data,
+	}
+}
+
+// addEvent adds an event for the current state of the user of rec to its outbox
+func addEvent(rec *userstore.Record, action userstore.Action) {
+	rec.Events = append(rec.Events, eventFor(action, rec.ID, rec.Data.Version, rec.Data))
+}
+
+// write writes rec, which was read at revision, and changes the lookup items of the values it holds from previous,
+// the values it held when it was read, in a single transaction. A revision of 0 writes a new record.
+// errChanged is returned if the record has been written since it was read, ErrAlreadyExists if it is new and a record
+// with the same id exists, and the error of lookupConflicts if another user holds one of its values
+func (store *Store) write(ctx context.Context, rec *userstore.Record, revision int64, previous map[lookupKind]string) error {
+	item, err := encodeRecord(rec, revision+1)
+	if err != nil {
+		return err
+	}
+	put := &types.Put{TableName: aws.String(store.table), Item: item}
+	// conflicts holds the error for the failure of the condition of each item written, in the same order
+	conflicts := []error{errChanged}
+	if revision == 0 {
+		put.ConditionExpression = aws.String("attribute_not_exists(#pk)")
+		put.ExpressionAttributeNames = map[string]string{"#pk": pkAttr}
+		conflicts[0] = userstore.ErrAlreadyExists
+	} else {
+		put.ConditionExpression = aws.String("#revision = :revision")
+		put.ExpressionAttributeNames = map[string]string{"#revision": revisionAttr}
+		put.ExpressionAttributeValues = map[string]types.AttributeValue{":revision": num(revision)}
+	}
+	items := []types.TransactWriteItem{{Put: put}}
+
+	current := lookups(rec)
+	for _, kind := range lookupKinds {
+		if previous[kind] == current[kind] {
+			continue
+		}
+		if previous[kind] != "" {
+			items = append(items, types.TransactWriteItem{Delete: &types.Delete{
+				TableName: aws.String(store.table),
+				Key:       lookupKey(kind, rec.Tenant, previous[kind]),
+			}})
+			conflicts = append(conflicts, nil)
+		}
+		if current[kind] != "" {
+			lookup := lookupKey(kind, rec.Tenant, current[kind])
+			lookup[userIDAttr] = str(rec.ID.String())
+			items = append(items, types.TransactWriteItem{Put: &types.Put{
+				TableName:                aws.String(store.table),
+				Item:                     lookup,
+				ConditionExpression:      aws.String("attribute_not_exists(#pk)"),
+				ExpressionAttributeNames: map[string]string{"#pk": pkAttr},
+			}})
+			conflicts = append(conflicts, lookupConflicts[kind])
+		}
+	}
+
+	_, err = store.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: items})
+	var canceled *types.TransactionCanceledException
+	if errors.As(err, &canceled) {
+		for i, reason := range canceled.CancellationReasons {
+			if aws.ToString(reason.Code) == conditionalCheckFailed && i < len(conflicts) && conflicts[i] != nil {
+				return conflicts[i]
+			}
+		}
+		// the transaction conflicted with another transaction writing the same items
+		return errChanged
+	}
+	if err != nil {
+		return fmt.Errorf("cannot write user record: %w", err)
+	}
+	return nil
+}
+
+// getRecord reads the record of the user with the given id, whichever tenant they belong to, and the revision it was
+// written at. It returns a nil record if there is none
+func (store *Store) getRecord(ctx context.Context, id uuid.UUID) (*userstore.Record, int64, error) {
+	out, err := store.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(store.table),
+		Key:            userKey(id),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("cannot read user record: %w", err)
+	}
+	if out.Item == nil {
+		return nil, 0, nil
+	}
+	return decodeRecord(out.Item)
+}
+
+// user reads the record of the user of the tenant of ctx with the given id, returning a nil record if there is no
+// such user or they have been deleted
+func (store *Store) user(ctx context.Context, id uuid.UUID) (*userstore.Record, int64, error) {
+	rec, revision, err := store.getRecord(ctx, id)
+	if err != nil || rec == nil || !memquery.IsLive(rec, tenant.FromContext(ctx)) {
+		return nil, 0, err
+	}
+	return rec, revision, nil
+}
+
+// lookup reads the record of the user of the tenant of ctx holding value, of the given kind. It returns a nil record
+// if no user holds it
+func (store *Store) lookup(ctx context.Context, kind lookupKind, value string) (*userstore.Record, int64, error) {
+	tenantID := tenant.FromContext(ctx)
+	out, err := store.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(store.table),
+		Key:            lookupKey(kind, tenantID, value),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("cannot read user record: %w", err)
+	}
+	if out.Item == nil {
+		return nil, 0, nil
+	}
+	id, err := uuid.Parse(stringOf(out.Item, userIDAttr))
+	if err != nil {
+		return nil, 0, fmt.Errorf("cannot read id of user record: %w", err)
+	}
+	rec, revision, err := store.getRecord(ctx, id)
+	if err != nil || rec == nil || rec.Tenant != tenantID {
+		return nil, 0, err
+	}
+	return rec, revision, nil
+}
+
+// modify calls apply with the record read by find, and writes it if apply returns nil. If the record is changed by
+// another caller before it is written, it is read and apply is called again. notFound is returned if find returns a
+// nil record, and errUnchanged if apply returns it
+func (store *Store) modify(ctx context.Context, find func(context.Context) (*userstore.Record, int64, error), notFound error, apply func(*userstore.Record) error) error {
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		rec, revision, err := find(ctx)
+		if err != nil {
+			return err
+		}
+		if rec == nil {
+			return notFound
+		}
+		previous := lookups(rec)
+		if err = apply(rec); err != nil {
+			return err
+		}
+		if err = store.write(ctx, rec, revision, previous); !errors.Is(err, errChanged) {
+			return err
+		}
+	}
+	return fmt.Errorf("cannot change user record after %d attempts: %w", maxAttempts, errChanged)
+}
+
+// modifyUser is modify for the user of the tenant of ctx with the given id. ErrNotFound is returned if there is no
+// such user
+func (store *Store) modifyUser(ctx context.Context, id uuid.UUID, apply func(*userstore.Record) error) error {
+	find := func(ctx context.Context) (*userstore.Record, int64, error) { return store.user(ctx, id) }
+	return store.modify(ctx, find, userstore.ErrNotFound, apply)
+}
+
+// insert writes a new record for user, with the event for its creation. ErrAlreadyExists is returned if a record with
+// the same id exists, and ErrEmailInUse or ErrNicknameInUse if the email address or nickname is used by another user
+func (store *Store) insert(ctx context.Context, user *userstore.User, key string) error {
+	usr := *user
+	rec := &userstore.Record{ID: usr.ID, Data: &usr, IdempotencyKey: key, Tenant: tenant.FromContext(ctx)}
+	if key != "" {
+		rec.IdempotencyHash = userstore.PayloadHash(&usr)
+	}
+	addEvent(rec, userstore.Created)
+	return store.write(ctx, rec, 0, nil)
+}
+
+// Create creates a new user record for the tenant of ctx. ErrEmailInUse or ErrNicknameInUse is returned if the
+// email address or nickname is used by another user
+func (store *Store) Create(ctx context.Context, user *userstore.User) (userstore.User, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "CreateUserRecord")
+	defer span.End()
+	if err := store.insert(ctx, user, ""); err != nil {
+		span.RecordError(err)
+		return *user, err
+	}
+	return *user, nil
+}
+
+// CreateMany creates a batch of new user records. Users which conflict with an existing user, or with another user in
+// the batch, are not created, but do not prevent the others from being created. Each user is written in a transaction
+// of its own, since their lookup items must be written with them.
+// It returns an error for each user, in the same order as users, which is nil if the user was created and
+// ErrEmailInUse or ErrNicknameInUse if it conflicted. An error is returned instead if a user could not be stored at all,
+// in which case the users before it have been created
+func (store *Store) CreateMany(ctx context.Context, users []userstore.User) ([]error, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "CreateManyUserRecords")
+	defer span.End()
+	errs := make([]error, len(users))
+	for i := range users {
+		err := store.insert(ctx, &users[i], "")
+		switch {
+		case errors.Is(err, userstore.ErrAlreadyExists):
+			errs[i] = err
+		case err != nil:
+			span.RecordError(err)
+			return nil, err
+		}
+	}
+	return errs, nil
+}
+
+// CreateWithKey creates a new user record, storing the idempotency key with it.
+// If a user has already been created with the same key, that user is returned instead of creating another.
+// ErrAlreadyExists is returned if the key has been used for a user which has since been deleted,
+// ErrIdempotencyKeyReused if it was used for a user created with different details, and ErrEmailInUse or
+// ErrNicknameInUse if the email address or nickname is used by another user
+func (store *Store) CreateWithKey(ctx context.Context, user *userstore.User, key string) (userstore.User, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "CreateUserRecordWithKey")
+	defer span.End()
+	err := store.insert(ctx, user, key)
+	if err == nil {
+		return *user, nil
+	}
+	span.RecordError(err)
+	if !errors.Is(err, userstore.ErrAlreadyExists) {
+		return *user, err
+	}
+	original, _, readErr := store.lookup(ctx, keyLookup, key)
+	switch {
+	case readErr != nil:
+		span.RecordError(readErr)
+		return *user, fmt.Errorf("cannot read user record created with the same key: %w", readErr)
+	case original == nil:
+		// the conflict was with the email or nickname of another user
+		return *user, err
+	case !memquery.IsLive(original, original.Tenant):
+		return *user, userstore.ErrAlreadyExists
+	case !original.SamePayload(user):
+		return *user, userstore.ErrIdempotencyKeyReused
+	}
+	return *original.Data, nil
+}
+
+// ReadOne reads a single user record of the tenant of ctx by ID. Soft deleted records are not read
+func (store *Store) ReadOne(ctx context.Context, id uuid.UUID) (user userstore.User, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "ReadOneRecord")
+	defer span.End()
+	rec, _, err := store.user(ctx, id)
+	if err != nil {
+		span.RecordError(err)
+		return user, err
+	}
+	if rec == nil {
+		span.RecordError(userstore.ErrNotFound)
+		return user, userstore.ErrNotFound
+	}
+	return *rec.Data, nil
+}
+
+// ReadMany reads the users of the tenant of ctx with the given IDs, in the order of ids. The user of an id which does
+// not exist or has been deleted is the zero User, whose ID is uuid.Nil. Each user is read separately
+func (store *Store) ReadMany(ctx context.Context, ids []uuid.UUID) ([]userstore.User, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "ReadManyRecords")
+	defer span.End()
+	users := make([]userstore.User, 0, len(ids))
+	for _, id := range ids {
+		rec, _, err := store.user(ctx, id)
+		if err != nil {
+			span.RecordError(err)
+			return nil, err
+		}
+		var usr userstore.User
+		if rec != nil {
+			usr = *rec.Data
+		}
+		users = append(users, usr)
+	}
+	return users, nil
+}
+
+// ReadRecord reads the whole record of a single user of the tenant of ctx by ID, including its pending events.
+// Unlike ReadOne, soft deleted records are read. ErrNotFound is returned if the record does not exist or has been
+// deleted irrecoverably
+func (store *Store) ReadRecord(ctx context.Context, id uuid.UUID) (rec userstore.Record, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "ReadRecord")
+	defer span.End()
+	stored, _, err := store.getRecord(ctx, id)
+	if err != nil {
+		span.RecordError(err)
+		return rec, err
+	}
+	if stored == nil || stored.Tenant != tenant.FromContext(ctx) || stored.Data == nil {
+		span.RecordError(userstore.ErrNotFound)
+		return rec, userstore.ErrNotFound
+	}
+	return *stored, nil
+}
+
+// FindByEmail reads a single user record by email address
+func (store *Store) FindByEmail(ctx context.Context, email string) (user userstore.User, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "FindByEmail")
+	defer span.End()
+	return store.findOne(ctx, emailLookup, email)
+}
+
+// FindByNickname reads a single user record by nickname
+func (store *Store) FindByNickname(ctx context.Context, nickname string) (user userstore.User, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "FindByNickname")
+	defer span.End()
+	return store.findOne(ctx, nicknameLookup, nickname)
+}
+
+// findOne reads the user of the tenant of ctx holding value, of the given kind, unless they have been soft deleted
+func (store *Store) findOne(ctx context.Context, kind lookupKind, value string) (user userstore.User, err error) {
+	span := trace.SpanFromContext(ctx)
+	rec, _, err := store.lookup(ctx, kind, value)
+	if err != nil {
+		span.RecordError(err)
+		return user, err
+	}
+	if rec == nil || !memquery.IsLive(rec, rec.Tenant) {
+		span.RecordError(userstore.ErrNotFound)
+		return user, userstore.ErrNotFound
+	}
+	return *rec.Data, nil
+}
+
+// EmailExists returns true if a user of the tenant of ctx has the email address email. Soft deleted users are
+// included, since their email addresses are not released until they are purged
+func (store *Store) EmailExists(ctx context.Context, email string) (bool, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "EmailExists")
+	defer span.End()
+	return store.exists(ctx, emailLookup, email)
+}
+
+// NicknameExists returns true if a user of the tenant of ctx has the nickname nickname. Soft deleted users are
+// included, since their nicknames are not released until they are purged
+func (store *Store) NicknameExists(ctx context.Context, nickname string) (bool, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "NicknameExists")
+	defer span.End()
+	return store.exists(ctx, nicknameLookup, nickname)
+}
+
+// exists returns true if a user of the tenant of ctx holds value, of the given kind
+func (store *Store) exists(ctx context.Context, kind lookupKind, value string) (bool, error) {
+	span := trace.SpanFromContext(ctx)
+	out, err := store.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(store.table),
+		Key:            lookupKey(kind, tenant.FromContext(ctx), value),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		span.RecordError(err)
+		return false, fmt.Errorf("cannot read user record: %w", err)
+	}
+	return out.Item != nil, nil
+}
+
+// ChangePassword updates a single user record, unless the provided update is stale.
+// The event for the change has the PasswordChanged action
+func (store *Store) ChangePassword(ctx context.Context, update *userstore.User) (user userstore.User, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "ChangePassword")
+	defer span.End()
+	return store.update(ctx, update, userstore.PasswordChanged)
+}
+
+// Anonymize updates a single user record, unless the provided update is stale. Unlike other updates, the nickname
+// and email address are also replaced, along with any password reset token or email change, two factor
+// authentication is turned off, previous nicknames are removed, and the event for the change has the Anonymized action
+func (store *Store) Anonymize(ctx context.Context, update *userstore.User) (user userstore.User, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "AnonymizeRecord")
+	defer span.End()
+	return store.update(ctx, update, userstore.Anonymized)
+}
+
+// ChangeStatus changes the status of a single user record to the status of update, unless the provided update is
+// stale. The event for the change has the Suspended, Reactivated, Banned or MarkedDormant action, for the suspended,
+// active, banned and dormant statuses respectively. It returns ErrInvalidStatus for any other status
+func (store *Store) ChangeStatus(ctx context.Context, update *userstore.User) (user userstore.User, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "ChangeStatus")
+	defer span.End()
+	action, ok := statusActions[update.Status]
+	if !ok {
+		span.RecordError(userstore.ErrInvalidStatus)
+		return user, userstore.ErrInvalidStatus
+	}
+	return store.update(ctx, update, action)
+}
+
+// update updates a single user record, unless the provided update is stale, and adds an event with the given action.
+// Changing the password also removes any password reset token, since it was issued for the old password
+func (store *Store) update(ctx context.Context, update *userstore.User, action userstore.Action) (user userstore.User, err error) {
+	span := trace.SpanFromContext(ctx)
+	err = store.modifyUser(ctx, update.ID, func(rec *userstore.Record) error {
+		usr := rec.Data
+		if usr.Version != update.Version {
+			return userstore.ErrInvalidVersion
+		}
+		usr.FirstName = update.FirstName
+		usr.LastName = update.LastName
+		usr.PasswordHash = update.PasswordHash
+		usr.Country = update.Country
+		usr.CreatedAt = update.CreatedAt
+		usr.UpdatedAt = update.UpdatedAt
+		usr.Version += 1
+		switch action {
+		case userstore.PasswordChanged:
+			rec.ResetToken = nil
+		case userstore.Anonymized:
+			usr.Nickname = update.Nickname
+			usr.Email = update.Email
+			usr.AvatarURL = update.AvatarURL
+			usr.TwoFactorEnabled = false
+			rec.ResetToken = nil
+			rec.EmailChange = nil
+			rec.TwoFactor = nil
+			rec.PreviousNicknames = nil
+		}
+		if action == statusActions[update.Status] {
+			usr.Status = update.Status
+		}
+		addEvent(rec, action)
+		user = *usr
+		return nil
+	})
+	if err != nil {
+		span.RecordError(err)
+		return userstore.User{}, err
+	}
+	return user, nil
+}
+
+// UpdateFields applies change to the user of the tenant of ctx with the given id, unless version is stale, and adds
+// an event with the Updated action. The change is applied to the record as it was read, and the record is only
+// written if it has not changed since, so concurrent changes to other fields are not overwritten. ErrNotFound is
+// returned if there is no such user, and ErrInvalidVersion if version is stale
+func (store *Store) UpdateFields(ctx context.Context, id uuid.UUID, version int64, change *userstore.Change) (user userstore.User, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "UpdateFields")
+	defer span.End()
+	err = store.modifyUser(ctx, id, func(rec *userstore.Record) error {
+		usr := rec.Data
+		if usr.Version != version {
+			return userstore.ErrInvalidVersion
+		}
+		for field, value := range map[*string]*string{
+			&usr.FirstName:    change.FirstName,
+			&usr.LastName:     change.LastName,
+			&usr.PasswordHash: change.PasswordHash,
+			&usr.Country:      change.Country,
+			&usr.AvatarURL:    change.AvatarURL,
+		} {
+			if value != nil {
+				*field = *value
+			}
+		}
+		usr.UpdatedAt = change.UpdatedAt
+		usr.Version += 1
+		addEvent(rec, userstore.Updated)
+		user = *usr
+		return nil
+	})
+	if err != nil {
+		span.RecordError(err)
+		return userstore.User{}, err
+	}
+	return user, nil
+}
+
+// RecordLogin records that the user of the tenant of ctx with the given id authenticated at the given time, which is
+// also the last time they were seen. ErrNotFound is returned if there is no such user
+func (store *Store) RecordLogin(ctx context.Context, id uuid.UUID, at time.Time) error {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "RecordLogin")
+	defer span.End()
+	err := store.modifyUser(ctx, id, func(rec *userstore.Record) error {
+		rec.Data.LastLoginAt = latest(rec.Data.LastLoginAt, at)
+		rec.Data.LastSeenAt = latest(rec.Data.LastSeenAt, at)
+		return nil
+	})
+	if err != nil {
+		span.RecordError(err)
+	}
+	return err
+}
+
+// TouchLastSeen records that the user of the tenant of ctx with the given id was active at the given time.
+// ErrNotFound is returned if there is no such user
+func (store *Store) TouchLastSeen(ctx context.Context, id uuid.UUID, at time.Time) error {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "TouchLastSeen")
+	defer span.End()
+	err := store.modifyUser(ctx, id, func(rec *userstore.Record) error {
+		rec.Data.LastSeenAt = latest(rec.Data.LastSeenAt, at)
+		return nil
+	})
+	if err != nil {
+		span.RecordError(err)
+	}
+	return err
+}
+
+// latest returns the later of a and b. Activity is not a change to the user, so recording it does not change the
+// version or add an event, and the times never move backwards
+func latest(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
+
+// BeginTwoFactor stores the sealed secret of a new two factor authentication enrollment of the user of the tenant of
+// ctx with the given id, replacing any enrollment which has not been confirmed. The user is not changed until the
+// enrollment is confirmed, so the version is not changed and no event is added. ErrNotFound is returned if there is
+// no such user, and ErrTwoFactorEnabled if the user already has two factor authentication enabled
+func (store *Store) BeginTwoFactor(ctx context.Context, id uuid.UUID, pendingSecret string) error {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "BeginTwoFactor")
+	defer span.End()
+	err := store.modifyUser(ctx, id, func(rec *userstore.Record) error {
+		if rec.Data.TwoFactorEnabled {
+			return userstore.ErrTwoFactorEnabled
+		}
+		rec.TwoFactor = &userstore.TwoFactor{PendingSecret: pendingSecret}
+		return nil
+	})
+	if err != nil {
+		span.RecordError(err)
+	}
+	return err
+}
+
+// EnableTwoFactor confirms the enrollment with the sealed secret pendingSecret of the user of the tenant of ctx with
+// the given id. The secret becomes the secret of the user, the code with the time step step is recorded as used,
+// and recoveryCodes, which are hashes, are stored. The event for the change has the TwoFactorEnabled action.
+// ErrNotFound is returned if there is no such user, and ErrTwoFactorNotPending if the enrollment has been replaced
+// or confirmed since it was read
+func (store *Store) EnableTwoFactor(ctx context.Context, id uuid.UUID, pendingSecret string, step int64, recoveryCodes []string) (user userstore.User, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "EnableTwoFactor")
+	defer span.End()
+	err = store.modifyUser(ctx, id, func(rec *userstore.Record) error {
+		if rec.TwoFactor == nil || rec.TwoFactor.PendingSecret != pendingSecret {
+			return userstore.ErrTwoFactorNotPending
+		}
+		usr := rec.Data
+		usr.TwoFactorEnabled = true
+		usr.UpdatedAt = utctime.Now()
+		usr.Version += 1
+		rec.TwoFactor = &userstore.TwoFactor{Secret: pendingSecret, LastStep: step, RecoveryCodes: recoveryCodes}
+		addEvent(rec, userstore.TwoFactorEnabled)
+		user = *usr
+		return nil
+	})
+	if err != nil {
+		span.RecordError(err)
+		return userstore.User{}, err
+	}
+	return user, nil
+}
+
+// DisableTwoFactor turns two factor authentication off for the user of the tenant of ctx with the given id, and
+// removes its secrets. The event for the change has the TwoFactorDisabled action. ErrNotFound is returned if there
+// is no such user, and ErrTwoFactorNotEnabled if the user does not have two factor authentication enabled
+func (store *Store) DisableTwoFactor(ctx context.Context, id uuid.UUID) (user userstore.User, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "DisableTwoFactor")
+	defer span.End()
+	err = store.modifyUser(ctx, id, func(rec *userstore.Record) error {
+		usr := rec.Data
+		if !usr.TwoFactorEnabled {
+			return userstore.ErrTwoFactorNotEnabled
+		}
+		usr.TwoFactorEnabled = false
+		usr.UpdatedAt = utctime.Now()
+		usr.Version += 1
+		rec.TwoFactor = nil
+		addEvent(rec, userstore.TwoFactorDisabled)
+		user = *usr
+		return nil
+	})
+	if err != nil {
+		span.RecordError(err)
+		return userstore.User{}, err
+	}
+	return user, nil
+}
+
+// UseTwoFactorStep records that a code with the time step step has been accepted for the user of the tenant of ctx
+// with the given id. ErrTwoFactorCodeRejected is returned if a code with the same or a later step has already been
+// accepted, so that codes cannot be replayed, or the user does not have two factor authentication enabled
+func (store *Store) UseTwoFactorStep(ctx context.Context, id uuid.UUID, step int64) error {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "UseTwoFactorStep")
+	defer span.End()
+	return store.useTwoFactorCode(ctx, id, func(twoFactor *userstore.TwoFactor) bool {
+		if twoFactor.LastStep >= step {
+			return false
+		}
+		twoFactor.LastStep = step
+		return true
+	})
+}
+
+// UseRecoveryCode removes the recovery code with the hash codeHash from the user of the tenant of ctx with the given
+// id, so that it cannot be used again. ErrTwoFactorCodeRejected is returned if the user does not have the code
+func (store *Store) UseRecoveryCode(ctx context.Context, id uuid.UUID, codeHash string) error {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "UseRecoveryCode")
+	defer span.End()
+	return store.useTwoFactorCode(ctx, id, func(twoFactor *userstore.TwoFactor) bool {
+		for i, code := range twoFactor.RecoveryCodes {
+			if code == codeHash {
+				twoFactor.RecoveryCodes = append(twoFactor.RecoveryCodes[:i], twoFactor.RecoveryCodes[i+1:]...)
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// useTwoFactorCode calls use with the two factor authentication state of the user with the given id, if they have
+// two factor authentication enabled, returning ErrTwoFactorCodeRejected unless use returns true. Using a code does
+// not change the user, so the version is not changed and no event is added. Since the record is only written if it
+// has not changed since it was read, a code cannot be used twice by concurrent callers
+func (store *Store) useTwoFactorCode(ctx context.Context, id uuid.UUID, use func(*userstore.TwoFactor) bool) error {
+	span := trace.SpanFromContext(ctx)
+	err := store.modifyUser(ctx, id, func(rec *userstore.Record) error {
+		if !rec.Data.TwoFactorEnabled || rec.TwoFactor == nil || !use(rec.TwoFactor) {
+			return userstore.ErrTwoFactorCodeRejected
+		}
+		return nil
+	})
+	if err != nil {
+		span.RecordError(err)
+	}
+	return err
+}
+
+// RequestPasswordReset stores a password reset token for the user of the tenant of ctx with the given id, replacing
+// any token issued before. The record stores reset, which holds the hash of token, and a PasswordResetRequested event
+// which carries token itself so that it can be sent to the user
+func (store *Store) RequestPasswordReset(ctx context.Context, id uuid.UUID, token string, reset userstore.ResetToken) error {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "RequestPasswordReset")
+	defer span.End()
+	err := store.modifyUser(ctx, id, func(rec *userstore.Record) error {
+		rec.ResetToken = &reset
+		evt := eventFor(userstore.PasswordResetRequested, rec.ID, rec.Data.Version, rec.Data)
+		evt.Token = token
+		rec.Events = append(rec.Events, evt)
+		return nil
+	})
+	if err != nil {
+		span.RecordError(err)
+	}
+	return err
+}
+
+// ResetPassword sets the password hash of the user of the tenant of ctx holding an unexpired reset token with the
+// hash tokenHash, and removes the token so that it cannot be used again. The event for the change has the
+// PasswordChanged action. ErrInvalidResetToken is returned if no user holds a matching token
+func (store *Store) ResetPassword(ctx context.Context, tokenHash, passwordHash string) (user userstore.User, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "ResetPassword")
+	defer span.End()
+	now := utctime.Now()
+	find := func(ctx context.Context) (*userstore.Record, int64, error) {
+		rec, revision, err := store.lookup(ctx, resetTokenLookup, tokenHash)
+		if err != nil || rec == nil || !memquery.IsLive(rec, rec.Tenant) || rec.ResetToken == nil ||
+			rec.ResetToken.Hash != tokenHash || !rec.ResetToken.ExpiresAt.After(now) {
+			return nil, 0, err
+		}
+		return rec, revision, nil
+	}
+	err = store.modify(ctx, find, userstore.ErrInvalidResetToken, func(rec *userstore.Record) error {
+		usr := rec.Data
+		usr.PasswordHash = passwordHash
+		usr.UpdatedAt = utctime.Now()
+		usr.Version += 1
+		rec.ResetToken = nil
+		addEvent(rec, userstore.PasswordChanged)
+		user = *usr
+		return nil
+	})
+	if err != nil {
+		span.RecordError(err)
+		return userstore.User{}, err
+	}
+	return user, nil
+}
+
+// RequestEmailChange stores a change of email address for the user of the tenant of ctx with the given id, unless the
+// provided version is stale, replacing any change requested before. The record stores change, which holds the hash of
+// token, and an EmailChangeRequested event which carries token itself so that it can be sent to the new address
+func (store *Store) RequestEmailChange(ctx context.Context, id uuid.UUID, version int64, token string, change userstore.EmailChange) error {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "RequestEmailChange")
+	defer span.End()
+	err := store.modifyUser(ctx, id, func(rec *userstore.Record) error {
+		if rec.Data.Version != version {
+			return userstore.ErrInvalidVersion
+		}
+		rec.EmailChange = &change
+		evt := eventFor(userstore.EmailChangeRequested, rec.ID, rec.Data.Version, rec.Data)
+		evt.Token = token
+		evt.Email = change.Email
+		rec.Events = append(rec.Events, evt)
+		return nil
+	})
+	if err != nil {
+		span.RecordError(err)
+	}
+	return err
+}
+
+// ConfirmEmailChange sets the email address of the user of the tenant of ctx with an unexpired email change with
+// the token hash tokenHash to the new address, and removes the change so that it cannot be confirmed again. The
+// lookup item of the new address is written with the change, so ErrEmailInUse is returned if another user has taken
+// the address since the change was requested. ErrInvalidEmailChangeToken is returned if no user has a matching change
+func (store *Store) ConfirmEmailChange(ctx context.Context, tokenHash string) (user userstore.User, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "ConfirmEmailChange")
+	defer span.End()
+	now := utctime.Now()
+	find := func(ctx context.Context) (*userstore.Record, int64, error) {
+		rec, revision, err := store.lookup(ctx, emailChangeLookup, tokenHash)
+		if err != nil || rec == nil || !memquery.IsLive(rec, rec.Tenant) || rec.EmailChange == nil ||
+			rec.EmailChange.Hash != tokenHash || !rec.EmailChange.ExpiresAt.After(now) {
+			return nil, 0, err
+		}
+		return rec, revision, nil
+	}
+	err = store.modify(ctx, find, userstore.ErrInvalidEmailChangeToken, func(rec *userstore.Record) error {
+		usr := rec.Data
+		usr.Email = rec.EmailChange.Email
+		usr.UpdatedAt = utctime.Now()
+		usr.Version += 1
+		rec.EmailChange = nil
+		addEvent(rec, userstore.EmailChanged)
+		user = *usr
+		return nil
+	})
+	if err != nil {
+		span.RecordError(err)
+		return userstore.User{}, err
+	}
+	return user, nil
+}
+
+// ChangeNickname changes the nickname of the user of the tenant of ctx with the given id, unless version is stale,
+// adds the current nickname to the previous nicknames of the user and adds an event with the NicknameChanged action.
+// ErrNotFound is returned if there is no such user, ErrInvalidVersion if version is stale, ErrNicknameChangeTooSoon
+// if the nickname was last changed less than cooldown ago, and ErrNicknameInUse if another user has the nickname
+func (store *Store) ChangeNickname(ctx context.Context, id uuid.UUID, version int64, nickname string, cooldown time.Duration) (user userstore.User, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "ChangeNickname")
+	defer span.End()
+	err = store.modifyUser(ctx, id, func(rec *userstore.Record) error {
+		usr := rec.Data
+		if usr.Version != version {
+			return userstore.ErrInvalidVersion
+		}
+		now := utctime.Now()
+		if n := len(rec.PreviousNicknames); n > 0 && rec.PreviousNicknames[n-1].ChangedAt.After(now.Add(-cooldown)) {
+			return userstore.ErrNicknameChangeTooSoon
+		}
+		rec.PreviousNicknames = append(rec.PreviousNicknames, userstore.PreviousNickname{Nickname: usr.Nickname, ChangedAt: now})
+		usr.Nickname = nickname
+		usr.UpdatedAt = now
+		usr.Version += 1
+		addEvent(rec, userstore.NicknameChanged)
+		user = *usr
+		return nil
+	})
+	if err != nil {
+		span.RecordError(err)
+		return userstore.User{}, err
+	}
+	return user, nil
+}
+
+// DeleteOne deletes a single user record. It is soft deleted if the store was created with NewWithRetention
+func (store *Store) DeleteOne(ctx context.Context, id uuid.UUID) error {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "DeleteOneRecord")
+	defer span.End()
+	err := store.modifyUser(ctx, id, func(rec *userstore.Record) error {
+		store.remove(rec)
+		return nil
+	})
+	if err != nil {
+		span.RecordError(err)
+	}
+	return err
+}
+
+// remove deletes rec. Soft deletes keep the data of the record, so that it can be restored, and irrecoverable deletes
+// keep the record without its data until its events are processed, which releases its email address and nickname.
+// Either way, the event for the deletion does not carry the data, only the email address of the user, so that the
+// deletion can be confirmed to them
+func (store *Store) remove(rec *userstore.Record) {
+	evt := eventFor(userstore.Deleted, rec.ID, math.MaxInt64, nil)
+	evt.Email = rec.Data.Email
+	if store.retention > 0 {
+		deletedAt := utctime.Now()
+		rec.DeletedAt = &deletedAt
+	} else {
+		rec.Data = nil
+		rec.ResetToken = nil
+		rec.EmailChange = nil
+	}
+	rec.Events = append(rec.Events, evt)
+}
+
+// DeleteMany deletes the user records with the given IDs and returns the IDs of the deleted records.
+// IDs of records which do not exist or are already deleted are not returned. As with DeleteOne, records are soft
+// deleted if the store was created with NewWithRetention. Each record is deleted in a transaction of its own, so an
+// error part way through leaves the records before it deleted
+func (store *Store) DeleteMany(ctx context.Context, ids []uuid.UUID) ([]uuid.UUID, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "DeleteManyRecords")
+	defer span.End()
+	var deleted []uuid.UUID
+	for _, id := range ids {
+		err := store.modifyUser(ctx, id, func(rec *userstore.Record) error {
+			store.remove(rec)
+			return nil
+		})
+		switch {
+		case errors.Is(err, userstore.ErrNotFound):
+		case err != nil:
+			span.RecordError(err)
+			return nil, err
+		default:
+			deleted = append(deleted, id)
+		}
+	}
+	return deleted, nil
+}
+
+// Restore restores the soft deleted user record of the tenant of ctx with the given ID, if it was deleted less than
+// the retention of the store ago. The event for the restore has the Restored action, and the version of the user is
+// incremented. ErrNotFound is returned if there is no such record, which is always the case for stores which delete
+// users irrecoverably
+func (store *Store) Restore(ctx context.Context, id uuid.UUID) (user userstore.User, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "RestoreRecord")
+	defer span.End()
+	cutoff := utctime.Now().Add(-store.retention)
+	find := func(ctx context.Context) (*userstore.Record, int64, error) {
+		rec, revision, err := store.getRecord(ctx, id)
+		if err != nil || rec == nil || rec.Tenant != tenant.FromContext(ctx) || rec.Data == nil ||
+			rec.DeletedAt == nil || !rec.DeletedAt.After(cutoff) {
+			return nil, 0, err
+		}
+		return rec, revision, nil
+	}
+	err = store.modify(ctx, find, userstore.ErrNotFound, func(rec *userstore.Record) error {
+		usr := rec.Data
+		usr.UpdatedAt = utctime.Now()
+		usr.Version += 1
+		rec.DeletedAt = nil
+		addEvent(rec, userstore.Restored)
+		user = *usr
+		return nil
+	})
+	if err != nil {
+		span.RecordError(err)
+		return userstore.User{}, err
+	}
+	return user, nil
+}
+
+// Replay adds an event with the Replayed action carrying the current state of the user of the tenant of ctx with the
+// given id, without changing the user or its version. ErrNotFound is returned if there is no such user
+func (store *Store) Replay(ctx context.Context, id uuid.UUID) (user userstore.User, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "ReplayRecord")
+	defer span.End()
+	err = store.modifyUser(ctx, id, func(rec *userstore.Record) error {
+		addEvent(rec, userstore.Replayed)
+		user = *rec.Data
+		return nil
+	})
+	if err != nil {
+		span.RecordError(err)
+		return userstore.User{}, err
+	}
+	return user, nil
+}
+
+// scanRecords calls visit with each record of every tenant, until it returns false. Every item of the table is read,
+// so it is only suitable for occasional maintenance
+func (store *Store) scanRecords(ctx context.Context, visit func(*userstore.Record) bool) error {
+	input := &dynamodb.ScanInput{
+		TableName:                 aws.String(store.table),
+		FilterExpression:          aws.String("#sk = :sk"),
+		ExpressionAttributeNames:  map[string]string{"#sk": skAttr},
+		ExpressionAttributeValues: map[string]types.AttributeValue{":sk": str(userSK)},
+	}
+	for {
+		out, err := store.client.Scan(ctx, input)
+		if err != nil {
+			return fmt.Errorf("cannot scan user records: %w", err)
+		}
+		for _, item := range out.Items {
+			rec, _, err := decodeRecord(item)
+			if err != nil {
+				return err
+			}
+			if !visit(rec) {
+				return nil
+			}
+		}
+		if len(out.LastEvaluatedKey) == 0 {
+			return nil
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+}
+
+// changeEach applies apply to the record of each of ids, as it is when it is written, returning the number of records
+// changed. A record for which apply returns errUnchanged, since it has been changed by another caller since it was
+// found, is skipped
+func (store *Store) changeEach(ctx context.Context, ids []uuid.UUID, apply func(*userstore.Record) error) (int64, error) {
+	var changed int64
+	for _, id := range ids {
+		id := id
+		find := func(ctx context.Context) (*userstore.Record, int64, error) { return store.getRecord(ctx, id) }
+		err := store.modify(ctx, find, errUnchanged, apply)
+		switch {
+		case errors.Is(err, errUnchanged):
+		case err != nil:
+			return changed, err
+		default:
+			changed += 1
+		}
+	}
+	return changed, nil
+}
+
+// Purge irrecoverably deletes the records of every tenant which were soft deleted more than the retention of the store
+// ago, returning the number of records purged. No events are added, since the deletions have already been published
+func (store *Store) Purge(ctx context.Context) (int64, error) {
+	if store.retention == 0 {
+		return 0, nil
+	}
+	return store.PurgeDeletedBefore(ctx, utctime.Now().Add(-store.retention))
+}
+
+// PurgeDeletedBefore irrecoverably deletes the records of every tenant which were soft deleted at or before cutoff,
+// returning the number of records purged. Every record is read to find them
+func (store *Store) PurgeDeletedBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "PurgeRecords")
+	defer span.End()
+	isPurgeable := func(rec *userstore.Record) bool {
+		return rec.Data != nil && rec.DeletedAt != nil && !rec.DeletedAt.After(cutoff)
+	}
+	var ids []uuid.UUID
+	err := store.scanRecords(ctx, func(rec *userstore.Record) bool {
+		if isPurgeable(rec) {
+			ids = append(ids, rec.ID)
+		}
+		return true
+	})
+	if err != nil {
+		span.RecordError(err)
+		return 0, fmt.Errorf("cannot purge deleted users: %w", err)
+	}
+	purged, err := store.changeEach(ctx, ids, func(rec *userstore.Record) error {
+		if !isPurgeable(rec) {
+			return errUnchanged
+		}
+		rec.Data = nil
+		rec.DeletedAt = nil
+		rec.ResetToken = nil
+		rec.EmailChange = nil
+		return nil
+	})
+	if err != nil {
+		span.RecordError(err)
+		return purged, fmt.Errorf("cannot purge deleted users: %w", err)
+	}
+	return purged, nil
+}
+
+// MarkDormant changes the status of the active users of every tenant who have not been seen since the given time,
+// including users created before it who have never been seen, to dormant, adding an event with the MarkedDormant
+// action for each. It returns the number of users made dormant. A user who is seen or changed by another caller
+// before they are made dormant is skipped, since they may no longer be inactive. Every record is read to find them
+func (store *Store) MarkDormant(ctx context.Context, inactiveSince time.Time) (int64, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "MarkDormantRecords")
+	defer span.End()
+	isDormant := func(rec *userstore.Record) bool {
+		return memquery.IsLive(rec, rec.Tenant) && memquery.IsActive(rec.Data) && memquery.IsInactive(rec.Data, inactiveSince)
+	}
+	var ids []uuid.UUID
+	err := store.scanRecords(ctx, func(rec *userstore.Record) bool {
+		if isDormant(rec) {
+			ids = append(ids, rec.ID)
+		}
+		return true
+	})
+	if err != nil {
+		span.RecordError(err)
+		return 0, fmt.Errorf("cannot find inactive users: %w", err)
+	}
+	marked, err := store.changeEach(ctx, ids, func(rec *userstore.Record) error {
+		if !isDormant(rec) {
+			return errUnchanged
+		}
+		rec.Data.Status = userstore.StatusDormant
+		rec.Data.UpdatedAt = utctime.Now()
+		rec.Data.Version += 1
+		addEvent(rec, userstore.MarkedDormant)
+		return nil
+	})
+	if err != nil {
+		span.RecordError(err)
+		return marked, fmt.Errorf("cannot make user dormant: %w", err)
+	}
+	return marked, nil
+}
+
+// queryPartition returns the query of the partition pk of index which reads the records which could match query, in
+// the order given by the query, limit items at a time. When the index is sorted by the time users were created, users
+// are only read from the period they could have been created in, and from after the user the query starts after
+func (store *Store) queryPartition(query *userstore.Query, index sortIndex, pk string, limit int32) *dynamodb.QueryInput {
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String(store.table),
+		IndexName:                 aws.String(index.name),
+		KeyConditionExpression:    aws.String("#pk = :pk"),
+		ExpressionAttributeNames:  map[string]string{"#pk": index.pkAttr},
+		ExpressionAttributeValues: map[string]types.AttributeValue{":pk": str(pk)},
+		ScanIndexForward:          aws.Bool(!query.SortDescending),
+		Limit:                     aws.Int32(limit),
+	}
+	if !index.byCreation {
+		return input
+	}
+
+	after := timeText(query.CreatedAfter)
+	input.KeyConditionExpression = aws.String("#pk = :pk AND #sk >= :after")
+	input.ExpressionAttributeNames["#sk"] = index.skAttr
+	input.ExpressionAttributeValues[":after"] = str(after)
+	createdBefore := query.CreatedBefore
+	if !query.InactiveSince.IsZero() && (createdBefore.IsZero() || query.InactiveSince.Before(createdBefore)) {
+		// users are seen after they are created, so users who were last seen before the time were created before it
+		createdBefore = query.InactiveSince
+	}
+	before := ""
+	if !createdBefore.IsZero() {
+		// sort keys are the time followed by the id, so every sort key of a user created before the time sorts before
+		// the time alone
+		before = timeText(createdBefore)
+		input.KeyConditionExpression = aws.String("#pk = :pk AND #sk BETWEEN :after AND :before")
+		input.ExpressionAttributeValues[":before"] = str(before)
+	}
+
+	if query.AfterID != uuid.Nil {
+		// DynamoDB rejects a start key outside of the key condition, so it is only used when it falls inside it. Users
+		// are filtered by memquery.IsAfter as well, so the users before it are still skipped when it does not
+		start := timeText(query.AfterCreatedAt) + "#" + query.AfterID.String()
+		if start >= after && (before == "" || start <= before) {
+			input.ExclusiveStartKey = userKey(query.AfterID)
+			input.ExclusiveStartKey[index.pkAttr] = str(pk)
+			input.ExclusiveStartKey[index.skAttr] = str(start)
+		}
+	}
+	return input
+}
+
+// queryItems calls visit with each item read by input, until it returns false
+func (store *Store) queryItems(ctx context.Context, input *dynamodb.QueryInput, visit func(map[string]types.AttributeValue) (bool, error)) error {
+	for {
+		out, err := store.client.Query(ctx, input)
+		if err != nil {
+			return err
+		}
+		for _, item := range out.Items {
+			more, err := visit(item)
+			if err != nil || !more {
+				return err
+			}
+		}
+		if len(out.LastEvaluatedKey) == 0 {
+			return nil
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+}
+
+// partition reads the records of users matching a query from one partition of an index, a page of items at a time as
+// they are needed
+type partition struct {
+	client Client
+	input  *dynamodb.QueryInput
+	keep   func(*userstore.Record) bool
+	// recs are the records of the page read last which have not been taken
+	recs []userstore.Record
+	done bool
+}
+
+// head returns the first record of the partition which has not been taken, reading pages of it until one holds a
+// record which is kept. It returns nil when every record has been taken
+func (p *partition) head(ctx context.Context) (*userstore.Record, error) {
+	for len(p.recs) == 0 && !p.done {
+		out, err := p.client.Query(ctx, p.input)
+		if err != nil {
+			return nil, fmt.Errorf("cannot find matching users: %w", err)
+		}
+		for _, item := range out.Items {
+			rec, _, err := decodeRecord(item)
+			if err != nil {
+				return nil, err
+			}
+			if p.keep(rec) {
+				p.recs = append(p.recs, *rec)
+			}
+		}
+		p.input.ExclusiveStartKey = out.LastEvaluatedKey
+		p.done = len(out.LastEvaluatedKey) == 0
+	}
+	if len(p.recs) == 0 {
+		return nil, nil
+	}
+	return &p.recs[0], nil
+}
+
+// partitionCursor is a userstore.Cursor over the records read from partitions of an index, which are each in the order
+// of a query, merged into that order
+type partitionCursor struct {
+	partitions []*partition
+	order      func(a, b *userstore.Record) int
+	current    userstore.Record
+	err        error
+}
+
+func (c *partitionCursor) Next(ctx context.Context) bool {
+	if c.err != nil {
+		return false
+	}
+	var first *partition
+	var next *userstore.Record
+	for _, p := range c.partitions {
+		head, err := p.head(ctx)
+		if err != nil {
+			c.err = err
+			return false
+		}
+		if head != nil && (next == nil || c.order(head, next) < 0) {
+			first, next = p, head
+		}
+	}
+	if first == nil {
+		return false
+	}
+	c.current = *next
+	first.recs = first.recs[1:]
+	return true
+}
+
+func (c *partitionCursor) Decode(val interface{}) error {
+	rec, ok := val.(*userstore.Record)
+	if !ok {
+		return fmt.Errorf("cannot decode user record into %T", val)
+	}
+	*rec = c.current
+	return nil
+}
+
+func (c *partitionCursor) Err() error {
+	return c.err
+}
+
+func (c *partitionCursor) Close(context.Context) error {
+	c.partitions = nil
+	return nil
+}
+
+// cursor returns a cursor over the records of the users of the tenant of ctx matching query, in the order given by the
+// query, starting after the user the query starts after, which reads limit items of an index at a time. A query for an
+// email address or nickname reads the one user holding it from its lookup item. Otherwise users are read from the
+// index of the tenant for the sort of the query, or from the index of each of the countries of the query when it has
+// any and users are sorted by the time they were created. The indexes are eventually consistent, so a user who has
+// just been changed may not match as they do now. ErrInvalidSort is returned for an invalid sort, as by
+// memquery.Order
+func (store *Store) cursor(ctx context.Context, query *userstore.Query, limit int32) (userstore.Cursor, error) {
+	order, err := memquery.Order(query)
+	if err != nil {
+		return nil, err
+	}
+	match := memquery.Match(ctx, query)
+	keep := func(rec *userstore.Record) bool {
+		return match(rec) && (query.AfterID == uuid.Nil || memquery.IsAfter(rec, query))
+	}
+
+	if query.Email != "" || query.Nickname != "" {
+		kind, value := emailLookup, query.Email
+		if value == "" {
+			kind, value = nicknameLookup, query.Nickname
+		}
+		rec, _, err := store.lookup(ctx, kind, value)
+		if err != nil {
+			return nil, fmt.Errorf("cannot find matching users: %w", err)
+		}
+		var recs []userstore.Record
+		if rec != nil && keep(rec) {
+			recs = append(recs, *rec)
+		}
+		return memquery.NewCursor(recs), nil
+	}
+
+	field := query.SortBy
+	if field == "" {
+		field = userstore.SortCreatedAt
+	}
+	pk := tenantPrefix + tenant.FromContext(ctx)
+	cursor := &partitionCursor{order: order}
+	if field == userstore.SortCreatedAt && len(query.Countries) > 0 {
+		seen := make(map[string]bool)
+		for _, country := range query.Countries {
+			if !seen[country] {
+				seen[country] = true
+				input := store.queryPartition(query, countrySort, pk+"#"+country, limit)
+				cursor.partitions = append(cursor.partitions, &partition{client: store.client, input: input, keep: keep})
+			}
+		}
+	} else {
+		input := store.queryPartition(query, sortIndexes[field], pk, limit)
+		cursor.partitions = append(cursor.partitions, &partition{client: store.client, input: input, keep: keep})
+	}
+	return cursor, nil
+}
+
+// countQuery returns query without its sort or the user it starts after, for counting every user matching it in the
+// order they can be read most quickly
+func countQuery(query *userstore.Query) *userstore.Query {
+	counted := *query
+	counted.SortBy = ""
+	counted.SortDescending = false
+	counted.AfterID = uuid.Nil
+	return &counted
+}
+
+// FindMany fetches pages of users matching the given query. Each request also returns the total count of users, unless
+// the query skips it. Only the users up to the end of the page are read to find it, but the users are all read to
+// count them
+func (store *Store) FindMany(ctx context.Context, query *userstore.Query) (page userstore.Page, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "FindUserRecords")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, findTimeout)
+	defer cancel()
+
+	// one user more than the page is read, to say whether there are more
+	skip := memquery.Skip(query)
+	limit := int64(queryPageSize)
+	if query.Length > 0 && skip+int64(query.Length)+1 < limit {
+		limit = skip + int64(query.Length) + 1
+	}
+	cursor, err := store.cursor(ctx, query, int32(limit))
+	if err != nil {
+		span.RecordError(err)
+		return page, err
+	}
+	defer cursor.Close(ctx)
+
+	page.Page = query.Page
+	page.Items = make([]userstore.User, 0)
+	for (query.Length == 0 || int32(len(page.Items)) <= query.Length) && cursor.Next(ctx) {
+		if skip > 0 {
+			skip -= 1
+			continue
+		}
+		var rec userstore.Record
+		if err = cursor.Decode(&rec); err != nil {
+			span.RecordError(err)
+			return page, err
+		}
+		page.Items = append(page.Items, *rec.Data)
+	}
+	if err = cursor.Err(); err != nil {
+		span.RecordError(err)
+		return page, err
+	}
+	if query.Length > 0 && int32(len(page.Items)) > query.Length {
+		page.Items = page.Items[:query.Length]
+		page.HasMore = query.SkipTotal
+	}
+
+	if query.SkipTotal {
+		page.Total = userstore.UnknownTotal
+		return page, nil
+	}
+	if page.Total, err = store.count(ctx, query); err != nil {
+		span.RecordError(err)
+		return page, err
+	}
+	return page, nil
+}
+
+// Count returns the total count of users matching the given query, without returning any of them.
+// The length, page and sort of the query are ignored
+func (store *Store) Count(ctx context.Context, query *userstore.Query) (int64, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "CountUserRecords")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, findTimeout)
+	defer cancel()
+
+	total, err := store.count(ctx, query)
+	if err != nil {
+		span.RecordError(err)
+		return 0, err
+	}
+	return total, nil
+}
+
+// count returns the total count of users matching query, which are all read to count them
+func (store *Store) count(ctx context.Context, query *userstore.Query) (int64, error) {
+	cursor, err := store.cursor(ctx, countQuery(query), queryPageSize)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+	var total int64
+	for cursor.Next(ctx) {
+		total += 1
+	}
+	return total, cursor.Err()
+}
+
+// Iterate returns a UserIterator over all of the users matching the given query, in the order given by the query.
+// The length and page of the query are ignored. The users are read a page at a time as they are iterated, so changes
+// made while iterating may be seen
+func (store *Store) Iterate(ctx context.Context, query *userstore.Query) (userstore.UserIterator, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "IterateUserRecords")
+	defer span.End()
+
+	cursor, err := store.cursor(ctx, query, queryPageSize)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	return userstore.NewIterator(cursor), nil
+}
+
+// Stats counts the users matching the given query by country and by the interval in which they were created. Weeks
+// start on Monday, and periods start at midnight UTC. The length, page and sort of the query are ignored
+func (store *Store) Stats(ctx context.Context, query *userstore.Query, interval userstore.StatsInterval) (userstore.Stats, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "UserRecordStats")
+	defer span.End()
+
+	tally, err := memquery.NewTally(interval)
+	if err != nil {
+		span.RecordError(err)
+		return userstore.Stats{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, findTimeout)
+	defer cancel()
+
+	cursor, err := store.cursor(ctx, countQuery(query), queryPageSize)
+	if err != nil {
+		span.RecordError(err)
+		return userstore.Stats{}, err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var rec userstore.Record
+		if err = cursor.Decode(&rec); err != nil {
+			span.RecordError(err)
+			return userstore.Stats{}, err
+		}
+		tally.Add(rec.Data)
+	}
+	if err = cursor.Err(); err != nil {
+		span.RecordError(err)
+		return userstore.Stats{}, err
+	}
+	return tally.Stats(), nil
+}
+
+// outbox returns the query of the outbox index, which reads the records with waiting events in the order their first
+// events were last updated
+func (store *Store) outbox() *dynamodb.QueryInput {
+	return &dynamodb.QueryInput{
+		TableName:                 aws.String(store.table),
+		IndexName:                 aws.String(outboxIndex),
+		KeyConditionExpression:    aws.String("#pk = :pk"),
+		ExpressionAttributeNames:  map[string]string{"#pk": outboxPKAttr},
+		ExpressionAttributeValues: map[string]types.AttributeValue{":pk": str(outboxPartition)},
+	}
+}
+
+// Backlog measures the events of every tenant which have not been processed, so that publishing falling behind can
+// be detected
+func (store *Store) Backlog(ctx context.Context) (userstore.Backlog, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "EventBacklog")
+	defer span.End()
+
+	var backlog userstore.Backlog
+	err := store.queryItems(ctx, store.outbox(), func(item map[string]types.AttributeValue) (bool, error) {
+		rec, _, err := decodeRecord(item)
+		// the events of a user with a dead lettered event wait until it is requeued
+		if err != nil || len(rec.Events) == 0 || rec.Events[0].State == userstore.DeadLettered {
+			return err == nil, err
+		}
+		backlog.Pending += int64(len(rec.Events))
+		// the events of a record are in the order they were created
+		if oldest := rec.Events[0].CreatedAt; backlog.Oldest.IsZero() || oldest.Before(backlog.Oldest) {
+			backlog.Oldest = oldest
+		}
+		return true, nil
+	})
+	if err != nil {
+		span.RecordError(err)
+		return userstore.Backlog{}, fmt.Errorf("cannot count pending events: %w", err)
+	}
+	return backlog, nil
+}
+
+// isWaiting returns true if evt is waiting to be processed at now. An event which has been processing for longer than
+// the retry timeout is processed again
+func isWaiting(evt *userstore.Event, now time.Time, retryTimeout time.Duration) bool {
+	return evt.State == userstore.Pending ||
+		(evt.State == userstore.Processing && evt.UpdatedAt.Before(now.Add(-retryTimeout)))
+}
+
+// nextEvents marks the first events of up to eventBatchSize of the records whose first events have waited longest as
+// processing, and returns them, oldest first. Only the first event of each record can be processed, so that the events
+// of a user are published in order. The outbox index is eventually consistent, so each event found is checked again as
+// it is marked, and an event marked by another caller first is skipped
+func (store *Store) nextEvents(ctx context.Context, retryTimeout time.Duration) ([]userstore.Event, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "FetchEvents")
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, findTimeout)
+	defer cancel()
+
+	now := utctime.Now()
+	events := make([]userstore.Event, 0)
+	err := store.queryItems(ctx, store.outbox(), func(item map[string]types.AttributeValue) (bool, error) {
+		rec, _, err := decodeRecord(item)
+		if err != nil {
+			return false, err
+		}
+		if len(rec.Events) == 0 || !isWaiting(&rec.Events[0], now, retryTimeout) {
+			return true, nil
+		}
+		head := rec.Events[0]
+		var next userstore.Event
+		find := func(ctx context.Context) (*userstore.Record, int64, error) { return store.getRecord(ctx, rec.ID) }
+		err = store.modify(ctx, find, errUnchanged, func(rec *userstore.Record) error {
+			if len(rec.Events) == 0 || rec.Events[0].State != head.State || !rec.Events[0].UpdatedAt.Equal(head.UpdatedAt) {
+				return errUnchanged
+			}
+			rec.Events[0].State = userstore.Processing
+			rec.Events[0].UpdatedAt = now
+			rec.Events[0].Attempts++
+			next = rec.Events[0]
+			return nil
+		})
+		switch {
+		case errors.Is(err, errUnchanged) || errors.Is(err, errChanged):
+			return true, nil
+		case err != nil:
+			return false, err
+		}
+		events = append(events, next)
+		return len(events) < eventBatchSize, nil
+	})
+	if err != nil {
+		span.RecordError(err)
+		return events, fmt.Errorf("cannot fetch events: %w", err)
+	}
+	return events, nil
+}
+
+// Events returns a channel of events from the store. Events are claimed in batches of up to eventBatchSize, and the
+// next batch is claimed without waiting when a batch is full
+func (store *Store) Events(ctx context.Context, minInterval, maxInterval, retryTimeout time.Duration) <-chan userstore.EventResult {
+	out := make(chan userstore.EventResult)
+	go func() {
+		defer close(out)
+		source := rand.New(rand.NewSource(utctime.Now().UnixNano()))
+		for {
+			events, err := store.nextEvents(ctx, retryTimeout)
+			results := make([]userstore.EventResult, 0, len(events))
+			for _, event := range events {
+				results = append(results, userstore.EventResult{Event: event})
+			}
+			if err != nil {
+				results = append(results, userstore.EventResult{Err: err})
+			}
+			for _, result := range results {
+				select {
+				case <-ctx.Done():
+					return
+				case out <- result:
+				}
+			}
+			if err != nil || len(events) < eventBatchSize {
+				// the wait is also made when there are no waiting events, so that the store is not polled in a tight loop
+				waitWithJitter(ctx, minInterval, maxInterval, source)
+			}
+			if ctx.Err() != nil {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+func waitWithJitter(ctx context.Context, minInterval, maxInterval time.Duration, source *rand.Rand) {
+	min, max := int64(minInterval), int64(maxInterval)
+	after := time.After(minInterval + time.Duration(source.Int63n(max-min)))
+	select {
+	case <-ctx.Done():
+	case <-after:
+	}
+}
+
+// ProcessEvent marks the matching event as processed by removing it from the store
+func (store *Store) ProcessEvent(ctx context.Context, id uuid.UUID, version int64) error {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "ProcessEvent")
+	defer span.End()
+	find := func(ctx context.Context) (*userstore.Record, int64, error) { return store.getRecord(ctx, id) }
+	err := store.modify(ctx, find, errUnchanged, func(rec *userstore.Record) error {
+		if len(rec.Events) == 0 || rec.Events[0].State != userstore.Processing || rec.Events[0].Version != version {
+			return errUnchanged
+		}
+		rec.Events = rec.Events[1:]
+		return nil
+	})
+	if err != nil && !errors.Is(err, errUnchanged) {
+		span.RecordError(err)
+		return fmt.Errorf("cannot complete event: %w", err)
+	}
+	return nil
+}
+
+// DeadLetterEvent moves the matching event, which must be being processed, to the DeadLettered state, so that it is
+// not processed again until it is requeued with RequeueDeadLetter
+func (store *Store) DeadLetterEvent(ctx context.Context, id uuid.UUID, version int64) error {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "DeadLetterEvent")
+	defer span.End()
+	find := func(ctx context.Context) (*userstore.Record, int64, error) { return store.getRecord(ctx, id) }
+	err := store.modify(ctx, find, errUnchanged, func(rec *userstore.Record) error {
+		if len(rec.Events) == 0 || rec.Events[0].State != userstore.Processing || rec.Events[0].Version != version {
+			return errUnchanged
+		}
+		rec.Events[0].State = userstore.DeadLettered
+		rec.Events[0].UpdatedAt = utctime.Now()
+		return nil
+	})
+	if err != nil && !errors.Is(err, errUnchanged) {
+		span.RecordError(err)
+		return fmt.Errorf("cannot dead letter event: %w", err)
+	}
+	return nil
+}
+
+// DeadLetters reads the dead lettered events of the users of the tenant of ctx, including deleted users, in the order
+// they were dead lettered. Dead lettered events stay in the outbox index, which is sorted by the time the first event
+// of each record was last updated
+func (store *Store) DeadLetters(ctx context.Context) ([]userstore.Event, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "ReadDeadLetters")
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, findTimeout)
+	defer cancel()
+
+	tenantID := tenant.FromContext(ctx)
+	events := make([]userstore.Event, 0)
+	err := store.queryItems(ctx, store.outbox(), func(item map[string]types.AttributeValue) (bool, error) {
+		rec, _, err := decodeRecord(item)
+		if err != nil {
+			return false, err
+		}
+		if rec.Tenant == tenantID && len(rec.Events) > 0 && rec.Events[0].State == userstore.DeadLettered {
+			events = append(events, rec.Events[0])
+		}
+		return true, nil
+	})
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("cannot read dead letters: %w", err)
+	}
+	return events, nil
+}
+
+// RequeueDeadLetter returns the dead lettered event of the user identified by id to the Pending state, with no
+// attempts, so that it is processed again. It returns userstore.ErrNotFound if the user, in the tenant of ctx, has no
+// dead lettered event
+func (store *Store) RequeueDeadLetter(ctx context.Context, id uuid.UUID) error {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "RequeueDeadLetter")
+	defer span.End()
+	tenantID := tenant.FromContext(ctx)
+	find := func(ctx context.Context) (*userstore.Record, int64, error) { return store.getRecord(ctx, id) }
+	err := store.modify(ctx, find, userstore.ErrNotFound, func(rec *userstore.Record) error {
+		if rec.Tenant != tenantID || len(rec.Events) == 0 || rec.Events[0].State != userstore.DeadLettered {
+			return userstore.ErrNotFound
+		}
+		rec.Events[0].State = userstore.Pending
+		rec.Events[0].UpdatedAt = utctime.Now()
+		rec.Events[0].Attempts = 0
+		return nil
+	})
+	if err != nil {
+		span.RecordError(err)
+		if errors.Is(err, userstore.ErrNotFound) {
+			return err
+		}
+		return fmt.Errorf("cannot requeue dead letter: %w", err)
+	}
+	return nil
+}
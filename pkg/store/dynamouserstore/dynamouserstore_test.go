@@ -0,0 +1,151 @@
+package dynamouserstore_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/bxcodec/faker/v3"
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/store/dynamouserstore"
+	"github.com/robotlovesyou/fitest/pkg/store/storetest"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/user"
+	"github.com/robotlovesyou/fitest/pkg/utctime"
+	"github.com/stretchr/testify/require"
+)
+
+const timeout = 10 * time.Second
+
+// the store must be usable in place of the mongo store
+var _ user.UserStore = (*dynamouserstore.Store)(nil)
+
+func createMany(ctx context.Context, items []userstore.User, store *dynamouserstore.Store) {
+	for _, item := range items {
+		_, err := store.Create(ctx, &item)
+		if err != nil {
+			panic(fmt.Errorf("cannot create many: %v", err))
+		}
+	}
+}
+
+// testClient returns a client of the test endpoint, which is expected to be DynamoDB Local, so static credentials are
+// used
+func testClient() *dynamodb.Client {
+	return dynamodb.New(dynamodb.Options{
+		Region:           "us-east-1",
+		Credentials:      credentials.NewStaticCredentialsProvider("test", "test", ""),
+		EndpointResolver: dynamodb.EndpointResolverFromURL(os.Getenv("DYNAMODB_TEST_ENDPOINT")),
+	})
+}
+
+// newTestStore returns a store created by newStore with a table of its own, so that tests do not see each other's
+// users. The table is deleted when t finishes
+func newTestStore(t *testing.T, newStore func(dynamouserstore.Client, string) *dynamouserstore.Store) *dynamouserstore.Store {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	client := testClient()
+	table := fmt.Sprintf("test%s", uuid.Must(uuid.NewRandom()).String())
+	store := newStore(client, table)
+	require.NoError(t, store.EnsureTable(ctx))
+	t.Cleanup(func() {
+		client.DeleteTable(context.Background(), &dynamodb.DeleteTableInput{TableName: aws.String(table)})
+	})
+	return store
+}
+
+func TestStoreConformsToTheSuite(t *testing.T) {
+	storetest.Run(t, func(t *testing.T, retention time.Duration) storetest.Store {
+		if retention == 0 {
+			return newTestStore(t, dynamouserstore.New)
+		}
+		return newTestStore(t, func(client dynamouserstore.Client, table string) *dynamouserstore.Store {
+			return dynamouserstore.NewWithRetention(client, table, retention)
+		})
+	})
+}
+
+func fakeUserRecord(muts ...func(r *userstore.User)) userstore.User {
+	r := userstore.User{
+		ID:           uuid.Must(uuid.NewRandom()),
+		FirstName:    faker.FirstName(),
+		LastName:     faker.LastName(),
+		Nickname:     faker.Username(),
+		PasswordHash: "supersecrethash",
+		Email:        faker.Email(),
+		Country:      "DE",
+		CreatedAt:    utctime.Now(),
+		UpdatedAt:    utctime.Now(),
+		Version:      user.DefaultVersion,
+	}
+
+	for _, m := range muts {
+		m(&r)
+	}
+	return r
+}
+
+func TestEnsureTableAddsMissingIndexesToAnExistingTable(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// the table is created with the indexes of the first version of the store
+	client := testClient()
+	table := fmt.Sprintf("test%s", uuid.Must(uuid.NewRandom()).String())
+	t.Cleanup(func() {
+		client.DeleteTable(context.Background(), &dynamodb.DeleteTableInput{TableName: aws.String(table)})
+	})
+	var definitions []types.AttributeDefinition
+	for _, attribute := range []string{"PK", "SK", "TenantPK", "TenantSK", "CountryPK", "CountrySK", "OutboxPK", "OutboxSK"} {
+		definitions = append(definitions, types.AttributeDefinition{
+			AttributeName: aws.String(attribute),
+			AttributeType: types.ScalarAttributeTypeS,
+		})
+	}
+	index := func(name, pk, sk string) types.GlobalSecondaryIndex {
+		return types.GlobalSecondaryIndex{
+			IndexName: aws.String(name),
+			KeySchema: []types.KeySchemaElement{
+				{AttributeName: aws.String(pk), KeyType: types.KeyTypeHash},
+				{AttributeName: aws.String(sk), KeyType: types.KeyTypeRange},
+			},
+			Projection: &types.Projection{ProjectionType: types.ProjectionTypeAll},
+		}
+	}
+	_, err := client.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName:            aws.String(table),
+		BillingMode:          types.BillingModePayPerRequest,
+		AttributeDefinitions: definitions,
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String("PK"), KeyType: types.KeyTypeHash},
+			{AttributeName: aws.String("SK"), KeyType: types.KeyTypeRange},
+		},
+		GlobalSecondaryIndexes: []types.GlobalSecondaryIndex{
+			index("ByTenant", "TenantPK", "TenantSK"),
+			index("ByCountry", "CountryPK", "CountrySK"),
+			index("Outbox", "OutboxPK", "OutboxSK"),
+		},
+	})
+	require.NoError(t, err)
+
+	store := dynamouserstore.New(client, table)
+	users := []userstore.User{
+		fakeUserRecord(func(u *userstore.User) { u.LastName = "Brown" }),
+		fakeUserRecord(func(u *userstore.User) { u.LastName = "Able" }),
+	}
+	createMany(ctx, users, store)
+	require.NoError(t, store.EnsureTable(ctx))
+
+	page, err := store.FindMany(ctx, &userstore.Query{SortBy: userstore.SortLastName, Length: 10, Page: 1})
+	require.NoError(t, err)
+	require.Len(t, page.Items, 2)
+	require.Equal(t, users[1].ID, page.Items[0].ID)
+	require.Equal(t, users[0].ID, page.Items[1].ID)
+}
@@ -0,0 +1,289 @@
+// Package memquery matches, sorts, pages and counts user records which have been read into memory, for the stores
+// which cannot query their records where they are held. Users are matched and ordered as the userstore package
+// matches and orders them, so that every store finds the same users for a query
+package memquery
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/tenant"
+)
+
+// sortCompares compare two users by each SortField, returning a negative number when a sorts before b, a positive
+// number when it sorts after b, and 0 when they sort together
+var sortCompares = map[userstore.SortField]func(a, b *userstore.User) int{
+	userstore.SortCreatedAt: func(a, b *userstore.User) int { return compareTimes(a.CreatedAt, b.CreatedAt) },
+	userstore.SortUpdatedAt: func(a, b *userstore.User) int { return compareTimes(a.UpdatedAt, b.UpdatedAt) },
+	userstore.SortLastName:  func(a, b *userstore.User) int { return strings.Compare(a.LastName, b.LastName) },
+	userstore.SortNickname:  func(a, b *userstore.User) int { return strings.Compare(a.Nickname, b.Nickname) },
+}
+
+// compareTimes compares a and b as sortCompares do
+func compareTimes(a, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	default:
+		return 0
+	}
+}
+
+// IsLive returns true if rec holds a user of the tenant tenantID which has not been deleted
+func IsLive(rec *userstore.Record, tenantID string) bool {
+	return rec.Tenant == tenantID && rec.Data != nil && rec.DeletedAt == nil
+}
+
+// IsInactive returns true if usr has not been seen since the given time, including if they were created before it
+// and have never been seen
+func IsInactive(usr *userstore.User, since time.Time) bool {
+	return usr.CreatedAt.Before(since) && usr.LastSeenAt.Before(since)
+}
+
+// IsActive returns true if usr has the active status. Users without a status are active
+func IsActive(usr *userstore.User) bool {
+	return usr.Status == "" || usr.Status == userstore.StatusActive
+}
+
+// Match returns a function which returns true for the records of users of the tenant of ctx matching query.
+// Soft deleted users never match
+func Match(ctx context.Context, query *userstore.Query) func(*userstore.Record) bool {
+	tenantID := tenant.FromContext(ctx)
+	countries := make(map[string]bool, len(query.Countries))
+	for _, country := range query.Countries {
+		countries[country] = true
+	}
+	return func(rec *userstore.Record) bool {
+		if !IsLive(rec, tenantID) {
+			return false
+		}
+		usr := rec.Data
+		switch {
+		case usr.CreatedAt.Before(query.CreatedAfter):
+			return false
+		case !query.CreatedBefore.IsZero() && !usr.CreatedAt.Before(query.CreatedBefore):
+			return false
+		case len(countries) > 0 && !countries[usr.Country]:
+			return false
+		case !query.InactiveSince.IsZero() && !IsInactive(usr, query.InactiveSince):
+			return false
+		case query.Status == userstore.StatusActive && !IsActive(usr):
+			return false
+		case query.Status != "" && query.Status != userstore.StatusActive && usr.Status != query.Status:
+			return false
+		case query.Search != "" && !matchesSearch(usr, query.Search):
+			return false
+		case query.Nickname != "" && usr.Nickname != query.Nickname:
+			return false
+		case query.Email != "" && usr.Email != query.Email:
+			return false
+		case query.NamePrefix != "" && !matchesNamePrefix(usr, query.NamePrefix):
+			return false
+		}
+		return true
+	}
+}
+
+// matchesSearch returns true if the nickname or email address of usr is search, or their first or last name starts
+// with it
+func matchesSearch(usr *userstore.User, search string) bool {
+	return usr.Nickname == search || usr.Email == search ||
+		strings.HasPrefix(usr.FirstName, search) || strings.HasPrefix(usr.LastName, search)
+}
+
+// matchesNamePrefix returns true if the first or last name of usr starts with prefix, ignoring case
+func matchesNamePrefix(usr *userstore.User, prefix string) bool {
+	prefix = strings.ToLower(prefix)
+	return strings.HasPrefix(strings.ToLower(usr.FirstName), prefix) ||
+		strings.HasPrefix(strings.ToLower(usr.LastName), prefix)
+}
+
+// Order returns a function which compares two records in the order given by query, returning a negative number when
+// a comes before b and a positive number when it comes after it. The id is used as a tie breaker so that the order
+// is stable between pages. ErrInvalidSort is returned if the query has an unknown sort, or starts after a user
+// without sorting by SortCreatedAt
+func Order(query *userstore.Query) (func(a, b *userstore.Record) int, error) {
+	field := query.SortBy
+	if field == "" {
+		field = userstore.SortCreatedAt
+	}
+	compare, ok := sortCompares[field]
+	if !ok || (query.AfterID != uuid.Nil && field != userstore.SortCreatedAt) {
+		return nil, userstore.ErrInvalidSort
+	}
+	return func(a, b *userstore.Record) int {
+		order := compare(a.Data, b.Data)
+		if order == 0 {
+			order = bytes.Compare(a.ID[:], b.ID[:])
+		}
+		if query.SortDescending {
+			return -order
+		}
+		return order
+	}, nil
+}
+
+// Sort sorts recs in the order given by query, returning the errors of Order
+func Sort(recs []userstore.Record, query *userstore.Query) error {
+	order, err := Order(query)
+	if err != nil {
+		return err
+	}
+	sort.Slice(recs, func(i, j int) bool { return order(&recs[i], &recs[j]) < 0 })
+	return nil
+}
+
+// IsAfter returns true if rec comes after the user identified by the AfterID and AfterCreatedAt of query, in the order
+// given by Order
+func IsAfter(rec *userstore.Record, query *userstore.Query) bool {
+	order := compareTimes(rec.Data.CreatedAt, query.AfterCreatedAt)
+	if order == 0 {
+		order = bytes.Compare(rec.ID[:], query.AfterID[:])
+	}
+	if query.SortDescending {
+		return order < 0
+	}
+	return order > 0
+}
+
+// Skip returns the number of users to skip to reach the page of the query. No users are skipped when the query starts
+// after a user
+func Skip(query *userstore.Query) int64 {
+	if query.AfterID != uuid.Nil {
+		return 0
+	}
+	skip := int64(query.Length) * (query.Page - 1)
+	if skip < int64(0) {
+		skip = int64(0)
+	}
+	return skip
+}
+
+// PageOf returns the page of query from recs, which are every record matching it in the order given by Sort
+func PageOf(recs []userstore.Record, query *userstore.Query) (page userstore.Page) {
+	page.Page = query.Page
+	page.Total = int64(len(recs))
+	if query.AfterID != uuid.Nil {
+		// the records are sorted, so those after the user follow the first of them
+		start := sort.Search(len(recs), func(i int) bool { return IsAfter(&recs[i], query) })
+		recs = recs[start:]
+	}
+	skip := Skip(query)
+	if skip > int64(len(recs)) {
+		skip = int64(len(recs))
+	}
+	recs = recs[skip:]
+	if query.Length > 0 && int64(len(recs)) > int64(query.Length) {
+		recs = recs[:query.Length]
+		page.HasMore = query.SkipTotal
+	}
+	if query.SkipTotal {
+		// the users have been read anyway, but the total is not returned, as it is not by the other stores
+		page.Total = userstore.UnknownTotal
+	}
+	page.Items = make([]userstore.User, 0, len(recs))
+	for _, rec := range recs {
+		page.Items = append(page.Items, *rec.Data)
+	}
+	return page
+}
+
+// sliceCursor is a userstore.Cursor over records which have already been read
+type sliceCursor struct {
+	recs []userstore.Record
+	next int
+}
+
+// NewCursor returns a userstore.Cursor over recs, so that they can be iterated with userstore.NewIterator
+func NewCursor(recs []userstore.Record) userstore.Cursor {
+	return &sliceCursor{recs: recs}
+}
+
+func (c *sliceCursor) Next(context.Context) bool {
+	if c.next >= len(c.recs) {
+		return false
+	}
+	c.next += 1
+	return true
+}
+
+func (c *sliceCursor) Decode(val interface{}) error {
+	rec, ok := val.(*userstore.Record)
+	if !ok {
+		return fmt.Errorf("cannot decode user record into %T", val)
+	}
+	*rec = c.recs[c.next-1]
+	return nil
+}
+
+func (c *sliceCursor) Err() error {
+	return nil
+}
+
+func (c *sliceCursor) Close(context.Context) error {
+	c.recs = nil
+	return nil
+}
+
+// StartOf returns the start of the period of the given interval containing t. Weeks start on Monday, and periods
+// start at midnight UTC
+func StartOf(t time.Time, interval userstore.StatsInterval) (time.Time, error) {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch interval {
+	case userstore.IntervalDay:
+		return day, nil
+	case userstore.IntervalWeek:
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7), nil
+	case userstore.IntervalMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC), nil
+	default:
+		return time.Time{}, fmt.Errorf("cannot count users by unknown interval %s", interval)
+	}
+}
+
+// Tally counts users by country and by the interval in which they were created, for Stats
+type Tally struct {
+	interval  userstore.StatsInterval
+	countries map[string]int64
+	signups   map[time.Time]int64
+}
+
+// NewTally returns an empty tally of users by the given interval. It returns an error for unknown intervals
+func NewTally(interval userstore.StatsInterval) (*Tally, error) {
+	if _, err := StartOf(time.Time{}, interval); err != nil {
+		return nil, err
+	}
+	return &Tally{interval: interval, countries: make(map[string]int64), signups: make(map[time.Time]int64)}, nil
+}
+
+// Add counts usr
+func (t *Tally) Add(usr *userstore.User) {
+	start, _ := StartOf(usr.CreatedAt, t.interval)
+	t.countries[usr.Country] += 1
+	t.signups[start] += 1
+}
+
+// Stats returns the counts of the users added to the tally, with countries in alphabetical order and periods in the
+// order they started
+func (t *Tally) Stats() userstore.Stats {
+	var stats userstore.Stats
+	for country, total := range t.countries {
+		stats.Countries = append(stats.Countries, userstore.CountryCount{Country: country, Total: total})
+		stats.Total += total
+	}
+	sort.Slice(stats.Countries, func(i, j int) bool { return stats.Countries[i].Country < stats.Countries[j].Country })
+	for start, total := range t.signups {
+		stats.Signups = append(stats.Signups, userstore.SignupCount{Start: start, Total: total})
+	}
+	sort.Slice(stats.Signups, func(i, j int) bool { return stats.Signups[i].Start.Before(stats.Signups[j].Start) })
+	return stats
+}
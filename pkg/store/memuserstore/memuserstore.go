@@ -0,0 +1,1061 @@
+// Package memuserstore implements a store for user details held in memory, so that the service and services which
+// depend on it can be run and tested without a database. It stores the same records as the userstore package and
+// returns the same errors, including the uniqueness of email addresses, nicknames and idempotency keys within a
+// tenant, optimistic locking with versions, and an outbox of events which are processed in the order they were added.
+// Users are lost when the process exits, and every user is held in memory, so it is not suitable for production
+package memuserstore
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/store/memquery"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/tenant"
+	"github.com/robotlovesyou/fitest/pkg/utctime"
+)
+
+// eventBatchSize is the largest number of events claimed at once by Events
+const eventBatchSize = 100
+
+// statusActions are the actions of the events for changes to each status
+var statusActions = map[userstore.Status]userstore.Action{
+	userstore.StatusActive:    userstore.Reactivated,
+	userstore.StatusSuspended: userstore.Suspended,
+	userstore.StatusBanned:    userstore.Banned,
+	userstore.StatusDormant:   userstore.MarkedDormant,
+}
+
+// Store provides services for storing and retrieving data. Every record is held in a map by id, and records are
+// copied in and out of the store so that callers cannot change them. It is safe for concurrent use
+type Store struct {
+	mtx     sync.Mutex
+	records map[uuid.UUID]*userstore.Record
+	// retention is the time soft deleted users are kept for before they are purged. When it is 0, users are deleted
+	// irrecoverably instead
+	retention time.Duration
+}
+
+type Monitor struct {
+	store *Store
+}
+
+func NewMonitor(store *Store) *Monitor {
+	return &Monitor{store: store}
+}
+
+func (m *Monitor) Name() string {
+	return "Datastore"
+}
+
+// Check always succeeds, since the store does not depend on anything which could fail
+func (m *Monitor) Check(context.Context) error {
+	return nil
+}
+
+// New creates a new, empty store, which deletes users irrecoverably
+func New() *Store {
+	return &Store{records: make(map[uuid.UUID]*userstore.Record)}
+}
+
+// NewWithRetention creates a new, empty store which soft deletes users. Soft deleted users are excluded from reads,
+// can be restored with Restore until retention has passed, and are then deleted irrecoverably by Purge
+func NewWithRetention(retention time.Duration) *Store {
+	store := New()
+	store.retention = retention
+	return store
+}
+
+// eventFor returns a pending event for a change to the user with the given id. The user is copied, so that later
+// changes to the record do not change the event
+func eventFor(action userstore.Action, id uuid.UUID, version int64, user *userstore.User) userstore.Event {
+	var data *userstore.User
+	if user != nil {
+		copied := *user
+		data = &copied
+	}
+	return userstore.Event{
+		ID:        id,
+		State:     userstore.Pending,
+		Action:    action,
+		Version:   version,
+		CreatedAt: utctime.Now(),
+		UpdatedAt: utctime.Now(),
+		Data:      data,
+	}
+}
+
+// addEvent adds an event for the current state of the user of rec to its outbox
+func addEvent(rec *userstore.Record, action userstore.Action) {
+	rec.Events = append(rec.Events, eventFor(action, rec.ID, rec.Data.Version, rec.Data))
+}
+
+// cloneRecord returns a copy of rec which shares nothing with it
+func cloneRecord(rec *userstore.Record) userstore.Record {
+	clone := *rec
+	if rec.Data != nil {
+		usr := *rec.Data
+		clone.Data = &usr
+	}
+	if rec.ResetToken != nil {
+		reset := *rec.ResetToken
+		clone.ResetToken = &reset
+	}
+	if rec.EmailChange != nil {
+		change := *rec.EmailChange
+		clone.EmailChange = &change
+	}
+	if rec.TwoFactor != nil {
+		twoFactor := *rec.TwoFactor
+		twoFactor.RecoveryCodes = append([]string(nil), rec.TwoFactor.RecoveryCodes...)
+		clone.TwoFactor = &twoFactor
+	}
+	if rec.DeletedAt != nil {
+		deletedAt := *rec.DeletedAt
+		clone.DeletedAt = &deletedAt
+	}
+	clone.PreviousNicknames = append([]userstore.PreviousNickname(nil), rec.PreviousNicknames...)
+	// the users of events are never changed once the event is added, so they can be shared
+	clone.Events = append([]userstore.Event(nil), rec.Events...)
+	return clone
+}
+
+// user returns the record of the user of the tenant tenantID with the given id, or nil if there is no such user or
+// they have been deleted. The caller must hold the lock
+func (store *Store) user(tenantID string, id uuid.UUID) *userstore.Record {
+	rec, ok := store.records[id]
+	if !ok || !memquery.IsLive(rec, tenantID) {
+		return nil
+	}
+	return rec
+}
+
+// first returns the first record matching match, or nil if there is none. The caller must hold the lock
+func (store *Store) first(match func(*userstore.Record) bool) *userstore.Record {
+	for _, rec := range store.records {
+		if match(rec) {
+			return rec
+		}
+	}
+	return nil
+}
+
+// conflict returns ErrEmailInUse or ErrNicknameInUse if another user of the tenant of rec, including a soft deleted
+// user, has the email address or nickname of rec. The caller must hold the lock
+func (store *Store) conflict(rec *userstore.Record) error {
+	for _, other := range store.records {
+		if other.ID == rec.ID || other.Tenant != rec.Tenant || other.Data == nil {
+			continue
+		}
+		switch {
+		case other.Data.Email == rec.Data.Email:
+			return userstore.ErrEmailInUse
+		case other.Data.Nickname == rec.Data.Nickname:
+			return userstore.ErrNicknameInUse
+		}
+	}
+	return nil
+}
+
+// modify calls apply with a copy of the record found by find, and stores the copy in place of the record if apply
+// returns nil and the copy does not conflict with another user. Since the lock is held throughout, a change is
+// applied atomically. notFound is returned if find returns nil
+func (store *Store) modify(find func() *userstore.Record, notFound error, apply func(*userstore.Record) error) error {
+	store.mtx.Lock()
+	defer store.mtx.Unlock()
+	rec := find()
+	if rec == nil {
+		return notFound
+	}
+	clone := cloneRecord(rec)
+	if err := apply(&clone); err != nil {
+		return err
+	}
+	if clone.Data != nil {
+		if err := store.conflict(&clone); err != nil {
+			return err
+		}
+	}
+	store.records[clone.ID] = &clone
+	return nil
+}
+
+// modifyUser is modify for the user of the tenant of ctx with the given id. ErrNotFound is returned if there is no
+// such user
+func (store *Store) modifyUser(ctx context.Context, id uuid.UUID, apply func(*userstore.Record) error) error {
+	tenantID := tenant.FromContext(ctx)
+	return store.modify(func() *userstore.Record { return store.user(tenantID, id) }, userstore.ErrNotFound, apply)
+}
+
+// insert stores a new record for user, with the event for its creation. ErrAlreadyExists is returned if a record
+// with the same id exists, and ErrEmailInUse or ErrNicknameInUse if the email address or nickname is used by another
+// user. The caller must hold the lock
+func (store *Store) insert(tenantID string, user *userstore.User, key string) error {
+	if _, ok := store.records[user.ID]; ok {
+		return userstore.ErrAlreadyExists
+	}
+	usr := *user
+	rec := &userstore.Record{ID: usr.ID, Data: &usr, IdempotencyKey: key, Tenant: tenantID}
+	if key != "" {
+		rec.IdempotencyHash = userstore.PayloadHash(&usr)
+	}
+	if err := store.conflict(rec); err != nil {
+		return err
+	}
+	addEvent(rec, userstore.Created)
+	store.records[rec.ID] = rec
+	return nil
+}
+
+// Create creates a new user record for the tenant of ctx. ErrEmailInUse or ErrNicknameInUse is returned if the
+// email address or nickname is used by another user
+func (store *Store) Create(ctx context.Context, user *userstore.User) (userstore.User, error) {
+	store.mtx.Lock()
+	defer store.mtx.Unlock()
+	if err := store.insert(tenant.FromContext(ctx), user, ""); err != nil {
+		return *user, err
+	}
+	return *user, nil
+}
+
+// CreateMany creates a batch of new user records. Users which conflict with an existing user, or with another user in
+// the batch, are not created, but do not prevent the others from being created.
+// It returns an error for each user, in the same order as users, which is nil if the user was created and
+// ErrEmailInUse or ErrNicknameInUse if it conflicted
+func (store *Store) CreateMany(ctx context.Context, users []userstore.User) ([]error, error) {
+	store.mtx.Lock()
+	defer store.mtx.Unlock()
+	tenantID := tenant.FromContext(ctx)
+	errs := make([]error, len(users))
+	for i := range users {
+		errs[i] = store.insert(tenantID, &users[i], "")
+	}
+	return errs, nil
+}
+
+// CreateWithKey creates a new user record, storing the idempotency key with it.
+// If a user has already been created with the same key, that user is returned instead of creating another.
+// ErrAlreadyExists is returned if the key has been used for a user which has since been deleted,
+// ErrIdempotencyKeyReused if it was used for a user created with different details, and ErrEmailInUse or
+// ErrNicknameInUse if the email address or nickname is used by another user
+func (store *Store) CreateWithKey(ctx context.Context, user *userstore.User, key string) (userstore.User, error) {
+	store.mtx.Lock()
+	defer store.mtx.Unlock()
+	tenantID := tenant.FromContext(ctx)
+	// records deleted irrecoverably are kept without their data, so keys are never reused
+	original := store.first(func(rec *userstore.Record) bool {
+		return rec.Tenant == tenantID && rec.IdempotencyKey == key
+	})
+	if original != nil {
+		if !memquery.IsLive(original, tenantID) {
+			return *user, userstore.ErrAlreadyExists
+		}
+		if !original.SamePayload(user) {
+			return *user, userstore.ErrIdempotencyKeyReused
+		}
+		return *original.Data, nil
+	}
+	if err := store.insert(tenantID, user, key); err != nil {
+		return *user, err
+	}
+	return *user, nil
+}
+
+// ReadOne reads a single user record of the tenant of ctx by ID. Soft deleted records are not read
+func (store *Store) ReadOne(ctx context.Context, id uuid.UUID) (user userstore.User, err error) {
+	store.mtx.Lock()
+	defer store.mtx.Unlock()
+	rec := store.user(tenant.FromContext(ctx), id)
+	if rec == nil {
+		return user, userstore.ErrNotFound
+	}
+	return *rec.Data, nil
+}
+
+// ReadMany reads the users of the tenant of ctx with the given IDs, in the order of ids. The user of an id which does
+// not exist or has been deleted is the zero User, whose ID is uuid.Nil
+func (store *Store) ReadMany(ctx context.Context, ids []uuid.UUID) ([]userstore.User, error) {
+	store.mtx.Lock()
+	defer store.mtx.Unlock()
+	tenantID := tenant.FromContext(ctx)
+	users := make([]userstore.User, 0, len(ids))
+	for _, id := range ids {
+		var usr userstore.User
+		if rec := store.user(tenantID, id); rec != nil {
+			usr = *rec.Data
+		}
+		users = append(users, usr)
+	}
+	return users, nil
+}
+
+// ReadRecord reads the whole record of a single user of the tenant of ctx by ID, including its pending events.
+// Unlike ReadOne, soft deleted records are read. ErrNotFound is returned if the record does not exist or has been
+// deleted irrecoverably
+func (store *Store) ReadRecord(ctx context.Context, id uuid.UUID) (rec userstore.Record, err error) {
+	store.mtx.Lock()
+	defer store.mtx.Unlock()
+	stored, ok := store.records[id]
+	if !ok || stored.Tenant != tenant.FromContext(ctx) || stored.Data == nil {
+		return rec, userstore.ErrNotFound
+	}
+	return cloneRecord(stored), nil
+}
+
+// FindByEmail reads a single user record by email address
+func (store *Store) FindByEmail(ctx context.Context, email string) (user userstore.User, err error) {
+	return store.findOne(ctx, func(usr *userstore.User) bool { return usr.Email == email })
+}
+
+// FindByNickname reads a single user record by nickname
+func (store *Store) FindByNickname(ctx context.Context, nickname string) (user userstore.User, err error) {
+	return store.findOne(ctx, func(usr *userstore.User) bool { return usr.Nickname == nickname })
+}
+
+// findOne reads the user of the tenant of ctx matching match, unless they have been soft deleted
+func (store *Store) findOne(ctx context.Context, match func(*userstore.User) bool) (user userstore.User, err error) {
+	store.mtx.Lock()
+	defer store.mtx.Unlock()
+	tenantID := tenant.FromContext(ctx)
+	rec := store.first(func(rec *userstore.Record) bool { return memquery.IsLive(rec, tenantID) && match(rec.Data) })
+	if rec == nil {
+		return user, userstore.ErrNotFound
+	}
+	return *rec.Data, nil
+}
+
+// EmailExists returns true if a user of the tenant of ctx has the email address email. Soft deleted users are
+// included, since their email addresses are not released until they are purged
+func (store *Store) EmailExists(ctx context.Context, email string) (bool, error) {
+	return store.exists(ctx, func(usr *userstore.User) bool { return usr.Email == email }), nil
+}
+
+// NicknameExists returns true if a user of the tenant of ctx has the nickname nickname. Soft deleted users are
+// included, since their nicknames are not released until they are purged
+func (store *Store) NicknameExists(ctx context.Context, nickname string) (bool, error) {
+	return store.exists(ctx, func(usr *userstore.User) bool { return usr.Nickname == nickname }), nil
+}
+
+// exists returns true if any user of the tenant of ctx, including a soft deleted user, matches match
+func (store *Store) exists(ctx context.Context, match func(*userstore.User) bool) bool {
+	store.mtx.Lock()
+	defer store.mtx.Unlock()
+	tenantID := tenant.FromContext(ctx)
+	return store.first(func(rec *userstore.Record) bool {
+		return rec.Tenant == tenantID && rec.Data != nil && match(rec.Data)
+	}) != nil
+}
+
+// ChangePassword updates a single user record, unless the provided update is stale.
+// The event for the change has the PasswordChanged action
+func (store *Store) ChangePassword(ctx context.Context, update *userstore.User) (user userstore.User, err error) {
+	return store.update(ctx, update, userstore.PasswordChanged)
+}
+
+// Anonymize updates a single user record, unless the provided update is stale. Unlike other updates, the nickname
+// and email address are also replaced, along with any password reset token or email change, two factor
+// authentication is turned off, previous nicknames are removed, and the event for the change has the Anonymized action
+func (store *Store) Anonymize(ctx context.Context, update *userstore.User) (user userstore.User, err error) {
+	return store.update(ctx, update, userstore.Anonymized)
+}
+
+// ChangeStatus changes the status of a single user record to the status of update, unless the provided update is
+// stale. The event for the change has the Suspended, Reactivated, Banned or MarkedDormant action, for the suspended,
+// active, banned and dormant statuses respectively. It returns ErrInvalidStatus for any other status
+func (store *Store) ChangeStatus(ctx context.Context, update *userstore.User) (user userstore.User, err error) {
+	action, ok := statusActions[update.Status]
+	if !ok {
+		return user, userstore.ErrInvalidStatus
+	}
+	return store.update(ctx, update, action)
+}
+
+// update updates a single user record, unless the provided update is stale, and adds an event with the given action.
+// Changing the password also removes any password reset token, since it was issued for the old password
+func (store *Store) update(ctx context.Context, update *userstore.User, action userstore.Action) (user userstore.User, err error) {
+	err = store.modifyUser(ctx, update.ID, func(rec *userstore.Record) error {
+		usr := rec.Data
+		if usr.Version != update.Version {
+			return userstore.ErrInvalidVersion
+		}
+		usr.FirstName = update.FirstName
+		usr.LastName = update.LastName
+		usr.PasswordHash = update.PasswordHash
+		usr.Country = update.Country
+		usr.CreatedAt = update.CreatedAt
+		usr.UpdatedAt = update.UpdatedAt
+		usr.Version += 1
+		switch action {
+		case userstore.PasswordChanged:
+			rec.ResetToken = nil
+		case userstore.Anonymized:
+			usr.Nickname = update.Nickname
+			usr.Email = update.Email
+			usr.AvatarURL = update.AvatarURL
+			usr.TwoFactorEnabled = false
+			rec.ResetToken = nil
+			rec.EmailChange = nil
+			rec.TwoFactor = nil
+			rec.PreviousNicknames = nil
+		}
+		if action == statusActions[update.Status] {
+			usr.Status = update.Status
+		}
+		addEvent(rec, action)
+		user = *usr
+		return nil
+	})
+	if err != nil {
+		return userstore.User{}, err
+	}
+	return user, nil
+}
+
+// UpdateFields applies change to the user of the tenant of ctx with the given id, unless version is stale, and adds
+// an event with the Updated action. ErrNotFound is returned if there is no such user, and ErrInvalidVersion if
+// version is stale
+func (store *Store) UpdateFields(ctx context.Context, id uuid.UUID, version int64, change *userstore.Change) (user userstore.User, err error) {
+	err = store.modifyUser(ctx, id, func(rec *userstore.Record) error {
+		usr := rec.Data
+		if usr.Version != version {
+			return userstore.ErrInvalidVersion
+		}
+		for field, value := range map[*string]*string{
+			&usr.FirstName:    change.FirstName,
+			&usr.LastName:     change.LastName,
+			&usr.PasswordHash: change.PasswordHash,
+			&usr.Country:      change.Country,
+			&usr.AvatarURL:    change.AvatarURL,
+		} {
+			if value != nil {
+				*field = *value
+			}
+		}
+		usr.UpdatedAt = change.UpdatedAt
+		usr.Version += 1
+		addEvent(rec, userstore.Updated)
+		user = *usr
+		return nil
+	})
+	if err != nil {
+		return userstore.User{}, err
+	}
+	return user, nil
+}
+
+// RecordLogin records that the user of the tenant of ctx with the given id authenticated at the given time, which is
+// also the last time they were seen. ErrNotFound is returned if there is no such user
+func (store *Store) RecordLogin(ctx context.Context, id uuid.UUID, at time.Time) error {
+	return store.modifyUser(ctx, id, func(rec *userstore.Record) error {
+		rec.Data.LastLoginAt = latest(rec.Data.LastLoginAt, at)
+		rec.Data.LastSeenAt = latest(rec.Data.LastSeenAt, at)
+		return nil
+	})
+}
+
+// TouchLastSeen records that the user of the tenant of ctx with the given id was active at the given time.
+// ErrNotFound is returned if there is no such user
+func (store *Store) TouchLastSeen(ctx context.Context, id uuid.UUID, at time.Time) error {
+	return store.modifyUser(ctx, id, func(rec *userstore.Record) error {
+		rec.Data.LastSeenAt = latest(rec.Data.LastSeenAt, at)
+		return nil
+	})
+}
+
+// latest returns the later of a and b. Activity is not a change to the user, so recording it does not change the
+// version or add an event, and the times never move backwards
+func latest(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
+
+// BeginTwoFactor stores the sealed secret of a new two factor authentication enrollment of the user of the tenant of
+// ctx with the given id, replacing any enrollment which has not been confirmed. The user is not changed until the
+// enrollment is confirmed, so the version is not changed and no event is added. ErrNotFound is returned if there is
+// no such user, and ErrTwoFactorEnabled if the user already has two factor authentication enabled
+func (store *Store) BeginTwoFactor(ctx context.Context, id uuid.UUID, pendingSecret string) error {
+	return store.modifyUser(ctx, id, func(rec *userstore.Record) error {
+		if rec.Data.TwoFactorEnabled {
+			return userstore.ErrTwoFactorEnabled
+		}
+		rec.TwoFactor = &userstore.TwoFactor{PendingSecret: pendingSecret}
+		return nil
+	})
+}
+
+// EnableTwoFactor confirms the enrollment with the sealed secret pendingSecret of the user of the tenant of ctx with
+// the given id. The secret becomes the secret of the user, the code with the time step step is recorded as used,
+// and recoveryCodes, which are hashes, are stored. The event for the change has the TwoFactorEnabled action.
+// ErrNotFound is returned if there is no such user, and ErrTwoFactorNotPending if the enrollment has been replaced
+// or confirmed since it was read
+func (store *Store) EnableTwoFactor(ctx context.Context, id uuid.UUID, pendingSecret string, step int64, recoveryCodes []string) (user userstore.User, err error) {
+	err = store.modifyUser(ctx, id, func(rec *userstore.Record) error {
+		if rec.TwoFactor == nil || rec.TwoFactor.PendingSecret != pendingSecret {
+			return userstore.ErrTwoFactorNotPending
+		}
+		usr := rec.Data
+		usr.TwoFactorEnabled = true
+		usr.UpdatedAt = utctime.Now()
+		usr.Version += 1
+		rec.TwoFactor = &userstore.TwoFactor{
+			Secret:        pendingSecret,
+			LastStep:      step,
+			RecoveryCodes: append([]string(nil), recoveryCodes...),
+		}
+		addEvent(rec, userstore.TwoFactorEnabled)
+		user = *usr
+		return nil
+	})
+	if err != nil {
+		return userstore.User{}, err
+	}
+	return user, nil
+}
+
+// DisableTwoFactor turns two factor authentication off for the user of the tenant of ctx with the given id, and
+// removes its secrets. The event for the change has the TwoFactorDisabled action. ErrNotFound is returned if there
+// is no such user, and ErrTwoFactorNotEnabled if the user does not have two factor authentication enabled
+func (store *Store) DisableTwoFactor(ctx context.Context, id uuid.UUID) (user userstore.User, err error) {
+	err = store.modifyUser(ctx, id, func(rec *userstore.Record) error {
+		usr := rec.Data
+		if !usr.TwoFactorEnabled {
+			return userstore.ErrTwoFactorNotEnabled
+		}
+		usr.TwoFactorEnabled = false
+		usr.UpdatedAt = utctime.Now()
+		usr.Version += 1
+		rec.TwoFactor = nil
+		addEvent(rec, userstore.TwoFactorDisabled)
+		user = *usr
+		return nil
+	})
+	if err != nil {
+		return userstore.User{}, err
+	}
+	return user, nil
+}
+
+// UseTwoFactorStep records that a code with the time step step has been accepted for the user of the tenant of ctx
+// with the given id. ErrTwoFactorCodeRejected is returned if a code with the same or a later step has already been
+// accepted, so that codes cannot be replayed, or the user does not have two factor authentication enabled
+func (store *Store) UseTwoFactorStep(ctx context.Context, id uuid.UUID, step int64) error {
+	return store.useTwoFactorCode(ctx, id, func(twoFactor *userstore.TwoFactor) bool {
+		if twoFactor.LastStep >= step {
+			return false
+		}
+		twoFactor.LastStep = step
+		return true
+	})
+}
+
+// UseRecoveryCode removes the recovery code with the hash codeHash from the user of the tenant of ctx with the given
+// id, so that it cannot be used again. ErrTwoFactorCodeRejected is returned if the user does not have the code
+func (store *Store) UseRecoveryCode(ctx context.Context, id uuid.UUID, codeHash string) error {
+	return store.useTwoFactorCode(ctx, id, func(twoFactor *userstore.TwoFactor) bool {
+		for i, code := range twoFactor.RecoveryCodes {
+			if code == codeHash {
+				twoFactor.RecoveryCodes = append(twoFactor.RecoveryCodes[:i], twoFactor.RecoveryCodes[i+1:]...)
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// useTwoFactorCode calls use with the two factor authentication state of the user with the given id, if they have
+// two factor authentication enabled, returning ErrTwoFactorCodeRejected unless use returns true. Using a code does
+// not change the user, so the version is not changed and no event is added
+func (store *Store) useTwoFactorCode(ctx context.Context, id uuid.UUID, use func(*userstore.TwoFactor) bool) error {
+	return store.modifyUser(ctx, id, func(rec *userstore.Record) error {
+		if !rec.Data.TwoFactorEnabled || rec.TwoFactor == nil || !use(rec.TwoFactor) {
+			return userstore.ErrTwoFactorCodeRejected
+		}
+		return nil
+	})
+}
+
+// RequestPasswordReset stores a password reset token for the user of the tenant of ctx with the given id, replacing
+// any token issued before. The record stores reset, which holds the hash of token, and a PasswordResetRequested event
+// which carries token itself so that it can be sent to the user
+func (store *Store) RequestPasswordReset(ctx context.Context, id uuid.UUID, token string, reset userstore.ResetToken) error {
+	return store.modifyUser(ctx, id, func(rec *userstore.Record) error {
+		rec.ResetToken = &reset
+		evt := eventFor(userstore.PasswordResetRequested, rec.ID, rec.Data.Version, rec.Data)
+		evt.Token = token
+		rec.Events = append(rec.Events, evt)
+		return nil
+	})
+}
+
+// ResetPassword sets the password hash of the user of the tenant of ctx holding an unexpired reset token with the
+// hash tokenHash, and removes the token so that it cannot be used again. The event for the change has the
+// PasswordChanged action. ErrInvalidResetToken is returned if no user holds a matching token
+func (store *Store) ResetPassword(ctx context.Context, tokenHash, passwordHash string) (user userstore.User, err error) {
+	tenantID := tenant.FromContext(ctx)
+	now := utctime.Now()
+	find := func() *userstore.Record {
+		return store.first(func(rec *userstore.Record) bool {
+			return memquery.IsLive(rec, tenantID) && rec.ResetToken != nil && rec.ResetToken.Hash == tokenHash &&
+				rec.ResetToken.ExpiresAt.After(now)
+		})
+	}
+	err = store.modify(find, userstore.ErrInvalidResetToken, func(rec *userstore.Record) error {
+		usr := rec.Data
+		usr.PasswordHash = passwordHash
+		usr.UpdatedAt = utctime.Now()
+		usr.Version += 1
+		rec.ResetToken = nil
+		addEvent(rec, userstore.PasswordChanged)
+		user = *usr
+		return nil
+	})
+	if err != nil {
+		return userstore.User{}, err
+	}
+	return user, nil
+}
+
+// RequestEmailChange stores a change of email address for the user of the tenant of ctx with the given id, unless the
+// provided version is stale, replacing any change requested before. The record stores change, which holds the hash of
+// token, and an EmailChangeRequested event which carries token itself so that it can be sent to the new address
+func (store *Store) RequestEmailChange(ctx context.Context, id uuid.UUID, version int64, token string, change userstore.EmailChange) error {
+	return store.modifyUser(ctx, id, func(rec *userstore.Record) error {
+		if rec.Data.Version != version {
+			return userstore.ErrInvalidVersion
+		}
+		rec.EmailChange = &change
+		evt := eventFor(userstore.EmailChangeRequested, rec.ID, rec.Data.Version, rec.Data)
+		evt.Token = token
+		evt.Email = change.Email
+		rec.Events = append(rec.Events, evt)
+		return nil
+	})
+}
+
+// ConfirmEmailChange sets the email address of the user of the tenant of ctx with an unexpired email change with
+// the token hash tokenHash to the new address, and removes the change so that it cannot be confirmed again.
+// ErrEmailInUse is returned if another user has taken the address since the change was requested, and
+// ErrInvalidEmailChangeToken if no user has a matching change
+func (store *Store) ConfirmEmailChange(ctx context.Context, tokenHash string) (user userstore.User, err error) {
+	tenantID := tenant.FromContext(ctx)
+	now := utctime.Now()
+	find := func() *userstore.Record {
+		return store.first(func(rec *userstore.Record) bool {
+			return memquery.IsLive(rec, tenantID) && rec.EmailChange != nil && rec.EmailChange.Hash == tokenHash &&
+				rec.EmailChange.ExpiresAt.After(now)
+		})
+	}
+	err = store.modify(find, userstore.ErrInvalidEmailChangeToken, func(rec *userstore.Record) error {
+		usr := rec.Data
+		usr.Email = rec.EmailChange.Email
+		usr.UpdatedAt = utctime.Now()
+		usr.Version += 1
+		rec.EmailChange = nil
+		addEvent(rec, userstore.EmailChanged)
+		user = *usr
+		return nil
+	})
+	if err != nil {
+		return userstore.User{}, err
+	}
+	return user, nil
+}
+
+// ChangeNickname changes the nickname of the user of the tenant of ctx with the given id, unless version is stale,
+// adds the current nickname to the previous nicknames of the user and adds an event with the NicknameChanged action.
+// ErrNotFound is returned if there is no such user, ErrInvalidVersion if version is stale, ErrNicknameChangeTooSoon
+// if the nickname was last changed less than cooldown ago, and ErrNicknameInUse if another user has the nickname
+func (store *Store) ChangeNickname(ctx context.Context, id uuid.UUID, version int64, nickname string, cooldown time.Duration) (user userstore.User, err error) {
+	err = store.modifyUser(ctx, id, func(rec *userstore.Record) error {
+		usr := rec.Data
+		if usr.Version != version {
+			return userstore.ErrInvalidVersion
+		}
+		now := utctime.Now()
+		if n := len(rec.PreviousNicknames); n > 0 && rec.PreviousNicknames[n-1].ChangedAt.After(now.Add(-cooldown)) {
+			return userstore.ErrNicknameChangeTooSoon
+		}
+		rec.PreviousNicknames = append(rec.PreviousNicknames, userstore.PreviousNickname{Nickname: usr.Nickname, ChangedAt: now})
+		usr.Nickname = nickname
+		usr.UpdatedAt = now
+		usr.Version += 1
+		addEvent(rec, userstore.NicknameChanged)
+		user = *usr
+		return nil
+	})
+	if err != nil {
+		return userstore.User{}, err
+	}
+	return user, nil
+}
+
+// DeleteOne deletes a single user record. It is soft deleted if the store was created with NewWithRetention
+func (store *Store) DeleteOne(ctx context.Context, id uuid.UUID) error {
+	return store.modifyUser(ctx, id, func(rec *userstore.Record) error {
+		store.remove(rec)
+		return nil
+	})
+}
+
+// remove deletes rec. Soft deletes keep the data of the record, so that it can be restored, and irrecoverable deletes
+// keep the record without its data until its events are processed. Either way, the event for the deletion does not
+// carry the data, only the email address of the user, so that the deletion can be confirmed to them
+func (store *Store) remove(rec *userstore.Record) {
+	evt := eventFor(userstore.Deleted, rec.ID, math.MaxInt64, nil)
+	evt.Email = rec.Data.Email
+	if store.retention > 0 {
+		deletedAt := utctime.Now()
+		rec.DeletedAt = &deletedAt
+	} else {
+		rec.Data = nil
+	}
+	rec.Events = append(rec.Events, evt)
+}
+
+// DeleteMany deletes the user records with the given IDs and returns the IDs of the deleted records.
+// IDs of records which do not exist or are already deleted are not returned. As with DeleteOne, records are soft
+// deleted if the store was created with NewWithRetention
+func (store *Store) DeleteMany(ctx context.Context, ids []uuid.UUID) ([]uuid.UUID, error) {
+	store.mtx.Lock()
+	defer store.mtx.Unlock()
+	tenantID := tenant.FromContext(ctx)
+	var deleted []uuid.UUID
+	for _, id := range ids {
+		if rec := store.user(tenantID, id); rec != nil {
+			store.remove(rec)
+			deleted = append(deleted, id)
+		}
+	}
+	return deleted, nil
+}
+
+// Restore restores the soft deleted user record of the tenant of ctx with the given ID, if it was deleted less than
+// the retention of the store ago. The event for the restore has the Restored action, and the version of the user is
+// incremented. ErrNotFound is returned if there is no such record, which is always the case for stores which delete
+// users irrecoverably
+func (store *Store) Restore(ctx context.Context, id uuid.UUID) (user userstore.User, err error) {
+	tenantID := tenant.FromContext(ctx)
+	cutoff := utctime.Now().Add(-store.retention)
+	find := func() *userstore.Record {
+		rec, ok := store.records[id]
+		if !ok || rec.Tenant != tenantID || rec.Data == nil || rec.DeletedAt == nil || !rec.DeletedAt.After(cutoff) {
+			return nil
+		}
+		return rec
+	}
+	err = store.modify(find, userstore.ErrNotFound, func(rec *userstore.Record) error {
+		usr := rec.Data
+		usr.UpdatedAt = utctime.Now()
+		usr.Version += 1
+		rec.DeletedAt = nil
+		addEvent(rec, userstore.Restored)
+		user = *usr
+		return nil
+	})
+	if err != nil {
+		return userstore.User{}, err
+	}
+	return user, nil
+}
+
+// Replay adds an event with the Replayed action carrying the current state of the user of the tenant of ctx with the
+// given id, without changing the user or its version. ErrNotFound is returned if there is no such user
+func (store *Store) Replay(ctx context.Context, id uuid.UUID) (user userstore.User, err error) {
+	err = store.modifyUser(ctx, id, func(rec *userstore.Record) error {
+		addEvent(rec, userstore.Replayed)
+		user = *rec.Data
+		return nil
+	})
+	if err != nil {
+		return userstore.User{}, err
+	}
+	return user, nil
+}
+
+// Purge irrecoverably deletes the records of every tenant which were soft deleted more than the retention of the store
+// ago, returning the number of records purged. No events are added, since the deletions have already been published
+func (store *Store) Purge(ctx context.Context) (int64, error) {
+	if store.retention == 0 {
+		return 0, nil
+	}
+	return store.PurgeDeletedBefore(ctx, utctime.Now().Add(-store.retention))
+}
+
+// PurgeDeletedBefore irrecoverably deletes the records of every tenant which were soft deleted at or before cutoff,
+// returning the number of records purged
+func (store *Store) PurgeDeletedBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	store.mtx.Lock()
+	defer store.mtx.Unlock()
+	var purged int64
+	for _, rec := range store.records {
+		if rec.DeletedAt == nil || rec.DeletedAt.After(cutoff) {
+			continue
+		}
+		rec.Data = nil
+		rec.DeletedAt = nil
+		rec.ResetToken = nil
+		rec.EmailChange = nil
+		purged += 1
+	}
+	return purged, nil
+}
+
+// MarkDormant changes the status of the active users of every tenant who have not been seen since the given time,
+// including users created before it who have never been seen, to dormant, adding an event with the MarkedDormant
+// action for each. It returns the number of users made dormant
+func (store *Store) MarkDormant(ctx context.Context, inactiveSince time.Time) (int64, error) {
+	store.mtx.Lock()
+	defer store.mtx.Unlock()
+	var marked int64
+	for _, rec := range store.records {
+		if !memquery.IsLive(rec, rec.Tenant) || !memquery.IsActive(rec.Data) || !memquery.IsInactive(rec.Data, inactiveSince) {
+			continue
+		}
+		rec.Data.Status = userstore.StatusDormant
+		rec.Data.UpdatedAt = utctime.Now()
+		rec.Data.Version += 1
+		addEvent(rec, userstore.MarkedDormant)
+		marked += 1
+	}
+	return marked, nil
+}
+
+// find returns copies of the users matching query, in the order given by the query. ErrInvalidSort is returned if
+// the query has an unknown sort
+func (store *Store) find(ctx context.Context, query *userstore.Query) ([]userstore.Record, error) {
+	if _, err := memquery.Order(query); err != nil {
+		return nil, err
+	}
+
+	store.mtx.Lock()
+	match := memquery.Match(ctx, query)
+	var recs []userstore.Record
+	for _, rec := range store.records {
+		if match(rec) {
+			recs = append(recs, cloneRecord(rec))
+		}
+	}
+	store.mtx.Unlock()
+
+	return recs, memquery.Sort(recs, query)
+}
+
+// FindMany fetches pages of users matching the given query. Each request also returns the total count of users
+func (store *Store) FindMany(ctx context.Context, query *userstore.Query) (page userstore.Page, err error) {
+	recs, err := store.find(ctx, query)
+	if err != nil {
+		return page, err
+	}
+	return memquery.PageOf(recs, query), nil
+}
+
+// Count returns the total count of users matching the given query, without fetching any of them.
+// The length, page and sort of the query are ignored
+func (store *Store) Count(ctx context.Context, query *userstore.Query) (int64, error) {
+	store.mtx.Lock()
+	defer store.mtx.Unlock()
+	match := memquery.Match(ctx, query)
+	var total int64
+	for _, rec := range store.records {
+		if match(rec) {
+			total += 1
+		}
+	}
+	return total, nil
+}
+
+// Iterate returns a UserIterator over all of the users matching the given query, in the order given by the query.
+// The length and page of the query are ignored. The users are copied when Iterate is called, so changes made while
+// iterating are not seen
+func (store *Store) Iterate(ctx context.Context, query *userstore.Query) (userstore.UserIterator, error) {
+	recs, err := store.find(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return userstore.NewIterator(memquery.NewCursor(recs)), nil
+}
+
+// Stats counts the users matching the given query by country and by the interval in which they were created. Weeks
+// start on Monday, and periods start at midnight UTC. The length, page and sort of the query are ignored
+func (store *Store) Stats(ctx context.Context, query *userstore.Query, interval userstore.StatsInterval) (userstore.Stats, error) {
+	tally, err := memquery.NewTally(interval)
+	if err != nil {
+		return userstore.Stats{}, err
+	}
+	store.mtx.Lock()
+	defer store.mtx.Unlock()
+	match := memquery.Match(ctx, query)
+	for _, rec := range store.records {
+		if match(rec) {
+			tally.Add(rec.Data)
+		}
+	}
+	return tally.Stats(), nil
+}
+
+// Backlog measures the events of every tenant which have not been processed, so that publishing falling behind can
+// be detected
+func (store *Store) Backlog(ctx context.Context) (userstore.Backlog, error) {
+	store.mtx.Lock()
+	defer store.mtx.Unlock()
+	var backlog userstore.Backlog
+	for _, rec := range store.records {
+		// the events of a user with a dead lettered event wait until it is requeued
+		if len(rec.Events) == 0 || rec.Events[0].State == userstore.DeadLettered {
+			continue
+		}
+		backlog.Pending += int64(len(rec.Events))
+		// the events of a record are in the order they were created
+		if oldest := rec.Events[0].CreatedAt; backlog.Oldest.IsZero() || oldest.Before(backlog.Oldest) {
+			backlog.Oldest = oldest
+		}
+	}
+	return backlog, nil
+}
+
+// nextEvents marks the first events of up to eventBatchSize of the records whose first events have waited longest as
+// processing, and returns them, oldest first. Only the first event of each record can be processed, so that the events
+// of a user are published in order. An event which has been processing for longer than the retry timeout is processed
+// again
+func (store *Store) nextEvents(retryTimeout time.Duration) []userstore.Event {
+	store.mtx.Lock()
+	defer store.mtx.Unlock()
+	now := utctime.Now()
+	var waiting []*userstore.Record
+	for _, rec := range store.records {
+		if len(rec.Events) == 0 {
+			continue
+		}
+		head := rec.Events[0]
+		if head.State == userstore.Pending ||
+			(head.State == userstore.Processing && head.UpdatedAt.Before(now.Add(-retryTimeout))) {
+			waiting = append(waiting, rec)
+		}
+	}
+	sort.Slice(waiting, func(i, j int) bool {
+		return waiting[i].Events[0].UpdatedAt.Before(waiting[j].Events[0].UpdatedAt)
+	})
+	if len(waiting) > eventBatchSize {
+		waiting = waiting[:eventBatchSize]
+	}
+	events := make([]userstore.Event, 0, len(waiting))
+	for _, rec := range waiting {
+		rec.Events[0].State = userstore.Processing
+		rec.Events[0].UpdatedAt = now
+		rec.Events[0].Attempts++
+		evt := rec.Events[0]
+		evt.Tenant = rec.Tenant
+		events = append(events, evt)
+	}
+	return events
+}
+
+// Events returns a channel of events from the store. Events are claimed in batches of up to eventBatchSize, and the
+// next batch is claimed without waiting when a batch is full
+func (store *Store) Events(ctx context.Context, minInterval, maxInterval, retryTimeout time.Duration) <-chan userstore.EventResult {
+	out := make(chan userstore.EventResult)
+	go func() {
+		defer close(out)
+		source := rand.New(rand.NewSource(utctime.Now().UnixNano()))
+		for {
+			events := store.nextEvents(retryTimeout)
+			for _, event := range events {
+				select {
+				case <-ctx.Done():
+					return
+				case out <- userstore.EventResult{Event: event}:
+				}
+			}
+			if len(events) < eventBatchSize {
+				// the wait is also made when there are no waiting events, so that the store is not polled in a tight loop
+				waitWithJitter(ctx, minInterval, maxInterval, source)
+			}
+			if ctx.Err() != nil {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+func waitWithJitter(ctx context.Context, minInterval, maxInterval time.Duration, source *rand.Rand) {
+	min, max := int64(minInterval), int64(maxInterval)
+	after := time.After(minInterval + time.Duration(source.Int63n(max-min)))
+	select {
+	case <-ctx.Done():
+	case <-after:
+	}
+}
+
+// ProcessEvent marks the matching event as processed by removing it from the store
+func (store *Store) ProcessEvent(ctx context.Context, id uuid.UUID, version int64) error {
+	store.mtx.Lock()
+	defer store.mtx.Unlock()
+	rec, ok := store.records[id]
+	if !ok || len(rec.Events) == 0 {
+		return nil
+	}
+	if head := rec.Events[0]; head.State == userstore.Processing && head.Version == version {
+		rec.Events = append([]userstore.Event(nil), rec.Events[1:]...)
+	}
+	return nil
+}
+
+// DeadLetterEvent moves the matching event, which must be being processed, to the DeadLettered state, so that it is
+// not processed again until it is requeued with RequeueDeadLetter
+func (store *Store) DeadLetterEvent(ctx context.Context, id uuid.UUID, version int64) error {
+	store.mtx.Lock()
+	defer store.mtx.Unlock()
+	rec, ok := store.records[id]
+	if !ok || len(rec.Events) == 0 {
+		return nil
+	}
+	if head := rec.Events[0]; head.State == userstore.Processing && head.Version == version {
+		rec.Events[0].State = userstore.DeadLettered
+		rec.Events[0].UpdatedAt = utctime.Now()
+	}
+	return nil
+}
+
+// DeadLetters reads the dead lettered events of the users of the tenant of ctx, including deleted users, in the order
+// they were dead lettered
+func (store *Store) DeadLetters(ctx context.Context) ([]userstore.Event, error) {
+	store.mtx.Lock()
+	defer store.mtx.Unlock()
+	tenantID := tenant.FromContext(ctx)
+	events := make([]userstore.Event, 0)
+	for _, rec := range store.records {
+		if rec.Tenant != tenantID || len(rec.Events) == 0 || rec.Events[0].State != userstore.DeadLettered {
+			continue
+		}
+		evt := rec.Events[0]
+		evt.Tenant = rec.Tenant
+		events = append(events, evt)
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].UpdatedAt.Before(events[j].UpdatedAt) })
+	return events, nil
+}
+
+// RequeueDeadLetter returns the dead lettered event of the user identified by id to the Pending state, with no
+// attempts, so that it is processed again. It returns userstore.ErrNotFound if the user, in the tenant of ctx, has no
+// dead lettered event
+func (store *Store) RequeueDeadLetter(ctx context.Context, id uuid.UUID) error {
+	store.mtx.Lock()
+	defer store.mtx.Unlock()
+	rec, ok := store.records[id]
+	if !ok || rec.Tenant != tenant.FromContext(ctx) || len(rec.Events) == 0 ||
+		rec.Events[0].State != userstore.DeadLettered {
+		return userstore.ErrNotFound
+	}
+	rec.Events[0].State = userstore.Pending
+	rec.Events[0].UpdatedAt = utctime.Now()
+	rec.Events[0].Attempts = 0
+	return nil
+}
@@ -0,0 +1,22 @@
+package memuserstore_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/robotlovesyou/fitest/pkg/store/memuserstore"
+	"github.com/robotlovesyou/fitest/pkg/store/storetest"
+	"github.com/robotlovesyou/fitest/pkg/user"
+)
+
+// the store must be usable in place of the mongo store
+var _ user.UserStore = (*memuserstore.Store)(nil)
+
+func TestStoreConformsToTheSuite(t *testing.T) {
+	storetest.Run(t, func(t *testing.T, retention time.Duration) storetest.Store {
+		if retention == 0 {
+			return memuserstore.New()
+		}
+		return memuserstore.NewWithRetention(retention)
+	})
+}
@@ -0,0 +1,133 @@
+// Package migrate runs versioned migrations of the schema and records of a store.
+// Migrations are applied in order of their versions, and each is recorded once it has been applied, so that it is
+// only ever applied once. A lock held while migrations run stops several runners, such as instances of the service
+// starting together, from applying the same migrations at once.
+// The package does not know about any particular database: each store provides its migrations along with a Recorder
+// which records them in its own database
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/utctime"
+)
+
+const (
+	// LockLease is the time a lock is held for before it expires, so that a runner which stops without releasing it
+	// does not stop migrations forever. It must be longer than the longest migration. It should probably be
+	// configurable
+	LockLease = 10 * time.Minute
+
+	// lockRetryInterval is the time waited before trying again to take a lock held by another runner
+	lockRetryInterval = time.Second
+)
+
+var (
+	// ErrLocked is returned by Recorder.Lock when another runner holds the lock
+	ErrLocked = errors.New("migrations are locked by another runner")
+	// ErrInvalidOrder is returned when migrations are not in increasing order of version
+	ErrInvalidOrder = errors.New("migrations are not in increasing order of version")
+	// ErrUnknownMigration is returned when the store has a migration applied which is not known, which happens when it
+	// has been migrated by a newer release
+	ErrUnknownMigration = errors.New("store has an unknown migration applied")
+)
+
+// Migration is a change to the schema or records of a store. Up should leave the store unchanged if it fails, or be
+// safe to run again, since a migration which fails is not recorded and is run again by the next runner
+type Migration struct {
+	Version int64
+	Name    string
+	Up      func(ctx context.Context) error
+}
+
+// Applied records a migration which has been applied
+type Applied struct {
+	Version   int64
+	Name      string
+	AppliedAt time.Time
+}
+
+// Recorder records the migrations applied to a store, and holds the lock which allows a single runner to apply them
+type Recorder interface {
+	// Lock takes the lock for owner until expiresAt, unless another owner holds a lock which has not expired, in which
+	// case it returns ErrLocked
+	Lock(ctx context.Context, owner string, expiresAt time.Time) error
+	// Unlock releases the lock held by owner. It does nothing if owner does not hold the lock
+	Unlock(ctx context.Context, owner string) error
+	// Applied returns the migrations which have been applied, in any order
+	Applied(ctx context.Context) ([]Applied, error)
+	// Record records that a migration has been applied
+	Record(ctx context.Context, applied Applied) error
+}
+
+// Run applies the migrations which have not yet been applied, in order, and returns the migrations it applied.
+// If another runner holds the lock, Run waits until it is released, or until ctx is done. Migrations applied before
+// an error are recorded, so a later run continues from the migration which failed
+func Run(ctx context.Context, recorder Recorder, migrations []Migration) ([]Migration, error) {
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version <= migrations[i-1].Version {
+			return nil, fmt.Errorf("%w: %d follows %d", ErrInvalidOrder, migrations[i].Version, migrations[i-1].Version)
+		}
+	}
+
+	owner := uuid.Must(uuid.NewRandom()).String()
+	if err := lock(ctx, recorder, owner); err != nil {
+		return nil, err
+	}
+	// the lock is released even if ctx is done, so that the next runner does not wait for it to expire
+	defer recorder.Unlock(context.Background(), owner)
+
+	applied, err := recorder.Applied(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read applied migrations: %w", err)
+	}
+	known := make(map[int64]bool, len(migrations))
+	for _, migration := range migrations {
+		known[migration.Version] = true
+	}
+	done := make(map[int64]bool, len(applied))
+	for _, a := range applied {
+		if !known[a.Version] {
+			return nil, fmt.Errorf("%w: %d %s", ErrUnknownMigration, a.Version, a.Name)
+		}
+		done[a.Version] = true
+	}
+
+	var ran []Migration
+	for _, migration := range migrations {
+		if done[migration.Version] {
+			continue
+		}
+		if err := migration.Up(ctx); err != nil {
+			return ran, fmt.Errorf("cannot apply migration %d %s: %w", migration.Version, migration.Name, err)
+		}
+		err := recorder.Record(ctx, Applied{Version: migration.Version, Name: migration.Name, AppliedAt: utctime.Now()})
+		if err != nil {
+			return ran, fmt.Errorf("cannot record migration %d %s: %w", migration.Version, migration.Name, err)
+		}
+		ran = append(ran, migration)
+	}
+	return ran, nil
+}
+
+// lock takes the lock for owner, waiting for any other runner to release it
+func lock(ctx context.Context, recorder Recorder, owner string) error {
+	for {
+		err := recorder.Lock(ctx, owner, utctime.Now().Add(LockLease))
+		if !errors.Is(err, ErrLocked) {
+			if err != nil {
+				return fmt.Errorf("cannot lock migrations: %w", err)
+			}
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("cannot lock migrations: %w", ctx.Err())
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
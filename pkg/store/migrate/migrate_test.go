@@ -0,0 +1,162 @@
+package migrate_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/robotlovesyou/fitest/pkg/store/migrate"
+	"github.com/robotlovesyou/fitest/pkg/utctime"
+	"github.com/stretchr/testify/require"
+)
+
+const testTimeout = 10 * time.Second
+
+type stubRecorder struct {
+	mu        sync.Mutex
+	owner     string
+	expiresAt time.Time
+	applied   []migrate.Applied
+}
+
+func (sr *stubRecorder) Lock(_ context.Context, owner string, expiresAt time.Time) error {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	if sr.owner != "" && sr.owner != owner && sr.expiresAt.After(utctime.Now()) {
+		return migrate.ErrLocked
+	}
+	sr.owner = owner
+	sr.expiresAt = expiresAt
+	return nil
+}
+
+func (sr *stubRecorder) Unlock(_ context.Context, owner string) error {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	if sr.owner == owner {
+		sr.owner = ""
+	}
+	return nil
+}
+
+func (sr *stubRecorder) Applied(context.Context) ([]migrate.Applied, error) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	return append([]migrate.Applied(nil), sr.applied...), nil
+}
+
+func (sr *stubRecorder) Record(_ context.Context, applied migrate.Applied) error {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	sr.applied = append(sr.applied, applied)
+	return nil
+}
+
+// recording returns a migration which appends its version to ran when it is applied
+func recording(version int64, ran *[]int64) migrate.Migration {
+	return migrate.Migration{Version: version, Name: "test", Up: func(context.Context) error {
+		*ran = append(*ran, version)
+		return nil
+	}}
+}
+
+func withContext(f func(context.Context)) {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	f(ctx)
+}
+
+func TestMigrationsAreAppliedInOrderOnce(t *testing.T) {
+	withContext(func(ctx context.Context) {
+		var ran []int64
+		recorder := &stubRecorder{}
+		migrations := []migrate.Migration{recording(1, &ran), recording(2, &ran), recording(5, &ran)}
+
+		applied, err := migrate.Run(ctx, recorder, migrations)
+		require.NoError(t, err)
+		require.Len(t, applied, 3)
+		require.Equal(t, []int64{1, 2, 5}, ran)
+		require.Len(t, recorder.applied, 3)
+		require.Empty(t, recorder.owner)
+
+		applied, err = migrate.Run(ctx, recorder, append(migrations, recording(6, &ran)))
+		require.NoError(t, err)
+		require.Len(t, applied, 1)
+		require.Equal(t, []int64{1, 2, 5, 6}, ran)
+	})
+}
+
+func TestMigrationsOutOfOrderAreRejected(t *testing.T) {
+	withContext(func(ctx context.Context) {
+		var ran []int64
+		cases := [][]migrate.Migration{
+			{recording(2, &ran), recording(1, &ran)},
+			{recording(1, &ran), recording(1, &ran)},
+		}
+		for _, c := range cases {
+			thisCase := c
+			_, err := migrate.Run(ctx, &stubRecorder{}, thisCase)
+			require.ErrorIs(t, err, migrate.ErrInvalidOrder)
+		}
+		require.Empty(t, ran)
+	})
+}
+
+func TestUnknownAppliedMigrationsAreRejected(t *testing.T) {
+	withContext(func(ctx context.Context) {
+		var ran []int64
+		recorder := &stubRecorder{applied: []migrate.Applied{{Version: 7, Name: "newer"}}}
+		_, err := migrate.Run(ctx, recorder, []migrate.Migration{recording(1, &ran)})
+		require.ErrorIs(t, err, migrate.ErrUnknownMigration)
+		require.Empty(t, ran)
+		require.Empty(t, recorder.owner)
+	})
+}
+
+func TestFailedMigrationIsNotRecordedAndStopsLaterMigrations(t *testing.T) {
+	withContext(func(ctx context.Context) {
+		var ran []int64
+		failure := errors.New("failed")
+		recorder := &stubRecorder{}
+		migrations := []migrate.Migration{
+			recording(1, &ran),
+			{Version: 2, Name: "failing", Up: func(context.Context) error { return failure }},
+			recording(3, &ran),
+		}
+		applied, err := migrate.Run(ctx, recorder, migrations)
+		require.ErrorIs(t, err, failure)
+		require.Len(t, applied, 1)
+		require.Equal(t, []int64{1}, ran)
+		require.Len(t, recorder.applied, 1)
+		require.Empty(t, recorder.owner)
+	})
+}
+
+func TestRunWaitsForTheLockToBeReleased(t *testing.T) {
+	withContext(func(ctx context.Context) {
+		var ran []int64
+		recorder := &stubRecorder{owner: "other", expiresAt: utctime.Now().Add(time.Hour)}
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			_ = recorder.Unlock(ctx, "other")
+		}()
+		_, err := migrate.Run(ctx, recorder, []migrate.Migration{recording(1, &ran)})
+		require.NoError(t, err)
+		require.Equal(t, []int64{1}, ran)
+	})
+}
+
+func TestRunGivesUpWaitingForTheLockWhenContextIsDone(t *testing.T) {
+	withContext(func(ctx context.Context) {
+		var ran []int64
+		recorder := &stubRecorder{owner: "other", expiresAt: utctime.Now().Add(time.Hour)}
+		ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+		_, err := migrate.Run(ctx, recorder, []migrate.Migration{recording(1, &ran)})
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.Empty(t, ran)
+		require.Equal(t, "other", recorder.owner)
+	})
+}
@@ -0,0 +1,184 @@
+// Package pguserstore implements a store for user details backed by PostgreSQL, using the store of the sqlstore
+// package with the dialect of PostgreSQL
+package pguserstore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/robotlovesyou/fitest/pkg/store/sqlstore"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+)
+
+const (
+	// codeUniqueViolation is the SQLSTATE returned by postgres when a write conflicts with a unique index
+	codeUniqueViolation = "23505"
+
+	// Names of the unique indexes on email addresses and nicknames, which are named in unique violation errors
+	emailIndex    = "users_tenant_email_key"
+	nicknameIndex = "users_tenant_nickname_key"
+)
+
+// schema creates the tables and indexes required by the store. As with the indexes of the userstore package, each
+// index used by queries for users is prefixed with the tenant, so that uniqueness is scoped to the tenant
+const schema = `
+CREATE TABLE IF NOT EXISTS users (
+	id                        uuid PRIMARY KEY,
+	tenant                    text NOT NULL,
+	first_name                text NOT NULL,
+	last_name                 text NOT NULL,
+	nickname                  text NOT NULL,
+	password_hash             text NOT NULL,
+	email                     text NOT NULL,
+	country                   text NOT NULL,
+	avatar_url                text NOT NULL DEFAULT '',
+	created_at                timestamptz NOT NULL,
+	updated_at                timestamptz NOT NULL,
+	version                   bigint NOT NULL,
+	status                    text NOT NULL DEFAULT '',
+	last_login_at             timestamptz,
+	last_seen_at              timestamptz,
+	two_factor_enabled        boolean NOT NULL DEFAULT false,
+	reset_token_hash          text,
+	reset_token_expires_at    timestamptz,
+	email_change_email        text,
+	email_change_hash         text,
+	email_change_expires_at   timestamptz,
+	two_factor_pending_secret text,
+	two_factor_secret         text,
+	two_factor_last_step      bigint NOT NULL DEFAULT 0,
+	two_factor_recovery_codes text[],
+	deleted_at                timestamptz,
+	previous_nicknames        jsonb NOT NULL DEFAULT '[]'
+);
+CREATE UNIQUE INDEX IF NOT EXISTS users_tenant_email_key ON users (tenant, email);
+CREATE UNIQUE INDEX IF NOT EXISTS users_tenant_nickname_key ON users (tenant, nickname);
+CREATE INDEX IF NOT EXISTS users_tenant_created_at_country_idx ON users (tenant, created_at, country);
+CREATE INDEX IF NOT EXISTS users_tenant_updated_at_idx ON users (tenant, updated_at);
+CREATE INDEX IF NOT EXISTS users_tenant_last_name_idx ON users (tenant, last_name);
+CREATE INDEX IF NOT EXISTS users_tenant_first_name_idx ON users (tenant, first_name);
+CREATE INDEX IF NOT EXISTS users_tenant_lower_first_name_idx ON users (tenant, lower(first_name) text_pattern_ops);
+CREATE INDEX IF NOT EXISTS users_tenant_lower_last_name_idx ON users (tenant, lower(last_name) text_pattern_ops);
+CREATE INDEX IF NOT EXISTS users_tenant_last_seen_at_idx ON users (tenant, last_seen_at);
+CREATE INDEX IF NOT EXISTS users_tenant_reset_token_hash_idx ON users (tenant, reset_token_hash)
+	WHERE reset_token_hash IS NOT NULL;
+CREATE INDEX IF NOT EXISTS users_tenant_email_change_hash_idx ON users (tenant, email_change_hash)
+	WHERE email_change_hash IS NOT NULL;
+CREATE INDEX IF NOT EXISTS users_deleted_at_idx ON users (deleted_at) WHERE deleted_at IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS user_idempotency_keys (
+	tenant       text NOT NULL,
+	key          text NOT NULL,
+	user_id      uuid NOT NULL,
+	payload_hash text NOT NULL DEFAULT '',
+	PRIMARY KEY (tenant, key)
+);
+
+CREATE TABLE IF NOT EXISTS user_events (
+	seq        bigserial PRIMARY KEY,
+	user_id    uuid NOT NULL,
+	tenant     text NOT NULL,
+	state      text NOT NULL,
+	action     text NOT NULL,
+	version    bigint NOT NULL,
+	created_at timestamptz NOT NULL,
+	updated_at timestamptz NOT NULL,
+	data       jsonb,
+	token      text,
+	email      text,
+	attempts   bigint NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS user_events_user_id_seq_idx ON user_events (user_id, seq);
+CREATE INDEX IF NOT EXISTS user_events_updated_at_idx ON user_events (updated_at);
+`
+
+// truncUnits maps each StatsInterval to the unit postgres truncates the time users were created to
+var truncUnits = map[userstore.StatsInterval]string{
+	userstore.IntervalDay:   "day",
+	userstore.IntervalWeek:  "week",
+	userstore.IntervalMonth: "month",
+}
+
+// Store provides services for storing and retrieving data. It returns the same errors as the userstore package
+type Store = sqlstore.Store
+
+type Monitor = sqlstore.Monitor
+
+func NewMonitor(store *Store) *Monitor {
+	return sqlstore.NewMonitor(store)
+}
+
+// New creates a new store, which deletes users irrecoverably
+func New(db *sql.DB) *Store {
+	return sqlstore.New(db, dialect{}, 0)
+}
+
+// NewWithRetention creates a new store which soft deletes users. Soft deleted users are excluded from reads, can be
+// restored with Restore until retention has passed, and are then deleted irrecoverably by Purge
+func NewWithRetention(db *sql.DB, retention time.Duration) *Store {
+	return sqlstore.New(db, dialect{}, retention)
+}
+
+// dialect is the sqlstore.Dialect of PostgreSQL
+type dialect struct{}
+
+func (dialect) Schema() string {
+	return schema
+}
+
+func (dialect) ConflictError(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) || pqErr.Code != codeUniqueViolation {
+		return nil
+	}
+	switch pqErr.Constraint {
+	case emailIndex:
+		return userstore.ErrEmailInUse
+	case nicknameIndex:
+		return userstore.ErrNicknameInUse
+	default:
+		return userstore.ErrAlreadyExists
+	}
+}
+
+func (dialect) Lock(skipLocked bool) string {
+	if skipLocked {
+		return " FOR UPDATE SKIP LOCKED"
+	}
+	return " FOR UPDATE"
+}
+
+func (dialect) RecoveryCodes(codes []string) interface{} {
+	return pq.Array(codes)
+}
+
+func (dialect) ScanRecoveryCodes(codes *[]string) interface{} {
+	return pq.Array(codes)
+}
+
+func (dialect) Latest(column, placeholder string) string {
+	// GREATEST ignores NULL, so users who have never been seen are changed
+	return fmt.Sprintf("GREATEST(%s, %s::timestamptz)", column, placeholder)
+}
+
+func (dialect) Search(arg func(interface{}) string, search string) string {
+	return fmt.Sprintf("(nickname = %[1]s OR email = %[1]s OR first_name LIKE %[2]s OR last_name LIKE %[2]s)",
+		arg(search), arg(sqlstore.LikePrefix(search)))
+}
+
+func (dialect) NamePrefix(arg func(interface{}) string, prefix string) string {
+	// the lower case names are indexed, so that the prefix is found without reading every user
+	pattern := arg(sqlstore.LikePrefix(prefix))
+	return fmt.Sprintf("(lower(first_name) LIKE lower(%[1]s) OR lower(last_name) LIKE lower(%[1]s))", pattern)
+}
+
+func (dialect) PeriodStart(interval userstore.StatsInterval) (string, bool) {
+	unit, ok := truncUnits[interval]
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("to_char(date_trunc('%s', created_at AT TIME ZONE 'UTC'), 'YYYY-MM-DD')", unit), true
+}
@@ -0,0 +1,76 @@
+package pguserstore_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/store/pguserstore"
+	"github.com/robotlovesyou/fitest/pkg/store/storetest"
+	"github.com/robotlovesyou/fitest/pkg/user"
+	"github.com/stretchr/testify/require"
+)
+
+const timeout = 10 * time.Second
+
+// the store must be usable in place of the mongo store
+var _ user.UserStore = (*pguserstore.Store)(nil)
+
+// testURI returns the URI of the test database along with the URI of a schema of it which is unique to the test, so
+// that tests do not see each other's users
+func testURI() (string, string, string) {
+	uriStr := os.Getenv("POSTGRES_TEST_URI")
+	parsed, err := url.Parse(uriStr)
+	if err != nil {
+		panic(fmt.Sprintf("cannot parse '%s' as a url: %v", uriStr, err))
+	}
+
+	schema := fmt.Sprintf("test%s", strings.ReplaceAll(uuid.Must(uuid.NewRandom()).String(), "-", ""))
+
+	qry := parsed.Query()
+	qry.Set("search_path", schema)
+	scoped := *parsed
+	scoped.RawQuery = qry.Encode()
+
+	return parsed.String(), scoped.String(), schema
+}
+
+// newTestStore returns a store created by newStore in a schema of its own, which is dropped when t finishes
+func newTestStore(t *testing.T, newStore func(*sql.DB) *pguserstore.Store) *pguserstore.Store {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	uri, scopedURI, schema := testURI()
+	admin, err := sql.Open("postgres", uri)
+	require.NoError(t, err)
+	_, err = admin.ExecContext(ctx, "CREATE SCHEMA "+schema)
+	require.NoError(t, err)
+	db, err := sql.Open("postgres", scopedURI)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		db.Close()
+		admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+		admin.Close()
+	})
+
+	store := newStore(db)
+	require.NoError(t, store.EnsureSchema(ctx))
+	return store
+}
+
+func TestStoreConformsToTheSuite(t *testing.T) {
+	storetest.Run(t, func(t *testing.T, retention time.Duration) storetest.Store {
+		if retention == 0 {
+			return newTestStore(t, pguserstore.New)
+		}
+		return newTestStore(t, func(db *sql.DB) *pguserstore.Store {
+			return pguserstore.NewWithRetention(db, retention)
+		})
+	})
+}
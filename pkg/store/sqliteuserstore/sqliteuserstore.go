@@ -0,0 +1,251 @@
+// Package sqliteuserstore implements a store for user details backed by SQLite, for single node deployments which
+// cannot run a separate database. It uses the store of the sqlstore package with the dialect of SQLite
+package sqliteuserstore
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/robotlovesyou/fitest/pkg/store/sqlstore"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+const (
+	// busyTimeout is the time, in milliseconds, a connection waits for another connection to finish writing before
+	// failing. It should probably be configurable
+	busyTimeout = 5000
+
+	// Columns of the unique indexes on email addresses and nicknames, which are named in unique constraint errors
+	emailColumn    = "users.email"
+	nicknameColumn = "users.nickname"
+)
+
+// schema creates the tables and indexes required by the store. As with the indexes of the userstore package, each
+// index used by queries for users is prefixed with the tenant, so that uniqueness is scoped to the tenant.
+// SQLite has no time type, so times are stored as the text the store writes them as, which sorts in the same order as
+// the times it holds and is understood by the date functions of SQLite. Recovery codes and previous nicknames are
+// stored as JSON arrays, and booleans as integers
+const schema = `
+CREATE TABLE IF NOT EXISTS users (
+	id                        text PRIMARY KEY,
+	tenant                    text NOT NULL,
+	first_name                text NOT NULL,
+	last_name                 text NOT NULL,
+	nickname                  text NOT NULL,
+	password_hash             text NOT NULL,
+	email                     text NOT NULL,
+	country                   text NOT NULL,
+	avatar_url                text NOT NULL DEFAULT '',
+	created_at                text NOT NULL,
+	updated_at                text NOT NULL,
+	version                   integer NOT NULL,
+	status                    text NOT NULL DEFAULT '',
+	last_login_at             text,
+	last_seen_at              text,
+	two_factor_enabled        integer NOT NULL DEFAULT 0,
+	reset_token_hash          text,
+	reset_token_expires_at    text,
+	email_change_email        text,
+	email_change_hash         text,
+	email_change_expires_at   text,
+	two_factor_pending_secret text,
+	two_factor_secret         text,
+	two_factor_last_step      integer NOT NULL DEFAULT 0,
+	two_factor_recovery_codes text,
+	deleted_at                text,
+	previous_nicknames        text NOT NULL DEFAULT '[]'
+);
+CREATE UNIQUE INDEX IF NOT EXISTS users_tenant_email_key ON users (tenant, email);
+CREATE UNIQUE INDEX IF NOT EXISTS users_tenant_nickname_key ON users (tenant, nickname);
+CREATE INDEX IF NOT EXISTS users_tenant_created_at_country_idx ON users (tenant, created_at, country);
+CREATE INDEX IF NOT EXISTS users_tenant_updated_at_idx ON users (tenant, updated_at);
+CREATE INDEX IF NOT EXISTS users_tenant_last_name_idx ON users (tenant, last_name);
+CREATE INDEX IF NOT EXISTS users_tenant_first_name_idx ON users (tenant, first_name);
+CREATE INDEX IF NOT EXISTS users_tenant_first_name_nocase_idx ON users (tenant, first_name COLLATE NOCASE);
+CREATE INDEX IF NOT EXISTS users_tenant_last_name_nocase_idx ON users (tenant, last_name COLLATE NOCASE);
+CREATE INDEX IF NOT EXISTS users_tenant_last_seen_at_idx ON users (tenant, last_seen_at);
+CREATE INDEX IF NOT EXISTS users_tenant_reset_token_hash_idx ON users (tenant, reset_token_hash)
+	WHERE reset_token_hash IS NOT NULL;
+CREATE INDEX IF NOT EXISTS users_tenant_email_change_hash_idx ON users (tenant, email_change_hash)
+	WHERE email_change_hash IS NOT NULL;
+CREATE INDEX IF NOT EXISTS users_deleted_at_idx ON users (deleted_at) WHERE deleted_at IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS user_idempotency_keys (
+	tenant       text NOT NULL,
+	key          text NOT NULL,
+	user_id      text NOT NULL,
+	payload_hash text NOT NULL DEFAULT '',
+	PRIMARY KEY (tenant, key)
+);
+
+CREATE TABLE IF NOT EXISTS user_events (
+	seq        integer PRIMARY KEY AUTOINCREMENT,
+	user_id    text NOT NULL,
+	tenant     text NOT NULL,
+	state      text NOT NULL,
+	action     text NOT NULL,
+	version    integer NOT NULL,
+	created_at text NOT NULL,
+	updated_at text NOT NULL,
+	data       text,
+	token      text,
+	email      text,
+	attempts   integer NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS user_events_user_id_seq_idx ON user_events (user_id, seq);
+CREATE INDEX IF NOT EXISTS user_events_updated_at_idx ON user_events (updated_at);
+`
+
+// periodStarts maps each StatsInterval to the expression for the date of the start of the period in which a user was
+// created. The 'weekday 0' modifier advances to the next Sunday unless the date is a Sunday, so going back six days
+// from it gives the Monday the week started on
+var periodStarts = map[userstore.StatsInterval]string{
+	userstore.IntervalDay:   "date(created_at)",
+	userstore.IntervalWeek:  "date(created_at, 'weekday 0', '-6 days')",
+	userstore.IntervalMonth: "date(created_at, 'start of month')",
+}
+
+// Store provides services for storing and retrieving data. It returns the same errors as the userstore package
+type Store = sqlstore.Store
+
+type Monitor = sqlstore.Monitor
+
+func NewMonitor(store *Store) *Monitor {
+	return sqlstore.NewMonitor(store)
+}
+
+// Open opens the SQLite database in the file at path, creating it if it does not exist. The database uses write
+// ahead logging so that reads are not blocked by writes, and transactions take the write lock when they begin, so
+// that concurrent transactions wait for each other rather than failing when they first write
+func Open(path string) (*sql.DB, error) {
+	params := url.Values{}
+	params.Add("_pragma", "journal_mode(WAL)")
+	params.Add("_pragma", fmt.Sprintf("busy_timeout(%d)", busyTimeout))
+	params.Set("_txlock", "immediate")
+	db, err := sql.Open("sqlite", "file:"+url.PathEscape(path)+"?"+params.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("cannot open %s: %w", path, err)
+	}
+	return db, nil
+}
+
+// New creates a new store, which deletes users irrecoverably. db should be opened with Open
+func New(db *sql.DB) *Store {
+	return sqlstore.New(db, dialect{}, 0)
+}
+
+// NewWithRetention creates a new store which soft deletes users. Soft deleted users are excluded from reads, can be
+// restored with Restore until retention has passed, and are then deleted irrecoverably by Purge
+func NewWithRetention(db *sql.DB, retention time.Duration) *Store {
+	return sqlstore.New(db, dialect{}, retention)
+}
+
+// dialect is the sqlstore.Dialect of SQLite
+type dialect struct{}
+
+func (dialect) Schema() string {
+	return schema
+}
+
+func (dialect) ConflictError(err error) error {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return nil
+	}
+	switch sqliteErr.Code() {
+	case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+	default:
+		return nil
+	}
+	// the message names the columns of the unique index
+	message := sqliteErr.Error()
+	switch {
+	case strings.Contains(message, emailColumn):
+		return userstore.ErrEmailInUse
+	case strings.Contains(message, nicknameColumn):
+		return userstore.ErrNicknameInUse
+	default:
+		return userstore.ErrAlreadyExists
+	}
+}
+
+// Lock returns an empty string, since transactions hold the write lock of the database from when they begin, so
+// nothing read in a transaction can change until it ends. SQLite allows a single writer at a time, so events cannot
+// be claimed by another caller between being found and being marked
+func (dialect) Lock(bool) string {
+	return ""
+}
+
+func (dialect) RecoveryCodes(codes []string) interface{} {
+	return jsonCodes{codes: &codes}
+}
+
+func (dialect) ScanRecoveryCodes(codes *[]string) interface{} {
+	return jsonCodes{codes: codes}
+}
+
+// jsonCodes writes and scans recovery codes as a JSON array, which is NULL for nil codes
+type jsonCodes struct {
+	codes *[]string
+}
+
+func (c jsonCodes) Value() (driver.Value, error) {
+	if *c.codes == nil {
+		return nil, nil
+	}
+	encoded, err := json.Marshal(*c.codes)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode recovery codes: %w", err)
+	}
+	return string(encoded), nil
+}
+
+func (c jsonCodes) Scan(src interface{}) error {
+	var encoded []byte
+	switch src := src.(type) {
+	case nil:
+		*c.codes = nil
+		return nil
+	case string:
+		encoded = []byte(src)
+	case []byte:
+		encoded = src
+	default:
+		return fmt.Errorf("cannot scan recovery codes from %T", src)
+	}
+	if err := json.Unmarshal(encoded, c.codes); err != nil {
+		return fmt.Errorf("cannot decode recovery codes: %w", err)
+	}
+	return nil
+}
+
+func (dialect) Latest(column, placeholder string) string {
+	// times are stored as text which sorts in time order, so the later time is the greater text. Users who have
+	// never been seen have NULL times, which are replaced
+	return fmt.Sprintf("max(coalesce(%[1]s, %[2]s), %[2]s)", column, placeholder)
+}
+
+func (dialect) Search(arg func(interface{}) string, search string) string {
+	// LIKE ignores case in SQLite, so the start of each name is compared with the search instead
+	return fmt.Sprintf("(nickname = %[1]s OR email = %[1]s OR substr(first_name, 1, length(%[1]s)) = %[1]s "+
+		"OR substr(last_name, 1, length(%[1]s)) = %[1]s)", arg(search))
+}
+
+func (dialect) NamePrefix(arg func(interface{}) string, prefix string) string {
+	// LIKE ignores the case of ASCII letters, and uses the indexes of names which ignore case
+	return fmt.Sprintf("(first_name LIKE %[1]s ESCAPE '\\' OR last_name LIKE %[1]s ESCAPE '\\')",
+		arg(sqlstore.LikePrefix(prefix)))
+}
+
+func (dialect) PeriodStart(interval userstore.StatsInterval) (string, bool) {
+	start, ok := periodStarts[interval]
+	return start, ok
+}
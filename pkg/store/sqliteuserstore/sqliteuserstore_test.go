@@ -0,0 +1,42 @@
+package sqliteuserstore_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/robotlovesyou/fitest/pkg/store/sqliteuserstore"
+	"github.com/robotlovesyou/fitest/pkg/store/storetest"
+	"github.com/robotlovesyou/fitest/pkg/user"
+	"github.com/stretchr/testify/require"
+)
+
+const timeout = 10 * time.Second
+
+// the store must be usable in place of the mongo store
+var _ user.UserStore = (*sqliteuserstore.Store)(nil)
+
+// newTestStore returns a store with a database of its own, so that tests do not see each other's users. The database
+// is removed when t finishes
+func newTestStore(t *testing.T, retention time.Duration) *sqliteuserstore.Store {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	db, err := sqliteuserstore.Open(filepath.Join(t.TempDir(), "users.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	store := sqliteuserstore.New(db)
+	if retention != 0 {
+		store = sqliteuserstore.NewWithRetention(db, retention)
+	}
+	require.NoError(t, store.EnsureSchema(ctx))
+	return store
+}
+
+func TestStoreConformsToTheSuite(t *testing.T) {
+	storetest.Run(t, func(t *testing.T, retention time.Duration) storetest.Store {
+		return newTestStore(t, retention)
+	})
+}
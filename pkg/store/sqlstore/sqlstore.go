@@ -0,0 +1,1899 @@
+// Package sqlstore implements a store for user details backed by a SQL database, which is shared by the stores for
+// each database. It stores the same records as the userstore package, using the same transactional outbox pattern:
+// each change to a user and the event to be published for it are written in a single transaction, and events are
+// handled in a separate process. Users are stored in the users table and their events in the user_events table, where
+// the events of each user are processed in the order they were added.
+// Statements are written for every database, with numbered placeholders, and a Dialect describes where the databases
+// differ
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/telemetry"
+	"github.com/robotlovesyou/fitest/pkg/tenant"
+	"github.com/robotlovesyou/fitest/pkg/utctime"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// findTimeout is used to ensure that finds and counts will complete.
+	// It should probably be configurable
+	findTimeout = 10 * time.Second
+
+	// eventBatchSize is the largest number of events claimed at once by Events.
+	// It should probably be configurable
+	eventBatchSize = 100
+
+	// notDeleted is the condition which excludes soft deleted users
+	notDeleted = "deleted_at IS NULL"
+
+	// timeLayout is the layout times are written in. Every database parses it, and databases without a time type store
+	// it as it is, since it sorts in the same order as the times it holds
+	timeLayout = "2006-01-02T15:04:05.000000000Z07:00"
+
+	// DateLayout is the layout of the dates of the expressions returned by Dialect.PeriodStart
+	DateLayout = "2006-01-02"
+)
+
+// Dialect describes how a database differs from the SQL written by the store, and the errors it returns
+type Dialect interface {
+	// Schema returns the statements which create the tables and indexes required by the store, if they do not exist.
+	// Each index used by queries for users is prefixed with the tenant, so that uniqueness is scoped to the tenant.
+	// Users deleted irrecoverably are removed from the users table, but their idempotency keys are kept, so that
+	// retrying their creation does not create them again
+	Schema() string
+
+	// ConflictError returns the error for err when it is a violation of a unique index: ErrEmailInUse or
+	// ErrNicknameInUse for the indexes on email addresses and nicknames, and ErrAlreadyExists for any other index. It
+	// returns nil when err is not a violation of a unique index
+	ConflictError(err error) error
+
+	// Lock returns the clause which locks the rows read by a query until the end of its transaction. When skipLocked
+	// is set, rows locked by another transaction are skipped rather than waited for. It returns an empty string for
+	// databases which lock the whole database for the transaction instead
+	Lock(skipLocked bool) string
+
+	// RecoveryCodes returns the value recovery codes are written as, which is NULL for nil codes
+	RecoveryCodes(codes []string) interface{}
+
+	// ScanRecoveryCodes returns the destination recovery codes are scanned into
+	ScanRecoveryCodes(codes *[]string) interface{}
+
+	// Latest returns the expression for the later of the time in column and the time of placeholder, which is the time
+	// of placeholder when column is NULL
+	Latest(column, placeholder string) string
+
+	// Search returns the condition for users whose nickname or email address is search, or whose first or last name
+	// starts with it, matching case. arg adds a value to the arguments of the condition, returning its placeholder
+	Search(arg func(value interface{}) string, search string) string
+
+	// NamePrefix returns the condition for users whose first or last name starts with prefix, ignoring case. arg adds a
+	// value to the arguments of the condition, returning its placeholder
+	NamePrefix(arg func(value interface{}) string, prefix string) string
+
+	// PeriodStart returns the expression for the date, as text in DateLayout, of the start of the period of the given
+	// interval in which a user was created. Weeks start on Monday, and periods start at midnight UTC. It returns false
+	// for unknown intervals
+	PeriodStart(interval userstore.StatsInterval) (string, bool)
+}
+
+// recordColumns are the columns of the users table, in the order they are scanned by scanRecord and written by
+// recordArgs
+var recordColumns = []string{
+	"id", "tenant", "first_name", "last_name", "nickname", "password_hash", "email", "country", "avatar_url",
+	"created_at", "updated_at", "version", "status", "last_login_at", "last_seen_at", "two_factor_enabled",
+	"reset_token_hash", "reset_token_expires_at", "email_change_email", "email_change_hash",
+	"email_change_expires_at", "two_factor_pending_secret", "two_factor_secret", "two_factor_last_step",
+	"two_factor_recovery_codes", "deleted_at", "previous_nicknames",
+}
+
+const eventColumns = "user_id, tenant, state, action, version, created_at, updated_at, data, token, email, attempts"
+
+var (
+	selectRecord = "SELECT " + strings.Join(recordColumns, ", ") + " FROM users"
+	insertRecord = insertStatement()
+	updateRecord = updateStatement()
+)
+
+// insertStatement returns the statement which inserts a record from the arguments returned by recordArgs
+func insertStatement() string {
+	placeholders := make([]string, 0, len(recordColumns))
+	for i := range recordColumns {
+		placeholders = append(placeholders, "$"+strconv.Itoa(i+1))
+	}
+	return fmt.Sprintf("INSERT INTO users (%s) VALUES (%s)", strings.Join(recordColumns, ", "), strings.Join(placeholders, ", "))
+}
+
+// updateStatement returns the statement which overwrites the record with the id of the arguments returned by
+// recordArgs
+func updateStatement() string {
+	assignments := make([]string, 0, len(recordColumns)-1)
+	for i, column := range recordColumns[1:] {
+		assignments = append(assignments, fmt.Sprintf("%s = $%d", column, i+2))
+	}
+	return fmt.Sprintf("UPDATE users SET %s WHERE id = $1", strings.Join(assignments, ", "))
+}
+
+// nextEventsStatement marks up to $5 of the oldest events which are waiting to be processed as being processed, and
+// returns them. Only the first event of each user can be processed, so that the events of a user are published in
+// order. An event which has been processing for longer than the retry timeout is processed again, and each time an
+// event is marked its attempts are counted. The %s is replaced with the lock of the dialect which skips locked rows,
+// so that events claimed by another caller are not claimed again
+const nextEventsStatement = `
+UPDATE user_events SET state = $1, updated_at = $2, attempts = attempts + 1
+WHERE seq IN (
+	SELECT head.seq FROM user_events AS head
+	WHERE (head.state = $3 OR (head.state = $1 AND head.updated_at < $4))
+	AND NOT EXISTS (
+		SELECT 1 FROM user_events AS earlier WHERE earlier.user_id = head.user_id AND earlier.seq < head.seq
+	)
+	ORDER BY head.updated_at
+	LIMIT $5
+	%s
+)
+RETURNING ` + eventColumns
+
+// sortColumns maps each SortField to the column it sorts by. Each column is the second column of an index, after
+// the tenant, so that sorting does not require an in memory sort
+var sortColumns = map[userstore.SortField]string{
+	userstore.SortCreatedAt: "created_at",
+	userstore.SortUpdatedAt: "updated_at",
+	userstore.SortLastName:  "last_name",
+	userstore.SortNickname:  "nickname",
+}
+
+// likeEscaper escapes the characters which have a special meaning in LIKE patterns
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// LikePrefix returns the LIKE pattern, escaped with backslashes, which matches text starting with prefix
+func LikePrefix(prefix string) string {
+	return likeEscaper.Replace(prefix) + "%"
+}
+
+// Store provides services for storing and retrieving data. It returns the same errors as the userstore package
+type Store struct {
+	db      *sql.DB
+	dialect Dialect
+	// retention is the time soft deleted users are kept for before they are purged. When it is 0, users are deleted
+	// irrecoverably instead
+	retention time.Duration
+}
+
+type Monitor struct {
+	store *Store
+}
+
+func NewMonitor(store *Store) *Monitor {
+	return &Monitor{store: store}
+}
+
+func (m *Monitor) Name() string {
+	return "Datastore"
+}
+
+func (m *Monitor) Check(ctx context.Context) error {
+	return m.store.db.PingContext(ctx)
+}
+
+// New creates a new store in db, which is written in the given dialect. When retention is 0, users are deleted
+// irrecoverably. Otherwise they are soft deleted: soft deleted users are excluded from reads, can be restored with
+// Restore until retention has passed, and are then deleted irrecoverably by Purge
+func New(db *sql.DB, dialect Dialect, retention time.Duration) *Store {
+	return &Store{db: db, dialect: dialect, retention: retention}
+}
+
+// EnsureSchema creates the tables and indexes required by the store, if they do not exist.
+// As with userstore.Store.Migrate, creating indexes at startup could be problematic for a production service
+func (store *Store) EnsureSchema(ctx context.Context) error {
+	if _, err := store.db.ExecContext(ctx, store.dialect.Schema()); err != nil {
+		return fmt.Errorf("cannot create schema: %w", err)
+	}
+	// tables created before the hashes of users were stored with their idempotency keys do not have a column for them
+	if _, err := store.db.ExecContext(ctx, "SELECT payload_hash FROM user_idempotency_keys WHERE 1 = 0"); err != nil {
+		_, err = store.db.ExecContext(ctx,
+			"ALTER TABLE user_idempotency_keys ADD COLUMN payload_hash text NOT NULL DEFAULT ''")
+		if err != nil {
+			return fmt.Errorf("cannot add payload hash to idempotency keys: %w", err)
+		}
+	}
+	return nil
+}
+
+// filter is a condition on the users table, and the arguments of its placeholders
+type filter struct {
+	conditions []string
+	args       []interface{}
+}
+
+// arg adds value to the arguments of the filter, returning its placeholder. Times are converted to the text they are
+// written as
+func (f *filter) arg(value interface{}) string {
+	if t, ok := value.(time.Time); ok {
+		value = timeText(t)
+	}
+	f.args = append(f.args, value)
+	return "$" + strconv.Itoa(len(f.args))
+}
+
+// list adds values to the arguments of the filter, returning a comma separated list of their placeholders
+func (f *filter) list(values []string) string {
+	placeholders := make([]string, 0, len(values))
+	for _, value := range values {
+		placeholders = append(placeholders, f.arg(value))
+	}
+	return strings.Join(placeholders, ", ")
+}
+
+// where adds condition to the filter, replacing each %s in condition with the placeholder of the matching value
+func (f *filter) where(condition string, values ...interface{}) *filter {
+	placeholders := make([]interface{}, 0, len(values))
+	for _, value := range values {
+		placeholders = append(placeholders, f.arg(value))
+	}
+	f.conditions = append(f.conditions, fmt.Sprintf(condition, placeholders...))
+	return f
+}
+
+func (f *filter) String() string {
+	return strings.Join(f.conditions, " AND ")
+}
+
+// userFilter returns the filter for the user of the tenant of ctx with the given id, unless they have been soft
+// deleted
+func userFilter(ctx context.Context, id uuid.UUID) *filter {
+	return (&filter{}).
+		where("tenant = %s", tenant.FromContext(ctx)).
+		where("id = %s", id).
+		where(notDeleted)
+}
+
+// idsFilter returns the filter for the users of the tenant of ctx with the given ids, unless they have been soft
+// deleted. There must be at least one id
+func idsFilter(ctx context.Context, ids []uuid.UUID) *filter {
+	values := make([]string, 0, len(ids))
+	for _, id := range ids {
+		values = append(values, id.String())
+	}
+	f := (&filter{}).where("tenant = %s", tenant.FromContext(ctx))
+	return f.where("id IN (" + f.list(values) + ")").where(notDeleted)
+}
+
+// scanner is a row which can be scanned, either a *sql.Row or *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanRecord scans a row of the recordColumns of the users table. Times are returned in UTC
+func (store *Store) scanRecord(row scanner) (rec userstore.Record, err error) {
+	var (
+		usr                                userstore.User
+		createdAt, updatedAt               string
+		lastLoginAt, lastSeenAt, deletedAt sql.NullString
+		resetHash, changeEmail, changeHash sql.NullString
+		resetExpiresAt, changeExpiresAt    sql.NullString
+		pendingSecret, secret              sql.NullString
+		lastStep                           int64
+		recoveryCodes                      []string
+		previousNicknames                  []byte
+	)
+	err = row.Scan(
+		&usr.ID, &rec.Tenant, &usr.FirstName, &usr.LastName, &usr.Nickname, &usr.PasswordHash, &usr.Email,
+		&usr.Country, &usr.AvatarURL, &createdAt, &updatedAt, &usr.Version, &usr.Status, &lastLoginAt,
+		&lastSeenAt, &usr.TwoFactorEnabled, &resetHash, &resetExpiresAt, &changeEmail, &changeHash,
+		&changeExpiresAt, &pendingSecret, &secret, &lastStep, store.dialect.ScanRecoveryCodes(&recoveryCodes),
+		&deletedAt, &previousNicknames,
+	)
+	if err != nil {
+		return rec, err
+	}
+	times := []struct {
+		text sql.NullString
+		dest *time.Time
+	}{
+		{sql.NullString{String: createdAt, Valid: true}, &usr.CreatedAt},
+		{sql.NullString{String: updatedAt, Valid: true}, &usr.UpdatedAt},
+		{lastLoginAt, &usr.LastLoginAt},
+		{lastSeenAt, &usr.LastSeenAt},
+	}
+	for _, t := range times {
+		if *t.dest, err = timeOf(t.text); err != nil {
+			return rec, err
+		}
+	}
+	rec.ID = usr.ID
+	rec.Data = &usr
+	if resetHash.Valid {
+		rec.ResetToken = &userstore.ResetToken{Hash: resetHash.String}
+		if rec.ResetToken.ExpiresAt, err = timeOf(resetExpiresAt); err != nil {
+			return rec, err
+		}
+	}
+	if changeHash.Valid {
+		rec.EmailChange = &userstore.EmailChange{Email: changeEmail.String, Hash: changeHash.String}
+		if rec.EmailChange.ExpiresAt, err = timeOf(changeExpiresAt); err != nil {
+			return rec, err
+		}
+	}
+	if pendingSecret.Valid || secret.Valid {
+		rec.TwoFactor = &userstore.TwoFactor{
+			PendingSecret: pendingSecret.String,
+			Secret:        secret.String,
+			LastStep:      lastStep,
+			RecoveryCodes: recoveryCodes,
+		}
+	}
+	if deletedAt.Valid {
+		at, err := timeOf(deletedAt)
+		if err != nil {
+			return rec, err
+		}
+		rec.DeletedAt = &at
+	}
+	if err = json.Unmarshal(previousNicknames, &rec.PreviousNicknames); err != nil {
+		return rec, fmt.Errorf("cannot decode previous nicknames: %w", err)
+	}
+	if len(rec.PreviousNicknames) == 0 {
+		rec.PreviousNicknames = nil
+	}
+	return rec, nil
+}
+
+// recordArgs returns the values of the recordColumns of rec
+func (store *Store) recordArgs(rec *userstore.Record) ([]interface{}, error) {
+	previousNicknames := rec.PreviousNicknames
+	if previousNicknames == nil {
+		previousNicknames = []userstore.PreviousNickname{}
+	}
+	encoded, err := json.Marshal(previousNicknames)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode previous nicknames: %w", err)
+	}
+	var reset userstore.ResetToken
+	if rec.ResetToken != nil {
+		reset = *rec.ResetToken
+	}
+	var change userstore.EmailChange
+	if rec.EmailChange != nil {
+		change = *rec.EmailChange
+	}
+	var twoFactor userstore.TwoFactor
+	if rec.TwoFactor != nil {
+		twoFactor = *rec.TwoFactor
+	}
+	var deletedAt sql.NullString
+	if rec.DeletedAt != nil {
+		deletedAt = nullTime(*rec.DeletedAt)
+	}
+	usr := rec.Data
+	return []interface{}{
+		usr.ID, rec.Tenant, usr.FirstName, usr.LastName, usr.Nickname, usr.PasswordHash, usr.Email, usr.Country,
+		usr.AvatarURL, timeText(usr.CreatedAt), timeText(usr.UpdatedAt), usr.Version, usr.Status,
+		nullTime(usr.LastLoginAt), nullTime(usr.LastSeenAt), usr.TwoFactorEnabled, nullString(reset.Hash),
+		nullTime(reset.ExpiresAt), nullString(change.Email), nullString(change.Hash), nullTime(change.ExpiresAt),
+		nullString(twoFactor.PendingSecret), nullString(twoFactor.Secret), twoFactor.LastStep,
+		store.dialect.RecoveryCodes(twoFactor.RecoveryCodes), deletedAt, string(encoded),
+	}, nil
+}
+
+// scanEvent scans a row of the eventColumns of the user_events table
+func scanEvent(row scanner) (evt userstore.Event, err error) {
+	var createdAt, updatedAt string
+	var data []byte
+	var token, email sql.NullString
+	err = row.Scan(&evt.ID, &evt.Tenant, &evt.State, &evt.Action, &evt.Version, &createdAt, &updatedAt,
+		&data, &token, &email, &evt.Attempts)
+	if err != nil {
+		return evt, err
+	}
+	if evt.CreatedAt, err = parseTime(createdAt); err != nil {
+		return evt, err
+	}
+	if evt.UpdatedAt, err = parseTime(updatedAt); err != nil {
+		return evt, err
+	}
+	evt.Token = token.String
+	evt.Email = email.String
+	if data != nil {
+		if err = json.Unmarshal(data, &evt.Data); err != nil {
+			return evt, fmt.Errorf("cannot decode event data: %w", err)
+		}
+	}
+	return evt, nil
+}
+
+// nullString returns a NULL string for the empty string
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// timeText returns t as the text it is written as
+func timeText(t time.Time) string {
+	return t.UTC().Format(timeLayout)
+}
+
+// nullTime returns t as the text it is written as, or NULL for the zero time
+func nullTime(t time.Time) sql.NullString {
+	if t.IsZero() {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: timeText(t), Valid: true}
+}
+
+// parseTime parses the text of a stored time, returning it in UTC. Times are scanned as text, which databases with a
+// time type return in RFC 3339 format, with as many digits as the time needs
+func parseTime(text string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, text)
+	if err != nil {
+		return t, fmt.Errorf("cannot parse stored time: %w", err)
+	}
+	return t.UTC(), nil
+}
+
+// timeOf parses the text of a stored time, returning the zero time if it is NULL
+func timeOf(text sql.NullString) (time.Time, error) {
+	if !text.Valid {
+		return time.Time{}, nil
+	}
+	return parseTime(text.String)
+}
+
+func eventFor(action userstore.Action, id uuid.UUID, version int64, user *userstore.User) userstore.Event {
+	return userstore.Event{
+		ID:        id,
+		State:     userstore.Pending,
+		Action:    action,
+		Version:   version,
+		CreatedAt: utctime.Now(),
+		UpdatedAt: utctime.Now(),
+		Data:      user,
+	}
+}
+
+// inTx calls f in a transaction, which is committed if f returns nil and rolled back otherwise
+func (store *Store) inTx(ctx context.Context, f func(*sql.Tx) error) error {
+	tx, err := store.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("cannot begin transaction: %w", err)
+	}
+	if err = f(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("cannot commit transaction: %w", err)
+	}
+	return nil
+}
+
+// modify reads the record of the user matching f in a transaction, locking it until apply, which is called with the
+// record, returns. notFound is returned if no user matches f
+func (store *Store) modify(ctx context.Context, f *filter, notFound error, apply func(*sql.Tx, *userstore.Record) error) error {
+	return store.inTx(ctx, func(tx *sql.Tx) error {
+		rec, err := store.scanRecord(tx.QueryRowContext(ctx, selectRecord+" WHERE "+f.String()+store.dialect.Lock(false), f.args...))
+		if errors.Is(err, sql.ErrNoRows) {
+			return notFound
+		}
+		if err != nil {
+			return fmt.Errorf("cannot read user record: %w", err)
+		}
+		return apply(tx, &rec)
+	})
+}
+
+// insert inserts rec and adds the event for its creation. ErrEmailInUse or ErrNicknameInUse is returned if the email
+// address or nickname is used by another user
+func (store *Store) insert(ctx context.Context, tx *sql.Tx, rec *userstore.Record) error {
+	args, err := store.recordArgs(rec)
+	if err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, insertRecord, args...); err != nil {
+		if conflict := store.dialect.ConflictError(err); conflict != nil {
+			return conflict
+		}
+		return fmt.Errorf("cannot store user record: %w", err)
+	}
+	return store.addEvent(ctx, tx, rec.Tenant, eventFor(userstore.Created, rec.ID, rec.Data.Version, rec.Data))
+}
+
+// save overwrites the stored record with rec and adds evt. ErrEmailInUse or ErrNicknameInUse is returned if the
+// email address or nickname of rec is used by another user
+func (store *Store) save(ctx context.Context, tx *sql.Tx, rec *userstore.Record, evt userstore.Event) error {
+	if err := store.overwrite(ctx, tx, rec); err != nil {
+		return err
+	}
+	return store.addEvent(ctx, tx, rec.Tenant, evt)
+}
+
+// overwrite overwrites the stored record with rec without adding an event
+func (store *Store) overwrite(ctx context.Context, tx *sql.Tx, rec *userstore.Record) error {
+	args, err := store.recordArgs(rec)
+	if err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, updateRecord, args...); err != nil {
+		if conflict := store.dialect.ConflictError(err); conflict != nil {
+			return conflict
+		}
+		return fmt.Errorf("cannot update user record: %w", err)
+	}
+	return nil
+}
+
+// addEvent adds evt to the outbox for a user of the tenant tenantID
+func (store *Store) addEvent(ctx context.Context, tx *sql.Tx, tenantID string, evt userstore.Event) error {
+	var data interface{}
+	if evt.Data != nil {
+		encoded, err := json.Marshal(evt.Data)
+		if err != nil {
+			return fmt.Errorf("cannot encode event data: %w", err)
+		}
+		data = string(encoded)
+	}
+	_, err := tx.ExecContext(ctx,
+		"INSERT INTO user_events ("+eventColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)",
+		evt.ID, tenantID, evt.State, evt.Action, evt.Version, timeText(evt.CreatedAt), timeText(evt.UpdatedAt), data,
+		nullString(evt.Token), nullString(evt.Email), evt.Attempts,
+	)
+	if err != nil {
+		return fmt.Errorf("cannot store event: %w", err)
+	}
+	return nil
+}
+
+// Create creates a new user record for the tenant of ctx. ErrEmailInUse or ErrNicknameInUse is returned if the
+// email address or nickname is used by another user
+func (store *Store) Create(ctx context.Context, user *userstore.User) (userstore.User, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "CreateUserRecord")
+	defer span.End()
+	rec := userstore.Record{ID: user.ID, Data: user, Tenant: tenant.FromContext(ctx)}
+	err := store.inTx(ctx, func(tx *sql.Tx) error {
+		return store.insert(ctx, tx, &rec)
+	})
+	if err != nil {
+		span.RecordError(err)
+		return *user, err
+	}
+	return *user, nil
+}
+
+// CreateMany creates a batch of new user records in a single transaction. Users which conflict with an existing user,
+// or with another user in the batch, are not created, but do not prevent the others from being created.
+// It returns an error for each user, in the same order as users, which is nil if the user was created and
+// ErrEmailInUse or ErrNicknameInUse if it conflicted. An error is returned instead if the batch could not be stored at all
+func (store *Store) CreateMany(ctx context.Context, users []userstore.User) ([]error, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "CreateManyUserRecords")
+	defer span.End()
+	errs := make([]error, len(users))
+	if len(users) == 0 {
+		return errs, nil
+	}
+	tenantID := tenant.FromContext(ctx)
+	err := store.inTx(ctx, func(tx *sql.Tx) error {
+		for i := range users {
+			// a conflict aborts the transaction in some databases, so each user is created after a savepoint which can be
+			// restored
+			if _, err := tx.ExecContext(ctx, "SAVEPOINT create_user"); err != nil {
+				return fmt.Errorf("cannot store user records: %w", err)
+			}
+			user := &users[i]
+			err := store.insert(ctx, tx, &userstore.Record{ID: user.ID, Data: user, Tenant: tenantID})
+			switch {
+			case errors.Is(err, userstore.ErrAlreadyExists):
+				errs[i] = err
+				if _, err := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT create_user"); err != nil {
+					return fmt.Errorf("cannot store user records: %w", err)
+				}
+			case err != nil:
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	return errs, nil
+}
+
+// CreateWithKey creates a new user record, storing the idempotency key with it.
+// If a user has already been created with the same key, that user is returned instead of creating another.
+// ErrAlreadyExists is returned if the key has been used for a user which has since been deleted,
+// ErrIdempotencyKeyReused if it was used for a user created with different details, and ErrEmailInUse or
+// ErrNicknameInUse if the email address or nickname is used by another user
+func (store *Store) CreateWithKey(ctx context.Context, user *userstore.User, key string) (userstore.User, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "CreateUserRecordWithKey")
+	defer span.End()
+	rec := userstore.Record{ID: user.ID, Data: user, IdempotencyKey: key, Tenant: tenant.FromContext(ctx)}
+	err := store.inTx(ctx, func(tx *sql.Tx) error {
+		if err := store.insert(ctx, tx, &rec); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx,
+			"INSERT INTO user_idempotency_keys (tenant, key, user_id, payload_hash) VALUES ($1, $2, $3, $4)",
+			rec.Tenant, key, rec.ID, userstore.PayloadHash(user))
+		if conflict := store.dialect.ConflictError(err); conflict != nil {
+			return conflict
+		}
+		if err != nil {
+			return fmt.Errorf("cannot store idempotency key: %w", err)
+		}
+		return nil
+	})
+	if err == nil {
+		return *user, nil
+	}
+	span.RecordError(err)
+	if !errors.Is(err, userstore.ErrAlreadyExists) {
+		return *user, err
+	}
+	conflict := err
+
+	// keyed holds the hash stored with the key
+	var id uuid.UUID
+	var keyed userstore.Record
+	err = store.db.QueryRowContext(ctx,
+		"SELECT user_id, payload_hash FROM user_idempotency_keys WHERE tenant = $1 AND key = $2", rec.Tenant, key,
+	).Scan(&id, &keyed.IdempotencyHash)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		// the conflict was with the email or nickname of another user
+		return *user, conflict
+	case err != nil:
+		span.RecordError(err)
+		return *user, fmt.Errorf("cannot read user record created with the same key: %w", err)
+	}
+	original, err := store.ReadOne(ctx, id)
+	switch {
+	case errors.Is(err, userstore.ErrNotFound):
+		return *user, userstore.ErrAlreadyExists
+	case err != nil:
+		return *user, fmt.Errorf("cannot read user record created with the same key: %w", err)
+	case !keyed.SamePayload(user):
+		return *user, userstore.ErrIdempotencyKeyReused
+	}
+	return original, nil
+}
+
+// findRecord reads the single record matching f. ErrNotFound is returned if there is none
+func (store *Store) findRecord(ctx context.Context, f *filter) (rec userstore.Record, err error) {
+	span := trace.SpanFromContext(ctx)
+	rec, err = store.scanRecord(store.db.QueryRowContext(ctx, selectRecord+" WHERE "+f.String(), f.args...))
+	if err != nil {
+		span.RecordError(err)
+		if errors.Is(err, sql.ErrNoRows) {
+			return rec, userstore.ErrNotFound
+		}
+		return rec, fmt.Errorf("cannot read user record: %w", err)
+	}
+	return rec, nil
+}
+
+// ReadOne reads a single user record of the tenant of ctx by ID. Soft deleted records are not read
+func (store *Store) ReadOne(ctx context.Context, id uuid.UUID) (user userstore.User, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "ReadOneRecord")
+	defer span.End()
+	rec, err := store.findRecord(ctx, userFilter(ctx, id))
+	if err != nil {
+		return user, err
+	}
+	return *rec.Data, nil
+}
+
+// ReadMany reads the users of the tenant of ctx with the given IDs, in the order of ids, in a single query. The user
+// of an id which does not exist or has been deleted is the zero User, whose ID is uuid.Nil
+func (store *Store) ReadMany(ctx context.Context, ids []uuid.UUID) ([]userstore.User, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "ReadManyRecords")
+	defer span.End()
+	if len(ids) == 0 {
+		return []userstore.User{}, nil
+	}
+	f := idsFilter(ctx, ids)
+	rows, err := store.db.QueryContext(ctx, selectRecord+" WHERE "+f.String(), f.args...)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("cannot read user records: %w", err)
+	}
+	defer rows.Close()
+	found := make([]userstore.User, 0, len(ids))
+	for rows.Next() {
+		rec, err := store.scanRecord(rows)
+		if err != nil {
+			span.RecordError(err)
+			return nil, fmt.Errorf("cannot read user record: %w", err)
+		}
+		found = append(found, *rec.Data)
+	}
+	if err = rows.Err(); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("cannot read user records: %w", err)
+	}
+	return userstore.InOrder(ids, found), nil
+}
+
+// ReadRecord reads the whole record of a single user of the tenant of ctx by ID, including its pending events.
+// Unlike ReadOne, soft deleted records are read. ErrNotFound is returned if the record does not exist or has been
+// deleted irrecoverably
+func (store *Store) ReadRecord(ctx context.Context, id uuid.UUID) (rec userstore.Record, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "ReadRecord")
+	defer span.End()
+	rec, err = store.findRecord(ctx, (&filter{}).where("tenant = %s", tenant.FromContext(ctx)).where("id = %s", id))
+	if err != nil {
+		return rec, err
+	}
+	rows, err := store.db.QueryContext(ctx, "SELECT "+eventColumns+" FROM user_events WHERE user_id = $1 ORDER BY seq", id)
+	if err != nil {
+		span.RecordError(err)
+		return rec, fmt.Errorf("cannot read events of user record: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		evt, err := scanEvent(rows)
+		if err != nil {
+			span.RecordError(err)
+			return rec, fmt.Errorf("cannot read events of user record: %w", err)
+		}
+		rec.Events = append(rec.Events, evt)
+	}
+	if err = rows.Err(); err != nil {
+		span.RecordError(err)
+		return rec, fmt.Errorf("cannot read events of user record: %w", err)
+	}
+	return rec, nil
+}
+
+// FindByEmail reads a single user record by email address
+func (store *Store) FindByEmail(ctx context.Context, email string) (user userstore.User, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "FindByEmail")
+	defer span.End()
+	// the unique index on tenant and email supports this query
+	return store.findOne(ctx, "email = %s", email)
+}
+
+// FindByNickname reads a single user record by nickname
+func (store *Store) FindByNickname(ctx context.Context, nickname string) (user userstore.User, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "FindByNickname")
+	defer span.End()
+	// the unique index on tenant and nickname supports this query
+	return store.findOne(ctx, "nickname = %s", nickname)
+}
+
+// findOne reads the single user of the tenant of ctx matching condition, which has a single placeholder for value
+func (store *Store) findOne(ctx context.Context, condition string, value interface{}) (user userstore.User, err error) {
+	f := (&filter{}).where("tenant = %s", tenant.FromContext(ctx)).where(condition, value).where(notDeleted)
+	rec, err := store.findRecord(ctx, f)
+	if err != nil {
+		return user, err
+	}
+	return *rec.Data, nil
+}
+
+// EmailExists returns true if a user of the tenant of ctx has the email address email. Soft deleted users are
+// included, since their email addresses are not released until they are purged
+func (store *Store) EmailExists(ctx context.Context, email string) (bool, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "EmailExists")
+	defer span.End()
+	return store.exists(ctx, "email = %s", email)
+}
+
+// NicknameExists returns true if a user of the tenant of ctx has the nickname nickname. Soft deleted users are
+// included, since their nicknames are not released until they are purged
+func (store *Store) NicknameExists(ctx context.Context, nickname string) (bool, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "NicknameExists")
+	defer span.End()
+	return store.exists(ctx, "nickname = %s", nickname)
+}
+
+// exists returns true if any user of the tenant of ctx matches condition, which has a single placeholder for value
+func (store *Store) exists(ctx context.Context, condition string, value interface{}) (bool, error) {
+	span := trace.SpanFromContext(ctx)
+	f := (&filter{}).where("tenant = %s", tenant.FromContext(ctx)).where(condition, value)
+	var exists bool
+	if err := store.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE "+f.String()+")", f.args...).Scan(&exists); err != nil {
+		span.RecordError(err)
+		return false, fmt.Errorf("cannot count user records: %w", err)
+	}
+	return exists, nil
+}
+
+// ChangePassword updates a single user record, unless the provided update is stale.
+// The event for the change has the PasswordChanged action
+func (store *Store) ChangePassword(ctx context.Context, update *userstore.User) (user userstore.User, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "ChangePassword")
+	defer span.End()
+	return store.update(ctx, update, userstore.PasswordChanged)
+}
+
+// Anonymize updates a single user record, unless the provided update is stale. Unlike other updates, the nickname
+// and email address are also replaced, along with any password reset token or email change, two factor
+// authentication is turned off, previous nicknames are removed, and the event for the change has the Anonymized action
+func (store *Store) Anonymize(ctx context.Context, update *userstore.User) (user userstore.User, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "AnonymizeRecord")
+	defer span.End()
+	return store.update(ctx, update, userstore.Anonymized)
+}
+
+// ChangeStatus changes the status of a single user record to the status of update, unless the provided update is
+// stale. The event for the change has the Suspended, Reactivated, Banned or MarkedDormant action, for the suspended,
+// active, banned and dormant statuses respectively. It returns ErrInvalidStatus for any other status
+func (store *Store) ChangeStatus(ctx context.Context, update *userstore.User) (user userstore.User, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "ChangeStatus")
+	defer span.End()
+	action, ok := statusActions[update.Status]
+	if !ok {
+		span.RecordError(userstore.ErrInvalidStatus)
+		return user, userstore.ErrInvalidStatus
+	}
+	return store.update(ctx, update, action)
+}
+
+// statusActions are the actions of the events for changes to each status
+var statusActions = map[userstore.Status]userstore.Action{
+	userstore.StatusActive:    userstore.Reactivated,
+	userstore.StatusSuspended: userstore.Suspended,
+	userstore.StatusBanned:    userstore.Banned,
+	userstore.StatusDormant:   userstore.MarkedDormant,
+}
+
+// update updates a single user record, unless the provided update is stale, and adds an event with the given action.
+// Changing the password also removes any password reset token, since it was issued for the old password
+func (store *Store) update(ctx context.Context, update *userstore.User, action userstore.Action) (user userstore.User, err error) {
+	span := trace.SpanFromContext(ctx)
+	err = store.modify(ctx, userFilter(ctx, update.ID), userstore.ErrNotFound, func(tx *sql.Tx, rec *userstore.Record) error {
+		usr := rec.Data
+		if usr.Version != update.Version {
+			return userstore.ErrInvalidVersion
+		}
+		usr.FirstName = update.FirstName
+		usr.LastName = update.LastName
+		usr.PasswordHash = update.PasswordHash
+		usr.Country = update.Country
+		usr.CreatedAt = update.CreatedAt
+		usr.UpdatedAt = update.UpdatedAt
+		usr.Version += 1
+		switch action {
+		case userstore.PasswordChanged:
+			rec.ResetToken = nil
+		case userstore.Anonymized:
+			usr.Nickname = update.Nickname
+			usr.Email = update.Email
+			usr.AvatarURL = update.AvatarURL
+			usr.TwoFactorEnabled = false
+			rec.ResetToken = nil
+			rec.EmailChange = nil
+			rec.TwoFactor = nil
+			rec.PreviousNicknames = nil
+		}
+		if action == statusActions[update.Status] {
+			usr.Status = update.Status
+		}
+		user = *usr
+		return store.save(ctx, tx, rec, eventFor(action, usr.ID, usr.Version, usr))
+	})
+	if err != nil {
+		span.RecordError(err)
+		return userstore.User{}, err
+	}
+	return user, nil
+}
+
+// UpdateFields applies change to the user of the tenant of ctx with the given id, unless version is stale, and adds
+// an event with the Updated action. The user is locked while the version is checked and the change is applied, so
+// concurrent changes to other fields are not overwritten. ErrNotFound is returned if there is no such user, and
+// ErrInvalidVersion if version is stale
+func (store *Store) UpdateFields(ctx context.Context, id uuid.UUID, version int64, change *userstore.Change) (user userstore.User, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "UpdateFields")
+	defer span.End()
+	err = store.modify(ctx, userFilter(ctx, id), userstore.ErrNotFound, func(tx *sql.Tx, rec *userstore.Record) error {
+		usr := rec.Data
+		if usr.Version != version {
+			return userstore.ErrInvalidVersion
+		}
+		for field, value := range map[*string]*string{
+			&usr.FirstName:    change.FirstName,
+			&usr.LastName:     change.LastName,
+			&usr.PasswordHash: change.PasswordHash,
+			&usr.Country:      change.Country,
+			&usr.AvatarURL:    change.AvatarURL,
+		} {
+			if value != nil {
+				*field = *value
+			}
+		}
+		usr.UpdatedAt = change.UpdatedAt
+		usr.Version += 1
+		user = *usr
+		return store.save(ctx, tx, rec, eventFor(userstore.Updated, usr.ID, usr.Version, usr))
+	})
+	if err != nil {
+		span.RecordError(err)
+		return userstore.User{}, err
+	}
+	return user, nil
+}
+
+// RecordLogin records that the user of the tenant of ctx with the given id authenticated at the given time, which is
+// also the last time they were seen. ErrNotFound is returned if there is no such user
+func (store *Store) RecordLogin(ctx context.Context, id uuid.UUID, at time.Time) error {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "RecordLogin")
+	defer span.End()
+	return store.touch(ctx, id, at, "last_login_at", "last_seen_at")
+}
+
+// TouchLastSeen records that the user of the tenant of ctx with the given id was active at the given time.
+// ErrNotFound is returned if there is no such user
+func (store *Store) TouchLastSeen(ctx context.Context, id uuid.UUID, at time.Time) error {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "TouchLastSeen")
+	defer span.End()
+	return store.touch(ctx, id, at, "last_seen_at")
+}
+
+// touch sets the activity time columns of the user with the given id to at, unless they are already later. Activity
+// is not a change to the user, so the version is not changed and no event is added
+func (store *Store) touch(ctx context.Context, id uuid.UUID, at time.Time, columns ...string) error {
+	span := trace.SpanFromContext(ctx)
+	f := userFilter(ctx, id)
+	placeholder := f.arg(at)
+	assignments := make([]string, 0, len(columns))
+	for _, column := range columns {
+		assignments = append(assignments, column+" = "+store.dialect.Latest(column, placeholder))
+	}
+	return store.exec(ctx, span, "UPDATE users SET "+strings.Join(assignments, ", ")+" WHERE "+f.String(), f.args, userstore.ErrNotFound, "cannot record user activity")
+}
+
+// exec executes statement, which changes a single user, returning notChanged if it changes none. Other errors are
+// wrapped with message
+func (store *Store) exec(ctx context.Context, span trace.Span, statement string, args []interface{}, notChanged error, message string) error {
+	res, err := store.db.ExecContext(ctx, statement, args...)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("%s: %w", message, err)
+	}
+	changed, err := res.RowsAffected()
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("%s: %w", message, err)
+	}
+	if changed != 1 {
+		span.RecordError(notChanged)
+		return notChanged
+	}
+	return nil
+}
+
+// BeginTwoFactor stores the sealed secret of a new two factor authentication enrollment of the user of the tenant of
+// ctx with the given id, replacing any enrollment which has not been confirmed. The user is not changed until the
+// enrollment is confirmed, so the version is not changed and no event is added. ErrNotFound is returned if there is
+// no such user, and ErrTwoFactorEnabled if the user already has two factor authentication enabled
+func (store *Store) BeginTwoFactor(ctx context.Context, id uuid.UUID, pendingSecret string) error {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "BeginTwoFactor")
+	defer span.End()
+	f := userFilter(ctx, id).where("NOT two_factor_enabled")
+	statement := fmt.Sprintf("UPDATE users SET two_factor_pending_secret = %s, two_factor_secret = NULL, "+
+		"two_factor_last_step = 0, two_factor_recovery_codes = NULL WHERE %s", f.arg(pendingSecret), f)
+	err := store.exec(ctx, span, statement, f.args, userstore.ErrTwoFactorEnabled, "cannot store two factor enrollment")
+	if errors.Is(err, userstore.ErrTwoFactorEnabled) {
+		// the user does not exist, or already has two factor authentication enabled
+		if _, err := store.ReadOne(ctx, id); err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// EnableTwoFactor confirms the enrollment with the sealed secret pendingSecret of the user of the tenant of ctx with
+// the given id. The secret becomes the secret of the user, the code with the time step step is recorded as used,
+// and recoveryCodes, which are hashes, are stored. The event for the change has the TwoFactorEnabled action.
+// ErrNotFound is returned if there is no such user, and ErrTwoFactorNotPending if the enrollment has been replaced
+// or confirmed since it was read
+func (store *Store) EnableTwoFactor(ctx context.Context, id uuid.UUID, pendingSecret string, step int64, recoveryCodes []string) (user userstore.User, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "EnableTwoFactor")
+	defer span.End()
+	err = store.modify(ctx, userFilter(ctx, id), userstore.ErrNotFound, func(tx *sql.Tx, rec *userstore.Record) error {
+		if rec.TwoFactor == nil || rec.TwoFactor.PendingSecret != pendingSecret {
+			return userstore.ErrTwoFactorNotPending
+		}
+		usr := rec.Data
+		usr.TwoFactorEnabled = true
+		usr.UpdatedAt = utctime.Now()
+		usr.Version += 1
+		rec.TwoFactor = &userstore.TwoFactor{Secret: pendingSecret, LastStep: step, RecoveryCodes: recoveryCodes}
+		user = *usr
+		return store.save(ctx, tx, rec, eventFor(userstore.TwoFactorEnabled, usr.ID, usr.Version, usr))
+	})
+	if err != nil {
+		span.RecordError(err)
+		return userstore.User{}, err
+	}
+	return user, nil
+}
+
+// DisableTwoFactor turns two factor authentication off for the user of the tenant of ctx with the given id, and
+// removes its secrets. The event for the change has the TwoFactorDisabled action. ErrNotFound is returned if there
+// is no such user, and ErrTwoFactorNotEnabled if the user does not have two factor authentication enabled
+func (store *Store) DisableTwoFactor(ctx context.Context, id uuid.UUID) (user userstore.User, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "DisableTwoFactor")
+	defer span.End()
+	err = store.modify(ctx, userFilter(ctx, id), userstore.ErrNotFound, func(tx *sql.Tx, rec *userstore.Record) error {
+		usr := rec.Data
+		if !usr.TwoFactorEnabled {
+			return userstore.ErrTwoFactorNotEnabled
+		}
+		usr.TwoFactorEnabled = false
+		usr.UpdatedAt = utctime.Now()
+		usr.Version += 1
+		rec.TwoFactor = nil
+		user = *usr
+		return store.save(ctx, tx, rec, eventFor(userstore.TwoFactorDisabled, usr.ID, usr.Version, usr))
+	})
+	if err != nil {
+		span.RecordError(err)
+		return userstore.User{}, err
+	}
+	return user, nil
+}
+
+// UseTwoFactorStep records that a code with the time step step has been accepted for the user of the tenant of ctx
+// with the given id. ErrTwoFactorCodeRejected is returned if a code with the same or a later step has already been
+// accepted, so that codes cannot be replayed, or the user does not have two factor authentication enabled
+func (store *Store) UseTwoFactorStep(ctx context.Context, id uuid.UUID, step int64) error {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "UseTwoFactorStep")
+	defer span.End()
+	f := userFilter(ctx, id).where("two_factor_enabled").where("two_factor_last_step < %s", step)
+	statement := fmt.Sprintf("UPDATE users SET two_factor_last_step = %s WHERE %s", f.arg(step), f)
+	return store.exec(ctx, span, statement, f.args, userstore.ErrTwoFactorCodeRejected, "cannot use two factor authentication code")
+}
+
+// UseRecoveryCode removes the recovery code with the hash codeHash from the user of the tenant of ctx with the given
+// id, so that it cannot be used again. ErrTwoFactorCodeRejected is returned if the user does not have the code
+func (store *Store) UseRecoveryCode(ctx context.Context, id uuid.UUID, codeHash string) error {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "UseRecoveryCode")
+	defer span.End()
+	f := userFilter(ctx, id).where("two_factor_enabled")
+	err := store.modify(ctx, f, userstore.ErrTwoFactorCodeRejected, func(tx *sql.Tx, rec *userstore.Record) error {
+		codes := rec.TwoFactor.RecoveryCodes
+		for i, code := range codes {
+			if code == codeHash {
+				rec.TwoFactor.RecoveryCodes = append(codes[:i:i], codes[i+1:]...)
+				// using a code is not a change to the user, so no event is added
+				return store.overwrite(ctx, tx, rec)
+			}
+		}
+		return userstore.ErrTwoFactorCodeRejected
+	})
+	if err != nil {
+		span.RecordError(err)
+	}
+	return err
+}
+
+// RequestPasswordReset stores a password reset token for the user of the tenant of ctx with the given id, replacing
+// any token issued before. The record stores reset, which holds the hash of token, and a PasswordResetRequested event
+// which carries token itself so that it can be sent to the user
+func (store *Store) RequestPasswordReset(ctx context.Context, id uuid.UUID, token string, reset userstore.ResetToken) error {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "RequestPasswordReset")
+	defer span.End()
+	err := store.modify(ctx, userFilter(ctx, id), userstore.ErrNotFound, func(tx *sql.Tx, rec *userstore.Record) error {
+		rec.ResetToken = &reset
+		evt := eventFor(userstore.PasswordResetRequested, rec.ID, rec.Data.Version, rec.Data)
+		evt.Token = token
+		return store.save(ctx, tx, rec, evt)
+	})
+	if err != nil {
+		span.RecordError(err)
+	}
+	return err
+}
+
+// ResetPassword sets the password hash of the user of the tenant of ctx holding an unexpired reset token with the
+// hash tokenHash, and removes the token so that it cannot be used again. The event for the change has the
+// PasswordChanged action. ErrInvalidResetToken is returned if no user holds a matching token
+func (store *Store) ResetPassword(ctx context.Context, tokenHash, passwordHash string) (user userstore.User, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "ResetPassword")
+	defer span.End()
+	f := (&filter{}).
+		where("tenant = %s", tenant.FromContext(ctx)).
+		where("reset_token_hash = %s", tokenHash).
+		where("reset_token_expires_at > %s", utctime.Now()).
+		where(notDeleted)
+	err = store.modify(ctx, f, userstore.ErrInvalidResetToken, func(tx *sql.Tx, rec *userstore.Record) error {
+		usr := rec.Data
+		usr.PasswordHash = passwordHash
+		usr.UpdatedAt = utctime.Now()
+		usr.Version += 1
+		rec.ResetToken = nil
+		user = *usr
+		return store.save(ctx, tx, rec, eventFor(userstore.PasswordChanged, usr.ID, usr.Version, usr))
+	})
+	if err != nil {
+		span.RecordError(err)
+		return userstore.User{}, err
+	}
+	return user, nil
+}
+
+// RequestEmailChange stores a change of email address for the user of the tenant of ctx with the given id, unless the
+// provided version is stale, replacing any change requested before. The record stores change, which holds the hash of
+// token, and an EmailChangeRequested event which carries token itself so that it can be sent to the new address
+func (store *Store) RequestEmailChange(ctx context.Context, id uuid.UUID, version int64, token string, change userstore.EmailChange) error {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "RequestEmailChange")
+	defer span.End()
+	err := store.modify(ctx, userFilter(ctx, id), userstore.ErrNotFound, func(tx *sql.Tx, rec *userstore.Record) error {
+		if rec.Data.Version != version {
+			return userstore.ErrInvalidVersion
+		}
+		rec.EmailChange = &change
+		evt := eventFor(userstore.EmailChangeRequested, rec.ID, rec.Data.Version, rec.Data)
+		evt.Token = token
+		evt.Email = change.Email
+		return store.save(ctx, tx, rec, evt)
+	})
+	if err != nil {
+		span.RecordError(err)
+	}
+	return err
+}
+
+// ConfirmEmailChange sets the email address of the user of the tenant of ctx with an unexpired email change with
+// the token hash tokenHash to the new address, and removes the change so that it cannot be confirmed again. The
+// unique index on email addresses is checked again when the change is confirmed, so ErrEmailInUse is returned
+// if another user has taken the address since the change was requested. ErrInvalidEmailChangeToken is returned if
+// no user has a matching change
+func (store *Store) ConfirmEmailChange(ctx context.Context, tokenHash string) (user userstore.User, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "ConfirmEmailChange")
+	defer span.End()
+	f := (&filter{}).
+		where("tenant = %s", tenant.FromContext(ctx)).
+		where("email_change_hash = %s", tokenHash).
+		where("email_change_expires_at > %s", utctime.Now()).
+		where(notDeleted)
+	err = store.modify(ctx, f, userstore.ErrInvalidEmailChangeToken, func(tx *sql.Tx, rec *userstore.Record) error {
+		usr := rec.Data
+		usr.Email = rec.EmailChange.Email
+		usr.UpdatedAt = utctime.Now()
+		usr.Version += 1
+		rec.EmailChange = nil
+		user = *usr
+		return store.save(ctx, tx, rec, eventFor(userstore.EmailChanged, usr.ID, usr.Version, usr))
+	})
+	if err != nil {
+		span.RecordError(err)
+		return userstore.User{}, err
+	}
+	return user, nil
+}
+
+// ChangeNickname changes the nickname of the user of the tenant of ctx with the given id, unless version is stale,
+// adds the current nickname to the previous nicknames of the user and adds an event with the NicknameChanged action.
+// ErrNotFound is returned if there is no such user, ErrInvalidVersion if version is stale, ErrNicknameChangeTooSoon
+// if the nickname was last changed less than cooldown ago, and ErrNicknameInUse if another user has the nickname
+func (store *Store) ChangeNickname(ctx context.Context, id uuid.UUID, version int64, nickname string, cooldown time.Duration) (user userstore.User, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "ChangeNickname")
+	defer span.End()
+	err = store.modify(ctx, userFilter(ctx, id), userstore.ErrNotFound, func(tx *sql.Tx, rec *userstore.Record) error {
+		usr := rec.Data
+		if usr.Version != version {
+			return userstore.ErrInvalidVersion
+		}
+		now := utctime.Now()
+		if n := len(rec.PreviousNicknames); n > 0 && rec.PreviousNicknames[n-1].ChangedAt.After(now.Add(-cooldown)) {
+			return userstore.ErrNicknameChangeTooSoon
+		}
+		rec.PreviousNicknames = append(rec.PreviousNicknames, userstore.PreviousNickname{Nickname: usr.Nickname, ChangedAt: now})
+		usr.Nickname = nickname
+		usr.UpdatedAt = now
+		usr.Version += 1
+		user = *usr
+		return store.save(ctx, tx, rec, eventFor(userstore.NicknameChanged, usr.ID, usr.Version, usr))
+	})
+	if err != nil {
+		span.RecordError(err)
+		return userstore.User{}, err
+	}
+	return user, nil
+}
+
+// DeleteOne deletes a single user record. It is soft deleted if the store was created with NewWithRetention
+func (store *Store) DeleteOne(ctx context.Context, id uuid.UUID) error {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "DeleteOneRecord")
+	defer span.End()
+	err := store.modify(ctx, userFilter(ctx, id), userstore.ErrNotFound, func(tx *sql.Tx, rec *userstore.Record) error {
+		return store.remove(ctx, tx, rec)
+	})
+	if err != nil {
+		span.RecordError(err)
+	}
+	return err
+}
+
+// remove deletes rec, keeping it if the store soft deletes users, and adds the event for the deletion. The event does
+// not carry the data of the user, only their email address, so that the deletion can be confirmed to them
+func (store *Store) remove(ctx context.Context, tx *sql.Tx, rec *userstore.Record) error {
+	var err error
+	if store.retention > 0 {
+		_, err = tx.ExecContext(ctx, "UPDATE users SET deleted_at = $1 WHERE id = $2", timeText(utctime.Now()), rec.ID)
+	} else {
+		_, err = tx.ExecContext(ctx, "DELETE FROM users WHERE id = $1", rec.ID)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot delete user: %w", err)
+	}
+	evt := eventFor(userstore.Deleted, rec.ID, math.MaxInt64, nil)
+	evt.Email = rec.Data.Email
+	return store.addEvent(ctx, tx, rec.Tenant, evt)
+}
+
+// DeleteMany deletes the user records with the given IDs in a single transaction and returns the IDs of the deleted
+// records. IDs of records which do not exist or are already deleted are not returned. As with DeleteOne, records are
+// soft deleted if the store was created with NewWithRetention
+func (store *Store) DeleteMany(ctx context.Context, ids []uuid.UUID) ([]uuid.UUID, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "DeleteManyRecords")
+	defer span.End()
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	f := idsFilter(ctx, ids)
+	var deleted []uuid.UUID
+	err := store.inTx(ctx, func(tx *sql.Tx) error {
+		recs, err := store.lockRecords(ctx, tx, f)
+		if err != nil {
+			return err
+		}
+		for i := range recs {
+			if err := store.remove(ctx, tx, &recs[i]); err != nil {
+				return err
+			}
+			deleted = append(deleted, recs[i].ID)
+		}
+		return nil
+	})
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	return deleted, nil
+}
+
+// lockRecords reads the records matching f, locking them until the end of tx. The records are read before any are
+// changed, since a connection cannot run another statement while reading rows
+func (store *Store) lockRecords(ctx context.Context, tx *sql.Tx, f *filter) ([]userstore.Record, error) {
+	rows, err := tx.QueryContext(ctx, selectRecord+" WHERE "+f.String()+store.dialect.Lock(false), f.args...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find user records: %w", err)
+	}
+	defer rows.Close()
+	var recs []userstore.Record
+	for rows.Next() {
+		rec, err := store.scanRecord(rows)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read user record: %w", err)
+		}
+		recs = append(recs, rec)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("cannot find user records: %w", err)
+	}
+	return recs, nil
+}
+
+// Restore restores the soft deleted user record of the tenant of ctx with the given ID, if it was deleted less than
+// the retention of the store ago. The event for the restore has the Restored action, and the version of the user is
+// incremented. ErrNotFound is returned if there is no such record, which is always the case for stores which delete
+// users irrecoverably
+func (store *Store) Restore(ctx context.Context, id uuid.UUID) (user userstore.User, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "RestoreRecord")
+	defer span.End()
+	f := (&filter{}).
+		where("tenant = %s", tenant.FromContext(ctx)).
+		where("id = %s", id).
+		where("deleted_at > %s", utctime.Now().Add(-store.retention))
+	err = store.modify(ctx, f, userstore.ErrNotFound, func(tx *sql.Tx, rec *userstore.Record) error {
+		usr := rec.Data
+		usr.UpdatedAt = utctime.Now()
+		usr.Version += 1
+		rec.DeletedAt = nil
+		user = *usr
+		return store.save(ctx, tx, rec, eventFor(userstore.Restored, usr.ID, usr.Version, usr))
+	})
+	if err != nil {
+		span.RecordError(err)
+		return userstore.User{}, err
+	}
+	return user, nil
+}
+
+// Replay adds an event with the Replayed action carrying the current state of the user of the tenant of ctx with the
+// given id, without changing the user or its version. ErrNotFound is returned if there is no such user
+func (store *Store) Replay(ctx context.Context, id uuid.UUID) (user userstore.User, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "ReplayRecord")
+	defer span.End()
+	err = store.modify(ctx, userFilter(ctx, id), userstore.ErrNotFound, func(tx *sql.Tx, rec *userstore.Record) error {
+		user = *rec.Data
+		return store.addEvent(ctx, tx, rec.Tenant, eventFor(userstore.Replayed, user.ID, user.Version, &user))
+	})
+	if err != nil {
+		span.RecordError(err)
+		return userstore.User{}, err
+	}
+	return user, nil
+}
+
+// Purge irrecoverably deletes the records of every tenant which were soft deleted more than the retention of the store
+// ago, returning the number of records purged. No events are added, since the deletions have already been published
+func (store *Store) Purge(ctx context.Context) (int64, error) {
+	if store.retention == 0 {
+		return 0, nil
+	}
+	return store.PurgeDeletedBefore(ctx, utctime.Now().Add(-store.retention))
+}
+
+// PurgeDeletedBefore irrecoverably deletes the records of every tenant which were soft deleted at or before cutoff,
+// returning the number of records purged
+func (store *Store) PurgeDeletedBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "PurgeRecords")
+	defer span.End()
+	res, err := store.db.ExecContext(ctx, "DELETE FROM users WHERE deleted_at <= $1", timeText(cutoff))
+	if err != nil {
+		span.RecordError(err)
+		return 0, fmt.Errorf("cannot purge deleted users: %w", err)
+	}
+	purged, err := res.RowsAffected()
+	if err != nil {
+		span.RecordError(err)
+		return 0, fmt.Errorf("cannot purge deleted users: %w", err)
+	}
+	return purged, nil
+}
+
+// inactiveFilter returns the filter for active users of every tenant who have not been seen since the given time,
+// including users created before it who have never been seen
+func inactiveFilter(inactiveSince time.Time) *filter {
+	return (&filter{}).
+		where(notDeleted).
+		where("status IN ('', %s)", userstore.StatusActive).
+		where("created_at < %s", inactiveSince).
+		where("(last_seen_at IS NULL OR last_seen_at < %s)", inactiveSince)
+}
+
+// MarkDormant changes the status of the active users of every tenant who have not been seen since the given time,
+// including users created before it who have never been seen, to dormant, adding an event with the MarkedDormant
+// action for each. It returns the number of users made dormant. A user who is seen or changed by another caller
+// before they are made dormant is skipped, since they may no longer be inactive
+func (store *Store) MarkDormant(ctx context.Context, inactiveSince time.Time) (int64, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "MarkDormantRecords")
+	defer span.End()
+	f := inactiveFilter(inactiveSince)
+	rows, err := store.db.QueryContext(ctx, "SELECT id, tenant FROM users WHERE "+f.String(), f.args...)
+	if err != nil {
+		span.RecordError(err)
+		return 0, fmt.Errorf("cannot find inactive users: %w", err)
+	}
+	// the users are read before any are changed, so that changing them does not need a second connection while the
+	// rows are open
+	type inactiveUser struct {
+		id     uuid.UUID
+		tenant string
+	}
+	var inactive []inactiveUser
+	for rows.Next() {
+		var usr inactiveUser
+		if err := rows.Scan(&usr.id, &usr.tenant); err != nil {
+			rows.Close()
+			span.RecordError(err)
+			return 0, fmt.Errorf("cannot read inactive user: %w", err)
+		}
+		inactive = append(inactive, usr)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		span.RecordError(err)
+		return 0, fmt.Errorf("cannot find inactive users: %w", err)
+	}
+
+	var marked int64
+	for _, usr := range inactive {
+		// the user is only changed if they are still inactive
+		f := inactiveFilter(inactiveSince).where("tenant = %s", usr.tenant).where("id = %s", usr.id)
+		err := store.modify(ctx, f, userstore.ErrNotFound, func(tx *sql.Tx, rec *userstore.Record) error {
+			rec.Data.Status = userstore.StatusDormant
+			rec.Data.UpdatedAt = utctime.Now()
+			rec.Data.Version += 1
+			return store.save(ctx, tx, rec, eventFor(userstore.MarkedDormant, rec.ID, rec.Data.Version, rec.Data))
+		})
+		switch {
+		case errors.Is(err, userstore.ErrNotFound):
+		case err != nil:
+			span.RecordError(err)
+			return marked, fmt.Errorf("cannot make user dormant: %w", err)
+		default:
+			marked += 1
+		}
+	}
+	return marked, nil
+}
+
+// filterFromQuery returns the filter for users of the tenant of ctx matching query. Soft deleted users never match
+func (store *Store) filterFromQuery(ctx context.Context, query *userstore.Query) *filter {
+	f := (&filter{}).
+		where("tenant = %s", tenant.FromContext(ctx)).
+		where(notDeleted).
+		where("created_at >= %s", query.CreatedAfter)
+	if len(query.Countries) > 0 {
+		f.where("country IN (" + f.list(query.Countries) + ")")
+	}
+	createdBefore := query.CreatedBefore
+	if !query.InactiveSince.IsZero() {
+		// users are seen after they are created, so users who were last seen before the time were created before it
+		if createdBefore.IsZero() || query.InactiveSince.Before(createdBefore) {
+			createdBefore = query.InactiveSince
+		}
+		f.where("(last_seen_at IS NULL OR last_seen_at < %s)", query.InactiveSince)
+	}
+	if !createdBefore.IsZero() {
+		f.where("created_at < %s", createdBefore)
+	}
+	switch query.Status {
+	case "":
+	case userstore.StatusActive:
+		// users without a status are active
+		f.where("status IN ('', %s)", query.Status)
+	default:
+		f.where("status = %s", query.Status)
+	}
+	if query.Search != "" {
+		f.where(store.dialect.Search(f.arg, query.Search))
+	}
+	if query.Nickname != "" {
+		f.where("nickname = %s", query.Nickname)
+	}
+	if query.Email != "" {
+		f.where("email = %s", query.Email)
+	}
+	if query.NamePrefix != "" {
+		f.where(store.dialect.NamePrefix(f.arg, query.NamePrefix))
+	}
+	return f
+}
+
+// orderFromQuery returns the order of the results of the query. The id is used as a tie breaker so that the order
+// of results is stable between pages
+func orderFromQuery(query *userstore.Query) (string, error) {
+	field := query.SortBy
+	if field == "" {
+		field = userstore.SortCreatedAt
+	}
+	column, ok := sortColumns[field]
+	if !ok || (query.AfterID != uuid.Nil && field != userstore.SortCreatedAt) {
+		return "", userstore.ErrInvalidSort
+	}
+	direction := "ASC"
+	if query.SortDescending {
+		direction = "DESC"
+	}
+	return fmt.Sprintf("%[1]s %[2]s, id %[2]s", column, direction), nil
+}
+
+// limitFromQuery returns the number of users to read for the page of the query, which must have a length. When the
+// query skips counting the matching users, one more user is read, to find whether more users follow the page
+func limitFromQuery(query *userstore.Query) int64 {
+	if query.SkipTotal {
+		return int64(query.Length) + 1
+	}
+	return int64(query.Length)
+}
+
+// skipFromQuery returns the number of users to skip to reach the page of the query. No users are skipped when the
+// query starts after a user
+func skipFromQuery(query *userstore.Query) int64 {
+	if query.AfterID != uuid.Nil {
+		return 0
+	}
+	skip := int64(query.Length) * (query.Page - 1)
+	if skip < int64(0) {
+		skip = int64(0)
+	}
+	return skip
+}
+
+// FindMany fetches pages of users matching the given query. Each request also returns the total count of users
+func (store *Store) FindMany(ctx context.Context, query *userstore.Query) (page userstore.Page, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "FindUserRecords")
+	defer span.End()
+
+	order, err := orderFromQuery(query)
+	if err != nil {
+		span.RecordError(err)
+		return page, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, findTimeout)
+	defer cancel()
+
+	page.Page = query.Page
+	page.Total = userstore.UnknownTotal
+	if !query.SkipTotal {
+		if page.Total, err = store.count(ctx, query); err != nil {
+			span.RecordError(err)
+			return page, err
+		}
+	}
+
+	f := store.filterFromQuery(ctx, query)
+	if query.AfterID != uuid.Nil {
+		// users after the last user of the previous page, in the order given by orderFromQuery
+		operator := ">"
+		if query.SortDescending {
+			operator = "<"
+		}
+		f.where("(created_at, id) "+operator+" (%s, %s)", query.AfterCreatedAt, query.AfterID)
+	}
+	statement := fmt.Sprintf("%s WHERE %s ORDER BY %s", selectRecord, f, order)
+	if query.Length > 0 {
+		// users are only skipped when pages have a length
+		statement += fmt.Sprintf(" LIMIT %d OFFSET %d", limitFromQuery(query), skipFromQuery(query))
+	}
+	rows, err := store.db.QueryContext(ctx, statement, f.args...)
+	if err != nil {
+		span.RecordError(err)
+		return page, fmt.Errorf("cannot find matching users: %w", err)
+	}
+	defer rows.Close()
+	page.Items = make([]userstore.User, 0, query.Length)
+	for rows.Next() {
+		rec, err := store.scanRecord(rows)
+		if err != nil {
+			span.RecordError(err)
+			return page, fmt.Errorf("cannot read matching user: %w", err)
+		}
+		page.Items = append(page.Items, *rec.Data)
+	}
+	if err = rows.Err(); err != nil {
+		span.RecordError(err)
+		return page, fmt.Errorf("cannot find matching users: %w", err)
+	}
+	if query.SkipTotal && query.Length > 0 && len(page.Items) > int(query.Length) {
+		page.Items = page.Items[:query.Length]
+		page.HasMore = true
+	}
+	return page, nil
+}
+
+// count returns the total count of users matching the given query
+func (store *Store) count(ctx context.Context, query *userstore.Query) (int64, error) {
+	f := store.filterFromQuery(ctx, query)
+	var total int64
+	if err := store.db.QueryRowContext(ctx, "SELECT count(*) FROM users WHERE "+f.String(), f.args...).Scan(&total); err != nil {
+		return 0, fmt.Errorf("cannot count matching users: %w", err)
+	}
+	return total, nil
+}
+
+// Count returns the total count of users matching the given query, without fetching any of them.
+// The length, page and sort of the query are ignored
+func (store *Store) Count(ctx context.Context, query *userstore.Query) (int64, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "CountUserRecords")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, findTimeout)
+	defer cancel()
+
+	total, err := store.count(ctx, query)
+	if err != nil {
+		span.RecordError(err)
+	}
+	return total, err
+}
+
+// rowsCursor is a userstore.Cursor over rows of the recordColumns of the users table
+type rowsCursor struct {
+	store *Store
+	rows  *sql.Rows
+}
+
+func (c *rowsCursor) Next(context.Context) bool {
+	return c.rows.Next()
+}
+
+func (c *rowsCursor) Decode(val interface{}) error {
+	rec, ok := val.(*userstore.Record)
+	if !ok {
+		return fmt.Errorf("cannot decode user record into %T", val)
+	}
+	var err error
+	*rec, err = c.store.scanRecord(c.rows)
+	return err
+}
+
+func (c *rowsCursor) Err() error {
+	return c.rows.Err()
+}
+
+func (c *rowsCursor) Close(context.Context) error {
+	return c.rows.Close()
+}
+
+// Iterate returns a UserIterator over all of the users matching the given query, in the order given by the query.
+// The length and page of the query are ignored. Unlike FindMany, no timeout is applied, so ctx must be cancelled
+// to abandon a slow iteration
+func (store *Store) Iterate(ctx context.Context, query *userstore.Query) (userstore.UserIterator, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "IterateUserRecords")
+	defer span.End()
+
+	order, err := orderFromQuery(query)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	f := store.filterFromQuery(ctx, query)
+	rows, err := store.db.QueryContext(ctx, selectRecord+" WHERE "+f.String()+" ORDER BY "+order, f.args...)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("cannot find matching users: %w", err)
+	}
+	return userstore.NewIterator(&rowsCursor{store: store, rows: rows}), nil
+}
+
+// Stats counts the users matching the given query by country and by the interval in which they were created, using
+// a single query. Weeks start on Monday, and periods start at midnight UTC. The length, page and sort of the
+// query are ignored
+func (store *Store) Stats(ctx context.Context, query *userstore.Query, interval userstore.StatsInterval) (userstore.Stats, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "UserRecordStats")
+	defer span.End()
+
+	signup, ok := store.dialect.PeriodStart(interval)
+	if !ok {
+		err := fmt.Errorf("cannot count users by unknown interval %s", interval)
+		span.RecordError(err)
+		return userstore.Stats{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, findTimeout)
+	defer cancel()
+
+	// rows grouped by country are marked with 0 and ordered first, followed by rows grouped by signup period. The
+	// placeholders of the filter are numbered, so both halves of the query share its arguments
+	f := store.filterFromQuery(ctx, query)
+	rows, err := store.db.QueryContext(ctx, fmt.Sprintf(
+		"SELECT 0, country, NULL, count(*) FROM users WHERE %[2]s GROUP BY country "+
+			"UNION ALL SELECT 1, NULL, %[1]s, count(*) FROM users WHERE %[2]s GROUP BY %[1]s "+
+			"ORDER BY 1, 2, 3", signup, f), f.args...)
+	if err != nil {
+		span.RecordError(err)
+		return userstore.Stats{}, fmt.Errorf("cannot aggregate matching users: %w", err)
+	}
+	defer rows.Close()
+	var stats userstore.Stats
+	for rows.Next() {
+		var grouping int
+		var country, start sql.NullString
+		var total int64
+		if err := rows.Scan(&grouping, &country, &start, &total); err != nil {
+			span.RecordError(err)
+			return userstore.Stats{}, fmt.Errorf("cannot read aggregated users: %w", err)
+		}
+		if grouping == 0 {
+			stats.Countries = append(stats.Countries, userstore.CountryCount{Country: country.String, Total: total})
+			stats.Total += total
+			continue
+		}
+		// the dates of the periods are in UTC, without a time
+		date, err := time.Parse(DateLayout, start.String)
+		if err != nil {
+			span.RecordError(err)
+			return userstore.Stats{}, fmt.Errorf("cannot read aggregated users: %w", err)
+		}
+		stats.Signups = append(stats.Signups, userstore.SignupCount{Start: date, Total: total})
+	}
+	if err = rows.Err(); err != nil {
+		span.RecordError(err)
+		return userstore.Stats{}, fmt.Errorf("cannot read aggregated users: %w", err)
+	}
+	return stats, nil
+}
+
+// Backlog measures the events of every tenant which have not been processed, so that publishing falling behind can
+// be detected
+func (store *Store) Backlog(ctx context.Context) (userstore.Backlog, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "EventBacklog")
+	defer span.End()
+
+	var backlog userstore.Backlog
+	var oldest sql.NullString
+	// the events of a user with a dead lettered event wait until it is requeued. Only the first event of a user can be
+	// dead lettered
+	err := store.db.QueryRowContext(ctx,
+		"SELECT count(*), min(created_at) FROM user_events "+
+			"WHERE user_id NOT IN (SELECT user_id FROM user_events WHERE state = $1)", userstore.DeadLettered,
+	).Scan(&backlog.Pending, &oldest)
+	if err != nil {
+		span.RecordError(err)
+		return userstore.Backlog{}, fmt.Errorf("cannot count pending events: %w", err)
+	}
+	if backlog.Oldest, err = timeOf(oldest); err != nil {
+		span.RecordError(err)
+		return userstore.Backlog{}, err
+	}
+	return backlog, nil
+}
+
+// nextEvents marks up to eventBatchSize of the events waiting to be processed as processing and returns them, oldest
+// first
+func (store *Store) nextEvents(ctx context.Context, retryTimeout time.Duration) ([]userstore.Event, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "FetchEvents")
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, findTimeout)
+	defer cancel()
+	now := utctime.Now()
+	rows, err := store.db.QueryContext(ctx, fmt.Sprintf(nextEventsStatement, store.dialect.Lock(true)),
+		userstore.Processing, timeText(now), userstore.Pending, timeText(now.Add(-1*retryTimeout)), eventBatchSize)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("cannot claim events: %w", err)
+	}
+	defer rows.Close()
+	events := make([]userstore.Event, 0)
+	for rows.Next() {
+		evt, err := scanEvent(rows)
+		if err != nil {
+			span.RecordError(err)
+			return nil, fmt.Errorf("cannot read claimed event: %w", err)
+		}
+		events = append(events, evt)
+	}
+	if err = rows.Err(); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("cannot read claimed events: %w", err)
+	}
+	// the rows returned by an update are not ordered
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].CreatedAt.Before(events[j].CreatedAt)
+	})
+	return events, nil
+}
+
+// Events returns a channel of events from the store. Events are claimed in batches of up to eventBatchSize, and the
+// next batch is claimed without waiting when a batch is full
+func (store *Store) Events(ctx context.Context, minInterval, maxInterval, retryTimeout time.Duration) <-chan userstore.EventResult {
+	out := make(chan userstore.EventResult)
+	go func() {
+		defer close(out)
+		source := rand.New(rand.NewSource(utctime.Now().UnixNano()))
+		for {
+			events, err := store.nextEvents(ctx, retryTimeout)
+			results := make([]userstore.EventResult, 0, len(events))
+			for _, event := range events {
+				results = append(results, userstore.EventResult{Event: event})
+			}
+			if err != nil {
+				results = append(results, userstore.EventResult{Err: err})
+			}
+			for _, result := range results {
+				select {
+				case <-ctx.Done():
+					return
+				case out <- result:
+				}
+			}
+			if err != nil || len(events) < eventBatchSize {
+				// there are no more waiting events, so wait before polling again rather than querying in a tight loop
+				waitWithJitter(ctx, minInterval, maxInterval, source)
+			}
+			if ctx.Err() != nil {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+func waitWithJitter(ctx context.Context, minInterval, maxInterval time.Duration, source *rand.Rand) {
+	min, max := int64(minInterval), int64(maxInterval)
+	after := time.After(minInterval + time.Duration(source.Int63n(max-min)))
+	select {
+	case <-ctx.Done():
+	case <-after:
+	}
+}
+
+// ProcessEvent marks the matching event as processed by removing it from the store
+func (store *Store) ProcessEvent(ctx context.Context, id uuid.UUID, version int64) error {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "ProcessEvent")
+	defer span.End()
+	_, err := store.db.ExecContext(ctx,
+		"DELETE FROM user_events WHERE seq = (SELECT min(seq) FROM user_events WHERE user_id = $1) "+
+			"AND state = $2 AND version = $3",
+		id, userstore.Processing, version)
+	if err != nil {
+		span.RecordError(err)
+		err = fmt.Errorf("cannot complete event: %w", err)
+	}
+	return err
+}
+
+// DeadLetterEvent moves the matching event, which must be being processed, to the DeadLettered state, so that it is
+// not processed again until it is requeued with RequeueDeadLetter
+func (store *Store) DeadLetterEvent(ctx context.Context, id uuid.UUID, version int64) error {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "DeadLetterEvent")
+	defer span.End()
+	_, err := store.db.ExecContext(ctx,
+		"UPDATE user_events SET state = $1, updated_at = $2 "+
+			"WHERE seq = (SELECT min(seq) FROM user_events WHERE user_id = $3) AND state = $4 AND version = $5",
+		userstore.DeadLettered, timeText(utctime.Now()), id, userstore.Processing, version)
+	if err != nil {
+		span.RecordError(err)
+		err = fmt.Errorf("cannot dead letter event: %w", err)
+	}
+	return err
+}
+
+// DeadLetters reads the dead lettered events of the users of the tenant of ctx, including deleted users, in the order
+// they were dead lettered
+func (store *Store) DeadLetters(ctx context.Context) ([]userstore.Event, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "ReadDeadLetters")
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, findTimeout)
+	defer cancel()
+	rows, err := store.db.QueryContext(ctx,
+		"SELECT "+eventColumns+" FROM user_events WHERE tenant = $1 AND state = $2 ORDER BY updated_at",
+		tenant.FromContext(ctx), userstore.DeadLettered)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("cannot find dead letters: %w", err)
+	}
+	defer rows.Close()
+	events := make([]userstore.Event, 0)
+	for rows.Next() {
+		evt, err := scanEvent(rows)
+		if err != nil {
+			span.RecordError(err)
+			return nil, fmt.Errorf("cannot read dead letter: %w", err)
+		}
+		events = append(events, evt)
+	}
+	if err = rows.Err(); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("cannot read dead letters: %w", err)
+	}
+	return events, nil
+}
+
+// RequeueDeadLetter returns the dead lettered event of the user identified by id to the Pending state, with no
+// attempts, so that it is processed again. It returns userstore.ErrNotFound if the user, in the tenant of ctx, has no
+// dead lettered event
+func (store *Store) RequeueDeadLetter(ctx context.Context, id uuid.UUID) error {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "RequeueDeadLetter")
+	defer span.End()
+	res, err := store.db.ExecContext(ctx,
+		"UPDATE user_events SET state = $1, updated_at = $2, attempts = 0 "+
+			"WHERE user_id = $3 AND tenant = $4 AND state = $5",
+		userstore.Pending, timeText(utctime.Now()), id, tenant.FromContext(ctx), userstore.DeadLettered)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("cannot requeue dead letter: %w", err)
+	}
+	requeued, err := res.RowsAffected()
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("cannot requeue dead letter: %w", err)
+	}
+	if requeued == 0 {
+		span.RecordError(userstore.ErrNotFound)
+		return userstore.ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,271 @@
+package storetest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/tenant"
+	"github.com/stretchr/testify/require"
+)
+
+func testCanCreateAndReadAUser(t *testing.T, newStore Factory) {
+	withStore(t, newStore, func(ctx context.Context, store Store) {
+		rec := fakeUser()
+		created, err := store.Create(ctx, &rec)
+		require.NoError(t, err)
+		compareUsers(t, rec, created)
+
+		read, err := store.ReadOne(ctx, rec.ID)
+		require.NoError(t, err)
+		compareUsers(t, rec, read)
+		require.Equal(t, rec.Version, read.Version)
+
+		_, err = store.ReadOne(ctx, uuid.Must(uuid.NewRandom()))
+		require.ErrorIs(t, err, userstore.ErrNotFound)
+	})
+}
+
+func testCannotCreateClashingUsers(t *testing.T, newStore Factory) {
+	cases := []struct {
+		name     string
+		userA    userstore.User
+		userB    userstore.User
+		expected error
+	}{
+		{
+			name:     "Clashing Email",
+			expected: userstore.ErrEmailInUse,
+			userA:    fakeUser(func(u *userstore.User) { u.Email = "abc@example.com" }),
+			userB:    fakeUser(func(u *userstore.User) { u.Email = "abc@example.com" }),
+		},
+		{
+			name:     "Clashing Nickname",
+			expected: userstore.ErrNicknameInUse,
+			userA:    fakeUser(func(u *userstore.User) { u.Nickname = "superoriginal" }),
+			userB:    fakeUser(func(u *userstore.User) { u.Nickname = "superoriginal" }),
+		},
+	}
+	for _, c := range cases {
+		thisCase := c
+		t.Run(thisCase.name, func(t *testing.T) {
+			withStore(t, newStore, func(ctx context.Context, store Store) {
+				_, err := store.Create(ctx, &thisCase.userA)
+				require.NoError(t, err)
+				_, err = store.Create(ctx, &thisCase.userB)
+				require.ErrorIs(t, err, userstore.ErrAlreadyExists)
+				require.ErrorIs(t, err, thisCase.expected)
+			})
+		})
+	}
+}
+
+func testCreateManyCreatesUsersWhichDoNotConflict(t *testing.T, newStore Factory) {
+	existing := fakeUser()
+	users := []userstore.User{
+		fakeUser(),
+		fakeUser(func(u *userstore.User) { u.Email = existing.Email }),
+		fakeUser(func(u *userstore.User) { u.Nickname = "repeated" }),
+		fakeUser(func(u *userstore.User) { u.Nickname = "repeated" }),
+	}
+	withStore(t, newStore, func(ctx context.Context, store Store) {
+		createMany(ctx, t, store, existing)
+
+		errs, err := store.CreateMany(ctx, users)
+		require.NoError(t, err)
+		require.Len(t, errs, len(users))
+		require.NoError(t, errs[0])
+		require.ErrorIs(t, errs[1], userstore.ErrEmailInUse)
+		require.NoError(t, errs[2])
+		require.ErrorIs(t, errs[3], userstore.ErrNicknameInUse)
+
+		for _, created := range []userstore.User{users[0], users[2]} {
+			read, err := store.ReadOne(ctx, created.ID)
+			require.NoError(t, err)
+			compareUsers(t, created, read)
+		}
+		_, err = store.ReadOne(ctx, users[1].ID)
+		require.ErrorIs(t, err, userstore.ErrNotFound)
+	})
+}
+
+func testCreateWithKeyReturnsTheUserCreatedWithTheSameKey(t *testing.T, newStore Factory) {
+	withStore(t, newStore, func(ctx context.Context, store Store) {
+		rec := fakeUser()
+		_, err := store.CreateWithKey(ctx, &rec, "some key")
+		require.NoError(t, err)
+
+		// a retry has the same details, but is given a new id, and its password is hashed again
+		retry := rec
+		retry.ID = uuid.Must(uuid.NewRandom())
+		retry.PasswordHash = "anothersecrethash"
+		created, err := store.CreateWithKey(ctx, &retry, "some key")
+		require.NoError(t, err)
+		compareUsers(t, rec, created)
+
+		other := fakeUser()
+		created, err = store.CreateWithKey(ctx, &other, "another key")
+		require.NoError(t, err)
+		compareUsers(t, other, created)
+
+		// the key of a deleted user cannot be used to create another user
+		require.NoError(t, store.DeleteOne(ctx, rec.ID))
+		_, err = store.CreateWithKey(ctx, &retry, "some key")
+		require.ErrorIs(t, err, userstore.ErrAlreadyExists)
+	})
+}
+
+func testCreateWithKeyRejectsADifferentUserWithTheSameKey(t *testing.T, newStore Factory) {
+	withStore(t, newStore, func(ctx context.Context, store Store) {
+		rec := fakeUser()
+		_, err := store.CreateWithKey(ctx, &rec, "some key")
+		require.NoError(t, err)
+
+		other := fakeUser()
+		_, err = store.CreateWithKey(ctx, &other, "some key")
+		require.ErrorIs(t, err, userstore.ErrIdempotencyKeyReused)
+		_, err = store.ReadOne(ctx, other.ID)
+		require.ErrorIs(t, err, userstore.ErrNotFound)
+
+		changed := rec
+		changed.ID = uuid.Must(uuid.NewRandom())
+		changed.Country = "NL"
+		_, err = store.CreateWithKey(ctx, &changed, "some key")
+		require.ErrorIs(t, err, userstore.ErrIdempotencyKeyReused)
+	})
+}
+
+func testCannotCreateClashingUserWithNewIdempotencyKey(t *testing.T, newStore Factory) {
+	rec := fakeUser()
+	cases := []struct {
+		name     string
+		clashing userstore.User
+		expected error
+	}{
+		{
+			name:     "Clashing Email",
+			clashing: fakeUser(func(u *userstore.User) { u.Email = rec.Email }),
+			expected: userstore.ErrEmailInUse,
+		},
+		{
+			name:     "Clashing Nickname",
+			clashing: fakeUser(func(u *userstore.User) { u.Nickname = rec.Nickname }),
+			expected: userstore.ErrNicknameInUse,
+		},
+	}
+	for _, c := range cases {
+		thisCase := c
+		t.Run(thisCase.name, func(t *testing.T) {
+			withStore(t, newStore, func(ctx context.Context, store Store) {
+				_, err := store.CreateWithKey(ctx, &rec, "some key")
+				require.NoError(t, err)
+				_, err = store.CreateWithKey(ctx, &thisCase.clashing, "another key")
+				require.ErrorIs(t, err, thisCase.expected)
+			})
+		})
+	}
+}
+
+func testEmailAndNicknameExist(t *testing.T, newStore Factory) {
+	withStore(t, newStore, func(ctx context.Context, store Store) {
+		rec := fakeUser()
+		createMany(ctx, t, store, rec)
+
+		exists, err := store.EmailExists(ctx, rec.Email)
+		require.NoError(t, err)
+		require.True(t, exists)
+		exists, err = store.NicknameExists(ctx, rec.Nickname)
+		require.NoError(t, err)
+		require.True(t, exists)
+		exists, err = store.EmailExists(ctx, "unused@example.com")
+		require.NoError(t, err)
+		require.False(t, exists)
+		exists, err = store.NicknameExists(ctx, "unused")
+		require.NoError(t, err)
+		require.False(t, exists)
+
+		found, err := store.FindByNickname(ctx, rec.Nickname)
+		require.NoError(t, err)
+		compareUsers(t, rec, found)
+		found, err = store.FindByEmail(ctx, rec.Email)
+		require.NoError(t, err)
+		compareUsers(t, rec, found)
+		_, err = store.FindByNickname(ctx, "unused")
+		require.ErrorIs(t, err, userstore.ErrNotFound)
+		_, err = store.FindByEmail(ctx, "unused@example.com")
+		require.ErrorIs(t, err, userstore.ErrNotFound)
+	})
+}
+
+func testReadManyReturnsUsersInTheOrderRequested(t *testing.T, newStore Factory) {
+	withStore(t, newStore, func(ctx context.Context, store Store) {
+		rec1 := fakeUser()
+		rec2 := fakeUser()
+		deleted := fakeUser()
+		createMany(ctx, t, store, rec1, rec2, deleted)
+		require.NoError(t, store.DeleteOne(ctx, deleted.ID))
+
+		users, err := store.ReadMany(ctx, []uuid.UUID{rec2.ID, uuid.Must(uuid.NewRandom()), rec1.ID, deleted.ID})
+		require.NoError(t, err)
+		require.Equal(t, []uuid.UUID{rec2.ID, uuid.Nil, rec1.ID, uuid.Nil}, idsOf(users))
+		compareUsers(t, rec2, users[0])
+
+		users, err = store.ReadMany(tenant.With(ctx, "acme"), []uuid.UUID{rec1.ID})
+		require.NoError(t, err)
+		require.Equal(t, []userstore.User{{}}, users, "users of other tenants are not read")
+	})
+}
+
+func testRecordsReadFromTheStoreCannotChangeIt(t *testing.T, newStore Factory) {
+	withStore(t, newStore, func(ctx context.Context, store Store) {
+		rec := fakeUser()
+		createMany(ctx, t, store, rec)
+		require.NoError(t, store.BeginTwoFactor(ctx, rec.ID, "sealed secret"))
+		_, err := store.EnableTwoFactor(ctx, rec.ID, "sealed secret", 1, []string{"code hash"})
+		require.NoError(t, err)
+
+		record, err := store.ReadRecord(ctx, rec.ID)
+		require.NoError(t, err)
+		record.Data.Nickname = "changed"
+		record.TwoFactor.RecoveryCodes[0] = "changed"
+		record.Events[0].Action = userstore.Deleted
+
+		record, err = store.ReadRecord(ctx, rec.ID)
+		require.NoError(t, err)
+		require.Equal(t, rec.Nickname, record.Data.Nickname)
+		require.Equal(t, []string{"code hash"}, record.TwoFactor.RecoveryCodes)
+		require.Equal(t, userstore.Created, record.Events[0].Action)
+	})
+}
+
+func testUsersOfOtherTenantsAreNotSeen(t *testing.T, newStore Factory) {
+	withStore(t, newStore, func(ctx context.Context, store Store) {
+		acme, other := tenant.With(ctx, "acme"), tenant.With(ctx, "other")
+		rec := fakeUser()
+		_, err := store.Create(acme, &rec)
+		require.NoError(t, err)
+
+		_, err = store.ReadOne(other, rec.ID)
+		require.ErrorIs(t, err, userstore.ErrNotFound)
+		_, err = store.ReadOne(ctx, rec.ID)
+		require.ErrorIs(t, err, userstore.ErrNotFound)
+		require.ErrorIs(t, store.DeleteOne(other, rec.ID), userstore.ErrNotFound)
+		exists, err := store.EmailExists(other, rec.Email)
+		require.NoError(t, err)
+		require.False(t, exists)
+
+		// emails and nicknames are only unique within a tenant
+		clash := fakeUser(func(u *userstore.User) { u.Email = rec.Email; u.Nickname = rec.Nickname })
+		_, err = store.Create(other, &clash)
+		require.NoError(t, err)
+
+		page, err := store.FindMany(acme, &userstore.Query{Length: 10, Page: 1})
+		require.NoError(t, err)
+		require.Equal(t, int64(1), page.Total)
+		require.Equal(t, rec.ID, page.Items[0].ID)
+		read, err := store.ReadOne(acme, rec.ID)
+		require.NoError(t, err)
+		compareUsers(t, rec, read)
+	})
+}
@@ -0,0 +1,191 @@
+package storetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/stretchr/testify/require"
+)
+
+func testDeletedUsersCannotBeDeletedAgain(t *testing.T, newStore Factory) {
+	withStore(t, newStore, func(ctx context.Context, store Store) {
+		rec1 := fakeUser()
+		rec2 := fakeUser()
+		createMany(ctx, t, store, rec1, rec2)
+
+		// deleting more than one user checks that the unique indexes ignore deleted users
+		require.NoError(t, store.DeleteOne(ctx, rec1.ID))
+		require.NoError(t, store.DeleteOne(ctx, rec2.ID))
+		require.ErrorIs(t, store.DeleteOne(ctx, rec1.ID), userstore.ErrNotFound)
+		require.ErrorIs(t, store.DeleteOne(ctx, uuid.Must(uuid.NewRandom())), userstore.ErrNotFound)
+		deleted, err := store.DeleteMany(ctx, []uuid.UUID{rec1.ID})
+		require.NoError(t, err)
+		require.Empty(t, deleted)
+	})
+}
+
+func testDeleteManyReturnsDeletedIDs(t *testing.T, newStore Factory) {
+	withStore(t, newStore, func(ctx context.Context, store Store) {
+		rec1 := fakeUser()
+		rec2 := fakeUser()
+		kept := fakeUser()
+		createMany(ctx, t, store, rec1, rec2, kept)
+
+		deleted, err := store.DeleteMany(ctx, []uuid.UUID{rec1.ID, uuid.Must(uuid.NewRandom()), rec2.ID})
+		require.NoError(t, err)
+		require.ElementsMatch(t, []uuid.UUID{rec1.ID, rec2.ID}, deleted)
+		_, err = store.ReadOne(ctx, rec1.ID)
+		require.ErrorIs(t, err, userstore.ErrNotFound)
+		_, err = store.ReadOne(ctx, kept.ID)
+		require.NoError(t, err)
+	})
+}
+
+func testDeletionEventsCarryTheEmailAddressOfTheUser(t *testing.T, newStore Factory) {
+	withSoftDeletingStore(t, newStore, time.Hour, func(ctx context.Context, store Store) {
+		rec1 := fakeUser()
+		rec2 := fakeUser()
+		createMany(ctx, t, store, rec1, rec2)
+		require.NoError(t, store.DeleteOne(ctx, rec1.ID))
+		_, err := store.DeleteMany(ctx, []uuid.UUID{rec2.ID})
+		require.NoError(t, err)
+
+		for _, rec := range []userstore.User{rec1, rec2} {
+			stored, err := store.ReadRecord(ctx, rec.ID)
+			require.NoError(t, err)
+			require.Len(t, stored.Events, 2)
+			require.Equal(t, userstore.Deleted, stored.Events[1].Action)
+			require.Equal(t, rec.Email, stored.Events[1].Email)
+			require.Nil(t, stored.Events[1].Data)
+		}
+	})
+}
+
+func testSoftDeletedUsersAreNotRead(t *testing.T, newStore Factory) {
+	withSoftDeletingStore(t, newStore, time.Hour, func(ctx context.Context, store Store) {
+		rec := fakeUser()
+		createMany(ctx, t, store, rec)
+		require.NoError(t, store.DeleteOne(ctx, rec.ID))
+
+		_, err := store.ReadOne(ctx, rec.ID)
+		require.ErrorIs(t, err, userstore.ErrNotFound)
+		_, err = store.FindByEmail(ctx, rec.Email)
+		require.ErrorIs(t, err, userstore.ErrNotFound)
+		_, err = store.FindByNickname(ctx, rec.Nickname)
+		require.ErrorIs(t, err, userstore.ErrNotFound)
+		page, err := store.FindMany(ctx, &userstore.Query{Length: 10, Page: 1})
+		require.NoError(t, err)
+		require.Empty(t, page.Items)
+		require.Zero(t, page.Total)
+		require.ErrorIs(t, store.DeleteOne(ctx, rec.ID), userstore.ErrNotFound)
+
+		// soft deleted users keep their email address and nickname until they are purged
+		exists, err := store.EmailExists(ctx, rec.Email)
+		require.NoError(t, err)
+		require.True(t, exists)
+		other := fakeUser(func(u *userstore.User) { u.Email = rec.Email })
+		_, err = store.Create(ctx, &other)
+		require.ErrorIs(t, err, userstore.ErrAlreadyExists)
+	})
+}
+
+func testSoftDeletedUsersCanBeRestoredAndPurged(t *testing.T, newStore Factory) {
+	withSoftDeletingStore(t, newStore, time.Hour, func(ctx context.Context, store Store) {
+		rec := fakeUser()
+		createMany(ctx, t, store, rec)
+		deleted, err := store.DeleteMany(ctx, []uuid.UUID{rec.ID})
+		require.NoError(t, err)
+		require.Equal(t, []uuid.UUID{rec.ID}, deleted)
+
+		restored, err := store.Restore(ctx, rec.ID)
+		require.NoError(t, err)
+		require.Equal(t, rec.ID, restored.ID)
+		require.Equal(t, rec.Email, restored.Email)
+		require.Equal(t, rec.Version+1, restored.Version)
+		read, err := store.ReadOne(ctx, rec.ID)
+		require.NoError(t, err)
+		require.Equal(t, restored.Version, read.Version)
+		stored, err := store.ReadRecord(ctx, rec.ID)
+		require.NoError(t, err)
+		require.Equal(t, userstore.Restored, lastEvent(&stored).Action)
+
+		_, err = store.Restore(ctx, rec.ID)
+		require.ErrorIs(t, err, userstore.ErrNotFound)
+		_, err = store.Restore(ctx, uuid.Must(uuid.NewRandom()))
+		require.ErrorIs(t, err, userstore.ErrNotFound)
+
+		// users deleted within the retention are not purged
+		require.NoError(t, store.DeleteOne(ctx, rec.ID))
+		purged, err := store.Purge(ctx)
+		require.NoError(t, err)
+		require.Zero(t, purged)
+	})
+}
+
+func testSoftDeletedUsersCannotBeRestoredAfterRetention(t *testing.T, newStore Factory) {
+	withSoftDeletingStore(t, newStore, time.Millisecond, func(ctx context.Context, store Store) {
+		rec := fakeUser()
+		createMany(ctx, t, store, rec)
+		require.NoError(t, store.DeleteOne(ctx, rec.ID))
+		time.Sleep(10 * time.Millisecond)
+
+		_, err := store.Restore(ctx, rec.ID)
+		require.ErrorIs(t, err, userstore.ErrNotFound)
+		purged, err := store.Purge(ctx)
+		require.NoError(t, err)
+		require.Equal(t, int64(1), purged)
+
+		// once purged, the email address and nickname can be used again
+		exists, err := store.EmailExists(ctx, rec.Email)
+		require.NoError(t, err)
+		require.False(t, exists)
+		other := fakeUser(func(u *userstore.User) { u.Email = rec.Email; u.Nickname = rec.Nickname })
+		createMany(ctx, t, store, other)
+	})
+}
+
+func testHardDeletedUsersCannotBeRestored(t *testing.T, newStore Factory) {
+	withStore(t, newStore, func(ctx context.Context, store Store) {
+		rec := fakeUser()
+		createMany(ctx, t, store, rec)
+		require.NoError(t, store.DeleteOne(ctx, rec.ID))
+
+		_, err := store.Restore(ctx, rec.ID)
+		require.ErrorIs(t, err, userstore.ErrNotFound)
+		purged, err := store.Purge(ctx)
+		require.NoError(t, err)
+		require.Zero(t, purged)
+
+		// the email address and nickname can be used again straight away
+		other := fakeUser(func(u *userstore.User) { u.Email = rec.Email; u.Nickname = rec.Nickname })
+		createMany(ctx, t, store, other)
+	})
+}
+
+func testPurgeDeletedBeforeOnlyPurgesUsersDeletedBeforeTheCutoff(t *testing.T, newStore Factory) {
+	withSoftDeletingStore(t, newStore, time.Hour, func(ctx context.Context, store Store) {
+		earlier := fakeUser()
+		later := fakeUser()
+		createMany(ctx, t, store, earlier, later)
+
+		require.NoError(t, store.DeleteOne(ctx, earlier.ID))
+		time.Sleep(10 * time.Millisecond)
+		cutoff := now()
+		time.Sleep(10 * time.Millisecond)
+		require.NoError(t, store.DeleteOne(ctx, later.ID))
+
+		purged, err := store.PurgeDeletedBefore(ctx, cutoff)
+		require.NoError(t, err)
+		require.Equal(t, int64(1), purged)
+
+		exists, err := store.EmailExists(ctx, earlier.Email)
+		require.NoError(t, err)
+		require.False(t, exists)
+		exists, err = store.EmailExists(ctx, later.Email)
+		require.NoError(t, err)
+		require.True(t, exists)
+	})
+}
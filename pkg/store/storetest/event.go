@@ -0,0 +1,187 @@
+package storetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/tenant"
+	"github.com/stretchr/testify/require"
+)
+
+// collectEvents collects n events from store, which are sent again once retryTimeout has passed. Each event is
+// processed once it is collected if processEvent is set
+func collectEvents(ctx context.Context, t *testing.T, store Store, retryTimeout time.Duration, processEvent bool, n int) []userstore.Event {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	collected := make([]userstore.Event, 0, n)
+	events := store.Events(ctx, 10*time.Millisecond, 20*time.Millisecond, retryTimeout)
+	for len(collected) < n {
+		select {
+		case <-ctx.Done():
+			require.FailNow(t, "events were not collected", "collected %d of %d events: %v", len(collected), n, ctx.Err())
+		case e := <-events:
+			require.NoError(t, e.Err)
+			collected = append(collected, e.Event)
+			if processEvent {
+				require.NoError(t, store.ProcessEvent(ctx, e.Event.ID, e.Event.Version))
+			}
+		}
+	}
+	return collected
+}
+
+func testActionsCauseEventsInOrder(t *testing.T, newStore Factory) {
+	withStore(t, newStore, func(ctx context.Context, store Store) {
+		rec := fakeUser()
+		createMany(ctx, t, store, rec)
+		rec.PasswordHash = "newsupersecrethash"
+		_, err := store.ChangePassword(ctx, &rec)
+		require.NoError(t, err)
+		_, err = store.Replay(ctx, rec.ID)
+		require.NoError(t, err)
+		require.NoError(t, store.DeleteOne(ctx, rec.ID))
+
+		events := collectEvents(ctx, t, store, 10*time.Second, true, 4)
+		expected := []userstore.Action{userstore.Created, userstore.PasswordChanged, userstore.Replayed, userstore.Deleted}
+		for i, action := range expected {
+			require.Equal(t, action, events[i].Action)
+			require.Equal(t, rec.ID, events[i].ID)
+		}
+		require.Equal(t, rec.Email, events[0].Data.Email)
+		require.Equal(t, rec.Email, events[3].Email)
+		require.Nil(t, events[3].Data)
+	})
+}
+
+func testEventsCarryTokens(t *testing.T, newStore Factory) {
+	withStore(t, newStore, func(ctx context.Context, store Store) {
+		rec := fakeUser()
+		createMany(ctx, t, store, rec)
+		reset := userstore.ResetToken{Hash: "token hash", ExpiresAt: now().Add(time.Hour)}
+		require.NoError(t, store.RequestPasswordReset(ctx, rec.ID, "token", reset))
+		change := userstore.EmailChange{Email: "new@example.com", Hash: "change hash", ExpiresAt: now().Add(time.Hour)}
+		require.NoError(t, store.RequestEmailChange(ctx, rec.ID, rec.Version, "change token", change))
+
+		events := collectEvents(ctx, t, store, 10*time.Second, true, 3)
+		require.Empty(t, events[0].Token)
+		require.Equal(t, userstore.PasswordResetRequested, events[1].Action)
+		require.Equal(t, "token", events[1].Token)
+		require.Equal(t, rec.Email, events[1].Data.Email)
+		require.Equal(t, userstore.EmailChangeRequested, events[2].Action)
+		require.Equal(t, "change token", events[2].Token)
+		require.Equal(t, "new@example.com", events[2].Email)
+
+		// tokens are not kept once their events are processed
+		stored, err := store.ReadRecord(ctx, rec.ID)
+		require.NoError(t, err)
+		for _, evt := range stored.Events {
+			require.Empty(t, evt.Token)
+		}
+	})
+}
+
+func testTimedOutPendingEventsAreSentAgain(t *testing.T, newStore Factory) {
+	withStore(t, newStore, func(ctx context.Context, store Store) {
+		rec := fakeUser()
+		createMany(ctx, t, store, rec)
+
+		// using a very short retry window so that the same event is sent more than once
+		events := collectEvents(ctx, t, store, 100*time.Millisecond, false, 2)
+		require.Equal(t, events[0].ID, events[1].ID)
+		require.Equal(t, events[0].Version, events[1].Version)
+	})
+}
+
+func testBacklogMeasuresEventsWhichHaveNotBeenProcessed(t *testing.T, newStore Factory) {
+	withStore(t, newStore, func(ctx context.Context, store Store) {
+		backlog, err := store.Backlog(ctx)
+		require.NoError(t, err)
+		require.Zero(t, backlog.Pending)
+		require.True(t, backlog.Oldest.IsZero())
+
+		before := now().Add(-time.Second)
+		rec1 := fakeUser()
+		rec2 := fakeUser()
+		createMany(ctx, t, store, rec1, rec2)
+		require.NoError(t, store.DeleteOne(ctx, rec2.ID))
+
+		backlog, err = store.Backlog(ctx)
+		require.NoError(t, err)
+		require.Equal(t, int64(3), backlog.Pending)
+		require.True(t, backlog.Oldest.After(before))
+
+		collectEvents(ctx, t, store, time.Minute, true, 3)
+		backlog, err = store.Backlog(ctx)
+		require.NoError(t, err)
+		require.Zero(t, backlog.Pending)
+	})
+}
+
+func testEventAttemptsAreCounted(t *testing.T, newStore Factory) {
+	withStore(t, newStore, func(ctx context.Context, store Store) {
+		rec := fakeUser()
+		createMany(ctx, t, store, rec)
+
+		events := collectEvents(ctx, t, store, 100*time.Millisecond, false, 2)
+		require.Equal(t, int64(1), events[0].Attempts)
+		require.Equal(t, int64(2), events[1].Attempts)
+	})
+}
+
+func testDeadLetteredEventsAreNotProcessedUntilRequeued(t *testing.T, newStore Factory) {
+	withStore(t, newStore, func(ctx context.Context, store Store) {
+		rec := fakeUser()
+		createMany(ctx, t, store, rec)
+		_, err := store.Replay(ctx, rec.ID)
+		require.NoError(t, err)
+
+		events := collectEvents(ctx, t, store, time.Minute, false, 1)
+		require.NoError(t, store.DeadLetterEvent(ctx, events[0].ID, events[0].Version))
+
+		deadLetters, err := store.DeadLetters(ctx)
+		require.NoError(t, err)
+		require.Len(t, deadLetters, 1)
+		require.Equal(t, userstore.Created, deadLetters[0].Action)
+		require.Equal(t, userstore.DeadLettered, deadLetters[0].State)
+		require.Equal(t, int64(1), deadLetters[0].Attempts)
+
+		backlog, err := store.Backlog(ctx)
+		require.NoError(t, err)
+		require.Zero(t, backlog.Pending)
+
+		otherTenant := tenant.With(ctx, "other")
+		require.ErrorIs(t, store.RequeueDeadLetter(otherTenant, rec.ID), userstore.ErrNotFound)
+		deadLetters, err = store.DeadLetters(otherTenant)
+		require.NoError(t, err)
+		require.Empty(t, deadLetters)
+
+		require.NoError(t, store.RequeueDeadLetter(ctx, rec.ID))
+		require.ErrorIs(t, store.RequeueDeadLetter(ctx, rec.ID), userstore.ErrNotFound)
+
+		events = collectEvents(ctx, t, store, time.Minute, true, 2)
+		require.Equal(t, userstore.Created, events[0].Action)
+		require.Equal(t, int64(1), events[0].Attempts)
+		require.Equal(t, userstore.Replayed, events[1].Action)
+	})
+}
+
+func testEventsOfManyUsersAreClaimedInBatches(t *testing.T, newStore Factory) {
+	withStore(t, newStore, func(ctx context.Context, store Store) {
+		// more users than fit in a single batch
+		users := make([]userstore.User, 0, 150)
+		for i := 0; i < cap(users); i++ {
+			users = append(users, fakeUser())
+		}
+		createMany(ctx, t, store, users...)
+
+		events := collectEvents(ctx, t, store, time.Minute, true, len(users))
+		ids := make([]uuid.UUID, 0, len(events))
+		for _, e := range events {
+			ids = append(ids, e.ID)
+		}
+		require.ElementsMatch(t, idsOf(users), ids)
+	})
+}
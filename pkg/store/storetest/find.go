@@ -0,0 +1,365 @@
+package storetest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/stretchr/testify/require"
+)
+
+// created is the time the users of the find tests were created, which is a Monday
+var created = time.Date(2022, 4, 4, 0, 0, 0, 0, time.UTC)
+
+// createdHoursAfter returns a change to a user which sets it to have been created hours after created
+func createdHoursAfter(hours int) func(u *userstore.User) {
+	return func(u *userstore.User) { u.CreatedAt = created.Add(time.Duration(hours) * time.Hour) }
+}
+
+// requireIDs fails t unless users are expected, in the same order
+func requireIDs(t *testing.T, expected, users []userstore.User) {
+	require.Equal(t, idsOf(expected), idsOf(users))
+}
+
+func testFindManyReturnsPagesOfMatchingUsers(t *testing.T, newStore Factory) {
+	users := make([]userstore.User, 20)
+	for i := range users {
+		country := "DE"
+		if i%4 == 0 {
+			country = "NL"
+		}
+		users[i] = fakeUser(createdHoursAfter(i), func(u *userstore.User) { u.Country = country })
+	}
+	withStore(t, newStore, func(ctx context.Context, store Store) {
+		page, err := store.FindMany(ctx, &userstore.Query{Length: 10, Page: 1})
+		require.NoError(t, err)
+		require.Equal(t, int64(1), page.Page)
+		require.Zero(t, page.Total)
+		require.Empty(t, page.Items)
+
+		createMany(ctx, t, store, users...)
+		page, err = store.FindMany(ctx, &userstore.Query{Length: 10, Page: 2})
+		require.NoError(t, err)
+		require.Equal(t, int64(2), page.Page)
+		require.Equal(t, int64(20), page.Total)
+		requireIDs(t, users[10:], page.Items)
+		for i, itm := range page.Items {
+			compareUsers(t, users[10+i], itm)
+		}
+
+		page, err = store.FindMany(ctx, &userstore.Query{Length: 2, Page: 2, Countries: []string{"NL"}})
+		require.NoError(t, err)
+		require.Equal(t, int64(5), page.Total)
+		requireIDs(t, []userstore.User{users[8], users[12]}, page.Items)
+
+		page, err = store.FindMany(ctx, &userstore.Query{Length: 2, Page: 1, Countries: []string{"NL", "FR"}, SortDescending: true})
+		require.NoError(t, err)
+		require.Equal(t, int64(5), page.Total)
+		requireIDs(t, []userstore.User{users[16], users[12]}, page.Items)
+
+		total, err := store.Count(ctx, &userstore.Query{Countries: []string{"NL"}})
+		require.NoError(t, err)
+		require.Equal(t, int64(5), total)
+
+		_, err = store.FindMany(ctx, &userstore.Query{Length: 10, Page: 1, SortBy: "password_hash"})
+		require.ErrorIs(t, err, userstore.ErrInvalidSort)
+		_, err = store.Iterate(ctx, &userstore.Query{SortBy: "password_hash"})
+		require.ErrorIs(t, err, userstore.ErrInvalidSort)
+	})
+}
+
+func testFindManySortsByLastName(t *testing.T, newStore Factory) {
+	users := make([]userstore.User, 20)
+	for i := range users {
+		lastName := fmt.Sprintf("Lastname%02d", i)
+		users[i] = fakeUser(func(u *userstore.User) { u.LastName = lastName })
+	}
+	reversed := make([]userstore.User, len(users))
+	for i := range users {
+		reversed[len(users)-1-i] = users[i]
+	}
+	withStore(t, newStore, func(ctx context.Context, store Store) {
+		// creating the users in reverse so that they are not found in the order they were created
+		createMany(ctx, t, store, reversed...)
+		page, err := store.FindMany(ctx, &userstore.Query{Length: 10, Page: 1, SortBy: userstore.SortLastName})
+		require.NoError(t, err)
+		require.Equal(t, int64(20), page.Total)
+		requireIDs(t, users[:10], page.Items)
+
+		page, err = store.FindMany(ctx, &userstore.Query{Length: 10, Page: 1, SortBy: userstore.SortLastName, SortDescending: true})
+		require.NoError(t, err)
+		requireIDs(t, reversed[:10], page.Items)
+	})
+}
+
+func testFindManyStartsAfterTheLastUserOfThePreviousPage(t *testing.T, newStore Factory) {
+	// users created at the same time are ordered by id
+	users := []userstore.User{
+		fakeUser(createdHoursAfter(0)),
+		fakeUser(createdHoursAfter(0)),
+		fakeUser(createdHoursAfter(1)),
+		fakeUser(createdHoursAfter(2)),
+		fakeUser(createdHoursAfter(2)),
+	}
+	withStore(t, newStore, func(ctx context.Context, store Store) {
+		createMany(ctx, t, store, users...)
+		for _, descending := range []bool{false, true} {
+			all, err := store.FindMany(ctx, &userstore.Query{Length: 10, Page: 1, SortDescending: descending})
+			require.NoError(t, err)
+			require.Len(t, all.Items, len(users))
+
+			query := userstore.Query{Length: 2, Page: 1, SortDescending: descending}
+			var found []userstore.User
+			for {
+				page, err := store.FindMany(ctx, &query)
+				require.NoError(t, err)
+				require.Equal(t, int64(len(users)), page.Total)
+				if len(page.Items) == 0 {
+					break
+				}
+				found = append(found, page.Items...)
+				last := page.Items[len(page.Items)-1]
+				query.AfterID, query.AfterCreatedAt = last.ID, last.CreatedAt
+			}
+			requireIDs(t, all.Items, found)
+		}
+
+		_, err := store.FindMany(ctx, &userstore.Query{SortBy: userstore.SortLastName, AfterID: users[0].ID})
+		require.ErrorIs(t, err, userstore.ErrInvalidSort)
+	})
+}
+
+func testFindManyMatchesCreationTimes(t *testing.T, newStore Factory) {
+	users := make([]userstore.User, 5)
+	for i := range users {
+		users[i] = fakeUser(createdHoursAfter(-24 * i))
+	}
+	withStore(t, newStore, func(ctx context.Context, store Store) {
+		createMany(ctx, t, store, users...)
+		query := userstore.Query{
+			Length:        10,
+			Page:          1,
+			CreatedAfter:  created.Add(-78 * time.Hour),
+			CreatedBefore: created.Add(-time.Hour),
+			SortBy:        userstore.SortCreatedAt,
+		}
+		page, err := store.FindMany(ctx, &query)
+		require.NoError(t, err)
+		require.Equal(t, int64(3), page.Total)
+		requireIDs(t, []userstore.User{users[3], users[2], users[1]}, page.Items)
+
+		query.CreatedBefore = time.Time{}
+		page, err = store.FindMany(ctx, &query)
+		require.NoError(t, err)
+		requireIDs(t, []userstore.User{users[3], users[2], users[1], users[0]}, page.Items)
+	})
+}
+
+func testFindManyMatchesStatus(t *testing.T, newStore Factory) {
+	users := []userstore.User{
+		fakeUser(createdHoursAfter(0)),
+		fakeUser(createdHoursAfter(1), func(u *userstore.User) { u.Status = userstore.StatusSuspended }),
+		fakeUser(createdHoursAfter(2)),
+		fakeUser(createdHoursAfter(3), func(u *userstore.User) { u.Status = userstore.StatusSuspended }),
+	}
+	withStore(t, newStore, func(ctx context.Context, store Store) {
+		createMany(ctx, t, store, users...)
+		page, err := store.FindMany(ctx, &userstore.Query{Length: 10, Page: 1, Status: userstore.StatusSuspended})
+		require.NoError(t, err)
+		require.Equal(t, int64(2), page.Total)
+		requireIDs(t, []userstore.User{users[1], users[3]}, page.Items)
+
+		total, err := store.Count(ctx, &userstore.Query{Status: userstore.StatusDormant})
+		require.NoError(t, err)
+		require.Zero(t, total)
+	})
+}
+
+func testFindManyMatchesInactiveUsers(t *testing.T, newStore Factory) {
+	since := now().Add(-24 * time.Hour)
+	seenLongAgo := fakeUser(func(u *userstore.User) { u.CreatedAt = since.Add(-3 * time.Hour) })
+	neverSeen := fakeUser(func(u *userstore.User) { u.CreatedAt = since.Add(-2 * time.Hour) })
+	seenRecently := fakeUser(func(u *userstore.User) { u.CreatedAt = since.Add(-time.Hour) })
+	createdSince := fakeUser()
+	withStore(t, newStore, func(ctx context.Context, store Store) {
+		createMany(ctx, t, store, seenLongAgo, neverSeen, seenRecently, createdSince)
+		require.NoError(t, store.TouchLastSeen(ctx, seenLongAgo.ID, since.Add(-time.Hour)))
+		require.NoError(t, store.TouchLastSeen(ctx, seenRecently.ID, now()))
+
+		page, err := store.FindMany(ctx, &userstore.Query{Length: 10, Page: 1, InactiveSince: since})
+		require.NoError(t, err)
+		require.Equal(t, int64(2), page.Total)
+		requireIDs(t, []userstore.User{seenLongAgo, neverSeen}, page.Items)
+	})
+}
+
+func testFindManyMatchesNicknameEmailAndNamePrefix(t *testing.T, newStore Factory) {
+	users := []userstore.User{
+		fakeUser(func(u *userstore.User) { u.FirstName = "Anna"; u.LastName = "Smith" }),
+		fakeUser(func(u *userstore.User) { u.FirstName = "annabel"; u.LastName = "Jones" }),
+		fakeUser(func(u *userstore.User) { u.FirstName = "Bob"; u.LastName = "ANDERSON" }),
+	}
+	cases := []struct {
+		name     string
+		query    userstore.Query
+		expected []userstore.User
+	}{
+		{name: "Nickname", query: userstore.Query{Nickname: users[1].Nickname}, expected: users[1:2]},
+		{name: "Email", query: userstore.Query{Email: users[2].Email}, expected: users[2:3]},
+		{name: "First name prefix ignoring case", query: userstore.Query{NamePrefix: "ANN"}, expected: users[:2]},
+		{name: "Last name prefix ignoring case", query: userstore.Query{NamePrefix: "and"}, expected: users[2:3]},
+		{name: "Either name prefix", query: userstore.Query{NamePrefix: "an"}, expected: users},
+		{name: "Email and mismatched name prefix", query: userstore.Query{Email: users[0].Email, NamePrefix: "bob"}},
+		{name: "Unknown nickname", query: userstore.Query{Nickname: "nobody"}},
+	}
+	withStore(t, newStore, func(ctx context.Context, store Store) {
+		createMany(ctx, t, store, users...)
+		for _, c := range cases {
+			thisCase := c
+			t.Run(thisCase.name, func(t *testing.T) {
+				thisCase.query.Length = 10
+				thisCase.query.Page = 1
+				page, err := store.FindMany(ctx, &thisCase.query)
+				require.NoError(t, err)
+				require.Equal(t, int64(len(thisCase.expected)), page.Total)
+				require.ElementsMatch(t, idsOf(thisCase.expected), idsOf(page.Items))
+			})
+		}
+	})
+}
+
+func testFindManyWhichSkipsTheTotalSaysWhetherThereAreMoreUsers(t *testing.T, newStore Factory) {
+	users := []userstore.User{
+		fakeUser(createdHoursAfter(0)),
+		fakeUser(createdHoursAfter(1)),
+		fakeUser(createdHoursAfter(2)),
+	}
+	withStore(t, newStore, func(ctx context.Context, store Store) {
+		createMany(ctx, t, store, users...)
+		page, err := store.FindMany(ctx, &userstore.Query{Length: 2, Page: 1, SkipTotal: true})
+		require.NoError(t, err)
+		require.Equal(t, userstore.UnknownTotal, page.Total)
+		require.True(t, page.HasMore)
+		requireIDs(t, users[:2], page.Items)
+
+		page, err = store.FindMany(ctx, &userstore.Query{Length: 2, Page: 2, SkipTotal: true})
+		require.NoError(t, err)
+		require.Equal(t, userstore.UnknownTotal, page.Total)
+		require.False(t, page.HasMore)
+		requireIDs(t, users[2:], page.Items)
+	})
+}
+
+func testSearchMatchesNamePrefixesLiterallyWithCase(t *testing.T, newStore Factory) {
+	users := []userstore.User{
+		fakeUser(createdHoursAfter(0), func(u *userstore.User) { u.FirstName = "Maximilian"; u.LastName = "Schmidt" }),
+		fakeUser(createdHoursAfter(1), func(u *userstore.User) { u.FirstName = "Erika"; u.LastName = "Maxwell" }),
+		fakeUser(createdHoursAfter(2), func(u *userstore.User) { u.Nickname = "max"; u.FirstName = "Hans"; u.LastName = "Meier" }),
+		fakeUser(createdHoursAfter(3), func(u *userstore.User) { u.Email = "max@example.com"; u.FirstName = "Anna"; u.LastName = "Weber" }),
+		fakeUser(createdHoursAfter(4), func(u *userstore.User) { u.Nickname = "maxi"; u.FirstName = "Jana"; u.LastName = "Koch" }),
+		fakeUser(createdHoursAfter(5), func(u *userstore.User) { u.FirstName = "100%"; u.LastName = "Lehmann" }),
+		fakeUser(createdHoursAfter(6), func(u *userstore.User) { u.FirstName = "1000"; u.LastName = "Wolf" }),
+	}
+	cases := []struct {
+		search   string
+		expected []userstore.User
+	}{
+		{search: "Max", expected: users[:2]},
+		{search: "max", expected: users[2:3]},
+		{search: "max@example.com", expected: users[3:4]},
+		{search: "M.x"},
+		{search: "100%", expected: users[5:6]},
+		{search: "10_0"},
+	}
+	withStore(t, newStore, func(ctx context.Context, store Store) {
+		createMany(ctx, t, store, users...)
+		for _, c := range cases {
+			thisCase := c
+			t.Run(thisCase.search, func(t *testing.T) {
+				page, err := store.FindMany(ctx, &userstore.Query{Length: 10, Page: 1, Search: thisCase.search})
+				require.NoError(t, err)
+				requireIDs(t, thisCase.expected, page.Items)
+				total, err := store.Count(ctx, &userstore.Query{Search: thisCase.search})
+				require.NoError(t, err)
+				require.Equal(t, int64(len(thisCase.expected)), total)
+			})
+		}
+	})
+}
+
+func testIterateVisitsEveryMatchingUser(t *testing.T, newStore Factory) {
+	users := make([]userstore.User, 30)
+	for i := range users {
+		country := "DE"
+		if i%3 == 0 {
+			country = "NL"
+		}
+		users[i] = fakeUser(createdHoursAfter(i), func(u *userstore.User) { u.Country = country })
+	}
+	withStore(t, newStore, func(ctx context.Context, store Store) {
+		createMany(ctx, t, store, users...)
+		it, err := store.Iterate(ctx, &userstore.Query{Countries: []string{"NL"}})
+		require.NoError(t, err)
+		defer it.Close(ctx)
+
+		i := 0
+		for it.Next(ctx) {
+			compareUsers(t, users[i*3], it.User())
+			i++
+		}
+		require.NoError(t, it.Err())
+		require.Equal(t, 10, i)
+	})
+}
+
+func testStatsCountUsersByCountryAndSignupDay(t *testing.T, newStore Factory) {
+	users := []userstore.User{
+		fakeUser(createdHoursAfter(1), func(u *userstore.User) { u.Country = "NL" }),
+		fakeUser(createdHoursAfter(2), func(u *userstore.User) { u.Country = "DE" }),
+		fakeUser(createdHoursAfter(26), func(u *userstore.User) { u.Country = "NL" }),
+		fakeUser(createdHoursAfter(50), func(u *userstore.User) { u.Country = "FR" }),
+	}
+	withStore(t, newStore, func(ctx context.Context, store Store) {
+		createMany(ctx, t, store, users...)
+		stats, err := store.Stats(ctx, &userstore.Query{Countries: []string{"DE", "NL"}}, userstore.IntervalDay)
+		require.NoError(t, err)
+		require.Equal(t, int64(3), stats.Total)
+		require.Equal(t, []userstore.CountryCount{{Country: "DE", Total: 1}, {Country: "NL", Total: 2}}, stats.Countries)
+		require.Len(t, stats.Signups, 2)
+		require.True(t, created.Equal(stats.Signups[0].Start))
+		require.Equal(t, int64(2), stats.Signups[0].Total)
+		require.True(t, created.Add(24*time.Hour).Equal(stats.Signups[1].Start))
+		require.Equal(t, int64(1), stats.Signups[1].Total)
+	})
+}
+
+func testStatsCountSignupsByWeekStartingOnMonday(t *testing.T, newStore Factory) {
+	users := []userstore.User{
+		fakeUser(createdHoursAfter(-1)),
+		fakeUser(createdHoursAfter(1)),
+		fakeUser(createdHoursAfter(6 * 24)),
+	}
+	withStore(t, newStore, func(ctx context.Context, store Store) {
+		createMany(ctx, t, store, users...)
+		stats, err := store.Stats(ctx, &userstore.Query{}, userstore.IntervalWeek)
+		require.NoError(t, err)
+		require.Equal(t, int64(3), stats.Total)
+		require.Len(t, stats.Signups, 2)
+		require.True(t, created.Add(-7*24*time.Hour).Equal(stats.Signups[0].Start))
+		require.Equal(t, int64(1), stats.Signups[0].Total)
+		require.True(t, created.Equal(stats.Signups[1].Start))
+		require.Equal(t, int64(2), stats.Signups[1].Total)
+	})
+}
+
+func testStatsAreEmptyWhenNoUsersMatch(t *testing.T, newStore Factory) {
+	withStore(t, newStore, func(ctx context.Context, store Store) {
+		stats, err := store.Stats(ctx, &userstore.Query{Countries: []string{"NL"}}, userstore.IntervalMonth)
+		require.NoError(t, err)
+		require.Zero(t, stats.Total)
+		require.Empty(t, stats.Countries)
+		require.Empty(t, stats.Signups)
+	})
+}
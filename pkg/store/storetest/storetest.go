@@ -0,0 +1,182 @@
+// Package storetest is a suite of tests which every user store runs, so that the stores the service can be configured
+// with behave in the same way. The behavior of the MongoDB store, which the other stores were written to replace, is
+// the reference for the suite
+package storetest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bxcodec/faker/v3"
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/user"
+	"github.com/robotlovesyou/fitest/pkg/utctime"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	// timeout is the time allowed for each test
+	timeout = 10 * time.Second
+	// resolution is the resolution of the times stored by every store. MongoDB only stores milliseconds
+	resolution = time.Millisecond
+)
+
+// Store is a user store which the suite is run against
+type Store interface {
+	user.UserStore
+	PurgeDeletedBefore(context.Context, time.Time) (int64, error)
+}
+
+// Factory creates an empty store for a test, which is cleaned up when the test finishes. Stores created with a
+// retention soft delete users and keep them for the retention, and stores created without one delete users
+type Factory func(t *testing.T, retention time.Duration) Store
+
+// test is a test of the suite, which creates its stores with newStore
+type test func(t *testing.T, newStore Factory)
+
+// tests are the tests of the suite, by name
+var tests = []struct {
+	name string
+	run  test
+}{
+	{name: "CanCreateAndReadAUser", run: testCanCreateAndReadAUser},
+	{name: "CannotCreateClashingUsers", run: testCannotCreateClashingUsers},
+	{name: "CreateManyCreatesUsersWhichDoNotConflict", run: testCreateManyCreatesUsersWhichDoNotConflict},
+	{name: "CreateWithKeyReturnsTheUserCreatedWithTheSameKey", run: testCreateWithKeyReturnsTheUserCreatedWithTheSameKey},
+	{name: "CreateWithKeyRejectsADifferentUserWithTheSameKey", run: testCreateWithKeyRejectsADifferentUserWithTheSameKey},
+	{name: "CannotCreateClashingUserWithNewIdempotencyKey", run: testCannotCreateClashingUserWithNewIdempotencyKey},
+	{name: "EmailAndNicknameExist", run: testEmailAndNicknameExist},
+	{name: "ReadManyReturnsUsersInTheOrderRequested", run: testReadManyReturnsUsersInTheOrderRequested},
+	{name: "RecordsReadFromTheStoreCannotChangeIt", run: testRecordsReadFromTheStoreCannotChangeIt},
+	{name: "UsersOfOtherTenantsAreNotSeen", run: testUsersOfOtherTenantsAreNotSeen},
+	{name: "ChangePasswordIncrementsVersionAndRejectsStaleChanges", run: testChangePasswordIncrementsVersionAndRejectsStaleChanges},
+	{name: "UpdateFieldsOnlyChangesSetFields", run: testUpdateFieldsOnlyChangesSetFields},
+	{name: "ConcurrentChangesOfTheSameVersionAddOneEvent", run: testConcurrentChangesOfTheSameVersionAddOneEvent},
+	{name: "AnonymizeReleasesEmailAndNickname", run: testAnonymizeReleasesEmailAndNickname},
+	{name: "ChangeStatusAddsEventForTheStatus", run: testChangeStatusAddsEventForTheStatus},
+	{name: "RecordLoginDoesNotMoveActivityBackwards", run: testRecordLoginDoesNotMoveActivityBackwards},
+	{name: "TwoFactorCodesCannotBeReused", run: testTwoFactorCodesCannotBeReused},
+	{name: "TwoFactorEnrollmentCanBeReplaced", run: testTwoFactorEnrollmentCanBeReplaced},
+	{name: "DisableTwoFactorRemovesSecrets", run: testDisableTwoFactorRemovesSecrets},
+	{name: "PasswordResetTokenCanOnlyBeUsedOnce", run: testPasswordResetTokenCanOnlyBeUsedOnce},
+	{name: "EmailChangeIsConfirmedWithToken", run: testEmailChangeIsConfirmedWithToken},
+	{name: "ConfirmingEmailChangeToAddressInUseFails", run: testConfirmingEmailChangeToAddressInUseFails},
+	{name: "ChangeNicknameKeepsHistoryAndEnforcesCooldown", run: testChangeNicknameKeepsHistoryAndEnforcesCooldown},
+	{name: "ReplayAddsEventWithCurrentStateOfUser", run: testReplayAddsEventWithCurrentStateOfUser},
+	{name: "MarkDormantOnlyChangesInactiveUsers", run: testMarkDormantOnlyChangesInactiveUsers},
+	{name: "DeletedUsersCannotBeDeletedAgain", run: testDeletedUsersCannotBeDeletedAgain},
+	{name: "DeleteManyReturnsDeletedIDs", run: testDeleteManyReturnsDeletedIDs},
+	{name: "DeletionEventsCarryTheEmailAddressOfTheUser", run: testDeletionEventsCarryTheEmailAddressOfTheUser},
+	{name: "SoftDeletedUsersAreNotRead", run: testSoftDeletedUsersAreNotRead},
+	{name: "SoftDeletedUsersCanBeRestoredAndPurged", run: testSoftDeletedUsersCanBeRestoredAndPurged},
+	{name: "SoftDeletedUsersCannotBeRestoredAfterRetention", run: testSoftDeletedUsersCannotBeRestoredAfterRetention},
+	{name: "HardDeletedUsersCannotBeRestored", run: testHardDeletedUsersCannotBeRestored},
+	{name: "PurgeDeletedBeforeOnlyPurgesUsersDeletedBeforeTheCutoff", run: testPurgeDeletedBeforeOnlyPurgesUsersDeletedBeforeTheCutoff},
+	{name: "ActionsCauseEventsInOrder", run: testActionsCauseEventsInOrder},
+	{name: "EventsCarryTokens", run: testEventsCarryTokens},
+	{name: "TimedOutPendingEventsAreSentAgain", run: testTimedOutPendingEventsAreSentAgain},
+	{name: "BacklogMeasuresEventsWhichHaveNotBeenProcessed", run: testBacklogMeasuresEventsWhichHaveNotBeenProcessed},
+	{name: "EventAttemptsAreCounted", run: testEventAttemptsAreCounted},
+	{name: "DeadLetteredEventsAreNotProcessedUntilRequeued", run: testDeadLetteredEventsAreNotProcessedUntilRequeued},
+	{name: "EventsOfManyUsersAreClaimedInBatches", run: testEventsOfManyUsersAreClaimedInBatches},
+	{name: "FindManyReturnsPagesOfMatchingUsers", run: testFindManyReturnsPagesOfMatchingUsers},
+	{name: "FindManySortsByLastName", run: testFindManySortsByLastName},
+	{name: "FindManyStartsAfterTheLastUserOfThePreviousPage", run: testFindManyStartsAfterTheLastUserOfThePreviousPage},
+	{name: "FindManyMatchesCreationTimes", run: testFindManyMatchesCreationTimes},
+	{name: "FindManyMatchesStatus", run: testFindManyMatchesStatus},
+	{name: "FindManyMatchesInactiveUsers", run: testFindManyMatchesInactiveUsers},
+	{name: "FindManyMatchesNicknameEmailAndNamePrefix", run: testFindManyMatchesNicknameEmailAndNamePrefix},
+	{name: "FindManyWhichSkipsTheTotalSaysWhetherThereAreMoreUsers", run: testFindManyWhichSkipsTheTotalSaysWhetherThereAreMoreUsers},
+	{name: "SearchMatchesNamePrefixesLiterallyWithCase", run: testSearchMatchesNamePrefixesLiterallyWithCase},
+	{name: "IterateVisitsEveryMatchingUser", run: testIterateVisitsEveryMatchingUser},
+	{name: "StatsCountUsersByCountryAndSignupDay", run: testStatsCountUsersByCountryAndSignupDay},
+	{name: "StatsCountSignupsByWeekStartingOnMonday", run: testStatsCountSignupsByWeekStartingOnMonday},
+	{name: "StatsAreEmptyWhenNoUsersMatch", run: testStatsAreEmptyWhenNoUsersMatch},
+}
+
+// Run runs the suite against the stores created by newStore
+func Run(t *testing.T, newStore Factory) {
+	for _, tt := range tests {
+		thisTest := tt
+		t.Run(thisTest.name, func(t *testing.T) {
+			thisTest.run(t, newStore)
+		})
+	}
+}
+
+// withStore calls f with a store created by newStore which deletes users
+func withStore(t *testing.T, newStore Factory, f func(context.Context, Store)) {
+	withSoftDeletingStore(t, newStore, 0, f)
+}
+
+// withSoftDeletingStore calls f with a store created by newStore which soft deletes users and keeps them for retention
+func withSoftDeletingStore(t *testing.T, newStore Factory, retention time.Duration, f func(context.Context, Store)) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	f(ctx, newStore(t, retention))
+}
+
+// now returns the current time, at the resolution of the stores
+func now() time.Time {
+	return utctime.Now().Truncate(resolution)
+}
+
+// fakeUser returns a user with fake details, changed by each of muts
+func fakeUser(muts ...func(u *userstore.User)) userstore.User {
+	u := userstore.User{
+		ID:           uuid.Must(uuid.NewRandom()),
+		FirstName:    faker.FirstName(),
+		LastName:     faker.LastName(),
+		Nickname:     faker.Username(),
+		PasswordHash: "supersecrethash",
+		Email:        faker.Email(),
+		Country:      "DE",
+		CreatedAt:    now(),
+		UpdatedAt:    now(),
+		Version:      user.DefaultVersion,
+	}
+	for _, m := range muts {
+		m(&u)
+	}
+	return u
+}
+
+// createMany creates each of users in store
+func createMany(ctx context.Context, t *testing.T, store Store, users ...userstore.User) {
+	for i := range users {
+		_, err := store.Create(ctx, &users[i])
+		require.NoError(t, err, fmt.Sprintf("cannot create user %d", i))
+	}
+}
+
+// compareUsers fails t unless a and b have the same details
+func compareUsers(t *testing.T, a, b userstore.User) {
+	require.Equal(t, a.ID, b.ID)
+	require.Equal(t, a.FirstName, b.FirstName)
+	require.Equal(t, a.LastName, b.LastName)
+	require.Equal(t, a.Nickname, b.Nickname)
+	require.Equal(t, a.PasswordHash, b.PasswordHash)
+	require.Equal(t, a.Email, b.Email)
+	require.Equal(t, a.Country, b.Country)
+	require.Equal(t, a.AvatarURL, b.AvatarURL)
+	require.Equal(t, a.Status, b.Status)
+	require.True(t, a.CreatedAt.Equal(b.CreatedAt), "created at %s, not %s", b.CreatedAt, a.CreatedAt)
+	require.True(t, a.UpdatedAt.Equal(b.UpdatedAt), "updated at %s, not %s", b.UpdatedAt, a.UpdatedAt)
+}
+
+// idsOf returns the ids of users
+func idsOf(users []userstore.User) []uuid.UUID {
+	ids := make([]uuid.UUID, 0, len(users))
+	for _, usr := range users {
+		ids = append(ids, usr.ID)
+	}
+	return ids
+}
+
+// lastEvent returns the last event stored for the user of rec
+func lastEvent(rec *userstore.Record) userstore.Event {
+	return rec.Events[len(rec.Events)-1]
+}
@@ -0,0 +1,443 @@
+package storetest
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/tenant"
+	"github.com/stretchr/testify/require"
+)
+
+func testChangePasswordIncrementsVersionAndRejectsStaleChanges(t *testing.T, newStore Factory) {
+	withStore(t, newStore, func(ctx context.Context, store Store) {
+		rec := fakeUser()
+		createMany(ctx, t, store, rec)
+
+		update := rec
+		update.PasswordHash = "newsupersecrethash"
+		updated, err := store.ChangePassword(ctx, &update)
+		require.NoError(t, err)
+		require.Equal(t, rec.Version+1, updated.Version)
+		require.Equal(t, "newsupersecrethash", updated.PasswordHash)
+
+		_, err = store.ChangePassword(ctx, &update)
+		require.ErrorIs(t, err, userstore.ErrInvalidVersion)
+		missing := fakeUser()
+		_, err = store.ChangePassword(ctx, &missing)
+		require.ErrorIs(t, err, userstore.ErrNotFound)
+	})
+}
+
+func testUpdateFieldsOnlyChangesSetFields(t *testing.T, newStore Factory) {
+	withStore(t, newStore, func(ctx context.Context, store Store) {
+		rec := fakeUser()
+		createMany(ctx, t, store, rec)
+
+		firstName, country, avatarURL := "$New", "NL", "https://images.example.com/avatars/1.png"
+		change := userstore.Change{FirstName: &firstName, Country: &country, AvatarURL: &avatarURL, UpdatedAt: now()}
+		updated, err := store.UpdateFields(ctx, rec.ID, rec.Version, &change)
+		require.NoError(t, err)
+
+		expected := rec
+		expected.FirstName = firstName
+		expected.Country = country
+		expected.AvatarURL = avatarURL
+		expected.UpdatedAt = change.UpdatedAt
+		compareUsers(t, expected, updated)
+		require.Equal(t, rec.Version+1, updated.Version)
+		read, err := store.ReadOne(ctx, rec.ID)
+		require.NoError(t, err)
+		compareUsers(t, expected, read)
+
+		stored, err := store.ReadRecord(ctx, rec.ID)
+		require.NoError(t, err)
+		evt := lastEvent(&stored)
+		require.Equal(t, userstore.Updated, evt.Action)
+		require.Equal(t, rec.ID, evt.ID)
+		require.Equal(t, updated.Version, evt.Version)
+		compareUsers(t, expected, *evt.Data)
+
+		_, err = store.UpdateFields(ctx, rec.ID, rec.Version, &userstore.Change{Country: &country, UpdatedAt: now()})
+		require.ErrorIs(t, err, userstore.ErrInvalidVersion)
+		_, err = store.UpdateFields(ctx, uuid.Must(uuid.NewRandom()), rec.Version, &userstore.Change{Country: &country, UpdatedAt: now()})
+		require.ErrorIs(t, err, userstore.ErrNotFound)
+	})
+}
+
+func testConcurrentChangesOfTheSameVersionAddOneEvent(t *testing.T, newStore Factory) {
+	withStore(t, newStore, func(ctx context.Context, store Store) {
+		rec := fakeUser()
+		createMany(ctx, t, store, rec)
+
+		const changes = 5
+		errs := make([]error, changes)
+		var wg sync.WaitGroup
+		for i := 0; i < changes; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				firstName := "New"
+				_, errs[i] = store.UpdateFields(ctx, rec.ID, rec.Version, &userstore.Change{FirstName: &firstName, UpdatedAt: now()})
+			}(i)
+		}
+		wg.Wait()
+
+		succeeded := 0
+		for _, err := range errs {
+			if err == nil {
+				succeeded += 1
+				continue
+			}
+			require.ErrorIs(t, err, userstore.ErrInvalidVersion)
+		}
+		require.Equal(t, 1, succeeded)
+		stored, err := store.ReadRecord(ctx, rec.ID)
+		require.NoError(t, err)
+		require.Len(t, stored.Events, 2)
+	})
+}
+
+func testAnonymizeReleasesEmailAndNickname(t *testing.T, newStore Factory) {
+	withStore(t, newStore, func(ctx context.Context, store Store) {
+		rec := fakeUser(func(u *userstore.User) { u.AvatarURL = "https://images.example.com/avatars/1.png" })
+		createMany(ctx, t, store, rec)
+		renamed, err := store.ChangeNickname(ctx, rec.ID, rec.Version, "renamed", time.Hour)
+		require.NoError(t, err)
+		require.NoError(t, store.BeginTwoFactor(ctx, rec.ID, "sealed"))
+		enabled, err := store.EnableTwoFactor(ctx, rec.ID, "sealed", 10, []string{"code1"})
+		require.NoError(t, err)
+
+		anonymized := renamed
+		anonymized.Version = enabled.Version
+		anonymized.FirstName = "Anonymized"
+		anonymized.LastName = "Anonymized"
+		anonymized.Nickname = "anonymized-" + rec.ID.String()
+		anonymized.Email = rec.ID.String() + "@anonymized.invalid"
+		anonymized.PasswordHash = ""
+		anonymized.AvatarURL = ""
+		updated, err := store.Anonymize(ctx, &anonymized)
+		require.NoError(t, err)
+		compareUsers(t, anonymized, updated)
+		require.Equal(t, enabled.Version+1, updated.Version)
+		require.False(t, updated.TwoFactorEnabled)
+
+		stored, err := store.ReadRecord(ctx, rec.ID)
+		require.NoError(t, err)
+		require.Empty(t, stored.PreviousNicknames)
+		require.Nil(t, stored.TwoFactor)
+		require.Equal(t, userstore.Anonymized, lastEvent(&stored).Action)
+
+		// the original email address and nickname can be used again
+		other := fakeUser(func(u *userstore.User) { u.Email = rec.Email; u.Nickname = rec.Nickname })
+		createMany(ctx, t, store, other)
+	})
+}
+
+func testChangeStatusAddsEventForTheStatus(t *testing.T, newStore Factory) {
+	withStore(t, newStore, func(ctx context.Context, store Store) {
+		rec := fakeUser()
+		createMany(ctx, t, store, rec)
+
+		suspended := rec
+		suspended.Status = userstore.StatusSuspended
+		updated, err := store.ChangeStatus(ctx, &suspended)
+		require.NoError(t, err)
+		require.Equal(t, userstore.StatusSuspended, updated.Status)
+		require.Equal(t, rec.Version+1, updated.Version)
+
+		stored, err := store.ReadRecord(ctx, rec.ID)
+		require.NoError(t, err)
+		require.Equal(t, userstore.Suspended, lastEvent(&stored).Action)
+
+		unknown := updated
+		unknown.Status = "unknown"
+		_, err = store.ChangeStatus(ctx, &unknown)
+		require.ErrorIs(t, err, userstore.ErrInvalidStatus)
+	})
+}
+
+func testRecordLoginDoesNotMoveActivityBackwards(t *testing.T, newStore Factory) {
+	withStore(t, newStore, func(ctx context.Context, store Store) {
+		rec := fakeUser()
+		createMany(ctx, t, store, rec)
+
+		at := now()
+		require.NoError(t, store.RecordLogin(ctx, rec.ID, at))
+		require.NoError(t, store.TouchLastSeen(ctx, rec.ID, at.Add(-time.Hour)))
+		stored, err := store.ReadRecord(ctx, rec.ID)
+		require.NoError(t, err)
+		require.True(t, at.Equal(stored.Data.LastLoginAt))
+		require.True(t, at.Equal(stored.Data.LastSeenAt))
+		require.Equal(t, rec.Version, stored.Data.Version)
+		require.Len(t, stored.Events, 1, "only the Created event is stored")
+
+		missing := uuid.Must(uuid.NewRandom())
+		require.ErrorIs(t, store.TouchLastSeen(ctx, missing, at), userstore.ErrNotFound)
+		require.ErrorIs(t, store.RecordLogin(ctx, missing, at), userstore.ErrNotFound)
+	})
+}
+
+// withTwoFactorEnabled calls f with a user with two factor authentication enabled, with the secret "sealed", the last
+// step 10 and the recovery code hashes "code1" and "code2"
+func withTwoFactorEnabled(t *testing.T, newStore Factory, f func(context.Context, Store, userstore.User)) {
+	withStore(t, newStore, func(ctx context.Context, store Store) {
+		rec := fakeUser()
+		createMany(ctx, t, store, rec)
+		require.NoError(t, store.BeginTwoFactor(ctx, rec.ID, "sealed"))
+		usr, err := store.EnableTwoFactor(ctx, rec.ID, "sealed", 10, []string{"code1", "code2"})
+		require.NoError(t, err)
+		f(ctx, store, usr)
+	})
+}
+
+func testTwoFactorCodesCannotBeReused(t *testing.T, newStore Factory) {
+	withTwoFactorEnabled(t, newStore, func(ctx context.Context, store Store, usr userstore.User) {
+		require.True(t, usr.TwoFactorEnabled)
+		stored, err := store.ReadRecord(ctx, usr.ID)
+		require.NoError(t, err)
+		require.Equal(t, userstore.TwoFactor{Secret: "sealed", LastStep: 10, RecoveryCodes: []string{"code1", "code2"}}, *stored.TwoFactor)
+		require.Equal(t, userstore.TwoFactorEnabled, lastEvent(&stored).Action)
+
+		require.ErrorIs(t, store.UseTwoFactorStep(ctx, usr.ID, 10), userstore.ErrTwoFactorCodeRejected)
+		require.NoError(t, store.UseTwoFactorStep(ctx, usr.ID, 11))
+		require.ErrorIs(t, store.UseTwoFactorStep(ctx, usr.ID, 11), userstore.ErrTwoFactorCodeRejected)
+		require.NoError(t, store.UseRecoveryCode(ctx, usr.ID, "code1"))
+		require.ErrorIs(t, store.UseRecoveryCode(ctx, usr.ID, "code1"), userstore.ErrTwoFactorCodeRejected)
+		require.ErrorIs(t, store.UseRecoveryCode(ctx, usr.ID, "unknown"), userstore.ErrTwoFactorCodeRejected)
+
+		stored, err = store.ReadRecord(ctx, usr.ID)
+		require.NoError(t, err)
+		require.Equal(t, int64(11), stored.TwoFactor.LastStep)
+		require.Equal(t, []string{"code2"}, stored.TwoFactor.RecoveryCodes)
+		require.Equal(t, usr.Version, stored.Data.Version, "using codes does not change the user")
+
+		require.ErrorIs(t, store.BeginTwoFactor(ctx, usr.ID, "other"), userstore.ErrTwoFactorEnabled)
+		require.ErrorIs(t, store.BeginTwoFactor(ctx, uuid.Must(uuid.NewRandom()), "other"), userstore.ErrNotFound)
+	})
+}
+
+func testTwoFactorEnrollmentCanBeReplaced(t *testing.T, newStore Factory) {
+	withStore(t, newStore, func(ctx context.Context, store Store) {
+		rec := fakeUser()
+		createMany(ctx, t, store, rec)
+		require.NoError(t, store.BeginTwoFactor(ctx, rec.ID, "first"))
+		require.NoError(t, store.BeginTwoFactor(ctx, rec.ID, "second"))
+
+		_, err := store.EnableTwoFactor(ctx, rec.ID, "first", 10, nil)
+		require.ErrorIs(t, err, userstore.ErrTwoFactorNotPending)
+		enabled, err := store.EnableTwoFactor(ctx, rec.ID, "second", 10, nil)
+		require.NoError(t, err)
+		require.True(t, enabled.TwoFactorEnabled)
+		require.Equal(t, rec.Version+1, enabled.Version)
+	})
+}
+
+func testDisableTwoFactorRemovesSecrets(t *testing.T, newStore Factory) {
+	withTwoFactorEnabled(t, newStore, func(ctx context.Context, store Store, usr userstore.User) {
+		disabled, err := store.DisableTwoFactor(ctx, usr.ID)
+		require.NoError(t, err)
+		require.False(t, disabled.TwoFactorEnabled)
+		require.Equal(t, usr.Version+1, disabled.Version)
+
+		stored, err := store.ReadRecord(ctx, usr.ID)
+		require.NoError(t, err)
+		require.Nil(t, stored.TwoFactor)
+		require.Equal(t, userstore.TwoFactorDisabled, lastEvent(&stored).Action)
+
+		_, err = store.DisableTwoFactor(ctx, usr.ID)
+		require.ErrorIs(t, err, userstore.ErrTwoFactorNotEnabled)
+		require.ErrorIs(t, store.UseRecoveryCode(ctx, usr.ID, "code2"), userstore.ErrTwoFactorCodeRejected)
+	})
+}
+
+func testPasswordResetTokenCanOnlyBeUsedOnce(t *testing.T, newStore Factory) {
+	withStore(t, newStore, func(ctx context.Context, store Store) {
+		rec := fakeUser()
+		expired := fakeUser()
+		changed := fakeUser()
+		createMany(ctx, t, store, rec, expired, changed)
+
+		reset := userstore.ResetToken{Hash: "token hash", ExpiresAt: now().Add(time.Hour)}
+		require.NoError(t, store.RequestPasswordReset(ctx, rec.ID, "token", reset))
+		updated, err := store.ResetPassword(ctx, "token hash", "newsupersecrethash")
+		require.NoError(t, err)
+		require.Equal(t, "newsupersecrethash", updated.PasswordHash)
+		require.Equal(t, rec.Version+1, updated.Version)
+		_, err = store.ResetPassword(ctx, "token hash", "newsupersecrethash")
+		require.ErrorIs(t, err, userstore.ErrInvalidResetToken)
+
+		reset = userstore.ResetToken{Hash: "expired hash", ExpiresAt: now().Add(-time.Second)}
+		require.NoError(t, store.RequestPasswordReset(ctx, expired.ID, "token", reset))
+		_, err = store.ResetPassword(ctx, "expired hash", "newsupersecrethash")
+		require.ErrorIs(t, err, userstore.ErrInvalidResetToken)
+
+		// changing the password removes the token
+		reset = userstore.ResetToken{Hash: "changed hash", ExpiresAt: now().Add(time.Hour)}
+		require.NoError(t, store.RequestPasswordReset(ctx, changed.ID, "token", reset))
+		changed.PasswordHash = "changedhash"
+		_, err = store.ChangePassword(ctx, &changed)
+		require.NoError(t, err)
+		_, err = store.ResetPassword(ctx, "changed hash", "newsupersecrethash")
+		require.ErrorIs(t, err, userstore.ErrInvalidResetToken)
+
+		err = store.RequestPasswordReset(ctx, uuid.Must(uuid.NewRandom()), "token", reset)
+		require.ErrorIs(t, err, userstore.ErrNotFound)
+	})
+}
+
+func testEmailChangeIsConfirmedWithToken(t *testing.T, newStore Factory) {
+	withStore(t, newStore, func(ctx context.Context, store Store) {
+		rec := fakeUser()
+		expired := fakeUser()
+		createMany(ctx, t, store, rec, expired)
+
+		change := userstore.EmailChange{Email: "new@example.com", Hash: "token hash", ExpiresAt: now().Add(time.Hour)}
+		err := store.RequestEmailChange(ctx, rec.ID, rec.Version+1, "token", change)
+		require.ErrorIs(t, err, userstore.ErrInvalidVersion)
+		require.NoError(t, store.RequestEmailChange(ctx, rec.ID, rec.Version, "token", change))
+
+		// the address is not changed until the change is confirmed
+		read, err := store.ReadOne(ctx, rec.ID)
+		require.NoError(t, err)
+		require.Equal(t, rec.Email, read.Email)
+
+		updated, err := store.ConfirmEmailChange(ctx, "token hash")
+		require.NoError(t, err)
+		require.Equal(t, "new@example.com", updated.Email)
+		require.Equal(t, rec.Version+1, updated.Version)
+		_, err = store.ConfirmEmailChange(ctx, "token hash")
+		require.ErrorIs(t, err, userstore.ErrInvalidEmailChangeToken)
+
+		change = userstore.EmailChange{Email: "expired@example.com", Hash: "expired hash", ExpiresAt: now().Add(-time.Second)}
+		require.NoError(t, store.RequestEmailChange(ctx, expired.ID, expired.Version, "token", change))
+		_, err = store.ConfirmEmailChange(ctx, "expired hash")
+		require.ErrorIs(t, err, userstore.ErrInvalidEmailChangeToken)
+	})
+}
+
+func testConfirmingEmailChangeToAddressInUseFails(t *testing.T, newStore Factory) {
+	withStore(t, newStore, func(ctx context.Context, store Store) {
+		rec := fakeUser()
+		other := fakeUser()
+		createMany(ctx, t, store, rec)
+
+		change := userstore.EmailChange{Email: other.Email, Hash: "token hash", ExpiresAt: now().Add(time.Hour)}
+		require.NoError(t, store.RequestEmailChange(ctx, rec.ID, rec.Version, "token", change))
+		// another user takes the address before the change is confirmed
+		createMany(ctx, t, store, other)
+
+		_, err := store.ConfirmEmailChange(ctx, "token hash")
+		require.ErrorIs(t, err, userstore.ErrEmailInUse)
+	})
+}
+
+func testChangeNicknameKeepsHistoryAndEnforcesCooldown(t *testing.T, newStore Factory) {
+	withStore(t, newStore, func(ctx context.Context, store Store) {
+		rec := fakeUser()
+		other := fakeUser()
+		createMany(ctx, t, store, rec, other)
+
+		_, err := store.ChangeNickname(ctx, uuid.Must(uuid.NewRandom()), rec.Version, "renamed", time.Hour)
+		require.ErrorIs(t, err, userstore.ErrNotFound)
+		_, err = store.ChangeNickname(ctx, rec.ID, rec.Version+1, "renamed", time.Hour)
+		require.ErrorIs(t, err, userstore.ErrInvalidVersion)
+		_, err = store.ChangeNickname(ctx, rec.ID, rec.Version, other.Nickname, time.Hour)
+		require.ErrorIs(t, err, userstore.ErrNicknameInUse)
+
+		updated, err := store.ChangeNickname(ctx, rec.ID, rec.Version, "renamed", time.Hour)
+		require.NoError(t, err)
+		require.Equal(t, "renamed", updated.Nickname)
+		require.Equal(t, rec.Version+1, updated.Version)
+		_, err = store.ChangeNickname(ctx, rec.ID, updated.Version, "renamed-again", time.Hour)
+		require.ErrorIs(t, err, userstore.ErrNicknameChangeTooSoon)
+		_, err = store.ChangeNickname(ctx, rec.ID, updated.Version, "renamed-again", 0)
+		require.NoError(t, err)
+
+		stored, err := store.ReadRecord(ctx, rec.ID)
+		require.NoError(t, err)
+		require.Equal(t, "renamed-again", stored.Data.Nickname)
+		require.Len(t, stored.PreviousNicknames, 2)
+		require.Equal(t, rec.Nickname, stored.PreviousNicknames[0].Nickname)
+		require.Equal(t, "renamed", stored.PreviousNicknames[1].Nickname)
+		require.Equal(t, userstore.NicknameChanged, lastEvent(&stored).Action)
+
+		// the original nickname can be used again
+		reused := fakeUser(func(u *userstore.User) { u.Nickname = rec.Nickname })
+		createMany(ctx, t, store, reused)
+	})
+}
+
+func testReplayAddsEventWithCurrentStateOfUser(t *testing.T, newStore Factory) {
+	withSoftDeletingStore(t, newStore, time.Hour, func(ctx context.Context, store Store) {
+		rec := fakeUser()
+		deleted := fakeUser()
+		createMany(ctx, t, store, rec, deleted)
+		require.NoError(t, store.DeleteOne(ctx, deleted.ID))
+
+		replayed, err := store.Replay(ctx, rec.ID)
+		require.NoError(t, err)
+		require.Equal(t, rec.Version, replayed.Version)
+
+		stored, err := store.ReadRecord(ctx, rec.ID)
+		require.NoError(t, err)
+		require.Equal(t, rec.Version, stored.Data.Version)
+		require.Len(t, stored.Events, 2)
+		require.Equal(t, userstore.Replayed, stored.Events[1].Action)
+		require.Equal(t, rec.Version, stored.Events[1].Version)
+		require.Equal(t, rec.Email, stored.Events[1].Data.Email)
+
+		_, err = store.Replay(ctx, uuid.Must(uuid.NewRandom()))
+		require.ErrorIs(t, err, userstore.ErrNotFound)
+		_, err = store.Replay(ctx, deleted.ID)
+		require.ErrorIs(t, err, userstore.ErrNotFound)
+	})
+}
+
+func testMarkDormantOnlyChangesInactiveUsers(t *testing.T, newStore Factory) {
+	since := now().Add(-24 * time.Hour)
+	seenLongAgo := fakeUser(func(u *userstore.User) { u.CreatedAt = since.Add(-2 * time.Hour) })
+	neverSeen := fakeUser(func(u *userstore.User) { u.CreatedAt = since.Add(-time.Hour) })
+	otherTenant := fakeUser(func(u *userstore.User) { u.CreatedAt = since.Add(-time.Hour) })
+	seenRecently := fakeUser(func(u *userstore.User) { u.CreatedAt = since.Add(-time.Hour) })
+	suspended := fakeUser(func(u *userstore.User) {
+		u.CreatedAt = since.Add(-time.Hour)
+		u.Status = userstore.StatusSuspended
+	})
+	deleted := fakeUser(func(u *userstore.User) { u.CreatedAt = since.Add(-time.Hour) })
+	createdSince := fakeUser()
+	withSoftDeletingStore(t, newStore, time.Hour, func(ctx context.Context, store Store) {
+		other := tenant.With(ctx, "other")
+		createMany(ctx, t, store, seenLongAgo, neverSeen, seenRecently, suspended, deleted, createdSince)
+		createMany(other, t, store, otherTenant)
+		require.NoError(t, store.TouchLastSeen(ctx, seenLongAgo.ID, since.Add(-time.Hour)))
+		require.NoError(t, store.TouchLastSeen(ctx, seenRecently.ID, now()))
+		require.NoError(t, store.DeleteOne(ctx, deleted.ID))
+
+		marked, err := store.MarkDormant(ctx, since)
+		require.NoError(t, err)
+		require.Equal(t, int64(3), marked, "users of every tenant are made dormant")
+
+		for _, dormant := range []struct {
+			ctx context.Context
+			usr userstore.User
+		}{{ctx, seenLongAgo}, {ctx, neverSeen}, {other, otherTenant}} {
+			stored, err := store.ReadRecord(dormant.ctx, dormant.usr.ID)
+			require.NoError(t, err)
+			require.Equal(t, userstore.StatusDormant, stored.Data.Status)
+			require.Equal(t, dormant.usr.Version+1, stored.Data.Version)
+			require.Len(t, stored.Events, 2)
+			require.Equal(t, userstore.MarkedDormant, stored.Events[1].Action)
+			require.Equal(t, stored.Data.Version, stored.Events[1].Version)
+		}
+		for _, unchanged := range []userstore.User{seenRecently, suspended, createdSince} {
+			read, err := store.ReadOne(ctx, unchanged.ID)
+			require.NoError(t, err)
+			require.Equal(t, unchanged.Status, read.Status)
+			require.Equal(t, unchanged.Version, read.Version)
+		}
+	})
+}
@@ -0,0 +1,105 @@
+package usercache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/robotlovesyou/fitest/pkg/utctime"
+)
+
+// LRU is a Cache held in memory, which removes the least recently used value when it is full. It is not shared by
+// instances of the service
+type LRU struct {
+	mtx     sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// NewLRU creates an LRU which holds at most size values
+func NewLRU(size int) *LRU {
+	return &LRU{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// Get implements Cache
+func (cache *LRU) Get(_ context.Context, key string) ([]byte, bool, error) {
+	cache.mtx.Lock()
+	defer cache.mtx.Unlock()
+	value, ok := cache.get(key)
+	return value, ok, nil
+}
+
+// GetMany implements Cache
+func (cache *LRU) GetMany(_ context.Context, keys ...string) ([][]byte, error) {
+	cache.mtx.Lock()
+	defer cache.mtx.Unlock()
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		values[i], _ = cache.get(key)
+	}
+	return values, nil
+}
+
+// get returns the value cached for key, and false if there is none or it has expired. It must be called with the
+// mutex held
+func (cache *LRU) get(key string) ([]byte, bool) {
+	elem, ok := cache.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*lruEntry)
+	if utctime.Now().After(entry.expires) {
+		cache.remove(elem)
+		return nil, false
+	}
+	cache.order.MoveToFront(elem)
+	return entry.value, true
+}
+
+// Set implements Cache
+func (cache *LRU) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	cache.mtx.Lock()
+	defer cache.mtx.Unlock()
+	expires := utctime.Now().Add(ttl)
+	if elem, ok := cache.entries[key]; ok {
+		entry := elem.Value.(*lruEntry)
+		entry.value, entry.expires = value, expires
+		cache.order.MoveToFront(elem)
+		return nil
+	}
+	for cache.order.Len() >= cache.size && cache.order.Len() > 0 {
+		cache.remove(cache.order.Back())
+	}
+	cache.entries[key] = cache.order.PushFront(&lruEntry{key: key, value: value, expires: expires})
+	return nil
+}
+
+// Delete implements Cache
+func (cache *LRU) Delete(_ context.Context, keys ...string) error {
+	cache.mtx.Lock()
+	defer cache.mtx.Unlock()
+	for _, key := range keys {
+		if elem, ok := cache.entries[key]; ok {
+			cache.remove(elem)
+		}
+	}
+	return nil
+}
+
+// remove removes elem from the cache. It must be called with the mutex held
+func (cache *LRU) remove(elem *list.Element) {
+	cache.order.Remove(elem)
+	delete(cache.entries, elem.Value.(*lruEntry).key)
+}
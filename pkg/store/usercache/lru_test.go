@@ -0,0 +1,55 @@
+package usercache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/robotlovesyou/fitest/pkg/store/usercache"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLRURemovesLeastRecentlyUsedValueWhenFull(t *testing.T) {
+	ctx := context.Background()
+	cache := usercache.NewLRU(2)
+	require.NoError(t, cache.Set(ctx, "a", []byte("a"), time.Minute))
+	require.NoError(t, cache.Set(ctx, "b", []byte("b"), time.Minute))
+	_, ok, _ := cache.Get(ctx, "a")
+	require.True(t, ok)
+
+	require.NoError(t, cache.Set(ctx, "c", []byte("c"), time.Minute))
+	_, ok, _ = cache.Get(ctx, "b")
+	require.False(t, ok)
+	for _, key := range []string{"a", "c"} {
+		value, ok, err := cache.Get(ctx, key)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, []byte(key), value)
+	}
+}
+
+func TestLRUDoesNotReturnExpiredOrDeletedValues(t *testing.T) {
+	ctx := context.Background()
+	cache := usercache.NewLRU(10)
+	require.NoError(t, cache.Set(ctx, "expired", []byte("value"), time.Millisecond))
+	require.NoError(t, cache.Set(ctx, "deleted", []byte("value"), time.Minute))
+	require.NoError(t, cache.Delete(ctx, "deleted", "missing"))
+	time.Sleep(5 * time.Millisecond)
+
+	for _, key := range []string{"expired", "deleted"} {
+		_, ok, err := cache.Get(ctx, key)
+		require.NoError(t, err)
+		require.False(t, ok, key)
+	}
+}
+
+func TestLRUGetsManyValues(t *testing.T) {
+	ctx := context.Background()
+	cache := usercache.NewLRU(10)
+	require.NoError(t, cache.Set(ctx, "a", []byte("a"), time.Minute))
+	require.NoError(t, cache.Set(ctx, "b", []byte("b"), time.Minute))
+
+	values, err := cache.GetMany(ctx, "a", "missing", "b", "a")
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("a"), nil, []byte("b"), []byte("a")}, values)
+}
@@ -0,0 +1,79 @@
+package usercache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/robotlovesyou/fitest/pkg/redis"
+)
+
+// Redis is a Cache held in redis, so that it is shared by every instance of the service
+type Redis struct {
+	client *goredis.Client
+}
+
+// NewRedis creates a Redis cache for the redis server at addr, e.g. redis:6379. Connections are opened on first use
+func NewRedis(addr string) *Redis {
+	return &Redis{client: redis.New(addr)}
+}
+
+// Get implements Cache
+func (cache *Redis) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := cache.client.Get(ctx, key).Bytes()
+	switch {
+	case errors.Is(err, goredis.Nil):
+		return nil, false, nil
+	case err != nil:
+		return nil, false, fmt.Errorf("cannot get cached value: %w", err)
+	}
+	return value, true, nil
+}
+
+// GetMany implements Cache. The values are read with a single MGET
+func (cache *Redis) GetMany(ctx context.Context, keys ...string) ([][]byte, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	replies, err := cache.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("cannot get cached values: %w", err)
+	}
+	values := make([][]byte, len(keys))
+	for i, reply := range replies {
+		switch value := reply.(type) {
+		case nil:
+		case string:
+			values[i] = []byte(value)
+		default:
+			return nil, fmt.Errorf("cannot get cached values: unexpected reply from redis: %v", reply)
+		}
+	}
+	return values, nil
+}
+
+// Set implements Cache
+func (cache *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if err := cache.client.Set(ctx, key, value, ttl).Err(); err != nil {
+		return fmt.Errorf("cannot set cached value: %w", err)
+	}
+	return nil
+}
+
+// Delete implements Cache
+func (cache *Redis) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	if err := cache.client.Del(ctx, keys...).Err(); err != nil {
+		return fmt.Errorf("cannot delete cached values: %w", err)
+	}
+	return nil
+}
+
+// Close closes the connections to redis
+func (cache *Redis) Close() error {
+	return cache.client.Close()
+}
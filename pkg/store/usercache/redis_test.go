@@ -0,0 +1,69 @@
+package usercache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/robotlovesyou/fitest/pkg/store/usercache"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisCacheSetsGetsAndDeletesValues(t *testing.T) {
+	server := miniredis.RunT(t)
+	cache := usercache.NewRedis(server.Addr())
+	defer cache.Close()
+	ctx := context.Background()
+
+	require.NoError(t, cache.Set(ctx, "key", []byte("value"), 30*time.Second))
+	require.Equal(t, 30*time.Second, server.TTL("key"))
+
+	value, ok, err := cache.Get(ctx, "key")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, []byte("value"), value)
+
+	_, ok, err = cache.Get(ctx, "missing")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	require.NoError(t, cache.Delete(ctx, "key", "other"))
+	require.False(t, server.Exists("key"))
+}
+
+func TestRedisCacheGetsManyValues(t *testing.T) {
+	server := miniredis.RunT(t)
+	cache := usercache.NewRedis(server.Addr())
+	defer cache.Close()
+	ctx := context.Background()
+	require.NoError(t, cache.Set(ctx, "a", []byte("a"), time.Minute))
+	require.NoError(t, cache.Set(ctx, "b", []byte("b"), time.Minute))
+
+	values, err := cache.GetMany(ctx, "a", "missing", "b", "a")
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("a"), nil, []byte("b"), []byte("a")}, values)
+}
+
+func TestRedisCacheExpiresValues(t *testing.T) {
+	server := miniredis.RunT(t)
+	cache := usercache.NewRedis(server.Addr())
+	defer cache.Close()
+	ctx := context.Background()
+
+	require.NoError(t, cache.Set(ctx, "key", []byte("value"), time.Second))
+	server.FastForward(2 * time.Second)
+	_, ok, err := cache.Get(ctx, "key")
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestRedisCacheReturnsRedisErrors(t *testing.T) {
+	server := miniredis.RunT(t)
+	cache := usercache.NewRedis(server.Addr())
+	defer cache.Close()
+	server.SetError("ERR something went wrong")
+
+	_, _, err := cache.Get(context.Background(), "key")
+	require.ErrorContains(t, err, "something went wrong")
+}
@@ -0,0 +1,391 @@
+// Package usercache implements a read-through cache of users in front of a user store, to take the load of reading
+// frequently requested users off the database
+package usercache
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/log"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/tenant"
+	"github.com/robotlovesyou/fitest/pkg/user"
+)
+
+// Cache holds encoded users by key. Implementations must be safe for concurrent use
+type Cache interface {
+	// Get returns the value cached for key, and false if there is none or it has expired
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// GetMany returns the values cached for keys, in the same order. The value of a key is nil if there is none or it
+	// has expired
+	GetMany(ctx context.Context, keys ...string) ([][]byte, error)
+	// Set caches value for key until ttl has passed
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Delete removes the values cached for keys
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// Store is a user.UserStore which caches the users read by ReadOne and ReadMany, and removes them from the cache when they are
+// changed or deleted, or their events are processed. Any other method is passed to the wrapped store.
+// Users changed by methods which do not name them, such as MarkDormant, are removed when their events are processed.
+// A user read from the database just before a change and cached just after it may be served stale until the ttl has
+// passed, as may users changed by another instance of the service when the cache is not shared.
+// Errors from the cache are logged, and the wrapped store is used as if the cache were empty
+type Store struct {
+	store  user.UserStore
+	cache  Cache
+	ttl    time.Duration
+	logger *log.Logger
+}
+
+var _ user.UserStore = (*Store)(nil)
+
+// New creates a Store which caches the users read from store in cache for ttl
+func New(store user.UserStore, cache Cache, ttl time.Duration, logger *log.Logger) *Store {
+	return &Store{
+		store:  store,
+		cache:  cache,
+		ttl:    ttl,
+		logger: logger,
+	}
+}
+
+// key returns the cache key of the user of the tenant of ctx with the given id
+func key(ctx context.Context, id uuid.UUID) string {
+	return "user:" + tenant.FromContext(ctx) + ":" + id.String()
+}
+
+// ReadOne returns the cached user with the given id, or reads it from the wrapped store and caches it
+func (store *Store) ReadOne(ctx context.Context, id uuid.UUID) (userstore.User, error) {
+	if usr, ok := store.cached(ctx, id); ok {
+		return usr, nil
+	}
+	usr, err := store.store.ReadOne(ctx, id)
+	if err != nil {
+		return usr, err
+	}
+	store.cacheUser(ctx, &usr)
+	return usr, nil
+}
+
+// ReadMany returns the cached users with the given ids, which are read from the cache in a single call, and reads the
+// others from the wrapped store in a single call and caches them. Users which do not exist are not cached
+func (store *Store) ReadMany(ctx context.Context, ids []uuid.UUID) ([]userstore.User, error) {
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = key(ctx, id)
+	}
+	values, err := store.cache.GetMany(ctx, keys...)
+	if err != nil {
+		store.logger.Errorf(ctx, err, "cannot read %d users from cache", len(ids))
+		values = nil
+	}
+
+	users := make([]userstore.User, len(ids))
+	// ids may be repeated, so each missing user is read once and returned at every index it was asked for
+	var missing []uuid.UUID
+	missingAt := make(map[uuid.UUID][]int)
+	for i, id := range ids {
+		if i < len(values) && values[i] != nil {
+			if usr, ok := store.decode(ctx, id, values[i]); ok {
+				users[i] = usr
+				continue
+			}
+		}
+		if _, ok := missingAt[id]; !ok {
+			missing = append(missing, id)
+		}
+		missingAt[id] = append(missingAt[id], i)
+	}
+	if len(missing) == 0 {
+		return users, nil
+	}
+
+	read, err := store.store.ReadMany(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	for i := range read {
+		for _, at := range missingAt[missing[i]] {
+			users[at] = read[i]
+		}
+		if read[i].ID != uuid.Nil {
+			store.cacheUser(ctx, &read[i])
+		}
+	}
+	return users, nil
+}
+
+// cached returns the cached user with the given id, and false if it is not cached or cannot be read from the cache
+func (store *Store) cached(ctx context.Context, id uuid.UUID) (userstore.User, bool) {
+	data, ok, err := store.cache.Get(ctx, key(ctx, id))
+	if err != nil {
+		store.logger.Errorf(ctx, err, "cannot read user %s from cache", id)
+	}
+	if !ok {
+		return userstore.User{}, false
+	}
+	return store.decode(ctx, id, data)
+}
+
+// decode decodes the cached user with the given id, and returns false if it cannot be decoded
+func (store *Store) decode(ctx context.Context, id uuid.UUID, data []byte) (userstore.User, bool) {
+	var usr userstore.User
+	if err := json.Unmarshal(data, &usr); err != nil {
+		store.logger.Errorf(ctx, err, "cannot decode cached user %s", id)
+		return usr, false
+	}
+	return usr, true
+}
+
+// cacheUser caches usr, which has been read from the wrapped store
+func (store *Store) cacheUser(ctx context.Context, usr *userstore.User) {
+	data, err := json.Marshal(usr)
+	if err != nil {
+		store.logger.Errorf(ctx, err, "cannot encode user %s for cache", usr.ID)
+		return
+	}
+	if err = store.cache.Set(ctx, key(ctx, usr.ID), data, store.ttl); err != nil {
+		store.logger.Errorf(ctx, err, "cannot cache user %s", usr.ID)
+	}
+}
+
+// UpdateFields implements user.UserStore
+func (store *Store) UpdateFields(ctx context.Context, id uuid.UUID, version int64, change *userstore.Change) (userstore.User, error) {
+	defer store.invalidate(ctx, id)
+	return store.store.UpdateFields(ctx, id, version, change)
+}
+
+// ChangePassword implements user.UserStore
+func (store *Store) ChangePassword(ctx context.Context, usr *userstore.User) (userstore.User, error) {
+	defer store.invalidate(ctx, usr.ID)
+	return store.store.ChangePassword(ctx, usr)
+}
+
+// Anonymize implements user.UserStore
+func (store *Store) Anonymize(ctx context.Context, usr *userstore.User) (userstore.User, error) {
+	defer store.invalidate(ctx, usr.ID)
+	return store.store.Anonymize(ctx, usr)
+}
+
+// ChangeStatus implements user.UserStore
+func (store *Store) ChangeStatus(ctx context.Context, usr *userstore.User) (userstore.User, error) {
+	defer store.invalidate(ctx, usr.ID)
+	return store.store.ChangeStatus(ctx, usr)
+}
+
+// ResetPassword implements user.UserStore
+func (store *Store) ResetPassword(ctx context.Context, tokenHash, passwordHash string) (userstore.User, error) {
+	usr, err := store.store.ResetPassword(ctx, tokenHash, passwordHash)
+	if err == nil {
+		store.invalidate(ctx, usr.ID)
+	}
+	return usr, err
+}
+
+// ConfirmEmailChange implements user.UserStore
+func (store *Store) ConfirmEmailChange(ctx context.Context, tokenHash string) (userstore.User, error) {
+	usr, err := store.store.ConfirmEmailChange(ctx, tokenHash)
+	if err == nil {
+		store.invalidate(ctx, usr.ID)
+	}
+	return usr, err
+}
+
+// ChangeNickname implements user.UserStore
+func (store *Store) ChangeNickname(ctx context.Context, id uuid.UUID, version int64, nickname string, cooldown time.Duration) (userstore.User, error) {
+	defer store.invalidate(ctx, id)
+	return store.store.ChangeNickname(ctx, id, version, nickname, cooldown)
+}
+
+// DeleteOne implements user.UserStore
+func (store *Store) DeleteOne(ctx context.Context, id uuid.UUID) error {
+	defer store.invalidate(ctx, id)
+	return store.store.DeleteOne(ctx, id)
+}
+
+// DeleteMany implements user.UserStore
+func (store *Store) DeleteMany(ctx context.Context, ids []uuid.UUID) ([]uuid.UUID, error) {
+	defer store.invalidate(ctx, ids...)
+	return store.store.DeleteMany(ctx, ids)
+}
+
+// Restore implements user.UserStore
+func (store *Store) Restore(ctx context.Context, id uuid.UUID) (userstore.User, error) {
+	defer store.invalidate(ctx, id)
+	return store.store.Restore(ctx, id)
+}
+
+// ProcessEvent implements user.UserStore
+func (store *Store) ProcessEvent(ctx context.Context, id uuid.UUID, version int64) error {
+	defer store.invalidate(ctx, id)
+	return store.store.ProcessEvent(ctx, id, version)
+}
+
+// RecordLogin implements user.UserStore
+func (store *Store) RecordLogin(ctx context.Context, id uuid.UUID, at time.Time) error {
+	defer store.invalidate(ctx, id)
+	return store.store.RecordLogin(ctx, id, at)
+}
+
+// TouchLastSeen implements user.UserStore
+func (store *Store) TouchLastSeen(ctx context.Context, id uuid.UUID, at time.Time) error {
+	defer store.invalidate(ctx, id)
+	return store.store.TouchLastSeen(ctx, id, at)
+}
+
+// EnableTwoFactor implements user.UserStore
+func (store *Store) EnableTwoFactor(ctx context.Context, id uuid.UUID, pendingSecret string, step int64, recoveryCodes []string) (userstore.User, error) {
+	defer store.invalidate(ctx, id)
+	return store.store.EnableTwoFactor(ctx, id, pendingSecret, step, recoveryCodes)
+}
+
+// DisableTwoFactor implements user.UserStore
+func (store *Store) DisableTwoFactor(ctx context.Context, id uuid.UUID) (userstore.User, error) {
+	defer store.invalidate(ctx, id)
+	return store.store.DisableTwoFactor(ctx, id)
+}
+
+// Create implements user.UserStore
+func (store *Store) Create(ctx context.Context, usr *userstore.User) (userstore.User, error) {
+	return store.store.Create(ctx, usr)
+}
+
+// CreateWithKey implements user.UserStore
+func (store *Store) CreateWithKey(ctx context.Context, usr *userstore.User, key string) (userstore.User, error) {
+	return store.store.CreateWithKey(ctx, usr, key)
+}
+
+// CreateMany implements user.UserStore
+func (store *Store) CreateMany(ctx context.Context, users []userstore.User) ([]error, error) {
+	return store.store.CreateMany(ctx, users)
+}
+
+// RequestPasswordReset implements user.UserStore
+func (store *Store) RequestPasswordReset(ctx context.Context, id uuid.UUID, email string, token userstore.ResetToken) error {
+	return store.store.RequestPasswordReset(ctx, id, email, token)
+}
+
+// RequestEmailChange implements user.UserStore
+func (store *Store) RequestEmailChange(ctx context.Context, id uuid.UUID, version int64, email string, change userstore.EmailChange) error {
+	return store.store.RequestEmailChange(ctx, id, version, email, change)
+}
+
+// ReadRecord implements user.UserStore. Records are not cached
+func (store *Store) ReadRecord(ctx context.Context, id uuid.UUID) (userstore.Record, error) {
+	return store.store.ReadRecord(ctx, id)
+}
+
+// FindByEmail implements user.UserStore
+func (store *Store) FindByEmail(ctx context.Context, email string) (userstore.User, error) {
+	return store.store.FindByEmail(ctx, email)
+}
+
+// FindByNickname implements user.UserStore
+func (store *Store) FindByNickname(ctx context.Context, nickname string) (userstore.User, error) {
+	return store.store.FindByNickname(ctx, nickname)
+}
+
+// EmailExists implements user.UserStore
+func (store *Store) EmailExists(ctx context.Context, email string) (bool, error) {
+	return store.store.EmailExists(ctx, email)
+}
+
+// NicknameExists implements user.UserStore
+func (store *Store) NicknameExists(ctx context.Context, nickname string) (bool, error) {
+	return store.store.NicknameExists(ctx, nickname)
+}
+
+// Replay implements user.UserStore
+func (store *Store) Replay(ctx context.Context, id uuid.UUID) (userstore.User, error) {
+	defer store.invalidate(ctx, id)
+	return store.store.Replay(ctx, id)
+}
+
+// Purge implements user.UserStore. Only deleted users are purged, and they are removed from the cache when they are
+// deleted
+func (store *Store) Purge(ctx context.Context) (int64, error) {
+	return store.store.Purge(ctx)
+}
+
+// MarkDormant implements user.UserStore. The users made dormant are removed from the cache when their events are
+// processed
+func (store *Store) MarkDormant(ctx context.Context, inactiveSince time.Time) (int64, error) {
+	return store.store.MarkDormant(ctx, inactiveSince)
+}
+
+// FindMany implements user.UserStore
+func (store *Store) FindMany(ctx context.Context, query *userstore.Query) (userstore.Page, error) {
+	return store.store.FindMany(ctx, query)
+}
+
+// Count implements user.UserStore
+func (store *Store) Count(ctx context.Context, query *userstore.Query) (int64, error) {
+	return store.store.Count(ctx, query)
+}
+
+// Stats implements user.UserStore
+func (store *Store) Stats(ctx context.Context, query *userstore.Query, interval userstore.StatsInterval) (userstore.Stats, error) {
+	return store.store.Stats(ctx, query, interval)
+}
+
+// Iterate implements user.UserStore
+func (store *Store) Iterate(ctx context.Context, query *userstore.Query) (userstore.UserIterator, error) {
+	return store.store.Iterate(ctx, query)
+}
+
+// Events implements user.UserStore
+func (store *Store) Events(ctx context.Context, pollInterval, lease, backoff time.Duration) <-chan userstore.EventResult {
+	return store.store.Events(ctx, pollInterval, lease, backoff)
+}
+
+// Backlog implements user.UserStore
+func (store *Store) Backlog(ctx context.Context) (userstore.Backlog, error) {
+	return store.store.Backlog(ctx)
+}
+
+// DeadLetterEvent implements user.UserStore
+func (store *Store) DeadLetterEvent(ctx context.Context, id uuid.UUID, version int64) error {
+	return store.store.DeadLetterEvent(ctx, id, version)
+}
+
+// DeadLetters implements user.UserStore
+func (store *Store) DeadLetters(ctx context.Context) ([]userstore.Event, error) {
+	return store.store.DeadLetters(ctx)
+}
+
+// RequeueDeadLetter implements user.UserStore
+func (store *Store) RequeueDeadLetter(ctx context.Context, id uuid.UUID) error {
+	return store.store.RequeueDeadLetter(ctx, id)
+}
+
+// BeginTwoFactor implements user.UserStore. It does not change the cached user
+func (store *Store) BeginTwoFactor(ctx context.Context, id uuid.UUID, pendingSecret string) error {
+	return store.store.BeginTwoFactor(ctx, id, pendingSecret)
+}
+
+// UseTwoFactorStep implements user.UserStore. It does not change the cached user
+func (store *Store) UseTwoFactorStep(ctx context.Context, id uuid.UUID, step int64) error {
+	return store.store.UseTwoFactorStep(ctx, id, step)
+}
+
+// UseRecoveryCode implements user.UserStore. It does not change the cached user
+func (store *Store) UseRecoveryCode(ctx context.Context, id uuid.UUID, code string) error {
+	return store.store.UseRecoveryCode(ctx, id, code)
+}
+
+// invalidate removes the users with the given ids from the cache
+func (store *Store) invalidate(ctx context.Context, ids ...uuid.UUID) {
+	if len(ids) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, key(ctx, id))
+	}
+	if err := store.cache.Delete(ctx, keys...); err != nil {
+		store.logger.Errorf(ctx, err, "cannot remove %d users from cache", len(ids))
+	}
+}
@@ -0,0 +1,334 @@
+package usercache_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/log"
+	"github.com/robotlovesyou/fitest/pkg/store/usercache"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/tenant"
+	"github.com/robotlovesyou/fitest/pkg/user"
+	"github.com/stretchr/testify/require"
+)
+
+// stubStore counts the reads of its users, and returns them from each method which changes a user. Methods which are
+// not implemented panic
+type stubStore struct {
+	user.UserStore
+	users map[uuid.UUID]userstore.User
+	reads int
+}
+
+func newStubStore(users ...userstore.User) *stubStore {
+	store := &stubStore{users: make(map[uuid.UUID]userstore.User)}
+	for _, usr := range users {
+		store.users[usr.ID] = usr
+	}
+	return store
+}
+
+func (store *stubStore) ReadOne(_ context.Context, id uuid.UUID) (userstore.User, error) {
+	store.reads += 1
+	usr, ok := store.users[id]
+	if !ok {
+		return usr, userstore.ErrNotFound
+	}
+	return usr, nil
+}
+
+func (store *stubStore) ReadMany(_ context.Context, ids []uuid.UUID) ([]userstore.User, error) {
+	store.reads += len(ids)
+	users := make([]userstore.User, 0, len(ids))
+	for _, id := range ids {
+		users = append(users, store.users[id])
+	}
+	return users, nil
+}
+
+func (store *stubStore) UpdateFields(_ context.Context, id uuid.UUID, _ int64, _ *userstore.Change) (userstore.User, error) {
+	return store.users[id], nil
+}
+
+func (store *stubStore) ChangePassword(_ context.Context, usr *userstore.User) (userstore.User, error) {
+	return *usr, nil
+}
+
+func (store *stubStore) Anonymize(_ context.Context, usr *userstore.User) (userstore.User, error) {
+	return *usr, nil
+}
+
+func (store *stubStore) ChangeStatus(_ context.Context, usr *userstore.User) (userstore.User, error) {
+	return *usr, nil
+}
+
+func (store *stubStore) ResetPassword(context.Context, string, string) (userstore.User, error) {
+	for _, usr := range store.users {
+		return usr, nil
+	}
+	return userstore.User{}, userstore.ErrInvalidResetToken
+}
+
+func (store *stubStore) ConfirmEmailChange(ctx context.Context, _ string) (userstore.User, error) {
+	return store.ResetPassword(ctx, "", "")
+}
+
+func (store *stubStore) ChangeNickname(_ context.Context, id uuid.UUID, _ int64, _ string, _ time.Duration) (userstore.User, error) {
+	return store.users[id], nil
+}
+
+func (store *stubStore) DeleteOne(context.Context, uuid.UUID) error {
+	return nil
+}
+
+func (store *stubStore) DeleteMany(_ context.Context, ids []uuid.UUID) ([]uuid.UUID, error) {
+	return ids, nil
+}
+
+func (store *stubStore) Restore(ctx context.Context, id uuid.UUID) (userstore.User, error) {
+	return store.users[id], nil
+}
+
+func (store *stubStore) Replay(_ context.Context, id uuid.UUID) (userstore.User, error) {
+	return store.users[id], nil
+}
+
+func (store *stubStore) RecordLogin(context.Context, uuid.UUID, time.Time) error {
+	return nil
+}
+
+func (store *stubStore) TouchLastSeen(context.Context, uuid.UUID, time.Time) error {
+	return nil
+}
+
+func (store *stubStore) ProcessEvent(context.Context, uuid.UUID, int64) error {
+	return nil
+}
+
+func fakeStoreUser() userstore.User {
+	return userstore.User{
+		ID:        uuid.New(),
+		FirstName: "Max",
+		LastName:  "Mustermann",
+		Nickname:  "max",
+		Email:     "max@example.com",
+		Country:   "DE",
+		CreatedAt: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+		UpdatedAt: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+		Version:   1,
+		Status:    userstore.StatusActive,
+	}
+}
+
+func newStore(t *testing.T, stub *stubStore, cache usercache.Cache) *usercache.Store {
+	logger, err := log.New("test")
+	require.NoError(t, err)
+	return usercache.New(stub, cache, time.Minute, logger)
+}
+
+func TestStoreCachesUsersPerTenant(t *testing.T) {
+	usr := fakeStoreUser()
+	stub := newStubStore(usr)
+	store := newStore(t, stub, usercache.NewLRU(10))
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		read, err := store.ReadOne(ctx, usr.ID)
+		require.NoError(t, err)
+		require.Equal(t, usr, read)
+	}
+	require.Equal(t, 1, stub.reads)
+
+	_, err := store.ReadOne(tenant.With(ctx, "acme"), usr.ID)
+	require.NoError(t, err)
+	require.Equal(t, 2, stub.reads)
+}
+
+func TestStoreDoesNotCacheMissingUsers(t *testing.T) {
+	stub := newStubStore()
+	store := newStore(t, stub, usercache.NewLRU(10))
+	id := uuid.New()
+	for i := 0; i < 2; i++ {
+		_, err := store.ReadOne(context.Background(), id)
+		require.ErrorIs(t, err, userstore.ErrNotFound)
+	}
+	require.Equal(t, 2, stub.reads)
+}
+
+func TestStoreReadsManyUsersFromCacheAndOnlyReadsTheMissingOnes(t *testing.T) {
+	cached, uncached := fakeStoreUser(), fakeStoreUser()
+	stub := newStubStore(cached, uncached)
+	store := newStore(t, stub, usercache.NewLRU(10))
+	ctx := context.Background()
+	_, err := store.ReadOne(ctx, cached.ID)
+	require.NoError(t, err)
+
+	missing := uuid.New()
+	users, err := store.ReadMany(ctx, []uuid.UUID{uncached.ID, missing, cached.ID})
+	require.NoError(t, err)
+	require.Equal(t, []userstore.User{uncached, {}, cached}, users)
+	require.Equal(t, 3, stub.reads, "only the users which were not cached are read")
+
+	users, err = store.ReadMany(ctx, []uuid.UUID{uncached.ID, cached.ID})
+	require.NoError(t, err)
+	require.Equal(t, []userstore.User{uncached, cached}, users)
+	require.Equal(t, 3, stub.reads)
+}
+
+// countingCache is an LRU which counts the calls made to read from it
+type countingCache struct {
+	*usercache.LRU
+	gets int
+}
+
+func (cache *countingCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	cache.gets += 1
+	return cache.LRU.Get(ctx, key)
+}
+
+func (cache *countingCache) GetMany(ctx context.Context, keys ...string) ([][]byte, error) {
+	cache.gets += 1
+	return cache.LRU.GetMany(ctx, keys...)
+}
+
+func TestStoreReadsManyUsersFromCacheInASingleCall(t *testing.T) {
+	users := []userstore.User{fakeStoreUser(), fakeStoreUser(), fakeStoreUser()}
+	cache := &countingCache{LRU: usercache.NewLRU(10)}
+	store := newStore(t, newStubStore(users...), cache)
+	ctx := context.Background()
+	ids := []uuid.UUID{users[0].ID, users[1].ID, users[2].ID}
+	_, err := store.ReadMany(ctx, ids)
+	require.NoError(t, err)
+
+	cache.gets = 0
+	read, err := store.ReadMany(ctx, ids)
+	require.NoError(t, err)
+	require.Equal(t, users, read)
+	require.Equal(t, 1, cache.gets)
+}
+
+func TestStoreReadsManyUsersWithRepeatedIDs(t *testing.T) {
+	cached, uncached := fakeStoreUser(), fakeStoreUser()
+	stub := newStubStore(cached, uncached)
+	store := newStore(t, stub, usercache.NewLRU(10))
+	ctx := context.Background()
+	_, err := store.ReadOne(ctx, cached.ID)
+	require.NoError(t, err)
+
+	missing := uuid.New()
+	users, err := store.ReadMany(ctx, []uuid.UUID{uncached.ID, cached.ID, uncached.ID, missing, cached.ID, missing})
+	require.NoError(t, err)
+	require.Equal(t, []userstore.User{uncached, cached, uncached, {}, cached, {}}, users)
+	require.Equal(t, 3, stub.reads, "each user which was not cached is read once")
+}
+
+func TestStoreRemovesChangedUsersFromCache(t *testing.T) {
+	cases := []struct {
+		name   string
+		change func(context.Context, *usercache.Store, userstore.User) error
+	}{
+		{name: "update", change: func(ctx context.Context, store *usercache.Store, usr userstore.User) error {
+			_, err := store.UpdateFields(ctx, usr.ID, usr.Version, &userstore.Change{})
+			return err
+		}},
+		{name: "change password", change: func(ctx context.Context, store *usercache.Store, usr userstore.User) error {
+			_, err := store.ChangePassword(ctx, &usr)
+			return err
+		}},
+		{name: "anonymize", change: func(ctx context.Context, store *usercache.Store, usr userstore.User) error {
+			_, err := store.Anonymize(ctx, &usr)
+			return err
+		}},
+		{name: "change status", change: func(ctx context.Context, store *usercache.Store, usr userstore.User) error {
+			_, err := store.ChangeStatus(ctx, &usr)
+			return err
+		}},
+		{name: "reset password", change: func(ctx context.Context, store *usercache.Store, _ userstore.User) error {
+			_, err := store.ResetPassword(ctx, "token hash", "password hash")
+			return err
+		}},
+		{name: "confirm email change", change: func(ctx context.Context, store *usercache.Store, _ userstore.User) error {
+			_, err := store.ConfirmEmailChange(ctx, "token hash")
+			return err
+		}},
+		{name: "change nickname", change: func(ctx context.Context, store *usercache.Store, usr userstore.User) error {
+			_, err := store.ChangeNickname(ctx, usr.ID, usr.Version, "renamed", time.Hour)
+			return err
+		}},
+		{name: "delete", change: func(ctx context.Context, store *usercache.Store, usr userstore.User) error {
+			return store.DeleteOne(ctx, usr.ID)
+		}},
+		{name: "delete many", change: func(ctx context.Context, store *usercache.Store, usr userstore.User) error {
+			_, err := store.DeleteMany(ctx, []uuid.UUID{uuid.New(), usr.ID})
+			return err
+		}},
+		{name: "restore", change: func(ctx context.Context, store *usercache.Store, usr userstore.User) error {
+			_, err := store.Restore(ctx, usr.ID)
+			return err
+		}},
+		{name: "replay", change: func(ctx context.Context, store *usercache.Store, usr userstore.User) error {
+			_, err := store.Replay(ctx, usr.ID)
+			return err
+		}},
+		{name: "process event", change: func(ctx context.Context, store *usercache.Store, usr userstore.User) error {
+			return store.ProcessEvent(ctx, usr.ID, usr.Version)
+		}},
+		{name: "record login", change: func(ctx context.Context, store *usercache.Store, usr userstore.User) error {
+			return store.RecordLogin(ctx, usr.ID, time.Now())
+		}},
+		{name: "touch last seen", change: func(ctx context.Context, store *usercache.Store, usr userstore.User) error {
+			return store.TouchLastSeen(ctx, usr.ID, time.Now())
+		}},
+	}
+	for _, c := range cases {
+		thisCase := c
+		t.Run(thisCase.name, func(t *testing.T) {
+			usr := fakeStoreUser()
+			stub := newStubStore(usr)
+			store := newStore(t, stub, usercache.NewLRU(10))
+			ctx := tenant.With(context.Background(), "acme")
+
+			_, err := store.ReadOne(ctx, usr.ID)
+			require.NoError(t, err)
+			require.NoError(t, thisCase.change(ctx, store, usr))
+			_, err = store.ReadOne(ctx, usr.ID)
+			require.NoError(t, err)
+			require.Equal(t, 2, stub.reads)
+		})
+	}
+}
+
+// failingCache is a Cache which always fails
+type failingCache struct{}
+
+func (failingCache) Get(context.Context, string) ([]byte, bool, error) {
+	return nil, false, errors.New("cache unavailable")
+}
+
+func (failingCache) GetMany(context.Context, ...string) ([][]byte, error) {
+	return nil, errors.New("cache unavailable")
+}
+
+func (failingCache) Set(context.Context, string, []byte, time.Duration) error {
+	return errors.New("cache unavailable")
+}
+
+func (failingCache) Delete(context.Context, ...string) error {
+	return errors.New("cache unavailable")
+}
+
+func TestStoreReadsUsersWhenCacheFails(t *testing.T) {
+	usr := fakeStoreUser()
+	store := newStore(t, newStubStore(usr), failingCache{})
+
+	read, err := store.ReadOne(context.Background(), usr.ID)
+	require.NoError(t, err)
+	require.Equal(t, usr, read)
+	users, err := store.ReadMany(context.Background(), []uuid.UUID{usr.ID, usr.ID})
+	require.NoError(t, err)
+	require.Equal(t, []userstore.User{usr, usr}, users)
+	require.NoError(t, store.DeleteOne(context.Background(), usr.ID))
+}
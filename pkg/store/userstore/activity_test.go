@@ -0,0 +1,72 @@
+package userstore_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/utctime"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordLoginSetsLastLoginAndLastSeenWithoutChangingVersion(t *testing.T) {
+	rec := fakeUserRecord()
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		_, err := store.Create(ctx, &rec)
+		require.NoError(t, err)
+		at := utctime.Now()
+		require.NoError(t, store.RecordLogin(ctx, rec.ID, at))
+
+		stored, err := store.ReadRecord(ctx, rec.ID)
+		require.NoError(t, err)
+		require.WithinDuration(t, at, stored.Data.LastLoginAt, time.Millisecond)
+		require.WithinDuration(t, at, stored.Data.LastSeenAt, time.Millisecond)
+		require.Equal(t, rec.Version, stored.Data.Version)
+		require.Len(t, stored.Events, 1, "only the Created event is stored")
+	})
+}
+
+func TestTouchLastSeenDoesNotMoveLastSeenBackwards(t *testing.T) {
+	rec := fakeUserRecord()
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		_, err := store.Create(ctx, &rec)
+		require.NoError(t, err)
+		later := utctime.Now()
+		require.NoError(t, store.TouchLastSeen(ctx, rec.ID, later))
+		require.NoError(t, store.TouchLastSeen(ctx, rec.ID, later.Add(-time.Hour)))
+
+		read, err := store.ReadOne(ctx, rec.ID)
+		require.NoError(t, err)
+		require.WithinDuration(t, later, read.LastSeenAt, time.Millisecond)
+		require.True(t, read.LastLoginAt.IsZero())
+	})
+}
+
+func TestTouchLastSeenFailsIfRecordDoesntExist(t *testing.T) {
+	rec := fakeUserRecord()
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		require.ErrorIs(t, store.TouchLastSeen(ctx, rec.ID, utctime.Now()), userstore.ErrNotFound)
+		require.ErrorIs(t, store.RecordLogin(ctx, rec.ID, utctime.Now()), userstore.ErrNotFound)
+	})
+}
+
+func TestCanFindUsersInactiveSinceATime(t *testing.T) {
+	since := utctime.Now().Add(-24 * time.Hour)
+	seenRecently := fakeUserRecord(func(r *userstore.User) { r.CreatedAt = since.Add(-time.Hour) })
+	seenLongAgo := fakeUserRecord(func(r *userstore.User) { r.CreatedAt = since.Add(-2 * time.Hour) })
+	neverSeen := fakeUserRecord(func(r *userstore.User) { r.CreatedAt = since.Add(-3 * time.Hour) })
+	createdSince := fakeUserRecord()
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		createMany(ctx, []userstore.User{seenRecently, seenLongAgo, neverSeen, createdSince}, store)
+		require.NoError(t, store.TouchLastSeen(ctx, seenRecently.ID, utctime.Now()))
+		require.NoError(t, store.TouchLastSeen(ctx, seenLongAgo.ID, since.Add(-time.Hour)))
+
+		page, err := store.FindMany(ctx, &userstore.Query{Page: 1, Length: 10, InactiveSince: since})
+		require.NoError(t, err)
+		require.Equal(t, int64(2), page.Total)
+		require.Len(t, page.Items, 2)
+		require.Equal(t, neverSeen.ID, page.Items[0].ID)
+		require.Equal(t, seenLongAgo.ID, page.Items[1].ID)
+	})
+}
@@ -0,0 +1,49 @@
+package userstore_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreCanAnonymizeAUserRecord(t *testing.T) {
+	rec := fakeUserRecord(func(r *userstore.User) { r.AvatarURL = "https://images.example.com/avatars/1.png" })
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		_, err := store.Create(ctx, &rec)
+		require.NoError(t, err)
+		anonymized := rec
+		anonymized.FirstName = "Anonymized"
+		anonymized.LastName = "Anonymized"
+		anonymized.Nickname = "anonymized-" + rec.ID.String()
+		anonymized.Email = rec.ID.String() + "@anonymized.invalid"
+		anonymized.PasswordHash = ""
+		anonymized.AvatarURL = ""
+
+		updated, err := store.Anonymize(ctx, &anonymized)
+		require.NoError(t, err)
+		compareUserRecords(t, anonymized, updated)
+		require.Equal(t, rec.Version+1, updated.Version)
+
+		// the original email address can be used again
+		other := fakeUserRecord(func(r *userstore.User) { r.Email = rec.Email })
+		_, err = store.Create(ctx, &other)
+		require.NoError(t, err)
+	})
+}
+
+func TestUpdateDoesNotChangeNicknameOrEmail(t *testing.T) {
+	rec := fakeUserRecord()
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		_, err := store.Create(ctx, &rec)
+		require.NoError(t, err)
+		update := rec
+		update.Nickname = "changed"
+		update.Email = "changed@example.com"
+		updated, err := store.UpdateOne(ctx, &update)
+		require.NoError(t, err)
+		require.Equal(t, rec.Nickname, updated.Nickname)
+		require.Equal(t, rec.Email, updated.Email)
+	})
+}
@@ -0,0 +1,65 @@
+package userstore_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestStoresWithDifferentCollectionsCanShareADatabase(t *testing.T) {
+	var db *mongo.Database
+	withStoreCreatedBy(func(d *mongo.Database) *userstore.Store {
+		db = d
+		return userstore.New(d, userstore.Options{})
+	}, func(ctx context.Context, store *userstore.Store) {
+		other := userstore.New(db, userstore.Options{Collection: "users_v2"})
+		applied, err := other.Migrate(ctx)
+		require.NoError(t, err)
+		require.Len(t, applied, len(other.Migrations()), "the migrations of the default collection do not count")
+
+		rec := fakeUserRecord()
+		_, err = other.Create(ctx, &rec)
+		require.NoError(t, err)
+		_, err = other.ReadOne(ctx, rec.ID)
+		require.NoError(t, err)
+		_, err = store.ReadOne(ctx, rec.ID)
+		require.ErrorIs(t, err, userstore.ErrNotFound)
+		// the email address is only unique within each collection
+		_, err = store.Create(ctx, &rec)
+		require.NoError(t, err)
+
+		count, err := db.Collection("users_v2_migrations").CountDocuments(ctx, bson.M{})
+		require.NoError(t, err)
+		require.Equal(t, int64(len(other.Migrations())), count)
+	})
+}
+
+func TestStoresCanBeKeptInAnotherDatabase(t *testing.T) {
+	var db *mongo.Database
+	withStoreCreatedBy(func(d *mongo.Database) *userstore.Store {
+		db = d
+		return userstore.New(d, userstore.Options{})
+	}, func(ctx context.Context, store *userstore.Store) {
+		name := "db" + uuid.Must(uuid.NewRandom()).String()
+		other := db.Client().Database(name)
+		defer other.Drop(ctx)
+
+		elsewhere := userstore.New(db, userstore.Options{Database: name})
+		_, err := elsewhere.Migrate(ctx)
+		require.NoError(t, err)
+		rec := fakeUserRecord()
+		_, err = elsewhere.Create(ctx, &rec)
+		require.NoError(t, err)
+
+		count, err := other.Collection(userstore.CollectionName).CountDocuments(ctx, bson.M{})
+		require.NoError(t, err)
+		require.Equal(t, int64(1), count)
+		_, err = store.ReadOne(ctx, rec.ID)
+		require.ErrorIs(t, err, userstore.ErrNotFound)
+	})
+}
@@ -3,7 +3,9 @@ package userstore_test
 import (
 	"context"
 	"testing"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/robotlovesyou/fitest/pkg/store/userstore"
 	"github.com/stretchr/testify/require"
 )
@@ -18,12 +20,14 @@ func TestStoreCanCreateAUserRecord(t *testing.T) {
 
 func TestCannotCreateClashingRecords(t *testing.T) {
 	cases := []struct {
-		name  string
-		userA userstore.User
-		userB userstore.User
+		name     string
+		userA    userstore.User
+		userB    userstore.User
+		expected error
 	}{
 		{
-			name: "Clashing Email",
+			name:     "Clashing Email",
+			expected: userstore.ErrEmailInUse,
 			userA: fakeUserRecord(func(u *userstore.User) {
 				u.Email = "abc@example.com"
 			}),
@@ -32,7 +36,8 @@ func TestCannotCreateClashingRecords(t *testing.T) {
 			}),
 		},
 		{
-			name: "Clashing Nickname",
+			name:     "Clashing Nickname",
+			expected: userstore.ErrNicknameInUse,
 			userA: fakeUserRecord(func(u *userstore.User) {
 				u.Nickname = "superoriginal"
 			}),
@@ -49,7 +54,102 @@ func TestCannotCreateClashingRecords(t *testing.T) {
 				require.NoError(t, err)
 				_, err = store.Create(ctx, &c.userB)
 				require.ErrorIs(t, err, userstore.ErrAlreadyExists)
+				require.ErrorIs(t, err, c.expected)
 			})
 		})
 	}
 }
+
+func TestStoreReturnsOriginalRecordForRepeatedIdempotencyKey(t *testing.T) {
+	rec := fakeUserRecord()
+	retry := rec
+	retry.ID = uuid.Must(uuid.NewRandom())
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		_, err := store.CreateWithKey(ctx, &rec, "some key")
+		require.NoError(t, err)
+		created, err := store.CreateWithKey(ctx, &retry, "some key")
+		require.NoError(t, err)
+		compareUserRecords(t, rec, created)
+	})
+}
+
+func TestStoreCreatesRecordsWithDifferentIdempotencyKeys(t *testing.T) {
+	rec1 := fakeUserRecord()
+	rec2 := fakeUserRecord()
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		_, err := store.CreateWithKey(ctx, &rec1, "some key")
+		require.NoError(t, err)
+		created, err := store.CreateWithKey(ctx, &rec2, "another key")
+		require.NoError(t, err)
+		compareUserRecords(t, rec2, created)
+	})
+}
+
+func TestCannotCreateClashingRecordWithNewIdempotencyKey(t *testing.T) {
+	rec := fakeUserRecord()
+	cases := []struct {
+		name     string
+		clashing userstore.User
+		expected error
+	}{
+		{
+			name:     "Clashing Email",
+			clashing: fakeUserRecord(func(u *userstore.User) { u.Email = rec.Email }),
+			expected: userstore.ErrEmailInUse,
+		},
+		{
+			name:     "Clashing Nickname",
+			clashing: fakeUserRecord(func(u *userstore.User) { u.Nickname = rec.Nickname }),
+			expected: userstore.ErrNicknameInUse,
+		},
+	}
+	for _, c := range cases {
+		thisCase := c
+		t.Run(thisCase.name, func(t *testing.T) {
+			withStore(func(ctx context.Context, store *userstore.Store) {
+				_, err := store.CreateWithKey(ctx, &rec, "some key")
+				require.NoError(t, err)
+				_, err = store.CreateWithKey(ctx, &thisCase.clashing, "another key")
+				require.ErrorIs(t, err, thisCase.expected)
+			})
+		})
+	}
+}
+
+func TestStoreCanCreateManyUserRecords(t *testing.T) {
+	existing := fakeUserRecord()
+	users := []userstore.User{
+		fakeUserRecord(),
+		fakeUserRecord(func(u *userstore.User) { u.Email = existing.Email }),
+		fakeUserRecord(func(u *userstore.User) { u.Nickname = "repeated" }),
+		fakeUserRecord(func(u *userstore.User) { u.Nickname = "repeated" }),
+	}
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		_, err := store.Create(ctx, &existing)
+		require.NoError(t, err)
+
+		errs, err := store.CreateMany(ctx, users)
+		require.NoError(t, err)
+		require.Len(t, errs, len(users))
+		require.NoError(t, errs[0])
+		require.ErrorIs(t, errs[1], userstore.ErrEmailInUse)
+		require.NoError(t, errs[2])
+		require.ErrorIs(t, errs[3], userstore.ErrNicknameInUse)
+
+		for _, created := range []userstore.User{users[0], users[2]} {
+			read, err := store.ReadOne(ctx, created.ID)
+			require.NoError(t, err)
+			compareUserRecords(t, created, read)
+		}
+		_, err = store.ReadOne(ctx, users[1].ID)
+		require.ErrorIs(t, err, userstore.ErrNotFound)
+	})
+}
+
+func TestChangesAreLimitedByTheWriteTimeout(t *testing.T) {
+	rec := fakeUserRecord()
+	withStoreOptions(userstore.Options{WriteTimeout: time.Nanosecond}, func(ctx context.Context, store *userstore.Store) {
+		_, err := store.Create(ctx, &rec)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
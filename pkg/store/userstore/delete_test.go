@@ -2,11 +2,16 @@ package userstore_test
 
 import (
 	"context"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/utctime"
 	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 func TestStoreCanDeleteAUserRecord(t *testing.T) {
@@ -53,3 +58,108 @@ func TestStoreCannotDeleteRecordTwice(t *testing.T) {
 		require.ErrorIs(t, err, userstore.ErrNotFound)
 	})
 }
+
+func TestStoreCanDeleteManyRecords(t *testing.T) {
+	rec1 := fakeUserRecord()
+	rec2 := fakeUserRecord()
+	missing := uuid.Must(uuid.NewRandom())
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		_, err := store.Create(ctx, &rec1)
+		require.NoError(t, err)
+		_, err = store.Create(ctx, &rec2)
+		require.NoError(t, err)
+		deleted, err := store.DeleteMany(ctx, []uuid.UUID{rec1.ID, missing, rec2.ID})
+		require.NoError(t, err)
+		require.ElementsMatch(t, []uuid.UUID{rec1.ID, rec2.ID}, deleted)
+		_, err = store.ReadOne(ctx, rec1.ID)
+		require.ErrorIs(t, err, userstore.ErrNotFound)
+	})
+}
+
+func TestStoreDoesNotDeleteManyRecordsTwice(t *testing.T) {
+	rec := fakeUserRecord()
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		_, err := store.Create(ctx, &rec)
+		require.NoError(t, err)
+		err = store.DeleteOne(ctx, rec.ID)
+		require.NoError(t, err)
+		deleted, err := store.DeleteMany(ctx, []uuid.UUID{rec.ID})
+		require.NoError(t, err)
+		require.Empty(t, deleted)
+	})
+}
+
+func TestDeletionEventsCarryTheEmailAddressOfTheUser(t *testing.T) {
+	rec1 := fakeUserRecord()
+	rec2 := fakeUserRecord()
+	withSoftDeletingStore(time.Hour, func(ctx context.Context, store *userstore.Store) {
+		_, err := store.Create(ctx, &rec1)
+		require.NoError(t, err)
+		_, err = store.Create(ctx, &rec2)
+		require.NoError(t, err)
+		require.NoError(t, store.DeleteOne(ctx, rec1.ID))
+		_, err = store.DeleteMany(ctx, []uuid.UUID{rec2.ID})
+		require.NoError(t, err)
+
+		for _, rec := range []userstore.User{rec1, rec2} {
+			read, err := store.ReadRecord(ctx, rec.ID)
+			require.NoError(t, err)
+			require.Len(t, read.Events, 2)
+			require.Equal(t, userstore.Deleted, read.Events[1].Action)
+			require.Equal(t, rec.Email, read.Events[1].Email)
+		}
+	})
+}
+
+// readRaw reads the record with the given id from db, however it was deleted
+func readRaw(ctx context.Context, db *mongo.Database, id uuid.UUID) (rec userstore.Record) {
+	if err := db.Collection(userstore.CollectionName).FindOne(ctx, bson.M{"_id": id}).Decode(&rec); err != nil {
+		panic(fmt.Errorf("cannot read raw record: %v", err))
+	}
+	return rec
+}
+
+func TestDeletedRecordsExpireOnceTheirEventsAreProcessed(t *testing.T) {
+	rec := fakeUserRecord()
+	retention := time.Hour
+	var db *mongo.Database
+	withStoreCreatedBy(func(d *mongo.Database) *userstore.Store {
+		db = d
+		return userstore.New(d, userstore.Options{TombstoneRetention: retention})
+	}, func(ctx context.Context, store *userstore.Store) {
+		_, err := store.CreateWithKey(ctx, &rec, "some key")
+		require.NoError(t, err)
+		require.NoError(t, store.DeleteOne(ctx, rec.ID))
+		require.Nil(t, readRaw(ctx, db, rec.ID).ExpiresAt)
+
+		collectEvents(ctx, store, time.Second, true, 2)
+		expiresAt := readRaw(ctx, db, rec.ID).ExpiresAt
+		require.NotNil(t, expiresAt)
+		require.WithinDuration(t, utctime.Now().Add(retention), *expiresAt, time.Minute)
+
+		// until the record expires, its idempotency key cannot be used again
+		retry := fakeUserRecord()
+		_, err = store.CreateWithKey(ctx, &retry, "some key")
+		require.ErrorIs(t, err, userstore.ErrAlreadyExists)
+	})
+}
+
+func TestPurgedRecordsExpire(t *testing.T) {
+	rec := fakeUserRecord()
+	var db *mongo.Database
+	withStoreCreatedBy(func(d *mongo.Database) *userstore.Store {
+		db = d
+		return userstore.NewWithRetention(d, time.Millisecond, userstore.Options{})
+	}, func(ctx context.Context, store *userstore.Store) {
+		_, err := store.Create(ctx, &rec)
+		require.NoError(t, err)
+		require.NoError(t, store.DeleteOne(ctx, rec.ID))
+		collectEvents(ctx, store, time.Second, true, 2)
+		require.Nil(t, readRaw(ctx, db, rec.ID).ExpiresAt)
+
+		time.Sleep(10 * time.Millisecond)
+		_, err = store.Purge(ctx)
+		require.NoError(t, err)
+		require.NotNil(t, readRaw(ctx, db, rec.ID).ExpiresAt)
+	})
+}
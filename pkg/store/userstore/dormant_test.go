@@ -0,0 +1,85 @@
+package userstore_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/tenant"
+	"github.com/robotlovesyou/fitest/pkg/utctime"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarkDormantChangesInactiveActiveUsersAndAddsEvents(t *testing.T) {
+	since := utctime.Now().Add(-24 * time.Hour)
+	seenLongAgo := fakeUserRecord(func(r *userstore.User) { r.CreatedAt = since.Add(-2 * time.Hour) })
+	neverSeen := fakeUserRecord(func(r *userstore.User) { r.CreatedAt = since.Add(-time.Hour) })
+	seenRecently := fakeUserRecord(func(r *userstore.User) { r.CreatedAt = since.Add(-time.Hour) })
+	suspended := fakeUserRecord(func(r *userstore.User) {
+		r.CreatedAt = since.Add(-time.Hour)
+		r.Status = userstore.StatusSuspended
+	})
+	createdSince := fakeUserRecord()
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		createMany(ctx, []userstore.User{seenLongAgo, neverSeen, seenRecently, suspended, createdSince}, store)
+		require.NoError(t, store.TouchLastSeen(ctx, seenLongAgo.ID, since.Add(-time.Hour)))
+		require.NoError(t, store.TouchLastSeen(ctx, seenRecently.ID, utctime.Now()))
+
+		marked, err := store.MarkDormant(ctx, since)
+		require.NoError(t, err)
+		require.Equal(t, int64(2), marked)
+
+		for _, dormant := range []userstore.User{seenLongAgo, neverSeen} {
+			rec, err := store.ReadRecord(ctx, dormant.ID)
+			require.NoError(t, err)
+			require.Equal(t, userstore.StatusDormant, rec.Data.Status)
+			require.Equal(t, dormant.Version+1, rec.Data.Version)
+			require.Len(t, rec.Events, 2)
+			require.Equal(t, userstore.MarkedDormant, rec.Events[1].Action)
+			require.Equal(t, rec.Data.Version, rec.Events[1].Version)
+		}
+		for _, unchanged := range []userstore.User{seenRecently, suspended, createdSince} {
+			read, err := store.ReadOne(ctx, unchanged.ID)
+			require.NoError(t, err)
+			require.Equal(t, unchanged.Status, read.Status)
+			require.Equal(t, unchanged.Version, read.Version)
+		}
+	})
+}
+
+func TestMarkDormantChangesUsersOfEveryTenant(t *testing.T) {
+	since := utctime.Now().Add(-24 * time.Hour)
+	users := []userstore.User{
+		fakeUserRecord(func(r *userstore.User) { r.CreatedAt = since.Add(-time.Hour) }),
+		fakeUserRecord(func(r *userstore.User) { r.CreatedAt = since.Add(-time.Hour) }),
+	}
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		_, err := store.Create(tenant.With(ctx, "acme"), &users[0])
+		require.NoError(t, err)
+		_, err = store.Create(tenant.With(ctx, "other"), &users[1])
+		require.NoError(t, err)
+
+		marked, err := store.MarkDormant(ctx, since)
+		require.NoError(t, err)
+		require.Equal(t, int64(2), marked)
+
+		read, err := store.ReadOne(tenant.With(ctx, "other"), users[1].ID)
+		require.NoError(t, err)
+		require.Equal(t, userstore.StatusDormant, read.Status)
+	})
+}
+
+func TestMarkDormantSkipsDeletedUsers(t *testing.T) {
+	since := utctime.Now().Add(-24 * time.Hour)
+	rec := fakeUserRecord(func(r *userstore.User) { r.CreatedAt = since.Add(-time.Hour) })
+	withSoftDeletingStore(time.Hour, func(ctx context.Context, store *userstore.Store) {
+		_, err := store.Create(ctx, &rec)
+		require.NoError(t, err)
+		require.NoError(t, store.DeleteOne(ctx, rec.ID))
+
+		marked, err := store.MarkDormant(ctx, since)
+		require.NoError(t, err)
+		require.Zero(t, marked)
+	})
+}
@@ -0,0 +1,248 @@
+package userstore
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/telemetry"
+	"github.com/robotlovesyou/fitest/pkg/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel"
+)
+
+// restoreBatchSize is the number of dumped users inserted at once by RestoreDump. It should probably be configurable
+const restoreBatchSize = 500
+
+// maxDumpLine is the length of the longest line of a dump which RestoreDump reads
+const maxDumpLine = 1024 * 1024
+
+// DumpOptions select what is written by Dump
+type DumpOptions struct {
+	// IncludeCredentials includes the password hashes and two factor secrets of users. Without them, users are
+	// restored without a password, and without two factor authentication, so they must reset their password
+	IncludeCredentials bool
+}
+
+// DumpedUser is a line of a dump written by Dump, which holds a user and the tenant they belong to
+type DumpedUser struct {
+	Tenant           string    `json:"tenant"`
+	ID               uuid.UUID `json:"id"`
+	FirstName        string    `json:"first_name"`
+	LastName         string    `json:"last_name"`
+	Nickname         string    `json:"nickname"`
+	PasswordHash     string    `json:"password_hash,omitempty"`
+	Email            string    `json:"email"`
+	Country          string    `json:"country"`
+	AvatarURL        string    `json:"avatar_url,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+	Version          int64     `json:"version"`
+	Status           Status    `json:"status,omitempty"`
+	LastLoginAt      time.Time `json:"last_login_at,omitempty"`
+	LastSeenAt       time.Time `json:"last_seen_at,omitempty"`
+	TwoFactorEnabled bool      `json:"two_factor_enabled,omitempty"`
+	// TwoFactorSecret and RecoveryCodes, the hashes of the unused recovery codes, are only dumped with the
+	// credentials of the user
+	TwoFactorSecret string   `json:"two_factor_secret,omitempty"`
+	RecoveryCodes   []string `json:"recovery_codes,omitempty"`
+}
+
+// dumpedUser returns the line of a dump for the record rec
+func dumpedUser(rec *Record, opts DumpOptions) DumpedUser {
+	u := rec.Data
+	dumped := DumpedUser{
+		Tenant:      rec.Tenant,
+		ID:          u.ID,
+		FirstName:   u.FirstName,
+		LastName:    u.LastName,
+		Nickname:    u.Nickname,
+		Email:       u.Email,
+		Country:     u.Country,
+		AvatarURL:   u.AvatarURL,
+		CreatedAt:   u.CreatedAt,
+		UpdatedAt:   u.UpdatedAt,
+		Version:     u.Version,
+		Status:      u.Status,
+		LastLoginAt: u.LastLoginAt,
+		LastSeenAt:  u.LastSeenAt,
+	}
+	if opts.IncludeCredentials {
+		dumped.PasswordHash = u.PasswordHash
+		if u.TwoFactorEnabled && rec.TwoFactor != nil {
+			dumped.TwoFactorEnabled = true
+			dumped.TwoFactorSecret = rec.TwoFactor.Secret
+			dumped.RecoveryCodes = rec.TwoFactor.RecoveryCodes
+		}
+	}
+	return dumped
+}
+
+// record returns the record which restores the dumped user, with the event for their creation
+func (dumped *DumpedUser) record() *Record {
+	u := &User{
+		ID:               dumped.ID,
+		FirstName:        dumped.FirstName,
+		LastName:         dumped.LastName,
+		Nickname:         dumped.Nickname,
+		PasswordHash:     dumped.PasswordHash,
+		Email:            dumped.Email,
+		Country:          dumped.Country,
+		AvatarURL:        dumped.AvatarURL,
+		CreatedAt:        dumped.CreatedAt,
+		UpdatedAt:        dumped.UpdatedAt,
+		Version:          dumped.Version,
+		Status:           dumped.Status,
+		LastLoginAt:      dumped.LastLoginAt,
+		LastSeenAt:       dumped.LastSeenAt,
+		TwoFactorEnabled: dumped.TwoFactorEnabled && dumped.TwoFactorSecret != "",
+	}
+	rec := &Record{
+		ID:            u.ID,
+		Data:          u,
+		Events:        []Event{eventFor(Created, u.ID, u.Version, u)},
+		Tenant:        dumped.Tenant,
+		SchemaVersion: CurrentSchemaVersion,
+	}
+	if u.TwoFactorEnabled {
+		rec.TwoFactor = &TwoFactor{Secret: dumped.TwoFactorSecret, RecoveryCodes: dumped.RecoveryCodes}
+	}
+	return rec
+}
+
+// Dump writes the users of every tenant to w as JSON lines of DumpedUser, and returns the number of users written.
+// Deleted users, the events waiting to be published and the tokens issued to users are not dumped. The users are
+// read from a single cursor rather than a snapshot, so users changed while they are dumped may be dumped either
+// before or after the change
+func (store *Store) Dump(ctx context.Context, w io.Writer, opts DumpOptions) (int64, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "DumpUsers")
+	defer span.End()
+
+	projection := bson.M{"data": 1, "tenant": 1, "schema_version": 1}
+	if opts.IncludeCredentials {
+		projection["two_factor"] = 1
+	}
+	filter := excludeDeleted(bson.M{"data": bson.M{"$ne": nil}})
+	cur, err := store.queries.Collection.Find(ctx, filter, options.Find().SetProjection(projection).SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		span.RecordError(err)
+		return 0, fmt.Errorf("cannot find users to dump: %w", err)
+	}
+	defer cur.Close(ctx)
+
+	buffered := bufio.NewWriter(w)
+	enc := json.NewEncoder(buffered)
+	var dumped int64
+	for cur.Next(ctx) {
+		var rec Record
+		if err = cur.Decode(&rec); err != nil {
+			span.RecordError(err)
+			return dumped, fmt.Errorf("cannot decode user to dump: %w", err)
+		}
+		if err = enc.Encode(dumpedUser(&rec, opts)); err != nil {
+			span.RecordError(err)
+			return dumped, fmt.Errorf("cannot write dumped user: %w", err)
+		}
+		dumped++
+	}
+	if err = cur.Err(); err != nil {
+		span.RecordError(err)
+		return dumped, fmt.Errorf("cannot find users to dump: %w", err)
+	}
+	if err = buffered.Flush(); err != nil {
+		span.RecordError(err)
+		return dumped, fmt.Errorf("cannot write dumped users: %w", err)
+	}
+	return dumped, nil
+}
+
+// RestoreResult is the outcome of RestoreDump
+type RestoreResult struct {
+	// Restored is the number of users restored
+	Restored int64
+	// Skipped is the number of users not restored because their id, email address or nickname is already used
+	Skipped int64
+}
+
+// RestoreDump creates the users of a dump written by Dump, in the tenants they were dumped from, so that a store can
+// be cloned or recovered. Users whose id, email address or nickname is already used are skipped, so a restore which
+// failed can be run again. An event for the creation of each user is published, as for the users created by CreateMany
+func (store *Store) RestoreDump(ctx context.Context, r io.Reader) (RestoreResult, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "RestoreDump")
+	defer span.End()
+	var result RestoreResult
+	if err := store.checkIndexesBuilt(); err != nil {
+		span.RecordError(err)
+		return result, err
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxDumpLine)
+	batch := make([]interface{}, 0, restoreBatchSize)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var dumped DumpedUser
+		if err := json.Unmarshal(scanner.Bytes(), &dumped); err != nil {
+			span.RecordError(err)
+			return result, fmt.Errorf("cannot read dumped user on line %d: %w", line, err)
+		}
+		if dumped.ID == uuid.Nil || (dumped.Tenant != tenant.Default && !tenant.Valid(dumped.Tenant)) {
+			err := fmt.Errorf("dumped user on line %d has no id or an invalid tenant", line)
+			span.RecordError(err)
+			return result, err
+		}
+		batch = append(batch, dumped.record())
+		if len(batch) == restoreBatchSize {
+			if err := store.restoreBatch(ctx, batch, &result); err != nil {
+				span.RecordError(err)
+				return result, err
+			}
+			batch = batch[:0]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		span.RecordError(err)
+		return result, fmt.Errorf("cannot read dump: %w", err)
+	}
+	if len(batch) > 0 {
+		if err := store.restoreBatch(ctx, batch, &result); err != nil {
+			span.RecordError(err)
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// restoreBatch inserts the records of a batch of dumped users, counting them in result
+func (store *Store) restoreBatch(ctx context.Context, batch []interface{}, result *RestoreResult) error {
+	ctx, cancel := store.writeContext(ctx)
+	defer cancel()
+	_, err := store.collection.InsertMany(ctx, batch, options.InsertMany().SetOrdered(false))
+	if err == nil {
+		result.Restored += int64(len(batch))
+		return nil
+	}
+	var bulkErr mongo.BulkWriteException
+	if !errors.As(err, &bulkErr) || bulkErr.WriteConcernError != nil {
+		return fmt.Errorf("cannot restore users: %w", err)
+	}
+	for _, writeErr := range bulkErr.WriteErrors {
+		if writeErr.Code != codeDuplicateKey {
+			return fmt.Errorf("cannot restore users: %w", err)
+		}
+	}
+	result.Skipped += int64(len(bulkErr.WriteErrors))
+	result.Restored += int64(len(batch) - len(bulkErr.WriteErrors))
+	return nil
+}
@@ -0,0 +1,105 @@
+package userstore_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/tenant"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestDumpedUsersCanBeRestoredToAnotherStore(t *testing.T) {
+	cases := []struct {
+		name               string
+		includeCredentials bool
+	}{
+		{name: "WithCredentials", includeCredentials: true},
+		{name: "WithoutCredentials"},
+	}
+	for _, c := range cases {
+		thisCase := c
+		t.Run(thisCase.name, func(t *testing.T) {
+			var db *mongo.Database
+			withStoreCreatedBy(func(d *mongo.Database) *userstore.Store {
+				db = d
+				return userstore.New(d, userstore.Options{})
+			}, func(ctx context.Context, store *userstore.Store) {
+				acme := tenant.With(ctx, "acme")
+				kept := fakeUserRecord()
+				_, err := store.Create(acme, &kept)
+				require.NoError(t, err)
+				deleted := fakeUserRecord()
+				_, err = store.Create(ctx, &deleted)
+				require.NoError(t, err)
+				require.NoError(t, store.DeleteOne(ctx, deleted.ID))
+
+				var dump bytes.Buffer
+				dumped, err := store.Dump(ctx, &dump, userstore.DumpOptions{IncludeCredentials: thisCase.includeCredentials})
+				require.NoError(t, err)
+				require.Equal(t, int64(1), dumped, "deleted users are not dumped")
+
+				clone := userstore.New(db, userstore.Options{Collection: "users_clone"})
+				_, err = clone.Migrate(ctx)
+				require.NoError(t, err)
+				result, err := clone.RestoreDump(ctx, bytes.NewReader(dump.Bytes()))
+				require.NoError(t, err)
+				require.Equal(t, userstore.RestoreResult{Restored: 1}, result)
+
+				restored, err := clone.ReadOne(acme, kept.ID)
+				require.NoError(t, err)
+				require.Equal(t, kept.Email, restored.Email)
+				require.Equal(t, kept.Version, restored.Version)
+				if thisCase.includeCredentials {
+					require.Equal(t, kept.PasswordHash, restored.PasswordHash)
+				} else {
+					require.Empty(t, restored.PasswordHash)
+				}
+				_, err = clone.ReadOne(ctx, kept.ID)
+				require.ErrorIs(t, err, userstore.ErrNotFound, "users are restored to the tenant they were dumped from")
+
+				result, err = clone.RestoreDump(ctx, bytes.NewReader(dump.Bytes()))
+				require.NoError(t, err)
+				require.Equal(t, userstore.RestoreResult{Skipped: 1}, result, "users which already exist are skipped")
+			})
+		})
+	}
+}
+
+func TestDumpsAreJSONLines(t *testing.T) {
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		for i := 0; i < 3; i++ {
+			rec := fakeUserRecord()
+			_, err := store.Create(ctx, &rec)
+			require.NoError(t, err)
+		}
+		var dump bytes.Buffer
+		_, err := store.Dump(ctx, &dump, userstore.DumpOptions{})
+		require.NoError(t, err)
+
+		lines := 0
+		scanner := bufio.NewScanner(&dump)
+		for scanner.Scan() {
+			var dumped userstore.DumpedUser
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &dumped))
+			require.Equal(t, tenant.Default, dumped.Tenant)
+			require.Empty(t, dumped.PasswordHash)
+			lines++
+		}
+		require.Equal(t, 3, lines)
+	})
+}
+
+func TestRestoringAMalformedDumpFails(t *testing.T) {
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		_, err := store.RestoreDump(ctx, strings.NewReader("{\"tenant\": \"default\"}\n"))
+		require.Error(t, err)
+		_, err = store.RestoreDump(ctx, strings.NewReader("not json\n"))
+		require.Error(t, err)
+	})
+}
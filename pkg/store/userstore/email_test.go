@@ -0,0 +1,77 @@
+package userstore_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/utctime"
+	"github.com/stretchr/testify/require"
+)
+
+func emailChange(email, hash string, expiresIn time.Duration) userstore.EmailChange {
+	return userstore.EmailChange{Email: email, Hash: hash, ExpiresAt: utctime.Now().Add(expiresIn)}
+}
+
+func TestStoreCanChangeEmailWithToken(t *testing.T) {
+	rec := fakeUserRecord()
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		_, err := store.Create(ctx, &rec)
+		require.NoError(t, err)
+		change := emailChange("new@example.com", "tokenhash", time.Hour)
+		require.NoError(t, store.RequestEmailChange(ctx, rec.ID, rec.Version, "token", change))
+
+		// the address is not changed until the change is confirmed
+		read, err := store.ReadOne(ctx, rec.ID)
+		require.NoError(t, err)
+		require.Equal(t, rec.Email, read.Email)
+
+		updated, err := store.ConfirmEmailChange(ctx, "tokenhash")
+		require.NoError(t, err)
+		require.Equal(t, "new@example.com", updated.Email)
+		require.Equal(t, rec.Version+1, updated.Version)
+
+		_, err = store.ConfirmEmailChange(ctx, "tokenhash")
+		require.ErrorIs(t, err, userstore.ErrInvalidEmailChangeToken)
+	})
+}
+
+func TestStoreCannotRequestEmailChangeWithStaleVersion(t *testing.T) {
+	rec := fakeUserRecord()
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		_, err := store.Create(ctx, &rec)
+		require.NoError(t, err)
+		err = store.RequestEmailChange(ctx, rec.ID, rec.Version+1, "token", emailChange("new@example.com", "tokenhash", time.Hour))
+		require.ErrorIs(t, err, userstore.ErrInvalidVersion)
+	})
+}
+
+func TestStoreCannotConfirmExpiredEmailChange(t *testing.T) {
+	rec := fakeUserRecord()
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		_, err := store.Create(ctx, &rec)
+		require.NoError(t, err)
+		require.NoError(t, store.RequestEmailChange(ctx, rec.ID, rec.Version, "token", emailChange("new@example.com", "tokenhash", -time.Second)))
+
+		_, err = store.ConfirmEmailChange(ctx, "tokenhash")
+		require.ErrorIs(t, err, userstore.ErrInvalidEmailChangeToken)
+	})
+}
+
+func TestStoreChecksEmailIsUniqueWhenChangeIsConfirmed(t *testing.T) {
+	rec := fakeUserRecord()
+	other := fakeUserRecord()
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		_, err := store.Create(ctx, &rec)
+		require.NoError(t, err)
+		require.NoError(t, store.RequestEmailChange(ctx, rec.ID, rec.Version, "token", emailChange(other.Email, "tokenhash", time.Hour)))
+
+		// another user takes the address before the change is confirmed
+		_, err = store.Create(ctx, &other)
+		require.NoError(t, err)
+
+		_, err = store.ConfirmEmailChange(ctx, "tokenhash")
+		require.ErrorIs(t, err, userstore.ErrEmailInUse)
+	})
+}
@@ -2,10 +2,15 @@ package userstore_test
 
 import (
 	"context"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/utctime"
 	"github.com/stretchr/testify/require"
 )
 
@@ -68,6 +73,18 @@ func TestActionsCauseEvents(t *testing.T) {
 			},
 			expected: []userstore.Action{userstore.Created, userstore.Updated},
 		},
+		{
+			name: "Create then ChangePassword",
+			actions: func(ctx context.Context, store *userstore.Store, t *testing.T) {
+				rec := fakeUserRecord()
+				_, err := store.Create(ctx, &rec)
+				require.NoError(t, err)
+				rec.PasswordHash = "newsupersecrethash"
+				_, err = store.ChangePassword(ctx, &rec)
+				require.NoError(t, err)
+			},
+			expected: []userstore.Action{userstore.Created, userstore.PasswordChanged},
+		},
 		{
 			name: "Create then Delete",
 			actions: func(ctx context.Context, store *userstore.Store, t *testing.T) {
@@ -106,3 +123,148 @@ func TestTimedOutPendingEventsAreReSent(t *testing.T) {
 		require.Len(t, events, 2)
 	})
 }
+
+func TestBacklogMeasuresEventsWhichHaveNotBeenProcessed(t *testing.T) {
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		backlog, err := store.Backlog(ctx)
+		require.NoError(t, err)
+		require.Zero(t, backlog.Pending)
+		require.True(t, backlog.Oldest.IsZero())
+
+		before := time.Now().Add(-time.Second)
+		rec1 := fakeUserRecord()
+		rec2 := fakeUserRecord()
+		_, err = store.Create(ctx, &rec1)
+		require.NoError(t, err)
+		_, err = store.Create(ctx, &rec2)
+		require.NoError(t, err)
+		require.NoError(t, store.DeleteOne(ctx, rec2.ID))
+
+		backlog, err = store.Backlog(ctx)
+		require.NoError(t, err)
+		require.Equal(t, int64(3), backlog.Pending)
+		require.True(t, backlog.Oldest.After(before))
+
+		collectEvents(ctx, store, time.Minute, true, 3)
+		backlog, err = store.Backlog(ctx)
+		require.NoError(t, err)
+		require.Zero(t, backlog.Pending)
+	})
+}
+
+func TestEventAttemptsAreCounted(t *testing.T) {
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		rec := fakeUserRecord()
+		_, err := store.Create(ctx, &rec)
+		require.NoError(t, err)
+
+		events := collectEvents(ctx, store, 100*time.Millisecond, false, 2)
+		require.Equal(t, int64(1), events[0].Attempts)
+		require.Equal(t, int64(2), events[1].Attempts)
+	})
+}
+
+func TestDeadLetteredEventsAreNotProcessedUntilRequeued(t *testing.T) {
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		rec := fakeUserRecord()
+		_, err := store.Create(ctx, &rec)
+		require.NoError(t, err)
+		_, err = store.UpdateOne(ctx, &rec)
+		require.NoError(t, err)
+
+		events := collectEvents(ctx, store, time.Minute, false, 1)
+		require.NoError(t, store.DeadLetterEvent(ctx, events[0].ID, events[0].Version))
+
+		deadLetters, err := store.DeadLetters(ctx)
+		require.NoError(t, err)
+		require.Len(t, deadLetters, 1)
+		require.Equal(t, userstore.Created, deadLetters[0].Action)
+		require.Equal(t, userstore.DeadLettered, deadLetters[0].State)
+		require.Equal(t, int64(1), deadLetters[0].Attempts)
+
+		backlog, err := store.Backlog(ctx)
+		require.NoError(t, err)
+		require.Zero(t, backlog.Pending)
+
+		require.NoError(t, store.RequeueDeadLetter(ctx, rec.ID))
+		require.ErrorIs(t, store.RequeueDeadLetter(ctx, rec.ID), userstore.ErrNotFound)
+		deadLetters, err = store.DeadLetters(ctx)
+		require.NoError(t, err)
+		require.Empty(t, deadLetters)
+
+		events = collectEvents(ctx, store, time.Minute, true, 2)
+		require.Equal(t, userstore.Created, events[0].Action)
+		require.Equal(t, int64(1), events[0].Attempts)
+		require.Equal(t, userstore.Updated, events[1].Action)
+	})
+}
+
+func TestEventsOfManyUsersAreClaimedInBatches(t *testing.T) {
+	withStoreOptions(userstore.Options{EventBatchSize: 2}, func(ctx context.Context, store *userstore.Store) {
+		var expected []uuid.UUID
+		for i := 0; i < 5; i++ {
+			rec := fakeUserRecord()
+			_, err := store.Create(ctx, &rec)
+			require.NoError(t, err)
+			expected = append(expected, rec.ID)
+		}
+
+		events := collectEvents(ctx, store, time.Minute, true, len(expected))
+		ids := make([]uuid.UUID, 0, len(events))
+		for _, e := range events {
+			ids = append(ids, e.ID)
+		}
+		require.ElementsMatch(t, expected, ids)
+	})
+}
+
+func TestChangesAreRefusedWhenTheUserHasTooManyPendingEvents(t *testing.T) {
+	withStoreOptions(userstore.Options{MaxPendingEvents: 2}, func(ctx context.Context, store *userstore.Store) {
+		rec := fakeUserRecord()
+		created, err := store.Create(ctx, &rec)
+		require.NoError(t, err)
+		updated, err := store.UpdateFields(ctx, rec.ID, created.Version, &userstore.Change{UpdatedAt: utctime.Now()})
+		require.NoError(t, err)
+
+		_, err = store.UpdateFields(ctx, rec.ID, updated.Version, &userstore.Change{UpdatedAt: utctime.Now()})
+		require.ErrorIs(t, err, userstore.ErrTooManyEvents)
+		_, err = store.Replay(ctx, rec.ID)
+		require.ErrorIs(t, err, userstore.ErrTooManyEvents)
+		// refusals are counted rather than failing the healthcheck
+		require.NoError(t, userstore.NewMonitor(store).Check(ctx))
+		expected := `
+# HELP users_store_too_many_events_refusals_total Count of changes refused because the user had the maximum number of events waiting to be published
+# TYPE users_store_too_many_events_refusals_total counter
+users_store_too_many_events_refusals_total 2
+`
+		require.NoError(t, testutil.CollectAndCompare(userstore.NewOperationCollector(store), strings.NewReader(expected), "users_store_too_many_events_refusals_total"))
+
+		// publishing an event makes room for another, and a full user can still be deleted
+		collectEvents(ctx, store, time.Minute, true, 1)
+		_, err = store.UpdateFields(ctx, rec.ID, updated.Version, &userstore.Change{UpdatedAt: utctime.Now()})
+		require.NoError(t, err)
+		require.NoError(t, store.DeleteOne(ctx, rec.ID))
+	})
+}
+
+func TestConcurrentChangesDoNotExceedMaxPendingEvents(t *testing.T) {
+	withStoreOptions(userstore.Options{MaxPendingEvents: 3}, func(ctx context.Context, store *userstore.Store) {
+		rec := fakeUserRecord()
+		_, err := store.Create(ctx, &rec)
+		require.NoError(t, err)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, _ = store.Replay(ctx, rec.ID)
+			}()
+		}
+		wg.Wait()
+
+		stored, err := store.ReadRecord(ctx, rec.ID)
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(stored.Events), 3)
+	})
+}
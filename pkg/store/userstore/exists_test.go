@@ -0,0 +1,48 @@
+package userstore_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmailAndNicknameExist(t *testing.T) {
+	rec := fakeUserRecord()
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		_, err := store.Create(ctx, &rec)
+		require.NoError(t, err)
+
+		exists, err := store.EmailExists(ctx, rec.Email)
+		require.NoError(t, err)
+		require.True(t, exists)
+		exists, err = store.NicknameExists(ctx, rec.Nickname)
+		require.NoError(t, err)
+		require.True(t, exists)
+
+		exists, err = store.EmailExists(ctx, "unused@example.com")
+		require.NoError(t, err)
+		require.False(t, exists)
+		exists, err = store.NicknameExists(ctx, "unused")
+		require.NoError(t, err)
+		require.False(t, exists)
+	})
+}
+
+func TestSoftDeletedUsersKeepTheirEmailAndNickname(t *testing.T) {
+	rec := fakeUserRecord()
+	withSoftDeletingStore(time.Hour, func(ctx context.Context, store *userstore.Store) {
+		_, err := store.Create(ctx, &rec)
+		require.NoError(t, err)
+		require.NoError(t, store.DeleteOne(ctx, rec.ID))
+
+		exists, err := store.EmailExists(ctx, rec.Email)
+		require.NoError(t, err)
+		require.True(t, exists)
+		exists, err = store.NicknameExists(ctx, rec.Nickname)
+		require.NoError(t, err)
+		require.True(t, exists)
+	})
+}
@@ -0,0 +1,221 @@
+package userstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/robotlovesyou/fitest/pkg/telemetry"
+	"github.com/robotlovesyou/fitest/pkg/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel"
+)
+
+const (
+	// collectionScan is the stage of plans which read every record of the collection
+	collectionScan = "COLLSCAN"
+	// explainLength is the length of the pages of queries explained by the ExplainHandler without one, which is the
+	// default length of the pages found by the service
+	explainLength = 25
+)
+
+// QueryPlan describes how the database ran the query for a page of users, so that queries which do not use an index
+// can be found before they are slow
+type QueryPlan struct {
+	// Stages are the stages of the plan chosen by the database, from the stage returning the users to the stages
+	// reading them
+	Stages []string `json:"stages"`
+	// Indexes are the names of the indexes the plan reads from
+	Indexes []string `json:"indexes"`
+	// CollectionScan is true when the plan reads every record of the collection rather than reading from an index
+	CollectionScan bool `json:"collection_scan"`
+	// KeysExamined and DocsExamined are the number of index keys and records read to find the Returned users
+	KeysExamined int64 `json:"keys_examined"`
+	DocsExamined int64 `json:"docs_examined"`
+	Returned     int64 `json:"returned"`
+	// Duration is the time the database took to run the query
+	Duration time.Duration `json:"duration"`
+}
+
+// explainOutput is the part of the output of explain read for a QueryPlan
+type explainOutput struct {
+	QueryPlanner struct {
+		WinningPlan bson.D `bson:"winningPlan"`
+	} `bson:"queryPlanner"`
+	ExecutionStats struct {
+		Returned            int64 `bson:"nReturned"`
+		ExecutionTimeMillis int64 `bson:"executionTimeMillis"`
+		TotalKeysExamined   int64 `bson:"totalKeysExamined"`
+		TotalDocsExamined   int64 `bson:"totalDocsExamined"`
+	} `bson:"executionStats"`
+}
+
+// Explain runs the query FindMany runs for the page of the given query, and returns the plan the database used for it.
+// The users are read but not returned, and the total is not counted. It is for diagnosing slow queries, so the query
+// is run with the read preference of queries but is not measured by the metrics of the store
+func (store *Store) Explain(ctx context.Context, query *Query) (QueryPlan, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "ExplainFindUserRecords")
+	defer span.End()
+	var plan QueryPlan
+
+	sort, err := sortFromQuery(query)
+	if err != nil {
+		span.RecordError(err)
+		return plan, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, store.options.FindTimeout)
+	defer cancel()
+
+	// the command is encoded with the registry of the collections, so that ids are matched as they are stored
+	cmd, err := bson.MarshalWithRegistry(newRegistry(store.options.UUIDRepresentation), bson.D{
+		{Key: "explain", Value: bson.D{
+			{Key: "find", Value: store.options.Collection},
+			{Key: "filter", Value: findFilter(ctx, query)},
+			{Key: "sort", Value: sort},
+			{Key: "skip", Value: skipFromQuery(query)},
+			{Key: "limit", Value: limitFromQuery(query)},
+		}},
+		{Key: "verbosity", Value: "executionStats"},
+	})
+	if err != nil {
+		span.RecordError(err)
+		return plan, fmt.Errorf("cannot encode explain command: %w", err)
+	}
+	var output explainOutput
+	err = store.db.RunCommand(ctx, cmd, options.RunCmd().SetReadPreference(store.options.QueryReadPreference)).
+		Decode(&output)
+	if err != nil {
+		span.RecordError(err)
+		return plan, fmt.Errorf("cannot explain query: %w", err)
+	}
+
+	plan = QueryPlan{
+		KeysExamined: output.ExecutionStats.TotalKeysExamined,
+		DocsExamined: output.ExecutionStats.TotalDocsExamined,
+		Returned:     output.ExecutionStats.Returned,
+		Duration:     time.Duration(output.ExecutionStats.ExecutionTimeMillis) * time.Millisecond,
+	}
+	addPlanStages(&plan, output.QueryPlanner.WinningPlan)
+	return plan, nil
+}
+
+// addPlanStages adds the stages and indexes of stage, and of the stages it reads from, to plan. The stages are found
+// wherever they are nested, since the shape of plans differs between versions of the database and sharded collections
+func addPlanStages(plan *QueryPlan, stage interface{}) {
+	switch s := stage.(type) {
+	case bson.D:
+		for _, e := range s {
+			switch e.Key {
+			case "stage":
+				name, _ := e.Value.(string)
+				plan.Stages = append(plan.Stages, name)
+				if name == collectionScan {
+					plan.CollectionScan = true
+				}
+			case "indexName":
+				index, _ := e.Value.(string)
+				plan.Indexes = append(plan.Indexes, index)
+			case "slotBasedPlan":
+				// the slot based plans of newer versions repeat the query plan in a form which is not read
+			default:
+				addPlanStages(plan, e.Value)
+			}
+		}
+	case bson.A:
+		for _, value := range s {
+			addPlanStages(plan, value)
+		}
+	}
+}
+
+// ExplainHandler returns a handler which responds with the QueryPlan, as JSON, of the query given by the parameters of
+// the request. The parameters are tenant, country, which can be repeated, status, search, nickname, email,
+// name_prefix, sort_by, descending, length, page and skip_total, and created_after, created_before and
+// inactive_since, which are RFC 3339 times. It is for diagnosing queries, and should only be served to operators
+func ExplainHandler(store *Store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		params := r.URL.Query()
+		if id := params.Get("tenant"); id != "" {
+			if !tenant.Valid(id) {
+				http.Error(w, fmt.Sprintf("invalid tenant %s", id), http.StatusBadRequest)
+				return
+			}
+			ctx = tenant.With(ctx, id)
+		}
+		query, err := queryFromParams(params)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		plan, err := store.Explain(ctx, query)
+		switch {
+		case errors.Is(err, ErrInvalidSort):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(plan)
+	})
+}
+
+// queryFromParams returns the query given by the parameters of a request to the ExplainHandler
+func queryFromParams(params url.Values) (*Query, error) {
+	query := &Query{
+		Countries:  params["country"],
+		Status:     Status(params.Get("status")),
+		Search:     params.Get("search"),
+		Nickname:   params.Get("nickname"),
+		Email:      params.Get("email"),
+		NamePrefix: params.Get("name_prefix"),
+		SortBy:     SortField(params.Get("sort_by")),
+		Length:     explainLength,
+		Page:       1,
+	}
+	var err error
+	times := map[string]*time.Time{
+		"created_after":  &query.CreatedAfter,
+		"created_before": &query.CreatedBefore,
+		"inactive_since": &query.InactiveSince,
+	}
+	for name, t := range times {
+		if value := params.Get(name); value != "" {
+			if *t, err = time.Parse(time.RFC3339, value); err != nil {
+				return nil, fmt.Errorf("cannot parse %s: %w", name, err)
+			}
+		}
+	}
+	flags := map[string]*bool{
+		"descending": &query.SortDescending,
+		"skip_total": &query.SkipTotal,
+	}
+	for name, flag := range flags {
+		if value := params.Get(name); value != "" {
+			if *flag, err = strconv.ParseBool(value); err != nil {
+				return nil, fmt.Errorf("cannot parse %s: %w", name, err)
+			}
+		}
+	}
+	if value := params.Get("length"); value != "" {
+		length, err := strconv.ParseInt(value, 10, 32)
+		if err != nil || length <= 0 {
+			return nil, fmt.Errorf("cannot parse length: it must be a positive number")
+		}
+		query.Length = int32(length)
+	}
+	if value := params.Get("page"); value != "" {
+		if query.Page, err = strconv.ParseInt(value, 10, 64); err != nil || query.Page <= 0 {
+			return nil, fmt.Errorf("cannot parse page: it must be a positive number")
+		}
+	}
+	return query, nil
+}
@@ -0,0 +1,92 @@
+package userstore_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExplainReportsTheIndexUsedByAQuery(t *testing.T) {
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		rec := fakeUserRecord()
+		_, err := store.Create(ctx, &rec)
+		require.NoError(t, err)
+
+		plan, err := store.Explain(ctx, &userstore.Query{Email: rec.Email, Length: 10, Page: 1})
+		require.NoError(t, err)
+		require.False(t, plan.CollectionScan)
+		require.NotEmpty(t, plan.Indexes)
+		require.NotEmpty(t, plan.Stages)
+		require.Equal(t, int64(1), plan.Returned)
+	})
+}
+
+func TestQueriesAreNotSortedInMemory(t *testing.T) {
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		rec := fakeUserRecord()
+		_, err := store.Create(ctx, &rec)
+		require.NoError(t, err)
+
+		queries := []userstore.Query{
+			{SortBy: userstore.SortCreatedAt},
+			{SortBy: userstore.SortCreatedAt, SortDescending: true},
+			{SortBy: userstore.SortUpdatedAt},
+			{SortBy: userstore.SortLastName},
+			{SortBy: userstore.SortNickname},
+			{SortBy: userstore.SortCreatedAt, AfterID: rec.ID, AfterCreatedAt: rec.CreatedAt},
+			{Nickname: rec.Nickname},
+			{Email: rec.Email},
+		}
+		for _, query := range queries {
+			query.Length, query.Page = 10, 1
+			plan, err := store.Explain(ctx, &query)
+			require.NoError(t, err)
+			require.False(t, plan.CollectionScan, "%+v", query)
+			require.NotContains(t, plan.Stages, "SORT", "%+v", query)
+		}
+	})
+}
+
+func TestExplainRejectsAnInvalidSort(t *testing.T) {
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		_, err := store.Explain(ctx, &userstore.Query{SortBy: "password_hash"})
+		require.ErrorIs(t, err, userstore.ErrInvalidSort)
+	})
+}
+
+func TestExplainHandlerRespondsWithTheQueryPlan(t *testing.T) {
+	cases := []struct {
+		name   string
+		params url.Values
+		status int
+	}{
+		{name: "NoParameters", params: url.Values{}, status: http.StatusOK},
+		{name: "Query", params: url.Values{"country": {"DE", "FR"}, "sort_by": {"nickname"}, "descending": {"true"}}, status: http.StatusOK},
+		{name: "InvalidSort", params: url.Values{"sort_by": {"password_hash"}}, status: http.StatusBadRequest},
+		{name: "InvalidTime", params: url.Values{"created_after": {"yesterday"}}, status: http.StatusBadRequest},
+		{name: "InvalidLength", params: url.Values{"length": {"0"}}, status: http.StatusBadRequest},
+		{name: "InvalidTenant", params: url.Values{"tenant": {"-acme"}}, status: http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		thisCase := c
+		t.Run(thisCase.name, func(t *testing.T) {
+			withStore(func(ctx context.Context, store *userstore.Store) {
+				rec := httptest.NewRecorder()
+				req := httptest.NewRequest(http.MethodGet, "/debug/explain?"+thisCase.params.Encode(), nil)
+				userstore.ExplainHandler(store).ServeHTTP(rec, req.WithContext(ctx))
+				require.Equal(t, thisCase.status, rec.Code, rec.Body.String())
+				if thisCase.status == http.StatusOK {
+					var plan userstore.QueryPlan
+					require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &plan))
+					require.NotEmpty(t, plan.Stages)
+				}
+			})
+		})
+	}
+}
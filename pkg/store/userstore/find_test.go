@@ -2,12 +2,18 @@ package userstore_test
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"testing"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/robotlovesyou/fitest/pkg/store/userstore"
 	"github.com/robotlovesyou/fitest/pkg/utctime"
 	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
 )
 
 func TestCanPageThroughAllUsers(t *testing.T) {
@@ -44,6 +50,26 @@ func TestCanPageThroughAllUsers(t *testing.T) {
 	})
 }
 
+func TestCanFindUsersWithConfiguredConcerns(t *testing.T) {
+	users := make([]userstore.User, 5)
+	for i := range users {
+		users[i] = fakeUserRecord()
+	}
+	storeOptions := userstore.Options{
+		QueryReadPreference: readpref.SecondaryPreferred(),
+		QueryReadConcern:    readconcern.Majority(),
+		WriteConcern:        writeconcern.New(writeconcern.WMajority()),
+	}
+	withStoreOptions(storeOptions, func(ctx context.Context, store *userstore.Store) {
+		createMany(ctx, users, store)
+		// a secondary may not have the users yet, so the query is repeated until it does
+		require.Eventually(t, func() bool {
+			page, err := store.FindMany(ctx, &userstore.Query{Page: 1, Length: 10})
+			return err == nil && page.Total == int64(len(users)) && len(page.Items) == len(users)
+		}, timeout, 10*time.Millisecond)
+	})
+}
+
 func TestCanPageThroughUserFromCountry(t *testing.T) {
 	users := make([]userstore.User, 20)
 	for i := range users {
@@ -61,9 +87,9 @@ func TestCanPageThroughUserFromCountry(t *testing.T) {
 	withStore(func(ctx context.Context, store *userstore.Store) {
 		createMany(ctx, users, store)
 		page, err := store.FindMany(ctx, &userstore.Query{
-			Page:    1,
-			Length:  10,
-			Country: "NL",
+			Page:      1,
+			Length:    10,
+			Countries: []string{"NL"},
 		})
 		require.NoError(t, err)
 		require.Equal(t, int64(1), page.Page)
@@ -126,7 +152,7 @@ func TestCanPageThroughUserCreatedAfterAndFromCountry(t *testing.T) {
 			Page:         1,
 			Length:       10,
 			CreatedAfter: utctime.Now().Add(-1 * time.Hour),
-			Country:      "NL",
+			Countries:    []string{"NL"},
 		})
 		require.NoError(t, err)
 		require.Equal(t, int64(1), page.Page)
@@ -149,3 +175,291 @@ func TestFindManyCanHandleEmptyResults(t *testing.T) {
 		require.Len(t, page.Items, 0)
 	})
 }
+
+func TestCanPageThroughUsersSortedByLastNameDescending(t *testing.T) {
+	users := make([]userstore.User, 20)
+	for i := range users {
+		users[i] = fakeUserRecord(func(u *userstore.User) {
+			u.LastName = fmt.Sprintf("Lastname%02d", i)
+		})
+	}
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		createMany(ctx, users, store)
+		page, err := store.FindMany(ctx, &userstore.Query{
+			Page:           1,
+			Length:         10,
+			SortBy:         userstore.SortLastName,
+			SortDescending: true,
+		})
+		require.NoError(t, err)
+		require.Equal(t, int64(20), page.Total)
+		require.Len(t, page.Items, 10)
+		for i, itm := range page.Items {
+			compareUserRecords(t, users[len(users)-1-i], itm)
+		}
+	})
+}
+
+func TestFindManyRejectsUnknownSortField(t *testing.T) {
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		_, err := store.FindMany(ctx, &userstore.Query{
+			Page:   1,
+			Length: 10,
+			SortBy: "password_hash",
+		})
+		require.ErrorIs(t, err, userstore.ErrInvalidSort)
+	})
+}
+
+func TestCanCountUsersFromCountry(t *testing.T) {
+	users := make([]userstore.User, 20)
+	for i := range users {
+		country := "DE"
+		if i%4 == 0 {
+			country = "NL"
+		}
+		users[i] = fakeUserRecord(func(u *userstore.User) {
+			u.Country = country
+		})
+	}
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		createMany(ctx, users, store)
+		total, err := store.Count(ctx, &userstore.Query{Countries: []string{"NL"}})
+		require.NoError(t, err)
+		require.Equal(t, int64(5), total)
+	})
+}
+
+func TestCanIterateThroughAllUsersFromCountry(t *testing.T) {
+	users := make([]userstore.User, 30)
+	for i := range users {
+		country := "DE"
+		if i%3 == 0 {
+			country = "NL"
+		}
+		users[i] = fakeUserRecord(func(u *userstore.User) {
+			u.Country = country
+		})
+	}
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		createMany(ctx, users, store)
+		it, err := store.Iterate(ctx, &userstore.Query{Countries: []string{"NL"}})
+		require.NoError(t, err)
+		defer it.Close(ctx)
+
+		i := 0
+		for it.Next(ctx) {
+			compareUserRecords(t, users[i*3], it.User())
+			i++
+		}
+		require.NoError(t, it.Err())
+		require.Equal(t, 10, i)
+	})
+}
+
+func TestIterateRejectsUnknownSortField(t *testing.T) {
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		_, err := store.Iterate(ctx, &userstore.Query{SortBy: "password_hash"})
+		require.ErrorIs(t, err, userstore.ErrInvalidSort)
+	})
+}
+
+func TestFindIterVisitsTheUsersOfAPage(t *testing.T) {
+	created := time.Date(2022, 4, 4, 0, 0, 0, 0, time.UTC)
+	users := make([]userstore.User, 5)
+	for i := range users {
+		users[i] = fakeUserRecord(func(u *userstore.User) { u.CreatedAt = created.Add(time.Duration(i) * time.Hour) })
+	}
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		createMany(ctx, users, store)
+		it, err := store.FindIter(ctx, &userstore.Query{Length: 2, Page: 2})
+		require.NoError(t, err)
+		defer it.Close(ctx)
+
+		var found []uuid.UUID
+		for it.Next(ctx) {
+			found = append(found, it.User().ID)
+		}
+		require.NoError(t, it.Err())
+		require.Equal(t, []uuid.UUID{users[2].ID, users[3].ID}, found)
+
+		_, err = store.FindIter(ctx, &userstore.Query{SortBy: "password_hash"})
+		require.ErrorIs(t, err, userstore.ErrInvalidSort)
+	})
+}
+
+type brokenCursor struct {
+	remaining int
+}
+
+func (c *brokenCursor) Next(context.Context) bool {
+	c.remaining--
+	return c.remaining >= 0
+}
+
+func (c *brokenCursor) Decode(interface{}) error {
+	return errBrokenRecord
+}
+
+func (c *brokenCursor) Err() error {
+	return nil
+}
+
+func (c *brokenCursor) Close(context.Context) error {
+	return nil
+}
+
+var errBrokenRecord = errors.New("broken record")
+
+func TestIteratorStopsAtRecordsWhichCannotBeDecoded(t *testing.T) {
+	it := userstore.NewIterator(&brokenCursor{remaining: 2})
+	require.False(t, it.Next(context.Background()))
+	require.ErrorIs(t, it.Err(), errBrokenRecord)
+	require.False(t, it.Next(context.Background()))
+}
+
+func TestCanSearchUsers(t *testing.T) {
+	users := []userstore.User{
+		fakeUserRecord(func(u *userstore.User) { u.FirstName = "Maximilian"; u.LastName = "Schmidt" }),
+		fakeUserRecord(func(u *userstore.User) { u.FirstName = "Erika"; u.LastName = "Maxwell" }),
+		fakeUserRecord(func(u *userstore.User) { u.Nickname = "max"; u.FirstName = "Hans"; u.LastName = "Meier" }),
+		fakeUserRecord(func(u *userstore.User) { u.Email = "max@example.com"; u.FirstName = "Anna"; u.LastName = "Weber" }),
+		fakeUserRecord(func(u *userstore.User) { u.Nickname = "maxi"; u.FirstName = "Jana"; u.LastName = "Koch" }),
+	}
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		createMany(ctx, users, store)
+		cases := []struct {
+			search   string
+			expected []userstore.User
+		}{
+			{search: "Max", expected: users[:2]},
+			{search: "max", expected: users[2:3]},
+			{search: "max@example.com", expected: users[3:4]},
+			{search: "M.x", expected: nil},
+		}
+		for _, c := range cases {
+			page, err := store.FindMany(ctx, &userstore.Query{Page: 1, Length: 10, Search: c.search})
+			require.NoError(t, err)
+			require.Len(t, page.Items, len(c.expected))
+			for i, itm := range page.Items {
+				compareUserRecords(t, c.expected[i], itm)
+			}
+		}
+	})
+}
+
+func TestCanFindUsersFromSeveralCountries(t *testing.T) {
+	countries := []string{"DE", "NL", "BE", "NL", "FR"}
+	users := make([]userstore.User, len(countries))
+	for i, country := range countries {
+		country := country
+		users[i] = fakeUserRecord(func(u *userstore.User) {
+			u.Country = country
+		})
+	}
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		createMany(ctx, users, store)
+		page, err := store.FindMany(ctx, &userstore.Query{
+			Page:      1,
+			Length:    10,
+			Countries: []string{"NL", "BE"},
+		})
+		require.NoError(t, err)
+		require.Equal(t, int64(3), page.Total)
+		for _, itm := range page.Items {
+			require.Contains(t, []string{"NL", "BE"}, itm.Country)
+		}
+	})
+}
+
+func TestCanFindUsersCreatedBetweenTwoTimes(t *testing.T) {
+	now := utctime.Now()
+	users := make([]userstore.User, 5)
+	for i := range users {
+		createdAt := now.Add(-time.Duration(i) * 24 * time.Hour)
+		users[i] = fakeUserRecord(func(u *userstore.User) {
+			u.CreatedAt = createdAt
+		})
+	}
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		createMany(ctx, users, store)
+		page, err := store.FindMany(ctx, &userstore.Query{
+			Page:          1,
+			Length:        10,
+			CreatedAfter:  now.Add(-78 * time.Hour),
+			CreatedBefore: now.Add(-time.Hour),
+			SortBy:        userstore.SortCreatedAt,
+		})
+		require.NoError(t, err)
+		require.Equal(t, int64(3), page.Total)
+		require.Equal(t, users[3].ID, page.Items[0].ID)
+		require.Equal(t, users[1].ID, page.Items[2].ID)
+	})
+}
+
+func TestFindManyMatchesNicknameEmailAndNamePrefix(t *testing.T) {
+	users := []userstore.User{
+		fakeUserRecord(func(u *userstore.User) { u.FirstName = "Anna"; u.LastName = "Smith" }),
+		fakeUserRecord(func(u *userstore.User) { u.FirstName = "annabel"; u.LastName = "Jones" }),
+		fakeUserRecord(func(u *userstore.User) { u.FirstName = "Bob"; u.LastName = "ANDERSON" }),
+	}
+	cases := []struct {
+		name     string
+		query    userstore.Query
+		expected []userstore.User
+	}{
+		{name: "Nickname", query: userstore.Query{Nickname: users[1].Nickname}, expected: users[1:2]},
+		{name: "Email", query: userstore.Query{Email: users[2].Email}, expected: users[2:3]},
+		{name: "First name prefix ignoring case", query: userstore.Query{NamePrefix: "ANN"}, expected: users[:2]},
+		{name: "Last name prefix ignoring case", query: userstore.Query{NamePrefix: "and"}, expected: users[2:3]},
+		{name: "Either name prefix", query: userstore.Query{NamePrefix: "an"}, expected: users},
+		{name: "Email and mismatched name prefix", query: userstore.Query{Email: users[0].Email, NamePrefix: "bob"}},
+		{name: "Unknown nickname", query: userstore.Query{Nickname: "nobody"}},
+	}
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		createMany(ctx, users, store)
+		for _, c := range cases {
+			thisCase := c
+			t.Run(thisCase.name, func(t *testing.T) {
+				thisCase.query.Length = 10
+				thisCase.query.Page = 1
+				page, err := store.FindMany(ctx, &thisCase.query)
+				require.NoError(t, err)
+				require.Equal(t, int64(len(thisCase.expected)), page.Total)
+				var expected, found []uuid.UUID
+				for _, usr := range thisCase.expected {
+					expected = append(expected, usr.ID)
+				}
+				for _, usr := range page.Items {
+					found = append(found, usr.ID)
+				}
+				require.ElementsMatch(t, expected, found)
+			})
+		}
+	})
+}
+
+func TestFindManyWhichSkipsTheTotalSaysWhetherThereAreMoreUsers(t *testing.T) {
+	created := time.Date(2022, 4, 4, 0, 0, 0, 0, time.UTC)
+	users := []userstore.User{
+		fakeUserRecord(func(u *userstore.User) { u.CreatedAt = created }),
+		fakeUserRecord(func(u *userstore.User) { u.CreatedAt = created.Add(time.Hour) }),
+		fakeUserRecord(func(u *userstore.User) { u.CreatedAt = created.Add(2 * time.Hour) }),
+	}
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		createMany(ctx, users, store)
+		page, err := store.FindMany(ctx, &userstore.Query{Length: 2, Page: 1, SkipTotal: true})
+		require.NoError(t, err)
+		require.Equal(t, userstore.UnknownTotal, page.Total)
+		require.True(t, page.HasMore)
+		require.Len(t, page.Items, 2)
+		require.Equal(t, users[1].ID, page.Items[1].ID)
+
+		page, err = store.FindMany(ctx, &userstore.Query{Length: 2, Page: 2, SkipTotal: true})
+		require.NoError(t, err)
+		require.Equal(t, userstore.UnknownTotal, page.Total)
+		require.False(t, page.HasMore)
+		require.Len(t, page.Items, 1)
+		require.Equal(t, users[2].ID, page.Items[0].ID)
+	})
+}
@@ -0,0 +1,40 @@
+package userstore_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestMonitorFailsWhenTheRoundTripIsTooSlow(t *testing.T) {
+	cases := []struct {
+		name    string
+		options userstore.Options
+		healthy bool
+	}{
+		{name: "Ping within the default maximum", options: userstore.Options{}, healthy: true},
+		{name: "Query within the default maximum", options: userstore.Options{HealthQuery: true}, healthy: true},
+		{name: "Above the maximum", options: userstore.Options{HealthQuery: true, HealthMaxRoundTrip: time.Nanosecond}},
+	}
+	for _, c := range cases {
+		thisCase := c
+		t.Run(thisCase.name, func(t *testing.T) {
+			withStoreCreatedBy(func(db *mongo.Database) *userstore.Store {
+				return userstore.New(db, thisCase.options)
+			}, func(ctx context.Context, store *userstore.Store) {
+				monitor := userstore.NewMonitor(store)
+				err := monitor.Check(ctx)
+				if thisCase.healthy {
+					require.NoError(t, err)
+				} else {
+					require.ErrorContains(t, err, "round trip")
+				}
+				require.Contains(t, monitor.Describe(ctx), "round trip: ")
+			})
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package userstore
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// metricsNamespace and metricsSubsystem prefix the names of the metrics recorded for store operations
+	metricsNamespace = "users"
+	metricsSubsystem = "store"
+)
+
+// The types of error counted by operationMetrics
+const (
+	errorTypeNotFound        = "not_found"
+	errorTypeDuplicate       = "duplicate"
+	errorTypeVersionConflict = "version_conflict"
+	errorTypeTimeout         = "timeout"
+	errorTypeOther           = "other"
+)
+
+// operationMetrics records the latency of the operations of a store, the errors they return by type, and the changes
+// refused because the user had too many events waiting to be published
+type operationMetrics struct {
+	latency *prometheus.HistogramVec
+	errors  *prometheus.CounterVec
+	refused prometheus.Counter
+}
+
+// newOperationMetrics creates operationMetrics. They are registered by registering an OperationCollector
+func newOperationMetrics() *operationMetrics {
+	return &operationMetrics{
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "operation_duration_seconds",
+			Help:      "Latency of store operations by operation, including their retries",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "operation_errors_total",
+			Help:      "Count of store operations which returned an error, by operation and type of error",
+		}, []string{"operation", "type"}),
+		refused: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "too_many_events_refusals_total",
+			Help:      "Count of changes refused because the user had the maximum number of events waiting to be published",
+		}),
+	}
+}
+
+// observe records operation, which started at start, once it has returned the error err points to. It is deferred
+// by operations with a named error result
+func (m *operationMetrics) observe(operation string, start time.Time, err *error) {
+	m.latency.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if *err != nil {
+		m.errors.WithLabelValues(operation, errorType(*err)).Inc()
+	}
+}
+
+// errorType returns the type of err which is counted by operationMetrics
+func errorType(err error) string {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return errorTypeNotFound
+	case errors.Is(err, ErrAlreadyExists):
+		return errorTypeDuplicate
+	case errors.Is(err, ErrInvalidVersion), errors.Is(err, ErrTooManyRetries):
+		return errorTypeVersionConflict
+	case errors.Is(err, context.DeadlineExceeded):
+		return errorTypeTimeout
+	default:
+		return errorTypeOther
+	}
+}
+
+// OperationCollector is a prometheus.Collector which reports the latency of the operations of a store, the errors
+// they returned by type, and the changes refused because the user had too many events waiting to be published
+type OperationCollector struct {
+	metrics *operationMetrics
+}
+
+// NewOperationCollector creates a new OperationCollector for store
+func NewOperationCollector(store *Store) *OperationCollector {
+	return &OperationCollector{metrics: store.metrics}
+}
+
+// Describe implements prometheus.Collector
+func (c *OperationCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.metrics.latency.Describe(ch)
+	c.metrics.errors.Describe(ch)
+	c.metrics.refused.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (c *OperationCollector) Collect(ch chan<- prometheus.Metric) {
+	c.metrics.latency.Collect(ch)
+	c.metrics.errors.Collect(ch)
+	c.metrics.refused.Collect(ch)
+}
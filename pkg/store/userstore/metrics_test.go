@@ -0,0 +1,36 @@
+package userstore_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOperationErrorsAreCountedByType(t *testing.T) {
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		rec := fakeUserRecord()
+		_, err := store.Create(ctx, &rec)
+		require.NoError(t, err)
+
+		_, err = store.ReadOne(ctx, uuid.Must(uuid.NewRandom()))
+		require.ErrorIs(t, err, userstore.ErrNotFound)
+		clash := fakeUserRecord(func(u *userstore.User) { u.Email = rec.Email })
+		_, err = store.Create(ctx, &clash)
+		require.ErrorIs(t, err, userstore.ErrAlreadyExists)
+		stale := rec
+		stale.Version = rec.Version - 1
+		_, err = store.UpdateOne(ctx, &stale)
+		require.ErrorIs(t, err, userstore.ErrInvalidVersion)
+
+		collector := userstore.NewOperationCollector(store)
+		problems, err := testutil.CollectAndLint(collector)
+		require.NoError(t, err)
+		require.Empty(t, problems)
+		require.Equal(t, 3, testutil.CollectAndCount(collector, "users_store_operation_errors_total"))
+		require.Equal(t, 3, testutil.CollectAndCount(collector, "users_store_operation_duration_seconds"))
+	})
+}
@@ -0,0 +1,343 @@
+package userstore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/robotlovesyou/fitest/pkg/store/migrate"
+	"github.com/robotlovesyou/fitest/pkg/utctime"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// MigrationsCollectionName is the collection the applied migrations of the store are recorded in
+	MigrationsCollectionName = "migrations"
+	// MigrationLockCollectionName is the collection holding the lock taken while migrations are applied
+	MigrationLockCollectionName = "migration_lock"
+
+	// migrationLockID is the id of the single document of the lock collection
+	migrationLockID = "lock"
+
+	// foldBatchSize is the number of users whose names are folded by each write of indexFoldedNames
+	foldBatchSize = 1000
+)
+
+// Migrations returns the migrations of the store, in order. Migrations are never changed or removed once released,
+// since they may already have been applied: changes to the schema or records are made by adding a migration
+func (store *Store) Migrations() []migrate.Migration {
+	return []migrate.Migration{
+		{Version: 1, Name: "assign users to the default tenant", Up: store.migrateTenants},
+		{Version: 2, Name: "create indexes", Up: store.createIndexes},
+		{Version: 3, Name: "expire records of deleted users", Up: store.expireDeletedUsers},
+		{Version: 4, Name: "index folded names", Up: store.indexFoldedNames},
+		{Version: 5, Name: "index the order of creation", Up: store.indexCreationOrder},
+		{Version: 6, Name: "index sort orders", Up: store.indexSortOrders},
+	}
+}
+
+// Migrate applies the migrations of the store which have not been applied, and returns the migrations it applied.
+// If migrations are being applied by another runner, such as another instance of the service, it waits for them to
+// finish
+func (store *Store) Migrate(ctx context.Context) ([]migrate.Migration, error) {
+	return migrate.Run(ctx, store.migrationRecorder(), store.Migrations())
+}
+
+// migrationRecorder returns the MigrationRecorder of the store. Stores with a Collection other than CollectionName
+// record their migrations in collections prefixed with it, so that stores sharing a database migrate separately
+func (store *Store) migrationRecorder() *MigrationRecorder {
+	if store.options.Collection == CollectionName {
+		return NewMigrationRecorder(store.db)
+	}
+	prefix := store.options.Collection + "_"
+	return &MigrationRecorder{
+		migrations: store.db.Collection(prefix + MigrationsCollectionName),
+		lock:       store.db.Collection(prefix + MigrationLockCollectionName),
+	}
+}
+
+// expireDeletedUsers creates the TTL index which removes the records of irrecoverably deleted users once their expiry
+// time has passed, and sets the expiry time of the records which were deleted before it was created
+func (store *Store) expireDeletedUsers(ctx context.Context) error {
+	_, err := store.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetName(expiryIndex).SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return fmt.Errorf("cannot create index %s: %w", expiryIndex, err)
+	}
+	return store.expireDrained(ctx, bson.M{})
+}
+
+// indexCreationOrder creates the index used by queries sorted by the time users were created, and by queries which
+// start after a user, which are sorted by the time and then by id. Without the id, the database sorts the users which
+// match in memory before it can return the page
+func (store *Store) indexCreationOrder(ctx context.Context) error {
+	_, err := store.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			bson.E{Key: "tenant", Value: 1},
+			bson.E{Key: "data.created_at", Value: 1},
+			bson.E{Key: "_id", Value: 1},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("cannot index the order of creation: %w", err)
+	}
+	return nil
+}
+
+// indexSortOrders replaces the indexes on the update time and last name of users with indexes which include the id,
+// which breaks ties between users in each sort order, so that the database does not sort the users which match in
+// memory
+func (store *Store) indexSortOrders(ctx context.Context) error {
+	_, err := store.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				bson.E{Key: "tenant", Value: 1},
+				bson.E{Key: "data.updated_at", Value: 1},
+				bson.E{Key: "_id", Value: 1},
+			},
+		},
+		{
+			Keys: bson.D{
+				bson.E{Key: "tenant", Value: 1},
+				bson.E{Key: "data.last_name", Value: 1},
+				bson.E{Key: "_id", Value: 1},
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("cannot index sort orders: %w", err)
+	}
+	return store.dropIndexes(ctx, "tenant_1_data.updated_at_1", "tenant_1_data.last_name_1")
+}
+
+// indexFoldedNames sets the lower case forms of the first and last names of the users stored before they were added
+// by User.MarshalBSON, and creates the indexes used by queries by NamePrefix. A user who is changed while their names
+// are folded is skipped, since the change stored their folded names
+func (store *Store) indexFoldedNames(ctx context.Context) error {
+	cur, err := store.collection.Find(ctx, bson.M{
+		"data":                   bson.M{"$type": bsontype.EmbeddedDocument},
+		"data.first_name_folded": bson.M{"$exists": false},
+	}, options.Find().SetProjection(bson.M{"_id": 1, "data.first_name": 1, "data.last_name": 1}))
+	if err != nil {
+		return fmt.Errorf("cannot find users without folded names: %w", err)
+	}
+	defer cur.Close(ctx)
+	models := make([]mongo.WriteModel, 0, foldBatchSize)
+	write := func() error {
+		if len(models) == 0 {
+			return nil
+		}
+		if _, err := store.collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false)); err != nil {
+			return fmt.Errorf("cannot fold names: %w", err)
+		}
+		models = models[:0]
+		return nil
+	}
+	for cur.Next(ctx) {
+		var rec struct {
+			ID   interface{} `bson:"_id"`
+			Data struct {
+				FirstName string `bson:"first_name"`
+				LastName  string `bson:"last_name"`
+			} `bson:"data"`
+		}
+		if err := cur.Decode(&rec); err != nil {
+			return fmt.Errorf("cannot read names to fold: %w", err)
+		}
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": rec.ID, "data.first_name": rec.Data.FirstName, "data.last_name": rec.Data.LastName}).
+			SetUpdate(bson.M{"$set": bson.M{
+				"data.first_name_folded": foldName(rec.Data.FirstName),
+				"data.last_name_folded":  foldName(rec.Data.LastName),
+			}}))
+		if len(models) == foldBatchSize {
+			if err := write(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return fmt.Errorf("cannot read names to fold: %w", err)
+	}
+	if err := write(); err != nil {
+		return err
+	}
+
+	_, err = store.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				bson.E{Key: "tenant", Value: 1},
+				bson.E{Key: "data.first_name_folded", Value: 1},
+			},
+		},
+		{
+			Keys: bson.D{
+				bson.E{Key: "tenant", Value: 1},
+				bson.E{Key: "data.last_name_folded", Value: 1},
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("cannot create indexes of folded names: %w", err)
+	}
+	return nil
+}
+
+// MigrateInBackground applies the migrations of the store as Migrate does, without waiting for them, so that the
+// service can start serving while indexes are built on a large collection. Until the migrations finish, changes which
+// rely on the unique indexes return ErrIndexesBuilding, and the Monitor of the store describes the progress of the
+// builds. If the migrations fail, the Monitor reports the store as unhealthy and those changes keep failing.
+// The error of the migrations, or nil, is sent on the returned channel when they finish
+func (store *Store) MigrateInBackground(ctx context.Context) <-chan error {
+	store.mu.Lock()
+	store.building = true
+	store.mu.Unlock()
+	done := make(chan error, 1)
+	go func() {
+		_, err := store.Migrate(ctx)
+		store.mu.Lock()
+		store.building = false
+		store.migrateErr = err
+		store.mu.Unlock()
+		done <- err
+	}()
+	return done
+}
+
+// checkIndexesBuilt returns ErrIndexesBuilding if the migrations of the store are running, or failed, in the
+// background
+func (store *Store) checkIndexesBuilt() error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if store.building || store.migrateErr != nil {
+		return ErrIndexesBuilding
+	}
+	return nil
+}
+
+// migrationErr returns the error of the migrations run in the background, if they failed
+func (store *Store) migrationErr() error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.migrateErr
+}
+
+// isBuilding returns true while the migrations of the store run in the background
+func (store *Store) isBuilding() bool {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.building
+}
+
+// indexBuild is the part of an operation reported by the currentOp command which describes an index build
+type indexBuild struct {
+	Msg      string `bson:"msg"`
+	Progress struct {
+		Done  int64 `bson:"done"`
+		Total int64 `bson:"total"`
+	} `bson:"progress"`
+}
+
+// indexBuilds returns the index builds running on the collection of the store
+func (store *Store) indexBuilds(ctx context.Context) ([]indexBuild, error) {
+	var ops struct {
+		InProg []indexBuild `bson:"inprog"`
+	}
+	err := store.db.Client().Database("admin").RunCommand(ctx, bson.D{
+		{Key: "currentOp", Value: true},
+		{Key: "command.createIndexes", Value: store.options.Collection},
+		{Key: "ns", Value: store.db.Name() + "." + store.options.Collection},
+	}).Decode(&ops)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read index builds: %w", err)
+	}
+	return ops.InProg, nil
+}
+
+// MigrationRecorder is a migrate.Recorder which records migrations in a MongoDB database
+type MigrationRecorder struct {
+	migrations *mongo.Collection
+	lock       *mongo.Collection
+}
+
+// NewMigrationRecorder creates a new MigrationRecorder in db
+func NewMigrationRecorder(db *mongo.Database) *MigrationRecorder {
+	return &MigrationRecorder{
+		migrations: db.Collection(MigrationsCollectionName),
+		lock:       db.Collection(MigrationLockCollectionName),
+	}
+}
+
+// appliedMigration is the document recording an applied migration
+type appliedMigration struct {
+	Version   int64     `bson:"_id"`
+	Name      string    `bson:"name"`
+	AppliedAt time.Time `bson:"applied_at"`
+}
+
+// Lock takes the lock for owner. The lock document is only updated if its lock has expired or is already held by
+// owner, so when another owner holds it the upsert tries to insert a second document with the same id, which fails
+func (r *MigrationRecorder) Lock(ctx context.Context, owner string, expiresAt time.Time) error {
+	_, err := r.lock.UpdateOne(ctx,
+		bson.M{
+			"_id": migrationLockID,
+			"$or": bson.A{
+				bson.M{"expires_at": bson.M{"$lte": utctime.Now()}},
+				bson.M{"owner": owner},
+			},
+		},
+		bson.M{"$set": bson.M{"owner": owner, "expires_at": expiresAt}},
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return migrate.ErrLocked
+	}
+	if err != nil {
+		return fmt.Errorf("cannot take migration lock: %w", err)
+	}
+	return nil
+}
+
+// Unlock releases the lock if it is held by owner
+func (r *MigrationRecorder) Unlock(ctx context.Context, owner string) error {
+	_, err := r.lock.DeleteOne(ctx, bson.M{"_id": migrationLockID, "owner": owner})
+	if err != nil {
+		return fmt.Errorf("cannot release migration lock: %w", err)
+	}
+	return nil
+}
+
+// Applied returns the migrations which have been applied
+func (r *MigrationRecorder) Applied(ctx context.Context) ([]migrate.Applied, error) {
+	cur, err := r.migrations.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("cannot find applied migrations: %w", err)
+	}
+	var docs []appliedMigration
+	if err = cur.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("cannot read applied migrations: %w", err)
+	}
+	applied := make([]migrate.Applied, 0, len(docs))
+	for _, doc := range docs {
+		applied = append(applied, migrate.Applied{Version: doc.Version, Name: doc.Name, AppliedAt: doc.AppliedAt})
+	}
+	return applied, nil
+}
+
+// Record records that a migration has been applied
+func (r *MigrationRecorder) Record(ctx context.Context, applied migrate.Applied) error {
+	_, err := r.migrations.InsertOne(ctx, appliedMigration{
+		Version:   applied.Version,
+		Name:      applied.Name,
+		AppliedAt: applied.AppliedAt,
+	})
+	if err != nil {
+		return fmt.Errorf("cannot record migration: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package userstore_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/robotlovesyou/fitest/pkg/store/migrate"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/utctime"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// withRecorder calls f with a store and a recorder of the migrations of its database
+func withRecorder(f func(context.Context, *userstore.Store, *userstore.MigrationRecorder)) {
+	var recorder *userstore.MigrationRecorder
+	withStoreCreatedBy(func(db *mongo.Database) *userstore.Store {
+		recorder = userstore.NewMigrationRecorder(db)
+		return userstore.New(db, userstore.Options{})
+	}, func(ctx context.Context, store *userstore.Store) {
+		f(ctx, store, recorder)
+	})
+}
+
+func TestMigrationsAreRecordedAndOnlyAppliedOnce(t *testing.T) {
+	withRecorder(func(ctx context.Context, store *userstore.Store, recorder *userstore.MigrationRecorder) {
+		// the store has been migrated by withStore
+		applied, err := store.Migrate(ctx)
+		require.NoError(t, err)
+		require.Empty(t, applied)
+
+		recorded, err := recorder.Applied(ctx)
+		require.NoError(t, err)
+		require.Len(t, recorded, len(store.Migrations()))
+	})
+}
+
+func TestMigrationLockIsHeldByOneOwnerUntilItExpires(t *testing.T) {
+	withRecorder(func(ctx context.Context, _ *userstore.Store, recorder *userstore.MigrationRecorder) {
+		require.NoError(t, recorder.Lock(ctx, "first", utctime.Now().Add(time.Hour)))
+		require.NoError(t, recorder.Lock(ctx, "first", utctime.Now().Add(time.Hour)))
+		require.ErrorIs(t, recorder.Lock(ctx, "second", utctime.Now().Add(time.Hour)), migrate.ErrLocked)
+
+		require.NoError(t, recorder.Unlock(ctx, "second"))
+		require.ErrorIs(t, recorder.Lock(ctx, "second", utctime.Now().Add(time.Hour)), migrate.ErrLocked)
+
+		require.NoError(t, recorder.Unlock(ctx, "first"))
+		require.NoError(t, recorder.Lock(ctx, "second", utctime.Now().Add(-time.Second)))
+		// the lock of second has expired
+		require.NoError(t, recorder.Lock(ctx, "first", utctime.Now().Add(time.Hour)))
+	})
+}
+
+func TestChangesRelyingOnIndexesWaitForBackgroundMigrations(t *testing.T) {
+	withRecorder(func(ctx context.Context, store *userstore.Store, recorder *userstore.MigrationRecorder) {
+		// holding the lock keeps the background migrations waiting
+		require.NoError(t, recorder.Lock(ctx, "other", utctime.Now().Add(time.Hour)))
+		done := store.MigrateInBackground(ctx)
+		monitor := userstore.NewMonitor(store)
+
+		rec := fakeUserRecord()
+		_, err := store.Create(ctx, &rec)
+		require.ErrorIs(t, err, userstore.ErrIndexesBuilding)
+		require.NoError(t, monitor.Check(ctx))
+		require.NotEmpty(t, monitor.Describe(ctx))
+
+		require.NoError(t, recorder.Unlock(ctx, "other"))
+		require.NoError(t, <-done)
+		_, err = store.Create(ctx, &rec)
+		require.NoError(t, err)
+		require.NoError(t, monitor.Check(ctx))
+		// once the migrations are done, only the round trip is described
+		require.Regexp(t, "^round trip: [^,]+$", monitor.Describe(ctx))
+	})
+}
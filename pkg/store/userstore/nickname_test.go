@@ -0,0 +1,91 @@
+package userstore_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreCanChangeNickname(t *testing.T) {
+	rec := fakeUserRecord()
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		_, err := store.Create(ctx, &rec)
+		require.NoError(t, err)
+
+		updated, err := store.ChangeNickname(ctx, rec.ID, rec.Version, "renamed", time.Hour)
+		require.NoError(t, err)
+		require.Equal(t, "renamed", updated.Nickname)
+		require.Equal(t, rec.Version+1, updated.Version)
+
+		stored, err := store.ReadRecord(ctx, rec.ID)
+		require.NoError(t, err)
+		require.Equal(t, "renamed", stored.Data.Nickname)
+		require.Len(t, stored.PreviousNicknames, 1)
+		require.Equal(t, rec.Nickname, stored.PreviousNicknames[0].Nickname)
+		require.Equal(t, userstore.NicknameChanged, stored.Events[len(stored.Events)-1].Action)
+		require.Equal(t, updated.Version, stored.Events[len(stored.Events)-1].Version)
+
+		// the original nickname can be used again
+		other := fakeUserRecord(func(r *userstore.User) { r.Nickname = rec.Nickname })
+		_, err = store.Create(ctx, &other)
+		require.NoError(t, err)
+	})
+}
+
+func TestStoreCannotChangeNicknameBeforeCooldownHasPassed(t *testing.T) {
+	rec := fakeUserRecord()
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		_, err := store.Create(ctx, &rec)
+		require.NoError(t, err)
+		updated, err := store.ChangeNickname(ctx, rec.ID, rec.Version, "renamed", time.Hour)
+		require.NoError(t, err)
+
+		_, err = store.ChangeNickname(ctx, rec.ID, updated.Version, "renamed-again", time.Hour)
+		require.ErrorIs(t, err, userstore.ErrNicknameChangeTooSoon)
+
+		_, err = store.ChangeNickname(ctx, rec.ID, updated.Version, "renamed-again", 0)
+		require.NoError(t, err)
+		stored, err := store.ReadRecord(ctx, rec.ID)
+		require.NoError(t, err)
+		require.Len(t, stored.PreviousNicknames, 2)
+		require.Equal(t, "renamed", stored.PreviousNicknames[1].Nickname)
+	})
+}
+
+func TestStoreChangeNicknameReturnsCorrectErrors(t *testing.T) {
+	rec := fakeUserRecord()
+	other := fakeUserRecord()
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		createMany(ctx, []userstore.User{rec, other}, store)
+
+		_, err := store.ChangeNickname(ctx, uuid.New(), rec.Version, "renamed", time.Hour)
+		require.ErrorIs(t, err, userstore.ErrNotFound)
+		_, err = store.ChangeNickname(ctx, rec.ID, rec.Version+1, "renamed", time.Hour)
+		require.ErrorIs(t, err, userstore.ErrInvalidVersion)
+		_, err = store.ChangeNickname(ctx, rec.ID, rec.Version, other.Nickname, time.Hour)
+		require.ErrorIs(t, err, userstore.ErrNicknameInUse)
+	})
+}
+
+func TestAnonymizeRemovesPreviousNicknames(t *testing.T) {
+	rec := fakeUserRecord()
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		_, err := store.Create(ctx, &rec)
+		require.NoError(t, err)
+		updated, err := store.ChangeNickname(ctx, rec.ID, rec.Version, "renamed", time.Hour)
+		require.NoError(t, err)
+
+		anonymized := updated
+		anonymized.Nickname = "anonymized-" + rec.ID.String()
+		_, err = store.Anonymize(ctx, &anonymized)
+		require.NoError(t, err)
+
+		stored, err := store.ReadRecord(ctx, rec.ID)
+		require.NoError(t, err)
+		require.Empty(t, stored.PreviousNicknames)
+	})
+}
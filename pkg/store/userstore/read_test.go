@@ -3,9 +3,11 @@ package userstore_test
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/tenant"
 	"github.com/stretchr/testify/require"
 )
 
@@ -28,3 +30,76 @@ func TestReadOneReturnsNotFoundWhenRecordIsMissing(t *testing.T) {
 		require.ErrorIs(t, err, userstore.ErrNotFound)
 	})
 }
+
+func TestReadManyReturnsUsersInTheOrderRequested(t *testing.T) {
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		rec1 := fakeUserRecord()
+		rec2 := fakeUserRecord()
+		deleted := fakeUserRecord()
+		createMany(ctx, []userstore.User{rec1, rec2, deleted}, store)
+		require.NoError(t, store.DeleteOne(ctx, deleted.ID))
+
+		users, err := store.ReadMany(ctx, []uuid.UUID{rec2.ID, uuid.Must(uuid.NewRandom()), rec1.ID, deleted.ID})
+		require.NoError(t, err)
+		require.Len(t, users, 4)
+		require.Equal(t, []uuid.UUID{rec2.ID, uuid.Nil, rec1.ID, uuid.Nil}, []uuid.UUID{users[0].ID, users[1].ID, users[2].ID, users[3].ID})
+		compareUserRecords(t, rec2, users[0])
+
+		users, err = store.ReadMany(tenant.With(ctx, "acme"), []uuid.UUID{rec1.ID})
+		require.NoError(t, err)
+		require.Equal(t, []userstore.User{{}}, users, "users of other tenants are not read")
+	})
+}
+
+func TestFindByEmail(t *testing.T) {
+	rec := fakeUserRecord()
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		_, err := store.Create(ctx, &rec)
+		require.NoError(t, err)
+		read, err := store.FindByEmail(ctx, rec.Email)
+		require.NoError(t, err)
+		compareUserRecords(t, rec, read)
+	})
+}
+
+func TestFindByEmailReturnsNotFoundForDeletedRecord(t *testing.T) {
+	rec := fakeUserRecord()
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		_, err := store.Create(ctx, &rec)
+		require.NoError(t, err)
+		require.NoError(t, store.DeleteOne(ctx, rec.ID))
+		_, err = store.FindByEmail(ctx, rec.Email)
+		require.ErrorIs(t, err, userstore.ErrNotFound)
+	})
+}
+
+func TestFindByNickname(t *testing.T) {
+	rec := fakeUserRecord()
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		_, err := store.Create(ctx, &rec)
+		require.NoError(t, err)
+		read, err := store.FindByNickname(ctx, rec.Nickname)
+		require.NoError(t, err)
+		compareUserRecords(t, rec, read)
+
+		_, err = store.FindByNickname(ctx, "unknown")
+		require.ErrorIs(t, err, userstore.ErrNotFound)
+	})
+}
+
+func TestStoreCanReadWholeRecord(t *testing.T) {
+	rec := fakeUserRecord()
+	withSoftDeletingStore(time.Hour, func(ctx context.Context, store *userstore.Store) {
+		_, err := store.Create(ctx, &rec)
+		require.NoError(t, err)
+		require.NoError(t, store.DeleteOne(ctx, rec.ID))
+
+		read, err := store.ReadRecord(ctx, rec.ID)
+		require.NoError(t, err)
+		compareUserRecords(t, rec, *read.Data)
+		require.NotNil(t, read.DeletedAt)
+		require.Len(t, read.Events, 2)
+		require.Equal(t, userstore.Created, read.Events[0].Action)
+		require.Equal(t, userstore.Deleted, read.Events[1].Action)
+	})
+}
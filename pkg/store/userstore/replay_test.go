@@ -0,0 +1,50 @@
+package userstore_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreReplayAddsEventWithCurrentStateOfUser(t *testing.T) {
+	rec := fakeUserRecord()
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		_, err := store.Create(ctx, &rec)
+		require.NoError(t, err)
+
+		replayed, err := store.Replay(ctx, rec.ID)
+		require.NoError(t, err)
+		require.Equal(t, rec.Version, replayed.Version)
+
+		stored, err := store.ReadRecord(ctx, rec.ID)
+		require.NoError(t, err)
+		require.Equal(t, rec.Version, stored.Data.Version)
+		require.Len(t, stored.Events, 2)
+		require.Equal(t, userstore.Replayed, stored.Events[1].Action)
+		require.Equal(t, rec.Version, stored.Events[1].Version)
+		require.Equal(t, rec.Email, stored.Events[1].Data.Email)
+	})
+}
+
+func TestStoreReplayReturnsNotFoundForMissingUser(t *testing.T) {
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		_, err := store.Replay(ctx, uuid.New())
+		require.ErrorIs(t, err, userstore.ErrNotFound)
+	})
+}
+
+func TestStoreReplayReturnsNotFoundForSoftDeletedUser(t *testing.T) {
+	rec := fakeUserRecord()
+	withSoftDeletingStore(time.Hour, func(ctx context.Context, store *userstore.Store) {
+		_, err := store.Create(ctx, &rec)
+		require.NoError(t, err)
+		require.NoError(t, store.DeleteOne(ctx, rec.ID))
+
+		_, err = store.Replay(ctx, rec.ID)
+		require.ErrorIs(t, err, userstore.ErrNotFound)
+	})
+}
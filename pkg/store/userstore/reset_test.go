@@ -0,0 +1,73 @@
+package userstore_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/utctime"
+	"github.com/stretchr/testify/require"
+)
+
+func resetToken(hash string, expiresIn time.Duration) userstore.ResetToken {
+	return userstore.ResetToken{Hash: hash, ExpiresAt: utctime.Now().Add(expiresIn)}
+}
+
+func TestStoreCanResetPasswordWithToken(t *testing.T) {
+	rec := fakeUserRecord()
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		_, err := store.Create(ctx, &rec)
+		require.NoError(t, err)
+		require.NoError(t, store.RequestPasswordReset(ctx, rec.ID, "token", resetToken("tokenhash", time.Hour)))
+
+		updated, err := store.ResetPassword(ctx, "tokenhash", "newhash")
+		require.NoError(t, err)
+		require.Equal(t, "newhash", updated.PasswordHash)
+		require.Equal(t, rec.Version+1, updated.Version)
+
+		read, err := store.ReadOne(ctx, rec.ID)
+		require.NoError(t, err)
+		require.Equal(t, "newhash", read.PasswordHash)
+
+		// tokens can only be used once
+		_, err = store.ResetPassword(ctx, "tokenhash", "otherhash")
+		require.ErrorIs(t, err, userstore.ErrInvalidResetToken)
+	})
+}
+
+func TestStoreCannotResetPasswordWithExpiredToken(t *testing.T) {
+	rec := fakeUserRecord()
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		_, err := store.Create(ctx, &rec)
+		require.NoError(t, err)
+		require.NoError(t, store.RequestPasswordReset(ctx, rec.ID, "token", resetToken("tokenhash", -time.Second)))
+
+		_, err = store.ResetPassword(ctx, "tokenhash", "newhash")
+		require.ErrorIs(t, err, userstore.ErrInvalidResetToken)
+	})
+}
+
+func TestStoreCannotRequestPasswordResetForMissingUser(t *testing.T) {
+	rec := fakeUserRecord()
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		err := store.RequestPasswordReset(ctx, rec.ID, "token", resetToken("tokenhash", time.Hour))
+		require.ErrorIs(t, err, userstore.ErrNotFound)
+	})
+}
+
+func TestChangingPasswordRemovesResetToken(t *testing.T) {
+	rec := fakeUserRecord()
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		_, err := store.Create(ctx, &rec)
+		require.NoError(t, err)
+		require.NoError(t, store.RequestPasswordReset(ctx, rec.ID, "token", resetToken("tokenhash", time.Hour)))
+
+		rec.PasswordHash = "changedhash"
+		_, err = store.ChangePassword(ctx, &rec)
+		require.NoError(t, err)
+
+		_, err = store.ResetPassword(ctx, "tokenhash", "newhash")
+		require.ErrorIs(t, err, userstore.ErrInvalidResetToken)
+	})
+}
@@ -0,0 +1,324 @@
+package userstore
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/robotlovesyou/fitest/pkg/utctime"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+)
+
+const (
+	// maxRetryBackoff limits the time waited before each retry, however many times an operation has been retried.
+	// It should probably be configurable
+	maxRetryBackoff = 2 * time.Second
+	// retryBudgetTokens is the number of retries the budget holds when it is full, so that a store which has made few
+	// operations can still retry. It should probably be configurable
+	retryBudgetTokens = 10
+)
+
+// retryableCodes are the codes of server errors which are returned while a replica set elects a new primary or a
+// server shuts down, and which an operation can be retried after
+var retryableCodes = []int{
+	6,     // HostUnreachable
+	7,     // HostNotFound
+	89,    // NetworkTimeout
+	91,    // ShutdownInProgress
+	189,   // PrimarySteppedDown
+	9001,  // SocketException
+	10107, // NotWritablePrimary
+	11600, // InterruptedAtShutdown
+	11602, // InterruptedDueToReplStateChange
+	13435, // NotPrimaryNoSecondaryOk
+	13436, // NotPrimaryOrSecondary
+}
+
+// isRetryable returns true if err is transient, such as a network error or an error returned while a new primary is
+// elected, so that the operation which returned it can be retried
+func isRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if mongo.IsNetworkError(err) {
+		return true
+	}
+	var selectionErr topology.ServerSelectionError
+	if errors.As(err, &selectionErr) {
+		return !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, context.Canceled)
+	}
+	var serverErr mongo.ServerError
+	if !errors.As(err, &serverErr) {
+		return false
+	}
+	if serverErr.HasErrorLabel("RetryableWriteError") {
+		return true
+	}
+	for _, code := range retryableCodes {
+		if serverErr.HasErrorCode(code) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryBudget limits retries to a proportion of operations, so that retries do not multiply the load on a database
+// which is already failing. Each operation deposits ratio tokens, up to retryBudgetTokens, and each retry withdraws one
+type retryBudget struct {
+	mu     sync.Mutex
+	ratio  float64
+	tokens float64
+}
+
+// newRetryBudget creates a full retryBudget which allows ratio retries per operation
+func newRetryBudget(ratio float64) *retryBudget {
+	return &retryBudget{ratio: ratio, tokens: retryBudgetTokens}
+}
+
+// deposit records an operation
+func (b *retryBudget) deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens += b.ratio
+	if b.tokens > retryBudgetTokens {
+		b.tokens = retryBudgetTokens
+	}
+}
+
+// withdraw returns true if a retry can be made, and records it
+func (b *retryBudget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// retryCounts counts the retries of each operation, and the retries which were not made because the budget was spent
+type retryCounts struct {
+	mu      sync.Mutex
+	retried map[string]int64
+	denied  map[string]int64
+}
+
+func (c *retryCounts) add(counts map[string]int64, operation string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	counts[operation]++
+}
+
+// retrier retries operations which fail with transient errors, waiting for a jittered, exponentially increasing
+// backoff between attempts
+type retrier struct {
+	maxRetries int
+	backoff    time.Duration
+	budget     *retryBudget
+	counts     *retryCounts
+	mu         sync.Mutex
+	source     *rand.Rand
+}
+
+// newRetrier creates a retrier with the retry options of options
+func newRetrier(options Options) *retrier {
+	return &retrier{
+		maxRetries: options.MaxRetries,
+		backoff:    options.RetryBackoff,
+		budget:     newRetryBudget(options.RetryBudget),
+		counts:     &retryCounts{retried: make(map[string]int64), denied: make(map[string]int64)},
+		source:     rand.New(rand.NewSource(utctime.Now().UnixNano())),
+	}
+}
+
+// do calls f, named operation, retrying it while it fails with a retryable error until it has been retried
+// maxRetries times, the budget is spent or ctx is done. It must only be used for reads, which are safe to repeat.
+// Operations of a transaction are not retried, since a transient error aborts the transaction, which is retried as a
+// whole instead
+func (r *retrier) do(ctx context.Context, operation string, f func() error) error {
+	r.budget.deposit()
+	err := f()
+	if mongo.SessionFromContext(ctx) != nil {
+		return err
+	}
+	for attempt := 0; attempt < r.maxRetries && isRetryable(err); attempt++ {
+		if !r.budget.withdraw() {
+			r.counts.add(r.counts.denied, operation)
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(r.wait(attempt)):
+		}
+		r.counts.add(r.counts.retried, operation)
+		err = f()
+	}
+	return err
+}
+
+// wait returns the time to wait before retry attempt, which is chosen at random up to an exponentially increasing
+// limit, so that the retries of many operations which failed together are spread out
+func (r *retrier) wait(attempt int) time.Duration {
+	limit := r.backoff << attempt
+	if limit > maxRetryBackoff || limit <= 0 {
+		limit = maxRetryBackoff
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return time.Duration(r.source.Int63n(int64(limit)) + 1)
+}
+
+// retryingCollection is a mongo.Collection which retries the reads made by the store when they fail with transient
+// errors. Writes are not retried by the store, since a write which failed with a network error may still have been
+// applied, and repeating an insert, an increment or a push of an event would apply it twice. They are left to the
+// retryable writes of the driver, which the server recognises when they are repeated. Each operation is traced in a
+// span of its own, which includes its retries
+type retryingCollection struct {
+	*mongo.Collection
+	retrier *retrier
+}
+
+func (c *retryingCollection) Aggregate(ctx context.Context, pipeline interface{}, opts ...*options.AggregateOptions) (cur *mongo.Cursor, err error) {
+	ctx, span := c.startSpan(ctx, "Aggregate", pipeline)
+	defer func() { endSpan(span, err) }()
+	err = c.retrier.do(ctx, "Aggregate", func() error {
+		cur, err = c.Collection.Aggregate(ctx, pipeline, opts...)
+		return err
+	})
+	return cur, err
+}
+
+func (c *retryingCollection) BulkWrite(ctx context.Context, models []mongo.WriteModel, opts ...*options.BulkWriteOptions) (res *mongo.BulkWriteResult, err error) {
+	ctx, span := c.startSpan(ctx, "BulkWrite", nil)
+	defer func() { endSpan(span, err) }()
+	res, err = c.Collection.BulkWrite(ctx, models, opts...)
+	if res != nil {
+		span.SetAttributes(
+			matchedCountKey.Int64(res.MatchedCount),
+			modifiedCountKey.Int64(res.ModifiedCount),
+			insertedCountKey.Int64(res.InsertedCount+res.UpsertedCount),
+		)
+	}
+	return res, err
+}
+
+func (c *retryingCollection) CountDocuments(ctx context.Context, filter interface{}, opts ...*options.CountOptions) (count int64, err error) {
+	ctx, span := c.startSpan(ctx, "CountDocuments", filter)
+	defer func() { endSpan(span, err) }()
+	err = c.retrier.do(ctx, "CountDocuments", func() error {
+		count, err = c.Collection.CountDocuments(ctx, filter, opts...)
+		return err
+	})
+	span.SetAttributes(resultCountKey.Int64(count))
+	return count, err
+}
+
+func (c *retryingCollection) Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (cur *mongo.Cursor, err error) {
+	ctx, span := c.startSpan(ctx, "Find", filter)
+	defer func() { endSpan(span, err) }()
+	err = c.retrier.do(ctx, "Find", func() error {
+		cur, err = c.Collection.Find(ctx, filter, opts...)
+		return err
+	})
+	return cur, err
+}
+
+func (c *retryingCollection) FindOne(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) (res *mongo.SingleResult) {
+	ctx, span := c.startSpan(ctx, "FindOne", filter)
+	err := c.retrier.do(ctx, "FindOne", func() error {
+		res = c.Collection.FindOne(ctx, filter, opts...)
+		return res.Err()
+	})
+	span.SetAttributes(resultCountKey.Int(singleResultCount(err)))
+	endSpan(span, err)
+	return res
+}
+
+func (c *retryingCollection) FindOneAndUpdate(ctx context.Context, filter interface{}, update interface{}, opts ...*options.FindOneAndUpdateOptions) (res *mongo.SingleResult) {
+	ctx, span := c.startSpan(ctx, "FindOneAndUpdate", filter)
+	res = c.Collection.FindOneAndUpdate(ctx, filter, update, opts...)
+	err := res.Err()
+	span.SetAttributes(matchedCountKey.Int(singleResultCount(err)))
+	endSpan(span, err)
+	return res
+}
+
+func (c *retryingCollection) InsertMany(ctx context.Context, documents []interface{}, opts ...*options.InsertManyOptions) (res *mongo.InsertManyResult, err error) {
+	ctx, span := c.startSpan(ctx, "InsertMany", nil)
+	defer func() { endSpan(span, err) }()
+	res, err = c.Collection.InsertMany(ctx, documents, opts...)
+	if res != nil {
+		span.SetAttributes(insertedCountKey.Int(len(res.InsertedIDs)))
+	}
+	return res, err
+}
+
+func (c *retryingCollection) InsertOne(ctx context.Context, document interface{}, opts ...*options.InsertOneOptions) (res *mongo.InsertOneResult, err error) {
+	ctx, span := c.startSpan(ctx, "InsertOne", nil)
+	defer func() { endSpan(span, err) }()
+	res, err = c.Collection.InsertOne(ctx, document, opts...)
+	return res, err
+}
+
+func (c *retryingCollection) UpdateMany(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (res *mongo.UpdateResult, err error) {
+	ctx, span := c.startSpan(ctx, "UpdateMany", filter)
+	defer func() { endSpan(span, err) }()
+	res, err = c.Collection.UpdateMany(ctx, filter, update, opts...)
+	setUpdateAttributes(span, res)
+	return res, err
+}
+
+func (c *retryingCollection) UpdateOne(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (res *mongo.UpdateResult, err error) {
+	ctx, span := c.startSpan(ctx, "UpdateOne", filter)
+	defer func() { endSpan(span, err) }()
+	res, err = c.Collection.UpdateOne(ctx, filter, update, opts...)
+	setUpdateAttributes(span, res)
+	return res, err
+}
+
+// RetryCollector is a prometheus.Collector which reports the retries made by a store
+type RetryCollector struct {
+	counts  *retryCounts
+	retried *prometheus.Desc
+	denied  *prometheus.Desc
+}
+
+// NewRetryCollector creates a new RetryCollector for store
+func NewRetryCollector(store *Store) *RetryCollector {
+	return &RetryCollector{
+		counts: store.collection.retrier.counts,
+		retried: prometheus.NewDesc(
+			"users_store_retries_total",
+			"Count of retries of database operations which failed with transient errors, by operation",
+			[]string{"operation"}, nil,
+		),
+		denied: prometheus.NewDesc(
+			"users_store_retries_denied_total",
+			"Count of database operations which failed with transient errors and were not retried because the retry budget was spent, by operation",
+			[]string{"operation"}, nil,
+		),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *RetryCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.retried
+	ch <- c.denied
+}
+
+// Collect implements prometheus.Collector
+func (c *RetryCollector) Collect(ch chan<- prometheus.Metric) {
+	c.counts.mu.Lock()
+	defer c.counts.mu.Unlock()
+	for desc, counts := range map[*prometheus.Desc]map[string]int64{c.retried: c.counts.retried, c.denied: c.counts.denied} {
+		for operation, count := range counts {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, float64(count), operation)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package userstore_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// failFinds makes the next times finds of db fail with a PrimarySteppedDown error, as they do during an election.
+// It returns false if the server does not allow fail points to be set, which requires test commands to be enabled
+func failFinds(ctx context.Context, db *mongo.Database, times int) bool {
+	return failCommands(ctx, db, "find", times)
+}
+
+// failCommands makes the next times commands named command fail with a PrimarySteppedDown error
+func failCommands(ctx context.Context, db *mongo.Database, command string, times int) bool {
+	err := db.Client().Database("admin").RunCommand(ctx, bson.D{
+		{Key: "configureFailPoint", Value: "failCommand"},
+		{Key: "mode", Value: bson.M{"times": times}},
+		{Key: "data", Value: bson.M{"failCommands": bson.A{command}, "errorCode": 189}},
+	}).Err()
+	return err == nil
+}
+
+func TestOperationsWhichFailWithTransientErrorsAreRetried(t *testing.T) {
+	var db *mongo.Database
+	withStoreCreatedBy(func(d *mongo.Database) *userstore.Store {
+		db = d
+		return userstore.New(d, userstore.Options{})
+	}, func(ctx context.Context, store *userstore.Store) {
+		rec := fakeUserRecord()
+		_, err := store.Create(ctx, &rec)
+		require.NoError(t, err)
+
+		// the driver retries reads once itself, so the store retries the second failure
+		if !failFinds(ctx, db, 2) {
+			t.Skip("the server does not allow fail points to be set")
+		}
+		_, err = store.ReadOne(ctx, rec.ID)
+		require.NoError(t, err)
+
+		collector := userstore.NewRetryCollector(store)
+		require.Equal(t, 1, testutil.CollectAndCount(collector, "users_store_retries_total"))
+		require.Equal(t, 0, testutil.CollectAndCount(collector, "users_store_retries_denied_total"))
+	})
+}
+
+func TestOperationsAreNotRetriedWhenRetriesAreDisabled(t *testing.T) {
+	var db *mongo.Database
+	withStoreCreatedBy(func(d *mongo.Database) *userstore.Store {
+		db = d
+		return userstore.New(d, userstore.Options{MaxRetries: -1})
+	}, func(ctx context.Context, store *userstore.Store) {
+		rec := fakeUserRecord()
+		_, err := store.Create(ctx, &rec)
+		require.NoError(t, err)
+
+		if !failFinds(ctx, db, 2) {
+			t.Skip("the server does not allow fail points to be set")
+		}
+		_, err = store.ReadOne(ctx, rec.ID)
+		require.Error(t, err)
+		require.Equal(t, 0, testutil.CollectAndCount(userstore.NewRetryCollector(store), "users_store_retries_total"))
+	})
+}
+
+func TestWritesWhichFailWithTransientErrorsAreNotRetriedByTheStore(t *testing.T) {
+	var db *mongo.Database
+	withStoreCreatedBy(func(d *mongo.Database) *userstore.Store {
+		db = d
+		return userstore.New(d, userstore.Options{})
+	}, func(ctx context.Context, store *userstore.Store) {
+		rec := fakeUserRecord()
+		_, err := store.Create(ctx, &rec)
+		require.NoError(t, err)
+
+		// the driver retries a write once itself on a replica set, so the second failure is returned
+		if !failCommands(ctx, db, "update", 2) {
+			t.Skip("the server does not allow fail points to be set")
+		}
+		name := "Changed"
+		_, err = store.UpdateFields(ctx, rec.ID, rec.Version, &userstore.Change{FirstName: &name})
+		require.Error(t, err)
+		require.Equal(t, 0, testutil.CollectAndCount(userstore.NewRetryCollector(store), "users_store_retries_total"))
+	})
+}
@@ -0,0 +1,123 @@
+package userstore
+
+import (
+	"fmt"
+	"reflect"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/bson/bsonrw"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// RecordUpgrade upgrades a stored record from the schema version before Version to Version. Upgrades are applied as
+// records are read, rather than to every record at once by a migration, so that fields can be added to records
+// without rewriting the collection
+type RecordUpgrade struct {
+	Version int
+	Name    string
+	// Up changes doc, a stored record, to the schema of Version. Records can be read with a projection, so Up must
+	// leave doc unchanged when the fields it upgrades were not read. Records read without their schema version are
+	// upgraded from the first version, so Up must also leave records which already have the schema of Version unchanged
+	Up func(doc bson.M) error
+}
+
+// CurrentSchemaVersion is the schema version of the records written by the store. It is the version of the last of
+// the RecordUpgrades
+const CurrentSchemaVersion = 1
+
+var tRecord = reflect.TypeOf(Record{})
+
+// RecordUpgrades returns the upgrades of stored records, in order. Like migrations, upgrades are never changed or
+// removed once released, since records may have been written with any earlier schema version
+func RecordUpgrades() []RecordUpgrade {
+	return []RecordUpgrade{
+		{Version: 1, Name: "set the status of users stored before users had a status", Up: setDefaultStatus},
+	}
+}
+
+// setDefaultStatus sets the status of a user stored before users had a status, and of the users of its events, to
+// StatusActive, which users without a status are treated as
+func setDefaultStatus(doc bson.M) error {
+	setStatus := func(data interface{}) {
+		if user, ok := data.(bson.M); ok {
+			if _, ok := user["status"]; !ok {
+				user["status"] = string(StatusActive)
+			}
+		}
+	}
+	setStatus(doc["data"])
+	if events, ok := doc["events"].(bson.A); ok {
+		for _, e := range events {
+			if evt, ok := e.(bson.M); ok {
+				setStatus(evt["data"])
+			}
+		}
+	}
+	return nil
+}
+
+// decodeRecord decodes a record, applying the RecordUpgrades with a later version than the schema version it was
+// stored with. Upgraded records have the CurrentSchemaVersion, so that they are written with it if they are stored
+// whole again
+func decodeRecord(dc bsoncodec.DecodeContext, vr bsonrw.ValueReader, val reflect.Value) error {
+	if !val.CanSet() || val.Type() != tRecord {
+		return bsoncodec.ValueDecoderError{Name: "RecordDecodeValue", Types: []reflect.Type{tRecord}, Received: val}
+	}
+	if vr.Type() == bsontype.Null {
+		val.Set(reflect.Zero(tRecord))
+		return vr.ReadNull()
+	}
+	raw, err := bsonrw.Copier{}.CopyDocumentToBytes(vr)
+	if err != nil {
+		return err
+	}
+	version, err := schemaVersion(raw)
+	if err != nil {
+		return err
+	}
+	if version < CurrentSchemaVersion {
+		if raw, err = upgradeRecord(dc.Registry, raw, version); err != nil {
+			return err
+		}
+	}
+
+	type plain Record // plain does not have a registered decoder, so it is decoded as a struct
+	var rec plain
+	if err = bson.UnmarshalWithRegistry(dc.Registry, raw, &rec); err != nil {
+		return err
+	}
+	val.Set(reflect.ValueOf(Record(rec)))
+	return nil
+}
+
+// schemaVersion returns the schema version of the record raw, which is 0 for records stored before records had one
+func schemaVersion(raw bson.Raw) (int, error) {
+	stored, err := raw.LookupErr("schema_version")
+	if err != nil {
+		return 0, nil
+	}
+	version, ok := stored.AsInt64OK()
+	if !ok {
+		return 0, fmt.Errorf("cannot decode schema version of type %v", stored.Type)
+	}
+	return int(version), nil
+}
+
+// upgradeRecord applies the RecordUpgrades with a later version than version to the record raw
+func upgradeRecord(registry *bsoncodec.Registry, raw bson.Raw, version int) (bson.Raw, error) {
+	var doc bson.M
+	if err := bson.UnmarshalWithRegistry(registry, raw, &doc); err != nil {
+		return nil, err
+	}
+	for _, upgrade := range RecordUpgrades() {
+		if upgrade.Version <= version {
+			continue
+		}
+		if err := upgrade.Up(doc); err != nil {
+			return nil, fmt.Errorf("cannot upgrade record to schema version %d (%s): %w", upgrade.Version, upgrade.Name, err)
+		}
+	}
+	doc["schema_version"] = CurrentSchemaVersion
+	return bson.MarshalWithRegistry(registry, doc)
+}
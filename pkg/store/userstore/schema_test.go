@@ -0,0 +1,78 @@
+package userstore_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/tenant"
+	"github.com/robotlovesyou/fitest/pkg/utctime"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestCurrentSchemaVersionIsTheVersionOfTheLastUpgrade(t *testing.T) {
+	upgrades := userstore.RecordUpgrades()
+	for i, upgrade := range upgrades {
+		require.Equal(t, i+1, upgrade.Version, "upgrades are numbered in order from 1")
+	}
+	require.Equal(t, userstore.CurrentSchemaVersion, upgrades[len(upgrades)-1].Version)
+}
+
+func TestRecordsAreWrittenWithTheCurrentSchemaVersion(t *testing.T) {
+	var db *mongo.Database
+	withStoreCreatedBy(func(d *mongo.Database) *userstore.Store {
+		db = d
+		return userstore.New(d, userstore.Options{})
+	}, func(ctx context.Context, store *userstore.Store) {
+		rec := fakeUserRecord()
+		_, err := store.Create(ctx, &rec)
+		require.NoError(t, err)
+
+		raw, err := db.Collection(userstore.CollectionName).FindOne(ctx, bson.M{}).DecodeBytes()
+		require.NoError(t, err)
+		require.Equal(t, int64(userstore.CurrentSchemaVersion), raw.Lookup("schema_version").AsInt64())
+	})
+}
+
+func TestRecordsWithAnOlderSchemaVersionAreUpgradedAsTheyAreRead(t *testing.T) {
+	var db *mongo.Database
+	withStoreCreatedBy(func(d *mongo.Database) *userstore.Store {
+		db = d
+		return userstore.New(d, userstore.Options{})
+	}, func(ctx context.Context, store *userstore.Store) {
+		rec := fakeUserRecord()
+		// a user stored before records had a schema version, or users had a status
+		_, err := db.Collection(userstore.CollectionName).InsertOne(ctx, bson.M{
+			"_id":    rec.ID,
+			"tenant": tenant.Default,
+			"data": bson.M{
+				"id":         rec.ID,
+				"first_name": rec.FirstName,
+				"last_name":  rec.LastName,
+				"nickname":   rec.Nickname,
+				"email":      rec.Email,
+				"country":    rec.Country,
+				"created_at": utctime.Now(),
+				"updated_at": utctime.Now(),
+				"version":    rec.Version,
+			},
+			"events": bson.A{},
+		})
+		require.NoError(t, err)
+
+		read, err := store.ReadOne(ctx, rec.ID)
+		require.NoError(t, err)
+		require.Equal(t, userstore.StatusActive, read.Status)
+		record, err := store.ReadRecord(ctx, rec.ID)
+		require.NoError(t, err)
+		require.Equal(t, userstore.CurrentSchemaVersion, record.SchemaVersion)
+
+		// the stored record is not changed by reading it
+		raw, err := db.Collection(userstore.CollectionName).FindOne(ctx, bson.M{}).DecodeBytes()
+		require.NoError(t, err)
+		_, err = raw.LookupErr("schema_version")
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,128 @@
+package userstore_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/utctime"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSoftDeletedRecordsAreNotRead(t *testing.T) {
+	rec := fakeUserRecord()
+	withSoftDeletingStore(time.Hour, func(ctx context.Context, store *userstore.Store) {
+		_, err := store.Create(ctx, &rec)
+		require.NoError(t, err)
+		require.NoError(t, store.DeleteOne(ctx, rec.ID))
+
+		_, err = store.ReadOne(ctx, rec.ID)
+		require.ErrorIs(t, err, userstore.ErrNotFound)
+		_, err = store.FindByEmail(ctx, rec.Email)
+		require.ErrorIs(t, err, userstore.ErrNotFound)
+		page, err := store.FindMany(ctx, &userstore.Query{Length: 10, Page: 1})
+		require.NoError(t, err)
+		require.Empty(t, page.Items)
+		require.ErrorIs(t, store.DeleteOne(ctx, rec.ID), userstore.ErrNotFound)
+	})
+}
+
+func TestStoreCanRestoreSoftDeletedRecord(t *testing.T) {
+	rec := fakeUserRecord()
+	withSoftDeletingStore(time.Hour, func(ctx context.Context, store *userstore.Store) {
+		_, err := store.Create(ctx, &rec)
+		require.NoError(t, err)
+		deleted, err := store.DeleteMany(ctx, []uuid.UUID{rec.ID})
+		require.NoError(t, err)
+		require.Equal(t, []uuid.UUID{rec.ID}, deleted)
+
+		restored, err := store.Restore(ctx, rec.ID)
+		require.NoError(t, err)
+		compareUserRecords(t, rec, restored)
+		require.Equal(t, rec.Version+1, restored.Version)
+
+		read, err := store.ReadOne(ctx, rec.ID)
+		require.NoError(t, err)
+		require.Equal(t, restored.Version, read.Version)
+
+		_, err = store.Restore(ctx, rec.ID)
+		require.ErrorIs(t, err, userstore.ErrNotFound)
+	})
+}
+
+func TestSoftDeletedRecordsKeepTheirEmailAddress(t *testing.T) {
+	rec := fakeUserRecord()
+	withSoftDeletingStore(time.Hour, func(ctx context.Context, store *userstore.Store) {
+		_, err := store.Create(ctx, &rec)
+		require.NoError(t, err)
+		require.NoError(t, store.DeleteOne(ctx, rec.ID))
+
+		other := fakeUserRecord(func(r *userstore.User) { r.Email = rec.Email })
+		_, err = store.Create(ctx, &other)
+		require.ErrorIs(t, err, userstore.ErrAlreadyExists)
+	})
+}
+
+func TestStoreCannotRestoreRecordAfterRetention(t *testing.T) {
+	rec := fakeUserRecord()
+	withSoftDeletingStore(time.Millisecond, func(ctx context.Context, store *userstore.Store) {
+		_, err := store.Create(ctx, &rec)
+		require.NoError(t, err)
+		require.NoError(t, store.DeleteOne(ctx, rec.ID))
+		time.Sleep(10 * time.Millisecond)
+
+		_, err = store.Restore(ctx, rec.ID)
+		require.ErrorIs(t, err, userstore.ErrNotFound)
+
+		purged, err := store.Purge(ctx)
+		require.NoError(t, err)
+		require.Equal(t, int64(1), purged)
+
+		// once purged, the email address can be used again
+		other := fakeUserRecord(func(r *userstore.User) { r.Email = rec.Email })
+		_, err = store.Create(ctx, &other)
+		require.NoError(t, err)
+	})
+}
+
+func TestStoreCannotRestoreHardDeletedRecord(t *testing.T) {
+	rec := fakeUserRecord()
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		_, err := store.Create(ctx, &rec)
+		require.NoError(t, err)
+		require.NoError(t, store.DeleteOne(ctx, rec.ID))
+
+		_, err = store.Restore(ctx, rec.ID)
+		require.ErrorIs(t, err, userstore.ErrNotFound)
+		purged, err := store.Purge(ctx)
+		require.NoError(t, err)
+		require.Zero(t, purged)
+	})
+}
+
+func TestPurgeDeletedBeforeOnlyPurgesUsersDeletedBeforeTheCutoff(t *testing.T) {
+	withSoftDeletingStore(time.Hour, func(ctx context.Context, store *userstore.Store) {
+		earlier := fakeUserRecord()
+		later := fakeUserRecord()
+		createMany(ctx, []userstore.User{earlier, later}, store)
+
+		require.NoError(t, store.DeleteOne(ctx, earlier.ID))
+		time.Sleep(10 * time.Millisecond)
+		cutoff := utctime.Now()
+		time.Sleep(10 * time.Millisecond)
+		require.NoError(t, store.DeleteOne(ctx, later.ID))
+
+		purged, err := store.PurgeDeletedBefore(ctx, cutoff)
+		require.NoError(t, err)
+		require.Equal(t, int64(1), purged)
+
+		exists, err := store.EmailExists(ctx, earlier.Email)
+		require.NoError(t, err)
+		require.False(t, exists)
+		exists, err = store.EmailExists(ctx, later.Email)
+		require.NoError(t, err)
+		require.True(t, exists)
+	})
+}
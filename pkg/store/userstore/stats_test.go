@@ -0,0 +1,62 @@
+package userstore_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreCountsUsersByCountryAndSignupDay(t *testing.T) {
+	day := time.Date(2022, 4, 4, 0, 0, 0, 0, time.UTC)
+	users := []userstore.User{
+		fakeUserRecord(func(u *userstore.User) { u.Country = "NL"; u.CreatedAt = day.Add(time.Hour) }),
+		fakeUserRecord(func(u *userstore.User) { u.Country = "DE"; u.CreatedAt = day.Add(2 * time.Hour) }),
+		fakeUserRecord(func(u *userstore.User) { u.Country = "NL"; u.CreatedAt = day.Add(26 * time.Hour) }),
+		fakeUserRecord(func(u *userstore.User) { u.Country = "FR"; u.CreatedAt = day.Add(50 * time.Hour) }),
+	}
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		createMany(ctx, users, store)
+		stats, err := store.Stats(ctx, &userstore.Query{Countries: []string{"DE", "NL"}}, userstore.IntervalDay)
+		require.NoError(t, err)
+		require.Equal(t, int64(3), stats.Total)
+		require.Equal(t, []userstore.CountryCount{{Country: "DE", Total: 1}, {Country: "NL", Total: 2}}, stats.Countries)
+		require.Len(t, stats.Signups, 2)
+		require.True(t, day.Equal(stats.Signups[0].Start))
+		require.Equal(t, int64(2), stats.Signups[0].Total)
+		require.True(t, day.Add(24*time.Hour).Equal(stats.Signups[1].Start))
+		require.Equal(t, int64(1), stats.Signups[1].Total)
+	})
+}
+
+func TestStoreCountsSignupsByWeekStartingOnMonday(t *testing.T) {
+	monday := time.Date(2022, 4, 4, 0, 0, 0, 0, time.UTC)
+	users := []userstore.User{
+		fakeUserRecord(func(u *userstore.User) { u.CreatedAt = monday.Add(-time.Hour) }),
+		fakeUserRecord(func(u *userstore.User) { u.CreatedAt = monday.Add(time.Hour) }),
+		fakeUserRecord(func(u *userstore.User) { u.CreatedAt = monday.Add(6 * 24 * time.Hour) }),
+	}
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		createMany(ctx, users, store)
+		stats, err := store.Stats(ctx, &userstore.Query{}, userstore.IntervalWeek)
+		require.NoError(t, err)
+		require.Equal(t, int64(3), stats.Total)
+		require.Len(t, stats.Signups, 2)
+		require.True(t, monday.Add(-7*24*time.Hour).Equal(stats.Signups[0].Start))
+		require.Equal(t, int64(1), stats.Signups[0].Total)
+		require.True(t, monday.Equal(stats.Signups[1].Start))
+		require.Equal(t, int64(2), stats.Signups[1].Total)
+	})
+}
+
+func TestStoreStatsAreEmptyWhenNoUsersMatch(t *testing.T) {
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		stats, err := store.Stats(ctx, &userstore.Query{Countries: []string{"NL"}}, userstore.IntervalMonth)
+		require.NoError(t, err)
+		require.Zero(t, stats.Total)
+		require.Empty(t, stats.Countries)
+		require.Empty(t, stats.Signups)
+	})
+}
@@ -0,0 +1,85 @@
+package userstore_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreCanChangeStatus(t *testing.T) {
+	rec := fakeUserRecord()
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		_, err := store.Create(ctx, &rec)
+		require.NoError(t, err)
+		suspended := rec
+		suspended.Status = userstore.StatusSuspended
+		suspended.FirstName = "ignored"
+
+		updated, err := store.ChangeStatus(ctx, &suspended)
+		require.NoError(t, err)
+		require.Equal(t, userstore.StatusSuspended, updated.Status)
+		require.Equal(t, rec.FirstName, updated.FirstName)
+		require.Equal(t, rec.Version+1, updated.Version)
+
+		read, err := store.ReadRecord(ctx, rec.ID)
+		require.NoError(t, err)
+		require.Equal(t, userstore.Suspended, read.Events[len(read.Events)-1].Action)
+	})
+}
+
+func TestStoreCannotChangeToUnknownStatus(t *testing.T) {
+	rec := fakeUserRecord()
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		_, err := store.Create(ctx, &rec)
+		require.NoError(t, err)
+		update := rec
+		update.Status = "unknown"
+		_, err = store.ChangeStatus(ctx, &update)
+		require.ErrorIs(t, err, userstore.ErrInvalidStatus)
+	})
+}
+
+func TestUpdateDoesNotChangeStatus(t *testing.T) {
+	rec := fakeUserRecord()
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		_, err := store.Create(ctx, &rec)
+		require.NoError(t, err)
+		update := rec
+		update.Status = userstore.StatusBanned
+		updated, err := store.UpdateOne(ctx, &update)
+		require.NoError(t, err)
+		require.Equal(t, rec.Status, updated.Status)
+	})
+}
+
+func TestCanFindUsersByStatus(t *testing.T) {
+	users := []userstore.User{
+		// users stored before users had a status are active
+		fakeUserRecord(),
+		fakeUserRecord(func(u *userstore.User) { u.Status = userstore.StatusActive }),
+		fakeUserRecord(func(u *userstore.User) { u.Status = userstore.StatusSuspended }),
+		fakeUserRecord(func(u *userstore.User) { u.Status = userstore.StatusBanned }),
+	}
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		createMany(ctx, users, store)
+		cases := []struct {
+			status   userstore.Status
+			expected []userstore.User
+		}{
+			{status: "", expected: users},
+			{status: userstore.StatusActive, expected: users[:2]},
+			{status: userstore.StatusSuspended, expected: users[2:3]},
+			{status: userstore.StatusBanned, expected: users[3:]},
+		}
+		for _, c := range cases {
+			page, err := store.FindMany(ctx, &userstore.Query{Page: 1, Length: 10, Status: c.status})
+			require.NoError(t, err)
+			require.Len(t, page.Items, len(c.expected))
+			for i, itm := range page.Items {
+				compareUserRecords(t, c.expected[i], itm)
+			}
+		}
+	})
+}
@@ -0,0 +1,39 @@
+package userstore_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/robotlovesyou/fitest/pkg/store/storetest"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestStoreConformsToTheSuite(t *testing.T) {
+	storetest.Run(t, func(t *testing.T, retention time.Duration) storetest.Store {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		uri, dbName := testURI()
+		client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+		require.NoError(t, err)
+		db := client.Database(dbName)
+		t.Cleanup(func() {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			db.Drop(ctx)
+			client.Disconnect(ctx)
+		})
+
+		store := userstore.New(db, userstore.Options{})
+		if retention != 0 {
+			store = userstore.NewWithRetention(db, retention, userstore.Options{})
+		}
+		_, err = store.Migrate(ctx)
+		require.NoError(t, err)
+		return store
+	})
+}
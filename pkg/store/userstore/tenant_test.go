@@ -0,0 +1,57 @@
+package userstore_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/tenant"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsersOfDifferentTenantsCanShareEmailAndNickname(t *testing.T) {
+	userA := fakeUserRecord()
+	userB := fakeUserRecord(func(u *userstore.User) {
+		u.Email = userA.Email
+		u.Nickname = userA.Nickname
+	})
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		_, err := store.Create(tenant.With(ctx, "acme"), &userA)
+		require.NoError(t, err)
+		_, err = store.Create(tenant.With(ctx, "other"), &userB)
+		require.NoError(t, err)
+	})
+}
+
+func TestUsersCannotBeReadByOtherTenants(t *testing.T) {
+	rec := fakeUserRecord()
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		_, err := store.Create(tenant.With(ctx, "acme"), &rec)
+		require.NoError(t, err)
+
+		_, err = store.ReadOne(tenant.With(ctx, "other"), rec.ID)
+		require.ErrorIs(t, err, userstore.ErrNotFound)
+		_, err = store.ReadOne(ctx, rec.ID)
+		require.ErrorIs(t, err, userstore.ErrNotFound)
+		require.ErrorIs(t, store.DeleteOne(tenant.With(ctx, "other"), rec.ID), userstore.ErrNotFound)
+
+		read, err := store.ReadOne(tenant.With(ctx, "acme"), rec.ID)
+		require.NoError(t, err)
+		compareUserRecords(t, rec, read)
+	})
+}
+
+func TestFindOnlyReturnsUsersOfTheTenant(t *testing.T) {
+	users := []userstore.User{fakeUserRecord(), fakeUserRecord()}
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		_, err := store.Create(tenant.With(ctx, "acme"), &users[0])
+		require.NoError(t, err)
+		_, err = store.Create(tenant.With(ctx, "other"), &users[1])
+		require.NoError(t, err)
+
+		page, err := store.FindMany(tenant.With(ctx, "acme"), &userstore.Query{Length: 10, Page: 1})
+		require.NoError(t, err)
+		require.Equal(t, int64(1), page.Total)
+		require.Equal(t, users[0].ID, page.Items[0].ID)
+	})
+}
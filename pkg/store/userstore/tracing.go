@@ -0,0 +1,151 @@
+package userstore
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/robotlovesyou/fitest/pkg/telemetry"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The attributes of the spans of database operations
+const (
+	systemKey        = attribute.Key("db.system")
+	operationKey     = attribute.Key("db.operation")
+	collectionKey    = attribute.Key("db.mongodb.collection")
+	filterShapeKey   = attribute.Key("db.mongodb.filter_shape")
+	matchedCountKey  = attribute.Key("db.mongodb.matched_count")
+	modifiedCountKey = attribute.Key("db.mongodb.modified_count")
+	insertedCountKey = attribute.Key("db.mongodb.inserted_count")
+	// resultCountKey is the number of documents counted or returned by an operation, or of users or events returned
+	// by a store operation
+	resultCountKey = attribute.Key("db.result_count")
+)
+
+// startSpan starts the span of a single database operation of c, named after the collection and the operation, so that
+// slow queries can be found within the span of the store operation which made them. The shape of filter is recorded
+// instead of the filter itself, so that the data of users is not recorded
+func (c *retryingCollection) startSpan(ctx context.Context, operation string, filter interface{}) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{
+		systemKey.String("mongodb"),
+		operationKey.String(operation),
+		collectionKey.String(c.Name()),
+	}
+	if filter != nil {
+		attrs = append(attrs, filterShapeKey.String(filterShape(filter)))
+	}
+	return otel.Tracer(telemetry.TraceName).Start(ctx, c.Name()+"."+operation, trace.WithAttributes(attrs...))
+}
+
+// endSpan ends the span of a database operation which returned err. Finding no documents is not an error of the
+// operation, since the store returns ErrNotFound for it
+func endSpan(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+// setUpdateAttributes records the number of documents matched and modified by an update, if it was made
+func setUpdateAttributes(span trace.Span, res *mongo.UpdateResult) {
+	if res == nil {
+		return
+	}
+	span.SetAttributes(
+		matchedCountKey.Int64(res.MatchedCount),
+		modifiedCountKey.Int64(res.ModifiedCount),
+		insertedCountKey.Int64(res.UpsertedCount),
+	)
+}
+
+// singleResultCount returns the number of documents found by an operation which returns a single result and err
+func singleResultCount(err error) int {
+	if err != nil {
+		return 0
+	}
+	return 1
+}
+
+// filterShape describes the fields and operators of filter, with each value replaced by ?. Filters which differ only
+// in their values have the same shape, e.g. {_id: ?, tenant: ?, data.country: {$in: [?]}}
+func filterShape(filter interface{}) string {
+	var b strings.Builder
+	writeShape(&b, filter)
+	return b.String()
+}
+
+// writeShape writes the shape of value to b. The fields of maps are sorted, so that their shape does not depend on
+// the order of iteration, while the fields of documents keep their order
+func writeShape(b *strings.Builder, value interface{}) {
+	if doc, ok := value.(bson.D); ok {
+		b.WriteString("{")
+		for i, e := range doc {
+			writeField(b, i, e.Key, e.Value)
+		}
+		b.WriteString("}")
+		return
+	}
+
+	v := reflect.ValueOf(value)
+	switch {
+	case v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String:
+		keys := make([]string, 0, v.Len())
+		for _, k := range v.MapKeys() {
+			keys = append(keys, k.String())
+		}
+		sort.Strings(keys)
+		b.WriteString("{")
+		for i, k := range keys {
+			writeField(b, i, k, v.MapIndex(reflect.ValueOf(k).Convert(v.Type().Key())).Interface())
+		}
+		b.WriteString("}")
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8:
+		// arrays of values have the same shape whatever their length, but each document of an array is described
+		b.WriteString("[")
+		written := 0
+		for i := 0; i < v.Len(); i++ {
+			elem := v.Index(i).Interface()
+			if !isDocument(elem) {
+				continue
+			}
+			if written > 0 {
+				b.WriteString(", ")
+			}
+			writeShape(b, elem)
+			written++
+		}
+		if written == 0 && v.Len() > 0 {
+			b.WriteString("?")
+		}
+		b.WriteString("]")
+	default:
+		b.WriteString("?")
+	}
+}
+
+// writeField writes the ith field of a document, named key, to b
+func writeField(b *strings.Builder, i int, key string, value interface{}) {
+	if i > 0 {
+		b.WriteString(", ")
+	}
+	b.WriteString(key)
+	b.WriteString(": ")
+	writeShape(b, value)
+}
+
+// isDocument returns true if value is a document or an array, rather than a single value
+func isDocument(value interface{}) bool {
+	if _, ok := value.(bson.D); ok {
+		return true
+	}
+	v := reflect.ValueOf(value)
+	return (v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String) ||
+		(v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8)
+}
@@ -0,0 +1,105 @@
+package userstore_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/embedded"
+)
+
+// recordingProvider is a trace.TracerProvider which records the names and attributes of the spans which are ended
+type recordingProvider struct {
+	embedded.TracerProvider
+	mtx   sync.Mutex
+	spans map[string][]map[attribute.Key]attribute.Value
+}
+
+func (p *recordingProvider) Tracer(string, ...trace.TracerOption) trace.Tracer {
+	return &recordingTracer{provider: p}
+}
+
+// recordingTracer is a trace.Tracer which starts spans recorded by its provider
+type recordingTracer struct {
+	embedded.Tracer
+	provider *recordingProvider
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	span := &recordingSpan{
+		Span:     trace.SpanFromContext(context.Background()),
+		provider: t.provider,
+		name:     name,
+		attrs:    make(map[attribute.Key]attribute.Value),
+	}
+	config := trace.NewSpanStartConfig(opts...)
+	span.SetAttributes(config.Attributes()...)
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+// ended returns the attributes of each ended span named name
+func (p *recordingProvider) ended(name string) []map[attribute.Key]attribute.Value {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	return p.spans[name]
+}
+
+type recordingSpan struct {
+	trace.Span
+	provider *recordingProvider
+	name     string
+	attrs    map[attribute.Key]attribute.Value
+}
+
+func (s *recordingSpan) SetAttributes(kv ...attribute.KeyValue) {
+	for _, attr := range kv {
+		s.attrs[attr.Key] = attr.Value
+	}
+}
+
+func (s *recordingSpan) End(...trace.SpanEndOption) {
+	s.provider.mtx.Lock()
+	defer s.provider.mtx.Unlock()
+	s.provider.spans[s.name] = append(s.provider.spans[s.name], s.attrs)
+}
+
+func TestDatabaseOperationsAreTracedWithTheShapeOfTheirFilters(t *testing.T) {
+	provider := &recordingProvider{spans: make(map[string][]map[attribute.Key]attribute.Value)}
+	otel.SetTracerProvider(provider)
+
+	rec := fakeUserRecord(func(u *userstore.User) { u.Country = "NL" })
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		_, err := store.Create(ctx, &rec)
+		require.NoError(t, err)
+		_, err = store.ReadOne(ctx, rec.ID)
+		require.NoError(t, err)
+		page, err := store.FindMany(ctx, &userstore.Query{Countries: []string{"NL"}, Length: 10, Page: 1})
+		require.NoError(t, err)
+		require.Len(t, page.Items, 1)
+	})
+
+	reads := provider.ended(userstore.CollectionName + ".FindOne")
+	require.NotEmpty(t, reads)
+	read := reads[len(reads)-1]
+	require.Equal(t, "mongodb", read["db.system"].AsString())
+	require.Equal(t, userstore.CollectionName, read["db.mongodb.collection"].AsString())
+	require.Equal(t, int64(1), read["db.result_count"].AsInt64())
+	shape := read["db.mongodb.filter_shape"].AsString()
+	require.Contains(t, shape, "_id: ?")
+	require.Contains(t, shape, "tenant: ?")
+	require.False(t, strings.Contains(shape, rec.ID.String()), "the filter values are not recorded")
+
+	finds := provider.ended(userstore.CollectionName + ".Find")
+	require.NotEmpty(t, finds)
+	require.Contains(t, finds[len(finds)-1]["db.mongodb.filter_shape"].AsString(), "data.country: {$in: [?]}")
+
+	pages := provider.ended("FindUserRecords")
+	require.NotEmpty(t, pages)
+	require.Equal(t, int64(1), pages[len(pages)-1]["db.result_count"].AsInt64())
+}
@@ -0,0 +1,107 @@
+package userstore_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/stretchr/testify/require"
+)
+
+// withTwoFactorEnabled creates a user with two factor authentication enabled, with the secret "sealed", the last
+// step 10 and the recovery code hashes "code1" and "code2"
+func withTwoFactorEnabled(t *testing.T, f func(ctx context.Context, store *userstore.Store, usr userstore.User)) {
+	rec := fakeUserRecord()
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		_, err := store.Create(ctx, &rec)
+		require.NoError(t, err)
+		require.NoError(t, store.BeginTwoFactor(ctx, rec.ID, "sealed"))
+		usr, err := store.EnableTwoFactor(ctx, rec.ID, "sealed", 10, []string{"code1", "code2"})
+		require.NoError(t, err)
+		f(ctx, store, usr)
+	})
+}
+
+func TestEnableTwoFactorStoresSecretsAndAddsEvent(t *testing.T) {
+	withTwoFactorEnabled(t, func(ctx context.Context, store *userstore.Store, usr userstore.User) {
+		require.True(t, usr.TwoFactorEnabled)
+		require.Equal(t, int64(2), usr.Version)
+
+		stored, err := store.ReadRecord(ctx, usr.ID)
+		require.NoError(t, err)
+		require.True(t, stored.Data.TwoFactorEnabled)
+		require.Equal(t, userstore.TwoFactor{Secret: "sealed", LastStep: 10, RecoveryCodes: []string{"code1", "code2"}}, *stored.TwoFactor)
+		require.Len(t, stored.Events, 2)
+		require.Equal(t, userstore.TwoFactorEnabled, stored.Events[1].Action)
+	})
+}
+
+func TestBeginTwoFactorFailsWhenEnabledOrUserIsMissing(t *testing.T) {
+	withTwoFactorEnabled(t, func(ctx context.Context, store *userstore.Store, usr userstore.User) {
+		require.ErrorIs(t, store.BeginTwoFactor(ctx, usr.ID, "other"), userstore.ErrTwoFactorEnabled)
+		require.ErrorIs(t, store.BeginTwoFactor(ctx, uuid.Must(uuid.NewRandom()), "other"), userstore.ErrNotFound)
+	})
+}
+
+func TestEnableTwoFactorFailsWhenEnrollmentWasReplaced(t *testing.T) {
+	rec := fakeUserRecord()
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		_, err := store.Create(ctx, &rec)
+		require.NoError(t, err)
+		require.NoError(t, store.BeginTwoFactor(ctx, rec.ID, "first"))
+		require.NoError(t, store.BeginTwoFactor(ctx, rec.ID, "second"))
+
+		_, err = store.EnableTwoFactor(ctx, rec.ID, "first", 10, nil)
+		require.ErrorIs(t, err, userstore.ErrTwoFactorNotPending)
+	})
+}
+
+func TestCodesCanOnlyBeUsedOnce(t *testing.T) {
+	withTwoFactorEnabled(t, func(ctx context.Context, store *userstore.Store, usr userstore.User) {
+		require.ErrorIs(t, store.UseTwoFactorStep(ctx, usr.ID, 10), userstore.ErrTwoFactorCodeRejected)
+		require.NoError(t, store.UseTwoFactorStep(ctx, usr.ID, 11))
+		require.ErrorIs(t, store.UseTwoFactorStep(ctx, usr.ID, 11), userstore.ErrTwoFactorCodeRejected)
+
+		require.NoError(t, store.UseRecoveryCode(ctx, usr.ID, "code1"))
+		require.ErrorIs(t, store.UseRecoveryCode(ctx, usr.ID, "code1"), userstore.ErrTwoFactorCodeRejected)
+		require.ErrorIs(t, store.UseRecoveryCode(ctx, usr.ID, "unknown"), userstore.ErrTwoFactorCodeRejected)
+
+		stored, err := store.ReadRecord(ctx, usr.ID)
+		require.NoError(t, err)
+		require.Equal(t, []string{"code2"}, stored.TwoFactor.RecoveryCodes)
+		require.Equal(t, usr.Version, stored.Data.Version, "using codes does not change the user")
+	})
+}
+
+func TestDisableTwoFactorRemovesSecrets(t *testing.T) {
+	withTwoFactorEnabled(t, func(ctx context.Context, store *userstore.Store, usr userstore.User) {
+		disabled, err := store.DisableTwoFactor(ctx, usr.ID)
+		require.NoError(t, err)
+		require.False(t, disabled.TwoFactorEnabled)
+
+		stored, err := store.ReadRecord(ctx, usr.ID)
+		require.NoError(t, err)
+		require.Nil(t, stored.TwoFactor)
+		require.Equal(t, userstore.TwoFactorDisabled, stored.Events[len(stored.Events)-1].Action)
+
+		_, err = store.DisableTwoFactor(ctx, usr.ID)
+		require.ErrorIs(t, err, userstore.ErrTwoFactorNotEnabled)
+		require.ErrorIs(t, store.UseRecoveryCode(ctx, usr.ID, "code2"), userstore.ErrTwoFactorCodeRejected)
+	})
+}
+
+func TestAnonymizeTurnsTwoFactorOff(t *testing.T) {
+	withTwoFactorEnabled(t, func(ctx context.Context, store *userstore.Store, usr userstore.User) {
+		anonymized := usr
+		anonymized.Nickname = "anonymized-" + usr.ID.String()
+		anonymized.Email = usr.ID.String() + "@anonymized.invalid"
+		updated, err := store.Anonymize(ctx, &anonymized)
+		require.NoError(t, err)
+		require.False(t, updated.TwoFactorEnabled)
+
+		stored, err := store.ReadRecord(ctx, usr.ID)
+		require.NoError(t, err)
+		require.Nil(t, stored.TwoFactor)
+	})
+}
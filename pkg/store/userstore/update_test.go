@@ -2,9 +2,11 @@ package userstore_test
 
 import (
 	"context"
+	"sync"
 	"testing"
 
 	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/utctime"
 	"github.com/stretchr/testify/require"
 )
 
@@ -41,3 +43,88 @@ func TestUpdateFailsIfUpdateVersionIsStale(t *testing.T) {
 		require.ErrorIs(t, err, userstore.ErrInvalidVersion)
 	})
 }
+
+func TestConcurrentUpdatesOfTheSameVersionAddOneEvent(t *testing.T) {
+	rec := fakeUserRecord()
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		_, err := store.Create(ctx, &rec)
+		require.NoError(t, err)
+
+		const updates = 5
+		errs := make([]error, updates)
+		var wg sync.WaitGroup
+		for i := 0; i < updates; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				update := rec
+				update.FirstName = "New"
+				_, errs[i] = store.UpdateOne(ctx, &update)
+			}(i)
+		}
+		wg.Wait()
+
+		succeeded := 0
+		for _, err := range errs {
+			if err == nil {
+				succeeded += 1
+				continue
+			}
+			require.ErrorIs(t, err, userstore.ErrInvalidVersion)
+		}
+		require.Equal(t, 1, succeeded)
+		stored, err := store.ReadRecord(ctx, rec.ID)
+		require.NoError(t, err)
+		require.Len(t, stored.Events, 2)
+	})
+}
+
+func TestStoreCanUpdateSomeFieldsOfAUserRecord(t *testing.T) {
+	rec := fakeUserRecord()
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		_, err := store.Create(ctx, &rec)
+		require.NoError(t, err)
+		firstName, country, avatarURL := "$New", "NL", "https://images.example.com/avatars/1.png"
+		change := userstore.Change{FirstName: &firstName, Country: &country, AvatarURL: &avatarURL, UpdatedAt: utctime.Now()}
+		updated, err := store.UpdateFields(ctx, rec.ID, rec.Version, &change)
+		require.NoError(t, err)
+
+		expected := rec
+		expected.FirstName = firstName
+		expected.Country = country
+		expected.AvatarURL = avatarURL
+		expected.UpdatedAt = change.UpdatedAt
+		expected.Version = rec.Version + 1
+		compareUserRecords(t, expected, updated)
+		read, err := store.ReadOne(ctx, rec.ID)
+		require.NoError(t, err)
+		compareUserRecords(t, expected, read)
+
+		stored, err := store.ReadRecord(ctx, rec.ID)
+		require.NoError(t, err)
+		evt := stored.Events[len(stored.Events)-1]
+		require.Equal(t, userstore.Updated, evt.Action)
+		require.Equal(t, rec.ID, evt.ID)
+		require.Equal(t, expected.Version, evt.Version)
+		compareUserRecords(t, expected, *evt.Data)
+	})
+}
+
+func TestUpdateFieldsFailsIfRecordDoesntExist(t *testing.T) {
+	rec := fakeUserRecord()
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		_, err := store.UpdateFields(ctx, rec.ID, rec.Version, &userstore.Change{UpdatedAt: utctime.Now()})
+		require.ErrorIs(t, err, userstore.ErrNotFound)
+	})
+}
+
+func TestUpdateFieldsFailsIfVersionIsStale(t *testing.T) {
+	rec := fakeUserRecord()
+	rec.Version = 2
+	withStore(func(ctx context.Context, store *userstore.Store) {
+		_, err := store.Create(ctx, &rec)
+		require.NoError(t, err)
+		_, err = store.UpdateFields(ctx, rec.ID, 1, &userstore.Change{UpdatedAt: utctime.Now()})
+		require.ErrorIs(t, err, userstore.ErrInvalidVersion)
+	})
+}
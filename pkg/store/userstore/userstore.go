@@ -6,48 +6,197 @@ package userstore
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"math"
 	"math/rand"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/robotlovesyou/fitest/pkg/telemetry"
+	"github.com/robotlovesyou/fitest/pkg/tenant"
 	"github.com/robotlovesyou/fitest/pkg/utctime"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
 	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type State string
 type Action string
 
+// Status is the status of a user. Records stored before users had a status have none, and are active
+type Status string
+
 const (
 	Pending    State = "Pending"
 	Processing State = "Processing"
+	// DeadLettered is the state of an event which failed to be processed too many times. It is not processed again
+	// until it is requeued, and the later events of its user wait behind it
+	DeadLettered State = "DeadLettered"
 
 	Created Action = "Created"
 	Updated Action = "Updated"
 	Deleted Action = "Deleted"
+	// PasswordChanged is the action of events for password changes, which are recorded separately from other updates
+	PasswordChanged Action = "PasswordChanged"
+	// PasswordResetRequested is the action of events for password reset requests. The user is not changed
+	PasswordResetRequested Action = "PasswordResetRequested"
+	// EmailChangeRequested is the action of events for email address changes waiting to be confirmed. The user is not
+	// changed
+	EmailChangeRequested Action = "EmailChangeRequested"
+	// EmailChanged is the action of events for confirmed email address changes
+	EmailChanged Action = "EmailChanged"
+	// Restored is the action of events for soft deleted users which have been restored
+	Restored Action = "Restored"
+	// Anonymized is the action of events for users whose personal information has been replaced
+	Anonymized Action = "Anonymized"
+	// Suspended is the action of events for users who have been suspended
+	Suspended Action = "Suspended"
+	// Reactivated is the action of events for suspended users who have been made active again
+	Reactivated Action = "Reactivated"
+	// Banned is the action of events for users who have been banned
+	Banned Action = "Banned"
+	// MarkedDormant is the action of events for active users who have been made dormant because they have not been
+	// seen for a long time
+	MarkedDormant Action = "MarkedDormant"
+	// TwoFactorEnabled is the action of events for users who have confirmed their enrollment in two factor
+	// authentication
+	TwoFactorEnabled Action = "TwoFactorEnabled"
+	// TwoFactorDisabled is the action of events for users who have turned two factor authentication off
+	TwoFactorDisabled Action = "TwoFactorDisabled"
+	// NicknameChanged is the action of events for changes of nickname
+	NicknameChanged Action = "NicknameChanged"
+	// Replayed is the action of synthetic events carrying the current state of a user, which are added on request to
+	// recover consumers which have lost data. The user is not changed
+	Replayed Action = "Replayed"
+
+	StatusActive    Status = "active"
+	StatusSuspended Status = "suspended"
+	StatusBanned    Status = "banned"
+	StatusDormant   Status = "dormant"
 
+	// CollectionName is the Collection of stores created without one
 	CollectionName = "users"
 
-	// findTimeout is used to ensure that the goroutines created by find will complete.
-	// It should probably be configurable
-	findTimeout = 10 * time.Second
+	// DefaultFindTimeout is the FindTimeout of stores created without one
+	DefaultFindTimeout = 10 * time.Second
+	// DefaultWriteTimeout is the WriteTimeout of stores created without one
+	DefaultWriteTimeout = 10 * time.Second
+	// DefaultEventPollTimeout is the EventPollTimeout of stores created without one
+	DefaultEventPollTimeout = 10 * time.Second
+	// DefaultMaxRetries is the MaxRetries of stores created without it
+	DefaultMaxRetries = 3
+	// DefaultRetryBackoff is the RetryBackoff of stores created without one
+	DefaultRetryBackoff = 50 * time.Millisecond
+	// DefaultRetryBudget is the RetryBudget of stores created without one
+	DefaultRetryBudget = 0.1
+	// DefaultTombstoneRetention is the TombstoneRetention of stores created without one
+	DefaultTombstoneRetention = 30 * 24 * time.Hour
+	// DefaultEventBatchSize is the EventBatchSize of stores created without one
+	DefaultEventBatchSize = 100
+	// DefaultMaxPendingEvents is the MaxPendingEvents of stores created without it
+	DefaultMaxPendingEvents = 1000
+	// DefaultUUIDRepresentation is the UUIDRepresentation of stores created without one, which is how the driver
+	// stores UUIDs by default
+	DefaultUUIDRepresentation = UUIDGeneric
+	// DefaultHealthMaxRoundTrip is the HealthMaxRoundTrip of stores created without one
+	DefaultHealthMaxRoundTrip = time.Second
+	// healthTimeout limits the time taken by the checks of the Monitor of a store, so that a database which does not
+	// answer fails the check before the health check of the service times out. It should probably be configurable
+	healthTimeout = 2 * time.Second
+
+	// Error codes returned by mongodb when dropping an index from a collection when either does not exist
+	codeNamespaceNotFound = 26
+	codeIndexNotFound     = 27
+	// Error code returned by mongodb when a write conflicts with a unique index
+	codeDuplicateKey = 11000
+
+	// Names of the unique indexes on email addresses and nicknames, which are named in duplicate key errors
+	emailIndex    = "tenant_1_data.email_1"
+	nicknameIndex = "tenant_1_data.nickname_1"
+	// Fields of the unique indexes on email addresses and nicknames, which are included in the key pattern of
+	// duplicate key errors
+	emailField    = "data.email"
+	nicknameField = "data.nickname"
+	// expiryIndex is the name of the TTL index which removes expired records
+	expiryIndex = "expires_at_1"
 )
 
+// legacyIndexes are the names of indexes created before users were scoped by tenant.
+// They are replaced by indexes which include the tenant
+var legacyIndexes = []string{
+	"data.email_1",
+	"data.nickname_1",
+	"idempotency_key_1",
+	"data.created_at_1_data.country_1",
+	"data.updated_at_1",
+	"data.last_name_1",
+}
+
 var (
 	// ErrAlreadyExists is returned when the new record cannot be inserted due to a unique constraint conflict
 	// In a real world implementation, this would need to carry enough information for the consumer to be able to address the issue
 	ErrAlreadyExists = errors.New("a user with that email or nickname already exists")
+	// ErrEmailInUse is returned when the email address of a new or changed record is used by another record.
+	// It wraps ErrAlreadyExists
+	ErrEmailInUse = fmt.Errorf("%w: the email address is in use", ErrAlreadyExists)
+	// ErrNicknameInUse is returned when the nickname of a new record is used by another record.
+	// It wraps ErrAlreadyExists
+	ErrNicknameInUse = fmt.Errorf("%w: the nickname is in use", ErrAlreadyExists)
 	//ErrNotFound is returned when the requested record does not exist
 	ErrNotFound = errors.New("the requested user cannot be found in the store")
 	// ErrInvalidVersion is returned when a record cannot be updated because the version is out of date
 	ErrInvalidVersion = errors.New("the user cannot be updated because the version is invalid")
+	// ErrInvalidSort is returned when a query is sorted by a field which is not a SortField, or starts after a user
+	// without being sorted by SortCreatedAt
+	ErrInvalidSort = errors.New("the users cannot be sorted by the requested field")
+	// ErrInvalidResetToken is returned when no user holds an unexpired password reset token matching the request
+	ErrInvalidResetToken = errors.New("the password reset token is invalid or has expired")
+	// ErrInvalidEmailChangeToken is returned when no user has an unexpired email change matching the request
+	ErrInvalidEmailChangeToken = errors.New("the email change token is invalid or has expired")
+	// ErrInvalidStatus is returned when a user is changed to a status which is not a Status
+	ErrInvalidStatus = errors.New("the user cannot be changed to the requested status")
+	// ErrTooManyRetries is returned when a change conflicts with other changes of the same user more often than the
+	// store retries it
+	ErrTooManyRetries = errors.New("the change conflicted with other changes too many times")
+	// ErrTooManyEvents is returned when a change cannot be made because the user already has the maximum number of
+	// events waiting to be published
+	ErrTooManyEvents = errors.New("the user has too many events waiting to be published")
+	// ErrIndexesBuilding is returned by changes which rely on the unique indexes of the store while they are being
+	// built in the background, since a duplicate email address or nickname stored during the build would fail it
+	ErrIndexesBuilding = errors.New("the indexes of the store are being built")
+	// ErrNicknameChangeTooSoon is returned when the nickname of a user is changed before the cooldown since their last
+	// change has passed
+	ErrNicknameChangeTooSoon = errors.New("the nickname of the user was changed too recently")
+	// ErrTwoFactorEnabled is returned when a user who already has two factor authentication enabled enrolls again
+	ErrTwoFactorEnabled = errors.New("the user already has two factor authentication enabled")
+	// ErrTwoFactorNotPending is returned when two factor authentication is enabled for a user whose enrollment has
+	// been replaced or confirmed since it was read
+	ErrTwoFactorNotPending = errors.New("the two factor authentication enrollment of the user has changed")
+	// ErrTwoFactorNotEnabled is returned when two factor authentication is disabled for a user who does not have it
+	// enabled
+	ErrTwoFactorNotEnabled = errors.New("the user does not have two factor authentication enabled")
+	// ErrTwoFactorCodeRejected is returned when a two factor authentication code has already been used, or a recovery
+	// code does not belong to the user
+	ErrTwoFactorCodeRejected = errors.New("the two factor authentication code has already been used or is invalid")
+	// ErrIdempotencyKeyReused is returned when a user is created with the idempotency key of a user created with
+	// different details, so that the request cannot be a retry of the one which created them
+	ErrIdempotencyKeyReused = errors.New("the idempotency key was used to create a different user")
 )
 
 // User represents a user as stored in the database
@@ -59,9 +208,52 @@ type User struct {
 	PasswordHash string    `bson:"password_hash"`
 	Email        string    `bson:"email"`
 	Country      string    `bson:"country"`
+	AvatarURL    string    `bson:"avatar_url,omitempty"`
 	CreatedAt    time.Time `bson:"created_at"`
 	UpdatedAt    time.Time `bson:"updated_at"`
 	Version      int64     `bson:"version"`
+	Status       Status    `bson:"status,omitempty"`
+	// LastLoginAt is the time the user last authenticated, and LastSeenAt the time they were last active. They are
+	// zero if the user has never been. Changing them does not change the version of the user or add an event
+	LastLoginAt time.Time `bson:"last_login_at,omitempty"`
+	LastSeenAt  time.Time `bson:"last_seen_at,omitempty"`
+	// TwoFactorEnabled is true when the user must give a code from their authenticator app, or a recovery code, to
+	// authenticate. The secrets are stored in Record.TwoFactor
+	TwoFactorEnabled bool `bson:"two_factor_enabled,omitempty"`
+}
+
+// MarshalBSON encodes the user with the lower case forms of their first and last names, which are indexed so that
+// queries by NamePrefix ignore case and still use indexes. They are ignored when the user is decoded
+func (u User) MarshalBSON() ([]byte, error) {
+	return u.marshalBSON(bson.DefaultRegistry)
+}
+
+// marshalBSON is MarshalBSON with registry, which the collections of a store use to encode the UUIDs of users with
+// the UUIDRepresentation of the store
+func (u User) marshalBSON(registry *bsoncodec.Registry) ([]byte, error) {
+	type plain User // plain does not have the MarshalBSON method, so it is encoded as a struct
+	doc, err := bson.MarshalWithRegistry(registry, plain(u))
+	if err != nil {
+		return nil, err
+	}
+	idx, folded := bsoncore.AppendDocumentStart(nil)
+	folded = append(folded, doc[4:len(doc)-1]...) // the elements of doc, without its length and terminator
+	folded = bsoncore.AppendStringElement(folded, "first_name_folded", foldName(u.FirstName))
+	folded = bsoncore.AppendStringElement(folded, "last_name_folded", foldName(u.LastName))
+	return bsoncore.AppendDocumentEnd(folded, idx)
+}
+
+// foldName returns the form of name compared with the NamePrefix of queries
+func foldName(name string) string {
+	return strings.ToLower(name)
+}
+
+// statusActions are the actions of the events for changes to each status
+var statusActions = map[Status]Action{
+	StatusActive:    Reactivated,
+	StatusSuspended: Suspended,
+	StatusBanned:    Banned,
+	StatusDormant:   MarkedDormant,
 }
 
 // Event represents an event about a mutation
@@ -73,6 +265,18 @@ type Event struct {
 	CreatedAt time.Time `bson:"created_at"`
 	UpdatedAt time.Time `bson:"updated_at"`
 	Data      *User     `bson:"data"`
+	// Tenant is the tenant of the record the event is for. It is read from the record rather than stored with the event
+	Tenant string `bson:"-"`
+	// Token is the token of a PasswordResetRequested or EmailChangeRequested event, so that it can be sent to the
+	// user. It is only stored until the event has been processed
+	Token string `bson:"token,omitempty"`
+	// Email is the new email address of an EmailChangeRequested event, which the token is sent to, or the address of
+	// the user of a Deleted event, which the confirmation of the deletion is sent to. Like Token, it is only stored
+	// until the event has been processed
+	Email string `bson:"email,omitempty"`
+	// Attempts is the number of times the event has been read from the store to be processed, including the read
+	// which returned it
+	Attempts int64 `bson:"attempts,omitempty"`
 }
 
 // EventResult represents the result of reading the next event from the store
@@ -87,31 +291,293 @@ type Record struct {
 	ID     uuid.UUID `bson:"_id"`
 	Data   *User     `bson:"data"`
 	Events []Event   `bson:"events"`
+	// IdempotencyKey is the key provided by the client which created the record, if any
+	IdempotencyKey string `bson:"idempotency_key,omitempty"`
+	// IdempotencyHash is the PayloadHash of the user when they were created with IdempotencyKey. Records created
+	// before it was stored do not have one
+	IdempotencyHash string `bson:"idempotency_hash,omitempty"`
+	// Tenant is the tenant the user belongs to. It is kept when the user is deleted
+	Tenant string `bson:"tenant"`
+	// ResetToken is the password reset token issued to the user, if any
+	ResetToken *ResetToken `bson:"reset_token,omitempty"`
+	// EmailChange is the change of email address waiting to be confirmed by the user, if any
+	EmailChange *EmailChange `bson:"email_change,omitempty"`
+	// TwoFactor holds the two factor authentication secrets of the user, if they have enrolled. They are kept out of
+	// Data so that they are not copied into events
+	TwoFactor *TwoFactor `bson:"two_factor,omitempty"`
+	// DeletedAt is the time the user was soft deleted, if it has been. Soft deleted records keep their data, and
+	// their email address and nickname, until they are purged
+	DeletedAt *time.Time `bson:"deleted_at,omitempty"`
+	// PreviousNicknames are the nicknames the user has changed from, oldest first. They are removed when the user is
+	// anonymized
+	PreviousNicknames []PreviousNickname `bson:"previous_nicknames,omitempty"`
+	// ExpiresAt is the time after which the record of an irrecoverably deleted user, all of whose events have been
+	// processed, is removed by the database. It is not set for any other record
+	ExpiresAt *time.Time `bson:"expires_at,omitempty"`
+	// SchemaVersion is the schema version the record was written with. Records are upgraded to the
+	// CurrentSchemaVersion as they are read, so it is only older in the database
+	SchemaVersion int `bson:"schema_version,omitempty"`
+}
+
+// PayloadHash returns the hash of the details user was created with, which is stored with the idempotency key they
+// were created with so that a retry can be told apart from a different user created with the same key. The password
+// is not hashed, since its hash is salted differently for each request
+func PayloadHash(user *User) string {
+	hash := sha256.New()
+	for _, field := range []string{user.FirstName, user.LastName, user.Nickname, user.Email, user.Country, user.AvatarURL} {
+		// each field is prefixed with its length, so that the boundaries between fields are part of the hash
+		fmt.Fprintf(hash, "%d:%s", len(field), field)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// SamePayload returns true if user has the details the user of rec was created with, which is assumed for records
+// created before their IdempotencyHash was stored
+func (rec *Record) SamePayload(user *User) bool {
+	return rec.IdempotencyHash == "" || rec.IdempotencyHash == PayloadHash(user)
+}
+
+// PreviousNickname is a nickname a user has changed from, and the time they changed it
+type PreviousNickname struct {
+	Nickname  string    `bson:"nickname"`
+	ChangedAt time.Time `bson:"changed_at"`
+}
+
+// ResetToken is a single use password reset token. Only the hash of the token is stored, so that the tokens cannot
+// be read from the database
+type ResetToken struct {
+	Hash      string    `bson:"hash"`
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+// TwoFactor is the two factor authentication state of a user. The secrets are stored sealed by the service, and
+// only the hashes of recovery codes are stored
+type TwoFactor struct {
+	// PendingSecret is the secret of an enrollment which has not been confirmed with a code
+	PendingSecret string `bson:"pending_secret,omitempty"`
+	// Secret is the secret of the confirmed enrollment, if any
+	Secret string `bson:"secret,omitempty"`
+	// LastStep is the time step of the last code accepted, so that codes cannot be used twice
+	LastStep int64 `bson:"last_step,omitempty"`
+	// RecoveryCodes are the hashes of the unused recovery codes
+	RecoveryCodes []string `bson:"recovery_codes,omitempty"`
+}
+
+// EmailChange is a change of email address waiting to be confirmed with a single use token. Only the hash of the
+// token is stored
+type EmailChange struct {
+	Email     string    `bson:"email"`
+	Hash      string    `bson:"hash"`
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+// SortField is a field which find queries can be sorted by
+type SortField string
+
+const (
+	SortCreatedAt SortField = "created_at"
+	SortUpdatedAt SortField = "updated_at"
+	SortLastName  SortField = "last_name"
+	SortNickname  SortField = "nickname"
+)
+
+// sortKeys maps each SortField to the key of the document field it sorts by.
+// Each key must be the prefix of an index, so that sorting does not require an in memory sort
+var sortKeys = map[SortField]string{
+	SortCreatedAt: "data.created_at",
+	SortUpdatedAt: "data.updated_at",
+	SortLastName:  "data.last_name",
+	SortNickname:  "data.nickname",
 }
 
 // Query represents the paramteters of a find query
 type Query struct {
 	CreatedAfter time.Time
-	Country      string
-	Length       int32
-	Page         int64
+	// CreatedBefore matches users created before the given time. When it is zero, users match however recently they
+	// were created
+	CreatedBefore time.Time
+	// Countries matches users living in any of the given countries. When it is empty, users living in any country match
+	Countries []string
+	Length    int32
+	Page      int64
+	// SortBy is the field to sort results by. When it is empty, results are sorted by SortCreatedAt
+	SortBy SortField
+	// SortDescending sorts results in descending rather than ascending order
+	SortDescending bool
+	// Status matches users with the given status. When it is empty, users with any status match
+	Status Status
+	// Search matches users whose nickname or email address is the search term, or whose first or last name starts
+	// with it. Matching is case sensitive, so that it can use indexes. When it is empty, all users match
+	Search string
+	// InactiveSince matches users who have not been seen since the given time, including users created before it who
+	// have never been seen. When it is zero, users match however recently they were seen
+	InactiveSince time.Time
+	// Nickname and Email match the user with exactly the given nickname or email address. When they are empty, users
+	// with any nickname or email address match
+	Nickname string
+	Email    string
+	// NamePrefix matches users whose first or last name starts with it, ignoring case. When it is empty, users with any
+	// name match
+	NamePrefix string
+	// SkipTotal skips counting the users matching the query, which is expensive when many users match, for callers
+	// which only need to know whether there are more. The Total of the page is UnknownTotal, and HasMore is set instead
+	SkipTotal bool
+	// AfterID and AfterCreatedAt are the id and creation time of the last user of the previous page. When AfterID is
+	// set, results start after that user rather than at Page, so that deep pages are read from the index on creation
+	// times rather than by skipping the users of earlier pages. The total still counts every matching user. It can
+	// only be used when sorting by SortCreatedAt
+	AfterID        uuid.UUID
+	AfterCreatedAt time.Time
 }
 
+// UnknownTotal is the Total of the pages of queries which skip counting the matching users
+const UnknownTotal = int64(-1)
+
 // Page represents a page of results
 type Page struct {
-	Page  int64
+	Page int64
+	// Total is the number of users matching the query, or UnknownTotal if the query skips counting them
 	Total int64
 	Items []User
+	// HasMore is true when more users matching the query follow the page. It is only set for queries which skip
+	// counting the matching users
+	HasMore bool
+}
+
+// Options configures the timeouts and retries of a store. Fields which are zero take their default values
+type Options struct {
+	// FindTimeout limits the time taken by FindMany, Count and Stats, so that the goroutines created to find users
+	// complete
+	FindTimeout time.Duration
+	// WriteTimeout limits the time taken by each change, including the reads it depends on. Purge and MarkDormant,
+	// which change any number of users, are only limited by their context
+	WriteTimeout time.Duration
+	// EventPollTimeout limits the time taken to read and claim each batch of events sent by Events
+	EventPollTimeout time.Duration
+	// EventBatchSize is the largest number of events claimed at once by Events. When a full batch is claimed, Events
+	// claims the next batch without waiting, so that bursts of changes are published quickly
+	EventBatchSize int
+	// MaxRetries is the number of times a transaction which conflicts with another is retried before the change fails
+	// with ErrTooManyRetries, and the number of times an operation which fails with a transient error, such as a
+	// network error or an error returned while a new primary is elected, is retried. When it is negative, neither is
+	// retried
+	MaxRetries int
+	// RetryBackoff is the longest time waited before the first retry of an operation. The longest time doubles with
+	// each retry, and the time waited is chosen at random up to it
+	RetryBackoff time.Duration
+	// RetryBudget is the number of retries allowed for each operation made by the store, e.g. 0.1 allows one retry for
+	// every ten operations, so that retries do not overload a database which is failing
+	RetryBudget float64
+	// QueryReadPreference and QueryReadConcern are used by FindMany, Count, Stats and Iterate, which can read from
+	// secondaries since they do not need the latest version of each user. Other reads are made from the primary, since
+	// changes depend on them. When they are nil, the read preference and read concern of the database are used
+	QueryReadPreference *readpref.ReadPref
+	QueryReadConcern    *readconcern.ReadConcern
+	// WriteConcern is the acknowledgement required of each change, e.g. majority. When it is nil, the write concern of
+	// the database is used
+	WriteConcern *writeconcern.WriteConcern
+	// TombstoneRetention is the time the record of an irrecoverably deleted user is kept once all of its events have
+	// been processed, after which it is removed by the database. Until then, the idempotency key the user was created
+	// with cannot be used again
+	TombstoneRetention time.Duration
+	// MaxPendingEvents is the largest number of events waiting to be published which the record of a user can hold.
+	// Changes to a user which already holds that many fail with ErrTooManyEvents, so that the record of a user whose
+	// events cannot be published does not grow towards the size limit of documents. Deleting a user is never refused,
+	// and adds at most one more event. When it is negative, the number of events is not limited
+	MaxPendingEvents int
+	// Database is the name of the database the store is kept in. When it is empty, the database the store is created
+	// with is used
+	Database string
+	// Collection is the name of the collection users are kept in, so that several stores can share a database, e.g.
+	// while users are migrated from one to another. The migrations of a store with a Collection other than
+	// CollectionName are recorded in collections named after it, e.g. users_v2_migrations
+	Collection string
+	// UUIDRepresentation is the representation in BSON of the ids of users, and of the other UUIDs stored. UUIDs are
+	// read in any representation, but records are found by their ids in this representation, so records stored with
+	// another one must be rewritten with MigrateUUIDs when it is changed
+	UUIDRepresentation UUIDRepresentation
+	// HealthMaxRoundTrip is the longest time the checks of the Monitor of the store can take before the store is
+	// reported as unhealthy, so that a database which answers too slowly to serve calls is detected
+	HealthMaxRoundTrip time.Duration
+	// HealthQuery makes the Monitor of the store read from the collection of users as well as pinging the database,
+	// so that a database which answers pings but cannot serve reads is reported as unhealthy
+	HealthQuery bool
+}
+
+// withDefaults returns the options with the default value of each field which is zero
+func (options Options) withDefaults() Options {
+	if options.FindTimeout == 0 {
+		options.FindTimeout = DefaultFindTimeout
+	}
+	if options.WriteTimeout == 0 {
+		options.WriteTimeout = DefaultWriteTimeout
+	}
+	if options.EventPollTimeout == 0 {
+		options.EventPollTimeout = DefaultEventPollTimeout
+	}
+	if options.MaxRetries == 0 {
+		options.MaxRetries = DefaultMaxRetries
+	}
+	if options.MaxRetries < 0 {
+		options.MaxRetries = 0
+	}
+	if options.RetryBackoff == 0 {
+		options.RetryBackoff = DefaultRetryBackoff
+	}
+	if options.RetryBudget == 0 {
+		options.RetryBudget = DefaultRetryBudget
+	}
+	if options.TombstoneRetention == 0 {
+		options.TombstoneRetention = DefaultTombstoneRetention
+	}
+	if options.EventBatchSize == 0 {
+		options.EventBatchSize = DefaultEventBatchSize
+	}
+	if options.MaxPendingEvents == 0 {
+		options.MaxPendingEvents = DefaultMaxPendingEvents
+	}
+	if options.Collection == "" {
+		options.Collection = CollectionName
+	}
+	if options.UUIDRepresentation == "" {
+		options.UUIDRepresentation = DefaultUUIDRepresentation
+	}
+	if options.HealthMaxRoundTrip == 0 {
+		options.HealthMaxRoundTrip = DefaultHealthMaxRoundTrip
+	}
+	return options
 }
 
 // Store provides services for storing and retrieving data
 type Store struct {
 	db         *mongo.Database
-	collection *mongo.Collection
+	collection *retryingCollection
+	// queries is the collection of users with the read preference and read concern of queries of many users
+	queries *retryingCollection
+	options Options
+	// retention is the time soft deleted users are kept for before they are purged. When it is 0, users are deleted
+	// irrecoverably instead
+	retention time.Duration
+	// metrics records the latency and errors of the operations of the store
+	metrics *operationMetrics
+
+	// mu guards transactions, building and migrateErr
+	mu sync.Mutex
+	// transactions records whether the database supports multi-document transactions, once it has been checked
+	transactions *bool
+	// building is true while the migrations of the store, which build its indexes, run in the background
+	building bool
+	// migrateErr is the error of the migrations run in the background, if they failed
+	migrateErr error
 }
 
 type Monitor struct {
 	store *Store
+
+	// mu guards roundTrip
+	mu sync.Mutex
+	// roundTrip is the time taken by the last check which reached the database
+	roundTrip time.Duration
 }
 
 func NewMonitor(store *Store) *Monitor {
@@ -122,44 +588,290 @@ func (m *Monitor) Name() string {
 	return "Datastore"
 }
 
+// Check pings the database and, if the store has the HealthQuery option, finds a user by id, which only reads the
+// _id index. It fails if the database does not answer within healthTimeout, or if the round trip takes longer than
+// the HealthMaxRoundTrip of the store. It also fails if the migrations of the store run in the background have
+// failed, but not while they are running, so that the service can serve while indexes are built. Changes refused
+// with ErrTooManyEvents do not fail the check, since the store can still serve every other user, and are counted by
+// the OperationCollector of the store instead
 func (m *Monitor) Check(ctx context.Context) error {
-	return m.store.db.Client().Ping(ctx, nil)
+	if err := m.store.migrationErr(); err != nil {
+		return fmt.Errorf("cannot migrate database: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, healthTimeout)
+	defer cancel()
+
+	// the checks are not retried, since a database which needs retries is not healthy
+	start := time.Now()
+	if err := m.store.db.Client().Ping(ctx, nil); err != nil {
+		return fmt.Errorf("cannot ping database: %w", err)
+	}
+	if m.store.options.HealthQuery {
+		err := m.store.collection.Collection.FindOne(
+			ctx,
+			bson.M{"_id": uuid.Nil},
+			options.FindOne().SetProjection(bson.M{"_id": 1}),
+		).Err()
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return fmt.Errorf("cannot query users: %w", err)
+		}
+	}
+	roundTrip := time.Since(start)
+	m.mu.Lock()
+	m.roundTrip = roundTrip
+	m.mu.Unlock()
+
+	if roundTrip > m.store.options.HealthMaxRoundTrip {
+		return fmt.Errorf("round trip to the database took %s, which is above the maximum of %s", roundTrip, m.store.options.HealthMaxRoundTrip)
+	}
+	return nil
+}
+
+// Describe describes the round trip of the last check which reached the database, and the progress of the migrations
+// of the store run in the background and of the index builds they are waiting for
+func (m *Monitor) Describe(ctx context.Context) string {
+	m.mu.Lock()
+	roundTrip := m.roundTrip
+	m.mu.Unlock()
+	var descriptions []string
+	if roundTrip > 0 {
+		descriptions = append(descriptions, fmt.Sprintf("round trip: %s", roundTrip))
+	}
+	if m.store.isBuilding() {
+		descriptions = append(descriptions, m.describeMigrations(ctx))
+	}
+	return strings.Join(descriptions, ", ")
+}
+
+// describeMigrations describes the progress of the migrations of the store run in the background, and of the index
+// builds they are waiting for
+func (m *Monitor) describeMigrations(ctx context.Context) string {
+	builds, err := m.store.indexBuilds(ctx)
+	if err != nil {
+		return fmt.Sprintf("migrating: %v", err)
+	}
+	if len(builds) == 0 {
+		return "migrating"
+	}
+	descriptions := make([]string, 0, len(builds))
+	for _, build := range builds {
+		description := build.Msg
+		if build.Progress.Total > 0 {
+			description = fmt.Sprintf("%d of %d (%d%%)", build.Progress.Done, build.Progress.Total, 100*build.Progress.Done/build.Progress.Total)
+		}
+		descriptions = append(descriptions, description)
+	}
+	return "building indexes: " + strings.Join(descriptions, ", ")
 }
 
-// New creates a new store
-func New(db *mongo.Database) *Store {
+// New creates a new store with the given options, which deletes users irrecoverably
+func New(db *mongo.Database, opts Options) *Store {
+	opts = opts.withDefaults()
+	if opts.Database != "" {
+		db = db.Client().Database(opts.Database)
+	}
+	retrier := newRetrier(opts)
+	registry := newRegistry(opts.UUIDRepresentation)
+	writes := options.Collection().SetRegistry(registry).SetWriteConcern(opts.WriteConcern)
+	queries := options.Collection().
+		SetRegistry(registry).
+		SetReadPreference(opts.QueryReadPreference).
+		SetReadConcern(opts.QueryReadConcern)
 	return &Store{
 		db:         db,
-		collection: db.Collection(CollectionName),
+		collection: &retryingCollection{Collection: db.Collection(opts.Collection, writes), retrier: retrier},
+		queries:    &retryingCollection{Collection: db.Collection(opts.Collection, queries), retrier: retrier},
+		options:    opts,
+		metrics:    newOperationMetrics(),
+	}
+}
+
+// NewWithRetention creates a new store which soft deletes users. Soft deleted users are excluded from reads, can be
+// restored with Restore until retention has passed, and are then deleted irrecoverably by Purge
+func NewWithRetention(db *mongo.Database, retention time.Duration, opts Options) *Store {
+	store := New(db, opts)
+	store.retention = retention
+	return store
+}
+
+// supportsTransactions returns true if the database supports multi-document transactions, which requires it to be a
+// replica set member or a mongos router. The answer is remembered once the database has answered
+func (store *Store) supportsTransactions(ctx context.Context) (bool, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if store.transactions != nil {
+		return *store.transactions, nil
+	}
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	if err := store.db.RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return false, fmt.Errorf("cannot check for transaction support: %w", err)
+	}
+	supported := hello.SetName != "" || hello.Msg == "isdbgrid"
+	store.transactions = &supported
+	return supported, nil
+}
+
+// inTransaction calls f with a context which runs the operations of the store made with it in a single transaction,
+// so that a mutation and the event pushed for it are committed together with the reads they depend on. A transaction
+// which conflicts with another is retried, calling f again, up to the MaxRetries of the store. Standalone servers do not support transactions, so f is
+// called with ctx instead, and each of its operations is atomic by itself
+func (store *Store) inTransaction(ctx context.Context, f func(context.Context) error) error {
+	supported, err := store.supportsTransactions(ctx)
+	if err != nil {
+		return err
+	}
+	if !supported {
+		return f(ctx)
+	}
+	session, err := store.db.Client().StartSession()
+	if err != nil {
+		return fmt.Errorf("cannot start session: %w", err)
+	}
+	defer session.EndSession(ctx)
+	attempts := 0
+	transaction := options.Transaction().SetWriteConcern(store.options.WriteConcern)
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		// an error without the transient transaction label stops WithTransaction retrying
+		if attempts > store.options.MaxRetries {
+			return nil, ErrTooManyRetries
+		}
+		attempts++
+		return nil, f(sessCtx)
+	}, transaction)
+	return err
+}
+
+// writeContext returns a context which is done when the WriteTimeout of the store has passed, for a change
+func (store *Store) writeContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, store.options.WriteTimeout)
+}
+
+// excludeDeleted adds a condition to filter which excludes soft deleted records, and returns filter
+func excludeDeleted(filter bson.M) bson.M {
+	filter["deleted_at"] = bson.M{"$exists": false}
+	return filter
+}
+
+// migrateTenants assigns records created before users were scoped by tenant to the default tenant
+// and drops the indexes which did not include the tenant
+func (store *Store) migrateTenants(ctx context.Context) error {
+	_, err := store.collection.UpdateMany(ctx,
+		bson.M{"tenant": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"tenant": tenant.Default}},
+	)
+	if err != nil {
+		return fmt.Errorf("cannot assign users to the default tenant: %w", err)
+	}
+	return store.dropIndexes(ctx, legacyIndexes...)
+}
+
+// dropIndexes drops the indexes with the given names. Indexes which do not exist are ignored
+func (store *Store) dropIndexes(ctx context.Context, names ...string) error {
+	for _, name := range names {
+		_, err := store.collection.Indexes().DropOne(ctx, name)
+		var cmdErr mongo.CommandError
+		if errors.As(err, &cmdErr) && (cmdErr.Code == codeIndexNotFound || cmdErr.Code == codeNamespaceNotFound) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("cannot drop index %s: %w", name, err)
+		}
 	}
+	return nil
 }
 
-// Ensure indexes creates the set of indexes required by the store
+// createIndexes creates the set of indexes required by the store
 // creating indexes in the foreground like this could be problematic for a production service.
-func (store *Store) EnsureIndexes(ctx context.Context) error {
+// Each index used by queries for users is prefixed with the tenant, so that uniqueness is scoped to the tenant
+func (store *Store) createIndexes(ctx context.Context) error {
 	_, err := store.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
 		{
 			Keys: bson.D{
+				bson.E{Key: "tenant", Value: 1},
 				bson.E{Key: "data.email", Value: 1},
 			},
 			Options: options.Index().
+				SetName(emailIndex).
 				SetUnique(true).
 				SetPartialFilterExpression(bson.M{"data": bson.M{"$type": bsontype.EmbeddedDocument}}),
 		},
 		{
 			Keys: bson.D{
+				bson.E{Key: "tenant", Value: 1},
 				bson.E{Key: "data.nickname", Value: 1},
 			},
 			Options: options.Index().
+				SetName(nicknameIndex).
 				SetUnique(true).
 				SetPartialFilterExpression(bson.M{"data": bson.M{"$type": bsontype.EmbeddedDocument}}),
 		},
+		{
+			// Idempotency keys are kept for the lifetime of the record. It might be better to expire them
+			Keys: bson.D{
+				bson.E{Key: "tenant", Value: 1},
+				bson.E{Key: "idempotency_key", Value: 1},
+			},
+			Options: options.Index().
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"idempotency_key": bson.M{"$type": bsontype.String}}),
+		},
 		{
 			Keys: bson.D{
+				bson.E{Key: "tenant", Value: 1},
 				bson.E{Key: "data.created_at", Value: 1},
 				bson.E{Key: "data.country", Value: 1},
 			},
 		},
+		{
+			Keys: bson.D{
+				bson.E{Key: "tenant", Value: 1},
+				bson.E{Key: "data.updated_at", Value: 1},
+			},
+		},
+		{
+			Keys: bson.D{
+				bson.E{Key: "tenant", Value: 1},
+				bson.E{Key: "data.last_name", Value: 1},
+			},
+		},
+		{
+			Keys: bson.D{
+				bson.E{Key: "tenant", Value: 1},
+				bson.E{Key: "data.last_seen_at", Value: 1},
+			},
+		},
+		{
+			Keys: bson.D{
+				bson.E{Key: "tenant", Value: 1},
+				bson.E{Key: "data.first_name", Value: 1},
+			},
+		},
+		{
+			Keys: bson.D{
+				bson.E{Key: "tenant", Value: 1},
+				bson.E{Key: "reset_token.hash", Value: 1},
+			},
+			Options: options.Index().
+				SetPartialFilterExpression(bson.M{"reset_token.hash": bson.M{"$type": bsontype.String}}),
+		},
+		{
+			Keys: bson.D{
+				bson.E{Key: "tenant", Value: 1},
+				bson.E{Key: "email_change.hash", Value: 1},
+			},
+			Options: options.Index().
+				SetPartialFilterExpression(bson.M{"email_change.hash": bson.M{"$type": bsontype.String}}),
+		},
+		{
+			Keys: bson.D{
+				bson.E{Key: "deleted_at", Value: 1},
+			},
+			Options: options.Index().
+				SetPartialFilterExpression(bson.M{"deleted_at": bson.M{"$type": bsontype.DateTime}}),
+		},
 		{
 			Keys: bson.D{
 				bson.E{Key: "events.0.state", Value: 1},
@@ -182,36 +894,247 @@ func eventFor(action Action, id uuid.UUID, version int64, user *User) Event {
 	}
 }
 
-// Create creates a new user record
-func (store *Store) Create(ctx context.Context, user *User) (User, error) {
+// conflictError returns ErrEmailInUse or ErrNicknameInUse for a duplicate key error, err, which conflicted with the
+// unique index on email addresses or nicknames, and ErrAlreadyExists for a conflict with any other index
+func conflictError(err error) error {
+	var writeErr mongo.WriteException
+	if errors.As(err, &writeErr) {
+		for _, we := range writeErr.WriteErrors {
+			if we.Code == codeDuplicateKey {
+				return writeConflictError(we)
+			}
+		}
+	}
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) {
+		return duplicateKeyError(cmdErr.Raw, cmdErr.Message)
+	}
+	return duplicateKeyError(nil, err.Error())
+}
+
+// hasField returns true if doc includes a field named field. Field names including dots are not treated as paths
+func hasField(doc bson.Raw, field string) bool {
+	_, err := doc.LookupErr(field)
+	return err == nil
+}
+
+// writeConflictError returns the error for a single write which conflicted with a unique index
+func writeConflictError(we mongo.WriteError) error {
+	return duplicateKeyError(we.Raw, we.Message)
+}
+
+// duplicateKeyError returns the error for the index named by the key pattern of the server's duplicate key error,
+// raw. Servers which do not include the key pattern name the index in the message of the error instead
+func duplicateKeyError(raw bson.Raw, message string) error {
+	if pattern, ok := raw.Lookup("keyPattern").DocumentOK(); ok {
+		switch {
+		case hasField(pattern, emailField):
+			return ErrEmailInUse
+		case hasField(pattern, nicknameField):
+			return ErrNicknameInUse
+		default:
+			return ErrAlreadyExists
+		}
+	}
+	switch {
+	case strings.Contains(message, emailIndex):
+		return ErrEmailInUse
+	case strings.Contains(message, nicknameIndex):
+		return ErrNicknameInUse
+	default:
+		return ErrAlreadyExists
+	}
+}
+
+// eventCapacityError returns ErrTooManyEvents if the user of the tenant of ctx with the given id holds the
+// MaxPendingEvents of the store, and err otherwise. It is called when a change, whose filter requires the user to have
+// room for another event, matched no user, to tell whether that was why
+func (store *Store) eventCapacityError(ctx context.Context, id uuid.UUID, err error) error {
+	if store.options.MaxPendingEvents < 0 {
+		return err
+	}
+	findErr := store.collection.FindOne(ctx, bson.M{
+		"_id":                 id,
+		"tenant":              tenant.FromContext(ctx),
+		store.lastEventPath(): bson.M{"$exists": true},
+	}, options.FindOne().SetProjection(bson.M{"_id": 1})).Err()
+	switch {
+	case errors.Is(findErr, mongo.ErrNoDocuments):
+		return err
+	case findErr != nil:
+		return fmt.Errorf("cannot count the events of user: %w", findErr)
+	}
+	store.refuseTooManyEvents()
+	return ErrTooManyEvents
+}
+
+// belowEventCapacity adds to filter the condition that the record holds fewer than the MaxPendingEvents of the store,
+// so that a change cannot add an event to a record which is full, however many changes are made concurrently
+func (store *Store) belowEventCapacity(filter bson.M) bson.M {
+	if store.options.MaxPendingEvents >= 0 {
+		filter[store.lastEventPath()] = bson.M{"$exists": false}
+	}
+	return filter
+}
+
+// lastEventPath is the path of the last event a record can hold, which only exists when the record is full
+func (store *Store) lastEventPath() string {
+	return fmt.Sprintf("events.%d", store.options.MaxPendingEvents-1)
+}
+
+// checkRecordEventCapacity returns ErrTooManyEvents if rec, which has already been read, holds the MaxPendingEvents of
+// the store, so that a change to it can fail without being attempted
+func (store *Store) checkRecordEventCapacity(rec *Record) error {
+	if store.options.MaxPendingEvents < 0 || len(rec.Events) < store.options.MaxPendingEvents {
+		return nil
+	}
+	store.refuseTooManyEvents()
+	return ErrTooManyEvents
+}
+
+// refuseTooManyEvents counts a change refused with ErrTooManyEvents, so that a user whose events are stuck is noticed
+func (store *Store) refuseTooManyEvents() {
+	store.metrics.refused.Inc()
+}
+
+// Create creates a new user record for the tenant of ctx. ErrEmailInUse or ErrNicknameInUse is returned if the
+// email address or nickname is used by another user
+func (store *Store) Create(ctx context.Context, user *User) (created User, err error) {
 	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "CreateUserRecord")
 	defer span.End()
+	defer store.metrics.observe("Create", time.Now(), &err)
+	ctx, cancel := store.writeContext(ctx)
+	defer cancel()
+	if err := store.checkIndexesBuilt(); err != nil {
+		span.RecordError(err)
+		return *user, err
+	}
 	rec := Record{
-		ID:     user.ID,
-		Data:   user,
-		Events: []Event{eventFor(Created, user.ID, user.Version, user)},
+		ID:            user.ID,
+		Data:          user,
+		Events:        []Event{eventFor(Created, user.ID, user.Version, user)},
+		Tenant:        tenant.FromContext(ctx),
+		SchemaVersion: CurrentSchemaVersion,
 	}
-	_, err := store.collection.InsertOne(ctx, &rec)
+	_, err = store.collection.InsertOne(ctx, &rec)
 	if err != nil {
 		span.RecordError(err)
 		if mongo.IsDuplicateKeyError(err) {
-			// Since there are multiple unique indexes, a real world implementation should
-			// allow a consumer to differentiate between causes
-			return *user, ErrAlreadyExists
+			return *user, conflictError(err)
 		}
 		return *user, fmt.Errorf("cannot store user record: %w", err)
 	}
 	return *user, nil
 }
 
-// ReadOne reads a single user record by ID
+// CreateMany creates a batch of new user records in a single call. Users which conflict with an existing user, or
+// with another user in the batch, are not created, but do not prevent the others from being created.
+// It returns an error for each user, in the same order as users, which is nil if the user was created and
+// ErrEmailInUse or ErrNicknameInUse if it conflicted. An error is returned instead if the batch could not be stored at all
+func (store *Store) CreateMany(ctx context.Context, users []User) ([]error, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "CreateManyUserRecords")
+	defer span.End()
+	ctx, cancel := store.writeContext(ctx)
+	defer cancel()
+	if err := store.checkIndexesBuilt(); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	errs := make([]error, len(users))
+	if len(users) == 0 {
+		return errs, nil
+	}
+	tenantID := tenant.FromContext(ctx)
+	docs := make([]interface{}, 0, len(users))
+	for i := range users {
+		user := &users[i]
+		docs = append(docs, &Record{
+			ID:            user.ID,
+			Data:          user,
+			Events:        []Event{eventFor(Created, user.ID, user.Version, user)},
+			Tenant:        tenantID,
+			SchemaVersion: CurrentSchemaVersion,
+		})
+	}
+	_, err := store.collection.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	if err == nil {
+		return errs, nil
+	}
+	span.RecordError(err)
+	var bulkErr mongo.BulkWriteException
+	if !errors.As(err, &bulkErr) || bulkErr.WriteConcernError != nil {
+		return nil, fmt.Errorf("cannot store user records: %w", err)
+	}
+	for _, writeErr := range bulkErr.WriteErrors {
+		if writeErr.Code != codeDuplicateKey {
+			return nil, fmt.Errorf("cannot store user records: %w", err)
+		}
+		errs[writeErr.Index] = writeConflictError(writeErr.WriteError)
+	}
+	return errs, nil
+}
+
+// CreateWithKey creates a new user record, storing the idempotency key with it.
+// If a user has already been created with the same key, that user is returned instead of creating another.
+// ErrAlreadyExists is returned if the key has been used for a user which has since been deleted,
+// ErrIdempotencyKeyReused if it was used for a user created with different details, and ErrEmailInUse or
+// ErrNicknameInUse if the email address or nickname is used by another user
+func (store *Store) CreateWithKey(ctx context.Context, user *User, key string) (created User, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "CreateUserRecordWithKey")
+	defer span.End()
+	defer store.metrics.observe("CreateWithKey", time.Now(), &err)
+	ctx, cancel := store.writeContext(ctx)
+	defer cancel()
+	if err := store.checkIndexesBuilt(); err != nil {
+		span.RecordError(err)
+		return *user, err
+	}
+	rec := Record{
+		ID:              user.ID,
+		Data:            user,
+		Events:          []Event{eventFor(Created, user.ID, user.Version, user)},
+		IdempotencyKey:  key,
+		IdempotencyHash: PayloadHash(user),
+		Tenant:          tenant.FromContext(ctx),
+		SchemaVersion:   CurrentSchemaVersion,
+	}
+	_, err = store.collection.InsertOne(ctx, &rec)
+	if err == nil {
+		return *user, nil
+	}
+	span.RecordError(err)
+	if !mongo.IsDuplicateKeyError(err) {
+		return *user, fmt.Errorf("cannot store user record: %w", err)
+	}
+	conflict := err
+
+	var original Record
+	err = store.collection.FindOne(ctx, bson.M{"tenant": rec.Tenant, "idempotency_key": key}).Decode(&original)
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		// the conflict was with the email or nickname of another user
+		return *user, conflictError(conflict)
+	case err != nil:
+		span.RecordError(err)
+		return *user, fmt.Errorf("cannot read user record created with the same key: %w", err)
+	case original.Data == nil || original.DeletedAt != nil:
+		return *user, ErrAlreadyExists
+	case !original.SamePayload(user):
+		return *user, ErrIdempotencyKeyReused
+	}
+	return *original.Data, nil
+}
+
+// ReadOne reads a single user record of the tenant of ctx by ID. Soft deleted records are not read
 func (store *Store) ReadOne(ctx context.Context, id uuid.UUID) (user User, err error) {
 	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "ReadOneRecord")
 	defer span.End()
-	res := store.collection.FindOne(ctx, bson.M{
+	defer store.metrics.observe("ReadOne", time.Now(), &err)
+	res := store.collection.FindOne(ctx, excludeDeleted(bson.M{
 		"_id":     id,
+		"tenant":  tenant.FromContext(ctx),
 		"data.id": id, // deleted records will not have an id value but can still have events pending
-	})
+	}))
 	if err = res.Err(); err != nil {
 		span.RecordError(err)
 		if errors.Is(err, mongo.ErrNoDocuments) {
@@ -227,93 +1150,1335 @@ func (store *Store) ReadOne(ctx context.Context, id uuid.UUID) (user User, err e
 	return *rec.Data, nil
 }
 
-// UpdateOne updates a single user record, unless the provided update is stale
-func (store *Store) UpdateOne(ctx context.Context, update *User) (user User, err error) {
-	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "UpdateOneRecord")
+// ReadMany reads the users of the tenant of ctx with the given IDs, in the order of ids, in a single query. The user
+// of an id which does not exist or has been deleted is the zero User, whose ID is uuid.Nil
+func (store *Store) ReadMany(ctx context.Context, ids []uuid.UUID) (users []User, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "ReadManyRecords")
 	defer span.End()
-	rec, err := store.ReadOne(ctx, update.ID)
+	defer store.metrics.observe("ReadMany", time.Now(), &err)
+	if len(ids) == 0 {
+		return []User{}, nil
+	}
+	cur, err := store.collection.Find(ctx, excludeDeleted(bson.M{
+		"_id":    bson.M{"$in": ids},
+		"tenant": tenant.FromContext(ctx),
+		"data":   bson.M{"$ne": nil},
+	}), options.Find().SetProjection(bson.M{"data": 1}))
 	if err != nil {
 		span.RecordError(err)
-		if errors.Is(err, ErrNotFound) {
-			return user, err
+		return nil, fmt.Errorf("cannot read user records: %w", err)
+	}
+	defer cur.Close(ctx)
+	found := make([]User, 0, len(ids))
+	for cur.Next(ctx) {
+		var rec Record
+		if err = cur.Decode(&rec); err != nil {
+			span.RecordError(err)
+			return nil, fmt.Errorf("cannot decode record: %w", err)
 		}
-		return user, fmt.Errorf("cannot read record for updating: %w", err)
+		found = append(found, *rec.Data)
 	}
-	if rec.Version != update.Version {
+	if err = cur.Err(); err != nil {
 		span.RecordError(err)
-		return user, ErrInvalidVersion
+		return nil, fmt.Errorf("cannot read user records: %w", err)
 	}
+	return InOrder(ids, found), nil
+}
 
-	rec.FirstName = update.FirstName
-	rec.LastName = update.LastName
-	rec.PasswordHash = update.PasswordHash
-	rec.Country = update.Country
-	rec.CreatedAt = update.CreatedAt
-	rec.UpdatedAt = update.UpdatedAt
-	rec.Version += 1
-
-	res, err := store.collection.UpdateOne(ctx, bson.M{
-		"_id":          rec.ID,
-		"data.id":      rec.ID,
-		"data.version": update.Version,
-	}, bson.M{
-		"$set": bson.M{
-			"data": rec,
-		},
-		"$push": bson.M{
-			"events": eventFor(Updated, rec.ID, rec.Version, &rec),
-		},
-	})
-	if err != nil {
-		span.RecordError(err)
-		return user, fmt.Errorf("cannot update user record: %w", err)
+// InOrder returns users in the order of ids, for stores which read the users of ReadMany in another order. The user
+// of an id which is not among users is the zero User, whose ID is uuid.Nil
+func InOrder(ids []uuid.UUID, users []User) []User {
+	byID := make(map[uuid.UUID]User, len(users))
+	for _, usr := range users {
+		byID[usr.ID] = usr
 	}
-	if res.ModifiedCount != 1 {
-		// It is also possible to get here if the user was updated between the read and update calls.
-		// A real world implementation may want to differentiate between those states
-		span.RecordError(ErrInvalidVersion)
-		return user, ErrInvalidVersion
+	ordered := make([]User, 0, len(ids))
+	for _, id := range ids {
+		ordered = append(ordered, byID[id])
 	}
-	return rec, err
+	return ordered
 }
 
-// DeleteOne deletes a single user record
-func (store *Store) DeleteOne(ctx context.Context, id uuid.UUID) error {
-	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "DeleteOneRecord")
+// ReadRecord reads the whole record of a single user of the tenant of ctx by ID, including its pending events.
+// Unlike ReadOne, soft deleted records are read. ErrNotFound is returned if the record does not exist or has been
+// deleted irrecoverably
+func (store *Store) ReadRecord(ctx context.Context, id uuid.UUID) (rec Record, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "ReadRecord")
 	defer span.End()
-	res, err := store.collection.UpdateOne(ctx, bson.M{
+	err = store.collection.FindOne(ctx, bson.M{
 		"_id":     id,
+		"tenant":  tenant.FromContext(ctx),
 		"data.id": id,
-	}, bson.M{
-		"$set": bson.M{
-			"data": nil,
-		},
-		"$push": bson.M{
-			"events": eventFor(Deleted, id, math.MaxInt64, nil),
-		},
-	})
+	}).Decode(&rec)
 	if err != nil {
 		span.RecordError(err)
-		return fmt.Errorf("cannot delete user: %w", err)
-	}
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return rec, ErrNotFound
+		}
+		return rec, fmt.Errorf("cannot read user record: %w", err)
+	}
+	return rec, nil
+}
+
+// FindByEmail reads a single user record by email address
+func (store *Store) FindByEmail(ctx context.Context, email string) (user User, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "FindByEmail")
+	defer span.End()
+	// the unique index on tenant and data.email supports this query
+	return store.findOne(ctx, bson.M{"data.email": email})
+}
+
+// FindByNickname reads a single user record by nickname
+func (store *Store) FindByNickname(ctx context.Context, nickname string) (user User, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "FindByNickname")
+	defer span.End()
+	// the unique index on tenant and data.nickname supports this query
+	return store.findOne(ctx, bson.M{"data.nickname": nickname})
+}
+
+// EmailExists returns true if a user of the tenant of ctx has the email address email. Soft deleted users are
+// included, since their email addresses are not released until they are purged
+func (store *Store) EmailExists(ctx context.Context, email string) (bool, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "EmailExists")
+	defer span.End()
+	// the unique index on tenant and data.email supports this query
+	return store.exists(ctx, bson.M{"data.email": email})
+}
+
+// NicknameExists returns true if a user of the tenant of ctx has the nickname nickname. Soft deleted users are
+// included, since their nicknames are not released until they are purged
+func (store *Store) NicknameExists(ctx context.Context, nickname string) (bool, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "NicknameExists")
+	defer span.End()
+	// the unique index on tenant and data.nickname supports this query
+	return store.exists(ctx, bson.M{"data.nickname": nickname})
+}
+
+// exists returns true if any user record of the tenant of ctx matches filter. It stops counting at the first match
+func (store *Store) exists(ctx context.Context, filter bson.M) (bool, error) {
+	span := trace.SpanFromContext(ctx)
+	filter["tenant"] = tenant.FromContext(ctx)
+	// the unique indexes only cover records which have not been deleted irrecoverably, and are only used if the
+	// query says so
+	filter["data"] = bson.M{"$type": bsontype.EmbeddedDocument}
+	count, err := store.collection.CountDocuments(ctx, filter, options.Count().SetLimit(1))
+	if err != nil {
+		span.RecordError(err)
+		return false, fmt.Errorf("cannot count user records: %w", err)
+	}
+	return count > 0, nil
+}
+
+// findOne reads the single user record of the tenant of ctx matching filter
+func (store *Store) findOne(ctx context.Context, filter bson.M) (user User, err error) {
+	span := trace.SpanFromContext(ctx)
+	filter["tenant"] = tenant.FromContext(ctx)
+	// the unique indexes only cover records which have not been deleted, and are only used if the query says so
+	filter["data"] = bson.M{"$type": bsontype.EmbeddedDocument}
+	res := store.collection.FindOne(ctx, excludeDeleted(filter))
+	if err = res.Err(); err != nil {
+		span.RecordError(err)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return user, ErrNotFound
+		}
+		return user, fmt.Errorf("cannot find user record: %w", err)
+	}
+	var rec Record
+	if err = res.Decode(&rec); err != nil {
+		span.RecordError(err)
+		return user, fmt.Errorf("cannot decode record: %w", err)
+	}
+	return *rec.Data, nil
+}
+
+// UpdateOne updates a single user record, unless the provided update is stale
+func (store *Store) UpdateOne(ctx context.Context, update *User) (user User, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "UpdateOneRecord")
+	defer span.End()
+	defer store.metrics.observe("UpdateOne", time.Now(), &err)
+	return store.update(ctx, update, Updated)
+}
+
+// ChangePassword updates a single user record, unless the provided update is stale, as UpdateOne does.
+// The event for the change has the PasswordChanged action rather than the Updated action
+func (store *Store) ChangePassword(ctx context.Context, update *User) (user User, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "ChangePassword")
+	defer span.End()
+	return store.update(ctx, update, PasswordChanged)
+}
+
+// Anonymize updates a single user record, unless the provided update is stale, as UpdateOne does. Unlike an update,
+// the nickname and email address are also replaced, along with any password reset token or email change, two factor
+// authentication is turned off, and the event for the change has the Anonymized action
+func (store *Store) Anonymize(ctx context.Context, update *User) (user User, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "AnonymizeRecord")
+	defer span.End()
+	if err := store.checkIndexesBuilt(); err != nil {
+		span.RecordError(err)
+		return user, err
+	}
+	return store.update(ctx, update, Anonymized)
+}
+
+// ChangeStatus changes the status of a single user record to the status of update, unless the provided update is
+// stale, as UpdateOne does. The event for the change has the Suspended, Reactivated, Banned or MarkedDormant action,
+// for the suspended, active, banned and dormant statuses respectively. It returns ErrInvalidStatus for any other status
+func (store *Store) ChangeStatus(ctx context.Context, update *User) (user User, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "ChangeStatus")
+	defer span.End()
+	action, ok := statusActions[update.Status]
+	if !ok {
+		span.RecordError(ErrInvalidStatus)
+		return user, ErrInvalidStatus
+	}
+	return store.update(ctx, update, action)
+}
+
+// update updates a single user record, unless the provided update is stale, and adds an event with the given action.
+// Changing the password also removes any password reset token, since it was issued for the old password.
+// The record is read and updated in a single transaction, when the database supports them
+func (store *Store) update(ctx context.Context, update *User, action Action) (user User, err error) {
+	ctx, cancel := store.writeContext(ctx)
+	defer cancel()
+	err = store.inTransaction(ctx, func(ctx context.Context) error {
+		user, err = store.updateRead(ctx, update, action)
+		return err
+	})
+	if err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
+
+// updateRead reads the record to be changed by update and then updates it, for update
+func (store *Store) updateRead(ctx context.Context, update *User, action Action) (user User, err error) {
+	span := trace.SpanFromContext(ctx)
+	rec, err := store.ReadOne(ctx, update.ID)
+	if err != nil {
+		span.RecordError(err)
+		if errors.Is(err, ErrNotFound) {
+			return user, err
+		}
+		return user, fmt.Errorf("cannot read record for updating: %w", err)
+	}
+	if rec.Version != update.Version {
+		span.RecordError(err)
+		return user, ErrInvalidVersion
+	}
+
+	rec.FirstName = update.FirstName
+	rec.LastName = update.LastName
+	rec.PasswordHash = update.PasswordHash
+	rec.Country = update.Country
+	rec.CreatedAt = update.CreatedAt
+	rec.UpdatedAt = update.UpdatedAt
+	rec.Version += 1
+	if action == Anonymized {
+		rec.Nickname = update.Nickname
+		rec.Email = update.Email
+		rec.AvatarURL = update.AvatarURL
+		rec.TwoFactorEnabled = false
+	}
+	if action == statusActions[update.Status] {
+		rec.Status = update.Status
+	}
+
+	change := bson.M{
+		"$set": bson.M{
+			"data": rec,
+		},
+		"$push": bson.M{
+			"events": eventFor(action, rec.ID, rec.Version, &rec),
+		},
+	}
+	switch action {
+	case PasswordChanged:
+		change["$unset"] = bson.M{"reset_token": ""}
+	case Anonymized:
+		change["$unset"] = bson.M{"reset_token": "", "email_change": "", "two_factor": "", "previous_nicknames": ""}
+	}
+	res, err := store.collection.UpdateOne(ctx, store.belowEventCapacity(excludeDeleted(bson.M{
+		"_id":          rec.ID,
+		"tenant":       tenant.FromContext(ctx),
+		"data.id":      rec.ID,
+		"data.version": update.Version,
+	})), change)
+	if err != nil {
+		span.RecordError(err)
+		return user, fmt.Errorf("cannot update user record: %w", err)
+	}
 	if res.ModifiedCount != 1 {
+		// Without transactions, it is also possible to get here if the user was updated between the read and update
+		// calls. A real world implementation may want to differentiate between those states
+		err = store.eventCapacityError(ctx, rec.ID, ErrInvalidVersion)
+		span.RecordError(err)
+		return user, err
+	}
+	return rec, err
+}
+
+// Change is a change to some of the fields of a user. Fields which are nil are not changed
+type Change struct {
+	FirstName    *string
+	LastName     *string
+	PasswordHash *string
+	Country      *string
+	AvatarURL    *string
+	UpdatedAt    time.Time
+}
+
+// UpdateFields applies change to the user of the tenant of ctx with the given id, unless version is stale, and adds
+// an event with the Updated action. Unlike UpdateOne, the user is not read first: the version is checked, the
+// fields are set and the event is added by a single atomic update, so concurrent changes to other fields are not
+// overwritten. ErrNotFound is returned if there is no such user, and ErrInvalidVersion if version is stale
+func (store *Store) UpdateFields(ctx context.Context, id uuid.UUID, version int64, change *Change) (user User, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "UpdateFields")
+	defer span.End()
+	defer store.metrics.observe("UpdateFields", time.Now(), &err)
+	ctx, cancel := store.writeContext(ctx)
+	defer cancel()
+
+	// values are set with $literal so that values starting with $ are not read as field paths
+	set := bson.M{
+		"data.updated_at": bson.M{"$literal": change.UpdatedAt},
+		"data.version":    bson.M{"$add": bson.A{"$data.version", 1}},
+	}
+	if change.FirstName != nil {
+		set["data.first_name_folded"] = bson.M{"$literal": foldName(*change.FirstName)}
+	}
+	if change.LastName != nil {
+		set["data.last_name_folded"] = bson.M{"$literal": foldName(*change.LastName)}
+	}
+	for field, value := range map[string]*string{
+		"data.first_name":    change.FirstName,
+		"data.last_name":     change.LastName,
+		"data.password_hash": change.PasswordHash,
+		"data.country":       change.Country,
+		"data.avatar_url":    change.AvatarURL,
+	} {
+		if value != nil {
+			set[field] = bson.M{"$literal": *value}
+		}
+	}
+	// the event is built from the changed user by the second stage, matching the events added by eventFor
+	now := utctime.Now()
+	evt := bson.M{
+		"id":         "$data.id",
+		"state":      bson.M{"$literal": Pending},
+		"action":     bson.M{"$literal": Updated},
+		"version":    "$data.version",
+		"created_at": bson.M{"$literal": now},
+		"updated_at": bson.M{"$literal": now},
+		"data":       "$data",
+	}
+	pipeline := bson.A{
+		bson.M{"$set": set},
+		bson.M{"$set": bson.M{"events": bson.M{"$concatArrays": bson.A{
+			bson.M{"$ifNull": bson.A{"$events", bson.A{}}},
+			bson.A{evt},
+		}}}},
+	}
+
+	res := store.collection.FindOneAndUpdate(ctx, store.belowEventCapacity(excludeDeleted(bson.M{
+		"_id":          id,
+		"tenant":       tenant.FromContext(ctx),
+		"data.id":      id,
+		"data.version": version,
+	})), pipeline, options.FindOneAndUpdate().SetReturnDocument(options.After))
+	if err = res.Err(); err != nil {
+		span.RecordError(err)
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return user, fmt.Errorf("cannot update user record: %w", err)
+		}
+		// the user does not exist, the version is stale or the user cannot hold another event
+		if _, err = store.ReadOne(ctx, id); err != nil {
+			return user, err
+		}
+		return user, store.eventCapacityError(ctx, id, ErrInvalidVersion)
+	}
+	var rec Record
+	if err = res.Decode(&rec); err != nil {
+		span.RecordError(err)
+		return user, fmt.Errorf("cannot decode record: %w", err)
+	}
+	return *rec.Data, nil
+}
+
+// RecordLogin records that the user of the tenant of ctx with the given id authenticated at the given time, which is
+// also the last time they were seen. ErrNotFound is returned if there is no such user
+func (store *Store) RecordLogin(ctx context.Context, id uuid.UUID, at time.Time) error {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "RecordLogin")
+	defer span.End()
+	return store.touch(ctx, id, bson.M{"data.last_login_at": at, "data.last_seen_at": at})
+}
+
+// TouchLastSeen records that the user of the tenant of ctx with the given id was active at the given time.
+// ErrNotFound is returned if there is no such user
+func (store *Store) TouchLastSeen(ctx context.Context, id uuid.UUID, at time.Time) error {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "TouchLastSeen")
+	defer span.End()
+	return store.touch(ctx, id, bson.M{"data.last_seen_at": at})
+}
+
+// touch sets the activity times of the user with the given id to times, unless they are already later. Activity is
+// not a change to the user, so the version is not changed and no event is added, and concurrent updates which
+// check the version are not made to fail
+func (store *Store) touch(ctx context.Context, id uuid.UUID, times bson.M) error {
+	span := trace.SpanFromContext(ctx)
+	ctx, cancel := store.writeContext(ctx)
+	defer cancel()
+	res, err := store.collection.UpdateOne(ctx, excludeDeleted(bson.M{
+		"_id":     id,
+		"tenant":  tenant.FromContext(ctx),
+		"data.id": id,
+	}), bson.M{"$max": times})
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("cannot record user activity: %w", err)
+	}
+	if res.MatchedCount != 1 {
 		span.RecordError(ErrNotFound)
 		return ErrNotFound
 	}
 	return nil
 }
 
-func filterFromQuery(query *Query) bson.M {
-	f := bson.M{
+// BeginTwoFactor stores the sealed secret of a new two factor authentication enrollment of the user of the tenant of
+// ctx with the given id, replacing any enrollment which has not been confirmed. The user is not changed until the
+// enrollment is confirmed, so the version is not changed and no event is added. ErrNotFound is returned if there is
+// no such user, and ErrTwoFactorEnabled if the user already has two factor authentication enabled
+func (store *Store) BeginTwoFactor(ctx context.Context, id uuid.UUID, pendingSecret string) error {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "BeginTwoFactor")
+	defer span.End()
+	ctx, cancel := store.writeContext(ctx)
+	defer cancel()
+	res, err := store.collection.UpdateOne(ctx, excludeDeleted(bson.M{
+		"_id":                     id,
+		"tenant":                  tenant.FromContext(ctx),
+		"data.id":                 id,
+		"data.two_factor_enabled": bson.M{"$ne": true},
+	}), bson.M{
+		"$set": bson.M{"two_factor": TwoFactor{PendingSecret: pendingSecret}},
+	})
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("cannot store two factor enrollment: %w", err)
+	}
+	if res.MatchedCount != 1 {
+		// the user does not exist, or already has two factor authentication enabled
+		if _, err = store.ReadOne(ctx, id); err != nil {
+			return err
+		}
+		span.RecordError(ErrTwoFactorEnabled)
+		return ErrTwoFactorEnabled
+	}
+	return nil
+}
+
+// EnableTwoFactor confirms the enrollment with the sealed secret pendingSecret of the user of the tenant of ctx with
+// the given id. The secret becomes the secret of the user, the code with the time step step is recorded as used,
+// and recoveryCodes, which are hashes, are stored. The event for the change has the TwoFactorEnabled action.
+// ErrNotFound is returned if there is no such user, and ErrTwoFactorNotPending if the enrollment has been replaced
+// or confirmed, or the user has changed, since it was read
+func (store *Store) EnableTwoFactor(ctx context.Context, id uuid.UUID, pendingSecret string, step int64, recoveryCodes []string) (user User, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "EnableTwoFactor")
+	defer span.End()
+	ctx, cancel := store.writeContext(ctx)
+	defer cancel()
+	rec, err := store.ReadOne(ctx, id)
+	if err != nil {
+		span.RecordError(err)
+		if errors.Is(err, ErrNotFound) {
+			return user, err
+		}
+		return user, fmt.Errorf("cannot read record for enabling two factor authentication: %w", err)
+	}
+
+	rec.TwoFactorEnabled = true
+	rec.UpdatedAt = utctime.Now()
+	rec.Version += 1
+	res, err := store.collection.UpdateOne(ctx, store.belowEventCapacity(excludeDeleted(bson.M{
+		"_id":                       id,
+		"tenant":                    tenant.FromContext(ctx),
+		"data.id":                   id,
+		"data.version":              rec.Version - 1,
+		"two_factor.pending_secret": pendingSecret,
+	})), bson.M{
+		"$set": bson.M{
+			"data": rec,
+			"two_factor": TwoFactor{
+				Secret:        pendingSecret,
+				LastStep:      step,
+				RecoveryCodes: recoveryCodes,
+			},
+		},
+		"$push": bson.M{
+			"events": eventFor(TwoFactorEnabled, rec.ID, rec.Version, &rec),
+		},
+	})
+	if err != nil {
+		span.RecordError(err)
+		return user, fmt.Errorf("cannot enable two factor authentication: %w", err)
+	}
+	if res.ModifiedCount != 1 {
+		err = store.eventCapacityError(ctx, id, ErrTwoFactorNotPending)
+		span.RecordError(err)
+		return user, err
+	}
+	return rec, nil
+}
+
+// DisableTwoFactor turns two factor authentication off for the user of the tenant of ctx with the given id, and
+// removes its secrets. The event for the change has the TwoFactorDisabled action. ErrNotFound is returned if there
+// is no such user, ErrTwoFactorNotEnabled if the user does not have two factor authentication enabled, and
+// ErrInvalidVersion if the user changed while it was being disabled
+func (store *Store) DisableTwoFactor(ctx context.Context, id uuid.UUID) (user User, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "DisableTwoFactor")
+	defer span.End()
+	ctx, cancel := store.writeContext(ctx)
+	defer cancel()
+	rec, err := store.ReadOne(ctx, id)
+	if err != nil {
+		span.RecordError(err)
+		if errors.Is(err, ErrNotFound) {
+			return user, err
+		}
+		return user, fmt.Errorf("cannot read record for disabling two factor authentication: %w", err)
+	}
+	if !rec.TwoFactorEnabled {
+		span.RecordError(ErrTwoFactorNotEnabled)
+		return user, ErrTwoFactorNotEnabled
+	}
+
+	rec.TwoFactorEnabled = false
+	rec.UpdatedAt = utctime.Now()
+	rec.Version += 1
+	res, err := store.collection.UpdateOne(ctx, store.belowEventCapacity(excludeDeleted(bson.M{
+		"_id":          id,
+		"tenant":       tenant.FromContext(ctx),
+		"data.id":      id,
+		"data.version": rec.Version - 1,
+	})), bson.M{
+		"$set": bson.M{
+			"data": rec,
+		},
+		"$unset": bson.M{
+			"two_factor": "",
+		},
+		"$push": bson.M{
+			"events": eventFor(TwoFactorDisabled, rec.ID, rec.Version, &rec),
+		},
+	})
+	if err != nil {
+		span.RecordError(err)
+		return user, fmt.Errorf("cannot disable two factor authentication: %w", err)
+	}
+	if res.ModifiedCount != 1 {
+		err = store.eventCapacityError(ctx, id, ErrInvalidVersion)
+		span.RecordError(err)
+		return user, err
+	}
+	return rec, nil
+}
+
+// UseTwoFactorStep records that a code with the time step step has been accepted for the user of the tenant of ctx
+// with the given id. ErrTwoFactorCodeRejected is returned if a code with the same or a later step has already been
+// accepted, so that codes cannot be replayed, or the user does not have two factor authentication enabled
+func (store *Store) UseTwoFactorStep(ctx context.Context, id uuid.UUID, step int64) error {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "UseTwoFactorStep")
+	defer span.End()
+	return store.useTwoFactorCode(ctx, id, bson.M{"two_factor.last_step": bson.M{"$lt": step}}, bson.M{
+		"$set": bson.M{"two_factor.last_step": step},
+	})
+}
+
+// UseRecoveryCode removes the recovery code with the hash codeHash from the user of the tenant of ctx with the given
+// id, so that it cannot be used again. ErrTwoFactorCodeRejected is returned if the user does not have the code
+func (store *Store) UseRecoveryCode(ctx context.Context, id uuid.UUID, codeHash string) error {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "UseRecoveryCode")
+	defer span.End()
+	return store.useTwoFactorCode(ctx, id, bson.M{"two_factor.recovery_codes": codeHash}, bson.M{
+		"$pull": bson.M{"two_factor.recovery_codes": codeHash},
+	})
+}
+
+// useTwoFactorCode applies change to the user with the given id, if it has two factor authentication enabled and
+// matches filter. Using a code does not change the user, so the version is not changed and no event is added
+func (store *Store) useTwoFactorCode(ctx context.Context, id uuid.UUID, filter bson.M, change bson.M) error {
+	span := trace.SpanFromContext(ctx)
+	ctx, cancel := store.writeContext(ctx)
+	defer cancel()
+	filter["_id"] = id
+	filter["tenant"] = tenant.FromContext(ctx)
+	filter["data.id"] = id
+	filter["data.two_factor_enabled"] = true
+	res, err := store.collection.UpdateOne(ctx, excludeDeleted(filter), change)
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("cannot use two factor authentication code: %w", err)
+	}
+	if res.ModifiedCount != 1 {
+		span.RecordError(ErrTwoFactorCodeRejected)
+		return ErrTwoFactorCodeRejected
+	}
+	return nil
+}
+
+// RequestPasswordReset stores a password reset token for the user of the tenant of ctx with the given id, replacing
+// any token issued before. The record stores reset, which holds the hash of token, and a PasswordResetRequested event
+// which carries token itself so that it can be sent to the user
+func (store *Store) RequestPasswordReset(ctx context.Context, id uuid.UUID, token string, reset ResetToken) error {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "RequestPasswordReset")
+	defer span.End()
+	ctx, cancel := store.writeContext(ctx)
+	defer cancel()
+	rec, err := store.ReadOne(ctx, id)
+	if err != nil {
+		span.RecordError(err)
+		if errors.Is(err, ErrNotFound) {
+			return err
+		}
+		return fmt.Errorf("cannot read record for password reset: %w", err)
+	}
+
+	evt := eventFor(PasswordResetRequested, rec.ID, rec.Version, &rec)
+	evt.Token = token
+	res, err := store.collection.UpdateOne(ctx, store.belowEventCapacity(excludeDeleted(bson.M{
+		"_id":     rec.ID,
+		"tenant":  tenant.FromContext(ctx),
+		"data.id": rec.ID,
+	})), bson.M{
+		"$set": bson.M{
+			"reset_token": reset,
+		},
+		"$push": bson.M{
+			"events": evt,
+		},
+	})
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("cannot store password reset token: %w", err)
+	}
+	if res.ModifiedCount != 1 {
+		// the user was deleted between the read and update calls, or cannot hold another event
+		err = store.eventCapacityError(ctx, id, ErrNotFound)
+		span.RecordError(err)
+		return err
+	}
+	return nil
+}
+
+// ResetPassword sets the password hash of the user of the tenant of ctx holding an unexpired reset token with the
+// hash tokenHash, and removes the token so that it cannot be used again. The event for the change has the
+// PasswordChanged action. ErrInvalidResetToken is returned if no user holds a matching token
+func (store *Store) ResetPassword(ctx context.Context, tokenHash, passwordHash string) (user User, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "ResetPassword")
+	defer span.End()
+	ctx, cancel := store.writeContext(ctx)
+	defer cancel()
+	filter := excludeDeleted(bson.M{
+		"tenant":                 tenant.FromContext(ctx),
+		"reset_token.hash":       tokenHash,
+		"reset_token.expires_at": bson.M{"$gt": utctime.Now()},
+		"data":                   bson.M{"$type": bsontype.EmbeddedDocument},
+	})
+	var rec Record
+	if err = store.collection.FindOne(ctx, filter).Decode(&rec); err != nil {
+		span.RecordError(err)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return user, ErrInvalidResetToken
+		}
+		return user, fmt.Errorf("cannot find user record by reset token: %w", err)
+	}
+	if err = store.checkRecordEventCapacity(&rec); err != nil {
+		span.RecordError(err)
+		return user, err
+	}
+
+	user = *rec.Data
+	user.PasswordHash = passwordHash
+	user.UpdatedAt = utctime.Now()
+	user.Version += 1
+
+	filter["_id"] = rec.ID
+	filter["data.version"] = rec.Data.Version
+	store.belowEventCapacity(filter)
+	res, err := store.collection.UpdateOne(ctx, filter, bson.M{
+		"$set": bson.M{
+			"data": user,
+		},
+		"$unset": bson.M{
+			"reset_token": "",
+		},
+		"$push": bson.M{
+			"events": eventFor(PasswordChanged, user.ID, user.Version, &user),
+		},
+	})
+	if err != nil {
+		span.RecordError(err)
+		return user, fmt.Errorf("cannot reset password: %w", err)
+	}
+	if res.ModifiedCount != 1 {
+		// the token was used, or the user was changed, between the find and update calls
+		err = store.eventCapacityError(ctx, rec.ID, ErrInvalidResetToken)
+		span.RecordError(err)
+		return user, err
+	}
+	return user, nil
+}
+
+// RequestEmailChange stores a change of email address for the user of the tenant of ctx with the given id, unless the
+// provided version is stale, replacing any change requested before. The record stores change, which holds the hash of
+// token, and an EmailChangeRequested event which carries token itself so that it can be sent to the new address
+func (store *Store) RequestEmailChange(ctx context.Context, id uuid.UUID, version int64, token string, change EmailChange) error {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "RequestEmailChange")
+	defer span.End()
+	ctx, cancel := store.writeContext(ctx)
+	defer cancel()
+	rec, err := store.ReadOne(ctx, id)
+	if err != nil {
+		span.RecordError(err)
+		if errors.Is(err, ErrNotFound) {
+			return err
+		}
+		return fmt.Errorf("cannot read record for email change: %w", err)
+	}
+	if rec.Version != version {
+		span.RecordError(ErrInvalidVersion)
+		return ErrInvalidVersion
+	}
+
+	evt := eventFor(EmailChangeRequested, rec.ID, rec.Version, &rec)
+	evt.Token = token
+	evt.Email = change.Email
+	res, err := store.collection.UpdateOne(ctx, store.belowEventCapacity(excludeDeleted(bson.M{
+		"_id":          rec.ID,
+		"tenant":       tenant.FromContext(ctx),
+		"data.id":      rec.ID,
+		"data.version": version,
+	})), bson.M{
+		"$set": bson.M{
+			"email_change": change,
+		},
+		"$push": bson.M{
+			"events": evt,
+		},
+	})
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("cannot store email change: %w", err)
+	}
+	if res.ModifiedCount != 1 {
+		// the user was changed or deleted between the read and update calls, or cannot hold another event
+		err = store.eventCapacityError(ctx, id, ErrInvalidVersion)
+		span.RecordError(err)
+		return err
+	}
+	return nil
+}
+
+// ConfirmEmailChange sets the email address of the user of the tenant of ctx with an unexpired email change with
+// the token hash tokenHash to the new address, and removes the change so that it cannot be confirmed again. The
+// unique index on email addresses is checked again when the change is confirmed, so ErrEmailInUse is returned
+// if another user has taken the address since the change was requested. ErrInvalidEmailChangeToken is returned if
+// no user has a matching change
+func (store *Store) ConfirmEmailChange(ctx context.Context, tokenHash string) (user User, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "ConfirmEmailChange")
+	defer span.End()
+	defer store.metrics.observe("ConfirmEmailChange", time.Now(), &err)
+	ctx, cancel := store.writeContext(ctx)
+	defer cancel()
+	if err := store.checkIndexesBuilt(); err != nil {
+		span.RecordError(err)
+		return user, err
+	}
+	filter := excludeDeleted(bson.M{
+		"tenant":                  tenant.FromContext(ctx),
+		"email_change.hash":       tokenHash,
+		"email_change.expires_at": bson.M{"$gt": utctime.Now()},
+		"data":                    bson.M{"$type": bsontype.EmbeddedDocument},
+	})
+	var rec Record
+	if err = store.collection.FindOne(ctx, filter).Decode(&rec); err != nil {
+		span.RecordError(err)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return user, ErrInvalidEmailChangeToken
+		}
+		return user, fmt.Errorf("cannot find user record by email change token: %w", err)
+	}
+	if err = store.checkRecordEventCapacity(&rec); err != nil {
+		span.RecordError(err)
+		return user, err
+	}
+
+	user = *rec.Data
+	user.Email = rec.EmailChange.Email
+	user.UpdatedAt = utctime.Now()
+	user.Version += 1
+
+	filter["_id"] = rec.ID
+	filter["data.version"] = rec.Data.Version
+	store.belowEventCapacity(filter)
+	res, err := store.collection.UpdateOne(ctx, filter, bson.M{
+		"$set": bson.M{
+			"data": user,
+		},
+		"$unset": bson.M{
+			"email_change": "",
+		},
+		"$push": bson.M{
+			"events": eventFor(EmailChanged, user.ID, user.Version, &user),
+		},
+	})
+	if err != nil {
+		span.RecordError(err)
+		if mongo.IsDuplicateKeyError(err) {
+			return user, conflictError(err)
+		}
+		return user, fmt.Errorf("cannot change email: %w", err)
+	}
+	if res.ModifiedCount != 1 {
+		// the change was confirmed, or the user was changed, between the find and update calls
+		err = store.eventCapacityError(ctx, rec.ID, ErrInvalidEmailChangeToken)
+		span.RecordError(err)
+		return user, err
+	}
+	return user, nil
+}
+
+// ChangeNickname changes the nickname of the user of the tenant of ctx with the given id, unless version is stale,
+// adds the current nickname to the previous nicknames of the user and adds an event with the NicknameChanged action.
+// ErrNotFound is returned if there is no such user, ErrInvalidVersion if version is stale, ErrNicknameChangeTooSoon
+// if the nickname was last changed less than cooldown ago, and ErrNicknameInUse if another user has the nickname
+func (store *Store) ChangeNickname(ctx context.Context, id uuid.UUID, version int64, nickname string, cooldown time.Duration) (user User, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "ChangeNickname")
+	defer span.End()
+	defer store.metrics.observe("ChangeNickname", time.Now(), &err)
+	ctx, cancel := store.writeContext(ctx)
+	defer cancel()
+	if err := store.checkIndexesBuilt(); err != nil {
+		span.RecordError(err)
+		return user, err
+	}
+	filter := excludeDeleted(bson.M{
+		"_id":     id,
+		"tenant":  tenant.FromContext(ctx),
+		"data.id": id,
+	})
+	var rec Record
+	if err = store.collection.FindOne(ctx, filter).Decode(&rec); err != nil {
+		span.RecordError(err)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return user, ErrNotFound
+		}
+		return user, fmt.Errorf("cannot read record for changing nickname: %w", err)
+	}
+	if rec.Data.Version != version {
+		span.RecordError(ErrInvalidVersion)
+		return user, ErrInvalidVersion
+	}
+	now := utctime.Now()
+	if n := len(rec.PreviousNicknames); n > 0 && rec.PreviousNicknames[n-1].ChangedAt.After(now.Add(-cooldown)) {
+		span.RecordError(ErrNicknameChangeTooSoon)
+		return user, ErrNicknameChangeTooSoon
+	}
+	if err = store.checkRecordEventCapacity(&rec); err != nil {
+		span.RecordError(err)
+		return user, err
+	}
+
+	user = *rec.Data
+	user.Nickname = nickname
+	user.UpdatedAt = now
+	user.Version += 1
+
+	// the version changes with every change of nickname, so checking it also ensures that the cooldown has passed
+	filter["data.version"] = version
+	store.belowEventCapacity(filter)
+	res, err := store.collection.UpdateOne(ctx, filter, bson.M{
+		"$set": bson.M{
+			"data": user,
+		},
+		"$push": bson.M{
+			"previous_nicknames": PreviousNickname{Nickname: rec.Data.Nickname, ChangedAt: now},
+			"events":             eventFor(NicknameChanged, user.ID, user.Version, &user),
+		},
+	})
+	if err != nil {
+		span.RecordError(err)
+		if mongo.IsDuplicateKeyError(err) {
+			return user, conflictError(err)
+		}
+		return user, fmt.Errorf("cannot change nickname: %w", err)
+	}
+	if res.ModifiedCount != 1 {
+		// the user was changed or deleted between the read and update calls
+		err = store.eventCapacityError(ctx, rec.ID, ErrInvalidVersion)
+		span.RecordError(err)
+		return user, err
+	}
+	return user, nil
+}
+
+// DeleteOne deletes a single user record. It is soft deleted if the store was created with NewWithRetention.
+// The record is read and deleted in a single transaction, when the database supports them
+func (store *Store) DeleteOne(ctx context.Context, id uuid.UUID) (err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "DeleteOneRecord")
+	defer span.End()
+	defer store.metrics.observe("DeleteOne", time.Now(), &err)
+	ctx, cancel := store.writeContext(ctx)
+	defer cancel()
+	return store.inTransaction(ctx, func(ctx context.Context) error {
+		user, err := store.ReadOne(ctx, id)
+		if err != nil {
+			span.RecordError(err)
+			return err
+		}
+		res, err := store.collection.UpdateOne(ctx, deleteFilter(tenant.FromContext(ctx), id), store.deleteUpdate(id, user.Email))
+		if err != nil {
+			span.RecordError(err)
+			return fmt.Errorf("cannot delete user: %w", err)
+		}
+		if res.ModifiedCount != 1 {
+			span.RecordError(ErrNotFound)
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+func deleteFilter(tenantID string, id uuid.UUID) bson.M {
+	return excludeDeleted(bson.M{
+		"_id":     id,
+		"tenant":  tenantID,
+		"data.id": id,
+	})
+}
+
+// deleteUpdate returns the update which deletes the record with the given id. Soft deletes keep the data of the
+// record, so that it can be restored. Either way, the event for the deletion does not carry the data, only the email
+// address of the user, so that the deletion can be confirmed to them
+func (store *Store) deleteUpdate(id uuid.UUID, email string) bson.M {
+	set := bson.M{"data": nil}
+	if store.retention > 0 {
+		set = bson.M{"deleted_at": utctime.Now()}
+	}
+	evt := eventFor(Deleted, id, math.MaxInt64, nil)
+	evt.Email = email
+	return bson.M{
+		"$set": set,
+		"$push": bson.M{
+			"events": evt,
+		},
+	}
+}
+
+// Restore restores the soft deleted user record of the tenant of ctx with the given ID, if it was deleted less than
+// the retention of the store ago. The event for the restore has the Restored action, and the version of the user is
+// incremented. ErrNotFound is returned if there is no such record, which is always the case for stores which delete
+// users irrecoverably
+func (store *Store) Restore(ctx context.Context, id uuid.UUID) (user User, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "RestoreRecord")
+	defer span.End()
+	ctx, cancel := store.writeContext(ctx)
+	defer cancel()
+	filter := bson.M{
+		"_id":        id,
+		"tenant":     tenant.FromContext(ctx),
+		"data.id":    id,
+		"deleted_at": bson.M{"$gt": utctime.Now().Add(-store.retention)},
+	}
+	var rec Record
+	if err = store.collection.FindOne(ctx, filter).Decode(&rec); err != nil {
+		span.RecordError(err)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return user, ErrNotFound
+		}
+		return user, fmt.Errorf("cannot read record for restoring: %w", err)
+	}
+	if err = store.checkRecordEventCapacity(&rec); err != nil {
+		span.RecordError(err)
+		return user, err
+	}
+
+	user = *rec.Data
+	user.UpdatedAt = utctime.Now()
+	user.Version += 1
+
+	filter["data.version"] = rec.Data.Version
+	store.belowEventCapacity(filter)
+	res, err := store.collection.UpdateOne(ctx, filter, bson.M{
+		"$set": bson.M{
+			"data": user,
+		},
+		"$unset": bson.M{
+			"deleted_at": "",
+		},
+		"$push": bson.M{
+			"events": eventFor(Restored, user.ID, user.Version, &user),
+		},
+	})
+	if err != nil {
+		span.RecordError(err)
+		return user, fmt.Errorf("cannot restore user record: %w", err)
+	}
+	if res.ModifiedCount != 1 {
+		// the record was restored or purged between the read and update calls
+		err = store.eventCapacityError(ctx, rec.ID, ErrNotFound)
+		span.RecordError(err)
+		return user, err
+	}
+	return user, nil
+}
+
+// Replay adds an event with the Replayed action carrying the current state of the user of the tenant of ctx with the
+// given id, without changing the user or its version. ErrNotFound is returned if there is no such user, and
+// ErrInvalidVersion if the user was changed after it was read, in which case the event for that change carries the
+// current state
+func (store *Store) Replay(ctx context.Context, id uuid.UUID) (user User, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "ReplayRecord")
+	defer span.End()
+	ctx, cancel := store.writeContext(ctx)
+	defer cancel()
+	user, err = store.ReadOne(ctx, id)
+	if err != nil {
+		span.RecordError(err)
+		if errors.Is(err, ErrNotFound) {
+			return user, err
+		}
+		return user, fmt.Errorf("cannot read record for replaying: %w", err)
+	}
+
+	res, err := store.collection.UpdateOne(ctx, store.belowEventCapacity(excludeDeleted(bson.M{
+		"_id":          id,
+		"tenant":       tenant.FromContext(ctx),
+		"data.id":      id,
+		"data.version": user.Version,
+	})), bson.M{
+		"$push": bson.M{
+			"events": eventFor(Replayed, user.ID, user.Version, &user),
+		},
+	})
+	if err != nil {
+		span.RecordError(err)
+		return user, fmt.Errorf("cannot add replayed event: %w", err)
+	}
+	if res.ModifiedCount != 1 {
+		err = store.eventCapacityError(ctx, id, ErrInvalidVersion)
+		span.RecordError(err)
+		return user, err
+	}
+	return user, nil
+}
+
+// Purge irrecoverably deletes the records of every tenant which were soft deleted more than the retention of the store
+// ago, returning the number of records purged. No events are added, since the deletions have already been published
+func (store *Store) Purge(ctx context.Context) (int64, error) {
+	if store.retention == 0 {
+		return 0, nil
+	}
+	return store.PurgeDeletedBefore(ctx, utctime.Now().Add(-store.retention))
+}
+
+// PurgeDeletedBefore irrecoverably deletes the records of every tenant which were soft deleted at or before cutoff,
+// returning the number of records purged. It lets a scheduled job purge with a cutoff of its own, whatever the
+// retention of the store
+func (store *Store) PurgeDeletedBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "PurgeRecords")
+	defer span.End()
+	res, err := store.collection.UpdateMany(ctx, bson.M{
+		"deleted_at": bson.M{"$lte": cutoff},
+	}, bson.M{
+		"$set": bson.M{
+			"data": nil,
+		},
+		"$unset": bson.M{
+			"deleted_at":   "",
+			"reset_token":  "",
+			"email_change": "",
+		},
+	})
+	if err != nil {
+		span.RecordError(err)
+		return 0, fmt.Errorf("cannot purge deleted users: %w", err)
+	}
+	// the events of users deleted before their retention has passed have usually been processed already
+	if err = store.expireDrained(ctx, bson.M{}); err != nil {
+		span.RecordError(err)
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
+
+// expireDrained sets the expiry time of the records matching filter which belong to irrecoverably deleted users and
+// have no events waiting to be processed, so that they are removed by the database once TombstoneRetention has passed
+func (store *Store) expireDrained(ctx context.Context, filter bson.M) error {
+	filter["data"] = nil
+	filter["events"] = bson.M{"$size": 0}
+	filter["expires_at"] = bson.M{"$exists": false}
+	_, err := store.collection.UpdateMany(ctx, filter, bson.M{
+		"$set": bson.M{"expires_at": utctime.Now().Add(store.options.TombstoneRetention)},
+	})
+	if err != nil {
+		return fmt.Errorf("cannot expire records of deleted users: %w", err)
+	}
+	return nil
+}
+
+// MarkDormant changes the status of the active users of every tenant who have not been seen since the given time,
+// including users created before it who have never been seen, to dormant, adding an event with the MarkedDormant
+// action for each. It returns the number of users made dormant. A user who is changed by another caller while they
+// are being made dormant is skipped, since they may no longer be inactive
+func (store *Store) MarkDormant(ctx context.Context, inactiveSince time.Time) (int64, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "MarkDormantRecords")
+	defer span.End()
+	cur, err := store.collection.Find(ctx, excludeDeleted(bson.M{
+		"data":              bson.M{"$type": bsontype.EmbeddedDocument},
+		"data.status":       bson.M{"$in": bson.A{StatusActive, nil}},
+		"data.created_at":   bson.M{"$lt": inactiveSince},
+		"data.last_seen_at": bson.M{"$not": bson.M{"$gte": inactiveSince}},
+	}), options.Find().SetProjection(bson.M{"_id": 1, "data": 1, "tenant": 1}))
+	if err != nil {
+		span.RecordError(err)
+		return 0, fmt.Errorf("cannot find inactive users: %w", err)
+	}
+	defer cur.Close(ctx)
+
+	var marked int64
+	for cur.Next(ctx) {
+		var rec Record
+		if err := cur.Decode(&rec); err != nil {
+			span.RecordError(err)
+			return marked, fmt.Errorf("cannot read inactive user: %w", err)
+		}
+		version := rec.Data.Version
+		rec.Data.Status = StatusDormant
+		rec.Data.UpdatedAt = utctime.Now()
+		rec.Data.Version += 1
+		res, err := store.collection.UpdateOne(ctx, store.belowEventCapacity(excludeDeleted(bson.M{
+			"_id":          rec.ID,
+			"tenant":       rec.Tenant,
+			"data.version": version,
+		})), bson.M{
+			"$set":  bson.M{"data": rec.Data},
+			"$push": bson.M{"events": eventFor(MarkedDormant, rec.ID, rec.Data.Version, rec.Data)},
+		})
+		if err != nil {
+			span.RecordError(err)
+			return marked, fmt.Errorf("cannot make user dormant: %w", err)
+		}
+		// users which hold the MaxPendingEvents of the store are left to be marked once their events are published
+		marked += res.ModifiedCount
+	}
+	if err := cur.Err(); err != nil {
+		span.RecordError(err)
+		return marked, fmt.Errorf("cannot find inactive users: %w", err)
+	}
+	return marked, nil
+}
+
+// DeleteManyError is returned by DeleteMany when some of the records could not be deleted. The IDs of the records
+// which were deleted are returned with it
+type DeleteManyError struct {
+	// Failed holds the error for the ID of each record which could not be deleted
+	Failed map[uuid.UUID]error
+}
+
+func (e *DeleteManyError) Error() string {
+	return fmt.Sprintf("cannot delete %d of the user records", len(e.Failed))
+}
+
+// DeleteMany deletes the user records with the given IDs and returns the IDs of the deleted records.
+// IDs of records which do not exist or are already deleted are not returned. As with DeleteOne, records are soft
+// deleted if the store was created with NewWithRetention.
+// The records are found and deleted in a single transaction, when the database supports them, so either every record
+// is deleted along with its event or none are. Without transactions, a record deleted by another caller between
+// finding and deleting the records is still returned, since it has been deleted either way, and a record which cannot
+// be deleted does not prevent the others from being deleted. A *DeleteManyError is then returned with the IDs of the
+// records which were deleted
+func (store *Store) DeleteMany(ctx context.Context, ids []uuid.UUID) (deleted []uuid.UUID, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "DeleteManyRecords")
+	defer span.End()
+	ctx, cancel := store.writeContext(ctx)
+	defer cancel()
+	err = store.inTransaction(ctx, func(ctx context.Context) error {
+		deleted, err = store.deleteMany(ctx, ids)
+		return err
+	})
+	var partial *DeleteManyError
+	if err != nil && !errors.As(err, &partial) {
+		return nil, err
+	}
+	return deleted, err
+}
+
+// deleteMany finds and then deletes the records with the given IDs, for DeleteMany
+func (store *Store) deleteMany(ctx context.Context, ids []uuid.UUID) ([]uuid.UUID, error) {
+	span := trace.SpanFromContext(ctx)
+	tenantID := tenant.FromContext(ctx)
+	cur, err := store.collection.Find(ctx, excludeDeleted(bson.M{
+		"_id":    bson.M{"$in": ids},
+		"tenant": tenantID,
+		"data":   bson.M{"$type": bsontype.EmbeddedDocument},
+	}), options.Find().SetProjection(bson.M{"_id": 1, "data.email": 1}))
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("cannot find users to delete: %w", err)
+	}
+	var recs []Record
+	if err := cur.All(ctx, &recs); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("cannot read users to delete: %w", err)
+	}
+	if len(recs) == 0 {
+		return nil, nil
+	}
+
+	deleted := make([]uuid.UUID, 0, len(recs))
+	models := make([]mongo.WriteModel, 0, len(recs))
+	for _, rec := range recs {
+		deleted = append(deleted, rec.ID)
+		models = append(models, mongo.NewUpdateOneModel().SetFilter(deleteFilter(tenantID, rec.ID)).SetUpdate(store.deleteUpdate(rec.ID, rec.Data.Email)))
+	}
+	_, err = store.collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	if err == nil {
+		return deleted, nil
+	}
+	span.RecordError(err)
+	var bulkErr mongo.BulkWriteException
+	// in a transaction a write error aborts the whole batch, so only a batch written without one is partly deleted
+	if mongo.SessionFromContext(ctx) != nil || !errors.As(err, &bulkErr) || bulkErr.WriteConcernError != nil {
+		return nil, fmt.Errorf("cannot delete users: %w", err)
+	}
+	partial := &DeleteManyError{Failed: make(map[uuid.UUID]error, len(bulkErr.WriteErrors))}
+	for _, writeErr := range bulkErr.WriteErrors {
+		partial.Failed[deleted[writeErr.Index]] = writeErr
+	}
+	kept := deleted[:0]
+	for _, id := range deleted {
+		if partial.Failed[id] == nil {
+			kept = append(kept, id)
+		}
+	}
+	return kept, partial
+}
+
+// filterFromQuery returns the filter for users of the tenant of ctx matching query. Soft deleted users never match.
+// The filter requires the data of the record to be a document, as the partial indexes on email addresses and
+// nicknames do, so that queries by them can use those indexes
+func filterFromQuery(ctx context.Context, query *Query) bson.M {
+	f := excludeDeleted(bson.M{
+		"tenant":          tenant.FromContext(ctx),
+		"data":            bson.M{"$type": bsontype.EmbeddedDocument},
 		"data.created_at": bson.M{"$gte": query.CreatedAfter},
+	})
+	switch len(query.Countries) {
+	case 0:
+	case 1:
+		f["data.country"] = bson.M{"$eq": query.Countries[0]}
+	default:
+		f["data.country"] = bson.M{"$in": query.Countries}
+	}
+	createdBefore := query.CreatedBefore
+	if !query.InactiveSince.IsZero() {
+		// users are seen after they are created, so users who were last seen before the time were created before it
+		if createdBefore.IsZero() || query.InactiveSince.Before(createdBefore) {
+			createdBefore = query.InactiveSince
+		}
+		f["data.last_seen_at"] = bson.M{"$not": bson.M{"$gte": query.InactiveSince}}
 	}
-	if query.Country != "" {
-		f["data.country"] = bson.M{"$eq": query.Country}
+	if !createdBefore.IsZero() {
+		f["data.created_at"].(bson.M)["$lt"] = createdBefore
+	}
+	switch query.Status {
+	case "":
+	case StatusActive:
+		// records stored before users had a status are active
+		f["data.status"] = bson.M{"$in": bson.A{StatusActive, nil}}
+	default:
+		f["data.status"] = bson.M{"$eq": query.Status}
+	}
+	if query.Search != "" {
+		prefix := primitive.Regex{Pattern: "^" + regexp.QuoteMeta(query.Search)}
+		f["$or"] = bson.A{
+			bson.M{"data.nickname": query.Search},
+			bson.M{"data.email": query.Search},
+			bson.M{"data.first_name": prefix},
+			bson.M{"data.last_name": prefix},
+		}
+	}
+	if query.Nickname != "" {
+		f["data.nickname"] = bson.M{"$eq": query.Nickname}
+	}
+	if query.Email != "" {
+		f["data.email"] = bson.M{"$eq": query.Email}
+	}
+	if query.NamePrefix != "" {
+		// the folded names are compared with a case sensitive prefix, so that the indexes on them are used. The
+		// condition is in an $and, so that it does not replace the $or of the search
+		prefix := primitive.Regex{Pattern: "^" + regexp.QuoteMeta(foldName(query.NamePrefix))}
+		f["$and"] = bson.A{bson.M{"$or": bson.A{
+			bson.M{"data.first_name_folded": prefix},
+			bson.M{"data.last_name_folded": prefix},
+		}}}
 	}
 	return f
 }
 
+// sortFromQuery returns the sort order for the query. The id is used as a tie breaker so that the order of
+// results is stable between pages. Nicknames are unique, so users sorted by them are not sorted by id, and the
+// unique index on them gives the order
+func sortFromQuery(query *Query) (bson.D, error) {
+	field := query.SortBy
+	if field == "" {
+		field = SortCreatedAt
+	}
+	key, ok := sortKeys[field]
+	if !ok || (query.AfterID != uuid.Nil && field != SortCreatedAt) {
+		return nil, ErrInvalidSort
+	}
+	direction := 1
+	if query.SortDescending {
+		direction = -1
+	}
+	if field == SortNickname {
+		return bson.D{bson.E{Key: key, Value: direction}}, nil
+	}
+	return bson.D{
+		bson.E{Key: key, Value: direction},
+		bson.E{Key: "_id", Value: direction},
+	}, nil
+}
+
+// afterFilter returns the filter for the users after the user identified by the AfterID and AfterCreatedAt of query,
+// in the order given by sortFromQuery
+func afterFilter(query *Query) bson.M {
+	operator := "$gt"
+	if query.SortDescending {
+		operator = "$lt"
+	}
+	return bson.M{"$or": bson.A{
+		bson.M{"data.created_at": bson.M{operator: query.AfterCreatedAt}},
+		bson.M{"data.created_at": query.AfterCreatedAt, "_id": bson.M{operator: query.AfterID}},
+	}}
+}
+
+// findFilter returns the filter matching the users on the pages of the given query from its first page, or from the
+// user it starts after
+func findFilter(ctx context.Context, query *Query) bson.M {
+	filter := filterFromQuery(ctx, query)
+	if query.AfterID != uuid.Nil {
+		filter = bson.M{"$and": bson.A{filter, afterFilter(query)}}
+	}
+	return filter
+}
+
+// skipFromQuery returns the number of users to skip to reach the page of the query. No users are skipped when the
+// query starts after a user
 func skipFromQuery(query *Query) int64 {
+	if query.AfterID != uuid.Nil {
+		return 0
+	}
 	skip := int64(query.Length) * (query.Page - 1)
 	if skip < int64(0) {
 		skip = int64(0)
@@ -321,6 +2486,15 @@ func skipFromQuery(query *Query) int64 {
 	return skip
 }
 
+// limitFromQuery returns the number of users to read for the page of the query. When the query skips counting the
+// matching users, one more user is read, to find whether more users follow the page
+func limitFromQuery(query *Query) int64 {
+	if query.SkipTotal && query.Length > 0 {
+		return int64(query.Length) + 1
+	}
+	return int64(query.Length)
+}
+
 type totalResult struct {
 	count int64
 	err   error
@@ -329,10 +2503,19 @@ type totalResult struct {
 // findTotal reads the total count of user records matching the given query
 func (store *Store) findTotal(ctx context.Context, query *Query) <-chan totalResult {
 	out := make(chan totalResult)
+	if query.SkipTotal {
+		go func() {
+			select {
+			case <-ctx.Done():
+			case out <- totalResult{count: UnknownTotal}:
+			}
+		}()
+		return out
+	}
 	go func(q Query) {
 		var err error
 		var count int64
-		count, err = store.collection.CountDocuments(ctx, filterFromQuery(&q))
+		count, err = store.queries.CountDocuments(ctx, filterFromQuery(ctx, &q))
 		if err != nil {
 			err = fmt.Errorf("cannot count matching users: %w", err)
 		}
@@ -349,33 +2532,18 @@ type itemsResult struct {
 	err   error
 }
 
-// findItems items returns a page of users matching the given query
+// findItems reads the page of users matching the given query from an iterator
 func (store *Store) findItems(ctx context.Context, query *Query) <-chan itemsResult {
 	out := make(chan itemsResult)
 	go func(q Query) {
 		items := make([]User, 0, q.Length)
-		var err error
-		var rec Record
-
-		cursor, err := store.collection.Find(
-			ctx,
-			filterFromQuery(&q),
-			options.
-				Find().
-				SetSort(bson.M{"data.created_at": 1}).
-				SetSkip(skipFromQuery(&q)).
-				SetLimit(int64(query.Length)),
-		)
-		if err != nil {
-			err = fmt.Errorf("cannot find matching users: %w", err)
-		} else {
-			for cursor.Next(ctx) {
-				if err = cursor.Decode(&rec); err != nil {
-					break
-				}
-				items = append(items, *rec.Data)
+		it, err := store.findIter(ctx, &q, limitFromQuery(&q))
+		if err == nil {
+			for it.Next(ctx) {
+				items = append(items, it.User())
 			}
-			err = cursor.Err()
+			err = it.Err()
+			_ = it.Close(ctx)
 		}
 
 		select {
@@ -386,12 +2554,55 @@ func (store *Store) findItems(ctx context.Context, query *Query) <-chan itemsRes
 	return out
 }
 
-// FindMany fetches pages of users matching the given query. Each request also returns the total count of users
+// findIter returns an Iterator over at most limit of the users on the page of the given query. A limit of 0 reads all
+// of the users from the start of the page
+func (store *Store) findIter(ctx context.Context, query *Query, limit int64) (*Iterator, error) {
+	sort, err := sortFromQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := store.queries.Find(
+		ctx,
+		findFilter(ctx, query),
+		options.
+			Find().
+			SetSort(sort).
+			SetSkip(skipFromQuery(query)).
+			SetLimit(limit),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find matching users: %w", err)
+	}
+	return NewIterator(cursor), nil
+}
+
+// FindIter returns an Iterator over the page of users matching the given query, which reads the users as the cursor
+// advances instead of holding the page in memory. Unlike FindMany, no timeout is applied and the total is not counted
+func (store *Store) FindIter(ctx context.Context, query *Query) (*Iterator, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "FindUserRecordsIter")
+	defer span.End()
+
+	it, err := store.findIter(ctx, query, int64(query.Length))
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	return it, nil
+}
+
+// FindMany fetches pages of users matching the given query, reading them as FindIter does. Each request also returns the
+// total count of users
 func (store *Store) FindMany(ctx context.Context, query *Query) (page Page, err error) {
-	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "CreateUserRecord")
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "FindUserRecords")
 	defer span.End()
+	defer store.metrics.observe("FindMany", time.Now(), &err)
+
+	if _, err = sortFromQuery(query); err != nil {
+		span.RecordError(err)
+		return page, err
+	}
 
-	ctx, cancel := context.WithTimeout(ctx, findTimeout)
+	ctx, cancel := context.WithTimeout(ctx, store.options.FindTimeout)
 	defer cancel()
 
 	totalChan := store.findTotal(ctx, query)
@@ -420,75 +2631,382 @@ func (store *Store) FindMany(ctx context.Context, query *Query) (page Page, err
 		err = total.err
 		span.RecordError(err)
 	case items.err != nil:
-		span.RecordError(err)
 		err = items.err
+		span.RecordError(err)
 	}
 
-	return Page{
+	page = Page{
 		Page:  query.Page,
 		Total: total.count,
 		Items: items.items,
-	}, err
+	}
+	if query.SkipTotal && query.Length > 0 && len(page.Items) > int(query.Length) {
+		page.Items = page.Items[:query.Length]
+		page.HasMore = true
+	}
+	span.SetAttributes(resultCountKey.Int(len(page.Items)))
+	return page, err
+}
+
+// Count returns the total count of users matching the given query, without fetching any of them.
+// The length, page and sort of the query are ignored
+func (store *Store) Count(ctx context.Context, query *Query) (total int64, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "CountUserRecords")
+	defer span.End()
+	defer store.metrics.observe("Count", time.Now(), &err)
+
+	ctx, cancel := context.WithTimeout(ctx, store.options.FindTimeout)
+	defer cancel()
+
+	select {
+	case <-ctx.Done():
+		err := fmt.Errorf("cannot count users: %w", ctx.Err())
+		span.RecordError(err)
+		return 0, err
+	case total := <-store.findTotal(ctx, query):
+		if total.err != nil {
+			span.RecordError(total.err)
+		}
+		return total.count, total.err
+	}
+}
+
+// Cursor is a source of user records for an Iterator. It is satisfied by *mongo.Cursor, and allows stores backed by
+// other databases to return an Iterator
+type Cursor interface {
+	Next(context.Context) bool
+	// Decode decodes the current record into val, which is a *Record
+	Decode(val interface{}) error
+	Err() error
+	Close(context.Context) error
+}
+
+// UserIterator yields users one at a time, so that any number of users can be read without holding them all in
+// memory. It is returned by the Iterate method of each store, so that stores are free to read users in whatever way
+// suits their database. Iterator implements it for stores which read from a Cursor
+type UserIterator interface {
+	// Next moves the iterator to the next user, returning false when there are no more users or an error occurs
+	Next(context.Context) bool
+	// User returns the current user
+	User() User
+	// Err returns the error which stopped the iterator, if any
+	Err() error
+	// Close releases the resources of the iterator. It must be called once the iterator is no longer needed
+	Close(context.Context) error
+}
+
+// Iterator iterates over user records using a database cursor, so that any number of users can be read without
+// holding them all in memory
+type Iterator struct {
+	cursor Cursor
+	user   User
+	err    error
+}
 
+// NewIterator creates an Iterator which reads user records from cursor
+func NewIterator(cursor Cursor) *Iterator {
+	return &Iterator{cursor: cursor}
 }
 
-func (store *Store) readAndUpdateNextEvent(ctx context.Context, retryTimeout time.Duration) (e Event, err error) {
+// Next moves the iterator to the next user, returning false when there are no more users or an error occurs
+func (it *Iterator) Next(ctx context.Context) bool {
+	if it.err != nil || !it.cursor.Next(ctx) {
+		return false
+	}
 	var rec Record
-	res := store.collection.FindOneAndUpdate(ctx, bson.M{
+	if it.err = it.cursor.Decode(&rec); it.err != nil {
+		it.err = fmt.Errorf("cannot decode user record: %w", it.err)
+		return false
+	}
+	it.user = *rec.Data
+	return true
+}
+
+// User returns the current user
+func (it *Iterator) User() User {
+	return it.user
+}
+
+// Err returns the error which stopped the iterator, if any
+func (it *Iterator) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.cursor.Err()
+}
+
+// Close closes the underlying cursor. It must be called once the iterator is no longer needed
+func (it *Iterator) Close(ctx context.Context) error {
+	return it.cursor.Close(ctx)
+}
+
+// Iterate returns a UserIterator over all of the users matching the given query, in the order given by the query.
+// The length and page of the query are ignored. Unlike FindMany, no timeout is applied, so ctx must be cancelled
+// to abandon a slow iteration
+func (store *Store) Iterate(ctx context.Context, query *Query) (UserIterator, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "IterateUserRecords")
+	defer span.End()
+
+	sort, err := sortFromQuery(query)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	cursor, err := store.queries.Find(ctx, filterFromQuery(ctx, query), options.Find().SetSort(sort))
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("cannot find matching users: %w", err)
+	}
+	return NewIterator(cursor), nil
+}
+
+// StatsInterval is the length of the periods in which Stats counts signups
+type StatsInterval string
+
+const (
+	IntervalDay   StatsInterval = "day"
+	IntervalWeek  StatsInterval = "week"
+	IntervalMonth StatsInterval = "month"
+)
+
+// CountryCount is the number of users living in a country
+type CountryCount struct {
+	Country string `bson:"_id"`
+	Total   int64  `bson:"total"`
+}
+
+// SignupCount is the number of users created in the period which starts at Start
+type SignupCount struct {
+	Start time.Time `bson:"_id"`
+	Total int64     `bson:"total"`
+}
+
+// Stats are the numbers of users matching a query, in total, by country and by signup period
+type Stats struct {
+	Total int64
+	// Countries are ordered by country code. Countries without users are omitted
+	Countries []CountryCount `bson:"countries"`
+	// Signups are ordered by the start of their period. Periods without signups are omitted
+	Signups []SignupCount `bson:"signups"`
+}
+
+// Stats counts the users matching the given query by country and by the interval in which they were created, using
+// a single aggregation. Weeks start on Monday, and periods start at midnight UTC. The length, page and sort of the
+// query are ignored
+func (store *Store) Stats(ctx context.Context, query *Query, interval StatsInterval) (Stats, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "UserRecordStats")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, store.options.FindTimeout)
+	defer cancel()
+
+	count := bson.M{"$sum": 1}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filterFromQuery(ctx, query)}},
+		{{Key: "$facet", Value: bson.M{
+			"countries": bson.A{
+				bson.M{"$group": bson.M{"_id": "$data.country", "total": count}},
+				bson.M{"$sort": bson.M{"_id": 1}},
+			},
+			"signups": bson.A{
+				bson.M{"$group": bson.M{
+					"_id": bson.M{"$dateTrunc": bson.M{
+						"date":        "$data.created_at",
+						"unit":        string(interval),
+						"startOfWeek": "monday",
+					}},
+					"total": count,
+				}},
+				bson.M{"$sort": bson.M{"_id": 1}},
+			},
+		}}},
+	}
+	cursor, err := store.queries.Aggregate(ctx, pipeline)
+	if err != nil {
+		span.RecordError(err)
+		return Stats{}, fmt.Errorf("cannot aggregate matching users: %w", err)
+	}
+	var results []Stats
+	if err := cursor.All(ctx, &results); err != nil {
+		span.RecordError(err)
+		return Stats{}, fmt.Errorf("cannot read aggregated users: %w", err)
+	}
+	var stats Stats
+	if len(results) > 0 {
+		stats = results[0]
+	}
+	for _, c := range stats.Countries {
+		stats.Total += c.Total
+	}
+	return stats, nil
+}
+
+// Backlog describes the events in the outbox which have not been processed. The events of users with a dead lettered
+// event are not included, since they are not processed until it is requeued
+type Backlog struct {
+	// Pending is the number of events which have not been processed, including events which are being processed
+	Pending int64 `bson:"pending"`
+	// Oldest is the time the oldest event which has not been processed was created. It is zero when there are none
+	Oldest time.Time `bson:"oldest"`
+}
+
+// Backlog measures the events of every tenant which have not been processed, so that publishing falling behind can
+// be detected
+func (store *Store) Backlog(ctx context.Context) (Backlog, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "EventBacklog")
+	defer span.End()
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"events.0.state": bson.M{"$in": bson.A{Pending, Processing}}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":     nil,
+			"pending": bson.M{"$sum": bson.M{"$size": "$events"}},
+			// the events of a record are in the order they were created
+			"oldest": bson.M{"$min": bson.M{"$arrayElemAt": bson.A{"$events.created_at", 0}}},
+		}}},
+	}
+	cursor, err := store.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		span.RecordError(err)
+		return Backlog{}, fmt.Errorf("cannot aggregate pending events: %w", err)
+	}
+	var results []Backlog
+	if err := cursor.All(ctx, &results); err != nil {
+		span.RecordError(err)
+		return Backlog{}, fmt.Errorf("cannot read pending events: %w", err)
+	}
+	if len(results) == 0 {
+		return Backlog{}, nil
+	}
+	return results[0], nil
+}
+
+// waitingEvents returns a filter matching the records whose first event is waiting to be processed at now. An event
+// which has been processing for longer than the retry timeout is processed again
+func waitingEvents(now time.Time, retryTimeout time.Duration) bson.M {
+	return bson.M{
 		"$or": []bson.M{
 			{"events.0.state": Pending},
 			{
 				"events.0.state":      Processing,
-				"events.0.updated_at": bson.M{"$lt": utctime.Now().Add(-1 * retryTimeout)},
+				"events.0.updated_at": bson.M{"$lt": now.Add(-1 * retryTimeout)},
 			},
 		},
-	}, bson.M{
+	}
+}
+
+// claimEvents marks up to EventBatchSize of the events waiting to be processed as processing, those which have waited
+// longest first, and returns them. Only the first event of each record can be claimed, so that the events of a user
+// are published in order. The events found are claimed by a single update which checks that each is still waiting, and
+// is tagged with a claim id, so that an event claimed by another caller in between is not returned
+func (store *Store) claimEvents(ctx context.Context, retryTimeout time.Duration) ([]Event, error) {
+	now := utctime.Now()
+	// the index on the state and update time of the first event supports this query
+	cur, err := store.collection.Find(ctx, waitingEvents(now, retryTimeout), options.Find().
+		SetSort(bson.M{"events.0.updated_at": 1}).
+		SetLimit(int64(store.options.EventBatchSize)).
+		SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("cannot find waiting events: %w", err)
+	}
+	var found []Record
+	if err = cur.All(ctx, &found); err != nil {
+		return nil, fmt.Errorf("cannot read waiting events: %w", err)
+	}
+	if len(found) == 0 {
+		return nil, nil
+	}
+	ids := make([]uuid.UUID, 0, len(found))
+	for _, rec := range found {
+		ids = append(ids, rec.ID)
+	}
+
+	claim := uuid.Must(uuid.NewRandom()).String()
+	filter := waitingEvents(now, retryTimeout)
+	filter["_id"] = bson.M{"$in": ids}
+	_, err = store.collection.UpdateMany(ctx, filter, bson.M{
 		"$set": bson.M{
 			"events.0.state":      Processing,
-			"events.0.updated_at": utctime.Now(),
+			"events.0.updated_at": now,
+			"events.0.claim":      claim,
 		},
-	}, options.FindOneAndUpdate().SetSort(bson.M{"events.0.updated_at": 1}).SetReturnDocument(options.Before))
-	if err = res.Err(); err != nil {
-		return e, err
+		"$inc": bson.M{"events.0.attempts": 1},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot claim events: %w", err)
 	}
-	if err = res.Decode(&rec); err != nil {
-		return e, err
+
+	cur, err = store.collection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}, "events.0.claim": claim},
+		options.Find().SetProjection(bson.M{"tenant": 1, "events": bson.M{"$slice": 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("cannot find claimed events: %w", err)
+	}
+	var claimed []Record
+	if err = cur.All(ctx, &claimed); err != nil {
+		return nil, fmt.Errorf("cannot read claimed events: %w", err)
+	}
+	// the records are read in the order of their ids, so the events are sorted again
+	sort.Slice(claimed, func(i, j int) bool {
+		return claimed[i].Events[0].CreatedAt.Before(claimed[j].Events[0].CreatedAt)
+	})
+	events := make([]Event, 0, len(claimed))
+	for _, rec := range claimed {
+		e := rec.Events[0]
+		e.Tenant = rec.Tenant
+		events = append(events, e)
 	}
-	return rec.Events[0], nil
+	return events, nil
 }
 
-// Events returns a channel of events from the store.
+// Events returns a channel of events from the store. Events are claimed in batches of up to EventBatchSize, and the
+// next batch is claimed without waiting when a batch is full
 func (store *Store) Events(ctx context.Context, minInterval, maxInterval, retryTimeout time.Duration) <-chan EventResult {
 	out := make(chan EventResult)
 	go func() {
+		defer close(out)
 		source := rand.New(rand.NewSource(utctime.Now().UnixNano()))
 		for {
-			ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "FetchEvent")
-			defer span.End()
-			var event Event
-			var err error
-			// read the next event in a closure so we can defer the context cancel
-			func() {
-				innerCtx, cancel := context.WithTimeout(ctx, findTimeout)
-				defer cancel()
-				event, err = store.readAndUpdateNextEvent(innerCtx, retryTimeout)
-			}()
-			if err != nil && errors.Is(err, mongo.ErrNoDocuments) {
-				// we can ignore this error, it just means there are no waiting events
-				continue
+			results := store.fetchEvents(ctx, retryTimeout)
+			for _, result := range results {
+				select {
+				case <-ctx.Done():
+					return
+				case out <- result:
+				}
 			}
-			select {
-			case <-ctx.Done():
-				close(out)
+			if len(results) < store.options.EventBatchSize || results[0].Err != nil {
+				waitWithJitter(ctx, minInterval, maxInterval, source)
+			}
+			if ctx.Err() != nil {
 				return
-			case out <- EventResult{Event: event, Err: err}:
 			}
-			waitWithJitter(ctx, minInterval, maxInterval, source)
 		}
 	}()
 	return out
 }
 
+// fetchEvents claims the next batch of events, returning a result for each, or a single result with the error which
+// prevented them being claimed
+func (store *Store) fetchEvents(ctx context.Context, retryTimeout time.Duration) []EventResult {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "FetchEvents")
+	defer span.End()
+	var err error
+	defer store.metrics.observe("Events", time.Now(), &err)
+	ctx, cancel := context.WithTimeout(ctx, store.options.EventPollTimeout)
+	defer cancel()
+	events, err := store.claimEvents(ctx, retryTimeout)
+	if err != nil {
+		span.RecordError(err)
+		return []EventResult{{Err: err}}
+	}
+	span.SetAttributes(resultCountKey.Int(len(events)))
+	results := make([]EventResult, 0, len(events))
+	for _, e := range events {
+		results = append(results, EventResult{Event: e})
+	}
+	return results
+}
+
 func waitWithJitter(ctx context.Context, minInterval, maxInterval time.Duration, source *rand.Rand) {
 	min, max := int64(minInterval), int64(maxInterval)
 	after := time.After(minInterval + time.Duration(source.Int63n(max-min)))
@@ -499,10 +3017,13 @@ func waitWithJitter(ctx context.Context, minInterval, maxInterval time.Duration,
 }
 
 // Process event marks the matching event as processed by removing it from the store
-func (store *Store) ProcessEvent(ctx context.Context, id uuid.UUID, version int64) error {
+func (store *Store) ProcessEvent(ctx context.Context, id uuid.UUID, version int64) (err error) {
 	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "ProcessEvent")
 	defer span.End()
-	_, err := store.collection.UpdateOne(ctx, bson.M{
+	defer store.metrics.observe("ProcessEvent", time.Now(), &err)
+	ctx, cancel := store.writeContext(ctx)
+	defer cancel()
+	_, err = store.collection.UpdateOne(ctx, bson.M{
 		"_id":              id,
 		"events.0.state":   Processing,
 		"events.0.version": version,
@@ -511,7 +3032,95 @@ func (store *Store) ProcessEvent(ctx context.Context, id uuid.UUID, version int6
 	})
 	if err != nil {
 		span.RecordError(err)
-		err = fmt.Errorf("cannot complete event: %w", err)
+		return fmt.Errorf("cannot complete event: %w", err)
 	}
-	return err
+	// the record is expired even if the event had already been completed, so that processing the event again expires a
+	// record which could not be expired the first time
+	if err = store.expireDrained(ctx, bson.M{"_id": id}); err != nil {
+		span.RecordError(err)
+		return err
+	}
+	return nil
+}
+
+// DeadLetterEvent moves the matching event, which must be being processed, to the DeadLettered state, so that it is
+// not processed again until it is requeued with RequeueDeadLetter. The later events of its user wait behind it, so
+// that the events of a user are always processed in order
+func (store *Store) DeadLetterEvent(ctx context.Context, id uuid.UUID, version int64) error {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "DeadLetterEvent")
+	defer span.End()
+	ctx, cancel := store.writeContext(ctx)
+	defer cancel()
+	_, err := store.collection.UpdateOne(ctx, bson.M{
+		"_id":              id,
+		"events.0.state":   Processing,
+		"events.0.version": version,
+	}, bson.M{
+		"$set": bson.M{"events.0.state": DeadLettered, "events.0.updated_at": utctime.Now()},
+	})
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("cannot dead letter event: %w", err)
+	}
+	return nil
+}
+
+// DeadLetters reads the dead lettered events of the users of the tenant of ctx, including deleted users, in the order
+// they were dead lettered
+func (store *Store) DeadLetters(ctx context.Context) ([]Event, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "ReadDeadLetters")
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, store.options.FindTimeout)
+	defer cancel()
+	// the index on the state and update time of the first event supports this query
+	cur, err := store.collection.Find(ctx, bson.M{
+		"tenant":         tenant.FromContext(ctx),
+		"events.0.state": DeadLettered,
+	}, options.Find().SetSort(bson.M{"events.0.updated_at": 1}).SetProjection(bson.M{
+		"tenant": 1,
+		"events": bson.M{"$slice": 1},
+	}))
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("cannot find dead letters: %w", err)
+	}
+	var recs []Record
+	if err = cur.All(ctx, &recs); err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("cannot read dead letters: %w", err)
+	}
+	events := make([]Event, 0, len(recs))
+	for _, rec := range recs {
+		e := rec.Events[0]
+		e.Tenant = rec.Tenant
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+// RequeueDeadLetter returns the dead lettered event of the user identified by id to the Pending state, with no
+// attempts, so that it is processed again. It returns ErrNotFound if the user, in the tenant of ctx, has no dead
+// lettered event
+func (store *Store) RequeueDeadLetter(ctx context.Context, id uuid.UUID) error {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "RequeueDeadLetter")
+	defer span.End()
+	ctx, cancel := store.writeContext(ctx)
+	defer cancel()
+	res, err := store.collection.UpdateOne(ctx, bson.M{
+		"_id":            id,
+		"tenant":         tenant.FromContext(ctx),
+		"events.0.state": DeadLettered,
+	}, bson.M{
+		"$set":   bson.M{"events.0.state": Pending, "events.0.updated_at": utctime.Now()},
+		"$unset": bson.M{"events.0.attempts": ""},
+	})
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("cannot requeue dead letter: %w", err)
+	}
+	if res.MatchedCount == 0 {
+		span.RecordError(ErrNotFound)
+		return ErrNotFound
+	}
+	return nil
 }
@@ -47,6 +47,24 @@ func createMany(ctx context.Context, items []userstore.User, store *userstore.St
 }
 
 func withStore(f func(context.Context, *userstore.Store)) {
+	withStoreOptions(userstore.Options{}, f)
+}
+
+// withStoreOptions is withStore for a store created with options
+func withStoreOptions(options userstore.Options, f func(context.Context, *userstore.Store)) {
+	withStoreCreatedBy(func(db *mongo.Database) *userstore.Store {
+		return userstore.New(db, options)
+	}, f)
+}
+
+// withSoftDeletingStore is withStore for a store which soft deletes users and keeps them for retention
+func withSoftDeletingStore(retention time.Duration, f func(context.Context, *userstore.Store)) {
+	withStoreCreatedBy(func(db *mongo.Database) *userstore.Store {
+		return userstore.NewWithRetention(db, retention, userstore.Options{})
+	}, f)
+}
+
+func withStoreCreatedBy(newStore func(*mongo.Database) *userstore.Store, f func(context.Context, *userstore.Store)) {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
@@ -61,9 +79,9 @@ func withStore(f func(context.Context, *userstore.Store)) {
 	db := client.Database(dbName)
 	defer db.Drop(ctx)
 
-	store := userstore.New(db)
-	if err = store.EnsureIndexes(ctx); err != nil {
-		panic(fmt.Sprintf("cannot create indexes: %v", err))
+	store := newStore(db)
+	if _, err = store.Migrate(ctx); err != nil {
+		panic(fmt.Sprintf("cannot migrate db: %v", err))
 	}
 	f(ctx, store)
 }
@@ -96,6 +114,8 @@ func compareUserRecords(t *testing.T, a, b userstore.User) {
 	require.Equal(t, a.PasswordHash, b.PasswordHash)
 	require.Equal(t, a.Email, b.Email)
 	require.Equal(t, a.Country, b.Country)
+	require.Equal(t, a.AvatarURL, b.AvatarURL)
+	require.Equal(t, a.Status, b.Status)
 	require.True(t, b.CreatedAt.Sub(a.CreatedAt) <= time.Millisecond) // mongodb only has 1ms time resolution.
 	require.True(t, b.UpdatedAt.Sub(a.UpdatedAt) <= time.Millisecond) // mongodb only has 1ms time resolution.
 }
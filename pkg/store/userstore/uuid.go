@@ -0,0 +1,320 @@
+package userstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/telemetry"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/bson/bsonrw"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel"
+)
+
+// UUIDRepresentation is the representation in BSON of the UUIDs stored by a store, such as the ids of users
+type UUIDRepresentation string
+
+const (
+	// UUIDGeneric stores UUIDs as binary with the generic subtype 0, which is how the driver stores them by default
+	UUIDGeneric UUIDRepresentation = "generic"
+	// UUIDStandard stores UUIDs as binary with the UUID subtype 4, which other tools show as UUIDs
+	UUIDStandard UUIDRepresentation = "standard"
+	// UUIDLegacy stores UUIDs as binary with the legacy UUID subtype 3. Their bytes are stored in order, as the
+	// legacy representation of the python driver does, rather than in the orders of the legacy java or C# drivers
+	UUIDLegacy UUIDRepresentation = "legacy"
+	// UUIDString stores UUIDs as strings in their canonical form, e.g. 6ba7b810-9dad-11d1-80b4-00c04fd430c8
+	UUIDString UUIDRepresentation = "string"
+
+	// UUIDMigrationCollectionSuffix is appended to the Collection of a store to name the collection holding copies of
+	// the records being rewritten by MigrateUUIDs, e.g. users_uuid_migration
+	UUIDMigrationCollectionSuffix = "_uuid_migration"
+)
+
+// ErrTransactionsRequired is returned by MigrateUUIDs when the database does not support transactions, unless it is
+// allowed to run without them
+var ErrTransactionsRequired = errors.New("the database does not support transactions")
+
+// uuidSubtypes are the binary subtypes of the representations of UUIDs stored as binary
+var uuidSubtypes = map[UUIDRepresentation]byte{
+	UUIDGeneric:  bsontype.BinaryGeneric,
+	UUIDStandard: bsontype.BinaryUUID,
+	UUIDLegacy:   bsontype.BinaryUUIDOld,
+}
+
+var (
+	tUUID    = reflect.TypeOf(uuid.UUID{})
+	tUser    = reflect.TypeOf(User{})
+	tUserPtr = reflect.TypeOf(&User{})
+)
+
+// ParseUUIDRepresentation parses the name of a UUIDRepresentation, such as standard
+func ParseUUIDRepresentation(name string) (UUIDRepresentation, error) {
+	representation := UUIDRepresentation(name)
+	if _, ok := uuidSubtypes[representation]; ok || representation == UUIDString {
+		return representation, nil
+	}
+	return "", fmt.Errorf("unknown UUID representation %s", name)
+}
+
+// newRegistry creates the registry used by the collections of a store, which stores UUIDs with representation. UUIDs
+// are read in any representation, so that records stored with another representation can still be read while they
+// are migrated by MigrateUUIDs, and records are upgraded to the CurrentSchemaVersion as they are read
+func newRegistry(representation UUIDRepresentation) *bsoncodec.Registry {
+	rb := bson.NewRegistryBuilder()
+	rb.RegisterTypeEncoder(tUUID, uuidEncoder(representation))
+	rb.RegisterTypeDecoder(tUUID, bsoncodec.ValueDecoderFunc(decodeUUID))
+	rb.RegisterTypeDecoder(tRecord, bsoncodec.ValueDecoderFunc(decodeRecord))
+	// users are encoded by User.MarshalBSON, which would encode their ids with the default registry
+	rb.RegisterTypeEncoder(tUser, bsoncodec.ValueEncoderFunc(encodeUser))
+	rb.RegisterTypeEncoder(tUserPtr, bsoncodec.ValueEncoderFunc(encodeUserPtr))
+	return rb.Build()
+}
+
+// uuidEncoder returns the encoder which writes UUIDs with representation
+func uuidEncoder(representation UUIDRepresentation) bsoncodec.ValueEncoderFunc {
+	return func(_ bsoncodec.EncodeContext, vw bsonrw.ValueWriter, val reflect.Value) error {
+		if !val.IsValid() || val.Type() != tUUID {
+			return bsoncodec.ValueEncoderError{Name: "UUIDEncodeValue", Types: []reflect.Type{tUUID}, Received: val}
+		}
+		id := val.Interface().(uuid.UUID)
+		if representation == UUIDString {
+			return vw.WriteString(id.String())
+		}
+		subtype, ok := uuidSubtypes[representation]
+		if !ok {
+			return fmt.Errorf("unknown UUID representation %s", representation)
+		}
+		return vw.WriteBinaryWithSubtype(id[:], subtype)
+	}
+}
+
+// decodeUUID reads a UUID stored in any UUIDRepresentation
+func decodeUUID(_ bsoncodec.DecodeContext, vr bsonrw.ValueReader, val reflect.Value) error {
+	if !val.CanSet() || val.Type() != tUUID {
+		return bsoncodec.ValueDecoderError{Name: "UUIDDecodeValue", Types: []reflect.Type{tUUID}, Received: val}
+	}
+	var id uuid.UUID
+	switch vr.Type() {
+	case bsontype.Binary:
+		data, subtype, err := vr.ReadBinary()
+		if err != nil {
+			return err
+		}
+		if subtype != bsontype.BinaryGeneric && subtype != bsontype.BinaryUUID && subtype != bsontype.BinaryUUIDOld {
+			return fmt.Errorf("cannot decode binary with subtype %#x as a UUID", subtype)
+		}
+		if id, err = uuid.FromBytes(data); err != nil {
+			return fmt.Errorf("cannot decode binary as a UUID: %w", err)
+		}
+	case bsontype.String:
+		s, err := vr.ReadString()
+		if err != nil {
+			return err
+		}
+		if id, err = uuid.Parse(s); err != nil {
+			return fmt.Errorf("cannot decode string as a UUID: %w", err)
+		}
+	case bsontype.Null:
+		if err := vr.ReadNull(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("cannot decode %v as a UUID", vr.Type())
+	}
+	val.Set(reflect.ValueOf(id))
+	return nil
+}
+
+// encodeUser encodes a user as User.MarshalBSON does, with the registry of ec
+func encodeUser(ec bsoncodec.EncodeContext, vw bsonrw.ValueWriter, val reflect.Value) error {
+	if !val.IsValid() || val.Type() != tUser {
+		return bsoncodec.ValueEncoderError{Name: "UserEncodeValue", Types: []reflect.Type{tUser}, Received: val}
+	}
+	doc, err := val.Interface().(User).marshalBSON(ec.Registry)
+	if err != nil {
+		return err
+	}
+	return bsonrw.Copier{}.CopyDocumentFromBytes(vw, doc)
+}
+
+// encodeUserPtr encodes a pointer to a user with encodeUser, or null for a nil pointer
+func encodeUserPtr(ec bsoncodec.EncodeContext, vw bsonrw.ValueWriter, val reflect.Value) error {
+	if !val.IsValid() || val.Type() != tUserPtr {
+		return bsoncodec.ValueEncoderError{Name: "UserPtrEncodeValue", Types: []reflect.Type{tUserPtr}, Received: val}
+	}
+	if val.IsNil() {
+		return vw.WriteNull()
+	}
+	return encodeUser(ec, vw, val.Elem())
+}
+
+// MigrateUUIDs rewrites the records of every tenant whose ids are stored with another UUIDRepresentation than the one
+// of the store, and returns the number of records it rewrote. Since the id of a record cannot be changed, each record
+// is deleted and inserted again, in a transaction when the database supports them. Without transactions, each record
+// is first copied to the collection named after the Collection of the store with UUIDMigrationCollectionSuffix, and a
+// record which is deleted but not inserted again, e.g. because the migration crashed, is restored from its copy when
+// MigrateUUIDs is run again. It is missing until then, so MigrateUUIDs returns ErrTransactionsRequired unless
+// withoutTransactions is true.
+// Instances of the service with a different representation cannot find the rewritten records, so the representation
+// should be changed while the service is stopped, or scaled to a single instance
+func (store *Store) MigrateUUIDs(ctx context.Context, withoutTransactions bool) (int64, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "MigrateUUIDs")
+	defer span.End()
+
+	supported, err := store.supportsTransactions(ctx)
+	if err != nil {
+		span.RecordError(err)
+		return 0, err
+	}
+	if !supported && !withoutTransactions {
+		return 0, ErrTransactionsRequired
+	}
+
+	migrated, err := store.restoreUUIDMigrations(ctx)
+	if err != nil {
+		span.RecordError(err)
+		return migrated, err
+	}
+
+	// the ids are read as they are stored, so that records already stored with the representation are skipped
+	cur, err := store.collection.Find(ctx, bson.M{}, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		span.RecordError(err)
+		return migrated, fmt.Errorf("cannot find records: %w", err)
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		stored := cur.Current.Lookup("_id")
+		if store.storedWithRepresentation(stored) {
+			continue
+		}
+		if err = store.migrateUUIDs(ctx, stored, !supported); err != nil {
+			span.RecordError(err)
+			return migrated, err
+		}
+		migrated++
+	}
+	if err = cur.Err(); err != nil {
+		span.RecordError(err)
+		return migrated, fmt.Errorf("cannot find records: %w", err)
+	}
+	return migrated, nil
+}
+
+// uuidMigrations returns the collection holding the copies of the records being rewritten by MigrateUUIDs
+func (store *Store) uuidMigrations() *mongo.Collection {
+	opts := options.Collection().
+		SetRegistry(newRegistry(store.options.UUIDRepresentation)).
+		SetWriteConcern(store.options.WriteConcern)
+	return store.db.Collection(store.options.Collection+UUIDMigrationCollectionSuffix, opts)
+}
+
+// storedWithRepresentation returns true if the id stored is stored with the UUIDRepresentation of the store
+func (store *Store) storedWithRepresentation(stored bson.RawValue) bool {
+	if store.options.UUIDRepresentation == UUIDString {
+		return stored.Type == bsontype.String
+	}
+	subtype, _, ok := stored.BinaryOK()
+	return ok && subtype == uuidSubtypes[store.options.UUIDRepresentation]
+}
+
+// migrateUUIDs rewrites the record whose id is stored, with the UUIDRepresentation of the store. The record is matched
+// by its id as it is stored, rather than as a UUID, which would be encoded with the representation of the store. When
+// withCopy is true, the record is copied before it is deleted, and the copy is removed once it has been inserted again.
+// Collections cannot be created in transactions by every version of MongoDB, so records rewritten in a transaction
+// are not copied
+func (store *Store) migrateUUIDs(ctx context.Context, stored bson.RawValue, withCopy bool) error {
+	copies := store.uuidMigrations()
+	return store.inTransaction(ctx, func(ctx context.Context) error {
+		raw, err := store.collection.FindOne(ctx, bson.M{"_id": stored}).DecodeBytes()
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				// the record was purged or expired since it was found
+				return nil
+			}
+			return fmt.Errorf("cannot read record for migrating: %w", err)
+		}
+		var rec Record
+		if err = bson.UnmarshalWithRegistry(newRegistry(store.options.UUIDRepresentation), raw, &rec); err != nil {
+			return fmt.Errorf("cannot decode record for migrating: %w", err)
+		}
+		if withCopy {
+			upsert := options.Replace().SetUpsert(true)
+			if _, err = copies.ReplaceOne(ctx, bson.M{"_id": stored}, raw, upsert); err != nil {
+				return fmt.Errorf("cannot copy record for migrating: %w", err)
+			}
+		}
+		if _, err = store.collection.DeleteOne(ctx, bson.M{"_id": stored}); err != nil {
+			return fmt.Errorf("cannot delete record for migrating: %w", err)
+		}
+		if _, err = store.collection.InsertOne(ctx, &rec); err != nil {
+			return fmt.Errorf("cannot insert migrated record: %w", err)
+		}
+		if withCopy {
+			if _, err = copies.DeleteOne(ctx, bson.M{"_id": stored}); err != nil {
+				return fmt.Errorf("cannot remove copy of migrated record: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// restoreUUIDMigrations finishes rewriting the records copied by a MigrateUUIDs which stopped before they were
+// inserted again, and returns the number of records it rewrote. Copies of records which were not deleted, or which
+// were already inserted again, are removed
+func (store *Store) restoreUUIDMigrations(ctx context.Context) (int64, error) {
+	copies := store.uuidMigrations()
+	cur, err := copies.Find(ctx, bson.M{})
+	if err != nil {
+		return 0, fmt.Errorf("cannot find copies of records being migrated: %w", err)
+	}
+	defer cur.Close(ctx)
+
+	var restored int64
+	for cur.Next(ctx) {
+		stored := cur.Current.Lookup("_id")
+		var rec Record
+		if err = cur.Decode(&rec); err != nil {
+			return restored, fmt.Errorf("cannot decode copy of record being migrated: %w", err)
+		}
+		inserted, err := store.restoreUUIDMigration(ctx, stored, &rec)
+		if err != nil {
+			return restored, err
+		}
+		if inserted {
+			restored++
+		}
+		if _, err = copies.DeleteOne(ctx, bson.M{"_id": stored}); err != nil {
+			return restored, fmt.Errorf("cannot remove copy of migrated record: %w", err)
+		}
+	}
+	if err = cur.Err(); err != nil {
+		return restored, fmt.Errorf("cannot find copies of records being migrated: %w", err)
+	}
+	return restored, nil
+}
+
+// restoreUUIDMigration inserts rec, copied while its id was stored, unless the record was not deleted or has already
+// been inserted again, and returns true if it was inserted
+func (store *Store) restoreUUIDMigration(ctx context.Context, stored bson.RawValue, rec *Record) (bool, error) {
+	for _, filter := range []bson.M{{"_id": stored}, {"_id": rec.ID}} {
+		err := store.collection.FindOne(ctx, filter, options.FindOne().SetProjection(bson.M{"_id": 1})).Err()
+		if err == nil {
+			return false, nil
+		}
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return false, fmt.Errorf("cannot read record being migrated: %w", err)
+		}
+	}
+	if _, err := store.collection.InsertOne(ctx, rec); err != nil {
+		return false, fmt.Errorf("cannot insert migrated record: %w", err)
+	}
+	return true, nil
+}
@@ -0,0 +1,140 @@
+package userstore_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestUUIDRepresentationsCanBeParsed(t *testing.T) {
+	for _, representation := range []userstore.UUIDRepresentation{
+		userstore.UUIDGeneric,
+		userstore.UUIDStandard,
+		userstore.UUIDLegacy,
+		userstore.UUIDString,
+	} {
+		parsed, err := userstore.ParseUUIDRepresentation(string(representation))
+		require.NoError(t, err)
+		require.Equal(t, representation, parsed)
+	}
+	_, err := userstore.ParseUUIDRepresentation("java")
+	require.Error(t, err)
+}
+
+func TestIdsAreStoredWithTheUUIDRepresentationOfTheStore(t *testing.T) {
+	cases := []struct {
+		name           string
+		representation userstore.UUIDRepresentation
+		storedType     bsontype.Type
+		subtype        byte
+	}{
+		{name: "Default", storedType: bsontype.Binary, subtype: bsontype.BinaryGeneric},
+		{name: "Standard", representation: userstore.UUIDStandard, storedType: bsontype.Binary, subtype: bsontype.BinaryUUID},
+		{name: "Legacy", representation: userstore.UUIDLegacy, storedType: bsontype.Binary, subtype: bsontype.BinaryUUIDOld},
+		{name: "String", representation: userstore.UUIDString, storedType: bsontype.String},
+	}
+	for _, c := range cases {
+		thisCase := c
+		t.Run(thisCase.name, func(t *testing.T) {
+			var db *mongo.Database
+			withStoreCreatedBy(func(d *mongo.Database) *userstore.Store {
+				db = d
+				return userstore.New(d, userstore.Options{UUIDRepresentation: thisCase.representation})
+			}, func(ctx context.Context, store *userstore.Store) {
+				rec := fakeUserRecord()
+				_, err := store.Create(ctx, &rec)
+				require.NoError(t, err)
+				read, err := store.ReadOne(ctx, rec.ID)
+				require.NoError(t, err)
+				require.Equal(t, rec.ID, read.ID)
+
+				raw, err := db.Collection(userstore.CollectionName).FindOne(ctx, bson.M{}).DecodeBytes()
+				require.NoError(t, err)
+				for _, key := range [][]string{{"_id"}, {"data", "id"}} {
+					stored := raw.Lookup(key...)
+					require.Equal(t, thisCase.storedType, stored.Type)
+					if thisCase.storedType == bsontype.Binary {
+						subtype, _ := stored.Binary()
+						require.Equal(t, thisCase.subtype, subtype)
+					}
+				}
+			})
+		})
+	}
+}
+
+func TestMigrateUUIDsRewritesRecordsWithTheRepresentationOfTheStore(t *testing.T) {
+	var db *mongo.Database
+	withStoreCreatedBy(func(d *mongo.Database) *userstore.Store {
+		db = d
+		return userstore.New(d, userstore.Options{})
+	}, func(ctx context.Context, store *userstore.Store) {
+		rec := fakeUserRecord()
+		_, err := store.Create(ctx, &rec)
+		require.NoError(t, err)
+
+		standard := userstore.New(db, userstore.Options{UUIDRepresentation: userstore.UUIDStandard})
+		_, err = standard.ReadOne(ctx, rec.ID)
+		require.ErrorIs(t, err, userstore.ErrNotFound)
+
+		migrated, err := standard.MigrateUUIDs(ctx, true)
+		require.NoError(t, err)
+		require.Equal(t, int64(1), migrated)
+		read, err := standard.ReadOne(ctx, rec.ID)
+		require.NoError(t, err)
+		require.Equal(t, rec.Email, read.Email)
+		// the event for the creation of the user is kept
+		events := collectEvents(ctx, standard, time.Minute, true, 1)
+		require.Equal(t, rec.ID, events[0].ID)
+
+		migrated, err = standard.MigrateUUIDs(ctx, true)
+		require.NoError(t, err)
+		require.Zero(t, migrated)
+	})
+}
+
+func TestMigrateUUIDsRestoresRecordsCopiedByAnInterruptedMigration(t *testing.T) {
+	var db *mongo.Database
+	withStoreCreatedBy(func(d *mongo.Database) *userstore.Store {
+		db = d
+		return userstore.New(d, userstore.Options{})
+	}, func(ctx context.Context, store *userstore.Store) {
+		deleted := fakeUserRecord()
+		_, err := store.Create(ctx, &deleted)
+		require.NoError(t, err)
+		kept := fakeUserRecord()
+		_, err = store.Create(ctx, &kept)
+		require.NoError(t, err)
+
+		// the migration stopped after copying both records, and deleting one of them
+		users := db.Collection(userstore.CollectionName)
+		copies := db.Collection(userstore.CollectionName + userstore.UUIDMigrationCollectionSuffix)
+		for _, rec := range []userstore.User{deleted, kept} {
+			raw, err := users.FindOne(ctx, bson.M{"data.email": rec.Email}).DecodeBytes()
+			require.NoError(t, err)
+			_, err = copies.InsertOne(ctx, raw)
+			require.NoError(t, err)
+		}
+		_, err = users.DeleteOne(ctx, bson.M{"data.email": deleted.Email})
+		require.NoError(t, err)
+
+		standard := userstore.New(db, userstore.Options{UUIDRepresentation: userstore.UUIDStandard})
+		migrated, err := standard.MigrateUUIDs(ctx, true)
+		require.NoError(t, err)
+		require.Equal(t, int64(2), migrated)
+		for _, rec := range []userstore.User{deleted, kept} {
+			read, err := standard.ReadOne(ctx, rec.ID)
+			require.NoError(t, err)
+			require.Equal(t, rec.Email, read.Email)
+		}
+		remaining, err := copies.CountDocuments(ctx, bson.M{})
+		require.NoError(t, err)
+		require.Zero(t, remaining)
+	})
+}
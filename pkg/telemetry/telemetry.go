@@ -1,6 +1,14 @@
 package telemetry
 
+import "go.opentelemetry.io/otel/propagation"
+
 const (
 	// TraceName is the name used for telemetry traces by this service
 	TraceName = "users_service"
 )
+
+// Propagator returns the propagator used to carry trace context and baggage between services,
+// in the W3C Trace Context and Baggage formats
+func Propagator() propagation.TextMapPropagator {
+	return propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+}
@@ -0,0 +1,36 @@
+// package tenant carries the identifier of the tenant a call is made for, so that a single deployment of the
+// service can hold the users of many tenants
+package tenant
+
+import (
+	"context"
+	"regexp"
+)
+
+// Default is the tenant of calls which do not identify one. It is the tenant of every user created before
+// tenants were introduced
+const Default = ""
+
+// pattern is the pattern of valid tenant identifiers
+var pattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// Valid returns true if id is a valid tenant identifier. Identifiers are 1 to 63 lower case letters, digits or
+// hyphens, and do not start with a hyphen
+func Valid(id string) bool {
+	return pattern.MatchString(id)
+}
+
+type tenantKey struct{}
+
+// With returns a context carrying the provided tenant identifier
+func With(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, id)
+}
+
+// FromContext returns the tenant identifier carried by ctx, or Default if there is none
+func FromContext(ctx context.Context) string {
+	if id, ok := ctx.Value(tenantKey{}).(string); ok {
+		return id
+	}
+	return Default
+}
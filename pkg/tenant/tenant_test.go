@@ -0,0 +1,24 @@
+package tenant_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/robotlovesyou/fitest/pkg/tenant"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContextCarriesTenant(t *testing.T) {
+	require.Equal(t, tenant.Default, tenant.FromContext(context.Background()))
+	require.Equal(t, "acme", tenant.FromContext(tenant.With(context.Background(), "acme")))
+}
+
+func TestValidTenants(t *testing.T) {
+	for _, id := range []string{"acme", "acme-eu-1", "1", strings.Repeat("a", 63)} {
+		require.True(t, tenant.Valid(id), id)
+	}
+	for _, id := range []string{"", "-acme", "Acme", "acme_eu", "acme.eu", strings.Repeat("a", 64)} {
+		require.False(t, tenant.Valid(id), id)
+	}
+}
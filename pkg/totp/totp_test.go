@@ -0,0 +1,82 @@
+package totp_test
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/robotlovesyou/fitest/pkg/totp"
+	"github.com/stretchr/testify/require"
+)
+
+// rfcSecret is the SHA-1 secret used by the test vectors of RFC 6238
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestCodeMatchesRFCTestVectors(t *testing.T) {
+	// the last 6 digits of the 8 digit codes in appendix B of RFC 6238
+	cases := []struct {
+		unix int64
+		code string
+	}{
+		{unix: 59, code: "287082"},
+		{unix: 1111111109, code: "081804"},
+		{unix: 1111111111, code: "050471"},
+		{unix: 1234567890, code: "005924"},
+		{unix: 2000000000, code: "279037"},
+		{unix: 20000000000, code: "353130"},
+	}
+	for _, testCase := range cases {
+		code, err := totp.Code(rfcSecret, time.Unix(testCase.unix, 0))
+		require.NoError(t, err)
+		require.Equal(t, testCase.code, code)
+	}
+}
+
+func TestValidateAcceptsCodesWithinSkew(t *testing.T) {
+	secret, err := totp.GenerateSecret()
+	require.NoError(t, err)
+	now := time.Unix(1650000000, 0)
+
+	for _, offset := range []time.Duration{-totp.Period, 0, totp.Period} {
+		code, err := totp.Code(secret, now.Add(offset))
+		require.NoError(t, err)
+		step, ok, err := totp.Validate(secret, code, now)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, totp.Step(now.Add(offset)), step)
+	}
+}
+
+func TestValidateRejectsCodesOutsideSkew(t *testing.T) {
+	secret, err := totp.GenerateSecret()
+	require.NoError(t, err)
+	now := time.Unix(1650000000, 0)
+
+	code, err := totp.Code(secret, now.Add(-2*totp.Period))
+	require.NoError(t, err)
+	_, ok, err := totp.Validate(secret, code, now)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	_, ok, err = totp.Validate(secret, "not a code", now)
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestValidateFailsWithInvalidSecret(t *testing.T) {
+	_, _, err := totp.Validate("not base32!", "123456", time.Now())
+	require.ErrorIs(t, err, totp.ErrInvalidSecret)
+}
+
+func TestURIDescribesTheAccount(t *testing.T) {
+	uri, err := url.Parse(totp.URI("fitest", "max@example.com", "JBSWY3DPEHPK3PXP"))
+	require.NoError(t, err)
+	require.Equal(t, "otpauth", uri.Scheme)
+	require.Equal(t, "totp", uri.Host)
+	require.Equal(t, "/fitest:max@example.com", uri.Path)
+	require.Equal(t, "JBSWY3DPEHPK3PXP", uri.Query().Get("secret"))
+	require.Equal(t, "fitest", uri.Query().Get("issuer"))
+	require.Equal(t, "6", uri.Query().Get("digits"))
+	require.Equal(t, "30", uri.Query().Get("period"))
+}
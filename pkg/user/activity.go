@@ -0,0 +1,34 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/telemetry"
+	"github.com/robotlovesyou/fitest/pkg/utctime"
+	"go.opentelemetry.io/otel"
+)
+
+// TouchLastSeen records that the user identified by ref is active now. Activity is not a change to the user, so the
+// version of the user is not changed and no event is published. It returns ErrNotFound if there is no such user
+func (service *Service) TouchLastSeen(ctx context.Context, ref *Ref) error {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "TouchLastSeen")
+	defer span.End()
+
+	if err := service.validate.Struct(ref); err != nil {
+		return invalidError(err)
+	}
+
+	err := service.store.TouchLastSeen(ctx, uuid.MustParse(ref.ID), utctime.Now()) // the id has already been validated
+	if err != nil {
+		if errors.Is(err, userstore.ErrNotFound) {
+			return ErrNotFound
+		}
+		span.RecordError(err)
+		return fmt.Errorf("cannot record user activity in store: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package user_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/user"
+	"github.com/robotlovesyou/fitest/pkg/utctime"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTouchLastSeenCallsStoreWithCorrectParameters(t *testing.T) {
+	userRef := fakeUserRef()
+	before := utctime.Now()
+	storeStub := newStubUserStore()
+	storeStub.stubTouchLastSeen = func(_ context.Context, id uuid.UUID, at time.Time) error {
+		require.Equal(t, userRef.ID, id.String())
+		require.False(t, at.Before(before))
+		return nil
+	}
+	withService(storeStub)(func(service *user.Service) {
+		require.NoError(t, service.TouchLastSeen(context.Background(), &userRef))
+	})
+}
+
+func TestTouchLastSeenReturnsErrorWhenRefIsInvalid(t *testing.T) {
+	userRef := user.Ref{ID: "not a uuid"}
+	withService(newStubUserStore())(func(service *user.Service) {
+		require.ErrorIs(t, service.TouchLastSeen(context.Background(), &userRef), user.ErrInvalid)
+	})
+}
+
+func TestTouchLastSeenReturnsCorrectErrorWhenStoreFails(t *testing.T) {
+	unexpected := errors.New("some unexpected error")
+	cases := []struct {
+		name     string
+		expected error
+		result   error
+	}{
+		{name: "Not Found", expected: user.ErrNotFound, result: userstore.ErrNotFound},
+		{name: "Unexpected error included in chain", expected: unexpected, result: unexpected},
+	}
+	for _, c := range cases {
+		thisCase := c
+		t.Run(thisCase.name, func(t *testing.T) {
+			userRef := fakeUserRef()
+			storeStub := newStubUserStore()
+			storeStub.stubTouchLastSeen = func(context.Context, uuid.UUID, time.Time) error {
+				return thisCase.result
+			}
+			withService(storeStub)(func(service *user.Service) {
+				require.ErrorIs(t, service.TouchLastSeen(context.Background(), &userRef), thisCase.expected)
+			})
+		})
+	}
+}
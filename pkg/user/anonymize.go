@@ -0,0 +1,80 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/telemetry"
+	"github.com/robotlovesyou/fitest/pkg/utctime"
+	"go.opentelemetry.io/otel"
+)
+
+const (
+	// AnonymizedName replaces the first and last names of anonymized users
+	AnonymizedName = "Anonymized"
+	// anonymizedDomain is the domain of the email addresses of anonymized users. The .invalid top level domain is
+	// reserved, so mail can never be delivered to it
+	anonymizedDomain = "anonymized.invalid"
+)
+
+// anonymizedNickname returns the nickname of the anonymized user with the given id. It is derived from the id,
+// rather than the original nickname, so that it is unique and cannot be reversed
+func anonymizedNickname(id uuid.UUID) string {
+	return "anonymized-" + id.String()
+}
+
+// anonymizedEmail returns the email address of the anonymized user with the given id
+func anonymizedEmail(id uuid.UUID) string {
+	return id.String() + "@" + anonymizedDomain
+}
+
+// Anonymize irreversibly replaces the names, nickname and email address of the user identified by ref with
+// placeholders, and removes their avatar and their password so that they can no longer authenticate. The record, its
+// id and its version history are kept, so that references to the user remain valid. It returns ErrNotFound if there
+// is no such user. The change is published with the Anonymized action
+func (service *Service) Anonymize(ctx context.Context, ref *Ref) (usr User, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "Anonymize")
+	defer span.End()
+
+	if err = service.validate.Struct(ref); err != nil {
+		return usr, invalidError(err)
+	}
+
+	id := uuid.MustParse(ref.ID) // ok to call function which can panic because id has already been validated as a uuid
+
+	rec, err := service.store.ReadOne(ctx, id)
+	if err != nil {
+		if errors.Is(err, userstore.ErrNotFound) {
+			return usr, ErrNotFound
+		}
+		span.RecordError(err)
+		return usr, fmt.Errorf("unexpected error reading user store: %w", err)
+	}
+
+	rec.FirstName = AnonymizedName
+	rec.LastName = AnonymizedName
+	rec.Nickname = anonymizedNickname(id)
+	rec.Email = anonymizedEmail(id)
+	rec.PasswordHash = ""
+	rec.AvatarURL = ""
+	rec.UpdatedAt = utctime.Now()
+
+	rec, err = service.store.Anonymize(ctx, &rec)
+	if err != nil {
+		switch {
+		case errors.Is(err, userstore.ErrNotFound):
+			return usr, ErrNotFound
+		case errors.Is(err, userstore.ErrInvalidVersion):
+			return usr, ErrInvalidVersion
+		case errors.Is(err, userstore.ErrIndexesBuilding), errors.Is(err, userstore.ErrTooManyEvents):
+			return usr, ErrUnavailable
+		default:
+			span.RecordError(err)
+			return usr, fmt.Errorf("unexpected error anonymizing user in user store: %w", err)
+		}
+	}
+	return copyStoreUserToUser(&rec), nil
+}
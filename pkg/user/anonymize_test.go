@@ -0,0 +1,83 @@
+package user_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/user"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnonymizeReplacesPersonalInformation(t *testing.T) {
+	rec := fakeUserRecord(func(r *userstore.User) {
+		r.AvatarURL = "https://" + avatarHost + "/avatars/1.png"
+	})
+	userRef := user.Ref{ID: rec.ID.String()}
+	storeStub := newStubUserStore()
+	storeStub.stubReadOne = func(context.Context, uuid.UUID) (userstore.User, error) {
+		return rec, nil
+	}
+	storeStub.stubAnonymize = func(_ context.Context, anonymized *userstore.User) (userstore.User, error) {
+		require.Equal(t, rec.ID, anonymized.ID)
+		require.Equal(t, rec.Version, anonymized.Version)
+		require.Equal(t, rec.Country, anonymized.Country)
+		anonymized.Version += 1
+		return *anonymized, nil
+	}
+	withService(storeStub)(func(service *user.Service) {
+		usr, err := service.Anonymize(context.Background(), &userRef)
+		require.NoError(t, err)
+		require.Equal(t, user.AnonymizedName, usr.FirstName)
+		require.Equal(t, user.AnonymizedName, usr.LastName)
+		for _, value := range []string{usr.Nickname, usr.Email} {
+			require.NotContains(t, value, rec.Nickname)
+			require.NotContains(t, value, strings.Split(rec.Email, "@")[0])
+			require.Contains(t, value, rec.ID.String())
+		}
+		require.Empty(t, usr.PasswordHash)
+		require.Empty(t, usr.AvatarURL)
+		require.Equal(t, rec.Version+1, usr.Version)
+	})
+}
+
+func TestAnonymizeReturnsErrorWhenRefIsInvalid(t *testing.T) {
+	userRef := user.Ref{ID: "not a uuid"}
+	withService(newStubUserStore())(func(service *user.Service) {
+		_, err := service.Anonymize(context.Background(), &userRef)
+		require.ErrorIs(t, err, user.ErrInvalid)
+	})
+}
+
+func TestAnonymizeReturnsCorrectErrorWhenStoreFails(t *testing.T) {
+	unexpected := errors.New("some unexpected error")
+	cases := []struct {
+		name     string
+		expected error
+		result   error
+	}{
+		{name: "Not Found", expected: user.ErrNotFound, result: userstore.ErrNotFound},
+		{name: "Invalid Version", expected: user.ErrInvalidVersion, result: userstore.ErrInvalidVersion},
+		{name: "Unexpected error included in chain", expected: unexpected, result: unexpected},
+	}
+	for _, c := range cases {
+		thisCase := c
+		t.Run(thisCase.name, func(t *testing.T) {
+			userRef := fakeUserRef()
+			storeStub := newStubUserStore()
+			storeStub.stubReadOne = func(context.Context, uuid.UUID) (userstore.User, error) {
+				return fakeUserRecord(), nil
+			}
+			storeStub.stubAnonymize = func(context.Context, *userstore.User) (userstore.User, error) {
+				return userstore.User{}, thisCase.result
+			}
+			withService(storeStub)(func(service *user.Service) {
+				_, err := service.Anonymize(context.Background(), &userRef)
+				require.ErrorIs(t, err, thisCase.expected)
+			})
+		})
+	}
+}
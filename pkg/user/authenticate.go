@@ -0,0 +1,106 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/telemetry"
+	"github.com/robotlovesyou/fitest/pkg/utctime"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrInvalidCredentials is returned when an email address and password do not match a user.
+// It does not say which of them was wrong, so that it cannot be used to discover which email addresses are registered
+var ErrInvalidCredentials = errors.New("email or password is incorrect")
+
+// dummyPassword is hashed to produce a hash which is compared against when authenticating an unknown email address
+const dummyPassword = "not the password of any user"
+
+// dummyHash returns a hash, created by the service hasher, which no password matches in practice.
+// Comparing against it when an email address is unknown means that authentication takes the same time whether or
+// not the email address is registered. The hash is created once, but a failure to create it is returned rather than
+// kept, so that it is created again by the next authentication instead of comparing against an empty hash
+func (service *Service) dummyHash() (string, error) {
+	service.dummyHashMtx.Lock()
+	defer service.dummyHashMtx.Unlock()
+	if service.dummyHashValue == "" {
+		hash, err := service.hasher.Hash(dummyPassword)
+		if err != nil {
+			return "", fmt.Errorf("cannot create dummy password hash: %w", err)
+		}
+		service.dummyHashValue = hash
+	}
+	return service.dummyHashValue, nil
+}
+
+// Authenticate checks that password is the password of the user with the email address email.
+// It returns the user if it is, and ErrInvalidCredentials if the user does not exist, the password is incorrect or the
+// user is suspended, banned or dormant. If the user has two factor authentication enabled, code must also be the
+// current code from their authenticator app or one of their unused recovery codes. ErrTwoFactorRequired is returned
+// if it is empty, and ErrInvalidTwoFactorCode if it is incorrect. Neither is returned unless the password is correct.
+// A successful authentication is recorded as the user's last login. Failing to record it is logged rather than failing
+// the authentication
+func (service *Service) Authenticate(ctx context.Context, email, password, code string) (usr SanitizedUser, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "Authenticate")
+	defer span.End()
+
+	rec, err := service.store.FindByEmail(ctx, email)
+	if err != nil {
+		if !errors.Is(err, userstore.ErrNotFound) {
+			span.RecordError(err)
+			return usr, fmt.Errorf("cannot find user by email: %w", err)
+		}
+		hash, err := service.dummyHash()
+		if err != nil {
+			span.RecordError(err)
+			return usr, err
+		}
+		service.hasher.Compare(hash, password)
+		return usr, ErrInvalidCredentials
+	}
+	if !service.hasher.Compare(rec.PasswordHash, password) || statusOf(rec.Status) != StatusActive {
+		return usr, ErrInvalidCredentials
+	}
+	if rec.TwoFactorEnabled {
+		if err = service.authenticateTwoFactor(ctx, rec.ID, code); err != nil {
+			return usr, err
+		}
+	}
+	now := utctime.Now()
+	if err = service.store.RecordLogin(ctx, rec.ID, now); err != nil {
+		span.RecordError(err)
+		service.logger.Errorf(ctx, err, "cannot record login of user %s", rec.ID)
+	} else {
+		rec.LastLoginAt, rec.LastSeenAt = now, now
+	}
+	return *sanitizedUserFromUserstoreUser(&rec), nil
+}
+
+// authenticateTwoFactor checks the two factor authentication code given to authenticate the user with the given id
+func (service *Service) authenticateTwoFactor(ctx context.Context, id uuid.UUID, code string) error {
+	span := trace.SpanFromContext(ctx)
+	if code == "" {
+		return ErrTwoFactorRequired
+	}
+	rec, err := service.readTwoFactorRecord(ctx, id)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			// the user was deleted since it was found
+			return ErrInvalidCredentials
+		}
+		span.RecordError(err)
+		return err
+	}
+	if err = service.verifyTwoFactorCode(ctx, &rec, code); err != nil {
+		if !errors.Is(err, ErrInvalidTwoFactorCode) {
+			span.RecordError(err)
+			return fmt.Errorf("cannot verify two factor code: %w", err)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package user_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/password"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/user"
+	"github.com/stretchr/testify/require"
+)
+
+const testPassword = "password123"
+
+func storeWithPassword(t *testing.T, pwd string) (*stubUserStore, userstore.User) {
+	hash, err := password.NewWeak().Hash(pwd)
+	require.NoError(t, err)
+	rec := fakeUserRecord(func(r *userstore.User) {
+		r.PasswordHash = hash
+	})
+	storeStub := newStubUserStore()
+	storeStub.stubFindByEmail = func(_ context.Context, email string) (userstore.User, error) {
+		if email != rec.Email {
+			return userstore.User{}, userstore.ErrNotFound
+		}
+		return rec, nil
+	}
+	return storeStub, rec
+}
+
+func TestAuthenticateReturnsUserWithCorrectPassword(t *testing.T) {
+	storeStub, rec := storeWithPassword(t, testPassword)
+	storeStub.stubRecordLogin = func(context.Context, uuid.UUID, time.Time) error {
+		return nil
+	}
+	withService(storeStub)(func(service *user.Service) {
+		usr, err := service.Authenticate(context.Background(), rec.Email, testPassword, "")
+		require.NoError(t, err)
+		require.Equal(t, rec.ID.String(), usr.ID)
+		require.Equal(t, rec.Email, usr.Email)
+	})
+}
+
+func TestAuthenticateRecordsLogin(t *testing.T) {
+	storeStub, rec := storeWithPassword(t, testPassword)
+	var recorded time.Time
+	storeStub.stubRecordLogin = func(_ context.Context, id uuid.UUID, at time.Time) error {
+		require.Equal(t, rec.ID, id)
+		recorded = at
+		return nil
+	}
+	withService(storeStub)(func(service *user.Service) {
+		usr, err := service.Authenticate(context.Background(), rec.Email, testPassword, "")
+		require.NoError(t, err)
+		require.False(t, recorded.IsZero())
+		require.Equal(t, recorded.Format(user.TimeFormat), usr.LastLoginAt)
+		require.Equal(t, recorded.Format(user.TimeFormat), usr.LastSeenAt)
+	})
+}
+
+func TestAuthenticateSucceedsWhenLoginCannotBeRecorded(t *testing.T) {
+	storeStub, rec := storeWithPassword(t, testPassword)
+	storeStub.stubRecordLogin = func(context.Context, uuid.UUID, time.Time) error {
+		return errors.New("cannot record login")
+	}
+	withService(storeStub)(func(service *user.Service) {
+		usr, err := service.Authenticate(context.Background(), rec.Email, testPassword, "")
+		require.NoError(t, err)
+		require.Equal(t, rec.ID.String(), usr.ID)
+		require.Empty(t, usr.LastLoginAt)
+	})
+}
+
+func TestAuthenticateDoesNotDistinguishUnknownEmailFromWrongPassword(t *testing.T) {
+	storeStub, rec := storeWithPassword(t, testPassword)
+	withService(storeStub)(func(service *user.Service) {
+		_, wrongPassword := service.Authenticate(context.Background(), rec.Email, "wrong password", "")
+		require.ErrorIs(t, wrongPassword, user.ErrInvalidCredentials)
+
+		_, unknownEmail := service.Authenticate(context.Background(), "unknown@example.com", testPassword, "")
+		require.ErrorIs(t, unknownEmail, user.ErrInvalidCredentials)
+		require.Equal(t, wrongPassword.Error(), unknownEmail.Error())
+	})
+}
+
+func TestAuthenticateFailsForSuspendedOrBannedUsers(t *testing.T) {
+	for _, status := range []userstore.Status{userstore.StatusSuspended, userstore.StatusBanned} {
+		t.Run(string(status), func(t *testing.T) {
+			storeStub, rec := storeWithPassword(t, testPassword)
+			rec.Status = status
+			storeStub.stubFindByEmail = func(context.Context, string) (userstore.User, error) {
+				return rec, nil
+			}
+			withService(storeStub)(func(service *user.Service) {
+				_, err := service.Authenticate(context.Background(), rec.Email, testPassword, "")
+				require.ErrorIs(t, err, user.ErrInvalidCredentials)
+			})
+		})
+	}
+}
+
+func TestOriginalErrorIsInChainWhenStoreFindByEmailReturnsError(t *testing.T) {
+	unexpected := errors.New("some unexpected error")
+	storeStub := newStubUserStore()
+	storeStub.stubFindByEmail = func(context.Context, string) (userstore.User, error) {
+		return userstore.User{}, unexpected
+	}
+	withService(storeStub)(func(service *user.Service) {
+		_, err := service.Authenticate(context.Background(), "max@example.com", testPassword, "")
+		require.ErrorIs(t, err, unexpected)
+		require.NotErrorIs(t, err, user.ErrInvalidCredentials)
+	})
+}
+
+// countingHasher implements user.PasswordHasher and counts the calls to Compare
+type countingHasher struct {
+	user.PasswordHasher
+	compared int
+}
+
+func (ch *countingHasher) Compare(hash string, plain string) bool {
+	ch.compared++
+	return ch.PasswordHasher.Compare(hash, plain)
+}
+
+func TestAuthenticateComparesPasswordWhenEmailIsUnknown(t *testing.T) {
+	storeStub, _ := storeWithPassword(t, testPassword)
+	hasher := &countingHasher{PasswordHasher: password.NewWeak()}
+	withService(storeStub, useHasher(hasher))(func(service *user.Service) {
+		_, err := service.Authenticate(context.Background(), "unknown@example.com", testPassword, "")
+		require.ErrorIs(t, err, user.ErrInvalidCredentials)
+		require.Equal(t, 1, hasher.compared)
+	})
+}
+
+// flakyHasher implements user.PasswordHasher. Hash fails until failures reaches zero, and Compare records the hashes
+// it compares against
+type flakyHasher struct {
+	user.PasswordHasher
+	failures int
+	compared []string
+}
+
+func (fh *flakyHasher) Hash(plain string) (string, error) {
+	if fh.failures > 0 {
+		fh.failures--
+		return "", errors.New("failed")
+	}
+	return fh.PasswordHasher.Hash(plain)
+}
+
+func (fh *flakyHasher) Compare(hash string, plain string) bool {
+	fh.compared = append(fh.compared, hash)
+	return fh.PasswordHasher.Compare(hash, plain)
+}
+
+func TestAuthenticateCreatesTheDummyHashAgainAfterFailingToCreateIt(t *testing.T) {
+	storeStub, _ := storeWithPassword(t, testPassword)
+	hasher := &flakyHasher{PasswordHasher: password.NewWeak(), failures: 1}
+	withService(storeStub, useHasher(hasher))(func(service *user.Service) {
+		_, err := service.Authenticate(context.Background(), "unknown@example.com", testPassword, "")
+		require.Error(t, err)
+		require.NotErrorIs(t, err, user.ErrInvalidCredentials)
+		require.Empty(t, hasher.compared, "an empty hash is not compared against")
+
+		_, err = service.Authenticate(context.Background(), "unknown@example.com", testPassword, "")
+		require.ErrorIs(t, err, user.ErrInvalidCredentials)
+		require.Len(t, hasher.compared, 1)
+		require.NotEmpty(t, hasher.compared[0])
+	})
+}
@@ -0,0 +1,127 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/robotlovesyou/fitest/pkg/telemetry"
+	"github.com/robotlovesyou/fitest/pkg/tenant"
+	"github.com/robotlovesyou/fitest/pkg/utctime"
+	"go.opentelemetry.io/otel"
+)
+
+const (
+	// AvailabilityCacheTTL is the time the result of checking a nickname or email address is cached for. It should be
+	// configurable
+	AvailabilityCacheTTL = 30 * time.Second
+	// AvailabilityCacheSize is the maximum number of cached results of checking nicknames and email addresses. It
+	// should be configurable
+	AvailabilityCacheSize = 10000
+)
+
+// AvailabilityCheck names a nickname, an email address, or both, to check the availability of
+type AvailabilityCheck struct {
+	Nickname string `validate:"required_without=Email,omitempty,allowed-runes"`
+	Email    string `validate:"required_without=Nickname,omitempty,email"`
+}
+
+// Availability is the result of an AvailabilityCheck
+type Availability struct {
+	// NicknameAvailable is true if the nickname was checked and no user has it
+	NicknameAvailable bool
+	// EmailAvailable is true if the email address was checked and no user has it
+	EmailAvailable bool
+}
+
+// CheckAvailability checks whether the nickname and email address of check can be used by a new user, so that a
+// sign up form can say that they are taken before it is submitted. Results are cached for AvailabilityCacheTTL, which
+// limits the load caused by repeated checks. A nickname or email address reported as available may still be taken
+// before the user is created, in which case Create returns ErrAlreadyExists
+func (service *Service) CheckAvailability(ctx context.Context, check *AvailabilityCheck) (availability Availability, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "CheckAvailability")
+	defer span.End()
+
+	if err = service.validate.Struct(check); err != nil {
+		return availability, invalidError(err)
+	}
+
+	if check.Nickname != "" {
+		taken, err := service.taken(ctx, "nickname", check.Nickname, service.store.NicknameExists)
+		if err != nil {
+			span.RecordError(err)
+			return availability, err
+		}
+		availability.NicknameAvailable = !taken
+	}
+	if check.Email != "" {
+		taken, err := service.taken(ctx, "email", check.Email, service.store.EmailExists)
+		if err != nil {
+			span.RecordError(err)
+			return availability, err
+		}
+		availability.EmailAvailable = !taken
+	}
+	return availability, nil
+}
+
+// taken returns true if value, which is a nickname or email address as named by kind, is used by a user of the tenant
+// of ctx. The cached result is returned if there is one, and exists is called otherwise
+func (service *Service) taken(ctx context.Context, kind, value string, exists func(context.Context, string) (bool, error)) (bool, error) {
+	key := tenant.FromContext(ctx) + "\x00" + kind + "\x00" + value
+	if taken, ok := service.availability.get(key); ok {
+		return taken, nil
+	}
+	taken, err := exists(ctx, value)
+	if err != nil {
+		return false, fmt.Errorf("unexpected error checking %s availability: %w", kind, err)
+	}
+	service.availability.set(key, taken)
+	return taken, nil
+}
+
+// availabilityCache caches whether nicknames and email addresses are taken
+type availabilityCache struct {
+	mtx     sync.Mutex
+	entries map[string]cachedAvailability
+}
+
+type cachedAvailability struct {
+	taken   bool
+	expires time.Time
+}
+
+func newAvailabilityCache() *availabilityCache {
+	return &availabilityCache{entries: make(map[string]cachedAvailability)}
+}
+
+// get returns the cached result for key, and false if there is none or it has expired
+func (cache *availabilityCache) get(key string) (taken bool, ok bool) {
+	cache.mtx.Lock()
+	defer cache.mtx.Unlock()
+	entry, ok := cache.entries[key]
+	if !ok || utctime.Now().After(entry.expires) {
+		return false, false
+	}
+	return entry.taken, true
+}
+
+// set caches the result for key. When the cache is full, expired results are removed, and the result is not cached
+// if it is still full
+func (cache *availabilityCache) set(key string, taken bool) {
+	cache.mtx.Lock()
+	defer cache.mtx.Unlock()
+	now := utctime.Now()
+	if len(cache.entries) >= AvailabilityCacheSize {
+		for k, entry := range cache.entries {
+			if now.After(entry.expires) {
+				delete(cache.entries, k)
+			}
+		}
+		if len(cache.entries) >= AvailabilityCacheSize {
+			return
+		}
+	}
+	cache.entries[key] = cachedAvailability{taken: taken, expires: now.Add(AvailabilityCacheTTL)}
+}
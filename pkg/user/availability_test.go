@@ -0,0 +1,95 @@
+package user_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/robotlovesyou/fitest/pkg/tenant"
+	"github.com/robotlovesyou/fitest/pkg/user"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckAvailabilityReportsTakenNicknamesAndEmails(t *testing.T) {
+	storeStub := newStubUserStore()
+	storeStub.stubNicknameExists = func(_ context.Context, nickname string) (bool, error) {
+		return nickname == "taken", nil
+	}
+	storeStub.stubEmailExists = func(_ context.Context, email string) (bool, error) {
+		return email == "taken@example.com", nil
+	}
+	cases := []struct {
+		name     string
+		check    user.AvailabilityCheck
+		expected user.Availability
+	}{
+		{name: "both available", check: user.AvailabilityCheck{Nickname: "free", Email: "free@example.com"}, expected: user.Availability{NicknameAvailable: true, EmailAvailable: true}},
+		{name: "both taken", check: user.AvailabilityCheck{Nickname: "taken", Email: "taken@example.com"}},
+		{name: "only nickname", check: user.AvailabilityCheck{Nickname: "free"}, expected: user.Availability{NicknameAvailable: true}},
+		{name: "only email", check: user.AvailabilityCheck{Email: "free@example.com"}, expected: user.Availability{EmailAvailable: true}},
+	}
+	withService(storeStub)(func(service *user.Service) {
+		for _, c := range cases {
+			availability, err := service.CheckAvailability(context.Background(), &c.check)
+			require.NoError(t, err, c.name)
+			require.Equal(t, c.expected, availability, c.name)
+		}
+	})
+}
+
+func TestCheckAvailabilityCachesResultsPerTenant(t *testing.T) {
+	storeStub := newStubUserStore()
+	checks := 0
+	storeStub.stubNicknameExists = func(context.Context, string) (bool, error) {
+		checks += 1
+		return true, nil
+	}
+	withService(storeStub)(func(service *user.Service) {
+		check := user.AvailabilityCheck{Nickname: "taken"}
+		for i := 0; i < 3; i++ {
+			availability, err := service.CheckAvailability(context.Background(), &check)
+			require.NoError(t, err)
+			require.False(t, availability.NicknameAvailable)
+		}
+		require.Equal(t, 1, checks)
+
+		_, err := service.CheckAvailability(tenant.With(context.Background(), "acme"), &check)
+		require.NoError(t, err)
+		require.Equal(t, 2, checks)
+	})
+}
+
+func TestCannotCheckAvailabilityOfInvalidValues(t *testing.T) {
+	cases := []struct {
+		name  string
+		check user.AvailabilityCheck
+		field string
+	}{
+		{name: "nothing to check", check: user.AvailabilityCheck{}, field: "Nickname"},
+		{name: "invalid email", check: user.AvailabilityCheck{Email: "not an email"}, field: "Email"},
+	}
+	for _, c := range cases {
+		thisCase := c
+		t.Run(thisCase.name, func(t *testing.T) {
+			withService(newStubUserStore())(func(service *user.Service) {
+				_, err := service.CheckAvailability(context.Background(), &thisCase.check)
+				require.ErrorIs(t, err, user.ErrInvalid)
+				var invalid *user.InvalidError
+				require.ErrorAs(t, err, &invalid)
+				require.Equal(t, thisCase.field, invalid.Violations[0].Field)
+			})
+		})
+	}
+}
+
+func TestOriginalErrorIsInChainWhenStoreExistsReturnsError(t *testing.T) {
+	unexpected := errors.New("some unexpected error")
+	storeStub := newStubUserStore()
+	storeStub.stubEmailExists = func(context.Context, string) (bool, error) {
+		return false, unexpected
+	}
+	withService(storeStub)(func(service *user.Service) {
+		_, err := service.CheckAvailability(context.Background(), &user.AvailabilityCheck{Email: "max@example.com"})
+		require.ErrorIs(t, err, unexpected)
+	})
+}
@@ -0,0 +1,97 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/telemetry"
+	"go.opentelemetry.io/otel"
+)
+
+// MaxBatchDelete is the maximum number of users which can be deleted, or read, in a single batch
+const MaxBatchDelete = 500
+
+// Refs is a reference to a batch of users. At most MaxBatchDelete users can be referenced, which is checked by
+// validateRefs rather than by a tag, since tags cannot refer to the constant
+type Refs struct {
+	IDs []string `validate:"required,unique,dive,uuid"`
+}
+
+// validateRefs validates refs and returns the IDs it references. IDs are not case sensitive, so they are converted to
+// lower case before they are validated, and IDs which differ only in case are duplicates
+func (service *Service) validateRefs(refs *Refs) ([]uuid.UUID, error) {
+	if len(refs.IDs) > MaxBatchDelete {
+		return nil, &InvalidError{Violations: []FieldViolation{{
+			Field:       "IDs",
+			Rule:        "max",
+			Description: fmt.Sprintf("must have at most %d items", MaxBatchDelete),
+		}}}
+	}
+	var normalized Refs
+	for _, id := range refs.IDs {
+		normalized.IDs = append(normalized.IDs, strings.ToLower(id))
+	}
+	if err := service.validate.Struct(&normalized); err != nil {
+		return nil, invalidError(err)
+	}
+	ids := make([]uuid.UUID, 0, len(normalized.IDs))
+	for _, id := range normalized.IDs {
+		ids = append(ids, uuid.MustParse(id)) // the ids have already been validated
+	}
+	return ids, nil
+}
+
+// DeleteResult is the result of deleting a single user in a batch
+type DeleteResult struct {
+	ID string
+	// Deleted is false when the user does not exist or has already been deleted
+	Deleted bool
+}
+
+// BatchDelete deletes each referenced user which exists, returning a result for each ID in the order they were given.
+// If any ID is invalid, or a BeforeDelete hook rejects the deletion of any user, no users are deleted. A user which the
+// store fails to delete, when the others are deleted, is reported as not deleted
+func (service *Service) BatchDelete(ctx context.Context, refs *Refs) ([]DeleteResult, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "BatchDelete")
+	defer span.End()
+
+	ids, err := service.validateRefs(refs)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		if err := service.beforeDelete(ctx, &Ref{ID: id.String()}); err != nil {
+			return nil, err
+		}
+	}
+	deleted, err := service.store.DeleteMany(ctx, ids)
+	var partial *userstore.DeleteManyError
+	switch {
+	case errors.As(err, &partial):
+		// the users which could not be deleted are reported as not deleted, and the others are reported as usual
+		span.RecordError(err)
+		for id, failure := range partial.Failed {
+			service.logger.Errorf(ctx, failure, "cannot delete user %s", id)
+		}
+	case err != nil:
+		span.RecordError(err)
+		return nil, fmt.Errorf("cannot delete users: %w", err)
+	}
+
+	wasDeleted := make(map[uuid.UUID]bool, len(deleted))
+	for _, id := range deleted {
+		wasDeleted[id] = true
+	}
+	results := make([]DeleteResult, 0, len(ids))
+	for i, id := range ids {
+		results = append(results, DeleteResult{ID: refs.IDs[i], Deleted: wasDeleted[id]})
+		if wasDeleted[id] {
+			service.afterDelete(ctx, &Ref{ID: id.String()})
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,130 @@
+package user_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/user"
+	"github.com/stretchr/testify/require"
+)
+
+func fakeUserRefs(n int) user.Refs {
+	refs := user.Refs{}
+	for i := 0; i < n; i++ {
+		refs.IDs = append(refs.IDs, fakeUserRef().ID)
+	}
+	return refs
+}
+
+func TestBatchDeleteCallsStoreAndReturnsResultForEachID(t *testing.T) {
+	refs := fakeUserRefs(3)
+	storeStub := newStubUserStore()
+	withService(storeStub)(func(service *user.Service) {
+		storeStub.stubDeleteMany = func(ctx context.Context, ids []uuid.UUID) ([]uuid.UUID, error) {
+			require.Len(t, ids, len(refs.IDs))
+			for i, id := range ids {
+				require.Equal(t, refs.IDs[i], id.String())
+			}
+			// the second user does not exist
+			return []uuid.UUID{ids[2], ids[0]}, nil
+		}
+		results, err := service.BatchDelete(context.Background(), &refs)
+		require.NoError(t, err)
+		require.Equal(t, []user.DeleteResult{
+			{ID: refs.IDs[0], Deleted: true},
+			{ID: refs.IDs[1], Deleted: false},
+			{ID: refs.IDs[2], Deleted: true},
+		}, results)
+	})
+}
+
+func TestBatchDeleteReturnsErrorWhenRefsAreInvalid(t *testing.T) {
+	duplicated := fakeUserRefs(1)
+	duplicated.IDs = append(duplicated.IDs, duplicated.IDs[0])
+	duplicatedInAnotherCase := fakeUserRefs(1)
+	duplicatedInAnotherCase.IDs = append(duplicatedInAnotherCase.IDs, strings.ToUpper(duplicatedInAnotherCase.IDs[0]))
+	withInvalid := fakeUserRefs(2)
+	withInvalid.IDs = append(withInvalid.IDs, "not a uuid")
+
+	cases := []struct {
+		name string
+		refs user.Refs
+	}{
+		{name: "Empty", refs: user.Refs{}},
+		{name: "Too many", refs: fakeUserRefs(user.MaxBatchDelete + 1)},
+		{name: "Duplicate ID", refs: duplicated},
+		{name: "Duplicate ID in another case", refs: duplicatedInAnotherCase},
+		{name: "Invalid ID", refs: withInvalid},
+	}
+	for _, c := range cases {
+		thisCase := c
+		t.Run(thisCase.name, func(t *testing.T) {
+			storeStub := newStubUserStore()
+			withService(storeStub)(func(service *user.Service) {
+				storeStub.stubDeleteMany = func(context.Context, []uuid.UUID) ([]uuid.UUID, error) {
+					panic("store delete many should not be called when refs are invalid")
+				}
+				_, err := service.BatchDelete(context.Background(), &thisCase.refs)
+				require.ErrorIs(t, err, user.ErrInvalid)
+			})
+		})
+	}
+}
+
+func TestBatchDeleteReturnsErrorWhenStoreDeleteManyFails(t *testing.T) {
+	unexpected := errors.New("some unexpected error")
+	refs := fakeUserRefs(2)
+	storeStub := newStubUserStore()
+	withService(storeStub)(func(service *user.Service) {
+		storeStub.stubDeleteMany = func(context.Context, []uuid.UUID) ([]uuid.UUID, error) {
+			return nil, unexpected
+		}
+		_, err := service.BatchDelete(context.Background(), &refs)
+		require.ErrorIs(t, err, unexpected)
+	})
+}
+
+func TestBatchDeleteAcceptsIDsInUpperCase(t *testing.T) {
+	refs := fakeUserRefs(1)
+	id := uuid.MustParse(refs.IDs[0])
+	refs.IDs[0] = strings.ToUpper(refs.IDs[0])
+	storeStub := newStubUserStore()
+	withService(storeStub)(func(service *user.Service) {
+		storeStub.stubDeleteMany = func(_ context.Context, ids []uuid.UUID) ([]uuid.UUID, error) {
+			require.Equal(t, []uuid.UUID{id}, ids)
+			return ids, nil
+		}
+		results, err := service.BatchDelete(context.Background(), &refs)
+		require.NoError(t, err)
+		require.Equal(t, []user.DeleteResult{{ID: refs.IDs[0], Deleted: true}}, results)
+	})
+}
+
+func TestBatchDeleteReportsUsersTheStoreFailedToDeleteAsNotDeleted(t *testing.T) {
+	refs := fakeUserRefs(3)
+	storeStub := newStubUserStore()
+	var afterDeleted []string
+	hooks := user.Hooks{AfterDelete: []func(context.Context, *user.Ref){func(_ context.Context, ref *user.Ref) {
+		afterDeleted = append(afterDeleted, ref.ID)
+	}}}
+	withService(storeStub)(func(service *user.Service) {
+		service.UseHooks(hooks)
+		storeStub.stubDeleteMany = func(_ context.Context, ids []uuid.UUID) ([]uuid.UUID, error) {
+			return []uuid.UUID{ids[0], ids[2]}, &userstore.DeleteManyError{
+				Failed: map[uuid.UUID]error{ids[1]: errors.New("some write error")},
+			}
+		}
+		results, err := service.BatchDelete(context.Background(), &refs)
+		require.NoError(t, err)
+		require.Equal(t, []user.DeleteResult{
+			{ID: refs.IDs[0], Deleted: true},
+			{ID: refs.IDs[1], Deleted: false},
+			{ID: refs.IDs[2], Deleted: true},
+		}, results)
+		require.Equal(t, []string{refs.IDs[0], refs.IDs[2]}, afterDeleted)
+	})
+}
@@ -0,0 +1,72 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/telemetry"
+	"github.com/robotlovesyou/fitest/pkg/utctime"
+	"go.opentelemetry.io/otel"
+)
+
+// PasswordChange is a request to change the password of a user
+type PasswordChange struct {
+	ID              string `validate:"uuid"`
+	CurrentPassword string `validate:"required"`
+	Password        string `validate:"min=10"`
+	ConfirmPassword string `validate:"required,eqfield=Password"`
+	Version         int64
+}
+
+// ChangePassword changes the password of a user if the request is valid and the current password is correct.
+// It returns ErrInvalidCredentials if the current password is incorrect.
+// The change is published with the PasswordChanged action, rather than as an update
+func (service *Service) ChangePassword(ctx context.Context, change *PasswordChange) (usr User, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "ChangePassword")
+	defer span.End()
+
+	if err = service.validate.Struct(change); err != nil {
+		err = invalidError(err)
+		service.logger.Errorf(ctx, err, "cannot change password with invalid request")
+		return usr, err
+	}
+
+	id := uuid.MustParse(change.ID) // ok to call function which can panic because id has already been validated as a uuid
+
+	rec, err := service.store.ReadOne(ctx, id)
+	if err != nil {
+		if errors.Is(err, userstore.ErrNotFound) {
+			return usr, ErrNotFound
+		}
+		return usr, fmt.Errorf("unexpected error reading user store: %w", err)
+	}
+	if change.Version != rec.Version {
+		return usr, ErrInvalidVersion
+	}
+	if !service.hasher.Compare(rec.PasswordHash, change.CurrentPassword) {
+		return usr, ErrInvalidCredentials
+	}
+
+	if rec.PasswordHash, err = service.hasher.Hash(change.Password); err != nil {
+		return usr, fmt.Errorf("cannot hash password: %w", err)
+	}
+	rec.UpdatedAt = utctime.Now()
+
+	rec, err = service.store.ChangePassword(ctx, &rec)
+	if err != nil {
+		switch {
+		case errors.Is(err, userstore.ErrNotFound):
+			return usr, ErrNotFound
+		case errors.Is(err, userstore.ErrInvalidVersion):
+			return usr, ErrInvalidVersion
+		case errors.Is(err, userstore.ErrTooManyEvents):
+			return usr, ErrUnavailable
+		default:
+			return usr, fmt.Errorf("unexpected error changing password in user store: %w", err)
+		}
+	}
+	return copyStoreUserToUser(&rec), nil
+}
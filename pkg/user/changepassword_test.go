@@ -0,0 +1,92 @@
+package user_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/user"
+	"github.com/stretchr/testify/require"
+)
+
+func fakePasswordChange(rec userstore.User) user.PasswordChange {
+	return user.PasswordChange{
+		ID:              rec.ID.String(),
+		CurrentPassword: testPassword,
+		Password:        "newpassword123",
+		ConfirmPassword: "newpassword123",
+		Version:         rec.Version,
+	}
+}
+
+func TestChangePasswordStoresHashOfNewPassword(t *testing.T) {
+	storeStub, rec := storeWithPassword(t, testPassword)
+	change := fakePasswordChange(rec)
+	withService(storeStub)(func(service *user.Service) {
+		storeStub.stubReadOne = func(_ context.Context, id uuid.UUID) (userstore.User, error) {
+			require.True(t, compareIDs(rec.ID, id))
+			return rec, nil
+		}
+		storeStub.stubChangePassword = func(_ context.Context, changed *userstore.User) (userstore.User, error) {
+			require.True(t, checkPasswordHash(changed.PasswordHash, change.Password))
+			require.Equal(t, rec.FirstName, changed.FirstName)
+			changed.Version += 1
+			return *changed, nil
+		}
+		usr, err := service.ChangePassword(context.Background(), &change)
+		require.NoError(t, err)
+		require.Equal(t, rec.Version+1, usr.Version)
+	})
+}
+
+func TestCannotChangePasswordWithWrongCurrentPassword(t *testing.T) {
+	storeStub, rec := storeWithPassword(t, testPassword)
+	change := fakePasswordChange(rec)
+	change.CurrentPassword = "wrong password"
+	withService(storeStub)(func(service *user.Service) {
+		storeStub.stubReadOne = func(context.Context, uuid.UUID) (userstore.User, error) {
+			return rec, nil
+		}
+		_, err := service.ChangePassword(context.Background(), &change)
+		require.ErrorIs(t, err, user.ErrInvalidCredentials)
+	})
+}
+
+func TestCannotChangePasswordWithInvalidRequest(t *testing.T) {
+	rec := fakeUserRecord()
+	cases := []struct {
+		name   string
+		mutate func(*user.PasswordChange)
+		field  string
+	}{
+		{name: "short password", mutate: func(c *user.PasswordChange) { c.Password, c.ConfirmPassword = "short", "short" }, field: "Password"},
+		{name: "mismatched confirmation", mutate: func(c *user.PasswordChange) { c.ConfirmPassword = "different123" }, field: "ConfirmPassword"},
+		{name: "missing current password", mutate: func(c *user.PasswordChange) { c.CurrentPassword = "" }, field: "CurrentPassword"},
+	}
+	for _, testCase := range cases {
+		t.Run(testCase.name, func(t *testing.T) {
+			change := fakePasswordChange(rec)
+			testCase.mutate(&change)
+			withService(newStubUserStore())(func(service *user.Service) {
+				_, err := service.ChangePassword(context.Background(), &change)
+				var invalid *user.InvalidError
+				require.ErrorAs(t, err, &invalid)
+				require.Equal(t, testCase.field, invalid.Violations[0].Field)
+			})
+		})
+	}
+}
+
+func TestCannotChangePasswordWithStaleVersion(t *testing.T) {
+	storeStub, rec := storeWithPassword(t, testPassword)
+	change := fakePasswordChange(rec)
+	change.Version = rec.Version - 1
+	withService(storeStub)(func(service *user.Service) {
+		storeStub.stubReadOne = func(context.Context, uuid.UUID) (userstore.User, error) {
+			return rec, nil
+		}
+		_, err := service.ChangePassword(context.Background(), &change)
+		require.ErrorIs(t, err, user.ErrInvalidVersion)
+	})
+}
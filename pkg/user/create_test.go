@@ -9,6 +9,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/robotlovesyou/fitest/pkg/store/userstore"
 	"github.com/robotlovesyou/fitest/pkg/user"
+	"github.com/robotlovesyou/fitest/pkg/validation"
 	"github.com/stretchr/testify/require"
 )
 
@@ -93,6 +94,21 @@ func TestCorrectErrorIsReturnedWhenStoreReturnsErrAlreadyExists(t *testing.T) {
 			expected: user.ErrAlreadyExists,
 			result:   userstore.ErrAlreadyExists,
 		},
+		{
+			name:     "Email In Use",
+			expected: user.ErrEmailInUse,
+			result:   userstore.ErrEmailInUse,
+		},
+		{
+			name:     "Nickname In Use",
+			expected: user.ErrNicknameInUse,
+			result:   userstore.ErrNicknameInUse,
+		},
+		{
+			name:     "Indexes Building",
+			expected: user.ErrUnavailable,
+			result:   userstore.ErrIndexesBuilding,
+		},
 		{
 			name:     "Unepected Error included in chain",
 			expected: unexpected,
@@ -115,6 +131,34 @@ func TestCorrectErrorIsReturnedWhenStoreReturnsErrAlreadyExists(t *testing.T) {
 
 }
 
+func TestNewUserWithIdempotencyKeyCallsStoreCreateWithKey(t *testing.T) {
+	store := newStubUserStore()
+	newUser := fakeNewUser(func(nu *user.NewUser) {
+		nu.IdempotencyKey = "some key"
+		nu.Caller = "jwt:caller"
+	})
+	original := fakeUserRecord()
+	withService(store)(func(service *user.Service) {
+		store.stubCreateWithKey = func(ctx context.Context, usr *userstore.User, key string) (userstore.User, error) {
+			// the key is scoped by the caller
+			require.Equal(t, "10:jwt:caller:some key", key)
+			require.Equal(t, newUser.Email, usr.Email)
+			// the store returns the user created by an earlier request with the same key
+			return original, nil
+		}
+		usr, err := service.Create(context.Background(), &newUser)
+		require.NoError(t, err)
+		require.True(t, compareIDs(usr.ID, original.ID))
+		require.Equal(t, original.Email, usr.Email)
+
+		store.stubCreateWithKey = func(context.Context, *userstore.User, string) (userstore.User, error) {
+			return userstore.User{}, userstore.ErrIdempotencyKeyReused
+		}
+		_, err = service.Create(context.Background(), &newUser)
+		require.ErrorIs(t, err, user.ErrIdempotencyKeyReused)
+	})
+}
+
 func TestCorrectErrorIsReturnedForInvalidNewUser(t *testing.T) {
 	// In a real world implementation, the validation would need to return information rich enough to allow the consumer to
 	// address the issue, because "computer says 'No'" is not very helpful, but it will do for here, hopefully!
@@ -227,3 +271,43 @@ func TestCorrectErrorIsReturnedForInvalidNewUser(t *testing.T) {
 		})
 	}
 }
+
+func TestInvalidNewUserErrorDescribesEachInvalidField(t *testing.T) {
+	store := newStubUserStore()
+	newUser := fakeNewUser(func(nu *user.NewUser) {
+		nu.FirstName = ""
+		nu.Email = "not an email address"
+	})
+	withService(store)(func(service *user.Service) {
+		_, err := service.Create(context.Background(), &newUser)
+		var invalid *user.InvalidError
+		require.ErrorAs(t, err, &invalid)
+		require.Len(t, invalid.Violations, 2)
+		require.Equal(t, "FirstName", invalid.Violations[0].Field)
+		require.Equal(t, "required", invalid.Violations[0].Rule)
+		require.Equal(t, "Email", invalid.Violations[1].Field)
+		require.Equal(t, "email", invalid.Violations[1].Rule)
+		for _, v := range invalid.Violations {
+			require.NotEmpty(t, v.Description)
+		}
+	})
+}
+
+func TestCreateRejectsCountryNotAllowedByPolicy(t *testing.T) {
+	store := newStubUserStore()
+	newUser := fakeNewUser(func(nu *user.NewUser) {
+		nu.Country = "KP"
+	})
+	withService(store, useCountries(validation.CountryList{Allow: []string{"DE", "FR"}}))(func(service *user.Service) {
+		store.stubCreate = func(context.Context, *userstore.User) (userstore.User, error) {
+			panic("should not be calling store with a country which is not allowed")
+		}
+		_, err := service.Create(context.Background(), &newUser)
+		var invalid *user.InvalidError
+		require.ErrorAs(t, err, &invalid)
+		require.Len(t, invalid.Violations, 1)
+		require.Equal(t, "Country", invalid.Violations[0].Field)
+		require.Equal(t, "allowed-country", invalid.Violations[0].Rule)
+		require.Equal(t, "is not a country users can be registered in", invalid.Violations[0].Description)
+	})
+}
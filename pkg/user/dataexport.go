@@ -0,0 +1,103 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/telemetry"
+	"github.com/robotlovesyou/fitest/pkg/utctime"
+	"go.opentelemetry.io/otel"
+)
+
+// DataExport is everything held about a single user, for answering subject access requests.
+// Events are removed from the record once they have been published, so only the events which are still waiting to
+// be published are held, and exported. Password hashes and token hashes are credentials rather than information
+// about the user, so they are not exported
+type DataExport struct {
+	User *SanitizedUser `json:"user"`
+	// Tenant is the tenant of the user. It is empty for the default tenant
+	Tenant string `json:"tenant,omitempty"`
+	// DeletedAt is the time the user was soft deleted, if it has been
+	DeletedAt string `json:"deleted_at,omitempty"`
+	// PasswordResetExpiresAt is the time the pending password reset token expires, if there is one
+	PasswordResetExpiresAt string `json:"password_reset_expires_at,omitempty"`
+	// PendingEmailChange is the change of email address waiting to be confirmed, if there is one
+	PendingEmailChange *PendingEmailChange `json:"pending_email_change,omitempty"`
+	// PreviousNicknames are the nicknames the user has changed from, oldest first
+	PreviousNicknames []PreviousNickname `json:"previous_nicknames,omitempty"`
+	// PendingEvents are the events about the user which have not been published yet. Their tokens are removed
+	PendingEvents []Event `json:"pending_events"`
+	ExportedAt    string  `json:"exported_at"`
+}
+
+// PendingEmailChange is a change of email address waiting to be confirmed by the user
+type PendingEmailChange struct {
+	Email     string `json:"email"`
+	ExpiresAt string `json:"expires_at"`
+}
+
+// PreviousNickname is a nickname a user has changed from
+type PreviousNickname struct {
+	Nickname  string `json:"nickname"`
+	ChangedAt string `json:"changed_at"`
+}
+
+// ExportData returns everything held about the user identified by ref, including soft deleted users.
+// It returns ErrNotFound if there is no such user
+func (service *Service) ExportData(ctx context.Context, ref *Ref) (export DataExport, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "ExportData")
+	defer span.End()
+
+	if err = service.validate.Struct(ref); err != nil {
+		return export, invalidError(err)
+	}
+
+	id := uuid.MustParse(ref.ID) // ok to call function which can panic because id has already been validated as a uuid
+
+	rec, err := service.store.ReadRecord(ctx, id)
+	if err != nil {
+		if errors.Is(err, userstore.ErrNotFound) {
+			return export, ErrNotFound
+		}
+		span.RecordError(err)
+		return export, fmt.Errorf("unexpected error reading user store: %w", err)
+	}
+	return dataExportFromRecord(&rec), nil
+}
+
+func dataExportFromRecord(rec *userstore.Record) DataExport {
+	export := DataExport{
+		User:          sanitizedUserFromUserstoreUser(rec.Data),
+		Tenant:        rec.Tenant,
+		PendingEvents: make([]Event, 0, len(rec.Events)),
+		ExportedAt:    utctime.Now().Format(TimeFormat),
+	}
+	if rec.DeletedAt != nil {
+		export.DeletedAt = rec.DeletedAt.Format(TimeFormat)
+	}
+	if rec.ResetToken != nil {
+		export.PasswordResetExpiresAt = rec.ResetToken.ExpiresAt.Format(TimeFormat)
+	}
+	if rec.EmailChange != nil {
+		export.PendingEmailChange = &PendingEmailChange{
+			Email:     rec.EmailChange.Email,
+			ExpiresAt: rec.EmailChange.ExpiresAt.Format(TimeFormat),
+		}
+	}
+	for _, previous := range rec.PreviousNicknames {
+		export.PreviousNicknames = append(export.PreviousNicknames, PreviousNickname{
+			Nickname:  previous.Nickname,
+			ChangedAt: previous.ChangedAt.Format(TimeFormat),
+		})
+	}
+	for i := range rec.Events {
+		evt := eventFromUserstoreEvent(&rec.Events[i])
+		evt.Token = ""
+		evt.SentAt = ""
+		export.PendingEvents = append(export.PendingEvents, evt)
+	}
+	return export
+}
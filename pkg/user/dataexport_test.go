@@ -0,0 +1,93 @@
+package user_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/user"
+	"github.com/robotlovesyou/fitest/pkg/utctime"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportDataIncludesRecordAndPendingEvents(t *testing.T) {
+	rec := fakeUserRecord()
+	deletedAt := utctime.Now()
+	storeStub := newStubUserStore()
+	storeStub.stubReadRecord = func(_ context.Context, id uuid.UUID) (userstore.Record, error) {
+		require.Equal(t, rec.ID, id)
+		return userstore.Record{
+			ID:     rec.ID,
+			Data:   &rec,
+			Tenant: "acme",
+			Events: []userstore.Event{
+				{ID: rec.ID, Version: rec.Version, Action: userstore.Created, CreatedAt: rec.CreatedAt, Tenant: "acme", Data: &rec},
+				{ID: rec.ID, Version: rec.Version, Action: userstore.PasswordResetRequested, CreatedAt: rec.CreatedAt, Tenant: "acme", Token: "secret"},
+			},
+			ResetToken:  &userstore.ResetToken{Hash: "reset hash", ExpiresAt: deletedAt.Add(time.Hour)},
+			EmailChange: &userstore.EmailChange{Email: "new@example.com", Hash: "email hash", ExpiresAt: deletedAt.Add(time.Hour)},
+			DeletedAt:   &deletedAt,
+			PreviousNicknames: []userstore.PreviousNickname{
+				{Nickname: "previous", ChangedAt: deletedAt.Add(-time.Hour)},
+			},
+		}, nil
+	}
+	withService(storeStub)(func(service *user.Service) {
+		export, err := service.ExportData(context.Background(), &user.Ref{ID: rec.ID.String()})
+		require.NoError(t, err)
+		require.Equal(t, rec.ID.String(), export.User.ID)
+		require.Equal(t, rec.Email, export.User.Email)
+		require.Equal(t, "acme", export.Tenant)
+		require.Equal(t, deletedAt.Format(user.TimeFormat), export.DeletedAt)
+		require.NotEmpty(t, export.PasswordResetExpiresAt)
+		require.Equal(t, "new@example.com", export.PendingEmailChange.Email)
+		require.Equal(t, []user.PreviousNickname{
+			{Nickname: "previous", ChangedAt: deletedAt.Add(-time.Hour).Format(user.TimeFormat)},
+		}, export.PreviousNicknames)
+		require.Len(t, export.PendingEvents, 2)
+		require.Equal(t, string(userstore.Created), export.PendingEvents[0].Action)
+
+		doc, err := json.Marshal(export)
+		require.NoError(t, err)
+		for _, secret := range []string{"secret", "reset hash", "email hash", rec.PasswordHash} {
+			require.NotContains(t, string(doc), secret)
+		}
+	})
+}
+
+func TestExportDataReturnsErrorWhenRefIsInvalid(t *testing.T) {
+	withService(newStubUserStore())(func(service *user.Service) {
+		_, err := service.ExportData(context.Background(), &user.Ref{ID: "not a uuid"})
+		require.ErrorIs(t, err, user.ErrInvalid)
+	})
+}
+
+func TestExportDataReturnsCorrectErrorWhenStoreFails(t *testing.T) {
+	unexpected := errors.New("some unexpected error")
+	cases := []struct {
+		name     string
+		expected error
+		result   error
+	}{
+		{name: "Not Found", expected: user.ErrNotFound, result: userstore.ErrNotFound},
+		{name: "Unexpected error included in chain", expected: unexpected, result: unexpected},
+	}
+	for _, c := range cases {
+		thisCase := c
+		t.Run(thisCase.name, func(t *testing.T) {
+			userRef := fakeUserRef()
+			storeStub := newStubUserStore()
+			storeStub.stubReadRecord = func(context.Context, uuid.UUID) (userstore.Record, error) {
+				return userstore.Record{}, thisCase.result
+			}
+			withService(storeStub)(func(service *user.Service) {
+				_, err := service.ExportData(context.Background(), &userRef)
+				require.ErrorIs(t, err, thisCase.expected)
+			})
+		})
+	}
+}
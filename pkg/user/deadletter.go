@@ -0,0 +1,100 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/telemetry"
+	"go.opentelemetry.io/otel"
+)
+
+const (
+	// DefaultMaxEventAttempts is the number of times an event is sent before it is dead lettered, unless the service
+	// is configured with UseMaxEventAttempts
+	DefaultMaxEventAttempts = int64(10)
+)
+
+// DeadLetter describes an event which failed to be published too many times. It is not published again until it is
+// requeued, and the later events of its user wait behind it, so that the events of a user are published in order
+type DeadLetter struct {
+	// ID is the id of the user the event is for
+	ID        uuid.UUID
+	Version   int64
+	Action    string
+	CreatedAt time.Time
+	// DeadLetteredAt is the time the event was dead lettered
+	DeadLetteredAt time.Time
+	// Attempts is the number of times the event was sent
+	Attempts int64
+}
+
+// UseMaxEventAttempts sets the number of times an event is sent before it is dead lettered. A maximum of 0 sends
+// events until they are published, however many times that takes. It must be called before the service publishes
+// changes
+func (service *Service) UseMaxEventAttempts(attempts int64) {
+	service.maxEventAttempts = attempts
+}
+
+// deadLetterIfExhausted dead letters ue, which could not be sent, if it has been sent the maximum number of times, so
+// that an event which cannot be published is not sent forever
+func (service *Service) deadLetterIfExhausted(ctx context.Context, ue *userstore.Event) {
+	if service.maxEventAttempts == 0 || ue.Attempts < service.maxEventAttempts {
+		return
+	}
+	if err := service.store.DeadLetterEvent(ctx, ue.ID, ue.Version); err != nil {
+		service.logger.Errorf(ctx, err, "cannot dead letter event with id:%s and version %d", ue.ID, ue.Version)
+		return
+	}
+	service.logger.Infof(ctx, "dead lettered event with id: %s and version: %d after %d attempts", ue.ID, ue.Version, ue.Attempts)
+}
+
+// DeadLetters lists the dead lettered events of the users of the tenant of ctx, including deleted users, in the order
+// they were dead lettered
+func (service *Service) DeadLetters(ctx context.Context) ([]DeadLetter, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "DeadLetters")
+	defer span.End()
+
+	events, err := service.store.DeadLetters(ctx)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("cannot read dead letters from store: %w", err)
+	}
+	deadLetters := make([]DeadLetter, 0, len(events))
+	for _, e := range events {
+		deadLetters = append(deadLetters, DeadLetter{
+			ID:             e.ID,
+			Version:        e.Version,
+			Action:         string(e.Action),
+			CreatedAt:      e.CreatedAt,
+			DeadLetteredAt: e.UpdatedAt,
+			Attempts:       e.Attempts,
+		})
+	}
+	return deadLetters, nil
+}
+
+// RequeueDeadLetter returns the dead lettered event of the user identified by ref to the outbox, so that it is
+// published again, followed by the later events of the user. It returns ErrNotFound if the user has no dead lettered
+// event
+func (service *Service) RequeueDeadLetter(ctx context.Context, ref *Ref) error {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "RequeueDeadLetter")
+	defer span.End()
+
+	if err := service.validate.Struct(ref); err != nil {
+		return invalidError(err)
+	}
+
+	err := service.store.RequeueDeadLetter(ctx, uuid.MustParse(ref.ID)) // the id has already been validated
+	if err != nil {
+		if errors.Is(err, userstore.ErrNotFound) {
+			return ErrNotFound
+		}
+		span.RecordError(err)
+		return fmt.Errorf("cannot requeue dead letter in store: %w", err)
+	}
+	return nil
+}
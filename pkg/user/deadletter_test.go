@@ -0,0 +1,167 @@
+package user_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/event"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/tenant"
+	"github.com/robotlovesyou/fitest/pkg/user"
+	"github.com/robotlovesyou/fitest/pkg/utctime"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventsWhichCannotBeSentAreDeadLetteredAfterTheMaximumAttempts(t *testing.T) {
+	cases := []struct {
+		name         string
+		maxAttempts  int64
+		attempts     int64
+		deadLettered bool
+	}{
+		{name: "Below the maximum", maxAttempts: user.DefaultMaxEventAttempts, attempts: user.DefaultMaxEventAttempts - 1},
+		{name: "At the maximum", maxAttempts: user.DefaultMaxEventAttempts, attempts: user.DefaultMaxEventAttempts, deadLettered: true},
+		{name: "Above the maximum", maxAttempts: 3, attempts: 4, deadLettered: true},
+		{name: "No maximum", maxAttempts: 0, attempts: 1000},
+	}
+	for _, c := range cases {
+		thisCase := c
+		t.Run(thisCase.name, func(t *testing.T) {
+			store, events, _ := redeliveringStore()
+			var mtx sync.Mutex
+			var deadLettered []uuid.UUID
+			store.stubDeadLetterEvent = func(ctx context.Context, id uuid.UUID, version int64) error {
+				mtx.Lock()
+				defer mtx.Unlock()
+				require.Equal(t, "acme", tenant.FromContext(ctx))
+				require.Equal(t, user.DefaultVersion, version)
+				deadLettered = append(deadLettered, id)
+				return nil
+			}
+			eventStub := newEventStub()
+			eventStub.sendStub = func([]byte) event.Result {
+				return sadSendResult{}
+			}
+			withService(store, useBus(eventStub))(func(service *user.Service) {
+				service.UseMaxEventAttempts(thisCase.maxAttempts)
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				go service.PublishChanges(ctx, user.PublishConfig{})
+
+				e := eventForUserRecord(fakeUserRecord())
+				e.Tenant = "acme"
+				e.Attempts = thisCase.attempts
+				events <- e
+				// the event is dead lettered before the failure is recorded
+				for service.CheckEventCount() < 1 {
+					time.Sleep(time.Millisecond)
+				}
+
+				mtx.Lock()
+				defer mtx.Unlock()
+				if thisCase.deadLettered {
+					require.Equal(t, []uuid.UUID{e.ID}, deadLettered)
+				} else {
+					require.Empty(t, deadLettered)
+				}
+			})
+		})
+	}
+}
+
+func TestDeadLettersDescribesTheDeadLetteredEvents(t *testing.T) {
+	rec := fakeUserRecord()
+	created := utctime.Now().Add(-time.Hour)
+	deadLettered := utctime.Now()
+	storeStub := newStubUserStore()
+	storeStub.stubDeadLetters = func(ctx context.Context) ([]userstore.Event, error) {
+		require.Equal(t, "acme", tenant.FromContext(ctx))
+		return []userstore.Event{{
+			ID:        rec.ID,
+			State:     userstore.DeadLettered,
+			Action:    userstore.Updated,
+			Version:   3,
+			CreatedAt: created,
+			UpdatedAt: deadLettered,
+			Data:      &rec,
+			Attempts:  10,
+		}}, nil
+	}
+	withService(storeStub)(func(service *user.Service) {
+		deadLetters, err := service.DeadLetters(tenant.With(context.Background(), "acme"))
+		require.NoError(t, err)
+		require.Equal(t, []user.DeadLetter{{
+			ID:             rec.ID,
+			Version:        3,
+			Action:         string(userstore.Updated),
+			CreatedAt:      created,
+			DeadLetteredAt: deadLettered,
+			Attempts:       10,
+		}}, deadLetters)
+	})
+}
+
+func TestDeadLettersReturnsErrorWhenStoreFails(t *testing.T) {
+	unexpected := errors.New("some unexpected error")
+	storeStub := newStubUserStore()
+	storeStub.stubDeadLetters = func(context.Context) ([]userstore.Event, error) {
+		return nil, unexpected
+	}
+	withService(storeStub)(func(service *user.Service) {
+		_, err := service.DeadLetters(context.Background())
+		require.ErrorIs(t, err, unexpected)
+	})
+}
+
+func TestRequeueDeadLetterCallsStoreWithCorrectParameters(t *testing.T) {
+	userRef := fakeUserRef()
+	called := false
+	storeStub := newStubUserStore()
+	storeStub.stubRequeueDeadLetter = func(_ context.Context, id uuid.UUID) error {
+		require.Equal(t, userRef.ID, id.String())
+		called = true
+		return nil
+	}
+	withService(storeStub)(func(service *user.Service) {
+		require.NoError(t, service.RequeueDeadLetter(context.Background(), &userRef))
+		require.True(t, called)
+	})
+}
+
+func TestRequeueDeadLetterReturnsErrorWhenRefIsInvalid(t *testing.T) {
+	userRef := user.Ref{ID: "not a uuid"}
+	withService(newStubUserStore())(func(service *user.Service) {
+		err := service.RequeueDeadLetter(context.Background(), &userRef)
+		require.ErrorIs(t, err, user.ErrInvalid)
+	})
+}
+
+func TestRequeueDeadLetterReturnsCorrectErrorWhenStoreRequeueFails(t *testing.T) {
+	unexpected := errors.New("some unexpected error")
+	cases := []struct {
+		name     string
+		expected error
+		result   error
+	}{
+		{name: "Not Found", expected: user.ErrNotFound, result: userstore.ErrNotFound},
+		{name: "Unexpected error included in chain", expected: unexpected, result: unexpected},
+	}
+	for _, c := range cases {
+		thisCase := c
+		t.Run(thisCase.name, func(t *testing.T) {
+			userRef := fakeUserRef()
+			storeStub := newStubUserStore()
+			storeStub.stubRequeueDeadLetter = func(context.Context, uuid.UUID) error {
+				return thisCase.result
+			}
+			withService(storeStub)(func(service *user.Service) {
+				err := service.RequeueDeadLetter(context.Background(), &userRef)
+				require.ErrorIs(t, err, thisCase.expected)
+			})
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package user
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/utctime"
+)
+
+const (
+	// DeduplicationWindow is the time for which a published event is remembered, so that it is not published again
+	// when the store sends it again. It should be configurable
+	DeduplicationWindow = 10 * RetryInterval
+	// DeduplicationSize is the maximum number of published events remembered. It should be configurable
+	DeduplicationSize = 10000
+)
+
+// publishState is the state of an event known to the publisher
+type publishState int
+
+const (
+	// eventUnseen events are not being sent, and have not been sent recently
+	eventUnseen publishState = iota
+	// eventSending events are being sent by the bus
+	eventSending
+	// eventSent events have been confirmed as sent by the bus
+	eventSent
+)
+
+// eventKey identifies an event. Events which do not change a user, such as PasswordResetRequested, have the version
+// of the change before them, so the action and creation time are needed to tell events apart
+type eventKey struct {
+	tenant    string
+	id        uuid.UUID
+	version   int64
+	action    userstore.Action
+	createdAt int64
+}
+
+func eventKeyOf(ue *userstore.Event) eventKey {
+	return eventKey{
+		tenant:    ue.Tenant,
+		id:        ue.ID,
+		version:   ue.Version,
+		action:    ue.Action,
+		createdAt: ue.CreatedAt.UnixNano(),
+	}
+}
+
+// publishedEvents remembers the events being sent, and the events sent within DeduplicationWindow. The store sends
+// an event again when it is not processed within RetryInterval, which happens when sending it is slow, or it was
+// sent but could not be marked as processed. publishedEvents lets the publisher send each event once, so that
+// consumers see each change once from each instance of the service
+type publishedEvents struct {
+	mtx     sync.Mutex
+	entries map[eventKey]publishedEvent
+}
+
+type publishedEvent struct {
+	state   publishState
+	expires time.Time
+}
+
+func newPublishedEvents() *publishedEvents {
+	return &publishedEvents{entries: make(map[eventKey]publishedEvent)}
+}
+
+// begin returns the state of the event with the given key. If it is eventUnseen, the event is recorded as being sent
+func (published *publishedEvents) begin(key eventKey) publishState {
+	published.mtx.Lock()
+	defer published.mtx.Unlock()
+	entry, ok := published.entries[key]
+	if ok && (entry.state == eventSending || utctime.Now().Before(entry.expires)) {
+		return entry.state
+	}
+	published.set(key, publishedEvent{state: eventSending})
+	return eventUnseen
+}
+
+// sent records that the event with the given key has been sent
+func (published *publishedEvents) sent(key eventKey) {
+	published.mtx.Lock()
+	defer published.mtx.Unlock()
+	published.set(key, publishedEvent{state: eventSent, expires: utctime.Now().Add(DeduplicationWindow)})
+}
+
+// abandon forgets the event with the given key, which could not be sent, so that it is sent when it is retried
+func (published *publishedEvents) abandon(key eventKey) {
+	published.mtx.Lock()
+	defer published.mtx.Unlock()
+	delete(published.entries, key)
+}
+
+// set records entry for key. When there are DeduplicationSize entries, the expired entries are removed, and entry is
+// not recorded if there are still too many. It must be called with the mutex held
+func (published *publishedEvents) set(key eventKey, entry publishedEvent) {
+	if _, ok := published.entries[key]; !ok && len(published.entries) >= DeduplicationSize {
+		now := utctime.Now()
+		for k, e := range published.entries {
+			if e.state == eventSent && now.After(e.expires) {
+				delete(published.entries, k)
+			}
+		}
+		if len(published.entries) >= DeduplicationSize {
+			return
+		}
+	}
+	published.entries[key] = entry
+}
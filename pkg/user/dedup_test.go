@@ -0,0 +1,153 @@
+package user_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/event"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/user"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingSendResult is a send result which is not done until release is closed
+type blockingSendResult struct {
+	release <-chan struct{}
+}
+
+func (result blockingSendResult) Done(context.Context) error {
+	<-result.release
+	return nil
+}
+
+// redeliveringStore returns a stub store whose events are sent on the returned channel, so that a test can send the
+// same event several times. Each call to ProcessEvent returns the next of results, and is signalled on processed
+func redeliveringStore(results ...error) (*stubUserStore, chan<- userstore.Event, <-chan struct{}) {
+	store := newStubUserStore()
+	events := make(chan userstore.Event)
+	processed := make(chan struct{}, len(results))
+	store.stubEvents = func(ctx context.Context, _, _, _ time.Duration) <-chan userstore.EventResult {
+		out := make(chan userstore.EventResult)
+		go func() {
+			for {
+				select {
+				case e := <-events:
+					select {
+					case out <- userstore.EventResult{Event: e}:
+					case <-ctx.Done():
+						return
+					}
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+		return out
+	}
+	var mtx sync.Mutex
+	store.stubProcessEvent = func(context.Context, uuid.UUID, int64) error {
+		mtx.Lock()
+		defer mtx.Unlock()
+		err := results[0]
+		results = results[1:]
+		processed <- struct{}{}
+		return err
+	}
+	return store, events, processed
+}
+
+func TestRedeliveredEventsWhichWereSentAreOnlyProcessed(t *testing.T) {
+	store, events, processed := redeliveringStore(errors.New("cannot process"), nil)
+	var sends int
+	var mtx sync.Mutex
+	eventStub := newEventStub()
+	eventStub.sendStub = func([]byte) event.Result {
+		mtx.Lock()
+		defer mtx.Unlock()
+		sends += 1
+		return happySendResult{}
+	}
+	withService(store, useBus(eventStub))(func(service *user.Service) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go service.PublishChanges(ctx, user.PublishConfig{})
+
+		e := eventForUserRecord(fakeUserRecord())
+		events <- e
+		<-processed
+		events <- e
+		<-processed
+
+		mtx.Lock()
+		defer mtx.Unlock()
+		require.Equal(t, 1, sends)
+	})
+}
+
+func TestRedeliveredEventsWhichAreBeingSentAreSkipped(t *testing.T) {
+	store, events, processed := redeliveringStore(nil, nil)
+	release := make(chan struct{})
+	sent := make(chan struct{}, 2)
+	eventStub := newEventStub()
+	eventStub.sendStub = func([]byte) event.Result {
+		sent <- struct{}{}
+		return blockingSendResult{release: release}
+	}
+	withService(store, useBus(eventStub))(func(service *user.Service) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go service.PublishChanges(ctx, user.PublishConfig{})
+
+		e := eventForUserRecord(fakeUserRecord())
+		events <- e
+		<-sent
+		events <- e
+		// a third, distinct, event shows that the duplicate has been handled
+		events <- eventForUserRecord(fakeUserRecord())
+		<-sent
+		close(release)
+		<-processed
+		<-processed
+		require.Empty(t, sent)
+	})
+}
+
+func TestRedeliveredEventsWhichCouldNotBeSentAreSentAgain(t *testing.T) {
+	store, events, processed := redeliveringStore(nil)
+	var sends int
+	var mtx sync.Mutex
+	failed := make(chan struct{}, 1)
+	eventStub := newEventStub()
+	eventStub.sendStub = func([]byte) event.Result {
+		mtx.Lock()
+		defer mtx.Unlock()
+		sends += 1
+		if sends == 1 {
+			failed <- struct{}{}
+			return sadSendResult{}
+		}
+		return happySendResult{}
+	}
+	withService(store, useBus(eventStub))(func(service *user.Service) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go service.PublishChanges(ctx, user.PublishConfig{})
+
+		e := eventForUserRecord(fakeUserRecord())
+		events <- e
+		<-failed
+		for service.CheckEventCount() < 1 {
+			time.Sleep(time.Millisecond)
+		}
+		events <- e
+		<-processed
+
+		mtx.Lock()
+		defer mtx.Unlock()
+		require.Equal(t, 2, sends)
+	})
+}
@@ -0,0 +1,51 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/robotlovesyou/fitest/pkg/telemetry"
+	"github.com/robotlovesyou/fitest/pkg/utctime"
+	"go.opentelemetry.io/otel"
+)
+
+const (
+	// DormancyInterval is the time between checks for users who have become dormant. It should be configurable
+	DormancyInterval = time.Hour
+)
+
+// MarkDormant makes active users who have not been seen for inactiveFor dormant, including users created more than
+// inactiveFor ago who have never been seen. Dormant users cannot authenticate until they are reactivated.
+// Each change is published with the MarkedDormant action. It returns the number of users made dormant
+func (service *Service) MarkDormant(ctx context.Context, inactiveFor time.Duration) (int64, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "MarkDormant")
+	defer span.End()
+
+	marked, err := service.store.MarkDormant(ctx, utctime.Now().Add(-inactiveFor))
+	if err != nil {
+		span.RecordError(err)
+		return marked, fmt.Errorf("cannot make inactive users dormant in store: %w", err)
+	}
+	return marked, nil
+}
+
+// MarkDormantEvery makes users who have not been seen for inactiveFor dormant every interval, until ctx is done.
+// It blocks, so should be run in a separate goroutine
+func (service *Service) MarkDormantEvery(ctx context.Context, interval, inactiveFor time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		marked, err := service.MarkDormant(ctx, inactiveFor)
+		if err != nil {
+			service.logger.Errorf(ctx, err, "error making inactive users dormant")
+		} else if marked > 0 {
+			service.logger.Infof(ctx, "made %d inactive users dormant", marked)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package user_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/robotlovesyou/fitest/pkg/user"
+	"github.com/robotlovesyou/fitest/pkg/utctime"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarkDormantMarksUsersInactiveForThePeriod(t *testing.T) {
+	storeStub := newStubUserStore()
+	inactiveFor := 90 * 24 * time.Hour
+	storeStub.stubMarkDormant = func(_ context.Context, inactiveSince time.Time) (int64, error) {
+		require.WithinDuration(t, utctime.Now().Add(-inactiveFor), inactiveSince, time.Second)
+		return 3, nil
+	}
+	withService(storeStub)(func(service *user.Service) {
+		marked, err := service.MarkDormant(context.Background(), inactiveFor)
+		require.NoError(t, err)
+		require.Equal(t, int64(3), marked)
+	})
+}
+
+func TestMarkDormantIncludesUnexpectedErrorsInChain(t *testing.T) {
+	storeStub := newStubUserStore()
+	unexpected := errors.New("unexpected")
+	storeStub.stubMarkDormant = func(context.Context, time.Time) (int64, error) {
+		return 0, unexpected
+	}
+	withService(storeStub)(func(service *user.Service) {
+		_, err := service.MarkDormant(context.Background(), time.Hour)
+		require.ErrorIs(t, err, unexpected)
+	})
+}
+
+func TestMarkDormantEveryMarksUntilContextIsDone(t *testing.T) {
+	storeStub := newStubUserStore()
+	checks := make(chan struct{}, 10)
+	storeStub.stubMarkDormant = func(context.Context, time.Time) (int64, error) {
+		checks <- struct{}{}
+		return 1, nil
+	}
+	withService(storeStub)(func(service *user.Service) {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			service.MarkDormantEvery(ctx, 10*time.Millisecond, time.Hour)
+			close(done)
+		}()
+		for i := 0; i < 2; i++ {
+			select {
+			case <-checks:
+			case <-time.After(time.Second):
+				t.Fatal("inactive users were not made dormant")
+			}
+		}
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("marking dormant users did not stop when the context was done")
+		}
+	})
+}
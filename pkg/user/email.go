@@ -0,0 +1,139 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/telemetry"
+	"github.com/robotlovesyou/fitest/pkg/utctime"
+	"go.opentelemetry.io/otel"
+)
+
+const (
+	// EmailChangeTTL is how long a change of email address can be confirmed for after it is requested. It should be
+	// configurable
+	EmailChangeTTL = 24 * time.Hour
+)
+
+// ErrInvalidEmailChangeToken is returned when an email change token does not exist, has expired or has already been
+// used
+var ErrInvalidEmailChangeToken = errors.New("email change token is invalid or has expired")
+
+// EmailChange is a request to change the email address of a user. As with a password change, the current password
+// of the user is required
+type EmailChange struct {
+	ID              string `validate:"uuid"`
+	Email           string `validate:"required,email"`
+	CurrentPassword string `validate:"required"`
+	Version         int64
+}
+
+// EmailConfirmation confirms a change of email address with the token sent to the new address
+type EmailConfirmation struct {
+	Token string `validate:"required"`
+}
+
+// ChangeEmail requests a change to the email address of a user if the request is valid, the current password is
+// correct and no other user has the new address. The address is not changed until the change is confirmed with
+// ConfirmEmailChange, using a single use token which expires after EmailChangeTTL. The token is published with the
+// EmailChangeRequested action, for the mailer to send to the new address, and is not returned to the caller.
+// It returns ErrInvalidCredentials if the current password is incorrect
+func (service *Service) ChangeEmail(ctx context.Context, change *EmailChange) error {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "ChangeEmail")
+	defer span.End()
+
+	if err := service.validate.Struct(change); err != nil {
+		err = invalidError(err)
+		service.logger.Errorf(ctx, err, "cannot change email with invalid request")
+		return err
+	}
+
+	id := uuid.MustParse(change.ID) // ok to call function which can panic because id has already been validated as a uuid
+
+	rec, err := service.store.ReadOne(ctx, id)
+	if err != nil {
+		if errors.Is(err, userstore.ErrNotFound) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("unexpected error reading user store: %w", err)
+	}
+	if change.Version != rec.Version {
+		return ErrInvalidVersion
+	}
+	if !service.hasher.Compare(rec.PasswordHash, change.CurrentPassword) {
+		return ErrInvalidCredentials
+	}
+	if change.Email == rec.Email {
+		return &InvalidError{Violations: []FieldViolation{{
+			Field:       "Email",
+			Rule:        RuleChanged,
+			Description: "must be different to the current email address",
+		}}}
+	}
+	// uniqueness is checked here so that the user is told straight away, and again when the change is confirmed
+	if _, err = service.store.FindByEmail(ctx, change.Email); err == nil {
+		return ErrEmailInUse
+	} else if !errors.Is(err, userstore.ErrNotFound) {
+		return fmt.Errorf("cannot find user by email: %w", err)
+	}
+
+	token, err := newToken()
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("cannot generate email change token: %w", err)
+	}
+	err = service.store.RequestEmailChange(ctx, id, change.Version, token, userstore.EmailChange{
+		Email:     change.Email,
+		Hash:      hashToken(token),
+		ExpiresAt: utctime.Now().Add(EmailChangeTTL),
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, userstore.ErrNotFound):
+			return ErrNotFound
+		case errors.Is(err, userstore.ErrInvalidVersion):
+			return ErrInvalidVersion
+		case errors.Is(err, userstore.ErrTooManyEvents):
+			return ErrUnavailable
+		default:
+			span.RecordError(err)
+			return fmt.Errorf("unexpected error storing email change: %w", err)
+		}
+	}
+	return nil
+}
+
+// ConfirmEmailChange changes the email address of the user an email change token was sent to, if the request is
+// valid. It returns ErrInvalidEmailChangeToken if the token does not exist, has expired or has already been used,
+// and ErrEmailInUse if another user has taken the address since the change was requested.
+// The change is published with the EmailChanged action
+func (service *Service) ConfirmEmailChange(ctx context.Context, confirmation *EmailConfirmation) (usr User, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "ConfirmEmailChange")
+	defer span.End()
+
+	if err = service.validate.Struct(confirmation); err != nil {
+		err = invalidError(err)
+		service.logger.Errorf(ctx, err, "cannot confirm email change with invalid request")
+		return usr, err
+	}
+
+	rec, err := service.store.ConfirmEmailChange(ctx, hashToken(confirmation.Token))
+	if err != nil {
+		switch {
+		case errors.Is(err, userstore.ErrInvalidEmailChangeToken):
+			return usr, ErrInvalidEmailChangeToken
+		case errors.Is(err, userstore.ErrAlreadyExists):
+			return usr, ErrEmailInUse
+		case errors.Is(err, userstore.ErrIndexesBuilding), errors.Is(err, userstore.ErrTooManyEvents):
+			return usr, ErrUnavailable
+		default:
+			span.RecordError(err)
+			return usr, fmt.Errorf("unexpected error confirming email change in user store: %w", err)
+		}
+	}
+	return copyStoreUserToUser(&rec), nil
+}
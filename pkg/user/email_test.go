@@ -0,0 +1,152 @@
+package user_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/user"
+	"github.com/stretchr/testify/require"
+)
+
+func fakeEmailChange(rec userstore.User) user.EmailChange {
+	return user.EmailChange{
+		ID:              rec.ID.String(),
+		Email:           "new@example.com",
+		CurrentPassword: testPassword,
+		Version:         rec.Version,
+	}
+}
+
+// storeForEmailChange returns a stub store holding rec, with the password testPassword, where no other user has an
+// email address
+func storeForEmailChange(t *testing.T) (*stubUserStore, userstore.User) {
+	storeStub, rec := storeWithPassword(t, testPassword)
+	storeStub.stubReadOne = func(context.Context, uuid.UUID) (userstore.User, error) {
+		return rec, nil
+	}
+	return storeStub, rec
+}
+
+func TestChangeEmailStoresHashOfExpiringToken(t *testing.T) {
+	storeStub, rec := storeForEmailChange(t)
+	change := fakeEmailChange(rec)
+	called := false
+	storeStub.stubRequestEmailChange = func(_ context.Context, id uuid.UUID, version int64, token string, ec userstore.EmailChange) error {
+		called = true
+		require.True(t, compareIDs(rec.ID, id))
+		require.Equal(t, rec.Version, version)
+		require.Equal(t, change.Email, ec.Email)
+		require.Equal(t, hashOf(token), ec.Hash)
+		require.WithinDuration(t, time.Now().Add(user.EmailChangeTTL), ec.ExpiresAt, time.Minute)
+		return nil
+	}
+	withService(storeStub)(func(service *user.Service) {
+		require.NoError(t, service.ChangeEmail(context.Background(), &change))
+		require.True(t, called)
+	})
+}
+
+func TestCannotChangeEmailToAddressOfAnotherUser(t *testing.T) {
+	storeStub, rec := storeForEmailChange(t)
+	change := fakeEmailChange(rec)
+	storeStub.stubFindByEmail = func(context.Context, string) (userstore.User, error) {
+		return fakeUserRecord(), nil
+	}
+	withService(storeStub)(func(service *user.Service) {
+		require.ErrorIs(t, service.ChangeEmail(context.Background(), &change), user.ErrEmailInUse)
+	})
+}
+
+func TestCannotChangeEmailWithWrongCurrentPassword(t *testing.T) {
+	storeStub, rec := storeForEmailChange(t)
+	change := fakeEmailChange(rec)
+	change.CurrentPassword = "wrong password"
+	withService(storeStub)(func(service *user.Service) {
+		require.ErrorIs(t, service.ChangeEmail(context.Background(), &change), user.ErrInvalidCredentials)
+	})
+}
+
+func TestCannotChangeEmailWithStaleVersion(t *testing.T) {
+	storeStub, rec := storeForEmailChange(t)
+	change := fakeEmailChange(rec)
+	change.Version += 1
+	withService(storeStub)(func(service *user.Service) {
+		require.ErrorIs(t, service.ChangeEmail(context.Background(), &change), user.ErrInvalidVersion)
+	})
+}
+
+func TestCannotChangeEmailWithInvalidRequest(t *testing.T) {
+	rec := fakeUserRecord()
+	cases := []struct {
+		name   string
+		mutate func(*user.EmailChange)
+	}{
+		{name: "invalid id", mutate: func(c *user.EmailChange) { c.ID = "not a uuid" }},
+		{name: "invalid email", mutate: func(c *user.EmailChange) { c.Email = "not an email" }},
+		{name: "missing password", mutate: func(c *user.EmailChange) { c.CurrentPassword = "" }},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			change := fakeEmailChange(rec)
+			c.mutate(&change)
+			withService(newStubUserStore())(func(service *user.Service) {
+				require.ErrorIs(t, service.ChangeEmail(context.Background(), &change), user.ErrInvalid)
+			})
+		})
+	}
+}
+
+func TestCannotChangeEmailToCurrentAddress(t *testing.T) {
+	storeStub, rec := storeForEmailChange(t)
+	change := fakeEmailChange(rec)
+	change.Email = rec.Email
+	withService(storeStub)(func(service *user.Service) {
+		require.ErrorIs(t, service.ChangeEmail(context.Background(), &change), user.ErrInvalid)
+	})
+}
+
+func TestConfirmEmailChangeSendsHashOfToken(t *testing.T) {
+	rec := fakeUserRecord()
+	storeStub := newStubUserStore()
+	storeStub.stubConfirmEmailChange = func(_ context.Context, tokenHash string) (userstore.User, error) {
+		require.Equal(t, hashOf("token"), tokenHash)
+		rec.Email = "new@example.com"
+		rec.Version += 1
+		return rec, nil
+	}
+	withService(storeStub)(func(service *user.Service) {
+		usr, err := service.ConfirmEmailChange(context.Background(), &user.EmailConfirmation{Token: "token"})
+		require.NoError(t, err)
+		require.Equal(t, "new@example.com", usr.Email)
+		require.Equal(t, rec.Version, usr.Version)
+	})
+}
+
+func TestCorrectErrorReturnedConfirmingEmailChange(t *testing.T) {
+	unexpected := errors.New("some unexpected error")
+	cases := []struct {
+		name     string
+		storeErr error
+		expected error
+	}{
+		{name: "invalid token", storeErr: userstore.ErrInvalidEmailChangeToken, expected: user.ErrInvalidEmailChangeToken},
+		{name: "address taken", storeErr: userstore.ErrEmailInUse, expected: user.ErrEmailInUse},
+		{name: "unexpected", storeErr: unexpected, expected: unexpected},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			storeStub := newStubUserStore()
+			storeStub.stubConfirmEmailChange = func(context.Context, string) (userstore.User, error) {
+				return userstore.User{}, c.storeErr
+			}
+			withService(storeStub)(func(service *user.Service) {
+				_, err := service.ConfirmEmailChange(context.Background(), &user.EmailConfirmation{Token: "token"})
+				require.ErrorIs(t, err, c.expected)
+			})
+		})
+	}
+}
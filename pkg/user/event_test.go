@@ -129,7 +129,7 @@ func TestReceivingAnEventFromStoreSendsADomainEvent(t *testing.T) {
 			return nil
 		}
 
-		service.PublishChanges(ctx)
+		service.PublishChanges(ctx, user.PublishConfig{})
 
 		// Wait until all the send goroutines complete
 		for service.CheckEventCount() < int64(count) {
@@ -187,7 +187,7 @@ func TestErrorsReceivingEventsAreRecorded(t *testing.T) {
 		store.stubProcessEvent = func(context.Context, uuid.UUID, int64) error {
 			return nil
 		}
-		service.PublishChanges(ctx)
+		service.PublishChanges(ctx, user.PublishConfig{})
 
 		// Wait until all the send goroutines complete
 		for service.CheckEventCount() < int64(count) {
@@ -195,7 +195,7 @@ func TestErrorsReceivingEventsAreRecorded(t *testing.T) {
 		}
 		// math.Nextafter is suggested as the correct way to get the machine epsilon for comparing floats
 		// Ensure that the success rate is 50%
-		require.InDelta(t, 0.5, service.CheckEventSuccessRateAndReset(), math.Nextafter(1.0, 2.0)-1.0)
+		require.InDelta(t, 0.5, service.EventSuccessRate(), math.Nextafter(1.0, 2.0)-1.0)
 	})
 }
 
@@ -244,7 +244,7 @@ func TestErrorsSendingEventsAreRecorded(t *testing.T) {
 		store.stubProcessEvent = func(context.Context, uuid.UUID, int64) error {
 			return nil
 		}
-		service.PublishChanges(ctx)
+		service.PublishChanges(ctx, user.PublishConfig{})
 
 		// Wait until all the send goroutines complete
 		for service.CheckEventCount() < int64(count) {
@@ -252,6 +252,6 @@ func TestErrorsSendingEventsAreRecorded(t *testing.T) {
 		}
 		// math.Nextafter is suggested as the correct way to get the machine epsilon for comparing floats
 		// Check that the success rate is 50%
-		require.InDelta(t, 0.5, service.CheckEventSuccessRateAndReset(), math.Nextafter(1.0, 2.0)-1.0)
+		require.InDelta(t, 0.5, service.EventSuccessRate(), math.Nextafter(1.0, 2.0)-1.0)
 	})
 }
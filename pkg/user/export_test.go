@@ -0,0 +1,92 @@
+package user_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/user"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// iteratorOver creates a userstore.Iterator over the given users without a database
+func iteratorOver(t *testing.T, users []userstore.User) *userstore.Iterator {
+	docs := make([]interface{}, 0, len(users))
+	for i := range users {
+		docs = append(docs, userstore.Record{ID: users[i].ID, Data: &users[i]})
+	}
+	cursor, err := mongo.NewCursorFromDocuments(docs, nil, bson.DefaultRegistry)
+	require.NoError(t, err)
+	return userstore.NewIterator(cursor)
+}
+
+func TestExportSendsEveryUserFromStore(t *testing.T) {
+	query := fakeQuery()
+	records := fakePage(30, 1).Items
+	storeStub := newStubUserStore()
+	withService(storeStub)(func(service *user.Service) {
+		storeStub.stubIterate = func(ctx context.Context, q *userstore.Query) (userstore.UserIterator, error) {
+			require.Equal(t, []string{query.Country}, q.Countries)
+			return iteratorOver(t, records), nil
+		}
+		var sent []*user.SanitizedUser
+		err := service.Export(context.Background(), &query, func(usr *user.SanitizedUser) error {
+			sent = append(sent, usr)
+			return nil
+		})
+		require.NoError(t, err)
+		require.Len(t, sent, len(records))
+		for i, usr := range sent {
+			require.Equal(t, records[i].ID.String(), usr.ID)
+			require.Equal(t, records[i].Email, usr.Email)
+		}
+	})
+}
+
+func TestExportStopsWhenSendFails(t *testing.T) {
+	query := fakeQuery()
+	sendErr := errors.New("some send error")
+	storeStub := newStubUserStore()
+	withService(storeStub)(func(service *user.Service) {
+		storeStub.stubIterate = func(context.Context, *userstore.Query) (userstore.UserIterator, error) {
+			return iteratorOver(t, fakePage(5, 1).Items), nil
+		}
+		calls := 0
+		err := service.Export(context.Background(), &query, func(*user.SanitizedUser) error {
+			calls++
+			return sendErr
+		})
+		require.ErrorIs(t, err, sendErr)
+		require.Equal(t, 1, calls)
+	})
+}
+
+func TestCannotExportWithUnsortableField(t *testing.T) {
+	query := fakeQuery()
+	query.SortBy = "password_hash"
+	storeStub := newStubUserStore()
+	withService(storeStub)(func(service *user.Service) {
+		err := service.Export(context.Background(), &query, func(*user.SanitizedUser) error {
+			panic("send should not be called when query is invalid")
+		})
+		require.ErrorIs(t, err, user.ErrInvalid)
+	})
+}
+
+func TestOriginalErrorIsInChainWhenStoreIterateReturnsError(t *testing.T) {
+	query := fakeQuery()
+	unexpected := errors.New("some unexpected error")
+	storeStub := newStubUserStore()
+	withService(storeStub)(func(service *user.Service) {
+		storeStub.stubIterate = func(context.Context, *userstore.Query) (userstore.UserIterator, error) {
+			return nil, unexpected
+		}
+		err := service.Export(context.Background(), &query, func(*user.SanitizedUser) error {
+			return nil
+		})
+		require.ErrorIs(t, err, unexpected)
+	})
+}
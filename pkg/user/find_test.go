@@ -3,6 +3,7 @@ package user_test
 import (
 	"context"
 	"errors"
+	"strings"
 	"testing"
 	"time"
 
@@ -41,7 +42,7 @@ func TestCorrectParametersPassedToStoreFind(t *testing.T) {
 	withService(storeStub)(func(service *user.Service) {
 		storeStub.stubFindMany = func(ctx context.Context, q *userstore.Query) (userstore.Page, error) {
 			require.Equal(t, query.CreatedAfter, q.CreatedAfter.Format(user.TimeFormat))
-			require.Equal(t, query.Country, q.Country)
+			require.Equal(t, []string{query.Country}, q.Countries)
 			require.Equal(t, query.Length, q.Length)
 			require.Equal(t, query.Page, q.Page)
 			return page, nil
@@ -72,7 +73,7 @@ func TestCorrectDefaultsAreSetForFindManyWhenQueryHasMissingFields(t *testing.T)
 	withService(storeStub)(func(service *user.Service) {
 		storeStub.stubFindMany = func(ctx context.Context, q *userstore.Query) (userstore.Page, error) {
 			require.True(t, q.CreatedAfter.IsZero())
-			require.Equal(t, "", q.Country)
+			require.Empty(t, q.Countries)
 			require.Equal(t, user.DefaultLength, q.Length)
 			require.Equal(t, user.DefaultPage, q.Page)
 			return page, nil
@@ -85,6 +86,71 @@ func TestCorrectDefaultsAreSetForFindManyWhenQueryHasMissingFields(t *testing.T)
 	})
 }
 
+func TestLongPageLengthsAreReducedToTheMaximum(t *testing.T) {
+	query := fakeQuery()
+	query.Length = user.MaxRequestedPageLength
+	storeStub := newStubUserStore()
+	withService(storeStub)(func(service *user.Service) {
+		storeStub.stubFindMany = func(ctx context.Context, q *userstore.Query) (userstore.Page, error) {
+			require.Equal(t, int32(user.MaxPageLength), q.Length)
+			return fakePage(user.MaxPageLength, 1), nil
+		}
+		_, err := service.Find(context.Background(), &query)
+		require.NoError(t, err)
+	})
+}
+
+func TestPagesSayWhetherThereAreMoreUsers(t *testing.T) {
+	cases := []struct {
+		name       string
+		page       int64
+		total      int64
+		hasNext    bool
+		totalPages int64
+	}{
+		{name: "first of several", page: 1, total: 25, hasNext: true, totalPages: 3},
+		{name: "last partial page", page: 3, total: 25, hasNext: false, totalPages: 3},
+		{name: "last full page", page: 2, total: 20, hasNext: false, totalPages: 2},
+		{name: "beyond the last page", page: 4, total: 25, hasNext: false, totalPages: 3},
+		{name: "no users", page: 1, total: 0, hasNext: false, totalPages: 0},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			query := fakeQuery()
+			query.Page = c.page
+			storeStub := newStubUserStore()
+			withService(storeStub)(func(service *user.Service) {
+				storeStub.stubFindMany = func(context.Context, *userstore.Query) (userstore.Page, error) {
+					return userstore.Page{Page: c.page, Total: c.total}, nil
+				}
+				p, err := service.Find(context.Background(), &query)
+				require.NoError(t, err)
+				require.Equal(t, c.hasNext, p.HasNext)
+				require.Equal(t, c.totalPages, p.TotalPages)
+			})
+		})
+	}
+}
+
+func TestPagesOfQueriesWhichSkipTheTotalSayWhetherThereAreMoreUsers(t *testing.T) {
+	for _, hasMore := range []bool{true, false} {
+		query := fakeQuery()
+		query.SkipTotal = true
+		storeStub := newStubUserStore()
+		withService(storeStub)(func(service *user.Service) {
+			storeStub.stubFindMany = func(_ context.Context, q *userstore.Query) (userstore.Page, error) {
+				require.True(t, q.SkipTotal)
+				return userstore.Page{Page: q.Page, Total: userstore.UnknownTotal, HasMore: hasMore}, nil
+			}
+			p, err := service.Find(context.Background(), &query)
+			require.NoError(t, err)
+			require.Equal(t, hasMore, p.HasNext)
+			require.Equal(t, user.UnknownTotal, p.Total)
+			require.Equal(t, user.UnknownTotal, p.TotalPages)
+		})
+	}
+}
+
 func TestOriginalErrorIsInChainWhenStoreFindReturnsError(t *testing.T) {
 	query := user.Query{}
 	unexpected := errors.New("some unexpected error")
@@ -97,3 +163,152 @@ func TestOriginalErrorIsInChainWhenStoreFindReturnsError(t *testing.T) {
 		require.ErrorIs(t, err, unexpected)
 	})
 }
+
+func TestSortOptionsArePassedToStoreFind(t *testing.T) {
+	query := fakeQuery()
+	query.SortBy = "last_name"
+	query.SortDirection = user.SortDescending
+	storeStub := newStubUserStore()
+	withService(storeStub)(func(service *user.Service) {
+		storeStub.stubFindMany = func(ctx context.Context, q *userstore.Query) (userstore.Page, error) {
+			require.Equal(t, userstore.SortLastName, q.SortBy)
+			require.True(t, q.SortDescending)
+			return fakePage(1, 1), nil
+		}
+		_, err := service.Find(context.Background(), &query)
+		require.NoError(t, err)
+	})
+}
+
+func TestStatusIsPassedToStoreFind(t *testing.T) {
+	query := fakeQuery()
+	query.Status = user.StatusSuspended
+	storeStub := newStubUserStore()
+	withService(storeStub)(func(service *user.Service) {
+		storeStub.stubFindMany = func(ctx context.Context, q *userstore.Query) (userstore.Page, error) {
+			require.Equal(t, userstore.StatusSuspended, q.Status)
+			return fakePage(1, 1), nil
+		}
+		_, err := service.Find(context.Background(), &query)
+		require.NoError(t, err)
+	})
+}
+
+func TestSearchIsPassedToStoreFind(t *testing.T) {
+	query := fakeQuery()
+	query.Search = "Max"
+	storeStub := newStubUserStore()
+	withService(storeStub)(func(service *user.Service) {
+		storeStub.stubFindMany = func(ctx context.Context, q *userstore.Query) (userstore.Page, error) {
+			require.Equal(t, "Max", q.Search)
+			return fakePage(1, 1), nil
+		}
+		_, err := service.Find(context.Background(), &query)
+		require.NoError(t, err)
+	})
+}
+
+func TestCannotFindWithUnsortableField(t *testing.T) {
+	query := fakeQuery()
+	query.SortBy = "password"
+	storeStub := newStubUserStore()
+	withService(storeStub)(func(service *user.Service) {
+		_, err := service.Find(context.Background(), &query)
+		require.ErrorIs(t, err, user.ErrInvalid)
+		var invalid *user.InvalidError
+		require.ErrorAs(t, err, &invalid)
+		require.Equal(t, "SortBy", invalid.Violations[0].Field)
+	})
+}
+
+func TestCannotFindWithInvalidQuery(t *testing.T) {
+	cases := []struct {
+		name   string
+		modify func(query *user.Query)
+		field  string
+	}{
+		{name: "length too long", modify: func(query *user.Query) { query.Length = user.MaxRequestedPageLength + 1 }, field: "Length"},
+		{name: "negative length", modify: func(query *user.Query) { query.Length = -1 }, field: "Length"},
+		{name: "negative page", modify: func(query *user.Query) { query.Page = -1 }, field: "Page"},
+		{name: "badly formatted date", modify: func(query *user.Query) { query.CreatedAfter = "yesterday" }, field: "CreatedAfter"},
+		{name: "unknown status", modify: func(query *user.Query) { query.Status = "deleted" }, field: "Status"},
+		{name: "search too long", modify: func(query *user.Query) { query.Search = strings.Repeat("a", 101) }, field: "Search"},
+		{name: "badly formatted inactive since", modify: func(query *user.Query) { query.InactiveSince = "last week" }, field: "InactiveSince"},
+		{name: "badly formatted created before", modify: func(query *user.Query) { query.CreatedBefore = "tomorrow" }, field: "CreatedBefore"},
+		{name: "unknown country", modify: func(query *user.Query) { query.Countries = []string{"NL", "XX"} }, field: "Countries[1]"},
+		{name: "too many countries", modify: func(query *user.Query) { query.Countries = make([]string, 251) }, field: "Countries"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			query := fakeQuery()
+			c.modify(&query)
+			storeStub := newStubUserStore()
+			withService(storeStub)(func(service *user.Service) {
+				_, err := service.Find(context.Background(), &query)
+				require.ErrorIs(t, err, user.ErrInvalid)
+				var invalid *user.InvalidError
+				require.ErrorAs(t, err, &invalid)
+				require.Equal(t, c.field, invalid.Violations[0].Field)
+			})
+		})
+	}
+}
+
+func TestCountPassesQueryToStoreCount(t *testing.T) {
+	query := fakeQuery()
+	storeStub := newStubUserStore()
+	withService(storeStub)(func(service *user.Service) {
+		storeStub.stubCount = func(ctx context.Context, q *userstore.Query) (int64, error) {
+			require.Equal(t, query.CreatedAfter, q.CreatedAfter.Format(user.TimeFormat))
+			require.Equal(t, []string{query.Country}, q.Countries)
+			return 42, nil
+		}
+		total, err := service.Count(context.Background(), &query)
+		require.NoError(t, err)
+		require.Equal(t, int64(42), total)
+	})
+}
+
+func TestOriginalErrorIsInChainWhenStoreCountReturnsError(t *testing.T) {
+	query := user.Query{}
+	unexpected := errors.New("some unexpected error")
+	storeStub := newStubUserStore()
+	withService(storeStub)(func(service *user.Service) {
+		storeStub.stubCount = func(context.Context, *userstore.Query) (int64, error) {
+			return 0, unexpected
+		}
+		_, err := service.Count(context.Background(), &query)
+		require.ErrorIs(t, err, unexpected)
+	})
+}
+
+func TestInactiveSinceIsPassedToStoreFind(t *testing.T) {
+	query := fakeQuery()
+	query.InactiveSince = utctime.Now().Add(-30 * 24 * time.Hour).Format(user.TimeFormat)
+	storeStub := newStubUserStore()
+	withService(storeStub)(func(service *user.Service) {
+		storeStub.stubFindMany = func(ctx context.Context, q *userstore.Query) (userstore.Page, error) {
+			require.Equal(t, query.InactiveSince, q.InactiveSince.Format(user.TimeFormat))
+			return userstore.Page{Page: 1}, nil
+		}
+		_, err := service.Find(context.Background(), &query)
+		require.NoError(t, err)
+	})
+}
+
+func TestCountriesAndCreatedBeforeArePassedToStoreFind(t *testing.T) {
+	query := fakeQuery()
+	query.Countries = []string{"NL", "BE"}
+	query.CreatedBefore = utctime.Now().Format(user.TimeFormat)
+	storeStub := newStubUserStore()
+	withService(storeStub)(func(service *user.Service) {
+		storeStub.stubFindMany = func(ctx context.Context, q *userstore.Query) (userstore.Page, error) {
+			require.Equal(t, []string{"DE", "NL", "BE"}, q.Countries)
+			require.Equal(t, query.CreatedBefore, q.CreatedBefore.Format(user.TimeFormat))
+			return userstore.Page{Page: 1}, nil
+		}
+		_, err := service.Find(context.Background(), &query)
+		require.NoError(t, err)
+	})
+}
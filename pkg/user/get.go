@@ -0,0 +1,68 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/telemetry"
+	"go.opentelemetry.io/otel"
+)
+
+// Get reads the user identified by ref. It returns ErrNotFound if there is no such user
+func (service *Service) Get(ctx context.Context, ref *Ref) (usr SanitizedUser, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "Get")
+	defer span.End()
+
+	if err = service.validate.Struct(ref); err != nil {
+		return usr, invalidError(err)
+	}
+
+	rec, err := service.store.ReadOne(ctx, uuid.MustParse(ref.ID)) // the id has already been validated
+	if err != nil {
+		if errors.Is(err, userstore.ErrNotFound) {
+			return usr, ErrNotFound
+		}
+		span.RecordError(err)
+		return usr, fmt.Errorf("cannot read user from store: %w", err)
+	}
+	return *sanitizedUserFromUserstoreUser(&rec), nil
+}
+
+// GetResult is the result of reading a single user in a batch
+type GetResult struct {
+	ID string
+	// Found is false when the user does not exist or has been deleted, in which case User is empty
+	Found bool
+	User  SanitizedUser
+}
+
+// BatchGet reads each referenced user in a single read of the store, returning a result for each ID in the order they
+// were given, so that callers enriching a list of users do not read them one at a time. As with BatchDelete, up to
+// 500 users can be read at once
+func (service *Service) BatchGet(ctx context.Context, refs *Refs) ([]GetResult, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "BatchGet")
+	defer span.End()
+
+	ids, err := service.validateRefs(refs)
+	if err != nil {
+		return nil, err
+	}
+	users, err := service.store.ReadMany(ctx, ids)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("cannot read users from store: %w", err)
+	}
+
+	results := make([]GetResult, 0, len(ids))
+	for i := range users {
+		result := GetResult{ID: refs.IDs[i], Found: users[i].ID != uuid.Nil}
+		if result.Found {
+			result.User = *sanitizedUserFromUserstoreUser(&users[i])
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
@@ -0,0 +1,124 @@
+package user_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/user"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetReadsUserByID(t *testing.T) {
+	rec := fakeUserRecord()
+	storeStub := newStubUserStore()
+	storeStub.stubReadOne = func(_ context.Context, id uuid.UUID) (userstore.User, error) {
+		require.Equal(t, rec.ID, id)
+		return rec, nil
+	}
+	withService(storeStub)(func(service *user.Service) {
+		usr, err := service.Get(context.Background(), &user.Ref{ID: rec.ID.String()})
+		require.NoError(t, err)
+		require.Equal(t, rec.ID.String(), usr.ID)
+		require.Equal(t, rec.Email, usr.Email)
+	})
+}
+
+func TestCannotGetWithInvalidID(t *testing.T) {
+	withService(newStubUserStore())(func(service *user.Service) {
+		_, err := service.Get(context.Background(), &user.Ref{ID: "not a uuid"})
+		require.ErrorIs(t, err, user.ErrInvalid)
+	})
+}
+
+func TestGetReturnsNotFoundForUnknownUser(t *testing.T) {
+	storeStub := newStubUserStore()
+	storeStub.stubReadOne = func(context.Context, uuid.UUID) (userstore.User, error) {
+		return userstore.User{}, userstore.ErrNotFound
+	}
+	ref := fakeUserRef()
+	withService(storeStub)(func(service *user.Service) {
+		_, err := service.Get(context.Background(), &ref)
+		require.ErrorIs(t, err, user.ErrNotFound)
+	})
+}
+
+func TestOriginalErrorIsInChainWhenStoreReadOneReturnsError(t *testing.T) {
+	unexpected := errors.New("some unexpected error")
+	storeStub := newStubUserStore()
+	storeStub.stubReadOne = func(context.Context, uuid.UUID) (userstore.User, error) {
+		return userstore.User{}, unexpected
+	}
+	ref := fakeUserRef()
+	withService(storeStub)(func(service *user.Service) {
+		_, err := service.Get(context.Background(), &ref)
+		require.ErrorIs(t, err, unexpected)
+	})
+}
+
+func TestBatchGetReturnsResultForEachIDInOrder(t *testing.T) {
+	first, second := fakeUserRecord(), fakeUserRecord()
+	missing := fakeUserRef()
+	storeStub := newStubUserStore()
+	storeStub.stubReadMany = func(_ context.Context, ids []uuid.UUID) ([]userstore.User, error) {
+		require.Equal(t, []uuid.UUID{second.ID, uuid.MustParse(missing.ID), first.ID}, ids)
+		return []userstore.User{second, {}, first}, nil
+	}
+	refs := user.Refs{IDs: []string{second.ID.String(), missing.ID, first.ID.String()}}
+	withService(storeStub)(func(service *user.Service) {
+		results, err := service.BatchGet(context.Background(), &refs)
+		require.NoError(t, err)
+		require.Len(t, results, 3)
+		require.Equal(t, second.ID.String(), results[0].ID)
+		require.True(t, results[0].Found)
+		require.Equal(t, second.Email, results[0].User.Email)
+		require.Equal(t, user.GetResult{ID: missing.ID}, results[1])
+		require.True(t, results[2].Found)
+		require.Equal(t, first.ID.String(), results[2].User.ID)
+	})
+}
+
+func TestBatchGetReturnsErrorWhenRefsAreInvalid(t *testing.T) {
+	duplicated := fakeUserRefs(1)
+	duplicated.IDs = append(duplicated.IDs, duplicated.IDs[0])
+	duplicatedInAnotherCase := fakeUserRefs(1)
+	duplicatedInAnotherCase.IDs = append(duplicatedInAnotherCase.IDs, strings.ToUpper(duplicatedInAnotherCase.IDs[0]))
+	withInvalid := fakeUserRefs(2)
+	withInvalid.IDs = append(withInvalid.IDs, "not a uuid")
+
+	cases := []struct {
+		name string
+		refs user.Refs
+	}{
+		{name: "empty", refs: user.Refs{}},
+		{name: "too many", refs: fakeUserRefs(user.MaxBatchDelete + 1)},
+		{name: "duplicated", refs: duplicated},
+		{name: "duplicated in another case", refs: duplicatedInAnotherCase},
+		{name: "invalid", refs: withInvalid},
+	}
+	for _, c := range cases {
+		thisCase := c
+		t.Run(thisCase.name, func(t *testing.T) {
+			withService(newStubUserStore())(func(service *user.Service) {
+				_, err := service.BatchGet(context.Background(), &thisCase.refs)
+				require.ErrorIs(t, err, user.ErrInvalid)
+			})
+		})
+	}
+}
+
+func TestOriginalErrorIsInChainWhenStoreReadManyReturnsError(t *testing.T) {
+	unexpected := errors.New("some unexpected error")
+	storeStub := newStubUserStore()
+	storeStub.stubReadMany = func(context.Context, []uuid.UUID) ([]userstore.User, error) {
+		return nil, unexpected
+	}
+	refs := fakeUserRefs(2)
+	withService(storeStub)(func(service *user.Service) {
+		_, err := service.BatchGet(context.Background(), &refs)
+		require.ErrorIs(t, err, unexpected)
+	})
+}
@@ -0,0 +1,120 @@
+package user
+
+import (
+	"sync"
+	"time"
+
+	"github.com/robotlovesyou/fitest/pkg/utctime"
+)
+
+const (
+	// DefaultHealthWindow is the period over which the success ratio of publishing events is measured unless the
+	// service is configured with UseHealthConfig
+	DefaultHealthWindow = 5 * time.Minute
+	// windowBuckets is the number of buckets the results of publishing events are counted in. Results leave the window
+	// a bucket at a time, so the window covers between windowBuckets-1 and windowBuckets buckets of results
+	windowBuckets = 10
+)
+
+// HealthConfig sets when the Monitor of a service reports it as unhealthy
+type HealthConfig struct {
+	// MinSuccessRatio is the minimum proportion of events published successfully within Window
+	MinSuccessRatio float64
+	// Window is the period over which the success ratio is measured. It must be positive
+	Window time.Duration
+	// MaxEventAge is the maximum age of the oldest event waiting to be published
+	MaxEventAge time.Duration
+}
+
+// DefaultHealthConfig returns the HealthConfig used unless the service is configured with UseHealthConfig
+func DefaultHealthConfig() HealthConfig {
+	return HealthConfig{
+		MinSuccessRatio: MinHealthyRatio,
+		Window:          DefaultHealthWindow,
+		MaxEventAge:     MaxHealthyEventAge,
+	}
+}
+
+// UseHealthConfig sets when the Monitor of the service reports it as unhealthy. Results recorded before it is called
+// are discarded, so it must be called before the service publishes any events
+func (service *Service) UseHealthConfig(config HealthConfig) {
+	service.health = config
+	service.eventResults = newEventWindow(config.Window)
+}
+
+// EventSuccessRate returns the proportion of events which were published successfully within the window of the
+// health configuration, or 1 if there were none. Unlike a counter which is reset when it is read, it returns the same
+// rate to every caller, so health checks made by several probes do not interfere with each other
+func (service *Service) EventSuccessRate() float64 {
+	successes, failures := service.eventResults.totals(utctime.Now())
+	if successes+failures == 0 {
+		return 1.0
+	}
+	return float64(successes) / float64(successes+failures)
+}
+
+// CheckEventCount returns the number of events whose results were recorded within the window of the health
+// configuration
+func (service *Service) CheckEventCount() int64 {
+	successes, failures := service.eventResults.totals(utctime.Now())
+	return successes + failures
+}
+
+// eventWindow counts the results of publishing events over a sliding window. Results are counted in buckets, so that
+// old results can be dropped without remembering each one
+type eventWindow struct {
+	mtx     sync.Mutex
+	width   time.Duration
+	buckets [windowBuckets]eventBucket
+}
+
+// eventBucket counts the results recorded in the bucket of an eventWindow starting at start
+type eventBucket struct {
+	start     time.Time
+	successes int64
+	failures  int64
+}
+
+func newEventWindow(window time.Duration) *eventWindow {
+	width := window / windowBuckets
+	if width <= 0 {
+		width = 1
+	}
+	return &eventWindow{width: width}
+}
+
+// bucketStart returns the start of the bucket which results recorded at t are counted in
+func (w *eventWindow) bucketStart(t time.Time) time.Time {
+	return time.Unix(0, t.UnixNano()-t.UnixNano()%int64(w.width)).UTC()
+}
+
+// record counts a result recorded at now, replacing the counts of the bucket if they have left the window
+func (w *eventWindow) record(ok bool, now time.Time) {
+	start := w.bucketStart(now)
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	bucket := &w.buckets[(start.UnixNano()/int64(w.width))%windowBuckets]
+	if !bucket.start.Equal(start) {
+		*bucket = eventBucket{start: start}
+	}
+	if ok {
+		bucket.successes += 1
+	} else {
+		bucket.failures += 1
+	}
+}
+
+// totals returns the number of successes and failures counted by the buckets which are still in the window at now
+func (w *eventWindow) totals(now time.Time) (successes, failures int64) {
+	oldest := w.bucketStart(now).Add(-time.Duration(windowBuckets-1) * w.width)
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	for _, bucket := range w.buckets {
+		if bucket.start.Before(oldest) {
+			continue
+		}
+		successes += bucket.successes
+		failures += bucket.failures
+	}
+	return successes, failures
+}
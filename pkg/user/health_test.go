@@ -0,0 +1,112 @@
+package user_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/user"
+	"github.com/robotlovesyou/fitest/pkg/utctime"
+	"github.com/stretchr/testify/require"
+)
+
+// failToReceiveEvents makes the service record count failures to receive events from store, returning once they have
+// been recorded
+func failToReceiveEvents(t *testing.T, service *user.Service, store *stubUserStore, count int) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store.stubEvents = func(ctx context.Context, _, _, _ time.Duration) <-chan userstore.EventResult {
+		out := make(chan userstore.EventResult)
+		go func() {
+			for n := 0; n < count; n++ {
+				select {
+				case out <- userstore.EventResult{Err: errors.New("some error")}:
+				case <-ctx.Done():
+					return
+				}
+			}
+			cancel()
+		}()
+		return out
+	}
+	service.PublishChanges(ctx, user.PublishConfig{})
+	require.Eventually(t, func() bool { return service.CheckEventCount() >= int64(count) }, time.Second, 10*time.Millisecond)
+}
+
+func TestReadingEventSuccessRateDoesNotResetIt(t *testing.T) {
+	store := storeWithBacklog(userstore.Backlog{}, nil)
+	withService(store)(func(service *user.Service) {
+		failToReceiveEvents(t, service, store, 4)
+		monitor := user.NewMonitor(service)
+		require.Zero(t, service.EventSuccessRate())
+		require.Error(t, monitor.Check(context.Background()))
+		// a second probe sees the same failures
+		require.Zero(t, service.EventSuccessRate())
+		require.Error(t, monitor.Check(context.Background()))
+	})
+}
+
+func TestEventResultsLeaveTheHealthWindow(t *testing.T) {
+	store := storeWithBacklog(userstore.Backlog{}, nil)
+	withService(store)(func(service *user.Service) {
+		config := user.DefaultHealthConfig()
+		config.Window = 500 * time.Millisecond
+		service.UseHealthConfig(config)
+		failToReceiveEvents(t, service, store, 4)
+		require.Less(t, service.EventSuccessRate(), 1.0)
+
+		require.Eventually(t, func() bool { return service.EventSuccessRate() == 1.0 }, 2*time.Second, 10*time.Millisecond)
+		require.Zero(t, service.CheckEventCount())
+		require.NoError(t, user.NewMonitor(service).Check(context.Background()))
+	})
+}
+
+func TestMonitorUsesConfiguredThresholds(t *testing.T) {
+	cases := []struct {
+		name    string
+		config  user.HealthConfig
+		backlog userstore.Backlog
+		healthy bool
+	}{
+		{
+			name:    "failures allowed",
+			config:  user.HealthConfig{MinSuccessRatio: 0, Window: time.Minute, MaxEventAge: time.Hour},
+			healthy: true,
+		},
+		{
+			name:    "old event allowed",
+			config:  user.HealthConfig{MinSuccessRatio: 0, Window: time.Minute, MaxEventAge: time.Hour},
+			backlog: userstore.Backlog{Pending: 1, Oldest: utctime.Now().Add(-30 * time.Minute)},
+			healthy: true,
+		},
+		{
+			name:    "old event not allowed",
+			config:  user.HealthConfig{MinSuccessRatio: 0, Window: time.Minute, MaxEventAge: time.Minute},
+			backlog: userstore.Backlog{Pending: 1, Oldest: utctime.Now().Add(-30 * time.Minute)},
+			healthy: false,
+		},
+		{
+			name:    "failures not allowed",
+			config:  user.HealthConfig{MinSuccessRatio: 0.5, Window: time.Minute, MaxEventAge: time.Hour},
+			healthy: false,
+		},
+	}
+	for _, c := range cases {
+		thisCase := c
+		t.Run(thisCase.name, func(t *testing.T) {
+			store := storeWithBacklog(thisCase.backlog, nil)
+			withService(store)(func(service *user.Service) {
+				service.UseHealthConfig(thisCase.config)
+				failToReceiveEvents(t, service, store, 2)
+				err := user.NewMonitor(service).Check(context.Background())
+				if thisCase.healthy {
+					require.NoError(t, err)
+				} else {
+					require.Error(t, err)
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrRejected is returned when a hook rejects a change
+var ErrRejected = errors.New("the change was rejected")
+
+// RejectedError is returned by hooks to reject a change, e.g. because a new user fails sanctions screening or has
+// no invite code. It wraps ErrRejected, so errors.Is(err, ErrRejected) is true for any RejectedError
+type RejectedError struct {
+	// Reason is a constant, e.g. SANCTIONED, which clients can act on without parsing the message
+	Reason string
+	// Message explains why the change was rejected
+	Message string
+}
+
+func (e *RejectedError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrRejected.Error(), e.Message)
+}
+
+func (e *RejectedError) Unwrap() error {
+	return ErrRejected
+}
+
+// Hooks are functions called around changes to users, so that deployments can add their own checks and side effects
+// without changing the service. Before hooks are called in order once a request has been validated, and before the
+// change is stored. If one returns an error, the change is not made and the error is returned, so hooks should return
+// a *RejectedError to reject a change, and any other error if they fail. After hooks are called in order once the
+// change has been stored. They cannot undo it, so they return nothing and should handle their own failures.
+// Hooks must not modify the values they are given
+type Hooks struct {
+	// BeforeCreate is called with each new user, including imported users
+	BeforeCreate []func(context.Context, *NewUser) error
+	// AfterCreate is called with each created user, including imported users
+	AfterCreate []func(context.Context, *User)
+	// BeforeUpdate is called with each update. When its Fields are empty, every updatable field is changed
+	BeforeUpdate []func(context.Context, *Update) error
+	// AfterUpdate is called with each updated user
+	AfterUpdate []func(context.Context, *User)
+	// BeforeDelete is called with a reference to each user to be deleted, including users deleted in a batch
+	BeforeDelete []func(context.Context, *Ref) error
+	// AfterDelete is called with a reference to each deleted user
+	AfterDelete []func(context.Context, *Ref)
+}
+
+// UseHooks adds hooks to be called around changes to users, after any hooks already added. It must be called before
+// the service handles any requests
+func (service *Service) UseHooks(hooks Hooks) {
+	service.hooks.BeforeCreate = append(service.hooks.BeforeCreate, hooks.BeforeCreate...)
+	service.hooks.AfterCreate = append(service.hooks.AfterCreate, hooks.AfterCreate...)
+	service.hooks.BeforeUpdate = append(service.hooks.BeforeUpdate, hooks.BeforeUpdate...)
+	service.hooks.AfterUpdate = append(service.hooks.AfterUpdate, hooks.AfterUpdate...)
+	service.hooks.BeforeDelete = append(service.hooks.BeforeDelete, hooks.BeforeDelete...)
+	service.hooks.AfterDelete = append(service.hooks.AfterDelete, hooks.AfterDelete...)
+}
+
+// beforeCreate calls the BeforeCreate hooks with newUser, stopping at the first which returns an error
+func (service *Service) beforeCreate(ctx context.Context, newUser *NewUser) error {
+	for _, hook := range service.hooks.BeforeCreate {
+		if err := hook(ctx, newUser); err != nil {
+			return hookError(err)
+		}
+	}
+	return nil
+}
+
+// beforeUpdate calls the BeforeUpdate hooks with update, stopping at the first which returns an error
+func (service *Service) beforeUpdate(ctx context.Context, update *Update) error {
+	for _, hook := range service.hooks.BeforeUpdate {
+		if err := hook(ctx, update); err != nil {
+			return hookError(err)
+		}
+	}
+	return nil
+}
+
+// beforeDelete calls the BeforeDelete hooks with ref, stopping at the first which returns an error
+func (service *Service) beforeDelete(ctx context.Context, ref *Ref) error {
+	for _, hook := range service.hooks.BeforeDelete {
+		if err := hook(ctx, ref); err != nil {
+			return hookError(err)
+		}
+	}
+	return nil
+}
+
+// afterChange calls each of hooks with usr
+func afterChange(ctx context.Context, hooks []func(context.Context, *User), usr *User) {
+	for _, hook := range hooks {
+		hook(ctx, usr)
+	}
+}
+
+// afterDelete calls the AfterDelete hooks with ref
+func (service *Service) afterDelete(ctx context.Context, ref *Ref) {
+	for _, hook := range service.hooks.AfterDelete {
+		hook(ctx, ref)
+	}
+}
+
+// hookError returns the error returned by a before hook. Rejections are returned as they are, and other errors are
+// wrapped
+func hookError(err error) error {
+	if errors.Is(err, ErrRejected) {
+		return err
+	}
+	return fmt.Errorf("hook failed: %w", err)
+}
@@ -0,0 +1,248 @@
+package user_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/user"
+	"github.com/stretchr/testify/require"
+)
+
+// rejectEmail returns a BeforeCreate hook which rejects new users with the given email address
+func rejectEmail(email string) func(context.Context, *user.NewUser) error {
+	return func(_ context.Context, newUser *user.NewUser) error {
+		if newUser.Email == email {
+			return &user.RejectedError{Reason: "SANCTIONED", Message: "the user failed sanctions screening"}
+		}
+		return nil
+	}
+}
+
+func TestCreateCallsHooksAroundStoringTheUser(t *testing.T) {
+	storeStub := newStubUserStore()
+	newUser := fakeNewUser()
+	var calls []string
+	storeStub.stubCreate = func(_ context.Context, usr *userstore.User) (userstore.User, error) {
+		calls = append(calls, "store")
+		return *usr, nil
+	}
+	withService(storeStub)(func(service *user.Service) {
+		service.UseHooks(user.Hooks{
+			BeforeCreate: []func(context.Context, *user.NewUser) error{
+				func(_ context.Context, nu *user.NewUser) error {
+					require.Equal(t, newUser.Email, nu.Email)
+					calls = append(calls, "before")
+					return nil
+				},
+			},
+			AfterCreate: []func(context.Context, *user.User){
+				func(_ context.Context, usr *user.User) {
+					require.Equal(t, newUser.Email, usr.Email)
+					calls = append(calls, "after")
+				},
+			},
+		})
+		_, err := service.Create(context.Background(), &newUser)
+		require.NoError(t, err)
+		require.Equal(t, []string{"before", "store", "after"}, calls)
+	})
+}
+
+func TestRejectedCreateIsNotStored(t *testing.T) {
+	storeStub := newStubUserStore()
+	newUser := fakeNewUser()
+	withService(storeStub)(func(service *user.Service) {
+		afterCalled := false
+		service.UseHooks(user.Hooks{
+			BeforeCreate: []func(context.Context, *user.NewUser) error{rejectEmail(newUser.Email)},
+			AfterCreate:  []func(context.Context, *user.User){func(context.Context, *user.User) { afterCalled = true }},
+		})
+		_, err := service.Create(context.Background(), &newUser)
+		require.ErrorIs(t, err, user.ErrRejected)
+		var rejected *user.RejectedError
+		require.ErrorAs(t, err, &rejected)
+		require.Equal(t, "SANCTIONED", rejected.Reason)
+		require.False(t, afterCalled)
+	})
+}
+
+func TestHooksAreNotCalledForInvalidRequests(t *testing.T) {
+	storeStub := newStubUserStore()
+	newUser := fakeNewUser(func(nu *user.NewUser) { nu.Email = "not an email" })
+	withService(storeStub)(func(service *user.Service) {
+		service.UseHooks(user.Hooks{
+			BeforeCreate: []func(context.Context, *user.NewUser) error{
+				func(context.Context, *user.NewUser) error {
+					panic("hook called for invalid user")
+				},
+			},
+		})
+		_, err := service.Create(context.Background(), &newUser)
+		require.ErrorIs(t, err, user.ErrInvalid)
+	})
+}
+
+func TestHookFailuresAreWrappedAndStopLaterHooks(t *testing.T) {
+	storeStub := newStubUserStore()
+	newUser := fakeNewUser()
+	unexpected := errors.New("screening service unavailable")
+	withService(storeStub)(func(service *user.Service) {
+		service.UseHooks(user.Hooks{
+			BeforeCreate: []func(context.Context, *user.NewUser) error{
+				func(context.Context, *user.NewUser) error { return unexpected },
+			},
+		})
+		service.UseHooks(user.Hooks{
+			BeforeCreate: []func(context.Context, *user.NewUser) error{
+				func(context.Context, *user.NewUser) error {
+					panic("hook called after an earlier hook failed")
+				},
+			},
+		})
+		_, err := service.Create(context.Background(), &newUser)
+		require.ErrorIs(t, err, unexpected)
+		require.NotErrorIs(t, err, user.ErrRejected)
+	})
+}
+
+func TestUpdateCallsHooksAroundStoringTheChange(t *testing.T) {
+	storeStub := newStubUserStore()
+	update := fakeUserUpdate(func(u *user.Update) { u.Fields = []string{user.FieldFirstName} })
+	stored := fakeUserRecord()
+	storeStub.stubUpdateFields = func(context.Context, uuid.UUID, int64, *userstore.Change) (userstore.User, error) {
+		return stored, nil
+	}
+	withService(storeStub)(func(service *user.Service) {
+		var updated *user.User
+		service.UseHooks(user.Hooks{
+			BeforeUpdate: []func(context.Context, *user.Update) error{
+				func(_ context.Context, u *user.Update) error {
+					require.Equal(t, update.ID, u.ID)
+					return nil
+				},
+			},
+			AfterUpdate: []func(context.Context, *user.User){
+				func(_ context.Context, usr *user.User) { updated = usr },
+			},
+		})
+		_, err := service.Update(context.Background(), &update)
+		require.NoError(t, err)
+		require.NotNil(t, updated)
+		require.Equal(t, stored.ID, updated.ID)
+	})
+}
+
+func TestRejectedUpdateIsNotStored(t *testing.T) {
+	storeStub := newStubUserStore()
+	update := fakeUserUpdate()
+	withService(storeStub)(func(service *user.Service) {
+		service.UseHooks(user.Hooks{
+			BeforeUpdate: []func(context.Context, *user.Update) error{
+				func(context.Context, *user.Update) error { return &user.RejectedError{Message: "frozen"} },
+			},
+		})
+		_, err := service.Update(context.Background(), &update)
+		require.ErrorIs(t, err, user.ErrRejected)
+	})
+}
+
+func TestDeleteCallsHooksAroundDeletingTheUser(t *testing.T) {
+	storeStub := newStubUserStore()
+	userRef := fakeUserRef()
+	storeStub.stubDeleteOne = func(context.Context, uuid.UUID) error {
+		return nil
+	}
+	withService(storeStub)(func(service *user.Service) {
+		var deleted []string
+		service.UseHooks(user.Hooks{
+			BeforeDelete: []func(context.Context, *user.Ref) error{
+				func(context.Context, *user.Ref) error { return nil },
+			},
+			AfterDelete: []func(context.Context, *user.Ref){
+				func(_ context.Context, ref *user.Ref) { deleted = append(deleted, ref.ID) },
+			},
+		})
+		require.NoError(t, service.Delete(context.Background(), &userRef))
+		require.Equal(t, []string{userRef.ID}, deleted)
+	})
+}
+
+func TestRejectedDeleteIsNotMade(t *testing.T) {
+	storeStub := newStubUserStore()
+	userRef := fakeUserRef()
+	withService(storeStub)(func(service *user.Service) {
+		service.UseHooks(user.Hooks{
+			BeforeDelete: []func(context.Context, *user.Ref) error{
+				func(context.Context, *user.Ref) error { return &user.RejectedError{Message: "legal hold"} },
+			},
+		})
+		require.ErrorIs(t, service.Delete(context.Background(), &userRef), user.ErrRejected)
+	})
+}
+
+func TestBatchDeleteIsNotMadeIfAnyDeletionIsRejected(t *testing.T) {
+	storeStub := newStubUserStore()
+	refs := fakeUserRefs(3)
+	withService(storeStub)(func(service *user.Service) {
+		service.UseHooks(user.Hooks{
+			BeforeDelete: []func(context.Context, *user.Ref) error{
+				func(_ context.Context, ref *user.Ref) error {
+					if ref.ID == refs.IDs[1] {
+						return &user.RejectedError{Message: "legal hold"}
+					}
+					return nil
+				},
+			},
+		})
+		_, err := service.BatchDelete(context.Background(), &refs)
+		require.ErrorIs(t, err, user.ErrRejected)
+	})
+}
+
+func TestBatchDeleteCallsAfterDeleteForDeletedUsers(t *testing.T) {
+	storeStub := newStubUserStore()
+	refs := fakeUserRefs(2)
+	storeStub.stubDeleteMany = func(context.Context, []uuid.UUID) ([]uuid.UUID, error) {
+		return []uuid.UUID{uuid.MustParse(refs.IDs[0])}, nil
+	}
+	withService(storeStub)(func(service *user.Service) {
+		var deleted []string
+		service.UseHooks(user.Hooks{
+			AfterDelete: []func(context.Context, *user.Ref){
+				func(_ context.Context, ref *user.Ref) { deleted = append(deleted, ref.ID) },
+			},
+		})
+		_, err := service.BatchDelete(context.Background(), &refs)
+		require.NoError(t, err)
+		require.Equal(t, []string{refs.IDs[0]}, deleted)
+	})
+}
+
+func TestImportReportsRowsRejectedByHooks(t *testing.T) {
+	input := "first_name,last_name,nickname,email,password,country\n" +
+		csvRow("Max", "max", "max@example.com", "password123") +
+		csvRow("Erika", "erika", "sanctioned@example.com", "password123")
+	storeStub, results := importingStore()
+	withService(storeStub)(func(service *user.Service) {
+		var created []string
+		service.UseHooks(user.Hooks{
+			BeforeCreate: []func(context.Context, *user.NewUser) error{rejectEmail("sanctioned@example.com")},
+			AfterCreate: []func(context.Context, *user.User){
+				func(_ context.Context, usr *user.User) { created = append(created, usr.Email) },
+			},
+		})
+		report, err := service.Import(context.Background(), strings.NewReader(input), user.ImportCSV)
+		require.NoError(t, err)
+		require.Equal(t, 1, report.Imported)
+		require.Len(t, report.Errors, 1)
+		require.Equal(t, 3, report.Errors[0].Line)
+		require.ErrorIs(t, report.Errors[0].Err, user.ErrRejected)
+		_, stored := results()
+		require.Len(t, stored, 1)
+		require.Equal(t, []string{"max@example.com"}, created)
+	})
+}
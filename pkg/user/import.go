@@ -0,0 +1,311 @@
+package user
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/telemetry"
+	"go.opentelemetry.io/otel"
+)
+
+// ImportFormat is the format of the input read by Import
+type ImportFormat string
+
+const (
+	// ImportCSV is comma separated values, starting with a header row which names the columns
+	ImportCSV ImportFormat = "csv"
+	// ImportJSONL is a JSON object on each line
+	ImportJSONL ImportFormat = "jsonl"
+
+	// ImportBatchSize is the number of imported users stored at once. It should be configurable
+	ImportBatchSize = 500
+	// ImportWorkers is the number of passwords hashed at once while importing. It should be configurable
+	ImportWorkers = 8
+)
+
+// ErrUnknownImportFormat is returned when Import is asked to read a format which is not an ImportFormat
+var ErrUnknownImportFormat = errors.New("unknown import format")
+
+// importColumns set the field of a new user named by each column of CSV input, or each key of JSONL input.
+// Imported users are not asked to confirm their password, so the password also sets ConfirmPassword
+var importColumns = map[string]func(*NewUser, string){
+	"first_name": func(usr *NewUser, value string) { usr.FirstName = value },
+	"last_name":  func(usr *NewUser, value string) { usr.LastName = value },
+	"nickname":   func(usr *NewUser, value string) { usr.Nickname = value },
+	"email":      func(usr *NewUser, value string) { usr.Email = value },
+	"country":    func(usr *NewUser, value string) { usr.Country = value },
+	"password": func(usr *NewUser, value string) {
+		usr.Password = value
+		usr.ConfirmPassword = value
+	},
+}
+
+// ImportReport describes the outcome of an import
+type ImportReport struct {
+	// Imported is the number of users created
+	Imported int
+	// Errors describes each row which was not imported, in the order of the input
+	Errors []RowError
+}
+
+// RowError is the reason a single row of input was not imported
+type RowError struct {
+	// Line is the line of the input the row starts on, counting from 1
+	Line int
+	// Err is an *InvalidError if the row is invalid, a *RejectedError if a BeforeCreate hook rejects it, ErrEmailInUse
+	// or ErrNicknameInUse if it conflicts with an existing user, or describes why the row could not be read
+	Err error
+}
+
+// importRow is a single row of input, and the user to store for it once it has been validated
+type importRow struct {
+	line    int
+	newUser NewUser
+	user    *userstore.User
+	err     error
+}
+
+// rowReader returns the next row of input, or io.EOF when there are no more. A row which cannot be read is returned
+// with its err set, and an error is only returned if the input cannot be read any further
+type rowReader func() (importRow, error)
+
+// Import creates the users read from r, for migrating an existing user base into the service.
+// The columns of CSV input, or keys of JSONL input, are first_name, last_name, nickname, email, password and country,
+// and each row is validated, and checked by the BeforeCreate hooks, as Create checks new users. Passwords are hashed by ImportWorkers goroutines, and users
+// are stored in batches of ImportBatchSize.
+// Rows which cannot be read, are invalid, or conflict with an existing user or an earlier row are not imported, and
+// are listed in the report. An error is returned if the input cannot be read any further or the store fails, in which
+// case the report describes the rows handled before the failure
+func (service *Service) Import(ctx context.Context, r io.Reader, format ImportFormat) (report ImportReport, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "Import")
+	defer span.End()
+
+	next, err := importRows(r, format)
+	if err != nil {
+		span.RecordError(err)
+		return report, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	rows := make(chan importRow)
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(rows)
+		readErr <- sendRows(ctx, next, rows)
+	}()
+
+	prepared := make(chan importRow)
+	var workers sync.WaitGroup
+	for i := 0; i < ImportWorkers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for row := range rows {
+				if row.err == nil {
+					row.user, row.err = service.prepareImport(ctx, &row.newUser)
+				}
+				select {
+				case prepared <- row:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		workers.Wait()
+		close(prepared)
+	}()
+
+	batch := make([]importRow, 0, ImportBatchSize)
+	for row := range prepared {
+		if err != nil {
+			continue // the import has failed, so the rows still being prepared are discarded
+		}
+		if row.err != nil {
+			report.Errors = append(report.Errors, RowError{Line: row.line, Err: row.err})
+			continue
+		}
+		batch = append(batch, row)
+		if len(batch) == ImportBatchSize {
+			if err = service.storeImportBatch(ctx, batch, &report); err != nil {
+				cancel()
+			}
+			batch = batch[:0]
+		}
+	}
+	if err == nil {
+		err = service.storeImportBatch(ctx, batch, &report)
+	}
+	if err == nil {
+		err = <-readErr
+	}
+	sort.Slice(report.Errors, func(i, j int) bool {
+		return report.Errors[i].Line < report.Errors[j].Line
+	})
+	if err != nil {
+		span.RecordError(err)
+	}
+	return report, err
+}
+
+// sendRows sends each row returned by next to rows until there are no more, or ctx is done
+func sendRows(ctx context.Context, next rowReader, rows chan<- importRow) error {
+	for {
+		row, err := next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		select {
+		case rows <- row:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// prepareImport validates newUser and returns the user to store for it, with its password hashed
+func (service *Service) prepareImport(ctx context.Context, newUser *NewUser) (*userstore.User, error) {
+	if err := service.validate.Struct(newUser); err != nil {
+		return nil, invalidError(err)
+	}
+	if err := service.beforeCreate(ctx, newUser); err != nil {
+		return nil, err
+	}
+	id, err := service.idGenerator()
+	if err != nil {
+		return nil, fmt.Errorf("cannot generate uuid: %w", err)
+	}
+	passwordHash, err := service.hasher.Hash(newUser.Password)
+	if err != nil {
+		return nil, fmt.Errorf("cannot hash password: %w", err)
+	}
+	return newStoreUser(id, newUser, passwordHash), nil
+}
+
+// storeImportBatch stores the users of batch, adding them to the report
+func (service *Service) storeImportBatch(ctx context.Context, batch []importRow, report *ImportReport) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	users := make([]userstore.User, 0, len(batch))
+	for _, row := range batch {
+		users = append(users, *row.user)
+	}
+	errs, err := service.store.CreateMany(ctx, users)
+	if errors.Is(err, userstore.ErrIndexesBuilding) {
+		return ErrUnavailable
+	}
+	if err != nil {
+		return fmt.Errorf("unexpected error storing imported users: %w", err)
+	}
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			report.Imported += 1
+			created := copyStoreUserToUser(&users[i])
+			afterChange(ctx, service.hooks.AfterCreate, &created)
+		case errors.Is(err, userstore.ErrAlreadyExists):
+			report.Errors = append(report.Errors, RowError{Line: batch[i].line, Err: alreadyExistsError(err)})
+		default:
+			report.Errors = append(report.Errors, RowError{Line: batch[i].line, Err: err})
+		}
+	}
+	return nil
+}
+
+// importRows returns a rowReader which reads r in the given format
+func importRows(r io.Reader, format ImportFormat) (rowReader, error) {
+	switch format {
+	case ImportCSV:
+		return csvRows(r)
+	case ImportJSONL:
+		return jsonlRows(r), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownImportFormat, format)
+	}
+}
+
+// csvRows reads the header row of r, and returns a rowReader which reads the rows following it
+func csvRows(r io.Reader) (rowReader, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read CSV header: %w", err)
+	}
+	setters := make([]func(*NewUser, string), 0, len(header))
+	for _, column := range header {
+		set, ok := importColumns[column]
+		if !ok {
+			return nil, fmt.Errorf("cannot import unknown CSV column '%s'", column)
+		}
+		setters = append(setters, set)
+	}
+	return func() (row importRow, err error) {
+		record, err := reader.Read()
+		var parseErr *csv.ParseError
+		switch {
+		case errors.As(err, &parseErr):
+			return importRow{line: parseErr.StartLine, err: err}, nil
+		case err != nil:
+			return row, err
+		}
+		row.line, _ = reader.FieldPos(0)
+		for i, value := range record {
+			setters[i](&row.newUser, value)
+		}
+		return row, nil
+	}, nil
+}
+
+// jsonlRows returns a rowReader which reads a JSON object from each line of r. Blank lines are skipped
+func jsonlRows(r io.Reader) rowReader {
+	reader := bufio.NewReader(r)
+	line := 0
+	return func() (row importRow, err error) {
+		for {
+			data, err := reader.ReadBytes('\n')
+			if len(data) == 0 && err != nil {
+				return row, err
+			}
+			line += 1
+			data = bytes.TrimSpace(data)
+			if len(data) == 0 {
+				continue
+			}
+			return jsonlRow(line, data), nil
+		}
+	}
+}
+
+// jsonlRow returns the row for a single line of JSONL input
+func jsonlRow(line int, data []byte) importRow {
+	row := importRow{line: line}
+	var fields map[string]string
+	if row.err = json.Unmarshal(data, &fields); row.err != nil {
+		return row
+	}
+	for key, value := range fields {
+		set, ok := importColumns[key]
+		if !ok {
+			row.err = fmt.Errorf("unknown field '%s'", key)
+			return row
+		}
+		set(&row.newUser, value)
+	}
+	return row
+}
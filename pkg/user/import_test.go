@@ -0,0 +1,170 @@
+package user_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/user"
+	"github.com/stretchr/testify/require"
+)
+
+// importingStore returns a stub store which records the users created by CreateMany. Users with an email address in
+// conflicting are reported as already existing
+func importingStore(conflicting ...string) (*stubUserStore, func() ([][]userstore.User, []userstore.User)) {
+	var mtx sync.Mutex
+	var batches [][]userstore.User
+	var created []userstore.User
+	storeStub := newStubUserStore()
+	storeStub.stubCreateMany = func(_ context.Context, users []userstore.User) ([]error, error) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		batches = append(batches, users)
+		errs := make([]error, len(users))
+		for i, usr := range users {
+			for _, email := range conflicting {
+				if usr.Email == email {
+					errs[i] = userstore.ErrEmailInUse
+				}
+			}
+			if errs[i] == nil {
+				created = append(created, usr)
+			}
+		}
+		return errs, nil
+	}
+	return storeStub, func() ([][]userstore.User, []userstore.User) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		return batches, created
+	}
+}
+
+func csvRow(firstName, nickname, email, password string) string {
+	return fmt.Sprintf("%s,Mustermann,%s,%s,%s,DE\n", firstName, nickname, email, password)
+}
+
+func TestImportCSVCreatesValidUsersAndReportsRowErrors(t *testing.T) {
+	input := "first_name,last_name,nickname,email,password,country\n" +
+		csvRow("Max", "max", "max@example.com", "password123") +
+		csvRow("Erika", "erika", "not an email", "password123") +
+		csvRow("Hans", "hans", "taken@example.com", "password123") +
+		"Too,few,fields\n" +
+		csvRow("Anna", "anna", "anna@example.com", "password123")
+	storeStub, results := importingStore("taken@example.com")
+	withService(storeStub)(func(service *user.Service) {
+		report, err := service.Import(context.Background(), strings.NewReader(input), user.ImportCSV)
+		require.NoError(t, err)
+		require.Equal(t, 2, report.Imported)
+		require.Len(t, report.Errors, 3)
+
+		require.Equal(t, 3, report.Errors[0].Line)
+		var invalid *user.InvalidError
+		require.ErrorAs(t, report.Errors[0].Err, &invalid)
+		require.Equal(t, "Email", invalid.Violations[0].Field)
+		require.Equal(t, 4, report.Errors[1].Line)
+		require.ErrorIs(t, report.Errors[1].Err, user.ErrEmailInUse)
+		require.Equal(t, 5, report.Errors[2].Line)
+
+		_, created := results()
+		require.Len(t, created, 2)
+		for _, usr := range created {
+			require.NotEmpty(t, usr.ID)
+			require.Equal(t, userstore.StatusActive, usr.Status)
+			require.Equal(t, user.DefaultVersion, usr.Version)
+			require.True(t, checkPasswordHash(usr.PasswordHash, "password123"))
+		}
+	})
+}
+
+func TestImportJSONLCreatesValidUsersAndReportsRowErrors(t *testing.T) {
+	input := `{"first_name": "Max", "last_name": "Mustermann", "nickname": "max", "email": "max@example.com", "password": "password123", "country": "DE"}
+
+{"first_name": "Erika", "last_name": "Mustermann", "nickname": "erika", "email": "erika@example.com", "password": "short", "country": "DE"}
+{"first_name": "Hans"
+{"first_name": "Hans", "middle_name": "Peter"}
+{"first_name": "Anna", "last_name": "Mustermann", "nickname": "anna", "email": "anna@example.com", "password": "password123", "country": "DE"}`
+	storeStub, _ := importingStore()
+	withService(storeStub)(func(service *user.Service) {
+		report, err := service.Import(context.Background(), strings.NewReader(input), user.ImportJSONL)
+		require.NoError(t, err)
+		require.Equal(t, 2, report.Imported)
+		require.Len(t, report.Errors, 3)
+		for i, line := range []int{3, 4, 5} {
+			require.Equal(t, line, report.Errors[i].Line)
+		}
+		require.ErrorIs(t, report.Errors[0].Err, user.ErrInvalid)
+	})
+}
+
+// prefixHasher implements user.PasswordHasher cheaply, for tests which hash many passwords
+type prefixHasher struct{}
+
+func (prefixHasher) Hash(plain string) (string, error) {
+	return "hashed:" + plain, nil
+}
+
+func (prefixHasher) Compare(hash string, plain string) bool {
+	return hash == "hashed:"+plain
+}
+
+func TestImportStoresUsersInBatches(t *testing.T) {
+	var input strings.Builder
+	input.WriteString("first_name,last_name,nickname,email,password,country\n")
+	rows := user.ImportBatchSize*2 + 1
+	for i := 0; i < rows; i++ {
+		input.WriteString(csvRow("Max", fmt.Sprintf("max%d", i), fmt.Sprintf("max%d@example.com", i), "password123"))
+	}
+	storeStub, results := importingStore()
+	withService(storeStub, useHasher(prefixHasher{}))(func(service *user.Service) {
+		report, err := service.Import(context.Background(), strings.NewReader(input.String()), user.ImportCSV)
+		require.NoError(t, err)
+		require.Equal(t, rows, report.Imported)
+		require.Empty(t, report.Errors)
+		batches, _ := results()
+		require.Len(t, batches, 3)
+		for _, batch := range batches {
+			require.LessOrEqual(t, len(batch), user.ImportBatchSize)
+		}
+	})
+}
+
+func TestImportReturnsErrorWhenStoreFails(t *testing.T) {
+	unexpected := errors.New("some unexpected error")
+	input := "first_name,last_name,nickname,email,password,country\n" +
+		csvRow("Max", "max", "max@example.com", "password123")
+	storeStub := newStubUserStore()
+	storeStub.stubCreateMany = func(context.Context, []userstore.User) ([]error, error) {
+		return nil, unexpected
+	}
+	withService(storeStub)(func(service *user.Service) {
+		report, err := service.Import(context.Background(), strings.NewReader(input), user.ImportCSV)
+		require.ErrorIs(t, err, unexpected)
+		require.Zero(t, report.Imported)
+	})
+}
+
+func TestImportRejectsUnreadableInput(t *testing.T) {
+	cases := []struct {
+		name   string
+		input  string
+		format user.ImportFormat
+	}{
+		{name: "unknown format", input: "", format: "xml"},
+		{name: "missing CSV header", input: "", format: user.ImportCSV},
+		{name: "unknown CSV column", input: "first_name,middle_name\n", format: user.ImportCSV},
+	}
+	for _, c := range cases {
+		thisCase := c
+		t.Run(thisCase.name, func(t *testing.T) {
+			withService(newStubUserStore())(func(service *user.Service) {
+				_, err := service.Import(context.Background(), strings.NewReader(thisCase.input), thisCase.format)
+				require.Error(t, err)
+			})
+		})
+	}
+}
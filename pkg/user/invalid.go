@@ -0,0 +1,122 @@
+package user
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// FieldViolation describes why a single field of a request is invalid
+type FieldViolation struct {
+	// Field is the name of the invalid field, e.g. FirstName
+	Field string
+	// Rule names the rule the field breaks, so that clients can act on it without parsing the description. Rules
+	// checked by the validator are named by their validation tag, e.g. required, min or allowed-country
+	Rule string
+	// Description explains why the field is invalid
+	Description string
+}
+
+const (
+	// RuleUpdatable is broken by listing a field which cannot be updated in an Update
+	RuleUpdatable = "updatable"
+	// RuleChanged is broken by a change which does not change the field
+	RuleChanged = "changed"
+)
+
+// InvalidError is returned when a request fails validation. It carries the details of each invalid field.
+// It wraps ErrInvalid, so errors.Is(err, ErrInvalid) is true for any InvalidError
+type InvalidError struct {
+	Violations []FieldViolation
+}
+
+func (e *InvalidError) Error() string {
+	fields := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		fields = append(fields, fmt.Sprintf("%s %s", v.Field, v.Description))
+	}
+	return fmt.Sprintf("%s: %s", ErrInvalid.Error(), strings.Join(fields, ", "))
+}
+
+func (e *InvalidError) Unwrap() error {
+	return ErrInvalid
+}
+
+func isNumber(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	default:
+		return false
+	}
+}
+
+// describe returns a human readable description of a failed validation
+func describe(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "min":
+		if isNumber(fe.Kind()) {
+			return fmt.Sprintf("must be at least %s", fe.Param())
+		}
+		return fmt.Sprintf("must be at least %s characters long", fe.Param())
+	case "max":
+		if fe.Kind() == reflect.Slice {
+			return fmt.Sprintf("must have at most %s items", fe.Param())
+		}
+		if isNumber(fe.Kind()) {
+			return fmt.Sprintf("must be at most %s", fe.Param())
+		}
+		return fmt.Sprintf("must be at most %s characters long", fe.Param())
+	case "datetime":
+		return "must be an RFC 3339 timestamp, e.g. 2006-01-02T15:04:05Z"
+	case "unique":
+		return "must not contain duplicates"
+	case "eqfield":
+		return fmt.Sprintf("must match %s", fe.Param())
+	case "email":
+		return "must be a valid email address"
+	case "iso3166_1_alpha2":
+		return "must be an ISO 3166-1 alpha-2 country code"
+	case "allowed-country":
+		return "is not a country users can be registered in"
+	case "avatar-url":
+		return "must be an https URL on an allowed avatar host"
+	case "required_without":
+		return fmt.Sprintf("is required when %s is not set", fe.Param())
+	case "excluded_with":
+		return fmt.Sprintf("must not be set with %s", fe.Param())
+	case "oneof":
+		return fmt.Sprintf("must be one of %s", strings.ReplaceAll(fe.Param(), " ", ", "))
+	case "uuid":
+		return "must be a UUID"
+	case "allowed-runes":
+		return "must only contain letters, numbers, spaces, hyphens, underscores and apostrophes"
+	default:
+		return fmt.Sprintf("failed the %s validation", fe.Tag())
+	}
+}
+
+// invalidError converts an error returned by validator.Validate into an InvalidError.
+// Errors which are not validation errors are wrapped with ErrInvalid without any details
+func invalidError(err error) error {
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	violations := make([]FieldViolation, 0, len(validationErrors))
+	for _, fe := range validationErrors {
+		violations = append(violations, FieldViolation{
+			Field:       fe.Field(),
+			Rule:        fe.Tag(),
+			Description: describe(fe),
+		})
+	}
+	return &InvalidError{Violations: violations}
+}
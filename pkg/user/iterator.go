@@ -0,0 +1,64 @@
+package user
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/telemetry"
+	"go.opentelemetry.io/otel"
+)
+
+// UserIterator yields the users matching a query one at a time from a store cursor, so that any number of users can
+// be processed with constant memory
+type UserIterator struct {
+	it  userstore.UserIterator
+	usr SanitizedUser
+}
+
+// Next moves the iterator to the next user, returning false when there are no more users or an error occurs
+func (it *UserIterator) Next(ctx context.Context) bool {
+	if !it.it.Next(ctx) {
+		return false
+	}
+	usr := it.it.User()
+	it.usr = *sanitizedUserFromUserstoreUser(&usr)
+	return true
+}
+
+// User returns the current user
+func (it *UserIterator) User() SanitizedUser {
+	return it.usr
+}
+
+// Err returns the error which stopped the iterator, if any
+func (it *UserIterator) Err() error {
+	if err := it.it.Err(); err != nil {
+		return fmt.Errorf("cannot read users from store: %w", err)
+	}
+	return nil
+}
+
+// Close releases the store cursor. It must be called once the iterator is no longer needed
+func (it *UserIterator) Close(ctx context.Context) error {
+	return it.it.Close(ctx)
+}
+
+// FindAll returns a UserIterator over every user matching the given query, in the order given by the query. The page
+// and length of the query are ignored. Unlike Find, users are not read a page at a time, so it is suitable for exports
+// and batch jobs over any number of users. No timeout is applied, so ctx must be cancelled to abandon a slow iteration
+func (service *Service) FindAll(ctx context.Context, query *Query) (*UserIterator, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "FindAll")
+	defer span.End()
+
+	q, err := service.storeQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	it, err := service.store.Iterate(ctx, q)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("cannot find users in store: %w", err)
+	}
+	return &UserIterator{it: it}, nil
+}
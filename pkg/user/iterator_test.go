@@ -0,0 +1,59 @@
+package user_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/user"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindAllYieldsEveryUserFromStore(t *testing.T) {
+	query := fakeQuery()
+	records := fakePage(30, 1).Items
+	storeStub := newStubUserStore()
+	withService(storeStub)(func(service *user.Service) {
+		storeStub.stubIterate = func(ctx context.Context, q *userstore.Query) (userstore.UserIterator, error) {
+			require.Equal(t, []string{query.Country}, q.Countries)
+			return iteratorOver(t, records), nil
+		}
+		ctx := context.Background()
+		it, err := service.FindAll(ctx, &query)
+		require.NoError(t, err)
+		defer it.Close(ctx)
+
+		count := 0
+		for it.Next(ctx) {
+			usr := it.User()
+			require.Equal(t, records[count].ID.String(), usr.ID)
+			require.Equal(t, records[count].Email, usr.Email)
+			count++
+		}
+		require.NoError(t, it.Err())
+		require.Equal(t, len(records), count)
+	})
+}
+
+func TestCannotFindAllWithUnsortableField(t *testing.T) {
+	query := fakeQuery()
+	query.SortBy = "password_hash"
+	withService(newStubUserStore())(func(service *user.Service) {
+		_, err := service.FindAll(context.Background(), &query)
+		require.ErrorIs(t, err, user.ErrInvalid)
+	})
+}
+
+func TestOriginalErrorIsInChainWhenFindAllCannotIterate(t *testing.T) {
+	query := fakeQuery()
+	unexpected := errors.New("some unexpected error")
+	storeStub := newStubUserStore()
+	withService(storeStub)(func(service *user.Service) {
+		storeStub.stubIterate = func(context.Context, *userstore.Query) (userstore.UserIterator, error) {
+			return nil, unexpected
+		}
+		_, err := service.FindAll(context.Background(), &query)
+		require.ErrorIs(t, err, unexpected)
+	})
+}
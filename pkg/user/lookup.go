@@ -0,0 +1,42 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/telemetry"
+	"go.opentelemetry.io/otel"
+)
+
+// Lookup identifies a single user by either their email address or their nickname
+type Lookup struct {
+	Email    string `validate:"required_without=Nickname,excluded_with=Nickname,omitempty,email"`
+	Nickname string `validate:"required_without=Email,excluded_with=Email"`
+}
+
+// Lookup finds the user identified by lookup. It returns ErrNotFound if there is no such user
+func (service *Service) Lookup(ctx context.Context, lookup *Lookup) (usr SanitizedUser, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "Lookup")
+	defer span.End()
+
+	if err = service.validate.Struct(lookup); err != nil {
+		return usr, invalidError(err)
+	}
+
+	var rec userstore.User
+	if lookup.Email != "" {
+		rec, err = service.store.FindByEmail(ctx, lookup.Email)
+	} else {
+		rec, err = service.store.FindByNickname(ctx, lookup.Nickname)
+	}
+	if err != nil {
+		if errors.Is(err, userstore.ErrNotFound) {
+			return usr, ErrNotFound
+		}
+		span.RecordError(err)
+		return usr, fmt.Errorf("cannot look up user in store: %w", err)
+	}
+	return *sanitizedUserFromUserstoreUser(&rec), nil
+}
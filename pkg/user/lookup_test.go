@@ -0,0 +1,63 @@
+package user_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/user"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookupFindsUserByEmailOrNickname(t *testing.T) {
+	rec := fakeUserRecord()
+	storeStub := newStubUserStore()
+	storeStub.stubFindByEmail = func(_ context.Context, email string) (userstore.User, error) {
+		require.Equal(t, rec.Email, email)
+		return rec, nil
+	}
+	storeStub.stubFindByNickname = func(_ context.Context, nickname string) (userstore.User, error) {
+		require.Equal(t, rec.Nickname, nickname)
+		return rec, nil
+	}
+	withService(storeStub)(func(service *user.Service) {
+		for _, lookup := range []user.Lookup{{Email: rec.Email}, {Nickname: rec.Nickname}} {
+			usr, err := service.Lookup(context.Background(), &lookup)
+			require.NoError(t, err)
+			require.Equal(t, rec.ID.String(), usr.ID)
+		}
+	})
+}
+
+func TestLookupRequiresEitherEmailOrNickname(t *testing.T) {
+	for _, lookup := range []user.Lookup{{}, {Email: "max@example.com", Nickname: "max"}, {Email: "not an email"}} {
+		withService(newStubUserStore())(func(service *user.Service) {
+			_, err := service.Lookup(context.Background(), &lookup)
+			require.ErrorIs(t, err, user.ErrInvalid)
+		})
+	}
+}
+
+func TestLookupReturnsNotFoundForUnknownUser(t *testing.T) {
+	storeStub := newStubUserStore()
+	storeStub.stubFindByNickname = func(context.Context, string) (userstore.User, error) {
+		return userstore.User{}, userstore.ErrNotFound
+	}
+	withService(storeStub)(func(service *user.Service) {
+		_, err := service.Lookup(context.Background(), &user.Lookup{Nickname: "unknown"})
+		require.ErrorIs(t, err, user.ErrNotFound)
+	})
+}
+
+func TestOriginalErrorIsInChainWhenStoreLookupReturnsError(t *testing.T) {
+	unexpected := errors.New("some unexpected error")
+	storeStub := newStubUserStore()
+	storeStub.stubFindByEmail = func(context.Context, string) (userstore.User, error) {
+		return userstore.User{}, unexpected
+	}
+	withService(storeStub)(func(service *user.Service) {
+		_, err := service.Lookup(context.Background(), &user.Lookup{Email: "max@example.com"})
+		require.ErrorIs(t, err, unexpected)
+	})
+}
@@ -0,0 +1,98 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/telemetry"
+	"go.opentelemetry.io/otel"
+)
+
+const (
+	// DefaultNicknameCooldown is the time a user must wait between changes of nickname unless the service is
+	// configured with UseNicknameCooldown
+	DefaultNicknameCooldown = 30 * 24 * time.Hour
+)
+
+// ErrNicknameChangeTooSoon is returned when a user changes their nickname before the cooldown since their last change
+// has passed
+var ErrNicknameChangeTooSoon = errors.New("nickname was changed too recently")
+
+// NicknameChange is a request to change the nickname of a user
+type NicknameChange struct {
+	ID       string `validate:"uuid"`
+	Nickname string `validate:"required,allowed-runes"`
+	Version  int64
+}
+
+// UseNicknameCooldown sets the time a user must wait between changes of nickname. A cooldown of 0 allows users to
+// change their nickname at any time. It must be called before the service handles any requests
+func (service *Service) UseNicknameCooldown(cooldown time.Duration) {
+	service.nicknameCooldown = cooldown
+}
+
+// ChangeNickname changes the nickname of a user if the request is valid and no other user has the new nickname. The
+// previous nickname is kept in the history of the user, which is included in their data export. It returns
+// ErrNicknameChangeTooSoon if the user changed their nickname within the cooldown, and ErrNicknameInUse if the
+// nickname is taken. The change is published with the NicknameChanged action, so that systems which refer to users
+// by nickname can follow it
+func (service *Service) ChangeNickname(ctx context.Context, change *NicknameChange) (usr User, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "ChangeNickname")
+	defer span.End()
+
+	if err = service.validate.Struct(change); err != nil {
+		err = invalidError(err)
+		service.logger.Errorf(ctx, err, "cannot change nickname with invalid request")
+		return usr, err
+	}
+
+	id := uuid.MustParse(change.ID) // ok to call function which can panic because id has already been validated as a uuid
+
+	rec, err := service.store.ReadOne(ctx, id)
+	if err != nil {
+		if errors.Is(err, userstore.ErrNotFound) {
+			return usr, ErrNotFound
+		}
+		return usr, fmt.Errorf("unexpected error reading user store: %w", err)
+	}
+	if change.Version != rec.Version {
+		return usr, ErrInvalidVersion
+	}
+	if change.Nickname == rec.Nickname {
+		return usr, &InvalidError{Violations: []FieldViolation{{
+			Field:       "Nickname",
+			Rule:        RuleChanged,
+			Description: "must be different to the current nickname",
+		}}}
+	}
+	// uniqueness is checked here so that the user is told before the cooldown is checked, and again by the store
+	if _, err = service.store.FindByNickname(ctx, change.Nickname); err == nil {
+		return usr, ErrNicknameInUse
+	} else if !errors.Is(err, userstore.ErrNotFound) {
+		return usr, fmt.Errorf("cannot find user by nickname: %w", err)
+	}
+
+	updated, err := service.store.ChangeNickname(ctx, id, change.Version, change.Nickname, service.nicknameCooldown)
+	if err != nil {
+		switch {
+		case errors.Is(err, userstore.ErrNotFound):
+			return usr, ErrNotFound
+		case errors.Is(err, userstore.ErrInvalidVersion):
+			return usr, ErrInvalidVersion
+		case errors.Is(err, userstore.ErrNicknameChangeTooSoon):
+			return usr, ErrNicknameChangeTooSoon
+		case errors.Is(err, userstore.ErrNicknameInUse):
+			return usr, ErrNicknameInUse
+		case errors.Is(err, userstore.ErrIndexesBuilding), errors.Is(err, userstore.ErrTooManyEvents):
+			return usr, ErrUnavailable
+		default:
+			span.RecordError(err)
+			return usr, fmt.Errorf("unexpected error changing nickname in user store: %w", err)
+		}
+	}
+	return copyStoreUserToUser(&updated), nil
+}
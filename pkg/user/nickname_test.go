@@ -0,0 +1,154 @@
+package user_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/user"
+	"github.com/stretchr/testify/require"
+)
+
+func fakeNicknameChange(rec userstore.User) user.NicknameChange {
+	return user.NicknameChange{
+		ID:       rec.ID.String(),
+		Nickname: "renamed",
+		Version:  rec.Version,
+	}
+}
+
+// storeForNicknameChange returns a stub store holding rec, where no other user has a nickname
+func storeForNicknameChange() (*stubUserStore, userstore.User) {
+	storeStub := newStubUserStore()
+	rec := fakeUserRecord()
+	storeStub.stubReadOne = func(context.Context, uuid.UUID) (userstore.User, error) {
+		return rec, nil
+	}
+	storeStub.stubFindByNickname = func(context.Context, string) (userstore.User, error) {
+		return userstore.User{}, userstore.ErrNotFound
+	}
+	return storeStub, rec
+}
+
+func TestChangeNicknameCallsStoreWithCooldown(t *testing.T) {
+	storeStub, rec := storeForNicknameChange()
+	change := fakeNicknameChange(rec)
+	storeStub.stubChangeNickname = func(_ context.Context, id uuid.UUID, version int64, nickname string, cooldown time.Duration) (userstore.User, error) {
+		require.True(t, compareIDs(rec.ID, id))
+		require.Equal(t, rec.Version, version)
+		require.Equal(t, change.Nickname, nickname)
+		require.Equal(t, user.DefaultNicknameCooldown, cooldown)
+		updated := rec
+		updated.Nickname = nickname
+		updated.Version += 1
+		return updated, nil
+	}
+	withService(storeStub)(func(service *user.Service) {
+		usr, err := service.ChangeNickname(context.Background(), &change)
+		require.NoError(t, err)
+		require.Equal(t, change.Nickname, usr.Nickname)
+		require.Equal(t, rec.Version+1, usr.Version)
+	})
+}
+
+func TestChangeNicknameUsesConfiguredCooldown(t *testing.T) {
+	storeStub, rec := storeForNicknameChange()
+	change := fakeNicknameChange(rec)
+	storeStub.stubChangeNickname = func(_ context.Context, _ uuid.UUID, _ int64, _ string, cooldown time.Duration) (userstore.User, error) {
+		require.Equal(t, time.Hour, cooldown)
+		return rec, nil
+	}
+	withService(storeStub)(func(service *user.Service) {
+		service.UseNicknameCooldown(time.Hour)
+		_, err := service.ChangeNickname(context.Background(), &change)
+		require.NoError(t, err)
+	})
+}
+
+func TestCannotChangeNicknameToNicknameOfAnotherUser(t *testing.T) {
+	storeStub, rec := storeForNicknameChange()
+	change := fakeNicknameChange(rec)
+	storeStub.stubFindByNickname = func(context.Context, string) (userstore.User, error) {
+		return fakeUserRecord(), nil
+	}
+	withService(storeStub)(func(service *user.Service) {
+		_, err := service.ChangeNickname(context.Background(), &change)
+		require.ErrorIs(t, err, user.ErrNicknameInUse)
+	})
+}
+
+func TestCannotChangeNicknameWithStaleVersion(t *testing.T) {
+	storeStub, rec := storeForNicknameChange()
+	change := fakeNicknameChange(rec)
+	change.Version += 1
+	withService(storeStub)(func(service *user.Service) {
+		_, err := service.ChangeNickname(context.Background(), &change)
+		require.ErrorIs(t, err, user.ErrInvalidVersion)
+	})
+}
+
+func TestCannotChangeNicknameToCurrentNickname(t *testing.T) {
+	storeStub, rec := storeForNicknameChange()
+	change := fakeNicknameChange(rec)
+	change.Nickname = rec.Nickname
+	withService(storeStub)(func(service *user.Service) {
+		_, err := service.ChangeNickname(context.Background(), &change)
+		require.ErrorIs(t, err, user.ErrInvalid)
+	})
+}
+
+func TestCannotChangeNicknameWithInvalidRequest(t *testing.T) {
+	rec := fakeUserRecord()
+	cases := []struct {
+		name   string
+		mutate func(*user.NicknameChange)
+	}{
+		{name: "invalid id", mutate: func(c *user.NicknameChange) { c.ID = "not a uuid" }},
+		{name: "missing nickname", mutate: func(c *user.NicknameChange) { c.Nickname = "" }},
+	}
+	for _, c := range cases {
+		thisCase := c
+		t.Run(thisCase.name, func(t *testing.T) {
+			change := fakeNicknameChange(rec)
+			thisCase.mutate(&change)
+			withService(newStubUserStore())(func(service *user.Service) {
+				_, err := service.ChangeNickname(context.Background(), &change)
+				require.ErrorIs(t, err, user.ErrInvalid)
+			})
+		})
+	}
+}
+
+func TestChangeNicknameReturnsCorrectErrorWhenStoreChangeFails(t *testing.T) {
+	unexpected := errors.New("some unexpected error")
+	cases := []struct {
+		name     string
+		expected error
+		result   error
+	}{
+		{name: "Not Found", expected: user.ErrNotFound, result: userstore.ErrNotFound},
+		{name: "Invalid Version", expected: user.ErrInvalidVersion, result: userstore.ErrInvalidVersion},
+		{name: "Too Soon", expected: user.ErrNicknameChangeTooSoon, result: userstore.ErrNicknameChangeTooSoon},
+		{name: "Nickname In Use", expected: user.ErrNicknameInUse, result: userstore.ErrNicknameInUse},
+		{name: "Indexes Building", expected: user.ErrUnavailable, result: userstore.ErrIndexesBuilding},
+		{name: "Too Many Events", expected: user.ErrUnavailable, result: userstore.ErrTooManyEvents},
+		{name: "Unexpected error included in chain", expected: unexpected, result: unexpected},
+	}
+	for _, c := range cases {
+		thisCase := c
+		t.Run(thisCase.name, func(t *testing.T) {
+			storeStub, rec := storeForNicknameChange()
+			change := fakeNicknameChange(rec)
+			storeStub.stubChangeNickname = func(context.Context, uuid.UUID, int64, string, time.Duration) (userstore.User, error) {
+				return userstore.User{}, thisCase.result
+			}
+			withService(storeStub)(func(service *user.Service) {
+				_, err := service.ChangeNickname(context.Background(), &change)
+				require.ErrorIs(t, err, thisCase.expected)
+			})
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package user
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/tenant"
+)
+
+const (
+	// NotifyTimeout is the time allowed for sending each notification. It should be configurable
+	NotifyTimeout = 30 * time.Second
+	// NotifyWorkers is the number of notifications sent at once. It should be configurable
+	NotifyWorkers = 4
+	// NotifyQueueSize is the number of notifications waiting to be sent before the events they are sent for wait for
+	// room in the queue. It should be configurable
+	NotifyQueueSize = 1000
+	// NotifyAttempts is the number of times a notification is sent before it is abandoned
+	NotifyAttempts = 3
+	// NotifyRetryInterval is the time waited before a failed notification is sent again. It is doubled after each
+	// attempt
+	NotifyRetryInterval = time.Second
+	// undeliverableDomain is the top level domain reserved for addresses which are known not to exist, such as those
+	// of seeded users
+	undeliverableDomain = ".invalid"
+)
+
+// Notifier sends notifications to users about changes to their accounts
+type Notifier interface {
+	// Welcome welcomes a user who has been created, including users who have been imported
+	Welcome(ctx context.Context, user *SanitizedUser) error
+	// PasswordChanged tells a user that their password has been changed, including by a password reset
+	PasswordChanged(ctx context.Context, user *SanitizedUser) error
+	// Deleted confirms to a user that their account has been deleted. Only their email address is still known
+	Deleted(ctx context.Context, email string) error
+}
+
+// notification is a notification waiting to be sent by the workers started by PublishChanges
+type notification struct {
+	tenant  string
+	id      uuid.UUID
+	version int64
+	action  userstore.Action
+	send    func(context.Context) error
+}
+
+// UseNotifier sends notifications about changes to users with notifier. Notifications are sent once the event for the
+// change has been processed by PublishChanges, whether or not its action is published, by NotifyWorkers workers.
+// Users whose addresses are in the reserved .invalid top level domain are not notified. It must be called before the
+// service handles any requests
+func (service *Service) UseNotifier(notifier Notifier) {
+	service.notifier = notifier
+	service.notifications = make(chan notification, NotifyQueueSize)
+}
+
+// startNotifying starts the workers which send the queued notifications until ctx is done. Notifications still queued
+// then are not sent
+func (service *Service) startNotifying(ctx context.Context) {
+	if service.notifier == nil {
+		return
+	}
+	for i := 0; i < NotifyWorkers; i++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case n := <-service.notifications:
+					service.sendNotification(ctx, &n)
+				}
+			}
+		}()
+	}
+}
+
+// notify queues the notification for ue, if its action has one, to be sent in the background. When the queue is full,
+// notify waits for room in it until ctx is done
+func (service *Service) notify(ctx context.Context, ue *userstore.Event) {
+	if service.notifier == nil {
+		return
+	}
+	var send func(context.Context) error
+	switch {
+	case ue.Action == userstore.Created && ue.Data != nil && deliverable(ue.Data.Email):
+		user := sanitizedUserFromUserstoreUser(ue.Data)
+		send = func(ctx context.Context) error { return service.notifier.Welcome(ctx, user) }
+	case ue.Action == userstore.PasswordChanged && ue.Data != nil && deliverable(ue.Data.Email):
+		user := sanitizedUserFromUserstoreUser(ue.Data)
+		send = func(ctx context.Context) error { return service.notifier.PasswordChanged(ctx, user) }
+	case ue.Action == userstore.Deleted && ue.Email != "" && deliverable(ue.Email):
+		email := ue.Email
+		send = func(ctx context.Context) error { return service.notifier.Deleted(ctx, email) }
+	default:
+		return
+	}
+	n := notification{tenant: ue.Tenant, id: ue.ID, version: ue.Version, action: ue.Action, send: send}
+	select {
+	case service.notifications <- n:
+	case <-ctx.Done():
+		service.logger.Errorf(ctx, ctx.Err(), "cannot queue %s notification for event with id: %s and version: %d", n.action, n.id, n.version)
+	}
+}
+
+// sendNotification sends n up to NotifyAttempts times, waiting longer after each failure, until it is sent or ctx is
+// done. Each failure is logged
+func (service *Service) sendNotification(ctx context.Context, n *notification) {
+	ctx = tenant.With(ctx, n.tenant)
+	wait := NotifyRetryInterval
+	for attempt := 1; ; attempt++ {
+		sendCtx, cancel := context.WithTimeout(ctx, NotifyTimeout)
+		err := n.send(sendCtx)
+		cancel()
+		if err == nil {
+			return
+		}
+		service.logger.Errorf(ctx, err, "cannot send %s notification for event with id: %s and version: %d (attempt %d of %d)",
+			n.action, n.id, n.version, attempt, NotifyAttempts)
+		if attempt == NotifyAttempts {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+// deliverable returns false if email is in the reserved .invalid top level domain
+func deliverable(email string) bool {
+	return !strings.HasSuffix(strings.ToLower(email), undeliverableDomain)
+}
@@ -0,0 +1,177 @@
+package user_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/robotlovesyou/fitest/pkg/event"
+	"github.com/robotlovesyou/fitest/pkg/notify"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/user"
+	"github.com/stretchr/testify/require"
+)
+
+// publishWithNotifier publishes each of events with a service which notifies notifier, and returns the events sent to
+// the bus once every event has been processed
+func publishWithNotifier(t *testing.T, notifier user.Notifier, events ...userstore.Event) []user.Event {
+	results := make([]error, len(events))
+	store, in, processed := redeliveringStore(results...)
+	var mtx sync.Mutex
+	var sent []user.Event
+	eventStub := newEventStub()
+	eventStub.sendStub = func(body []byte) event.Result {
+		mtx.Lock()
+		defer mtx.Unlock()
+		var evt user.Event
+		require.NoError(t, json.Unmarshal(body, &evt))
+		sent = append(sent, evt)
+		return happySendResult{}
+	}
+	withService(store, useBus(eventStub))(func(service *user.Service) {
+		service.UseNotifier(notifier)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go service.PublishChanges(ctx, user.PublishConfig{})
+
+		for _, e := range events {
+			in <- e
+		}
+		for range events {
+			<-processed
+		}
+	})
+	mtx.Lock()
+	defer mtx.Unlock()
+	return sent
+}
+
+func eventWithAction(action userstore.Action) userstore.Event {
+	e := eventForUserRecord(fakeUserRecord())
+	e.Action = action
+	return e
+}
+
+func TestNotificationsAreSentForUserLifecycleEvents(t *testing.T) {
+	created := eventWithAction(userstore.Created)
+	changed := eventWithAction(userstore.PasswordChanged)
+	deleted := eventWithAction(userstore.Deleted)
+	deleted.Email = deleted.Data.Email
+	deleted.Data = nil
+
+	recorder := notify.NewRecorder()
+	publishWithNotifier(t, recorder, created, eventWithAction(userstore.Updated), changed, deleted)
+
+	require.Eventually(t, func() bool { return len(recorder.Notifications()) == 3 }, time.Second, 10*time.Millisecond)
+	notifications := map[notify.Kind]notify.Notification{}
+	for _, n := range recorder.Notifications() {
+		notifications[n.Kind] = n
+	}
+	require.Len(t, notifications, 3)
+	require.Equal(t, created.Data.Email, notifications[notify.KindWelcome].Email)
+	compareUserstoreUserAndSanitizedUser(created.Data, notifications[notify.KindWelcome].User, t)
+	require.Equal(t, changed.Data.Email, notifications[notify.KindPasswordChanged].Email)
+	compareUserstoreUserAndSanitizedUser(changed.Data, notifications[notify.KindPasswordChanged].User, t)
+	require.Equal(t, deleted.Email, notifications[notify.KindDeleted].Email)
+	require.Nil(t, notifications[notify.KindDeleted].User)
+}
+
+func TestAddressOfDeletedUserIsNotPublished(t *testing.T) {
+	deleted := eventWithAction(userstore.Deleted)
+	deleted.Email = deleted.Data.Email
+	deleted.Data = nil
+
+	sent := publishWithNotifier(t, notify.NewRecorder(), deleted)
+	require.Len(t, sent, 1)
+	require.Empty(t, sent[0].Email)
+}
+
+type failingNotifier struct {
+	calls chan struct{}
+}
+
+func (n failingNotifier) Welcome(context.Context, *user.SanitizedUser) error {
+	n.calls <- struct{}{}
+	return errors.New("cannot send")
+}
+
+func (n failingNotifier) PasswordChanged(context.Context, *user.SanitizedUser) error {
+	n.calls <- struct{}{}
+	return errors.New("cannot send")
+}
+
+func (n failingNotifier) Deleted(context.Context, string) error {
+	n.calls <- struct{}{}
+	return errors.New("cannot send")
+}
+
+func TestFailedNotificationsDoNotFailEvents(t *testing.T) {
+	notifier := failingNotifier{calls: make(chan struct{}, 1)}
+	sent := publishWithNotifier(t, notifier, eventWithAction(userstore.Created))
+	require.Len(t, sent, 1)
+	select {
+	case <-notifier.calls:
+	case <-time.After(time.Second):
+		t.Fatal("notifier was not called")
+	}
+}
+
+// flakyNotifier fails to send the first notification, and records the calls made to it
+type flakyNotifier struct {
+	mtx   sync.Mutex
+	calls int
+}
+
+func (n *flakyNotifier) call() error {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	n.calls++
+	if n.calls == 1 {
+		return errors.New("cannot send")
+	}
+	return nil
+}
+
+func (n *flakyNotifier) Welcome(context.Context, *user.SanitizedUser) error { return n.call() }
+
+func (n *flakyNotifier) PasswordChanged(context.Context, *user.SanitizedUser) error { return n.call() }
+
+func (n *flakyNotifier) Deleted(context.Context, string) error { return n.call() }
+
+func (n *flakyNotifier) Calls() int {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	return n.calls
+}
+
+func TestFailedNotificationsAreSentAgain(t *testing.T) {
+	notifier := &flakyNotifier{}
+	results := []error{nil}
+	store, in, processed := redeliveringStore(results...)
+	withService(store)(func(service *user.Service) {
+		service.UseNotifier(notifier)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go service.PublishChanges(ctx, user.PublishConfig{})
+
+		in <- eventWithAction(userstore.Created)
+		<-processed
+		require.Eventually(t, func() bool { return notifier.Calls() == 2 }, 3*user.NotifyRetryInterval, 10*time.Millisecond)
+	})
+}
+
+func TestUsersWithInvalidAddressesAreNotNotified(t *testing.T) {
+	seeded := eventWithAction(userstore.Created)
+	seeded.Data.Email = "seeded@" + user.SeedEmailDomain
+	created := eventWithAction(userstore.Created)
+
+	recorder := notify.NewRecorder()
+	publishWithNotifier(t, recorder, seeded, created)
+
+	require.Eventually(t, func() bool { return len(recorder.Notifications()) > 0 }, time.Second, 10*time.Millisecond)
+	require.Len(t, recorder.Notifications(), 1)
+	require.Equal(t, created.Data.Email, recorder.Notifications()[0].Email)
+}
@@ -0,0 +1,85 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/robotlovesyou/fitest/pkg/utctime"
+)
+
+const (
+	// MaxHealthyEventAge is the maximum age of the oldest event waiting to be published for the service to be
+	// considered healthy, unless the service is configured with UseHealthConfig
+	MaxHealthyEventAge = 5 * time.Minute
+	// BacklogTimeout is the time allowed for measuring the backlog when metrics are collected. It should be configurable
+	BacklogTimeout = 5 * time.Second
+)
+
+// EventBacklog describes the events in the outbox which have not been published
+type EventBacklog struct {
+	// Pending is the number of events which have not been published
+	Pending int64
+	// OldestAge is the age of the oldest event which has not been published. It is 0 when there are none
+	OldestAge time.Duration
+}
+
+// EventBacklog measures the events of every tenant which are waiting to be published. It can be used to alert on
+// publishing falling behind
+func (service *Service) EventBacklog(ctx context.Context) (EventBacklog, error) {
+	backlog, err := service.store.Backlog(ctx)
+	if err != nil {
+		return EventBacklog{}, fmt.Errorf("cannot measure event backlog in store: %w", err)
+	}
+	result := EventBacklog{Pending: backlog.Pending}
+	if !backlog.Oldest.IsZero() {
+		result.OldestAge = utctime.Now().Sub(backlog.Oldest)
+	}
+	return result, nil
+}
+
+// OutboxCollector is a prometheus.Collector which measures the event backlog of a service each time metrics are
+// collected
+type OutboxCollector struct {
+	service   *Service
+	pending   *prometheus.Desc
+	oldestAge *prometheus.Desc
+}
+
+// NewOutboxCollector creates a new OutboxCollector for service
+func NewOutboxCollector(service *Service) *OutboxCollector {
+	return &OutboxCollector{
+		service: service,
+		pending: prometheus.NewDesc(
+			"users_outbox_pending_events",
+			"Number of change events which have not been published",
+			nil, nil,
+		),
+		oldestAge: prometheus.NewDesc(
+			"users_outbox_oldest_pending_event_age_seconds",
+			"Age of the oldest change event which has not been published, or 0 when there are none",
+			nil, nil,
+		),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *OutboxCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.pending
+	ch <- c.oldestAge
+}
+
+// Collect implements prometheus.Collector. If the backlog cannot be measured, both metrics are reported as invalid
+func (c *OutboxCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), BacklogTimeout)
+	defer cancel()
+	backlog, err := c.service.EventBacklog(ctx)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.pending, err)
+		ch <- prometheus.NewInvalidMetric(c.oldestAge, err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.pending, prometheus.GaugeValue, float64(backlog.Pending))
+	ch <- prometheus.MustNewConstMetric(c.oldestAge, prometheus.GaugeValue, backlog.OldestAge.Seconds())
+}
@@ -0,0 +1,98 @@
+package user_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/user"
+	"github.com/robotlovesyou/fitest/pkg/utctime"
+	"github.com/stretchr/testify/require"
+)
+
+func storeWithBacklog(backlog userstore.Backlog, err error) *stubUserStore {
+	store := newStubUserStore()
+	store.stubBacklog = func(context.Context) (userstore.Backlog, error) {
+		return backlog, err
+	}
+	return store
+}
+
+func TestEventBacklogReportsAgeOfOldestEvent(t *testing.T) {
+	store := storeWithBacklog(userstore.Backlog{Pending: 3, Oldest: utctime.Now().Add(-time.Minute)}, nil)
+	withService(store)(func(service *user.Service) {
+		backlog, err := service.EventBacklog(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, int64(3), backlog.Pending)
+		require.GreaterOrEqual(t, backlog.OldestAge, time.Minute)
+		require.Less(t, backlog.OldestAge, 2*time.Minute)
+	})
+}
+
+func TestEventBacklogIsEmptyWhenNoEventsArePending(t *testing.T) {
+	store := storeWithBacklog(userstore.Backlog{}, nil)
+	withService(store)(func(service *user.Service) {
+		backlog, err := service.EventBacklog(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, user.EventBacklog{}, backlog)
+	})
+}
+
+func TestMonitorChecksAgeOfOldestEvent(t *testing.T) {
+	cases := []struct {
+		name    string
+		backlog userstore.Backlog
+		err     error
+		healthy bool
+	}{
+		{name: "no events", backlog: userstore.Backlog{}, healthy: true},
+		{name: "recent events", backlog: userstore.Backlog{Pending: 10, Oldest: utctime.Now().Add(-time.Minute)}, healthy: true},
+		{name: "old events", backlog: userstore.Backlog{Pending: 1, Oldest: utctime.Now().Add(-user.MaxHealthyEventAge - time.Minute)}, healthy: false},
+		{name: "store error", err: errors.New("some unexpected error"), healthy: false},
+	}
+	for _, c := range cases {
+		thisCase := c
+		t.Run(thisCase.name, func(t *testing.T) {
+			withService(storeWithBacklog(thisCase.backlog, thisCase.err))(func(service *user.Service) {
+				err := user.NewMonitor(service).Check(context.Background())
+				if thisCase.healthy {
+					require.NoError(t, err)
+				} else {
+					require.Error(t, err)
+				}
+			})
+		})
+	}
+}
+
+func TestOutboxCollectorReportsBacklog(t *testing.T) {
+	store := storeWithBacklog(userstore.Backlog{Pending: 7}, nil)
+	withService(store)(func(service *user.Service) {
+		registry := prometheus.NewRegistry()
+		require.NoError(t, registry.Register(user.NewOutboxCollector(service)))
+		expected := `
+# HELP users_outbox_oldest_pending_event_age_seconds Age of the oldest change event which has not been published, or 0 when there are none
+# TYPE users_outbox_oldest_pending_event_age_seconds gauge
+users_outbox_oldest_pending_event_age_seconds 0
+# HELP users_outbox_pending_events Number of change events which have not been published
+# TYPE users_outbox_pending_events gauge
+users_outbox_pending_events 7
+`
+		require.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected)))
+	})
+}
+
+func TestOutboxCollectorFailsWhenBacklogCannotBeMeasured(t *testing.T) {
+	store := storeWithBacklog(userstore.Backlog{}, errors.New("some unexpected error"))
+	withService(store)(func(service *user.Service) {
+		registry := prometheus.NewRegistry()
+		require.NoError(t, registry.Register(user.NewOutboxCollector(service)))
+		_, err := registry.Gather()
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,84 @@
+package user
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+)
+
+// PublishConfig selects the events which PublishChanges sends to the bus, and what they carry. The zero value sends
+// every event with its user. Events which are not sent are still processed, and are still streamed to watchers
+type PublishConfig struct {
+	// Actions lists the actions of the events to send. When it is empty, events with any action are sent
+	Actions []string
+	// ExcludeActions lists the actions of events which are not sent, even when they are listed in Actions
+	ExcludeActions []string
+	// OmitData sends events without their user, for topics whose consumers must not receive personal information.
+	// Consumers which need the user must read it from the service
+	OmitData bool
+}
+
+// publishedActions are the actions which can be listed in a PublishConfig
+var publishedActions = map[string]bool{
+	string(userstore.Created):                true,
+	string(userstore.Updated):                true,
+	string(userstore.Deleted):                true,
+	string(userstore.PasswordChanged):        true,
+	string(userstore.PasswordResetRequested): true,
+	string(userstore.EmailChangeRequested):   true,
+	string(userstore.EmailChanged):           true,
+	string(userstore.Restored):               true,
+	string(userstore.Anonymized):             true,
+	string(userstore.Suspended):              true,
+	string(userstore.Reactivated):            true,
+	string(userstore.Banned):                 true,
+	string(userstore.MarkedDormant):          true,
+	string(userstore.TwoFactorEnabled):       true,
+	string(userstore.TwoFactorDisabled):      true,
+	string(userstore.NicknameChanged):        true,
+	string(userstore.Replayed):               true,
+}
+
+// ParseActions parses a comma separated list of actions, e.g. Created,Deleted, for a PublishConfig. An empty list
+// returns no actions
+func ParseActions(list string) ([]string, error) {
+	if list == "" {
+		return nil, nil
+	}
+	var actions []string
+	for _, action := range strings.Split(list, ",") {
+		action = strings.TrimSpace(action)
+		if !publishedActions[action] {
+			return nil, fmt.Errorf("unknown action '%s'", action)
+		}
+		actions = append(actions, action)
+	}
+	return actions, nil
+}
+
+// publishes returns true if events with the given action are sent to the bus
+func (config *PublishConfig) publishes(action userstore.Action) bool {
+	for _, excluded := range config.ExcludeActions {
+		if excluded == string(action) {
+			return false
+		}
+	}
+	if len(config.Actions) == 0 {
+		return true
+	}
+	for _, included := range config.Actions {
+		if included == string(action) {
+			return true
+		}
+	}
+	return false
+}
+
+// published returns the event to send to the bus for evt
+func (config *PublishConfig) published(evt Event) Event {
+	if config.OmitData {
+		evt.Data = nil
+	}
+	return evt
+}
@@ -0,0 +1,92 @@
+package user_test
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/robotlovesyou/fitest/pkg/event"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/user"
+	"github.com/stretchr/testify/require"
+)
+
+// publishActions publishes an event with each of actions with config, and returns the events sent to the bus once
+// every event has been processed
+func publishActions(t *testing.T, config user.PublishConfig, actions ...userstore.Action) []user.Event {
+	results := make([]error, len(actions))
+	store, events, processed := redeliveringStore(results...)
+	var mtx sync.Mutex
+	var sent []user.Event
+	eventStub := newEventStub()
+	eventStub.sendStub = func(body []byte) event.Result {
+		mtx.Lock()
+		defer mtx.Unlock()
+		var evt user.Event
+		require.NoError(t, json.Unmarshal(body, &evt))
+		sent = append(sent, evt)
+		return happySendResult{}
+	}
+	withService(store, useBus(eventStub))(func(service *user.Service) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go service.PublishChanges(ctx, config)
+
+		for _, action := range actions {
+			e := eventForUserRecord(fakeUserRecord())
+			e.Action = action
+			events <- e
+		}
+		for range actions {
+			<-processed
+		}
+	})
+	mtx.Lock()
+	defer mtx.Unlock()
+	return sent
+}
+
+func TestPublishChangesOnlySendsSelectedActions(t *testing.T) {
+	cases := []struct {
+		name     string
+		config   user.PublishConfig
+		expected []string
+	}{
+		{name: "all actions", config: user.PublishConfig{}, expected: []string{"Created", "Updated", "Deleted"}},
+		{name: "included actions", config: user.PublishConfig{Actions: []string{"Deleted"}}, expected: []string{"Deleted"}},
+		{name: "excluded actions", config: user.PublishConfig{ExcludeActions: []string{"Updated"}}, expected: []string{"Created", "Deleted"}},
+		{name: "included and excluded actions", config: user.PublishConfig{Actions: []string{"Created", "Updated"}, ExcludeActions: []string{"Updated"}}, expected: []string{"Created"}},
+	}
+	for _, c := range cases {
+		thisCase := c
+		t.Run(thisCase.name, func(t *testing.T) {
+			sent := publishActions(t, thisCase.config, userstore.Created, userstore.Updated, userstore.Deleted)
+			var actions []string
+			for _, evt := range sent {
+				actions = append(actions, evt.Action)
+			}
+			require.ElementsMatch(t, thisCase.expected, actions)
+		})
+	}
+}
+
+func TestPublishChangesCanOmitData(t *testing.T) {
+	sent := publishActions(t, user.PublishConfig{OmitData: true}, userstore.Created)
+	require.Len(t, sent, 1)
+	require.NotEmpty(t, sent[0].ID)
+	require.Nil(t, sent[0].Data)
+}
+
+func TestCanParseActions(t *testing.T) {
+	actions, err := user.ParseActions("Created, Deleted")
+	require.NoError(t, err)
+	require.Equal(t, []string{"Created", "Deleted"}, actions)
+
+	actions, err = user.ParseActions("")
+	require.NoError(t, err)
+	require.Empty(t, actions)
+
+	_, err = user.ParseActions("Created,Destroyed")
+	require.Error(t, err)
+}
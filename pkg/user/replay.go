@@ -0,0 +1,41 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/telemetry"
+	"go.opentelemetry.io/otel"
+)
+
+// ReplayUserEvents publishes the current state of the user identified by ref again, with the Replayed action, so that
+// consumers which have lost data about the user can recover it. The user is not changed. Earlier events cannot be
+// replayed, since events are removed from the store once they have been published. It returns ErrNotFound if there
+// is no such user, and ErrInvalidVersion if the user changed while the event was added, in which case the event for
+// that change carries the current state
+func (service *Service) ReplayUserEvents(ctx context.Context, ref *Ref) (usr User, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "ReplayUserEvents")
+	defer span.End()
+
+	if err = service.validate.Struct(ref); err != nil {
+		return usr, invalidError(err)
+	}
+
+	rec, err := service.store.Replay(ctx, uuid.MustParse(ref.ID)) // the id has already been validated
+	if err != nil {
+		switch {
+		case errors.Is(err, userstore.ErrNotFound):
+			return usr, ErrNotFound
+		case errors.Is(err, userstore.ErrInvalidVersion):
+			return usr, ErrInvalidVersion
+		case errors.Is(err, userstore.ErrTooManyEvents):
+			return usr, ErrUnavailable
+		}
+		span.RecordError(err)
+		return usr, fmt.Errorf("cannot replay user events in store: %w", err)
+	}
+	return copyStoreUserToUser(&rec), nil
+}
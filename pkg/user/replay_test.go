@@ -0,0 +1,63 @@
+package user_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/user"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplayUserEventsCallsStoreWithCorrectParameters(t *testing.T) {
+	userRef := fakeUserRef()
+	rec := fakeUserRecord()
+	storeStub := newStubUserStore()
+	storeStub.stubReplay = func(_ context.Context, id uuid.UUID) (userstore.User, error) {
+		require.Equal(t, userRef.ID, id.String())
+		return rec, nil
+	}
+	withService(storeStub)(func(service *user.Service) {
+		usr, err := service.ReplayUserEvents(context.Background(), &userRef)
+		require.NoError(t, err)
+		require.Equal(t, rec.ID, usr.ID)
+		require.Equal(t, rec.Version, usr.Version)
+	})
+}
+
+func TestReplayUserEventsReturnsErrorWhenRefIsInvalid(t *testing.T) {
+	userRef := user.Ref{ID: "not a uuid"}
+	withService(newStubUserStore())(func(service *user.Service) {
+		_, err := service.ReplayUserEvents(context.Background(), &userRef)
+		require.ErrorIs(t, err, user.ErrInvalid)
+	})
+}
+
+func TestReplayUserEventsReturnsCorrectErrorWhenStoreReplayFails(t *testing.T) {
+	unexpected := errors.New("some unexpected error")
+	cases := []struct {
+		name     string
+		expected error
+		result   error
+	}{
+		{name: "Not Found", expected: user.ErrNotFound, result: userstore.ErrNotFound},
+		{name: "Invalid Version", expected: user.ErrInvalidVersion, result: userstore.ErrInvalidVersion},
+		{name: "Unexpected error included in chain", expected: unexpected, result: unexpected},
+	}
+	for _, c := range cases {
+		thisCase := c
+		t.Run(thisCase.name, func(t *testing.T) {
+			userRef := fakeUserRef()
+			storeStub := newStubUserStore()
+			storeStub.stubReplay = func(context.Context, uuid.UUID) (userstore.User, error) {
+				return userstore.User{}, thisCase.result
+			}
+			withService(storeStub)(func(service *user.Service) {
+				_, err := service.ReplayUserEvents(context.Background(), &userRef)
+				require.ErrorIs(t, err, thisCase.expected)
+			})
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/telemetry"
+	"github.com/robotlovesyou/fitest/pkg/utctime"
+	"go.opentelemetry.io/otel"
+)
+
+const (
+	// ResetTokenTTL is how long a password reset token can be used for after it is issued. It should be configurable
+	ResetTokenTTL = time.Hour
+)
+
+// ErrInvalidResetToken is returned when a password reset token does not exist, has expired or has already been used
+var ErrInvalidResetToken = errors.New("password reset token is invalid or has expired")
+
+// PasswordReset is a request to reset the password of a user with a token issued by RequestPasswordReset
+type PasswordReset struct {
+	Token           string `validate:"required"`
+	Password        string `validate:"min=10"`
+	ConfirmPassword string `validate:"required,eqfield=Password"`
+}
+
+// RequestPasswordReset issues a single use password reset token to the user with the email address email, replacing
+// any token issued before. The token expires after ResetTokenTTL. It is published with the PasswordResetRequested
+// action, for the mailer to send to the user, and is not returned to the caller.
+// No error is returned when the email address is unknown, so that it cannot be used to discover which email
+// addresses are registered
+func (service *Service) RequestPasswordReset(ctx context.Context, email string) error {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "RequestPasswordReset")
+	defer span.End()
+
+	rec, err := service.store.FindByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, userstore.ErrNotFound) {
+			return nil
+		}
+		span.RecordError(err)
+		return fmt.Errorf("cannot find user by email: %w", err)
+	}
+
+	token, err := newToken()
+	if err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("cannot generate password reset token: %w", err)
+	}
+	err = service.store.RequestPasswordReset(ctx, rec.ID, token, userstore.ResetToken{
+		Hash:      hashToken(token),
+		ExpiresAt: utctime.Now().Add(ResetTokenTTL),
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, userstore.ErrNotFound):
+			// the user was deleted since it was found
+			return nil
+		case errors.Is(err, userstore.ErrTooManyEvents):
+			return ErrUnavailable
+		}
+		span.RecordError(err)
+		return fmt.Errorf("cannot store password reset token: %w", err)
+	}
+	return nil
+}
+
+// ResetPassword sets the password of the user a password reset token was issued to, if the request is valid.
+// It returns ErrInvalidResetToken if the token does not exist, has expired or has already been used.
+// The change is published with the PasswordChanged action, as ChangePassword does
+func (service *Service) ResetPassword(ctx context.Context, reset *PasswordReset) (usr User, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "ResetPassword")
+	defer span.End()
+
+	if err = service.validate.Struct(reset); err != nil {
+		err = invalidError(err)
+		service.logger.Errorf(ctx, err, "cannot reset password with invalid request")
+		return usr, err
+	}
+
+	passwordHash, err := service.hasher.Hash(reset.Password)
+	if err != nil {
+		return usr, fmt.Errorf("cannot hash password: %w", err)
+	}
+
+	rec, err := service.store.ResetPassword(ctx, hashToken(reset.Token), passwordHash)
+	if err != nil {
+		switch {
+		case errors.Is(err, userstore.ErrInvalidResetToken):
+			return usr, ErrInvalidResetToken
+		case errors.Is(err, userstore.ErrTooManyEvents):
+			return usr, ErrUnavailable
+		}
+		span.RecordError(err)
+		return usr, fmt.Errorf("unexpected error resetting password in user store: %w", err)
+	}
+	return copyStoreUserToUser(&rec), nil
+}
@@ -0,0 +1,115 @@
+package user_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/user"
+	"github.com/stretchr/testify/require"
+)
+
+func hashOf(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func fakePasswordReset() user.PasswordReset {
+	return user.PasswordReset{
+		Token:           "token",
+		Password:        "newpassword123",
+		ConfirmPassword: "newpassword123",
+	}
+}
+
+func TestRequestPasswordResetStoresHashOfExpiringToken(t *testing.T) {
+	storeStub, rec := storeWithPassword(t, testPassword)
+	called := false
+	storeStub.stubRequestPasswordReset = func(_ context.Context, id uuid.UUID, token string, reset userstore.ResetToken) error {
+		called = true
+		require.True(t, compareIDs(rec.ID, id))
+		require.NotEmpty(t, token)
+		require.Equal(t, hashOf(token), reset.Hash)
+		require.WithinDuration(t, time.Now().Add(user.ResetTokenTTL), reset.ExpiresAt, time.Minute)
+		return nil
+	}
+	withService(storeStub)(func(service *user.Service) {
+		require.NoError(t, service.RequestPasswordReset(context.Background(), rec.Email))
+		require.True(t, called)
+	})
+}
+
+func TestRequestPasswordResetDoesNotRevealUnknownEmail(t *testing.T) {
+	storeStub, _ := storeWithPassword(t, testPassword)
+	withService(storeStub)(func(service *user.Service) {
+		require.NoError(t, service.RequestPasswordReset(context.Background(), "unknown@example.com"))
+	})
+}
+
+func TestOriginalErrorIsInChainWhenStoreRequestPasswordResetReturnsError(t *testing.T) {
+	unexpected := errors.New("some unexpected error")
+	storeStub, rec := storeWithPassword(t, testPassword)
+	storeStub.stubRequestPasswordReset = func(context.Context, uuid.UUID, string, userstore.ResetToken) error {
+		return unexpected
+	}
+	withService(storeStub)(func(service *user.Service) {
+		err := service.RequestPasswordReset(context.Background(), rec.Email)
+		require.ErrorIs(t, err, unexpected)
+	})
+}
+
+func TestResetPasswordStoresHashOfNewPassword(t *testing.T) {
+	rec := fakeUserRecord()
+	reset := fakePasswordReset()
+	storeStub := newStubUserStore()
+	storeStub.stubResetPassword = func(_ context.Context, tokenHash, passwordHash string) (userstore.User, error) {
+		require.Equal(t, hashOf(reset.Token), tokenHash)
+		require.True(t, checkPasswordHash(passwordHash, reset.Password))
+		rec.PasswordHash = passwordHash
+		rec.Version += 1
+		return rec, nil
+	}
+	withService(storeStub)(func(service *user.Service) {
+		usr, err := service.ResetPassword(context.Background(), &reset)
+		require.NoError(t, err)
+		require.Equal(t, rec.Version, usr.Version)
+	})
+}
+
+func TestCannotResetPasswordWithInvalidToken(t *testing.T) {
+	reset := fakePasswordReset()
+	storeStub := newStubUserStore()
+	storeStub.stubResetPassword = func(context.Context, string, string) (userstore.User, error) {
+		return userstore.User{}, userstore.ErrInvalidResetToken
+	}
+	withService(storeStub)(func(service *user.Service) {
+		_, err := service.ResetPassword(context.Background(), &reset)
+		require.ErrorIs(t, err, user.ErrInvalidResetToken)
+	})
+}
+
+func TestCannotResetPasswordWithInvalidRequest(t *testing.T) {
+	cases := []struct {
+		name   string
+		mutate func(*user.PasswordReset)
+	}{
+		{name: "missing token", mutate: func(r *user.PasswordReset) { r.Token = "" }},
+		{name: "short password", mutate: func(r *user.PasswordReset) { r.Password, r.ConfirmPassword = "short", "short" }},
+		{name: "mismatched confirmation", mutate: func(r *user.PasswordReset) { r.ConfirmPassword = "differentpassword" }},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			reset := fakePasswordReset()
+			c.mutate(&reset)
+			withService(newStubUserStore())(func(service *user.Service) {
+				_, err := service.ResetPassword(context.Background(), &reset)
+				require.ErrorIs(t, err, user.ErrInvalid)
+			})
+		})
+	}
+}
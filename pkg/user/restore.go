@@ -0,0 +1,66 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/telemetry"
+	"go.opentelemetry.io/otel"
+)
+
+const (
+	// PurgeInterval is the time between purges of soft deleted users. It should be configurable
+	PurgeInterval = time.Hour
+)
+
+// Restore restores the deleted user identified by ref, if the store soft deletes users and the retention period
+// has not passed. It returns ErrNotFound if there is no such user. The restore is published with the Restored action
+func (service *Service) Restore(ctx context.Context, ref *Ref) (usr User, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "Restore")
+	defer span.End()
+
+	if err = service.validate.Struct(ref); err != nil {
+		return usr, invalidError(err)
+	}
+
+	rec, err := service.store.Restore(ctx, uuid.MustParse(ref.ID)) // the id has already been validated
+	if err != nil {
+		switch {
+		case errors.Is(err, userstore.ErrNotFound):
+			return usr, ErrNotFound
+		case errors.Is(err, userstore.ErrTooManyEvents):
+			return usr, ErrUnavailable
+		}
+		span.RecordError(err)
+		return usr, fmt.Errorf("cannot restore user in store: %w", err)
+	}
+	return copyStoreUserToUser(&rec), nil
+}
+
+// PurgeEvery irrecoverably deletes the soft deleted users whose retention period has passed every interval, until
+// ctx is done. It blocks, so should be run in a separate goroutine
+func (service *Service) PurgeEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		// For most tracing I am not recording the user service functions, but this is the root of the purge calls
+		ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "PurgingDeletedUsers")
+		purged, err := service.store.Purge(ctx)
+		if err != nil {
+			span.RecordError(err)
+			service.logger.Errorf(ctx, err, "error purging deleted users")
+		} else if purged > 0 {
+			service.logger.Infof(ctx, "purged %d deleted users", purged)
+		}
+		span.End()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
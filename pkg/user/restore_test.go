@@ -0,0 +1,92 @@
+package user_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/user"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRestoreCallsStoreWithCorrectParameters(t *testing.T) {
+	userRef := fakeUserRef()
+	rec := fakeUserRecord()
+	storeStub := newStubUserStore()
+	storeStub.stubRestore = func(_ context.Context, id uuid.UUID) (userstore.User, error) {
+		require.Equal(t, userRef.ID, id.String())
+		return rec, nil
+	}
+	withService(storeStub)(func(service *user.Service) {
+		usr, err := service.Restore(context.Background(), &userRef)
+		require.NoError(t, err)
+		require.Equal(t, rec.ID, usr.ID)
+	})
+}
+
+func TestRestoreReturnsErrorWhenRefIsInvalid(t *testing.T) {
+	userRef := user.Ref{ID: "not a uuid"}
+	withService(newStubUserStore())(func(service *user.Service) {
+		_, err := service.Restore(context.Background(), &userRef)
+		require.ErrorIs(t, err, user.ErrInvalid)
+	})
+}
+
+func TestRestoreReturnsCorrectErrorWhenStoreRestoreFails(t *testing.T) {
+	unexpected := errors.New("some unexpected error")
+	cases := []struct {
+		name     string
+		expected error
+		result   error
+	}{
+		{name: "Not Found", expected: user.ErrNotFound, result: userstore.ErrNotFound},
+		{name: "Unexpected error included in chain", expected: unexpected, result: unexpected},
+	}
+	for _, c := range cases {
+		thisCase := c
+		t.Run(thisCase.name, func(t *testing.T) {
+			userRef := fakeUserRef()
+			storeStub := newStubUserStore()
+			storeStub.stubRestore = func(context.Context, uuid.UUID) (userstore.User, error) {
+				return userstore.User{}, thisCase.result
+			}
+			withService(storeStub)(func(service *user.Service) {
+				_, err := service.Restore(context.Background(), &userRef)
+				require.ErrorIs(t, err, thisCase.expected)
+			})
+		})
+	}
+}
+
+func TestPurgeEveryPurgesUntilContextIsDone(t *testing.T) {
+	storeStub := newStubUserStore()
+	purges := make(chan struct{}, 10)
+	storeStub.stubPurge = func(context.Context) (int64, error) {
+		purges <- struct{}{}
+		return 1, nil
+	}
+	withService(storeStub)(func(service *user.Service) {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			service.PurgeEvery(ctx, 10*time.Millisecond)
+			close(done)
+		}()
+		for i := 0; i < 2; i++ {
+			select {
+			case <-purges:
+			case <-time.After(time.Second):
+				t.Fatal("deleted users were not purged")
+			}
+		}
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("purging did not stop when the context was done")
+		}
+	})
+}
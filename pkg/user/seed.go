@@ -0,0 +1,108 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+
+	"github.com/bxcodec/faker/v3"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/telemetry"
+	"go.opentelemetry.io/otel"
+)
+
+const (
+	// DefaultSeedPassword is the password of seeded users when SeedOptions do not give one
+	DefaultSeedPassword = "password123"
+	// SeedEmailDomain is the domain of the email addresses of seeded users. It is in the reserved .invalid top level
+	// domain, so that no mail is sent to the addresses, which may belong to real people in other domains
+	SeedEmailDomain = "example.invalid"
+)
+
+// DefaultSeedCountries are the countries seeded users are registered in when SeedOptions do not give any
+var DefaultSeedCountries = []string{"DE", "FR", "GB", "ES", "IT", "NL", "US"}
+
+// SeedOptions configure the users created by Seed
+type SeedOptions struct {
+	// Password is the password of every seeded user, so that developers can authenticate as any of them
+	Password string
+	// Countries are the countries seeded users are registered in, chosen at random for each user
+	Countries []string
+}
+
+// withDefaults returns the options with the defaults set for any which are not set
+func (opts SeedOptions) withDefaults() SeedOptions {
+	if opts.Password == "" {
+		opts.Password = DefaultSeedPassword
+	}
+	if len(opts.Countries) == 0 {
+		opts.Countries = DefaultSeedCountries
+	}
+	return opts
+}
+
+// Seed creates n users with fake names, nicknames and email addresses in SeedEmailDomain, for filling the store of a
+// development environment. The users are validated, and checked by the BeforeCreate hooks, as Create checks new users, and an error
+// is returned for the first user which is not valid, since the options are then wrong. Users are stored in batches of
+// ImportBatchSize, and users which conflict with an existing user are skipped, so fewer than n users may be created.
+// The number of users created is returned
+func (service *Service) Seed(ctx context.Context, n int, opts SeedOptions) (created int, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "Seed")
+	defer span.End()
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+		}
+	}()
+
+	opts = opts.withDefaults()
+	// every seeded user has the same password, so it is only hashed once
+	passwordHash, err := service.hasher.Hash(opts.Password)
+	if err != nil {
+		return 0, fmt.Errorf("cannot hash password: %w", err)
+	}
+
+	report := ImportReport{}
+	batch := make([]importRow, 0, ImportBatchSize)
+	for i := 0; i < n; i++ {
+		row := importRow{line: i + 1}
+		if row.user, err = service.seedUser(ctx, &opts, passwordHash); err != nil {
+			return report.Imported, err
+		}
+		batch = append(batch, row)
+		if len(batch) == ImportBatchSize || i == n-1 {
+			if err = service.storeImportBatch(ctx, batch, &report); err != nil {
+				return report.Imported, err
+			}
+			batch = batch[:0]
+		}
+	}
+	return report.Imported, nil
+}
+
+// seedUser returns a user with fake details to store for Seed
+func (service *Service) seedUser(ctx context.Context, opts *SeedOptions, passwordHash string) (*userstore.User, error) {
+	id, err := service.idGenerator()
+	if err != nil {
+		return nil, fmt.Errorf("cannot generate uuid: %w", err)
+	}
+	// fake usernames are often repeated, so part of the id is added to make them unique
+	nickname := fmt.Sprintf("%s_%s", faker.Username(), id.String()[:8])
+	newUser := NewUser{
+		FirstName:       faker.FirstName(),
+		LastName:        faker.LastName(),
+		Nickname:        nickname,
+		Password:        opts.Password,
+		ConfirmPassword: opts.Password,
+		Email:           fmt.Sprintf("%s@%s", strings.ToLower(nickname), SeedEmailDomain),
+		Country:         opts.Countries[rand.Intn(len(opts.Countries))],
+	}
+	if err = service.validate.Struct(&newUser); err != nil {
+		return nil, invalidError(err)
+	}
+	if err = service.beforeCreate(ctx, &newUser); err != nil {
+		return nil, err
+	}
+	return newStoreUser(id, &newUser, passwordHash), nil
+}
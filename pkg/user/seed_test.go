@@ -0,0 +1,70 @@
+package user_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/user"
+	"github.com/robotlovesyou/fitest/pkg/validation"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeedCreatesValidUsersInBatches(t *testing.T) {
+	n := user.ImportBatchSize + 1
+	storeStub, results := importingStore()
+	withService(storeStub, useHasher(prefixHasher{}))(func(service *user.Service) {
+		created, err := service.Seed(context.Background(), n, user.SeedOptions{Countries: []string{"FR"}})
+		require.NoError(t, err)
+		require.Equal(t, n, created)
+		batches, users := results()
+		require.Len(t, batches, 2)
+		nicknames := make(map[string]bool, len(users))
+		for _, usr := range users {
+			require.Equal(t, "hashed:"+user.DefaultSeedPassword, usr.PasswordHash)
+			require.Equal(t, "FR", usr.Country)
+			require.NotEmpty(t, usr.FirstName)
+			require.True(t, strings.HasSuffix(usr.Email, "@"+user.SeedEmailDomain))
+			nicknames[usr.Nickname] = true
+		}
+		require.Len(t, nicknames, n, "seeded users have unique nicknames")
+	})
+}
+
+func TestSeedSkipsUsersWhichAlreadyExist(t *testing.T) {
+	storeStub, _ := importingStore()
+	storeStub.stubCreateMany = func(_ context.Context, users []userstore.User) ([]error, error) {
+		errs := make([]error, len(users))
+		errs[0] = userstore.ErrNicknameInUse
+		return errs, nil
+	}
+	withService(storeStub)(func(service *user.Service) {
+		created, err := service.Seed(context.Background(), 3, user.SeedOptions{})
+		require.NoError(t, err)
+		require.Equal(t, 2, created)
+	})
+}
+
+func TestSeedFailsWithInvalidOptions(t *testing.T) {
+	cases := []struct {
+		name string
+		opts user.SeedOptions
+	}{
+		{name: "short password", opts: user.SeedOptions{Password: "short"}},
+		{name: "disallowed country", opts: user.SeedOptions{Countries: []string{"GB"}}},
+	}
+	for _, c := range cases {
+		thisCase := c
+		t.Run(thisCase.name, func(t *testing.T) {
+			storeStub, results := importingStore()
+			withService(storeStub, useCountries(validation.CountryList{Allow: []string{"DE"}}))(func(service *user.Service) {
+				_, err := service.Seed(context.Background(), 1, thisCase.opts)
+				var invalid *user.InvalidError
+				require.ErrorAs(t, err, &invalid)
+				batches, _ := results()
+				require.Empty(t, batches)
+			})
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package user
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/telemetry"
+	"go.opentelemetry.io/otel"
+)
+
+const (
+	// DefaultStatsInterval is the interval in which signups are counted when a StatsQuery does not give one
+	DefaultStatsInterval = "day"
+)
+
+// StatsQuery selects the users counted by Stats. Its filters match users as the fields of a Query with the same
+// names do
+type StatsQuery struct {
+	CreatedAfter  string   `validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	CreatedBefore string   `validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	Country       string   `validate:"omitempty,iso3166_1_alpha2"`
+	Countries     []string `validate:"max=250,dive,iso3166_1_alpha2"`
+	Status        string   `validate:"omitempty,oneof=active suspended banned dormant"`
+	// Interval is the length of the periods signups are counted in. It must be empty, to count signups per day, or
+	// one of day, week or month
+	Interval string `validate:"omitempty,oneof=day week month"`
+}
+
+// CountryCount is the number of users living in a country
+type CountryCount struct {
+	Country string
+	Total   int64
+}
+
+// SignupCount is the number of users who signed up in the period which starts at Start. Start is formatted with
+// TimeFormat. Days and months start at midnight UTC, and weeks start on Monday
+type SignupCount struct {
+	Start string
+	Total int64
+}
+
+// Stats are the numbers of users matching a StatsQuery
+type Stats struct {
+	Total int64
+	// Countries are ordered by country code. Countries without users are omitted
+	Countries []CountryCount
+	// Signups are ordered by the start of their period. Periods without signups are omitted
+	Signups []SignupCount
+}
+
+// Stats counts the users matching the given query, in total, by country and by the period in which they signed up,
+// so that dashboards do not have to page through every user to compute totals
+func (service *Service) Stats(ctx context.Context, query *StatsQuery) (Stats, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "Stats")
+	defer span.End()
+
+	if err := service.validate.Struct(query); err != nil {
+		span.RecordError(err)
+		return Stats{}, invalidError(err)
+	}
+	q, err := service.storeQuery(&Query{
+		CreatedAfter:  query.CreatedAfter,
+		CreatedBefore: query.CreatedBefore,
+		Country:       query.Country,
+		Countries:     query.Countries,
+		Status:        query.Status,
+	})
+	if err != nil {
+		span.RecordError(err)
+		return Stats{}, err
+	}
+	interval := query.Interval
+	if interval == "" {
+		interval = DefaultStatsInterval
+	}
+	stats, err := service.store.Stats(ctx, q, userstore.StatsInterval(interval))
+	if err != nil {
+		span.RecordError(err)
+		return Stats{}, fmt.Errorf("cannot count users in store: %w", err)
+	}
+	result := Stats{
+		Total:     stats.Total,
+		Countries: make([]CountryCount, 0, len(stats.Countries)),
+		Signups:   make([]SignupCount, 0, len(stats.Signups)),
+	}
+	for _, c := range stats.Countries {
+		result.Countries = append(result.Countries, CountryCount{Country: c.Country, Total: c.Total})
+	}
+	for _, s := range stats.Signups {
+		result.Signups = append(result.Signups, SignupCount{Start: s.Start.UTC().Format(TimeFormat), Total: s.Total})
+	}
+	return result, nil
+}
@@ -0,0 +1,101 @@
+package user_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/user"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsPassesQueryToStoreAndConvertsResult(t *testing.T) {
+	start := time.Date(2022, 4, 4, 0, 0, 0, 0, time.UTC)
+	query := user.StatsQuery{
+		CreatedAfter:  start.Format(user.TimeFormat),
+		CreatedBefore: start.Add(7 * 24 * time.Hour).Format(user.TimeFormat),
+		Country:       "DE",
+		Countries:     []string{"NL"},
+		Status:        user.StatusActive,
+		Interval:      "week",
+	}
+	storeStub := newStubUserStore()
+	withService(storeStub)(func(service *user.Service) {
+		storeStub.stubStats = func(ctx context.Context, q *userstore.Query, interval userstore.StatsInterval) (userstore.Stats, error) {
+			require.Equal(t, query.CreatedAfter, q.CreatedAfter.Format(user.TimeFormat))
+			require.Equal(t, query.CreatedBefore, q.CreatedBefore.Format(user.TimeFormat))
+			require.Equal(t, []string{"DE", "NL"}, q.Countries)
+			require.Equal(t, userstore.StatusActive, q.Status)
+			require.Equal(t, userstore.IntervalWeek, interval)
+			return userstore.Stats{
+				Total:     3,
+				Countries: []userstore.CountryCount{{Country: "DE", Total: 1}, {Country: "NL", Total: 2}},
+				Signups:   []userstore.SignupCount{{Start: start, Total: 3}},
+			}, nil
+		}
+		stats, err := service.Stats(context.Background(), &query)
+		require.NoError(t, err)
+		require.Equal(t, user.Stats{
+			Total:     3,
+			Countries: []user.CountryCount{{Country: "DE", Total: 1}, {Country: "NL", Total: 2}},
+			Signups:   []user.SignupCount{{Start: "2022-04-04T00:00:00Z", Total: 3}},
+		}, stats)
+	})
+}
+
+func TestStatsCountsSignupsPerDayByDefault(t *testing.T) {
+	storeStub := newStubUserStore()
+	withService(storeStub)(func(service *user.Service) {
+		storeStub.stubStats = func(ctx context.Context, q *userstore.Query, interval userstore.StatsInterval) (userstore.Stats, error) {
+			require.Empty(t, q.Countries)
+			require.Equal(t, userstore.IntervalDay, interval)
+			return userstore.Stats{}, nil
+		}
+		stats, err := service.Stats(context.Background(), &user.StatsQuery{})
+		require.NoError(t, err)
+		require.Zero(t, stats.Total)
+		require.Empty(t, stats.Countries)
+		require.Empty(t, stats.Signups)
+	})
+}
+
+func TestCannotGetStatsWithInvalidQuery(t *testing.T) {
+	cases := []struct {
+		name  string
+		query user.StatsQuery
+		field string
+	}{
+		{name: "badly formatted created after", query: user.StatsQuery{CreatedAfter: "yesterday"}, field: "CreatedAfter"},
+		{name: "badly formatted created before", query: user.StatsQuery{CreatedBefore: "tomorrow"}, field: "CreatedBefore"},
+		{name: "unknown country", query: user.StatsQuery{Country: "XX"}, field: "Country"},
+		{name: "unknown country in countries", query: user.StatsQuery{Countries: []string{"XX"}}, field: "Countries[0]"},
+		{name: "unknown status", query: user.StatsQuery{Status: "deleted"}, field: "Status"},
+		{name: "unknown interval", query: user.StatsQuery{Interval: "year"}, field: "Interval"},
+	}
+	for _, c := range cases {
+		thisCase := c
+		t.Run(thisCase.name, func(t *testing.T) {
+			withService(newStubUserStore())(func(service *user.Service) {
+				_, err := service.Stats(context.Background(), &thisCase.query)
+				require.ErrorIs(t, err, user.ErrInvalid)
+				var invalid *user.InvalidError
+				require.ErrorAs(t, err, &invalid)
+				require.Equal(t, thisCase.field, invalid.Violations[0].Field)
+			})
+		})
+	}
+}
+
+func TestOriginalErrorIsInChainWhenStoreStatsReturnsError(t *testing.T) {
+	unexpected := errors.New("some unexpected error")
+	storeStub := newStubUserStore()
+	withService(storeStub)(func(service *user.Service) {
+		storeStub.stubStats = func(context.Context, *userstore.Query, userstore.StatsInterval) (userstore.Stats, error) {
+			return userstore.Stats{}, unexpected
+		}
+		_, err := service.Stats(context.Background(), &user.StatsQuery{})
+		require.ErrorIs(t, err, unexpected)
+	})
+}
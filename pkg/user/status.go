@@ -0,0 +1,113 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/telemetry"
+	"github.com/robotlovesyou/fitest/pkg/utctime"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Statuses of users
+const (
+	StatusActive    = string(userstore.StatusActive)
+	StatusSuspended = string(userstore.StatusSuspended)
+	StatusBanned    = string(userstore.StatusBanned)
+	StatusDormant   = string(userstore.StatusDormant)
+)
+
+// ErrInvalidTransition is returned when the status of a user cannot be changed to the requested status from their
+// current status
+var ErrInvalidTransition = errors.New("user status cannot be changed")
+
+// statusOf returns the status of a stored user. Users stored before users had a status are active
+func statusOf(status userstore.Status) string {
+	if status == "" {
+		return StatusActive
+	}
+	return string(status)
+}
+
+// Suspend suspends the active user identified by ref. Suspended users cannot authenticate until they are
+// reactivated. It returns ErrNotFound if there is no such user and ErrInvalidTransition if the user is not active.
+// The change is published with the Suspended action
+func (service *Service) Suspend(ctx context.Context, ref *Ref) (User, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "Suspend")
+	defer span.End()
+	return service.changeStatus(ctx, ref, StatusSuspended, StatusActive)
+}
+
+// Reactivate makes the suspended or dormant user identified by ref active again. It returns ErrNotFound if there is no
+// such user and ErrInvalidTransition if the user is not suspended or dormant. The change is published with the
+// Reactivated action
+func (service *Service) Reactivate(ctx context.Context, ref *Ref) (User, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "Reactivate")
+	defer span.End()
+	return service.changeStatus(ctx, ref, StatusActive, StatusSuspended, StatusDormant)
+}
+
+// Ban bans the active, suspended or dormant user identified by ref. Banned users cannot authenticate, and cannot be
+// reactivated. It returns ErrNotFound if there is no such user and ErrInvalidTransition if the user is already banned.
+// The change is published with the Banned action
+func (service *Service) Ban(ctx context.Context, ref *Ref) (User, error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "Ban")
+	defer span.End()
+	return service.changeStatus(ctx, ref, StatusBanned, StatusActive, StatusSuspended, StatusDormant)
+}
+
+// changeStatus changes the status of the user identified by ref to status, provided their current status is one of
+// from
+func (service *Service) changeStatus(ctx context.Context, ref *Ref, status string, from ...string) (usr User, err error) {
+	span := trace.SpanFromContext(ctx)
+
+	if err = service.validate.Struct(ref); err != nil {
+		return usr, invalidError(err)
+	}
+
+	id := uuid.MustParse(ref.ID) // ok to call function which can panic because id has already been validated as a uuid
+
+	rec, err := service.store.ReadOne(ctx, id)
+	if err != nil {
+		if errors.Is(err, userstore.ErrNotFound) {
+			return usr, ErrNotFound
+		}
+		span.RecordError(err)
+		return usr, fmt.Errorf("unexpected error reading user store: %w", err)
+	}
+	if !allowedTransition(statusOf(rec.Status), from) {
+		return usr, ErrInvalidTransition
+	}
+
+	rec.Status = userstore.Status(status)
+	rec.UpdatedAt = utctime.Now()
+
+	rec, err = service.store.ChangeStatus(ctx, &rec)
+	if err != nil {
+		switch {
+		case errors.Is(err, userstore.ErrNotFound):
+			return usr, ErrNotFound
+		case errors.Is(err, userstore.ErrInvalidVersion):
+			return usr, ErrInvalidVersion
+		case errors.Is(err, userstore.ErrTooManyEvents):
+			return usr, ErrUnavailable
+		default:
+			span.RecordError(err)
+			return usr, fmt.Errorf("unexpected error changing user status in user store: %w", err)
+		}
+	}
+	return copyStoreUserToUser(&rec), nil
+}
+
+func allowedTransition(current string, from []string) bool {
+	for _, status := range from {
+		if current == status {
+			return true
+		}
+	}
+	return false
+}
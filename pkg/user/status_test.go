@@ -0,0 +1,101 @@
+package user_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/user"
+	"github.com/stretchr/testify/require"
+)
+
+type statusChange func(*user.Service, context.Context, *user.Ref) (user.User, error)
+
+func TestStatusTransitions(t *testing.T) {
+	cases := []struct {
+		name     string
+		change   statusChange
+		from     userstore.Status
+		expected string
+		err      error
+	}{
+		{name: "suspend active", change: (*user.Service).Suspend, from: userstore.StatusActive, expected: user.StatusSuspended},
+		{name: "suspend user without status", change: (*user.Service).Suspend, from: "", expected: user.StatusSuspended},
+		{name: "suspend suspended", change: (*user.Service).Suspend, from: userstore.StatusSuspended, err: user.ErrInvalidTransition},
+		{name: "suspend banned", change: (*user.Service).Suspend, from: userstore.StatusBanned, err: user.ErrInvalidTransition},
+		{name: "suspend dormant", change: (*user.Service).Suspend, from: userstore.StatusDormant, err: user.ErrInvalidTransition},
+		{name: "reactivate suspended", change: (*user.Service).Reactivate, from: userstore.StatusSuspended, expected: user.StatusActive},
+		{name: "reactivate active", change: (*user.Service).Reactivate, from: userstore.StatusActive, err: user.ErrInvalidTransition},
+		{name: "reactivate banned", change: (*user.Service).Reactivate, from: userstore.StatusBanned, err: user.ErrInvalidTransition},
+		{name: "reactivate dormant", change: (*user.Service).Reactivate, from: userstore.StatusDormant, expected: user.StatusActive},
+		{name: "ban active", change: (*user.Service).Ban, from: userstore.StatusActive, expected: user.StatusBanned},
+		{name: "ban suspended", change: (*user.Service).Ban, from: userstore.StatusSuspended, expected: user.StatusBanned},
+		{name: "ban dormant", change: (*user.Service).Ban, from: userstore.StatusDormant, expected: user.StatusBanned},
+		{name: "ban banned", change: (*user.Service).Ban, from: userstore.StatusBanned, err: user.ErrInvalidTransition},
+	}
+	for _, c := range cases {
+		thisCase := c
+		t.Run(thisCase.name, func(t *testing.T) {
+			rec := fakeUserRecord(func(r *userstore.User) { r.Status = thisCase.from })
+			storeStub := newStubUserStore()
+			storeStub.stubReadOne = func(context.Context, uuid.UUID) (userstore.User, error) {
+				return rec, nil
+			}
+			storeStub.stubChangeStatus = func(_ context.Context, update *userstore.User) (userstore.User, error) {
+				require.Equal(t, rec.Version, update.Version)
+				require.Equal(t, rec.FirstName, update.FirstName)
+				update.Version += 1
+				return *update, nil
+			}
+			withService(storeStub)(func(service *user.Service) {
+				usr, err := thisCase.change(service, context.Background(), &user.Ref{ID: rec.ID.String()})
+				if thisCase.err != nil {
+					require.ErrorIs(t, err, thisCase.err)
+					return
+				}
+				require.NoError(t, err)
+				require.Equal(t, thisCase.expected, usr.Status)
+				require.Equal(t, rec.Version+1, usr.Version)
+			})
+		})
+	}
+}
+
+func TestChangeStatusReturnsErrorWhenRefIsInvalid(t *testing.T) {
+	withService(newStubUserStore())(func(service *user.Service) {
+		_, err := service.Suspend(context.Background(), &user.Ref{ID: "not a uuid"})
+		require.ErrorIs(t, err, user.ErrInvalid)
+	})
+}
+
+func TestChangeStatusReturnsCorrectErrorWhenStoreFails(t *testing.T) {
+	unexpected := errors.New("some unexpected error")
+	cases := []struct {
+		name     string
+		expected error
+		result   error
+	}{
+		{name: "Not Found", expected: user.ErrNotFound, result: userstore.ErrNotFound},
+		{name: "Invalid Version", expected: user.ErrInvalidVersion, result: userstore.ErrInvalidVersion},
+		{name: "Unexpected error included in chain", expected: unexpected, result: unexpected},
+	}
+	for _, c := range cases {
+		thisCase := c
+		t.Run(thisCase.name, func(t *testing.T) {
+			userRef := fakeUserRef()
+			storeStub := newStubUserStore()
+			storeStub.stubReadOne = func(context.Context, uuid.UUID) (userstore.User, error) {
+				return fakeUserRecord(), nil
+			}
+			storeStub.stubChangeStatus = func(context.Context, *userstore.User) (userstore.User, error) {
+				return userstore.User{}, thisCase.result
+			}
+			withService(storeStub)(func(service *user.Service) {
+				_, err := service.Ban(context.Background(), &userRef)
+				require.ErrorIs(t, err, thisCase.expected)
+			})
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package user
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+const (
+	// tokenBytes is the number of random bytes in a token sent to a user
+	tokenBytes = 32
+)
+
+// newToken returns a random single use token, to be sent to a user to confirm a request
+func newToken() (string, error) {
+	b := make([]byte, tokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the hash of a token which is stored in place of the token.
+// Tokens are random, so unlike passwords they do not need a slow hash, and a fast hash allows them to be looked up
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,334 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/telemetry"
+	"github.com/robotlovesyou/fitest/pkg/totp"
+	"github.com/robotlovesyou/fitest/pkg/utctime"
+	"go.opentelemetry.io/otel"
+)
+
+const (
+	// RecoveryCodeCount is the number of recovery codes issued when two factor authentication is enabled. It should
+	// be configurable
+	RecoveryCodeCount = 10
+	// recoveryCodeBytes is the number of random bytes in a recovery code, which is 16 characters when base32 encoded
+	recoveryCodeBytes = 10
+	// recoveryCodeGroup is the number of characters between the dashes of a recovery code
+	recoveryCodeGroup = 4
+)
+
+var (
+	// ErrTwoFactorUnavailable is returned when users enroll in two factor authentication but the service has not
+	// been configured with UseTwoFactor
+	ErrTwoFactorUnavailable = errors.New("two factor authentication is not available")
+	// ErrTwoFactorEnabled is returned when a user who already has two factor authentication enabled enrolls again
+	ErrTwoFactorEnabled = errors.New("user already has two factor authentication enabled")
+	// ErrTwoFactorNotEnabled is returned when two factor authentication is disabled for a user who does not have it
+	// enabled
+	ErrTwoFactorNotEnabled = errors.New("user does not have two factor authentication enabled")
+	// ErrTwoFactorNotEnrolled is returned when a user confirms an enrollment in two factor authentication which does
+	// not exist, or has been replaced by a later enrollment
+	ErrTwoFactorNotEnrolled = errors.New("user has no two factor authentication enrollment to confirm")
+	// ErrInvalidTwoFactorCode is returned when a two factor authentication code is incorrect, has already been used or
+	// has expired
+	ErrInvalidTwoFactorCode = errors.New("two factor authentication code is incorrect")
+	// ErrTwoFactorRequired is returned by Authenticate when the password of a user with two factor authentication
+	// enabled is correct, but no code was given
+	ErrTwoFactorRequired = errors.New("two factor authentication code is required")
+)
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// SecretSealer encrypts secrets which are stored by the service, but which the service must be able to read back
+type SecretSealer interface {
+	Seal(plain string) (string, error)
+	Open(sealed string) (string, error)
+}
+
+// TwoFactorConfig configures two factor authentication
+type TwoFactorConfig struct {
+	// Sealer encrypts the secrets of users before they are stored
+	Sealer SecretSealer
+	// Issuer is the name of the service shown by authenticator apps
+	Issuer string
+}
+
+// UseTwoFactor allows users to enroll in two factor authentication. It must be called before the service handles
+// any requests
+func (service *Service) UseTwoFactor(config TwoFactorConfig) {
+	service.twoFactor = config
+}
+
+// TwoFactorEnrollment is the secret of a new enrollment in two factor authentication, and the otpauth URI which
+// authenticator apps read, usually from a QR code, to add it
+type TwoFactorEnrollment struct {
+	Secret string
+	URI    string
+}
+
+// TwoFactorCode is a code from the authenticator app of a user, or one of their recovery codes
+type TwoFactorCode struct {
+	ID   string `validate:"uuid"`
+	Code string `validate:"required,max=32"`
+}
+
+// EnrollTwoFactor starts the enrollment in two factor authentication of the user identified by ref, replacing any
+// enrollment which has not been confirmed. Two factor authentication is not enabled until the enrollment is confirmed
+// with ConfirmTwoFactor. It returns ErrTwoFactorEnabled if the user already has it enabled, and
+// ErrTwoFactorUnavailable if the service has not been configured for it
+func (service *Service) EnrollTwoFactor(ctx context.Context, ref *Ref) (enrollment TwoFactorEnrollment, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "EnrollTwoFactor")
+	defer span.End()
+
+	if service.twoFactor.Sealer == nil {
+		return enrollment, ErrTwoFactorUnavailable
+	}
+	if err = service.validate.Struct(ref); err != nil {
+		return enrollment, invalidError(err)
+	}
+
+	id := uuid.MustParse(ref.ID) // the id has already been validated
+	rec, err := service.store.ReadOne(ctx, id)
+	if err != nil {
+		if errors.Is(err, userstore.ErrNotFound) {
+			return enrollment, ErrNotFound
+		}
+		span.RecordError(err)
+		return enrollment, fmt.Errorf("unexpected error reading user from store: %w", err)
+	}
+	if rec.TwoFactorEnabled {
+		return enrollment, ErrTwoFactorEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		span.RecordError(err)
+		return enrollment, fmt.Errorf("cannot generate two factor secret: %w", err)
+	}
+	sealed, err := service.twoFactor.Sealer.Seal(secret)
+	if err != nil {
+		span.RecordError(err)
+		return enrollment, fmt.Errorf("cannot seal two factor secret: %w", err)
+	}
+	if err = service.store.BeginTwoFactor(ctx, id, sealed); err != nil {
+		switch {
+		case errors.Is(err, userstore.ErrNotFound):
+			return enrollment, ErrNotFound
+		case errors.Is(err, userstore.ErrTwoFactorEnabled):
+			return enrollment, ErrTwoFactorEnabled
+		}
+		span.RecordError(err)
+		return enrollment, fmt.Errorf("cannot store two factor enrollment: %w", err)
+	}
+	return TwoFactorEnrollment{
+		Secret: secret,
+		URI:    totp.URI(service.twoFactor.Issuer, rec.Email, secret),
+	}, nil
+}
+
+// ConfirmTwoFactor enables two factor authentication for a user who has enrolled, if the code is the current code
+// from their authenticator app. It returns RecoveryCodeCount single use recovery codes, which can be used in place of
+// a code if the user loses their authenticator app. Only their hashes are stored, so they cannot be shown again.
+// The change is published with the TwoFactorEnabled action. It returns ErrTwoFactorNotEnrolled if the user has not
+// enrolled, and ErrInvalidTwoFactorCode if the code is incorrect
+func (service *Service) ConfirmTwoFactor(ctx context.Context, code *TwoFactorCode) (recoveryCodes []string, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "ConfirmTwoFactor")
+	defer span.End()
+
+	if service.twoFactor.Sealer == nil {
+		return nil, ErrTwoFactorUnavailable
+	}
+	if err = service.validate.Struct(code); err != nil {
+		return nil, invalidError(err)
+	}
+
+	id := uuid.MustParse(code.ID) // the id has already been validated
+	rec, err := service.readTwoFactorRecord(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if rec.Data.TwoFactorEnabled {
+		return nil, ErrTwoFactorEnabled
+	}
+	if rec.TwoFactor == nil || rec.TwoFactor.PendingSecret == "" {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+
+	secret, err := service.twoFactor.Sealer.Open(rec.TwoFactor.PendingSecret)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("cannot open two factor secret: %w", err)
+	}
+	step, ok, err := totp.Validate(secret, code.Code, utctime.Now())
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("cannot validate two factor code: %w", err)
+	}
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	recoveryCodes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("cannot generate recovery codes: %w", err)
+	}
+	if _, err = service.store.EnableTwoFactor(ctx, id, rec.TwoFactor.PendingSecret, step, hashes); err != nil {
+		switch {
+		case errors.Is(err, userstore.ErrNotFound):
+			return nil, ErrNotFound
+		case errors.Is(err, userstore.ErrTwoFactorNotPending):
+			return nil, ErrTwoFactorNotEnrolled
+		case errors.Is(err, userstore.ErrTooManyEvents):
+			return nil, ErrUnavailable
+		}
+		span.RecordError(err)
+		return nil, fmt.Errorf("cannot enable two factor authentication in store: %w", err)
+	}
+	return recoveryCodes, nil
+}
+
+// DisableTwoFactor turns two factor authentication off for a user, if the code is the current code from their
+// authenticator app or one of their unused recovery codes. The change is published with the TwoFactorDisabled
+// action. It returns ErrTwoFactorNotEnabled if the user does not have it enabled, and ErrInvalidTwoFactorCode if
+// the code is incorrect
+func (service *Service) DisableTwoFactor(ctx context.Context, code *TwoFactorCode) (usr User, err error) {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "DisableTwoFactor")
+	defer span.End()
+
+	if err = service.validate.Struct(code); err != nil {
+		return usr, invalidError(err)
+	}
+
+	id := uuid.MustParse(code.ID) // the id has already been validated
+	rec, err := service.readTwoFactorRecord(ctx, id)
+	if err != nil {
+		return usr, err
+	}
+	if !rec.Data.TwoFactorEnabled {
+		return usr, ErrTwoFactorNotEnabled
+	}
+	if err = service.verifyTwoFactorCode(ctx, &rec, code.Code); err != nil {
+		return usr, err
+	}
+
+	disabled, err := service.store.DisableTwoFactor(ctx, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, userstore.ErrNotFound):
+			return usr, ErrNotFound
+		case errors.Is(err, userstore.ErrTwoFactorNotEnabled):
+			return usr, ErrTwoFactorNotEnabled
+		case errors.Is(err, userstore.ErrInvalidVersion):
+			return usr, ErrInvalidVersion
+		case errors.Is(err, userstore.ErrTooManyEvents):
+			return usr, ErrUnavailable
+		}
+		span.RecordError(err)
+		return usr, fmt.Errorf("cannot disable two factor authentication in store: %w", err)
+	}
+	return copyStoreUserToUser(&disabled), nil
+}
+
+// readTwoFactorRecord reads the record of the user with the given id, which holds their two factor secrets
+func (service *Service) readTwoFactorRecord(ctx context.Context, id uuid.UUID) (rec userstore.Record, err error) {
+	rec, err = service.store.ReadRecord(ctx, id)
+	if err != nil {
+		if errors.Is(err, userstore.ErrNotFound) {
+			return rec, ErrNotFound
+		}
+		return rec, fmt.Errorf("unexpected error reading user record from store: %w", err)
+	}
+	if rec.Data == nil || rec.DeletedAt != nil {
+		return rec, ErrNotFound
+	}
+	return rec, nil
+}
+
+// verifyTwoFactorCode checks that code is the current code from the authenticator app of the user of rec, or one of
+// their unused recovery codes, and records it as used so that it cannot be used again.
+// It returns ErrInvalidTwoFactorCode if it is not
+func (service *Service) verifyTwoFactorCode(ctx context.Context, rec *userstore.Record, code string) error {
+	if rec.TwoFactor == nil || rec.TwoFactor.Secret == "" {
+		return ErrInvalidTwoFactorCode
+	}
+
+	var err error
+	if isAppCode(code) {
+		err = service.useAppCode(ctx, rec, code)
+	} else {
+		err = service.store.UseRecoveryCode(ctx, rec.ID, hashToken(normalizeRecoveryCode(code)))
+	}
+	if err != nil {
+		if errors.Is(err, userstore.ErrTwoFactorCodeRejected) {
+			return ErrInvalidTwoFactorCode
+		}
+		return err
+	}
+	return nil
+}
+
+// useAppCode checks that code is a current code for the secret of rec, and has not been used before
+func (service *Service) useAppCode(ctx context.Context, rec *userstore.Record, code string) error {
+	if service.twoFactor.Sealer == nil {
+		return ErrTwoFactorUnavailable
+	}
+	secret, err := service.twoFactor.Sealer.Open(rec.TwoFactor.Secret)
+	if err != nil {
+		return fmt.Errorf("cannot open two factor secret: %w", err)
+	}
+	step, ok, err := totp.Validate(secret, code, utctime.Now())
+	if err != nil {
+		return fmt.Errorf("cannot validate two factor code: %w", err)
+	}
+	if !ok {
+		return ErrInvalidTwoFactorCode
+	}
+	return service.store.UseTwoFactorStep(ctx, rec.ID, step)
+}
+
+// isAppCode returns true if code looks like a code from an authenticator app rather than a recovery code
+func isAppCode(code string) bool {
+	if len(code) != totp.Digits {
+		return false
+	}
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// newRecoveryCodes returns RecoveryCodeCount random recovery codes, formatted in dashed groups to be easier to copy,
+// and their hashes. Like tokens, they are random, so a fast hash is enough
+func newRecoveryCodes() (codes []string, hashes []string, err error) {
+	for i := 0; i < RecoveryCodeCount; i++ {
+		b := make([]byte, recoveryCodeBytes)
+		if _, err = rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		code := recoveryCodeEncoding.EncodeToString(b)
+		groups := make([]string, 0, len(code)/recoveryCodeGroup)
+		for start := 0; start < len(code); start += recoveryCodeGroup {
+			groups = append(groups, code[start:start+recoveryCodeGroup])
+		}
+		codes = append(codes, strings.Join(groups, "-"))
+		hashes = append(hashes, hashToken(code))
+	}
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode removes the dashes and spaces users may type in a recovery code, and ignores its case
+func normalizeRecoveryCode(code string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
@@ -0,0 +1,314 @@
+package user_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/totp"
+	"github.com/robotlovesyou/fitest/pkg/user"
+	"github.com/robotlovesyou/fitest/pkg/utctime"
+	"github.com/stretchr/testify/require"
+)
+
+const testSecret = "JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"
+
+// prefixSealer implements user.SecretSealer by prefixing secrets, so that tests can see what was sealed
+type prefixSealer struct{}
+
+func (prefixSealer) Seal(plain string) (string, error) {
+	return "sealed:" + plain, nil
+}
+
+func (prefixSealer) Open(sealed string) (string, error) {
+	return strings.TrimPrefix(sealed, "sealed:"), nil
+}
+
+var testTwoFactor = useTwoFactor(user.TwoFactorConfig{Sealer: prefixSealer{}, Issuer: "fitest"})
+
+func currentCode(t *testing.T) string {
+	code, err := totp.Code(testSecret, utctime.Now())
+	require.NoError(t, err)
+	return code
+}
+
+// storeWithTwoFactor returns a store holding rec with two factor authentication enabled with testSecret
+func storeWithTwoFactor(rec userstore.User) *stubUserStore {
+	rec.TwoFactorEnabled = true
+	storeStub := newStubUserStore()
+	storeStub.stubReadRecord = func(_ context.Context, id uuid.UUID) (userstore.Record, error) {
+		if id != rec.ID {
+			return userstore.Record{}, userstore.ErrNotFound
+		}
+		return userstore.Record{ID: rec.ID, Data: &rec, TwoFactor: &userstore.TwoFactor{Secret: "sealed:" + testSecret}}, nil
+	}
+	return storeStub
+}
+
+func TestEnrollTwoFactorFailsWhenNotConfigured(t *testing.T) {
+	withService(newStubUserStore())(func(service *user.Service) {
+		_, err := service.EnrollTwoFactor(context.Background(), &user.Ref{ID: uuid.Must(uuid.NewRandom()).String()})
+		require.ErrorIs(t, err, user.ErrTwoFactorUnavailable)
+	})
+}
+
+func TestEnrollTwoFactorStoresSealedSecretAndReturnsURI(t *testing.T) {
+	rec := fakeUserRecord()
+	storeStub := newStubUserStore()
+	storeStub.stubReadOne = func(context.Context, uuid.UUID) (userstore.User, error) {
+		return rec, nil
+	}
+	var stored string
+	storeStub.stubBeginTwoFactor = func(_ context.Context, id uuid.UUID, pendingSecret string) error {
+		require.Equal(t, rec.ID, id)
+		stored = pendingSecret
+		return nil
+	}
+	withService(storeStub, testTwoFactor)(func(service *user.Service) {
+		enrollment, err := service.EnrollTwoFactor(context.Background(), &user.Ref{ID: rec.ID.String()})
+		require.NoError(t, err)
+		require.NotEmpty(t, enrollment.Secret)
+		require.Equal(t, "sealed:"+enrollment.Secret, stored)
+		require.Equal(t, totp.URI("fitest", rec.Email, enrollment.Secret), enrollment.URI)
+	})
+}
+
+func TestEnrollTwoFactorFailsWhenAlreadyEnabled(t *testing.T) {
+	rec := fakeUserRecord(func(r *userstore.User) { r.TwoFactorEnabled = true })
+	storeStub := newStubUserStore()
+	storeStub.stubReadOne = func(context.Context, uuid.UUID) (userstore.User, error) {
+		return rec, nil
+	}
+	withService(storeStub, testTwoFactor)(func(service *user.Service) {
+		_, err := service.EnrollTwoFactor(context.Background(), &user.Ref{ID: rec.ID.String()})
+		require.ErrorIs(t, err, user.ErrTwoFactorEnabled)
+	})
+}
+
+func TestConfirmTwoFactorEnablesItAndReturnsRecoveryCodes(t *testing.T) {
+	rec := fakeUserRecord()
+	storeStub := newStubUserStore()
+	storeStub.stubReadRecord = func(context.Context, uuid.UUID) (userstore.Record, error) {
+		return userstore.Record{ID: rec.ID, Data: &rec, TwoFactor: &userstore.TwoFactor{PendingSecret: "sealed:" + testSecret}}, nil
+	}
+	var hashes []string
+	storeStub.stubEnableTwoFactor = func(_ context.Context, id uuid.UUID, pendingSecret string, step int64, recoveryCodes []string) (userstore.User, error) {
+		require.Equal(t, rec.ID, id)
+		require.Equal(t, "sealed:"+testSecret, pendingSecret)
+		require.Equal(t, totp.Step(utctime.Now()), step)
+		hashes = recoveryCodes
+		rec.TwoFactorEnabled = true
+		return rec, nil
+	}
+	withService(storeStub, testTwoFactor)(func(service *user.Service) {
+		codes, err := service.ConfirmTwoFactor(context.Background(), &user.TwoFactorCode{ID: rec.ID.String(), Code: currentCode(t)})
+		require.NoError(t, err)
+		require.Len(t, codes, user.RecoveryCodeCount)
+		require.Len(t, hashes, user.RecoveryCodeCount)
+		for i, code := range codes {
+			require.NotContains(t, hashes, code, "only the hashes of recovery codes are stored")
+			require.NotContains(t, codes[i+1:], code)
+		}
+	})
+}
+
+func TestConfirmTwoFactorFails(t *testing.T) {
+	rec := fakeUserRecord()
+	cases := []struct {
+		name      string
+		twoFactor *userstore.TwoFactor
+		code      string
+		expected  error
+	}{
+		{
+			name:      "NotEnrolled",
+			twoFactor: nil,
+			code:      "123456",
+			expected:  user.ErrTwoFactorNotEnrolled,
+		},
+		{
+			name:      "IncorrectCode",
+			twoFactor: &userstore.TwoFactor{PendingSecret: "sealed:" + testSecret},
+			code:      "not a code",
+			expected:  user.ErrInvalidTwoFactorCode,
+		},
+		{
+			name:      "MissingCode",
+			twoFactor: &userstore.TwoFactor{PendingSecret: "sealed:" + testSecret},
+			code:      "",
+			expected:  user.ErrInvalid,
+		},
+	}
+	for _, testCase := range cases {
+		t.Run(testCase.name, func(t *testing.T) {
+			storeStub := newStubUserStore()
+			storeStub.stubReadRecord = func(context.Context, uuid.UUID) (userstore.Record, error) {
+				return userstore.Record{ID: rec.ID, Data: &rec, TwoFactor: testCase.twoFactor}, nil
+			}
+			withService(storeStub, testTwoFactor)(func(service *user.Service) {
+				_, err := service.ConfirmTwoFactor(context.Background(), &user.TwoFactorCode{ID: rec.ID.String(), Code: testCase.code})
+				require.ErrorIs(t, err, testCase.expected)
+			})
+		})
+	}
+}
+
+func TestDisableTwoFactorWithAppCode(t *testing.T) {
+	rec := fakeUserRecord()
+	storeStub := storeWithTwoFactor(rec)
+	storeStub.stubUseTwoFactorStep = func(_ context.Context, id uuid.UUID, step int64) error {
+		require.Equal(t, rec.ID, id)
+		require.Equal(t, totp.Step(utctime.Now()), step)
+		return nil
+	}
+	storeStub.stubDisableTwoFactor = func(_ context.Context, id uuid.UUID) (userstore.User, error) {
+		require.Equal(t, rec.ID, id)
+		return rec, nil
+	}
+	withService(storeStub, testTwoFactor)(func(service *user.Service) {
+		usr, err := service.DisableTwoFactor(context.Background(), &user.TwoFactorCode{ID: rec.ID.String(), Code: currentCode(t)})
+		require.NoError(t, err)
+		require.False(t, usr.TwoFactorEnabled)
+	})
+}
+
+func TestRecoveryCodesCanBeUsedToDisableTwoFactor(t *testing.T) {
+	rec := fakeUserRecord()
+	storeStub := newStubUserStore()
+	storeStub.stubReadRecord = func(context.Context, uuid.UUID) (userstore.Record, error) {
+		return userstore.Record{ID: rec.ID, Data: &rec, TwoFactor: &userstore.TwoFactor{PendingSecret: "sealed:" + testSecret}}, nil
+	}
+	var hashes []string
+	storeStub.stubEnableTwoFactor = func(_ context.Context, _ uuid.UUID, _ string, _ int64, recoveryCodes []string) (userstore.User, error) {
+		hashes = recoveryCodes
+		return rec, nil
+	}
+	withService(storeStub, testTwoFactor)(func(service *user.Service) {
+		codes, err := service.ConfirmTwoFactor(context.Background(), &user.TwoFactorCode{ID: rec.ID.String(), Code: currentCode(t)})
+		require.NoError(t, err)
+
+		enabled := storeWithTwoFactor(rec)
+		storeStub.stubReadRecord = enabled.stubReadRecord
+		var used string
+		storeStub.stubUseRecoveryCode = func(_ context.Context, id uuid.UUID, codeHash string) error {
+			require.Equal(t, rec.ID, id)
+			used = codeHash
+			return nil
+		}
+		storeStub.stubDisableTwoFactor = func(context.Context, uuid.UUID) (userstore.User, error) {
+			return rec, nil
+		}
+		// recovery codes are accepted without their dashes and in lower case
+		code := strings.ToLower(strings.ReplaceAll(codes[3], "-", ""))
+		_, err = service.DisableTwoFactor(context.Background(), &user.TwoFactorCode{ID: rec.ID.String(), Code: code})
+		require.NoError(t, err)
+		require.Equal(t, hashes[3], used)
+	})
+}
+
+func TestDisableTwoFactorFails(t *testing.T) {
+	cases := []struct {
+		name     string
+		enabled  bool
+		code     string
+		rejected bool
+		expected error
+	}{
+		{
+			name:     "NotEnabled",
+			enabled:  false,
+			code:     "123456",
+			expected: user.ErrTwoFactorNotEnabled,
+		},
+		{
+			name:     "IncorrectAppCode",
+			enabled:  true,
+			code:     "000000",
+			expected: user.ErrInvalidTwoFactorCode,
+		},
+		{
+			name:     "ReusedAppCode",
+			enabled:  true,
+			rejected: true,
+			expected: user.ErrInvalidTwoFactorCode,
+		},
+		{
+			name:     "UnknownRecoveryCode",
+			enabled:  true,
+			code:     "AAAA-BBBB-CCCC-DDDD",
+			rejected: true,
+			expected: user.ErrInvalidTwoFactorCode,
+		},
+	}
+	for _, testCase := range cases {
+		t.Run(testCase.name, func(t *testing.T) {
+			rec := fakeUserRecord()
+			storeStub := storeWithTwoFactor(rec)
+			if !testCase.enabled {
+				storeStub = newStubUserStore()
+				storeStub.stubReadRecord = func(context.Context, uuid.UUID) (userstore.Record, error) {
+					return userstore.Record{ID: rec.ID, Data: &rec}, nil
+				}
+			}
+			storeStub.stubUseTwoFactorStep = func(context.Context, uuid.UUID, int64) error {
+				if testCase.rejected {
+					return userstore.ErrTwoFactorCodeRejected
+				}
+				return nil
+			}
+			storeStub.stubUseRecoveryCode = func(context.Context, uuid.UUID, string) error {
+				return userstore.ErrTwoFactorCodeRejected
+			}
+			code := testCase.code
+			if code == "" {
+				code = currentCode(t)
+			}
+			withService(storeStub, testTwoFactor)(func(service *user.Service) {
+				_, err := service.DisableTwoFactor(context.Background(), &user.TwoFactorCode{ID: rec.ID.String(), Code: code})
+				require.ErrorIs(t, err, testCase.expected)
+			})
+		})
+	}
+}
+
+func TestAuthenticateRequiresTwoFactorCodeWhenEnabled(t *testing.T) {
+	storeStub, rec := storeWithPassword(t, testPassword)
+	rec.TwoFactorEnabled = true
+	storeStub.stubFindByEmail = func(context.Context, string) (userstore.User, error) {
+		return rec, nil
+	}
+	storeStub.stubReadRecord = storeWithTwoFactor(rec).stubReadRecord
+	storeStub.stubUseTwoFactorStep = func(context.Context, uuid.UUID, int64) error {
+		return nil
+	}
+	storeStub.stubRecordLogin = func(context.Context, uuid.UUID, time.Time) error {
+		return nil
+	}
+	withService(storeStub, testTwoFactor)(func(service *user.Service) {
+		_, err := service.Authenticate(context.Background(), rec.Email, testPassword, "")
+		require.ErrorIs(t, err, user.ErrTwoFactorRequired)
+
+		_, err = service.Authenticate(context.Background(), rec.Email, testPassword, "000000")
+		require.ErrorIs(t, err, user.ErrInvalidTwoFactorCode)
+
+		usr, err := service.Authenticate(context.Background(), rec.Email, testPassword, currentCode(t))
+		require.NoError(t, err)
+		require.True(t, usr.TwoFactorEnabled)
+	})
+}
+
+func TestAuthenticateChecksPasswordBeforeTwoFactorCode(t *testing.T) {
+	storeStub, rec := storeWithPassword(t, testPassword)
+	rec.TwoFactorEnabled = true
+	storeStub.stubFindByEmail = func(context.Context, string) (userstore.User, error) {
+		return rec, nil
+	}
+	withService(storeStub, testTwoFactor)(func(service *user.Service) {
+		// the record holding the secret is not read, since the stub would panic
+		_, err := service.Authenticate(context.Background(), rec.Email, "wrong password", "")
+		require.ErrorIs(t, err, user.ErrInvalidCredentials)
+	})
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/robotlovesyou/fitest/pkg/store/userstore"
 	"github.com/robotlovesyou/fitest/pkg/user"
 	"github.com/robotlovesyou/fitest/pkg/utctime"
+	"github.com/robotlovesyou/fitest/pkg/validation"
 	"github.com/stretchr/testify/require"
 )
 
@@ -52,6 +53,24 @@ func fakeUserRecord(muts ...func(r *userstore.User)) userstore.User {
 	return r
 }
 
+// applyChange returns rec with change applied, as the store does
+func applyChange(rec userstore.User, change *userstore.Change) userstore.User {
+	for field, value := range map[*string]*string{
+		&rec.FirstName:    change.FirstName,
+		&rec.LastName:     change.LastName,
+		&rec.PasswordHash: change.PasswordHash,
+		&rec.Country:      change.Country,
+		&rec.AvatarURL:    change.AvatarURL,
+	} {
+		if value != nil {
+			*field = *value
+		}
+	}
+	rec.UpdatedAt = change.UpdatedAt
+	rec.Version += 1
+	return rec
+}
+
 func TestUpdateUserCallsStoreWithCorrectParameters(t *testing.T) {
 	store := newStubUserStore()
 	update := fakeUserUpdate()
@@ -60,28 +79,20 @@ func TestUpdateUserCallsStoreWithCorrectParameters(t *testing.T) {
 	})
 
 	withService(store)(func(service *user.Service) {
-		var storeUser userstore.User
-		store.stubReadOne = func(context.Context, uuid.UUID) (userstore.User, error) {
-			return rec, nil
-		}
-		store.stubUpdateOne = func(ctx context.Context, usr *userstore.User) (userstore.User, error) {
-			storeUser = *usr
-			require.False(t, emptyID(usr.ID))
-			require.Equal(t, update.FirstName, usr.FirstName)
-			require.Equal(t, update.LastName, usr.LastName)
-			require.Equal(t, rec.Nickname, usr.Nickname)
-			require.True(t, checkPasswordHash(usr.PasswordHash, update.Password))
-			require.Equal(t, rec.Email, usr.Email)
-			require.Equal(t, update.Country, usr.Country)
-			require.False(t, usr.CreatedAt.IsZero())
-			require.False(t, usr.UpdatedAt.IsZero())
-			require.True(t, usr.UpdatedAt.After(rec.UpdatedAt))
-			require.Equal(t, usr.Version, rec.Version)
-			return *usr, nil
+		store.stubUpdateFields = func(ctx context.Context, id uuid.UUID, version int64, change *userstore.Change) (userstore.User, error) {
+			require.Equal(t, rec.ID, id)
+			require.Equal(t, update.Version, version)
+			require.Equal(t, update.FirstName, *change.FirstName)
+			require.Equal(t, update.LastName, *change.LastName)
+			require.True(t, checkPasswordHash(*change.PasswordHash, update.Password))
+			require.Equal(t, update.Country, *change.Country)
+			require.Nil(t, change.AvatarURL, "avatar is only updated when it is listed")
+			require.True(t, change.UpdatedAt.After(rec.UpdatedAt))
+			return applyChange(rec, change), nil
 		}
 		usr, err := service.Update(context.Background(), &update)
 		require.NoError(t, err)
-		require.True(t, compareIDs(usr.ID, storeUser.ID))
+		require.True(t, compareIDs(usr.ID, rec.ID))
 		require.Equal(t, update.FirstName, usr.FirstName)
 		require.Equal(t, update.LastName, usr.LastName)
 		require.Equal(t, rec.Nickname, usr.Nickname)
@@ -90,6 +101,7 @@ func TestUpdateUserCallsStoreWithCorrectParameters(t *testing.T) {
 		require.Equal(t, update.Country, usr.Country)
 		require.Equal(t, rec.CreatedAt, usr.CreatedAt)
 		require.True(t, rec.UpdatedAt.Before(usr.UpdatedAt))
+		require.Equal(t, rec.Version+1, usr.Version)
 	})
 }
 
@@ -161,12 +173,6 @@ func TestForErrorWhenUpdateContainsInvalidValues(t *testing.T) {
 		t.Run(thisCase.name, func(t *testing.T) {
 			store := newStubUserStore()
 			withService(store)(func(service *user.Service) {
-				store.stubReadOne = func(context.Context, uuid.UUID) (userstore.User, error) {
-					panic("should not be calling read one when update is invalid")
-				}
-				store.stubUpdateOne = func(context.Context, *userstore.User) (userstore.User, error) {
-					panic("should not be calling update when update is invalid")
-				}
 				_, err := service.Update(context.Background(), &c.update)
 				require.ErrorIs(t, err, user.ErrInvalid)
 			})
@@ -185,11 +191,8 @@ func TestPasswordIsNotReHashedWhenItIsNotSetInTheUpdate(t *testing.T) {
 	})
 
 	withService(store)(func(service *user.Service) {
-		store.stubReadOne = func(context.Context, uuid.UUID) (userstore.User, error) {
-			return rec, nil
-		}
-		store.stubUpdateOne = func(ctx context.Context, usr *userstore.User) (userstore.User, error) {
-			return *usr, nil
+		store.stubUpdateFields = func(_ context.Context, _ uuid.UUID, _ int64, change *userstore.Change) (userstore.User, error) {
+			return applyChange(rec, change), nil
 		}
 		usr, err := service.Update(context.Background(), &update)
 		require.NoError(t, err)
@@ -197,22 +200,6 @@ func TestPasswordIsNotReHashedWhenItIsNotSetInTheUpdate(t *testing.T) {
 	})
 }
 
-func TestForErrorUpdatingUserWhenRecordNotFound(t *testing.T) {
-	store := newStubUserStore()
-	update := fakeUserUpdate()
-
-	withService(store)(func(service *user.Service) {
-		store.stubReadOne = func(context.Context, uuid.UUID) (rec userstore.User, err error) {
-			return rec, userstore.ErrNotFound
-		}
-		store.stubUpdateOne = func(ctx context.Context, usr *userstore.User) (userstore.User, error) {
-			panic("should not be calling update when the record is not found")
-		}
-		_, err := service.Update(context.Background(), &update)
-		require.ErrorIs(t, err, user.ErrNotFound)
-	})
-}
-
 func TestForErrorUpdatingUserWhenPasswordCannotBeHashed(t *testing.T) {
 	store := newStubUserStore()
 	update := fakeUserUpdate()
@@ -221,37 +208,14 @@ func TestForErrorUpdatingUserWhenPasswordCannotBeHashed(t *testing.T) {
 	})
 
 	withService(store, useHasher(badHasher{}))(func(service *user.Service) {
-		store.stubReadOne = func(context.Context, uuid.UUID) (userstore.User, error) {
-			return rec, nil
-		}
-		store.stubUpdateOne = func(ctx context.Context, usr *userstore.User) (userstore.User, error) {
-			return *usr, nil
+		store.stubUpdateFields = func(_ context.Context, _ uuid.UUID, _ int64, change *userstore.Change) (userstore.User, error) {
+			return applyChange(rec, change), nil
 		}
 		_, err := service.Update(context.Background(), &update)
 		require.Error(t, err)
 	})
 }
 
-func TestForErrorUpdatingUserWhenVersionIsStale(t *testing.T) {
-	store := newStubUserStore()
-	update := fakeUserUpdate()
-	rec := fakeUserRecord(func(r *userstore.User) {
-		r.ID = uuid.MustParse(update.ID)
-		r.Version = update.Version + 1
-	})
-
-	withService(store)(func(service *user.Service) {
-		store.stubReadOne = func(context.Context, uuid.UUID) (userstore.User, error) {
-			return rec, nil
-		}
-		store.stubUpdateOne = func(ctx context.Context, usr *userstore.User) (userstore.User, error) {
-			panic("should not be calling store update when version is stale")
-		}
-		_, err := service.Update(context.Background(), &update)
-		require.ErrorIs(t, err, user.ErrInvalidVersion)
-	})
-}
-
 func TestForErrorUpdatingUserWhenStoreUpdateFails(t *testing.T) {
 	unexpected := errors.New("unexpected")
 	cases := []struct {
@@ -269,6 +233,11 @@ func TestForErrorUpdatingUserWhenStoreUpdateFails(t *testing.T) {
 			expected: user.ErrInvalidVersion,
 			result:   userstore.ErrInvalidVersion,
 		},
+		{
+			name:     "Too Many Events",
+			expected: user.ErrUnavailable,
+			result:   userstore.ErrTooManyEvents,
+		},
 		{
 			name:     "Unexpected Error From Store Is Included In Chain",
 			expected: unexpected,
@@ -280,14 +249,8 @@ func TestForErrorUpdatingUserWhenStoreUpdateFails(t *testing.T) {
 		t.Run(thisCase.name, func(t *testing.T) {
 			store := newStubUserStore()
 			update := fakeUserUpdate()
-			rec := fakeUserRecord(func(r *userstore.User) {
-				r.ID = uuid.MustParse(update.ID)
-			})
 			withService(store)(func(service *user.Service) {
-				store.stubReadOne = func(context.Context, uuid.UUID) (userstore.User, error) {
-					return rec, nil
-				}
-				store.stubUpdateOne = func(context.Context, *userstore.User) (rec userstore.User, err error) {
+				store.stubUpdateFields = func(context.Context, uuid.UUID, int64, *userstore.Change) (rec userstore.User, err error) {
 					return rec, thisCase.result
 				}
 				_, err := service.Update(context.Background(), &update)
@@ -296,3 +259,170 @@ func TestForErrorUpdatingUserWhenStoreUpdateFails(t *testing.T) {
 		})
 	}
 }
+
+func TestOnlyFieldsListedInTheUpdateAreModified(t *testing.T) {
+	store := newStubUserStore()
+	update := fakeUserUpdate(func(u *user.Update) {
+		u.Fields = []string{user.FieldLastName}
+		// unlisted fields are not validated
+		u.FirstName = ""
+		u.Country = "123"
+		u.ConfirmPassword = "not the same as password"
+	})
+	rec := fakeUserRecord(func(r *userstore.User) {
+		r.ID = uuid.MustParse(update.ID)
+	})
+
+	withService(store)(func(service *user.Service) {
+		store.stubUpdateFields = func(_ context.Context, _ uuid.UUID, _ int64, change *userstore.Change) (userstore.User, error) {
+			return applyChange(rec, change), nil
+		}
+		usr, err := service.Update(context.Background(), &update)
+		require.NoError(t, err)
+		require.Equal(t, update.LastName, usr.LastName)
+		require.Equal(t, rec.FirstName, usr.FirstName)
+		require.Equal(t, rec.Country, usr.Country)
+		require.Equal(t, rec.PasswordHash, usr.PasswordHash)
+	})
+}
+
+func TestForErrorWhenListedFieldsAreInvalid(t *testing.T) {
+	cases := []struct {
+		name   string
+		update user.Update
+		field  string
+		rule   string
+	}{
+		{
+			name: "Listed field is invalid",
+			update: fakeUserUpdate(func(u *user.Update) {
+				u.Fields = []string{user.FieldFirstName}
+				u.FirstName = ""
+			}),
+			field: "FirstName",
+			rule:  "required",
+		},
+		{
+			name: "Password confirmation is checked",
+			update: fakeUserUpdate(func(u *user.Update) {
+				u.Fields = []string{user.FieldPassword}
+				u.ConfirmPassword = "not the same as password"
+			}),
+			field: "ConfirmPassword",
+			rule:  "eqfield",
+		},
+		{
+			name: "Listed password is empty",
+			update: fakeUserUpdate(func(u *user.Update) {
+				u.Fields = []string{user.FieldPassword}
+				u.Password = ""
+				u.ConfirmPassword = ""
+			}),
+			field: "Password",
+			rule:  "required",
+		},
+		{
+			name: "Field cannot be updated",
+			update: fakeUserUpdate(func(u *user.Update) {
+				u.Fields = []string{"Email"}
+			}),
+			field: "Fields",
+			rule:  user.RuleUpdatable,
+		},
+	}
+	for _, c := range cases {
+		thisCase := c
+		t.Run(thisCase.name, func(t *testing.T) {
+			store := newStubUserStore()
+			withService(store)(func(service *user.Service) {
+				_, err := service.Update(context.Background(), &thisCase.update)
+				var invalid *user.InvalidError
+				require.ErrorAs(t, err, &invalid)
+				require.Len(t, invalid.Violations, 1)
+				require.Equal(t, thisCase.field, invalid.Violations[0].Field)
+				require.Equal(t, thisCase.rule, invalid.Violations[0].Rule)
+			})
+		})
+	}
+}
+
+func TestUpdateRejectsCountryDeniedByPolicy(t *testing.T) {
+	store := newStubUserStore()
+	update := fakeUserUpdate(func(u *user.Update) {
+		u.Country = "KP"
+	})
+	withService(store, useCountries(validation.CountryList{Deny: []string{"KP"}}))(func(service *user.Service) {
+		_, err := service.Update(context.Background(), &update)
+		var invalid *user.InvalidError
+		require.ErrorAs(t, err, &invalid)
+		require.Len(t, invalid.Violations, 1)
+		require.Equal(t, "Country", invalid.Violations[0].Field)
+		require.Equal(t, "is not a country users can be registered in", invalid.Violations[0].Description)
+	})
+}
+
+func TestAvatarURLIsUpdatedWhenListed(t *testing.T) {
+	store := newStubUserStore()
+	update := fakeUserUpdate(func(u *user.Update) {
+		u.Fields = []string{user.FieldAvatarURL}
+		u.AvatarURL = "https://" + avatarHost + "/avatars/1.png"
+	})
+	rec := fakeUserRecord(func(r *userstore.User) {
+		r.ID = uuid.MustParse(update.ID)
+	})
+
+	withService(store)(func(service *user.Service) {
+		store.stubUpdateFields = func(_ context.Context, _ uuid.UUID, _ int64, change *userstore.Change) (userstore.User, error) {
+			require.Nil(t, change.FirstName)
+			require.Equal(t, update.AvatarURL, *change.AvatarURL)
+			return applyChange(rec, change), nil
+		}
+		usr, err := service.Update(context.Background(), &update)
+		require.NoError(t, err)
+		require.Equal(t, update.AvatarURL, usr.AvatarURL)
+		require.Equal(t, rec.FirstName, usr.FirstName)
+	})
+}
+
+func TestAvatarURLCanBeRemoved(t *testing.T) {
+	store := newStubUserStore()
+	update := fakeUserUpdate(func(u *user.Update) {
+		u.Fields = []string{user.FieldAvatarURL}
+	})
+	rec := fakeUserRecord(func(r *userstore.User) {
+		r.ID = uuid.MustParse(update.ID)
+		r.AvatarURL = "https://" + avatarHost + "/avatars/1.png"
+	})
+
+	withService(store)(func(service *user.Service) {
+		store.stubUpdateFields = func(_ context.Context, _ uuid.UUID, _ int64, change *userstore.Change) (userstore.User, error) {
+			return applyChange(rec, change), nil
+		}
+		usr, err := service.Update(context.Background(), &update)
+		require.NoError(t, err)
+		require.Empty(t, usr.AvatarURL)
+	})
+}
+
+func TestUpdateRejectsAvatarURLNotOnAnAllowedHost(t *testing.T) {
+	for _, avatarURL := range []string{
+		"https://tracker.example.net/pixel.gif",
+		"http://" + avatarHost + "/avatars/1.png",
+	} {
+		t.Run(avatarURL, func(t *testing.T) {
+			store := newStubUserStore()
+			update := fakeUserUpdate(func(u *user.Update) {
+				u.Fields = []string{user.FieldAvatarURL}
+				u.AvatarURL = avatarURL
+			})
+			withService(store)(func(service *user.Service) {
+				_, err := service.Update(context.Background(), &update)
+				var invalid *user.InvalidError
+				require.ErrorAs(t, err, &invalid)
+				require.Len(t, invalid.Violations, 1)
+				require.Equal(t, "AvatarURL", invalid.Violations[0].Field)
+				require.Equal(t, "avatar-url", invalid.Violations[0].Rule)
+			})
+		})
+	}
+}
@@ -13,16 +13,19 @@ import (
 	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
 	"github.com/robotlovesyou/fitest/pkg/event"
-	"github.com/robotlovesyou/fitest/pkg/log"
 	"github.com/robotlovesyou/fitest/pkg/store/userstore"
 	"github.com/robotlovesyou/fitest/pkg/telemetry"
+	"github.com/robotlovesyou/fitest/pkg/tenant"
 	"github.com/robotlovesyou/fitest/pkg/utctime"
 	"go.opentelemetry.io/otel"
 )
 
 const (
-	// MaxPageLength is the maximum length of a page
+	// MaxPageLength is the maximum length of a page. Longer requested lengths are reduced to it
 	MaxPageLength = 100
+	// MaxRequestedPageLength is the maximum length which can be requested for a page. Longer lengths are rejected
+	// rather than reduced, since they are more likely to be mistakes than requests for as many users as possible
+	MaxRequestedPageLength = 1000
 	// TimeFormat is the formatting string used by the users package
 	TimeFormat = time.RFC3339
 	// DefaultVersion is the version for new users
@@ -31,13 +34,16 @@ const (
 	DefaultPage = int64(1)
 	// DefaultLength is the default page length for finding users when none is provided
 	DefaultLength = int32(25)
+	// UnknownTotal is the Total and TotalPages of the pages of queries which skip counting the matching users
+	UnknownTotal = userstore.UnknownTotal
 	// MinPollInterval is the minimum time between polls for events. It should be configurable
 	MinPollInterval = 10 * time.Millisecond
 	// MinPollInterval is the minimum time between polls for events. It should be configurable
 	MaxPollInterval = 30 * time.Millisecond
 	// RetryTimeout is time an event can be left pending before retry. It should be configurable
 	RetryInterval = 10 * time.Second
-	// MinHealthyRatio is the minimum ratio of successful event publishes for the service to be considered healthy. It should be configurable
+	// MinHealthyRatio is the minimum ratio of successful event publishes for the service to be considered healthy, unless
+	// the service is configured with UseHealthConfig
 	MinHealthyRatio = 0.9
 )
 
@@ -45,14 +51,27 @@ var (
 	// ErrAlreadyExists is returned when the users email address or nickname are not unique.
 	// In a real world implementation further detail would be required to allow the client to rectify the error
 	ErrAlreadyExists = errors.New("user with that email or nickname already exists")
-	// ErrInvalid is returned when the validation of a new or updated user fails
-	// In a real world implementation further detail would be required to allow the client to rectify the error
+	// ErrEmailInUse is returned when the email address of a new user, or the new email address of a user, is used by
+	// another user. It wraps ErrAlreadyExists
+	ErrEmailInUse = fmt.Errorf("%w: email address is in use", ErrAlreadyExists)
+	// ErrNicknameInUse is returned when the nickname of a new user, or the new nickname of a user, is used by another
+	// user. It wraps ErrAlreadyExists
+	ErrNicknameInUse = fmt.Errorf("%w: nickname is in use", ErrAlreadyExists)
+	// ErrInvalid is returned when the validation of a new or updated user fails.
+	// Validation failures are returned as an *InvalidError, which wraps ErrInvalid and describes each invalid field
 	ErrInvalid = errors.New("user is invalid")
 	// ErrInvalidVersion is returned when the version returned with the update is incorrect, which would indicate that the
 	// data is stale
 	ErrInvalidVersion = errors.New("version is invalid")
 	// ErrNotFound is returned when the user matching a request does not exist
 	ErrNotFound = errors.New("user not found")
+	// ErrUnavailable is returned when a change cannot be made for now, such as a change of email address or nickname
+	// while the store is building the indexes which keep them unique, or a change to a user whose events are waiting
+	// to be published while the store holds too many of them. The change can be retried later
+	ErrUnavailable = errors.New("the change cannot be made at the moment")
+	// ErrIdempotencyKeyReused is returned when a new user is created with the idempotency key the same caller used to
+	// create a user with different details
+	ErrIdempotencyKeyReused = errors.New("the idempotency key was used to create a different user")
 )
 
 type NewUser struct {
@@ -62,7 +81,13 @@ type NewUser struct {
 	Password        string `validate:"min=10"`
 	ConfirmPassword string `validate:"required,eqfield=Password"`
 	Email           string `validate:"required,email"`
-	Country         string `validate:"required,iso3166_1_alpha2"`
+	Country         string `validate:"required,iso3166_1_alpha2,allowed-country"`
+	// IdempotencyKey is an optional key chosen by the client. Repeating a create with the same key returns the
+	// user created by the first request, so that clients can safely retry
+	IdempotencyKey string `validate:"max=255"`
+	// Caller identifies the authenticated caller creating the user. Idempotency keys are scoped by it, so that
+	// callers cannot be returned the users created by each other
+	Caller string
 }
 
 // User is the item stored by the service
@@ -74,9 +99,16 @@ type User struct {
 	PasswordHash string
 	Email        string
 	Country      string
+	AvatarURL    string
 	CreatedAt    time.Time
 	UpdatedAt    time.Time
 	Version      int64
+	Status       string
+	// LastLoginAt and LastSeenAt are zero if the user has never authenticated or been seen
+	LastLoginAt time.Time
+	LastSeenAt  time.Time
+	// TwoFactorEnabled is true when the user must give a two factor authentication code to authenticate
+	TwoFactorEnabled bool
 }
 
 // Sanitized user is a User with sensitive information removed
@@ -87,11 +119,33 @@ type SanitizedUser struct {
 	Nickname  string
 	Email     string
 	Country   string
+	AvatarURL string
 	CreatedAt string
 	UpdatedAt string
 	Version   int64
+	Status    string
+	// LastLoginAt and LastSeenAt are empty if the user has never authenticated or been seen
+	LastLoginAt      string
+	LastSeenAt       string
+	TwoFactorEnabled bool
 }
 
+// Names of the fields of a user which can be listed in Update.Fields
+const (
+	FieldFirstName = "FirstName"
+	FieldLastName  = "LastName"
+	FieldPassword  = "Password"
+	FieldCountry   = "Country"
+	FieldAvatarURL = "AvatarURL"
+)
+
+// updateFields are the fields of a user which can be updated
+var updateFields = []string{FieldFirstName, FieldLastName, FieldPassword, FieldCountry, FieldAvatarURL}
+
+// defaultUpdateFields are the fields updated when an Update does not list any. AvatarURL is left out, so that clients
+// which do not know about it do not remove it
+var defaultUpdateFields = []string{FieldFirstName, FieldLastName, FieldPassword, FieldCountry}
+
 // Update represents an update to the service
 type Update struct {
 	ID              string `validate:"uuid"`
@@ -99,8 +153,14 @@ type Update struct {
 	LastName        string `validate:"required,allowed-runes"`
 	Password        string `validate:"omitempty,min=10"`
 	ConfirmPassword string `validate:"eqfield=Password"`
-	Country         string `validate:"required,iso3166_1_alpha2"`
-	Version         int64
+	Country         string `validate:"required,iso3166_1_alpha2,allowed-country"`
+	// AvatarURL is the https URL of the user's profile picture, on one of the allowed avatar hosts. When it is empty
+	// the picture is removed
+	AvatarURL string `validate:"omitempty,max=2048,avatar-url"`
+	Version   int64
+	// Fields lists the fields to be updated. Fields which are not listed are neither validated nor modified.
+	// When it is empty, all fields except AvatarURL are updated
+	Fields []string
 }
 
 // Event is a change message as published by the service
@@ -110,7 +170,13 @@ type Event struct {
 	Action    string `json:"action"`
 	CreatedAt string `json:"created_at"`
 	SentAt    string `json:"sent_at"`
-	Data      *SanitizedUser
+	// Tenant is the tenant of the user. It is empty for the default tenant
+	Tenant string `json:"tenant,omitempty"`
+	// Token is the token of PasswordResetRequested and EmailChangeRequested events, for the mailer to send to the user
+	Token string `json:"token,omitempty"`
+	// Email is the new email address of EmailChangeRequested events, which the token is sent to
+	Email string `json:"email,omitempty"`
+	Data  *SanitizedUser
 }
 
 // Ref is a reference to a single user
@@ -118,12 +184,47 @@ type Ref struct {
 	ID string `validate:"uuid"`
 }
 
+// SortDirection is the order in which a page of users is sorted
+type SortDirection int
+
+const (
+	SortAscending SortDirection = iota
+	SortDescending
+)
+
 // Query represents the parameters used to request a page of users
 type Query struct {
-	CreatedAfter string
-	Country      string
-	Length       int32
-	Page         int64
+	// CreatedAfter must be empty or formatted with TimeFormat
+	CreatedAfter string `validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	// CreatedBefore matches users created before the given time. It must be empty, to match users however recently
+	// they were created, or formatted with TimeFormat
+	CreatedBefore string `validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	Country       string
+	// Countries matches users living in any of the given countries, as well as Country when it is set. Each must be
+	// an ISO 3166-1 alpha-2 code. When both are empty, users living in any country match
+	Countries []string `validate:"max=250,dive,iso3166_1_alpha2"`
+	// Length must not exceed MaxRequestedPageLength, and is reduced to MaxPageLength if it exceeds that.
+	// When it is 0, DefaultLength is used
+	Length int32 `validate:"min=0,max=1000"`
+	// Page must not be negative. When it is 0, DefaultPage is used
+	Page int64 `validate:"min=0"`
+	// SortBy is the field to sort users by. It must be one of created_at, updated_at, last_name or nickname.
+	// When it is empty, users are sorted by created_at
+	SortBy        string `validate:"omitempty,oneof=created_at updated_at last_name nickname"`
+	SortDirection SortDirection
+	// Status matches users with the given status. It must be empty, to match users with any status, or one of
+	// active, suspended, banned or dormant
+	Status string `validate:"omitempty,oneof=active suspended banned dormant"`
+	// Search matches users whose nickname or email address is the search term, or whose first or last name starts
+	// with it. Matching is case sensitive. When it is empty, users are not searched
+	Search string `validate:"max=100"`
+	// InactiveSince matches users who have not been seen since the given time, including users created before it who
+	// have never been seen. It must be empty, to match users however recently they were seen, or formatted with
+	// TimeFormat
+	InactiveSince string `validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	// SkipTotal skips counting the users matching the query, which is expensive when many users match. The Total and
+	// TotalPages of the page are UnknownTotal, and HasNext still reports whether there are users on later pages
+	SkipTotal bool
 }
 
 // Page is a page of users
@@ -131,6 +232,10 @@ type Page struct {
 	Page  int64
 	Total int64
 	Items []SanitizedUser
+	// HasNext is true when there are users matching the query on later pages
+	HasNext bool
+	// TotalPages is the number of pages of the length used for the query which hold the users matching it
+	TotalPages int64
 }
 
 // Service provides the services offered by this package
@@ -140,12 +245,33 @@ type Service struct {
 	idGenerator IDGenerator
 	validate    *validator.Validate
 	bus         event.Bus
-	eventMtx    sync.Mutex
-	eventCount  int64
-	successRate float64
-	// In a production setting I would declare this as an interface to allow for stub implementations for testing
+	// eventResults counts the results of publishing events over the window of health
+	eventResults *eventWindow
+	// health sets when the Monitor of the service reports it as unhealthy. It is set by UseHealthConfig
+	health   HealthConfig
+	watchers *watchers
+	// dummyHashMtx guards dummyHashValue, the hash compared against when authenticating an unknown email address
+	dummyHashMtx   sync.Mutex
+	dummyHashValue string
+	// twoFactor configures two factor authentication. Users cannot enroll until it is set by UseTwoFactor
+	twoFactor TwoFactorConfig
+	// hooks are called around changes to users. They are added by UseHooks
+	hooks Hooks
+	// notifier sends notifications about changes to users. No notifications are sent until it is set by UseNotifier
+	notifier Notifier
+	// notifications queues the notifications waiting to be sent. It is made by UseNotifier
+	notifications chan notification
+	// nicknameCooldown is the time a user must wait between changes of nickname. It is set by UseNicknameCooldown
+	nicknameCooldown time.Duration
+	// availability caches the results of CheckAvailability
+	availability *availabilityCache
+	// published remembers the events published recently, so that they are not published twice
+	published *publishedEvents
+	// maxEventAttempts is the number of times an event is sent before it is dead lettered. It is set by
+	// UseMaxEventAttempts
+	maxEventAttempts int64
 	// I am handling most logging at the RPC level, logging success or failure, but also need to log events, which don't exist at the RPC level
-	logger *log.Logger
+	logger Logger
 }
 
 type Monitor struct {
@@ -162,36 +288,87 @@ func (m *Monitor) Name() string {
 	return "Users Service"
 }
 
-func (m *Monitor) Check(context.Context) error {
-	rate := m.service.CheckEventSuccessRateAndReset()
-	if rate < MinHealthyRatio {
-		return fmt.Errorf("Event Success is %f which is below the minimu of %f", rate, MinHealthyRatio)
+// Check fails if too few events were published successfully within the window of the health configuration of the
+// service, or if the oldest event waiting to be published is older than its maximum age
+func (m *Monitor) Check(ctx context.Context) error {
+	rate := m.service.EventSuccessRate()
+	if rate < m.service.health.MinSuccessRatio {
+		return fmt.Errorf("Event Success is %f which is below the minimu of %f", rate, m.service.health.MinSuccessRatio)
+	}
+	backlog, err := m.service.EventBacklog(ctx)
+	if err != nil {
+		return err
+	}
+	if backlog.OldestAge > m.service.health.MaxEventAge {
+		return fmt.Errorf("oldest pending event is %s old, which is above the maximum of %s", backlog.OldestAge, m.service.health.MaxEventAge)
 	}
 	return nil
 }
 
 // New creates a new service.
 // It has a lot of parameters. It might be better to tidy them using an options struct
-func New(store UserStore, hasher PasswordHasher, idGenerator IDGenerator, validate *validator.Validate, bus event.Bus, logger *log.Logger) *Service {
+func New(store UserStore, hasher PasswordHasher, idGenerator IDGenerator, validate *validator.Validate, bus event.Bus, logger Logger) *Service {
 	return &Service{
-		store:       store,
-		hasher:      hasher,
-		idGenerator: idGenerator,
-		validate:    validate,
-		bus:         bus,
-		logger:      logger,
+		store:            store,
+		hasher:           hasher,
+		idGenerator:      idGenerator,
+		validate:         validate,
+		bus:              bus,
+		logger:           logger,
+		watchers:         newWatchers(),
+		availability:     newAvailabilityCache(),
+		published:        newPublishedEvents(),
+		nicknameCooldown: DefaultNicknameCooldown,
+		maxEventAttempts: DefaultMaxEventAttempts,
+		health:           DefaultHealthConfig(),
+		eventResults:     newEventWindow(DefaultHealthWindow),
 	}
 }
 
 // Userstore represents the fuctions which must be implemented by any storage service
 type UserStore interface {
 	Create(context.Context, *userstore.User) (userstore.User, error)
-	UpdateOne(context.Context, *userstore.User) (userstore.User, error)
+	CreateWithKey(context.Context, *userstore.User, string) (userstore.User, error)
+	CreateMany(context.Context, []userstore.User) ([]error, error)
+	UpdateFields(context.Context, uuid.UUID, int64, *userstore.Change) (userstore.User, error)
+	ChangePassword(context.Context, *userstore.User) (userstore.User, error)
+	Anonymize(context.Context, *userstore.User) (userstore.User, error)
+	ChangeStatus(context.Context, *userstore.User) (userstore.User, error)
+	RequestPasswordReset(context.Context, uuid.UUID, string, userstore.ResetToken) error
+	ResetPassword(context.Context, string, string) (userstore.User, error)
+	RequestEmailChange(context.Context, uuid.UUID, int64, string, userstore.EmailChange) error
+	ConfirmEmailChange(context.Context, string) (userstore.User, error)
 	ReadOne(context.Context, uuid.UUID) (userstore.User, error)
+	ReadMany(context.Context, []uuid.UUID) ([]userstore.User, error)
+	ReadRecord(context.Context, uuid.UUID) (userstore.Record, error)
+	FindByEmail(context.Context, string) (userstore.User, error)
+	FindByNickname(context.Context, string) (userstore.User, error)
+	EmailExists(context.Context, string) (bool, error)
+	NicknameExists(context.Context, string) (bool, error)
 	DeleteOne(context.Context, uuid.UUID) error
+	DeleteMany(context.Context, []uuid.UUID) ([]uuid.UUID, error)
+	ChangeNickname(context.Context, uuid.UUID, int64, string, time.Duration) (userstore.User, error)
+	Restore(context.Context, uuid.UUID) (userstore.User, error)
+	Replay(context.Context, uuid.UUID) (userstore.User, error)
+	Purge(context.Context) (int64, error)
+	MarkDormant(context.Context, time.Time) (int64, error)
 	FindMany(context.Context, *userstore.Query) (userstore.Page, error)
+	Count(context.Context, *userstore.Query) (int64, error)
+	Stats(context.Context, *userstore.Query, userstore.StatsInterval) (userstore.Stats, error)
+	Iterate(context.Context, *userstore.Query) (userstore.UserIterator, error)
 	Events(context.Context, time.Duration, time.Duration, time.Duration) <-chan userstore.EventResult
 	ProcessEvent(ctx context.Context, id uuid.UUID, version int64) error
+	Backlog(context.Context) (userstore.Backlog, error)
+	DeadLetterEvent(ctx context.Context, id uuid.UUID, version int64) error
+	DeadLetters(context.Context) ([]userstore.Event, error)
+	RequeueDeadLetter(context.Context, uuid.UUID) error
+	RecordLogin(context.Context, uuid.UUID, time.Time) error
+	TouchLastSeen(context.Context, uuid.UUID, time.Time) error
+	BeginTwoFactor(context.Context, uuid.UUID, string) error
+	EnableTwoFactor(context.Context, uuid.UUID, string, int64, []string) (userstore.User, error)
+	DisableTwoFactor(context.Context, uuid.UUID) (userstore.User, error)
+	UseTwoFactorStep(context.Context, uuid.UUID, int64) error
+	UseRecoveryCode(context.Context, uuid.UUID, string) error
 }
 
 // Interface for password hasher.
@@ -200,25 +377,72 @@ type PasswordHasher interface {
 	Compare(hash string, plain string) bool
 }
 
+// Logger represents the logging functions used by the service
+type Logger interface {
+	Infof(ctx context.Context, format string, args ...any)
+	Errorf(ctx context.Context, err error, format string, args ...any)
+}
+
 // Interface ID generation
 type IDGenerator func() (uuid.UUID, error)
 
+// alreadyExistsError returns ErrEmailInUse or ErrNicknameInUse for a conflict reported by the store, or
+// ErrAlreadyExists if the store did not say which
+func alreadyExistsError(err error) error {
+	switch {
+	case errors.Is(err, userstore.ErrEmailInUse):
+		return ErrEmailInUse
+	case errors.Is(err, userstore.ErrNicknameInUse):
+		return ErrNicknameInUse
+	default:
+		return ErrAlreadyExists
+	}
+}
+
 func copyStoreUserToUser(usr *userstore.User) User {
 	return User{
-		ID:           usr.ID,
-		FirstName:    usr.FirstName,
-		LastName:     usr.LastName,
-		Nickname:     usr.Nickname,
-		PasswordHash: usr.PasswordHash,
-		Email:        usr.Email,
-		Country:      usr.Country,
-		CreatedAt:    usr.CreatedAt,
-		UpdatedAt:    usr.UpdatedAt,
-		Version:      usr.Version,
+		ID:               usr.ID,
+		FirstName:        usr.FirstName,
+		LastName:         usr.LastName,
+		Nickname:         usr.Nickname,
+		PasswordHash:     usr.PasswordHash,
+		Email:            usr.Email,
+		Country:          usr.Country,
+		AvatarURL:        usr.AvatarURL,
+		CreatedAt:        usr.CreatedAt,
+		UpdatedAt:        usr.UpdatedAt,
+		Version:          usr.Version,
+		Status:           statusOf(usr.Status),
+		LastLoginAt:      usr.LastLoginAt,
+		LastSeenAt:       usr.LastSeenAt,
+		TwoFactorEnabled: usr.TwoFactorEnabled,
+	}
+}
+
+// newStoreUser returns the store record for a new, active user
+func newStoreUser(id uuid.UUID, newUser *NewUser, passwordHash string) *userstore.User {
+	return &userstore.User{
+		ID:           id,
+		FirstName:    newUser.FirstName,
+		LastName:     newUser.LastName,
+		Nickname:     newUser.Nickname,
+		PasswordHash: passwordHash,
+		Email:        newUser.Email,
+		Country:      newUser.Country,
+		CreatedAt:    utctime.Now(),
+		UpdatedAt:    utctime.Now(),
+		Version:      DefaultVersion,
+		Status:       userstore.StatusActive,
 	}
 }
 
-// Create creates a new user if the request is valid
+// scopedKey returns the idempotency key of newUser scoped by its caller. The caller is prefixed with its length, so
+// that no caller and key can give the key of another caller
+func scopedKey(newUser *NewUser) string {
+	return fmt.Sprintf("%d:%s:%s", len(newUser.Caller), newUser.Caller, newUser.IdempotencyKey)
+}
+
+// Create creates a new user if the request is valid and no BeforeCreate hook rejects it
 func (service *Service) Create(ctx context.Context, newUser *NewUser) (user User, err error) {
 	id, err := service.idGenerator()
 	if err != nil {
@@ -232,95 +456,165 @@ func (service *Service) Create(ctx context.Context, newUser *NewUser) (user User
 
 	if err = service.validate.Struct(newUser); err != nil {
 		service.logger.Errorf(ctx, err, "cannot create invalid user")
-		// In a real world implementation, the validation would need to return information rich enough to allow the consumer to
-		// address the issue, because "computer says 'No'" is not very helpful, but it will do for here, hopefully!
-
-		// Additionally, since this includes information which might be displayed to other users, it would likely want
+		// Since this includes information which might be displayed to other users, it would likely want
 		// to check for potentially offensive content in some fields
-		return user, ErrInvalid
+		return user, invalidError(err)
+	}
+	if err = service.beforeCreate(ctx, newUser); err != nil {
+		return user, err
 	}
 
-	rec, err := service.store.Create(ctx, &userstore.User{
-		ID:           id,
-		FirstName:    newUser.FirstName,
-		LastName:     newUser.LastName,
-		Nickname:     newUser.Nickname,
-		PasswordHash: string(passwordHash),
-		Email:        newUser.Email,
-		Country:      newUser.Country,
-		CreatedAt:    utctime.Now(),
-		UpdatedAt:    utctime.Now(),
-		Version:      DefaultVersion,
-	})
+	usr := newStoreUser(id, newUser, passwordHash)
+	var rec userstore.User
+	if newUser.IdempotencyKey != "" {
+		rec, err = service.store.CreateWithKey(ctx, usr, scopedKey(newUser))
+	} else {
+		rec, err = service.store.Create(ctx, usr)
+	}
 	if err != nil {
-		if errors.Is(err, userstore.ErrAlreadyExists) {
-			return user, ErrAlreadyExists
+		switch {
+		case errors.Is(err, userstore.ErrAlreadyExists):
+			return user, alreadyExistsError(err)
+		case errors.Is(err, userstore.ErrIndexesBuilding):
+			return user, ErrUnavailable
+		case errors.Is(err, userstore.ErrIdempotencyKeyReused):
+			return user, ErrIdempotencyKeyReused
 		}
 		return user, fmt.Errorf("unexpected error storing user: %w", err)
 	}
 
-	return copyStoreUserToUser(&rec), nil
+	user = copyStoreUserToUser(&rec)
+	afterChange(ctx, service.hooks.AfterCreate, &user)
+	return user, nil
 }
 
-func (service *Service) updateHashIfSet(update *Update, rec *userstore.User) (err error) {
+// updateHashIfSet sets the password hash of change to the hash of the password of update, if it is set
+func (service *Service) updateHashIfSet(update *Update, change *userstore.Change) error {
 	if len(update.Password) == 0 {
 		return nil
 	}
-	rec.PasswordHash, err = service.hasher.Hash(update.Password)
+	hash, err := service.hasher.Hash(update.Password)
 	if err != nil {
 		return fmt.Errorf("cannot update password hash: %w", err)
 	}
-	return
+	change.PasswordHash = &hash
+	return nil
 }
 
-// Update updates a user if the request is valid and references an existing user
-func (service *Service) Update(ctx context.Context, update *Update) (usr User, err error) {
-	if err := service.validate.Struct(update); err != nil {
-		service.logger.Errorf(ctx, err, "cannot update invalid user")
-		// In a real world implementation, the validation would need to return information rich enough to allow the consumer to
-		// address the issue, because "computer says 'No'" is not very helpful, but it will do for here, hopefully!
-		return usr, ErrInvalid
+// fieldsToUpdate returns the fields listed by the update, or all fields if none are listed.
+// It returns an InvalidError if any of the listed fields cannot be updated
+func fieldsToUpdate(update *Update) ([]string, error) {
+	if len(update.Fields) == 0 {
+		return defaultUpdateFields, nil
 	}
+	var violations []FieldViolation
+	for _, field := range update.Fields {
+		if !contains(updateFields, field) {
+			violations = append(violations, FieldViolation{
+				Field:       "Fields",
+				Rule:        RuleUpdatable,
+				Description: fmt.Sprintf("cannot update %s", field),
+			})
+		}
+	}
+	if len(violations) > 0 {
+		return nil, &InvalidError{Violations: violations}
+	}
+	return update.Fields, nil
+}
 
-	id := uuid.MustParse(update.ID) // ok to call function which can panic because id has already been validated as a uuid
-
-	rec, err := service.store.ReadOne(ctx, id)
-	if err != nil {
-		if errors.Is(err, userstore.ErrNotFound) {
-			return usr, ErrNotFound
+// validateUpdate validates the ID of the update and each of the fields to be updated
+func (service *Service) validateUpdate(update *Update, fields []string) error {
+	validated := []string{"ID"}
+	for _, field := range fields {
+		validated = append(validated, field)
+		if field == FieldPassword {
+			validated = append(validated, "ConfirmPassword")
 		}
 	}
-	if update.Version != rec.Version {
-		return usr, ErrInvalidVersion
+	if err := service.validate.StructPartial(update, validated...); err != nil {
+		return invalidError(err)
+	}
+	// an empty password leaves the password unchanged when the default fields are updated, but a request which lists
+	// the password must set one, since otherwise it would succeed without changing it
+	if len(update.Fields) > 0 && contains(fields, FieldPassword) && len(update.Password) == 0 {
+		return &InvalidError{Violations: []FieldViolation{
+			{Field: FieldPassword, Rule: "required", Description: "is required"},
+		}}
+	}
+	return nil
+}
+
+func contains(items []string, item string) bool {
+	for _, itm := range items {
+		if itm == item {
+			return true
+		}
 	}
+	return false
+}
 
-	if err = service.updateHashIfSet(update, &rec); err != nil {
+// Update updates a user if the request is valid, references an existing user and no BeforeUpdate hook rejects it.
+// Only the fields listed in update.Fields are modified, or all fields if none are listed. The store checks the version
+// and changes the fields in a single step, so the user is not read first
+func (service *Service) Update(ctx context.Context, update *Update) (usr User, err error) {
+	fields, err := fieldsToUpdate(update)
+	if err == nil {
+		err = service.validateUpdate(update, fields)
+	}
+	if err != nil {
+		service.logger.Errorf(ctx, err, "cannot update invalid user")
+		return usr, err
+	}
+	if err = service.beforeUpdate(ctx, update); err != nil {
 		return usr, err
 	}
 
-	rec.FirstName = update.FirstName
-	rec.LastName = update.LastName
-	rec.Country = update.Country
-	rec.UpdatedAt = utctime.Now()
+	id := uuid.MustParse(update.ID) // ok to call function which can panic because id has already been validated as a uuid
 
-	rec, err = service.store.UpdateOne(ctx, &rec)
+	change := userstore.Change{UpdatedAt: utctime.Now()}
+	for _, field := range fields {
+		switch field {
+		case FieldFirstName:
+			change.FirstName = &update.FirstName
+		case FieldLastName:
+			change.LastName = &update.LastName
+		case FieldCountry:
+			change.Country = &update.Country
+		case FieldAvatarURL:
+			change.AvatarURL = &update.AvatarURL
+		case FieldPassword:
+			if err = service.updateHashIfSet(update, &change); err != nil {
+				return usr, err
+			}
+		}
+	}
+
+	rec, err := service.store.UpdateFields(ctx, id, update.Version, &change)
 	if err != nil {
 		switch {
 		case errors.Is(err, userstore.ErrNotFound):
 			return usr, ErrNotFound
 		case errors.Is(err, userstore.ErrInvalidVersion):
 			return usr, ErrInvalidVersion
+		case errors.Is(err, userstore.ErrTooManyEvents):
+			return usr, ErrUnavailable
 		default:
 			return usr, fmt.Errorf("unexpected error updating user store: %w", err)
 		}
 	}
-	return copyStoreUserToUser(&rec), nil
+	usr = copyStoreUserToUser(&rec)
+	afterChange(ctx, service.hooks.AfterUpdate, &usr)
+	return usr, nil
 }
 
-// Delete deletes a single user, if the referenced user exists
+// Delete deletes a single user, if the referenced user exists and no BeforeDelete hook rejects it
 func (service *Service) Delete(ctx context.Context, ref *Ref) error {
 	if err := service.validate.Struct(ref); err != nil {
-		return ErrInvalid
+		return invalidError(err)
+	}
+	if err := service.beforeDelete(ctx, ref); err != nil {
+		return err
 	}
 
 	id := uuid.MustParse(ref.ID) // TODO: Ensure this is validated before call
@@ -331,16 +625,29 @@ func (service *Service) Delete(ctx context.Context, ref *Ref) error {
 		return fmt.Errorf("cannot delete user: %w", err)
 	}
 
+	service.afterDelete(ctx, ref)
 	return nil
 }
 
-// Find finds a page of users matching the given query
-func (service *Service) Find(ctx context.Context, query *Query) (p Page, err error) {
-	ca, err := time.Parse(TimeFormat, query.CreatedAfter)
-	if err != nil {
-		ca = time.Time{} // pass zero time as the default, because everything is created afterward
-		// This approach could be problematic if users are submitting badly formatted dates because
-		// it hides the error. One solution might be to return the query as it was understoof by the service
+// storeQuery validates query and converts it into a userstore.Query, applying defaults for missing fields
+func (service *Service) storeQuery(query *Query) (*userstore.Query, error) {
+	if err := service.validate.Struct(query); err != nil {
+		return nil, invalidError(err)
+	}
+	var ca time.Time // pass zero time as the default, because everything is created afterward
+	if query.CreatedAfter != "" {
+		// the format has already been validated
+		ca, _ = time.Parse(TimeFormat, query.CreatedAfter)
+	}
+	var createdBefore time.Time
+	if query.CreatedBefore != "" {
+		// the format has already been validated
+		createdBefore, _ = time.Parse(TimeFormat, query.CreatedBefore)
+	}
+	var inactiveSince time.Time
+	if query.InactiveSince != "" {
+		// the format has already been validated
+		inactiveSince, _ = time.Parse(TimeFormat, query.InactiveSince)
 	}
 	if query.Page == 0 {
 		query.Page = DefaultPage
@@ -348,12 +655,36 @@ func (service *Service) Find(ctx context.Context, query *Query) (p Page, err err
 	if query.Length == 0 {
 		query.Length = DefaultLength
 	}
-	page, err := service.store.FindMany(ctx, &userstore.Query{
-		CreatedAfter: ca,
-		Country:      query.Country,
-		Length:       query.Length,
-		Page:         query.Page,
-	})
+	if query.Length > MaxPageLength {
+		query.Length = MaxPageLength
+	}
+	var countries []string
+	if query.Country != "" {
+		countries = append(countries, query.Country)
+	}
+	countries = append(countries, query.Countries...)
+	return &userstore.Query{
+		CreatedAfter:   ca,
+		CreatedBefore:  createdBefore,
+		Countries:      countries,
+		Length:         query.Length,
+		Page:           query.Page,
+		SortBy:         userstore.SortField(query.SortBy),
+		SortDescending: query.SortDirection == SortDescending,
+		Status:         userstore.Status(query.Status),
+		Search:         query.Search,
+		InactiveSince:  inactiveSince,
+		SkipTotal:      query.SkipTotal,
+	}, nil
+}
+
+// Find finds a page of users matching the given query
+func (service *Service) Find(ctx context.Context, query *Query) (p Page, err error) {
+	q, err := service.storeQuery(query)
+	if err != nil {
+		return p, err
+	}
+	page, err := service.store.FindMany(ctx, q)
 	if err != nil {
 		return p, fmt.Errorf("cannot find users in store: %w", err)
 	}
@@ -361,72 +692,183 @@ func (service *Service) Find(ctx context.Context, query *Query) (p Page, err err
 	for _, itm := range page.Items {
 		items = append(items, *sanitizedUserFromUserstoreUser(&itm))
 	}
+	length := int64(q.Length)
+	if q.SkipTotal {
+		return Page{
+			Page:       page.Page,
+			Total:      UnknownTotal,
+			Items:      items,
+			HasNext:    page.HasMore,
+			TotalPages: UnknownTotal,
+		}, nil
+	}
 	return Page{
-		Page:  page.Page,
-		Total: page.Total,
-		Items: items,
+		Page:       page.Page,
+		Total:      page.Total,
+		Items:      items,
+		HasNext:    page.Page*length < page.Total,
+		TotalPages: (page.Total + length - 1) / length,
 	}, nil
 }
 
+// Count counts the users matching the given query. The page, length and sort of the query are ignored
+func (service *Service) Count(ctx context.Context, query *Query) (int64, error) {
+	q, err := service.storeQuery(query)
+	if err != nil {
+		return 0, err
+	}
+	total, err := service.store.Count(ctx, q)
+	if err != nil {
+		return 0, fmt.Errorf("cannot count users in store: %w", err)
+	}
+	return total, nil
+}
+
+// Export calls send with each user matching the given query, without paging. The page and length of the query are
+// ignored. Export stops at the first error returned by send and returns it
+func (service *Service) Export(ctx context.Context, query *Query, send func(*SanitizedUser) error) error {
+	ctx, span := otel.Tracer(telemetry.TraceName).Start(ctx, "Export")
+	defer span.End()
+
+	it, err := service.FindAll(ctx, query)
+	if err != nil {
+		return fmt.Errorf("cannot export users: %w", err)
+	}
+	defer it.Close(ctx)
+
+	for it.Next(ctx) {
+		usr := it.User()
+		if err := send(&usr); err != nil {
+			return err
+		}
+	}
+	if err := it.Err(); err != nil {
+		span.RecordError(err)
+		return fmt.Errorf("cannot export users: %w", err)
+	}
+	return nil
+}
+
 func sanitizedUserFromUserstoreUser(uu *userstore.User) *SanitizedUser {
 	if uu == nil {
 		return nil
 	}
 	return &SanitizedUser{
-		ID:        uu.ID.String(),
-		FirstName: uu.FirstName,
-		LastName:  uu.LastName,
-		Nickname:  uu.Nickname,
-		Email:     uu.Email,
-		Country:   uu.Country,
-		CreatedAt: uu.CreatedAt.Format(TimeFormat),
-		UpdatedAt: uu.UpdatedAt.Format(TimeFormat),
-		Version:   uu.Version,
+		ID:               uu.ID.String(),
+		FirstName:        uu.FirstName,
+		LastName:         uu.LastName,
+		Nickname:         uu.Nickname,
+		Email:            uu.Email,
+		Country:          uu.Country,
+		AvatarURL:        uu.AvatarURL,
+		CreatedAt:        uu.CreatedAt.Format(TimeFormat),
+		UpdatedAt:        uu.UpdatedAt.Format(TimeFormat),
+		Version:          uu.Version,
+		Status:           statusOf(uu.Status),
+		LastLoginAt:      formatActivity(uu.LastLoginAt),
+		LastSeenAt:       formatActivity(uu.LastSeenAt),
+		TwoFactorEnabled: uu.TwoFactorEnabled,
+	}
+}
+
+// formatActivity formats the time of a user's activity with TimeFormat, or returns "" if there has been none
+func formatActivity(at time.Time) string {
+	if at.IsZero() {
+		return ""
 	}
+	return at.Format(TimeFormat)
 }
 
 func eventFromUserstoreEvent(ue *userstore.Event) Event {
-	return Event{
+	evt := Event{
 		ID:        ue.ID.String(),
 		Version:   ue.Version,
 		Action:    string(ue.Action),
 		CreatedAt: ue.CreatedAt.Format(TimeFormat),
 		SentAt:    utctime.Now().Format(TimeFormat),
+		Tenant:    ue.Tenant,
+		Token:     ue.Token,
 		Data:      sanitizedUserFromUserstoreUser(ue.Data),
 	}
+	// the address of a deleted user is only for notifying them, and is not published
+	if ue.Action == userstore.EmailChangeRequested {
+		evt.Email = ue.Email
+	}
+	return evt
+}
+
+// tokenActions are the actions of events which carry a token for the mailer to send to the user. They do not change
+// the user, and only the user should see the token, so they are not sent to watchers
+var tokenActions = map[userstore.Action]bool{
+	userstore.PasswordResetRequested: true,
+	userstore.EmailChangeRequested:   true,
 }
 
-func (service *Service) publishChange(ctx context.Context, ue userstore.Event) {
+// publishChange sends ue to the bus, if config publishes its action, and marks it as processed. An event which is
+// already being sent is skipped, and an event which was sent recently is only marked as processed, so that it is not
+// sent again. An event which cannot be sent is dead lettered once it has been sent the maximum number of times
+func (service *Service) publishChange(ctx context.Context, ue userstore.Event, config *PublishConfig) {
+	key := eventKeyOf(&ue)
+	state := service.published.begin(key)
+	if state == eventSending {
+		service.logger.Infof(ctx, "skipping duplicate of event with id: %s and version: %d which is being sent", ue.ID, ue.Version)
+		return
+	}
+	// the event is dead lettered without the timeout for sending it, which may have passed
+	deadLetter := func() { service.deadLetterIfExhausted(tenant.With(ctx, ue.Tenant), &ue) }
+	// notifications are queued until the service stops publishing, rather than until the event times out
+	publishing := ctx
 	go func() {
-		ctx, cancel := context.WithTimeout(ctx, RetryInterval)
+		// the event is processed in the tenant of its user, so that wrappers of the store can tell which user it is
+		ctx, cancel := context.WithTimeout(tenant.With(ctx, ue.Tenant), RetryInterval)
 		defer cancel()
 
-		result, err := event.SendJSON(eventFromUserstoreEvent(&ue), service.bus)
-		if err != nil {
-			service.logger.Errorf(ctx, err, "error sending event with id:%s and version %d", ue.ID, ue.Version)
-			service.recordEventResult(false)
-			return
-		}
-		err = result.Done(ctx)
-		if err != nil {
-			service.logger.Errorf(ctx, err, "did not confirm sending event with id:%s and version %d", ue.ID, ue.Version)
-			service.recordEventResult(false)
-			return
+		evt := eventFromUserstoreEvent(&ue)
+		switch {
+		case state == eventSent:
+			service.logger.Infof(ctx, "not sending duplicate of event with id: %s and version: %d which was sent", ue.ID, ue.Version)
+		case !config.publishes(ue.Action):
+			service.published.sent(key)
+		default:
+			result, err := event.SendJSON(config.published(evt), service.bus)
+			if err != nil {
+				service.logger.Errorf(ctx, err, "error sending event with id:%s and version %d", ue.ID, ue.Version)
+				service.published.abandon(key)
+				deadLetter()
+				service.recordEventResult(false)
+				return
+			}
+			err = result.Done(ctx)
+			if err != nil {
+				service.logger.Errorf(ctx, err, "did not confirm sending event with id:%s and version %d", ue.ID, ue.Version)
+				service.published.abandon(key)
+				deadLetter()
+				service.recordEventResult(false)
+				return
+			}
+			service.published.sent(key)
 		}
-		if err = service.store.ProcessEvent(ctx, ue.ID, ue.Version); err != nil {
+		if err := service.store.ProcessEvent(ctx, ue.ID, ue.Version); err != nil {
 			service.logger.Errorf(ctx, err, "failed to process event with id:%s and version %d", ue.ID, ue.Version)
 			service.recordEventResult(false)
 			return
 		}
 		service.logger.Infof(ctx, "send event with id: %s and version: %d", ue.ID, ue.Version)
 		service.recordEventResult(true)
+		if state != eventSent {
+			service.notify(publishing, &ue)
+			if !tokenActions[ue.Action] {
+				service.watchers.broadcast(evt)
+			}
+		}
 	}()
 }
 
 // Publish changes promots the service to start listening to the store for change events.
-// and publishing to the services bus
+// and publishing to the services bus. config selects the events which are published
 // To stop listenting, cancel the provided context
-func (service *Service) PublishChanges(ctx context.Context) {
+func (service *Service) PublishChanges(ctx context.Context, config PublishConfig) {
+	service.startNotifying(ctx)
 	events := service.store.Events(ctx, MinPollInterval, MaxPollInterval, RetryInterval)
 Loop:
 	for {
@@ -450,42 +892,10 @@ Loop:
 			service.recordEventResult(false)
 			continue
 		}
-		service.publishChange(ctx, result.Event)
+		service.publishChange(ctx, result.Event, &config)
 	}
 }
 
 func (service *Service) recordEventResult(ok bool) {
-	val := float64(0.0)
-	if ok {
-		val = float64(1.0)
-	}
-	service.eventMtx.Lock()
-	defer service.eventMtx.Unlock()
-	service.eventCount += 1
-	change := (val - service.successRate) / float64(service.eventCount)
-	service.successRate += change
-}
-
-// CheckEventSuccessRateAndReset returns the proportion of events which were successfully published since the last request, and resets the counter
-// It can be used by a health check
-func (service *Service) CheckEventSuccessRateAndReset() float64 {
-	service.eventMtx.Lock()
-	defer service.eventMtx.Unlock()
-
-	// if there have been no events, return 100%
-	if service.eventCount == 0 {
-		return 1.0
-	}
-
-	rate := service.successRate
-	service.eventCount = 0
-	service.successRate = 0.0
-	return rate
-}
-
-// CheckEventCount returns the number of events recorded since the last reset
-func (service *Service) CheckEventCount() int64 {
-	service.eventMtx.Lock()
-	defer service.eventMtx.Unlock()
-	return service.eventCount
+	service.eventResults.record(ok, utctime.Now())
 }
@@ -8,7 +8,6 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/robotlovesyou/fitest/pkg/event"
-	"github.com/robotlovesyou/fitest/pkg/log"
 	"github.com/robotlovesyou/fitest/pkg/password"
 	"github.com/robotlovesyou/fitest/pkg/store/userstore"
 	"github.com/robotlovesyou/fitest/pkg/user"
@@ -18,6 +17,9 @@ import (
 
 const bobbyTables = "Robert'); DROP TABLE Students;--"
 
+// avatarHost is the host avatar URLs are allowed on by the services created by withService
+const avatarHost = "images.example.com"
+
 ////////////////////////////////////////////////////////////////////////////////
 ////////////////////////////////////////////////////////////////////////////////
 ////
@@ -28,22 +30,98 @@ const bobbyTables = "Robert'); DROP TABLE Students;--"
 ////////////////////////////////////////////////////////////////////////////////
 ////////////////////////////////////////////////////////////////////////////////
 
+// nopLogger discards everything logged by the code under test
+type nopLogger struct{}
+
+func (nopLogger) Infof(context.Context, string, ...any) {}
+
+func (nopLogger) Errorf(context.Context, error, string, ...any) {}
+
 type stubCreate func(context.Context, *userstore.User) (userstore.User, error)
-type stubUpdateOne func(context.Context, *userstore.User) (userstore.User, error)
+type stubCreateWithKey func(context.Context, *userstore.User, string) (userstore.User, error)
+type stubCreateMany func(context.Context, []userstore.User) ([]error, error)
+type stubUpdateFields func(context.Context, uuid.UUID, int64, *userstore.Change) (userstore.User, error)
+type stubChangePassword func(context.Context, *userstore.User) (userstore.User, error)
+type stubAnonymize func(context.Context, *userstore.User) (userstore.User, error)
+type stubChangeStatus func(context.Context, *userstore.User) (userstore.User, error)
+type stubRequestPasswordReset func(context.Context, uuid.UUID, string, userstore.ResetToken) error
+type stubResetPassword func(context.Context, string, string) (userstore.User, error)
+type stubRequestEmailChange func(context.Context, uuid.UUID, int64, string, userstore.EmailChange) error
+type stubConfirmEmailChange func(context.Context, string) (userstore.User, error)
 type stubReadOne func(context.Context, uuid.UUID) (userstore.User, error)
+type stubReadMany func(context.Context, []uuid.UUID) ([]userstore.User, error)
+type stubReadRecord func(context.Context, uuid.UUID) (userstore.Record, error)
+type stubFindByEmail func(context.Context, string) (userstore.User, error)
+type stubFindByNickname func(context.Context, string) (userstore.User, error)
+type stubExists func(context.Context, string) (bool, error)
 type stubDeleteOne func(context.Context, uuid.UUID) error
+type stubDeleteMany func(context.Context, []uuid.UUID) ([]uuid.UUID, error)
+type stubChangeNickname func(context.Context, uuid.UUID, int64, string, time.Duration) (userstore.User, error)
+type stubRestore func(context.Context, uuid.UUID) (userstore.User, error)
+type stubReplay func(context.Context, uuid.UUID) (userstore.User, error)
+type stubPurge func(context.Context) (int64, error)
+type stubMarkDormant func(context.Context, time.Time) (int64, error)
 type stubFindMany func(context.Context, *userstore.Query) (userstore.Page, error)
+type stubCount func(context.Context, *userstore.Query) (int64, error)
+type stubStats func(context.Context, *userstore.Query, userstore.StatsInterval) (userstore.Stats, error)
+type stubIterate func(context.Context, *userstore.Query) (userstore.UserIterator, error)
+type stubBacklog func(context.Context) (userstore.Backlog, error)
 type stubEvents func(context.Context, time.Duration, time.Duration, time.Duration) <-chan userstore.EventResult
 type stubProcessEvent func(ctx context.Context, id uuid.UUID, version int64) error
+type stubDeadLetterEvent func(ctx context.Context, id uuid.UUID, version int64) error
+type stubDeadLetters func(context.Context) ([]userstore.Event, error)
+type stubRequeueDeadLetter func(context.Context, uuid.UUID) error
+type stubRecordLogin func(context.Context, uuid.UUID, time.Time) error
+type stubTouchLastSeen func(context.Context, uuid.UUID, time.Time) error
+type stubBeginTwoFactor func(context.Context, uuid.UUID, string) error
+type stubEnableTwoFactor func(context.Context, uuid.UUID, string, int64, []string) (userstore.User, error)
+type stubDisableTwoFactor func(context.Context, uuid.UUID) (userstore.User, error)
+type stubUseTwoFactorStep func(context.Context, uuid.UUID, int64) error
+type stubUseRecoveryCode func(context.Context, uuid.UUID, string) error
 
 type stubUserStore struct {
-	stubCreate       stubCreate
-	stubUpdateOne    stubUpdateOne
-	stubReadOne      stubReadOne
-	stubDeleteOne    stubDeleteOne
-	stubFindMany     stubFindMany
-	stubEvents       stubEvents
-	stubProcessEvent stubProcessEvent
+	stubCreate               stubCreate
+	stubCreateWithKey        stubCreateWithKey
+	stubCreateMany           stubCreateMany
+	stubUpdateFields         stubUpdateFields
+	stubChangePassword       stubChangePassword
+	stubAnonymize            stubAnonymize
+	stubChangeStatus         stubChangeStatus
+	stubRequestPasswordReset stubRequestPasswordReset
+	stubResetPassword        stubResetPassword
+	stubRequestEmailChange   stubRequestEmailChange
+	stubConfirmEmailChange   stubConfirmEmailChange
+	stubReadOne              stubReadOne
+	stubReadMany             stubReadMany
+	stubReadRecord           stubReadRecord
+	stubFindByEmail          stubFindByEmail
+	stubFindByNickname       stubFindByNickname
+	stubEmailExists          stubExists
+	stubNicknameExists       stubExists
+	stubDeleteOne            stubDeleteOne
+	stubDeleteMany           stubDeleteMany
+	stubChangeNickname       stubChangeNickname
+	stubRestore              stubRestore
+	stubReplay               stubReplay
+	stubPurge                stubPurge
+	stubMarkDormant          stubMarkDormant
+	stubFindMany             stubFindMany
+	stubCount                stubCount
+	stubStats                stubStats
+	stubIterate              stubIterate
+	stubEvents               stubEvents
+	stubBacklog              stubBacklog
+	stubProcessEvent         stubProcessEvent
+	stubDeadLetterEvent      stubDeadLetterEvent
+	stubDeadLetters          stubDeadLetters
+	stubRequeueDeadLetter    stubRequeueDeadLetter
+	stubRecordLogin          stubRecordLogin
+	stubTouchLastSeen        stubTouchLastSeen
+	stubBeginTwoFactor       stubBeginTwoFactor
+	stubEnableTwoFactor      stubEnableTwoFactor
+	stubDisableTwoFactor     stubDisableTwoFactor
+	stubUseTwoFactorStep     stubUseTwoFactorStep
+	stubUseRecoveryCode      stubUseRecoveryCode
 }
 
 func newStubUserStore() *stubUserStore {
@@ -51,24 +129,129 @@ func newStubUserStore() *stubUserStore {
 		stubCreate: func(context.Context, *userstore.User) (userstore.User, error) {
 			panic("stub create")
 		},
-		stubUpdateOne: func(context.Context, *userstore.User) (userstore.User, error) {
-			panic("stub update")
+		stubCreateWithKey: func(context.Context, *userstore.User, string) (userstore.User, error) {
+			panic("stub create with key")
+		},
+		stubCreateMany: func(context.Context, []userstore.User) ([]error, error) {
+			panic("stub create many")
+		},
+		stubUpdateFields: func(context.Context, uuid.UUID, int64, *userstore.Change) (userstore.User, error) {
+			panic("stub update fields")
+		},
+		stubChangePassword: func(context.Context, *userstore.User) (userstore.User, error) {
+			panic("stub change password")
+		},
+		stubAnonymize: func(context.Context, *userstore.User) (userstore.User, error) {
+			panic("stub anonymize")
+		},
+		stubChangeStatus: func(context.Context, *userstore.User) (userstore.User, error) {
+			panic("stub change status")
+		},
+		stubRequestPasswordReset: func(context.Context, uuid.UUID, string, userstore.ResetToken) error {
+			panic("stub request password reset")
+		},
+		stubResetPassword: func(context.Context, string, string) (userstore.User, error) {
+			panic("stub reset password")
+		},
+		stubRequestEmailChange: func(context.Context, uuid.UUID, int64, string, userstore.EmailChange) error {
+			panic("stub request email change")
+		},
+		stubConfirmEmailChange: func(context.Context, string) (userstore.User, error) {
+			panic("stub confirm email change")
 		},
 		stubReadOne: func(context.Context, uuid.UUID) (userstore.User, error) {
 			panic("stub read one")
 		},
+		stubReadMany: func(context.Context, []uuid.UUID) ([]userstore.User, error) {
+			panic("stub read many")
+		},
+		stubReadRecord: func(context.Context, uuid.UUID) (userstore.Record, error) {
+			panic("stub read record")
+		},
+		stubFindByEmail: func(context.Context, string) (userstore.User, error) {
+			panic("stub find by email")
+		},
+		stubFindByNickname: func(context.Context, string) (userstore.User, error) {
+			panic("stub find by nickname")
+		},
+		stubEmailExists: func(context.Context, string) (bool, error) {
+			panic("stub email exists")
+		},
+		stubNicknameExists: func(context.Context, string) (bool, error) {
+			panic("stub nickname exists")
+		},
 		stubDeleteOne: func(context.Context, uuid.UUID) error {
 			panic("stub delete one")
 		},
+		stubDeleteMany: func(context.Context, []uuid.UUID) ([]uuid.UUID, error) {
+			panic("stub delete many")
+		},
+		stubChangeNickname: func(context.Context, uuid.UUID, int64, string, time.Duration) (userstore.User, error) {
+			panic("stub change nickname")
+		},
+		stubRestore: func(context.Context, uuid.UUID) (userstore.User, error) {
+			panic("stub restore")
+		},
+		stubReplay: func(context.Context, uuid.UUID) (userstore.User, error) {
+			panic("stub replay")
+		},
+		stubPurge: func(context.Context) (int64, error) {
+			panic("stub purge")
+		},
+		stubMarkDormant: func(context.Context, time.Time) (int64, error) {
+			panic("stub mark dormant")
+		},
 		stubFindMany: func(context.Context, *userstore.Query) (userstore.Page, error) {
 			panic("stub find many")
 		},
+		stubCount: func(context.Context, *userstore.Query) (int64, error) {
+			panic("stub count")
+		},
+		stubStats: func(context.Context, *userstore.Query, userstore.StatsInterval) (userstore.Stats, error) {
+			panic("stub stats")
+		},
+		stubIterate: func(context.Context, *userstore.Query) (userstore.UserIterator, error) {
+			panic("stub iterate")
+		},
 		stubEvents: func(context.Context, time.Duration, time.Duration, time.Duration) <-chan userstore.EventResult {
 			panic("stub events")
 		},
+		stubBacklog: func(context.Context) (userstore.Backlog, error) {
+			panic("stub backlog")
+		},
 		stubProcessEvent: func(ctx context.Context, id uuid.UUID, version int64) error {
 			panic("stub process event")
 		},
+		stubDeadLetterEvent: func(ctx context.Context, id uuid.UUID, version int64) error {
+			panic("stub dead letter event")
+		},
+		stubDeadLetters: func(context.Context) ([]userstore.Event, error) {
+			panic("stub dead letters")
+		},
+		stubRequeueDeadLetter: func(context.Context, uuid.UUID) error {
+			panic("stub requeue dead letter")
+		},
+		stubRecordLogin: func(context.Context, uuid.UUID, time.Time) error {
+			panic("stub record login")
+		},
+		stubTouchLastSeen: func(context.Context, uuid.UUID, time.Time) error {
+			panic("stub touch last seen")
+		},
+		stubBeginTwoFactor: func(context.Context, uuid.UUID, string) error {
+			panic("stub begin two factor")
+		},
+		stubEnableTwoFactor: func(context.Context, uuid.UUID, string, int64, []string) (userstore.User, error) {
+			panic("stub enable two factor")
+		},
+		stubDisableTwoFactor: func(context.Context, uuid.UUID) (userstore.User, error) {
+			panic("stub disable two factor")
+		},
+		stubUseTwoFactorStep: func(context.Context, uuid.UUID, int64) error {
+			panic("stub use two factor step")
+		},
+		stubUseRecoveryCode: func(context.Context, uuid.UUID, string) error {
+			panic("stub use recovery code")
+		},
 	}
 }
 
@@ -76,30 +259,170 @@ func (store *stubUserStore) Create(ctx context.Context, rec *userstore.User) (us
 	return store.stubCreate(ctx, rec)
 }
 
-func (store *stubUserStore) UpdateOne(ctx context.Context, rec *userstore.User) (userstore.User, error) {
-	return store.stubUpdateOne(ctx, rec)
+func (store *stubUserStore) CreateWithKey(ctx context.Context, rec *userstore.User, key string) (userstore.User, error) {
+	return store.stubCreateWithKey(ctx, rec, key)
+}
+
+func (store *stubUserStore) CreateMany(ctx context.Context, recs []userstore.User) ([]error, error) {
+	return store.stubCreateMany(ctx, recs)
+}
+
+func (store *stubUserStore) UpdateFields(ctx context.Context, id uuid.UUID, version int64, change *userstore.Change) (userstore.User, error) {
+	return store.stubUpdateFields(ctx, id, version, change)
+}
+
+func (store *stubUserStore) ChangePassword(ctx context.Context, rec *userstore.User) (userstore.User, error) {
+	return store.stubChangePassword(ctx, rec)
+}
+
+func (store *stubUserStore) Anonymize(ctx context.Context, rec *userstore.User) (userstore.User, error) {
+	return store.stubAnonymize(ctx, rec)
+}
+
+func (store *stubUserStore) ChangeStatus(ctx context.Context, update *userstore.User) (userstore.User, error) {
+	return store.stubChangeStatus(ctx, update)
+}
+
+func (store *stubUserStore) RequestPasswordReset(ctx context.Context, id uuid.UUID, token string, reset userstore.ResetToken) error {
+	return store.stubRequestPasswordReset(ctx, id, token, reset)
+}
+
+func (store *stubUserStore) ResetPassword(ctx context.Context, tokenHash, passwordHash string) (userstore.User, error) {
+	return store.stubResetPassword(ctx, tokenHash, passwordHash)
+}
+
+func (store *stubUserStore) RequestEmailChange(ctx context.Context, id uuid.UUID, version int64, token string, change userstore.EmailChange) error {
+	return store.stubRequestEmailChange(ctx, id, version, token, change)
+}
+
+func (store *stubUserStore) ConfirmEmailChange(ctx context.Context, tokenHash string) (userstore.User, error) {
+	return store.stubConfirmEmailChange(ctx, tokenHash)
 }
 
 func (store *stubUserStore) ReadOne(ctx context.Context, id uuid.UUID) (userstore.User, error) {
 	return store.stubReadOne(ctx, id)
 }
 
+func (store *stubUserStore) ReadMany(ctx context.Context, ids []uuid.UUID) ([]userstore.User, error) {
+	return store.stubReadMany(ctx, ids)
+}
+
+func (store *stubUserStore) ReadRecord(ctx context.Context, id uuid.UUID) (userstore.Record, error) {
+	return store.stubReadRecord(ctx, id)
+}
+
+func (store *stubUserStore) FindByEmail(ctx context.Context, email string) (userstore.User, error) {
+	return store.stubFindByEmail(ctx, email)
+}
+
+func (store *stubUserStore) FindByNickname(ctx context.Context, nickname string) (userstore.User, error) {
+	return store.stubFindByNickname(ctx, nickname)
+}
+
+func (store *stubUserStore) EmailExists(ctx context.Context, email string) (bool, error) {
+	return store.stubEmailExists(ctx, email)
+}
+
+func (store *stubUserStore) NicknameExists(ctx context.Context, nickname string) (bool, error) {
+	return store.stubNicknameExists(ctx, nickname)
+}
+
 func (store *stubUserStore) DeleteOne(ctx context.Context, id uuid.UUID) error {
 	return store.stubDeleteOne(ctx, id)
 }
 
+func (store *stubUserStore) DeleteMany(ctx context.Context, ids []uuid.UUID) ([]uuid.UUID, error) {
+	return store.stubDeleteMany(ctx, ids)
+}
+
+func (store *stubUserStore) ChangeNickname(ctx context.Context, id uuid.UUID, version int64, nickname string, cooldown time.Duration) (userstore.User, error) {
+	return store.stubChangeNickname(ctx, id, version, nickname, cooldown)
+}
+
+func (store *stubUserStore) Restore(ctx context.Context, id uuid.UUID) (userstore.User, error) {
+	return store.stubRestore(ctx, id)
+}
+
+func (store *stubUserStore) Replay(ctx context.Context, id uuid.UUID) (userstore.User, error) {
+	return store.stubReplay(ctx, id)
+}
+
+func (store *stubUserStore) Purge(ctx context.Context) (int64, error) {
+	return store.stubPurge(ctx)
+}
+
+func (store *stubUserStore) MarkDormant(ctx context.Context, inactiveSince time.Time) (int64, error) {
+	return store.stubMarkDormant(ctx, inactiveSince)
+}
+
 func (store *stubUserStore) FindMany(ctx context.Context, query *userstore.Query) (userstore.Page, error) {
 	return store.stubFindMany(ctx, query)
 }
 
+func (store *stubUserStore) Count(ctx context.Context, query *userstore.Query) (int64, error) {
+	return store.stubCount(ctx, query)
+}
+
+func (store *stubUserStore) Stats(ctx context.Context, query *userstore.Query, interval userstore.StatsInterval) (userstore.Stats, error) {
+	return store.stubStats(ctx, query, interval)
+}
+
+func (store *stubUserStore) Iterate(ctx context.Context, query *userstore.Query) (userstore.UserIterator, error) {
+	return store.stubIterate(ctx, query)
+}
+
 func (store *stubUserStore) Events(ctx context.Context, minInterval, maxInterval, retryTimeout time.Duration) <-chan userstore.EventResult {
 	return store.stubEvents(ctx, minInterval, maxInterval, retryTimeout)
 }
 
+func (store *stubUserStore) Backlog(ctx context.Context) (userstore.Backlog, error) {
+	return store.stubBacklog(ctx)
+}
+
 func (store *stubUserStore) ProcessEvent(ctx context.Context, id uuid.UUID, version int64) error {
 	return store.stubProcessEvent(ctx, id, version)
 }
 
+func (store *stubUserStore) DeadLetterEvent(ctx context.Context, id uuid.UUID, version int64) error {
+	return store.stubDeadLetterEvent(ctx, id, version)
+}
+
+func (store *stubUserStore) DeadLetters(ctx context.Context) ([]userstore.Event, error) {
+	return store.stubDeadLetters(ctx)
+}
+
+func (store *stubUserStore) RequeueDeadLetter(ctx context.Context, id uuid.UUID) error {
+	return store.stubRequeueDeadLetter(ctx, id)
+}
+
+func (store *stubUserStore) RecordLogin(ctx context.Context, id uuid.UUID, at time.Time) error {
+	return store.stubRecordLogin(ctx, id, at)
+}
+
+func (store *stubUserStore) TouchLastSeen(ctx context.Context, id uuid.UUID, at time.Time) error {
+	return store.stubTouchLastSeen(ctx, id, at)
+}
+
+func (store *stubUserStore) BeginTwoFactor(ctx context.Context, id uuid.UUID, pendingSecret string) error {
+	return store.stubBeginTwoFactor(ctx, id, pendingSecret)
+}
+
+func (store *stubUserStore) EnableTwoFactor(ctx context.Context, id uuid.UUID, pendingSecret string, step int64, recoveryCodes []string) (userstore.User, error) {
+	return store.stubEnableTwoFactor(ctx, id, pendingSecret, step, recoveryCodes)
+}
+
+func (store *stubUserStore) DisableTwoFactor(ctx context.Context, id uuid.UUID) (userstore.User, error) {
+	return store.stubDisableTwoFactor(ctx, id)
+}
+
+func (store *stubUserStore) UseTwoFactorStep(ctx context.Context, id uuid.UUID, step int64) error {
+	return store.stubUseTwoFactorStep(ctx, id, step)
+}
+
+func (store *stubUserStore) UseRecoveryCode(ctx context.Context, id uuid.UUID, codeHash string) error {
+	return store.stubUseRecoveryCode(ctx, id, codeHash)
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 ////////////////////////////////////////////////////////////////////////////////
 ////
@@ -153,10 +476,32 @@ func useBus(bus event.Bus) busOpt {
 	return busOpt{bus: bus}
 }
 
+type countriesOpt struct {
+	countries validation.CountryPolicy
+}
+
+func (countriesOpt) isoption() {}
+
+func useCountries(countries validation.CountryPolicy) countriesOpt {
+	return countriesOpt{countries: countries}
+}
+
+type twoFactorOpt struct {
+	config user.TwoFactorConfig
+}
+
+func (twoFactorOpt) isoption() {}
+
+func useTwoFactor(config user.TwoFactorConfig) twoFactorOpt {
+	return twoFactorOpt{config: config}
+}
+
 func withService(store *stubUserStore, options ...option) func(func(*user.Service)) {
 	hasher := user.PasswordHasher(password.NewWeak())
 	idGenerator := uuid.NewRandom
 	var bus event.Bus = event.New()
+	var countries validation.CountryPolicy = validation.CountryList{}
+	var twoFactor *user.TwoFactorConfig
 
 	for _, o := range options {
 		switch opt := o.(type) {
@@ -166,15 +511,23 @@ func withService(store *stubUserStore, options ...option) func(func(*user.Servic
 			idGenerator = opt.idGenerator
 		case busOpt:
 			bus = opt.bus
+		case countriesOpt:
+			countries = opt.countries
+		case twoFactorOpt:
+			twoFactor = &opt.config
 		}
 	}
 
 	return func(f func(service *user.Service)) {
-		logger, err := log.New("user tests")
-		if err != nil {
-			panic(err)
+		logger := nopLogger{}
+		service := user.New(store, hasher, idGenerator, validation.NewWithPolicy(validation.Policy{
+			Countries:   countries,
+			AvatarHosts: []string{avatarHost},
+		}), bus, logger)
+		if twoFactor != nil {
+			service.UseTwoFactor(*twoFactor)
 		}
-		f(user.New(store, hasher, idGenerator, validation.New(), bus, logger))
+		f(service)
 	}
 }
 
@@ -0,0 +1,76 @@
+package user
+
+import (
+	"context"
+	"sync"
+
+	"github.com/robotlovesyou/fitest/pkg/tenant"
+)
+
+const (
+	// WatchBufferSize is the number of events which can be queued for a watcher before it is considered
+	// too slow and is disconnected. It should be configurable
+	WatchBufferSize = 100
+)
+
+// watchers fans out published events to any number of subscribers. Each subscriber only receives the events of
+// its own tenant
+type watchers struct {
+	mtx  sync.Mutex
+	subs map[chan Event]string
+}
+
+func newWatchers() *watchers {
+	return &watchers{subs: make(map[chan Event]string)}
+}
+
+// subscribe adds a new subscriber for the tenant of ctx which will be removed when ctx is done
+func (w *watchers) subscribe(ctx context.Context) <-chan Event {
+	sub := make(chan Event, WatchBufferSize)
+	w.mtx.Lock()
+	w.subs[sub] = tenant.FromContext(ctx)
+	w.mtx.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		w.remove(sub)
+	}()
+	return sub
+}
+
+// remove removes and closes the subscriber, unless it has already been removed
+func (w *watchers) remove(sub chan Event) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	if _, ok := w.subs[sub]; ok {
+		delete(w.subs, sub)
+		close(sub)
+	}
+}
+
+// broadcast sends e to every subscriber for the tenant of e without blocking.
+// A subscriber whose buffer is full is removed, closing its channel, so that it can
+// reconnect rather than silently miss events
+func (w *watchers) broadcast(e Event) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	for sub, tenantID := range w.subs {
+		if tenantID != e.Tenant {
+			continue
+		}
+		select {
+		case sub <- e:
+		default:
+			delete(w.subs, sub)
+			close(sub)
+		}
+	}
+}
+
+// Watch subscribes to the change events published by the service for users of the tenant of ctx.
+// Events are only delivered once they have been confirmed by the bus, so a watcher sees the same
+// at least once stream as the bus consumers.
+// The returned channel is closed when ctx is done, or if the watcher falls more than WatchBufferSize events behind
+func (service *Service) Watch(ctx context.Context) <-chan Event {
+	return service.watchers.subscribe(ctx)
+}
@@ -0,0 +1,167 @@
+package user_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robotlovesyou/fitest/pkg/event"
+	"github.com/robotlovesyou/fitest/pkg/store/userstore"
+	"github.com/robotlovesyou/fitest/pkg/tenant"
+	"github.com/robotlovesyou/fitest/pkg/user"
+	"github.com/stretchr/testify/require"
+)
+
+// sendEvents returns a stub of store.Events which sends each of the provided events
+func sendEvents(events ...userstore.Event) stubEvents {
+	return func(ctx context.Context, _, _, _ time.Duration) <-chan userstore.EventResult {
+		out := make(chan userstore.EventResult)
+		go func() {
+			for _, e := range events {
+				select {
+				case out <- userstore.EventResult{Event: e}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+		return out
+	}
+}
+
+func TestWatchersReceivePublishedEvents(t *testing.T) {
+	store := newStubUserStore()
+	eventStub := newEventStub()
+	withService(store, useBus(eventStub))(func(service *user.Service) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		eventStub.sendStub = func([]byte) event.Result {
+			return happySendResult{}
+		}
+		store.stubProcessEvent = func(context.Context, uuid.UUID, int64) error {
+			return nil
+		}
+		published := eventForUserRecord(fakeUserRecord())
+		store.stubEvents = sendEvents(published)
+
+		first := service.Watch(ctx)
+		second := service.Watch(ctx)
+		go service.PublishChanges(ctx, user.PublishConfig{})
+
+		for _, watcher := range []<-chan user.Event{first, second} {
+			select {
+			case evt := <-watcher:
+				compareUserstoreEventAndUserEvent(published, evt, t)
+			case <-time.After(time.Second):
+				t.Fatal("watcher did not receive event")
+			}
+		}
+	})
+}
+
+func TestWatchersOnlyReceiveEventsOfTheirTenant(t *testing.T) {
+	store := newStubUserStore()
+	eventStub := newEventStub()
+	withService(store, useBus(eventStub))(func(service *user.Service) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		eventStub.sendStub = func([]byte) event.Result {
+			return happySendResult{}
+		}
+		store.stubProcessEvent = func(context.Context, uuid.UUID, int64) error {
+			return nil
+		}
+		other := eventForUserRecord(fakeUserRecord())
+		other.Tenant = "other"
+		published := eventForUserRecord(fakeUserRecord())
+		published.Tenant = "acme"
+		store.stubEvents = sendEvents(other, published)
+
+		watcher := service.Watch(tenant.With(ctx, "acme"))
+		go service.PublishChanges(ctx, user.PublishConfig{})
+
+		select {
+		case evt := <-watcher:
+			compareUserstoreEventAndUserEvent(published, evt, t)
+			require.Equal(t, "acme", evt.Tenant)
+		case <-time.After(time.Second):
+			t.Fatal("watcher did not receive event")
+		}
+	})
+}
+
+func TestWatchersDoNotReceivePasswordResetRequests(t *testing.T) {
+	store := newStubUserStore()
+	eventStub := newEventStub()
+	withService(store, useBus(eventStub))(func(service *user.Service) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		eventStub.sendStub = func([]byte) event.Result {
+			return happySendResult{}
+		}
+		store.stubProcessEvent = func(context.Context, uuid.UUID, int64) error {
+			return nil
+		}
+		reset := eventForUserRecord(fakeUserRecord())
+		reset.Action = userstore.PasswordResetRequested
+		reset.Token = "token"
+		published := eventForUserRecord(fakeUserRecord())
+		store.stubEvents = sendEvents(reset, published)
+
+		watcher := service.Watch(ctx)
+		go service.PublishChanges(ctx, user.PublishConfig{})
+
+		select {
+		case evt := <-watcher:
+			compareUserstoreEventAndUserEvent(published, evt, t)
+		case <-time.After(time.Second):
+			t.Fatal("watcher did not receive event")
+		}
+	})
+}
+
+func TestWatchersDoNotReceiveUnconfirmedEvents(t *testing.T) {
+	store := newStubUserStore()
+	eventStub := newEventStub()
+	withService(store, useBus(eventStub))(func(service *user.Service) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		eventStub.sendStub = func([]byte) event.Result {
+			return sadSendResult{}
+		}
+		store.stubEvents = sendEvents(eventForUserRecord(fakeUserRecord()))
+
+		watcher := service.Watch(ctx)
+		go service.PublishChanges(ctx, user.PublishConfig{})
+
+		for service.CheckEventCount() < 1 {
+			time.Sleep(10 * time.Millisecond)
+		}
+		select {
+		case <-watcher:
+			t.Fatal("watcher received an event which was not confirmed by the bus")
+		default:
+		}
+	})
+}
+
+func TestWatchIsClosedWhenContextIsDone(t *testing.T) {
+	store := newStubUserStore()
+	withService(store)(func(service *user.Service) {
+		ctx, cancel := context.WithCancel(context.Background())
+		watcher := service.Watch(ctx)
+		cancel()
+
+		select {
+		case _, more := <-watcher:
+			require.False(t, more)
+		case <-time.After(time.Second):
+			t.Fatal("watcher was not closed")
+		}
+	})
+}
@@ -4,13 +4,119 @@
 package validation
 
 import (
+	"fmt"
+	"net/url"
 	"regexp"
+	"strings"
 
 	"github.com/go-playground/validator/v10"
 )
 
+// CountryPolicy decides which countries users may be registered in. It is applied to fields with the
+// allowed-country tag, after they have been validated as ISO 3166-1 alpha-2 country codes
+type CountryPolicy interface {
+	Allows(country string) bool
+}
+
+// CountryList is a CountryPolicy which allows the countries in Allow, or every country if Allow is empty, except the
+// countries in Deny. The zero value allows every country
+type CountryList struct {
+	Allow []string
+	Deny  []string
+}
+
+// Allows implements CountryPolicy
+func (list CountryList) Allows(country string) bool {
+	country = strings.ToUpper(country)
+	for _, denied := range list.Deny {
+		if denied == country {
+			return false
+		}
+	}
+	if len(list.Allow) == 0 {
+		return true
+	}
+	for _, allowed := range list.Allow {
+		if allowed == country {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseCountries parses a comma separated list of ISO 3166-1 alpha-2 country codes, e.g. DE,FR, for a CountryList.
+// Codes are converted to upper case. An empty list returns no countries
+func ParseCountries(list string) ([]string, error) {
+	if list == "" {
+		return nil, nil
+	}
+	v := validator.New()
+	var countries []string
+	for _, country := range strings.Split(list, ",") {
+		country = strings.ToUpper(strings.TrimSpace(country))
+		if err := v.Var(country, "iso3166_1_alpha2"); err != nil {
+			return nil, fmt.Errorf("unknown country '%s'", country)
+		}
+		countries = append(countries, country)
+	}
+	return countries, nil
+}
+
+// ParseHosts parses a comma separated list of host names, e.g. images.example.com,cdn.example.com, for the
+// AvatarHosts of a Policy. Names are converted to lower case. An empty list returns no hosts
+func ParseHosts(list string) ([]string, error) {
+	if list == "" {
+		return nil, nil
+	}
+	v := validator.New()
+	var hosts []string
+	for _, host := range strings.Split(list, ",") {
+		host = strings.ToLower(strings.TrimSpace(host))
+		if err := v.Var(host, "hostname_rfc1123"); err != nil {
+			return nil, fmt.Errorf("invalid host '%s'", host)
+		}
+		hosts = append(hosts, host)
+	}
+	return hosts, nil
+}
+
+// Policy holds the configurable rules applied by a validator
+type Policy struct {
+	// Countries decides which countries users may be registered in, for fields with the allowed-country tag. When it
+	// is nil every country is allowed
+	Countries CountryPolicy
+	// AvatarHosts lists the hosts which the https URLs of fields with the avatar-url tag may refer to. When it is
+	// empty no avatar URLs are allowed, so that users cannot point other clients at hosts which track them
+	AvatarHosts []string
+}
+
+// avatarURL returns true if value is an https URL on one of hosts
+func avatarURL(value string, hosts []string) bool {
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme != "https" || u.User != nil || u.Hostname() == "" {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, allowed := range hosts {
+		if allowed == host {
+			return true
+		}
+	}
+	return false
+}
+
+// New creates a validator which allows every country, and no avatar URLs
 func New() *validator.Validate {
+	return NewWithPolicy(Policy{})
+}
+
+// NewWithPolicy creates a validator which applies policy
+func NewWithPolicy(policy Policy) *validator.Validate {
 	v := validator.New()
+	countries := policy.Countries
+	if countries == nil {
+		countries = CountryList{}
+	}
 
 	// double quote ('"') is included here because of a bug in go faker,
 	// which includes it in first names where it should be a single quote
@@ -19,5 +125,11 @@ func New() *validator.Validate {
 	v.RegisterValidation("allowed-runes", func(fl validator.FieldLevel) bool {
 		return allowedRunesRegexp.MatchString(fl.Field().String())
 	})
+	v.RegisterValidation("allowed-country", func(fl validator.FieldLevel) bool {
+		return countries.Allows(fl.Field().String())
+	})
+	v.RegisterValidation("avatar-url", func(fl validator.FieldLevel) bool {
+		return avatarURL(fl.Field().String(), policy.AvatarHosts)
+	})
 	return v
 }
@@ -0,0 +1,3105 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: v2/users.proto
+
+// Version 2 of the users API. It replaces the string timestamps and actions of version 1 with
+// google.protobuf.Timestamp and enums. Version 1 is served alongside it during migration
+
+package userspbv2
+
+import (
+	_ "buf.build/gen/go/bufbuild/protovalidate/protocolbuffers/go/buf/validate"
+	_ "google.golang.org/genproto/googleapis/api/annotations"
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	emptypb "google.golang.org/protobuf/types/known/emptypb"
+	fieldmaskpb "google.golang.org/protobuf/types/known/fieldmaskpb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type UserStatus int32
+
+const (
+	UserStatus_USER_STATUS_UNSPECIFIED UserStatus = 0
+	UserStatus_USER_STATUS_ACTIVE      UserStatus = 1
+	UserStatus_USER_STATUS_SUSPENDED   UserStatus = 2
+	UserStatus_USER_STATUS_BANNED      UserStatus = 3
+	UserStatus_USER_STATUS_DORMANT     UserStatus = 4
+)
+
+// Enum value maps for UserStatus.
+var (
+	UserStatus_name = map[int32]string{
+		0: "USER_STATUS_UNSPECIFIED",
+		1: "USER_STATUS_ACTIVE",
+		2: "USER_STATUS_SUSPENDED",
+		3: "USER_STATUS_BANNED",
+		4: "USER_STATUS_DORMANT",
+	}
+	UserStatus_value = map[string]int32{
+		"USER_STATUS_UNSPECIFIED": 0,
+		"USER_STATUS_ACTIVE":      1,
+		"USER_STATUS_SUSPENDED":   2,
+		"USER_STATUS_BANNED":      3,
+		"USER_STATUS_DORMANT":     4,
+	}
+)
+
+func (x UserStatus) Enum() *UserStatus {
+	p := new(UserStatus)
+	*p = x
+	return p
+}
+
+func (x UserStatus) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (UserStatus) Descriptor() protoreflect.EnumDescriptor {
+	return file_v2_users_proto_enumTypes[0].Descriptor()
+}
+
+func (UserStatus) Type() protoreflect.EnumType {
+	return &file_v2_users_proto_enumTypes[0]
+}
+
+func (x UserStatus) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use UserStatus.Descriptor instead.
+func (UserStatus) EnumDescriptor() ([]byte, []int) {
+	return file_v2_users_proto_rawDescGZIP(), []int{0}
+}
+
+type SortField int32
+
+const (
+	SortField_SORT_FIELD_UNSPECIFIED SortField = 0
+	SortField_SORT_FIELD_CREATED_AT  SortField = 1
+	SortField_SORT_FIELD_UPDATED_AT  SortField = 2
+	SortField_SORT_FIELD_LAST_NAME   SortField = 3
+	SortField_SORT_FIELD_NICKNAME    SortField = 4
+)
+
+// Enum value maps for SortField.
+var (
+	SortField_name = map[int32]string{
+		0: "SORT_FIELD_UNSPECIFIED",
+		1: "SORT_FIELD_CREATED_AT",
+		2: "SORT_FIELD_UPDATED_AT",
+		3: "SORT_FIELD_LAST_NAME",
+		4: "SORT_FIELD_NICKNAME",
+	}
+	SortField_value = map[string]int32{
+		"SORT_FIELD_UNSPECIFIED": 0,
+		"SORT_FIELD_CREATED_AT":  1,
+		"SORT_FIELD_UPDATED_AT":  2,
+		"SORT_FIELD_LAST_NAME":   3,
+		"SORT_FIELD_NICKNAME":    4,
+	}
+)
+
+func (x SortField) Enum() *SortField {
+	p := new(SortField)
+	*p = x
+	return p
+}
+
+func (x SortField) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (SortField) Descriptor() protoreflect.EnumDescriptor {
+	return file_v2_users_proto_enumTypes[1].Descriptor()
+}
+
+func (SortField) Type() protoreflect.EnumType {
+	return &file_v2_users_proto_enumTypes[1]
+}
+
+func (x SortField) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use SortField.Descriptor instead.
+func (SortField) EnumDescriptor() ([]byte, []int) {
+	return file_v2_users_proto_rawDescGZIP(), []int{1}
+}
+
+type SortDirection int32
+
+const (
+	SortDirection_SORT_DIRECTION_ASCENDING  SortDirection = 0
+	SortDirection_SORT_DIRECTION_DESCENDING SortDirection = 1
+)
+
+// Enum value maps for SortDirection.
+var (
+	SortDirection_name = map[int32]string{
+		0: "SORT_DIRECTION_ASCENDING",
+		1: "SORT_DIRECTION_DESCENDING",
+	}
+	SortDirection_value = map[string]int32{
+		"SORT_DIRECTION_ASCENDING":  0,
+		"SORT_DIRECTION_DESCENDING": 1,
+	}
+)
+
+func (x SortDirection) Enum() *SortDirection {
+	p := new(SortDirection)
+	*p = x
+	return p
+}
+
+func (x SortDirection) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (SortDirection) Descriptor() protoreflect.EnumDescriptor {
+	return file_v2_users_proto_enumTypes[2].Descriptor()
+}
+
+func (SortDirection) Type() protoreflect.EnumType {
+	return &file_v2_users_proto_enumTypes[2]
+}
+
+func (x SortDirection) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use SortDirection.Descriptor instead.
+func (SortDirection) EnumDescriptor() ([]byte, []int) {
+	return file_v2_users_proto_rawDescGZIP(), []int{2}
+}
+
+type Action int32
+
+const (
+	Action_ACTION_UNSPECIFIED         Action = 0
+	Action_ACTION_CREATED             Action = 1
+	Action_ACTION_UPDATED             Action = 2
+	Action_ACTION_DELETED             Action = 3
+	Action_ACTION_PASSWORD_CHANGED    Action = 4
+	Action_ACTION_EMAIL_CHANGED       Action = 5
+	Action_ACTION_RESTORED            Action = 6
+	Action_ACTION_ANONYMIZED          Action = 7
+	Action_ACTION_SUSPENDED           Action = 8
+	Action_ACTION_REACTIVATED         Action = 9
+	Action_ACTION_BANNED              Action = 10
+	Action_ACTION_TWO_FACTOR_ENABLED  Action = 11
+	Action_ACTION_TWO_FACTOR_DISABLED Action = 12
+	Action_ACTION_MARKED_DORMANT      Action = 13
+	Action_ACTION_REPLAYED            Action = 14
+	Action_ACTION_NICKNAME_CHANGED    Action = 15
+)
+
+// Enum value maps for Action.
+var (
+	Action_name = map[int32]string{
+		0:  "ACTION_UNSPECIFIED",
+		1:  "ACTION_CREATED",
+		2:  "ACTION_UPDATED",
+		3:  "ACTION_DELETED",
+		4:  "ACTION_PASSWORD_CHANGED",
+		5:  "ACTION_EMAIL_CHANGED",
+		6:  "ACTION_RESTORED",
+		7:  "ACTION_ANONYMIZED",
+		8:  "ACTION_SUSPENDED",
+		9:  "ACTION_REACTIVATED",
+		10: "ACTION_BANNED",
+		11: "ACTION_TWO_FACTOR_ENABLED",
+		12: "ACTION_TWO_FACTOR_DISABLED",
+		13: "ACTION_MARKED_DORMANT",
+		14: "ACTION_REPLAYED",
+		15: "ACTION_NICKNAME_CHANGED",
+	}
+	Action_value = map[string]int32{
+		"ACTION_UNSPECIFIED":         0,
+		"ACTION_CREATED":             1,
+		"ACTION_UPDATED":             2,
+		"ACTION_DELETED":             3,
+		"ACTION_PASSWORD_CHANGED":    4,
+		"ACTION_EMAIL_CHANGED":       5,
+		"ACTION_RESTORED":            6,
+		"ACTION_ANONYMIZED":          7,
+		"ACTION_SUSPENDED":           8,
+		"ACTION_REACTIVATED":         9,
+		"ACTION_BANNED":              10,
+		"ACTION_TWO_FACTOR_ENABLED":  11,
+		"ACTION_TWO_FACTOR_DISABLED": 12,
+		"ACTION_MARKED_DORMANT":      13,
+		"ACTION_REPLAYED":            14,
+		"ACTION_NICKNAME_CHANGED":    15,
+	}
+)
+
+func (x Action) Enum() *Action {
+	p := new(Action)
+	*p = x
+	return p
+}
+
+func (x Action) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Action) Descriptor() protoreflect.EnumDescriptor {
+	return file_v2_users_proto_enumTypes[3].Descriptor()
+}
+
+func (Action) Type() protoreflect.EnumType {
+	return &file_v2_users_proto_enumTypes[3]
+}
+
+func (x Action) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Action.Descriptor instead.
+func (Action) EnumDescriptor() ([]byte, []int) {
+	return file_v2_users_proto_rawDescGZIP(), []int{3}
+}
+
+type StatsInterval int32
+
+const (
+	StatsInterval_STATS_INTERVAL_UNSPECIFIED StatsInterval = 0
+	StatsInterval_STATS_INTERVAL_DAY         StatsInterval = 1
+	StatsInterval_STATS_INTERVAL_WEEK        StatsInterval = 2
+	StatsInterval_STATS_INTERVAL_MONTH       StatsInterval = 3
+)
+
+// Enum value maps for StatsInterval.
+var (
+	StatsInterval_name = map[int32]string{
+		0: "STATS_INTERVAL_UNSPECIFIED",
+		1: "STATS_INTERVAL_DAY",
+		2: "STATS_INTERVAL_WEEK",
+		3: "STATS_INTERVAL_MONTH",
+	}
+	StatsInterval_value = map[string]int32{
+		"STATS_INTERVAL_UNSPECIFIED": 0,
+		"STATS_INTERVAL_DAY":         1,
+		"STATS_INTERVAL_WEEK":        2,
+		"STATS_INTERVAL_MONTH":       3,
+	}
+)
+
+func (x StatsInterval) Enum() *StatsInterval {
+	p := new(StatsInterval)
+	*p = x
+	return p
+}
+
+func (x StatsInterval) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (StatsInterval) Descriptor() protoreflect.EnumDescriptor {
+	return file_v2_users_proto_enumTypes[4].Descriptor()
+}
+
+func (StatsInterval) Type() protoreflect.EnumType {
+	return &file_v2_users_proto_enumTypes[4]
+}
+
+func (x StatsInterval) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use StatsInterval.Descriptor instead.
+func (StatsInterval) EnumDescriptor() ([]byte, []int) {
+	return file_v2_users_proto_rawDescGZIP(), []int{4}
+}
+
+type NewUser struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	FirstName       string                 `protobuf:"bytes,1,opt,name=first_name,json=firstName,proto3" json:"first_name,omitempty"`
+	LastName        string                 `protobuf:"bytes,2,opt,name=last_name,json=lastName,proto3" json:"last_name,omitempty"`
+	Nickname        string                 `protobuf:"bytes,3,opt,name=nickname,proto3" json:"nickname,omitempty"`
+	Password        string                 `protobuf:"bytes,4,opt,name=password,proto3" json:"password,omitempty"`
+	ConfirmPassword string                 `protobuf:"bytes,5,opt,name=confirm_password,json=confirmPassword,proto3" json:"confirm_password,omitempty"`
+	Email           string                 `protobuf:"bytes,6,opt,name=email,proto3" json:"email,omitempty"`
+	Country         string                 `protobuf:"bytes,7,opt,name=country,proto3" json:"country,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *NewUser) Reset() {
+	*x = NewUser{}
+	mi := &file_v2_users_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *NewUser) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*NewUser) ProtoMessage() {}
+
+func (x *NewUser) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_users_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use NewUser.ProtoReflect.Descriptor instead.
+func (*NewUser) Descriptor() ([]byte, []int) {
+	return file_v2_users_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *NewUser) GetFirstName() string {
+	if x != nil {
+		return x.FirstName
+	}
+	return ""
+}
+
+func (x *NewUser) GetLastName() string {
+	if x != nil {
+		return x.LastName
+	}
+	return ""
+}
+
+func (x *NewUser) GetNickname() string {
+	if x != nil {
+		return x.Nickname
+	}
+	return ""
+}
+
+func (x *NewUser) GetPassword() string {
+	if x != nil {
+		return x.Password
+	}
+	return ""
+}
+
+func (x *NewUser) GetConfirmPassword() string {
+	if x != nil {
+		return x.ConfirmPassword
+	}
+	return ""
+}
+
+func (x *NewUser) GetEmail() string {
+	if x != nil {
+		return x.Email
+	}
+	return ""
+}
+
+func (x *NewUser) GetCountry() string {
+	if x != nil {
+		return x.Country
+	}
+	return ""
+}
+
+type User struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Id        string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	FirstName string                 `protobuf:"bytes,2,opt,name=first_name,json=firstName,proto3" json:"first_name,omitempty"`
+	LastName  string                 `protobuf:"bytes,3,opt,name=last_name,json=lastName,proto3" json:"last_name,omitempty"`
+	Nickname  string                 `protobuf:"bytes,4,opt,name=nickname,proto3" json:"nickname,omitempty"`
+	Email     string                 `protobuf:"bytes,5,opt,name=email,proto3" json:"email,omitempty"`
+	Country   string                 `protobuf:"bytes,6,opt,name=country,proto3" json:"country,omitempty"`
+	CreatedAt *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	UpdatedAt *timestamppb.Timestamp `protobuf:"bytes,8,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	Version   int64                  `protobuf:"varint,9,opt,name=version,proto3" json:"version,omitempty"`
+	Status    UserStatus             `protobuf:"varint,10,opt,name=status,proto3,enum=users.v2.UserStatus" json:"status,omitempty"`
+	// avatar_url is the https URL of the user's profile picture. It is empty when the user has none
+	AvatarUrl string `protobuf:"bytes,11,opt,name=avatar_url,json=avatarUrl,proto3" json:"avatar_url,omitempty"`
+	// last_login_at is the time the user last authenticated. It is not set if they never have
+	LastLoginAt *timestamppb.Timestamp `protobuf:"bytes,12,opt,name=last_login_at,json=lastLoginAt,proto3" json:"last_login_at,omitempty"`
+	// last_seen_at is the time the user was last active. It is not set if they have never been seen
+	LastSeenAt *timestamppb.Timestamp `protobuf:"bytes,13,opt,name=last_seen_at,json=lastSeenAt,proto3" json:"last_seen_at,omitempty"`
+	// two_factor_enabled is true when the user must give a two factor authentication code to authenticate
+	TwoFactorEnabled bool `protobuf:"varint,14,opt,name=two_factor_enabled,json=twoFactorEnabled,proto3" json:"two_factor_enabled,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *User) Reset() {
+	*x = User{}
+	mi := &file_v2_users_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *User) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*User) ProtoMessage() {}
+
+func (x *User) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_users_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use User.ProtoReflect.Descriptor instead.
+func (*User) Descriptor() ([]byte, []int) {
+	return file_v2_users_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *User) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *User) GetFirstName() string {
+	if x != nil {
+		return x.FirstName
+	}
+	return ""
+}
+
+func (x *User) GetLastName() string {
+	if x != nil {
+		return x.LastName
+	}
+	return ""
+}
+
+func (x *User) GetNickname() string {
+	if x != nil {
+		return x.Nickname
+	}
+	return ""
+}
+
+func (x *User) GetEmail() string {
+	if x != nil {
+		return x.Email
+	}
+	return ""
+}
+
+func (x *User) GetCountry() string {
+	if x != nil {
+		return x.Country
+	}
+	return ""
+}
+
+func (x *User) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *User) GetUpdatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.UpdatedAt
+	}
+	return nil
+}
+
+func (x *User) GetVersion() int64 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *User) GetStatus() UserStatus {
+	if x != nil {
+		return x.Status
+	}
+	return UserStatus_USER_STATUS_UNSPECIFIED
+}
+
+func (x *User) GetAvatarUrl() string {
+	if x != nil {
+		return x.AvatarUrl
+	}
+	return ""
+}
+
+func (x *User) GetLastLoginAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.LastLoginAt
+	}
+	return nil
+}
+
+func (x *User) GetLastSeenAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.LastSeenAt
+	}
+	return nil
+}
+
+func (x *User) GetTwoFactorEnabled() bool {
+	if x != nil {
+		return x.TwoFactorEnabled
+	}
+	return false
+}
+
+type Update struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	Id              string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	FirstName       string                 `protobuf:"bytes,2,opt,name=first_name,json=firstName,proto3" json:"first_name,omitempty"`
+	LastName        string                 `protobuf:"bytes,3,opt,name=last_name,json=lastName,proto3" json:"last_name,omitempty"`
+	Password        string                 `protobuf:"bytes,4,opt,name=password,proto3" json:"password,omitempty"`
+	ConfirmPassword string                 `protobuf:"bytes,5,opt,name=confirm_password,json=confirmPassword,proto3" json:"confirm_password,omitempty"`
+	Country         string                 `protobuf:"bytes,6,opt,name=country,proto3" json:"country,omitempty"`
+	Version         int64                  `protobuf:"varint,7,opt,name=version,proto3" json:"version,omitempty"`
+	// update_mask lists the fields to update, from first_name, last_name, password, country and avatar_url.
+	// Setting password also sets confirm_password. When update_mask is not set, all fields except avatar_url are
+	// updated
+	UpdateMask *fieldmaskpb.FieldMask `protobuf:"bytes,8,opt,name=update_mask,json=updateMask,proto3" json:"update_mask,omitempty"`
+	// avatar_url is the https URL of the user's profile picture, on one of the hosts allowed by the service. Setting
+	// it to an empty string removes the picture
+	AvatarUrl     string `protobuf:"bytes,9,opt,name=avatar_url,json=avatarUrl,proto3" json:"avatar_url,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Update) Reset() {
+	*x = Update{}
+	mi := &file_v2_users_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Update) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Update) ProtoMessage() {}
+
+func (x *Update) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_users_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Update.ProtoReflect.Descriptor instead.
+func (*Update) Descriptor() ([]byte, []int) {
+	return file_v2_users_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Update) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Update) GetFirstName() string {
+	if x != nil {
+		return x.FirstName
+	}
+	return ""
+}
+
+func (x *Update) GetLastName() string {
+	if x != nil {
+		return x.LastName
+	}
+	return ""
+}
+
+func (x *Update) GetPassword() string {
+	if x != nil {
+		return x.Password
+	}
+	return ""
+}
+
+func (x *Update) GetConfirmPassword() string {
+	if x != nil {
+		return x.ConfirmPassword
+	}
+	return ""
+}
+
+func (x *Update) GetCountry() string {
+	if x != nil {
+		return x.Country
+	}
+	return ""
+}
+
+func (x *Update) GetVersion() int64 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *Update) GetUpdateMask() *fieldmaskpb.FieldMask {
+	if x != nil {
+		return x.UpdateMask
+	}
+	return nil
+}
+
+func (x *Update) GetAvatarUrl() string {
+	if x != nil {
+		return x.AvatarUrl
+	}
+	return ""
+}
+
+type Ref struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Ref) Reset() {
+	*x = Ref{}
+	mi := &file_v2_users_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Ref) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Ref) ProtoMessage() {}
+
+func (x *Ref) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_users_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Ref.ProtoReflect.Descriptor instead.
+func (*Ref) Descriptor() ([]byte, []int) {
+	return file_v2_users_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Ref) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type Refs struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Ids           []string               `protobuf:"bytes,1,rep,name=ids,proto3" json:"ids,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Refs) Reset() {
+	*x = Refs{}
+	mi := &file_v2_users_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Refs) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Refs) ProtoMessage() {}
+
+func (x *Refs) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_users_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Refs.ProtoReflect.Descriptor instead.
+func (*Refs) Descriptor() ([]byte, []int) {
+	return file_v2_users_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Refs) GetIds() []string {
+	if x != nil {
+		return x.Ids
+	}
+	return nil
+}
+
+type DeleteResult struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// deleted is false when the user does not exist or has already been deleted
+	Deleted       bool `protobuf:"varint,2,opt,name=deleted,proto3" json:"deleted,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteResult) Reset() {
+	*x = DeleteResult{}
+	mi := &file_v2_users_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteResult) ProtoMessage() {}
+
+func (x *DeleteResult) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_users_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteResult.ProtoReflect.Descriptor instead.
+func (*DeleteResult) Descriptor() ([]byte, []int) {
+	return file_v2_users_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *DeleteResult) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *DeleteResult) GetDeleted() bool {
+	if x != nil {
+		return x.Deleted
+	}
+	return false
+}
+
+type BatchDeleteResult struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// results contains a result for each id, in the order they were requested
+	Results       []*DeleteResult `protobuf:"bytes,1,rep,name=results,proto3" json:"results,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchDeleteResult) Reset() {
+	*x = BatchDeleteResult{}
+	mi := &file_v2_users_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchDeleteResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchDeleteResult) ProtoMessage() {}
+
+func (x *BatchDeleteResult) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_users_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchDeleteResult.ProtoReflect.Descriptor instead.
+func (*BatchDeleteResult) Descriptor() ([]byte, []int) {
+	return file_v2_users_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *BatchDeleteResult) GetResults() []*DeleteResult {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+type GetResult struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// found is false when the user does not exist or has been deleted, in which case user is not set
+	Found         bool  `protobuf:"varint,2,opt,name=found,proto3" json:"found,omitempty"`
+	User          *User `protobuf:"bytes,3,opt,name=user,proto3" json:"user,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetResult) Reset() {
+	*x = GetResult{}
+	mi := &file_v2_users_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetResult) ProtoMessage() {}
+
+func (x *GetResult) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_users_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetResult.ProtoReflect.Descriptor instead.
+func (*GetResult) Descriptor() ([]byte, []int) {
+	return file_v2_users_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *GetResult) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *GetResult) GetFound() bool {
+	if x != nil {
+		return x.Found
+	}
+	return false
+}
+
+func (x *GetResult) GetUser() *User {
+	if x != nil {
+		return x.User
+	}
+	return nil
+}
+
+type BatchGetResult struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// results contains a result for each id, in the order they were requested
+	Results       []*GetResult `protobuf:"bytes,1,rep,name=results,proto3" json:"results,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchGetResult) Reset() {
+	*x = BatchGetResult{}
+	mi := &file_v2_users_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchGetResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchGetResult) ProtoMessage() {}
+
+func (x *BatchGetResult) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_users_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchGetResult.ProtoReflect.Descriptor instead.
+func (*BatchGetResult) Descriptor() ([]byte, []int) {
+	return file_v2_users_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *BatchGetResult) GetResults() []*GetResult {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+type Query struct {
+	state        protoimpl.MessageState `protogen:"open.v1"`
+	CreatedAfter *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=created_after,json=createdAfter,proto3" json:"created_after,omitempty"`
+	Country      string                 `protobuf:"bytes,2,opt,name=country,proto3" json:"country,omitempty"`
+	Length       int32                  `protobuf:"varint,3,opt,name=length,proto3" json:"length,omitempty"`
+	Page         int64                  `protobuf:"varint,4,opt,name=page,proto3" json:"page,omitempty"`
+	// sort_by defaults to created_at
+	SortBy        SortField     `protobuf:"varint,5,opt,name=sort_by,json=sortBy,proto3,enum=users.v2.SortField" json:"sort_by,omitempty"`
+	SortDirection SortDirection `protobuf:"varint,6,opt,name=sort_direction,json=sortDirection,proto3,enum=users.v2.SortDirection" json:"sort_direction,omitempty"`
+	// status limits the users found to those with the given status. When it is unspecified, users with any status are
+	// found
+	Status UserStatus `protobuf:"varint,7,opt,name=status,proto3,enum=users.v2.UserStatus" json:"status,omitempty"`
+	// search finds users whose nickname or email address is the search term, or whose first or last name starts with
+	// it. Matching is case sensitive
+	Search string `protobuf:"bytes,8,opt,name=search,proto3" json:"search,omitempty"`
+	// inactive_since finds users who have not been seen since the given time, including users created before it who
+	// have never been seen
+	InactiveSince *timestamppb.Timestamp `protobuf:"bytes,9,opt,name=inactive_since,json=inactiveSince,proto3" json:"inactive_since,omitempty"`
+	// countries finds users living in any of the given countries, as well as country when it is set
+	Countries []string `protobuf:"bytes,10,rep,name=countries,proto3" json:"countries,omitempty"`
+	// created_before finds users created before the given time
+	CreatedBefore *timestamppb.Timestamp `protobuf:"bytes,11,opt,name=created_before,json=createdBefore,proto3" json:"created_before,omitempty"`
+	// skip_total skips counting the users matching the query, which is slow when many users match. The total and
+	// total_pages of the page are -1, and has_next still says whether there are users on later pages
+	SkipTotal     bool `protobuf:"varint,12,opt,name=skip_total,json=skipTotal,proto3" json:"skip_total,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Query) Reset() {
+	*x = Query{}
+	mi := &file_v2_users_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Query) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Query) ProtoMessage() {}
+
+func (x *Query) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_users_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Query.ProtoReflect.Descriptor instead.
+func (*Query) Descriptor() ([]byte, []int) {
+	return file_v2_users_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *Query) GetCreatedAfter() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAfter
+	}
+	return nil
+}
+
+func (x *Query) GetCountry() string {
+	if x != nil {
+		return x.Country
+	}
+	return ""
+}
+
+func (x *Query) GetLength() int32 {
+	if x != nil {
+		return x.Length
+	}
+	return 0
+}
+
+func (x *Query) GetPage() int64 {
+	if x != nil {
+		return x.Page
+	}
+	return 0
+}
+
+func (x *Query) GetSortBy() SortField {
+	if x != nil {
+		return x.SortBy
+	}
+	return SortField_SORT_FIELD_UNSPECIFIED
+}
+
+func (x *Query) GetSortDirection() SortDirection {
+	if x != nil {
+		return x.SortDirection
+	}
+	return SortDirection_SORT_DIRECTION_ASCENDING
+}
+
+func (x *Query) GetStatus() UserStatus {
+	if x != nil {
+		return x.Status
+	}
+	return UserStatus_USER_STATUS_UNSPECIFIED
+}
+
+func (x *Query) GetSearch() string {
+	if x != nil {
+		return x.Search
+	}
+	return ""
+}
+
+func (x *Query) GetInactiveSince() *timestamppb.Timestamp {
+	if x != nil {
+		return x.InactiveSince
+	}
+	return nil
+}
+
+func (x *Query) GetCountries() []string {
+	if x != nil {
+		return x.Countries
+	}
+	return nil
+}
+
+func (x *Query) GetCreatedBefore() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedBefore
+	}
+	return nil
+}
+
+func (x *Query) GetSkipTotal() bool {
+	if x != nil {
+		return x.SkipTotal
+	}
+	return false
+}
+
+type Page struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Page  int64                  `protobuf:"varint,1,opt,name=page,proto3" json:"page,omitempty"`
+	Total int64                  `protobuf:"varint,2,opt,name=total,proto3" json:"total,omitempty"`
+	Items []*User                `protobuf:"bytes,3,rep,name=items,proto3" json:"items,omitempty"`
+	// has_next is true when there are users matching the query on later pages
+	HasNext bool `protobuf:"varint,4,opt,name=has_next,json=hasNext,proto3" json:"has_next,omitempty"`
+	// total_pages is the number of pages of the requested length which hold the users matching the query
+	TotalPages    int64 `protobuf:"varint,5,opt,name=total_pages,json=totalPages,proto3" json:"total_pages,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Page) Reset() {
+	*x = Page{}
+	mi := &file_v2_users_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Page) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Page) ProtoMessage() {}
+
+func (x *Page) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_users_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Page.ProtoReflect.Descriptor instead.
+func (*Page) Descriptor() ([]byte, []int) {
+	return file_v2_users_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *Page) GetPage() int64 {
+	if x != nil {
+		return x.Page
+	}
+	return 0
+}
+
+func (x *Page) GetTotal() int64 {
+	if x != nil {
+		return x.Total
+	}
+	return 0
+}
+
+func (x *Page) GetItems() []*User {
+	if x != nil {
+		return x.Items
+	}
+	return nil
+}
+
+func (x *Page) GetHasNext() bool {
+	if x != nil {
+		return x.HasNext
+	}
+	return false
+}
+
+func (x *Page) GetTotalPages() int64 {
+	if x != nil {
+		return x.TotalPages
+	}
+	return 0
+}
+
+type Count struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Total         int64                  `protobuf:"varint,1,opt,name=total,proto3" json:"total,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Count) Reset() {
+	*x = Count{}
+	mi := &file_v2_users_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Count) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Count) ProtoMessage() {}
+
+func (x *Count) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_users_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Count.ProtoReflect.Descriptor instead.
+func (*Count) Descriptor() ([]byte, []int) {
+	return file_v2_users_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *Count) GetTotal() int64 {
+	if x != nil {
+		return x.Total
+	}
+	return 0
+}
+
+// StatsQuery selects the users counted by GetUserStats. Its filters match users as the fields of a Query with the
+// same names do
+type StatsQuery struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	CreatedAfter  *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=created_after,json=createdAfter,proto3" json:"created_after,omitempty"`
+	CreatedBefore *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=created_before,json=createdBefore,proto3" json:"created_before,omitempty"`
+	Country       string                 `protobuf:"bytes,3,opt,name=country,proto3" json:"country,omitempty"`
+	Countries     []string               `protobuf:"bytes,4,rep,name=countries,proto3" json:"countries,omitempty"`
+	Status        UserStatus             `protobuf:"varint,5,opt,name=status,proto3,enum=users.v2.UserStatus" json:"status,omitempty"`
+	// interval is the length of the periods signups are counted in. When it is unspecified, signups are counted per
+	// day
+	Interval      StatsInterval `protobuf:"varint,6,opt,name=interval,proto3,enum=users.v2.StatsInterval" json:"interval,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StatsQuery) Reset() {
+	*x = StatsQuery{}
+	mi := &file_v2_users_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StatsQuery) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StatsQuery) ProtoMessage() {}
+
+func (x *StatsQuery) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_users_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StatsQuery.ProtoReflect.Descriptor instead.
+func (*StatsQuery) Descriptor() ([]byte, []int) {
+	return file_v2_users_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *StatsQuery) GetCreatedAfter() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAfter
+	}
+	return nil
+}
+
+func (x *StatsQuery) GetCreatedBefore() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedBefore
+	}
+	return nil
+}
+
+func (x *StatsQuery) GetCountry() string {
+	if x != nil {
+		return x.Country
+	}
+	return ""
+}
+
+func (x *StatsQuery) GetCountries() []string {
+	if x != nil {
+		return x.Countries
+	}
+	return nil
+}
+
+func (x *StatsQuery) GetStatus() UserStatus {
+	if x != nil {
+		return x.Status
+	}
+	return UserStatus_USER_STATUS_UNSPECIFIED
+}
+
+func (x *StatsQuery) GetInterval() StatsInterval {
+	if x != nil {
+		return x.Interval
+	}
+	return StatsInterval_STATS_INTERVAL_UNSPECIFIED
+}
+
+// CountryCount is the number of users living in a country
+type CountryCount struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Country       string                 `protobuf:"bytes,1,opt,name=country,proto3" json:"country,omitempty"`
+	Total         int64                  `protobuf:"varint,2,opt,name=total,proto3" json:"total,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CountryCount) Reset() {
+	*x = CountryCount{}
+	mi := &file_v2_users_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CountryCount) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CountryCount) ProtoMessage() {}
+
+func (x *CountryCount) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_users_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CountryCount.ProtoReflect.Descriptor instead.
+func (*CountryCount) Descriptor() ([]byte, []int) {
+	return file_v2_users_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *CountryCount) GetCountry() string {
+	if x != nil {
+		return x.Country
+	}
+	return ""
+}
+
+func (x *CountryCount) GetTotal() int64 {
+	if x != nil {
+		return x.Total
+	}
+	return 0
+}
+
+// SignupCount is the number of users who signed up in the period which starts at start. Days and months start at
+// midnight UTC, and weeks start on Monday
+type SignupCount struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Start         *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=start,proto3" json:"start,omitempty"`
+	Total         int64                  `protobuf:"varint,2,opt,name=total,proto3" json:"total,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SignupCount) Reset() {
+	*x = SignupCount{}
+	mi := &file_v2_users_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SignupCount) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SignupCount) ProtoMessage() {}
+
+func (x *SignupCount) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_users_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SignupCount.ProtoReflect.Descriptor instead.
+func (*SignupCount) Descriptor() ([]byte, []int) {
+	return file_v2_users_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *SignupCount) GetStart() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Start
+	}
+	return nil
+}
+
+func (x *SignupCount) GetTotal() int64 {
+	if x != nil {
+		return x.Total
+	}
+	return 0
+}
+
+type Stats struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Total int64                  `protobuf:"varint,1,opt,name=total,proto3" json:"total,omitempty"`
+	// countries are ordered by country code. Countries without users are omitted
+	Countries []*CountryCount `protobuf:"bytes,2,rep,name=countries,proto3" json:"countries,omitempty"`
+	// signups are ordered by the start of their period. Periods without signups are omitted
+	Signups       []*SignupCount `protobuf:"bytes,3,rep,name=signups,proto3" json:"signups,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Stats) Reset() {
+	*x = Stats{}
+	mi := &file_v2_users_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Stats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Stats) ProtoMessage() {}
+
+func (x *Stats) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_users_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Stats.ProtoReflect.Descriptor instead.
+func (*Stats) Descriptor() ([]byte, []int) {
+	return file_v2_users_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *Stats) GetTotal() int64 {
+	if x != nil {
+		return x.Total
+	}
+	return 0
+}
+
+func (x *Stats) GetCountries() []*CountryCount {
+	if x != nil {
+		return x.Countries
+	}
+	return nil
+}
+
+func (x *Stats) GetSignups() []*SignupCount {
+	if x != nil {
+		return x.Signups
+	}
+	return nil
+}
+
+// Lookup identifies a single user by email address or nickname
+type Lookup struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Key:
+	//
+	//	*Lookup_Email
+	//	*Lookup_Nickname
+	Key           isLookup_Key `protobuf_oneof:"key"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Lookup) Reset() {
+	*x = Lookup{}
+	mi := &file_v2_users_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Lookup) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Lookup) ProtoMessage() {}
+
+func (x *Lookup) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_users_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Lookup.ProtoReflect.Descriptor instead.
+func (*Lookup) Descriptor() ([]byte, []int) {
+	return file_v2_users_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *Lookup) GetKey() isLookup_Key {
+	if x != nil {
+		return x.Key
+	}
+	return nil
+}
+
+func (x *Lookup) GetEmail() string {
+	if x != nil {
+		if x, ok := x.Key.(*Lookup_Email); ok {
+			return x.Email
+		}
+	}
+	return ""
+}
+
+func (x *Lookup) GetNickname() string {
+	if x != nil {
+		if x, ok := x.Key.(*Lookup_Nickname); ok {
+			return x.Nickname
+		}
+	}
+	return ""
+}
+
+type isLookup_Key interface {
+	isLookup_Key()
+}
+
+type Lookup_Email struct {
+	Email string `protobuf:"bytes,1,opt,name=email,proto3,oneof"`
+}
+
+type Lookup_Nickname struct {
+	Nickname string `protobuf:"bytes,2,opt,name=nickname,proto3,oneof"`
+}
+
+func (*Lookup_Email) isLookup_Key() {}
+
+func (*Lookup_Nickname) isLookup_Key() {}
+
+type PasswordChange struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	Id              string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	CurrentPassword string                 `protobuf:"bytes,2,opt,name=current_password,json=currentPassword,proto3" json:"current_password,omitempty"`
+	Password        string                 `protobuf:"bytes,3,opt,name=password,proto3" json:"password,omitempty"`
+	ConfirmPassword string                 `protobuf:"bytes,4,opt,name=confirm_password,json=confirmPassword,proto3" json:"confirm_password,omitempty"`
+	Version         int64                  `protobuf:"varint,5,opt,name=version,proto3" json:"version,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *PasswordChange) Reset() {
+	*x = PasswordChange{}
+	mi := &file_v2_users_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PasswordChange) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PasswordChange) ProtoMessage() {}
+
+func (x *PasswordChange) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_users_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PasswordChange.ProtoReflect.Descriptor instead.
+func (*PasswordChange) Descriptor() ([]byte, []int) {
+	return file_v2_users_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *PasswordChange) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *PasswordChange) GetCurrentPassword() string {
+	if x != nil {
+		return x.CurrentPassword
+	}
+	return ""
+}
+
+func (x *PasswordChange) GetPassword() string {
+	if x != nil {
+		return x.Password
+	}
+	return ""
+}
+
+func (x *PasswordChange) GetConfirmPassword() string {
+	if x != nil {
+		return x.ConfirmPassword
+	}
+	return ""
+}
+
+func (x *PasswordChange) GetVersion() int64 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+type EmailChange struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	Id              string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Email           string                 `protobuf:"bytes,2,opt,name=email,proto3" json:"email,omitempty"`
+	CurrentPassword string                 `protobuf:"bytes,3,opt,name=current_password,json=currentPassword,proto3" json:"current_password,omitempty"`
+	Version         int64                  `protobuf:"varint,4,opt,name=version,proto3" json:"version,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *EmailChange) Reset() {
+	*x = EmailChange{}
+	mi := &file_v2_users_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EmailChange) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EmailChange) ProtoMessage() {}
+
+func (x *EmailChange) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_users_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EmailChange.ProtoReflect.Descriptor instead.
+func (*EmailChange) Descriptor() ([]byte, []int) {
+	return file_v2_users_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *EmailChange) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *EmailChange) GetEmail() string {
+	if x != nil {
+		return x.Email
+	}
+	return ""
+}
+
+func (x *EmailChange) GetCurrentPassword() string {
+	if x != nil {
+		return x.CurrentPassword
+	}
+	return ""
+}
+
+func (x *EmailChange) GetVersion() int64 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+type NicknameChange struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Nickname      string                 `protobuf:"bytes,2,opt,name=nickname,proto3" json:"nickname,omitempty"`
+	Version       int64                  `protobuf:"varint,3,opt,name=version,proto3" json:"version,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *NicknameChange) Reset() {
+	*x = NicknameChange{}
+	mi := &file_v2_users_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *NicknameChange) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*NicknameChange) ProtoMessage() {}
+
+func (x *NicknameChange) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_users_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use NicknameChange.ProtoReflect.Descriptor instead.
+func (*NicknameChange) Descriptor() ([]byte, []int) {
+	return file_v2_users_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *NicknameChange) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *NicknameChange) GetNickname() string {
+	if x != nil {
+		return x.Nickname
+	}
+	return ""
+}
+
+func (x *NicknameChange) GetVersion() int64 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+type EmailConfirmation struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// token is the token sent to the new email address after the change was requested
+	Token         string `protobuf:"bytes,1,opt,name=token,proto3" json:"token,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EmailConfirmation) Reset() {
+	*x = EmailConfirmation{}
+	mi := &file_v2_users_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EmailConfirmation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EmailConfirmation) ProtoMessage() {}
+
+func (x *EmailConfirmation) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_users_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EmailConfirmation.ProtoReflect.Descriptor instead.
+func (*EmailConfirmation) Descriptor() ([]byte, []int) {
+	return file_v2_users_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *EmailConfirmation) GetToken() string {
+	if x != nil {
+		return x.Token
+	}
+	return ""
+}
+
+// AvailabilityCheck names a nickname, an email address, or both, to check the availability of
+type AvailabilityCheck struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Nickname      string                 `protobuf:"bytes,1,opt,name=nickname,proto3" json:"nickname,omitempty"`
+	Email         string                 `protobuf:"bytes,2,opt,name=email,proto3" json:"email,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AvailabilityCheck) Reset() {
+	*x = AvailabilityCheck{}
+	mi := &file_v2_users_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AvailabilityCheck) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AvailabilityCheck) ProtoMessage() {}
+
+func (x *AvailabilityCheck) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_users_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AvailabilityCheck.ProtoReflect.Descriptor instead.
+func (*AvailabilityCheck) Descriptor() ([]byte, []int) {
+	return file_v2_users_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *AvailabilityCheck) GetNickname() string {
+	if x != nil {
+		return x.Nickname
+	}
+	return ""
+}
+
+func (x *AvailabilityCheck) GetEmail() string {
+	if x != nil {
+		return x.Email
+	}
+	return ""
+}
+
+type Availability struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// nickname_available is true if the nickname was checked and no user has it
+	NicknameAvailable bool `protobuf:"varint,1,opt,name=nickname_available,json=nicknameAvailable,proto3" json:"nickname_available,omitempty"`
+	// email_available is true if the email address was checked and no user has it
+	EmailAvailable bool `protobuf:"varint,2,opt,name=email_available,json=emailAvailable,proto3" json:"email_available,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *Availability) Reset() {
+	*x = Availability{}
+	mi := &file_v2_users_proto_msgTypes[22]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Availability) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Availability) ProtoMessage() {}
+
+func (x *Availability) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_users_proto_msgTypes[22]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Availability.ProtoReflect.Descriptor instead.
+func (*Availability) Descriptor() ([]byte, []int) {
+	return file_v2_users_proto_rawDescGZIP(), []int{22}
+}
+
+func (x *Availability) GetNicknameAvailable() bool {
+	if x != nil {
+		return x.NicknameAvailable
+	}
+	return false
+}
+
+func (x *Availability) GetEmailAvailable() bool {
+	if x != nil {
+		return x.EmailAvailable
+	}
+	return false
+}
+
+type UserData struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// document is a JSON document containing everything held about the user: the user, any pending password reset
+	// or email change, and the events about the user which have not been published yet
+	Document      string `protobuf:"bytes,1,opt,name=document,proto3" json:"document,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UserData) Reset() {
+	*x = UserData{}
+	mi := &file_v2_users_proto_msgTypes[23]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UserData) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UserData) ProtoMessage() {}
+
+func (x *UserData) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_users_proto_msgTypes[23]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UserData.ProtoReflect.Descriptor instead.
+func (*UserData) Descriptor() ([]byte, []int) {
+	return file_v2_users_proto_rawDescGZIP(), []int{23}
+}
+
+func (x *UserData) GetDocument() string {
+	if x != nil {
+		return x.Document
+	}
+	return ""
+}
+
+type Credentials struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Email    string                 `protobuf:"bytes,1,opt,name=email,proto3" json:"email,omitempty"`
+	Password string                 `protobuf:"bytes,2,opt,name=password,proto3" json:"password,omitempty"`
+	// code is the current code from the authenticator app of a user with two factor authentication enabled, or one of
+	// their recovery codes
+	Code          string `protobuf:"bytes,3,opt,name=code,proto3" json:"code,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Credentials) Reset() {
+	*x = Credentials{}
+	mi := &file_v2_users_proto_msgTypes[24]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Credentials) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Credentials) ProtoMessage() {}
+
+func (x *Credentials) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_users_proto_msgTypes[24]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Credentials.ProtoReflect.Descriptor instead.
+func (*Credentials) Descriptor() ([]byte, []int) {
+	return file_v2_users_proto_rawDescGZIP(), []int{24}
+}
+
+func (x *Credentials) GetEmail() string {
+	if x != nil {
+		return x.Email
+	}
+	return ""
+}
+
+func (x *Credentials) GetPassword() string {
+	if x != nil {
+		return x.Password
+	}
+	return ""
+}
+
+func (x *Credentials) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+// TwoFactorEnrollment is the secret of a new enrollment in two factor authentication
+type TwoFactorEnrollment struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// secret is the base32 encoded secret, for users to type into their authenticator app
+	Secret string `protobuf:"bytes,1,opt,name=secret,proto3" json:"secret,omitempty"`
+	// uri is the otpauth URI of the secret, to be shown to users as a QR code
+	Uri           string `protobuf:"bytes,2,opt,name=uri,proto3" json:"uri,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TwoFactorEnrollment) Reset() {
+	*x = TwoFactorEnrollment{}
+	mi := &file_v2_users_proto_msgTypes[25]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TwoFactorEnrollment) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TwoFactorEnrollment) ProtoMessage() {}
+
+func (x *TwoFactorEnrollment) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_users_proto_msgTypes[25]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TwoFactorEnrollment.ProtoReflect.Descriptor instead.
+func (*TwoFactorEnrollment) Descriptor() ([]byte, []int) {
+	return file_v2_users_proto_rawDescGZIP(), []int{25}
+}
+
+func (x *TwoFactorEnrollment) GetSecret() string {
+	if x != nil {
+		return x.Secret
+	}
+	return ""
+}
+
+func (x *TwoFactorEnrollment) GetUri() string {
+	if x != nil {
+		return x.Uri
+	}
+	return ""
+}
+
+// TwoFactorCode is a code from the authenticator app of a user, or one of their recovery codes
+type TwoFactorCode struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Code          string                 `protobuf:"bytes,2,opt,name=code,proto3" json:"code,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TwoFactorCode) Reset() {
+	*x = TwoFactorCode{}
+	mi := &file_v2_users_proto_msgTypes[26]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TwoFactorCode) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TwoFactorCode) ProtoMessage() {}
+
+func (x *TwoFactorCode) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_users_proto_msgTypes[26]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TwoFactorCode.ProtoReflect.Descriptor instead.
+func (*TwoFactorCode) Descriptor() ([]byte, []int) {
+	return file_v2_users_proto_rawDescGZIP(), []int{26}
+}
+
+func (x *TwoFactorCode) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *TwoFactorCode) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+// RecoveryCodes are the single use codes which can be used in place of a code from an authenticator app
+type RecoveryCodes struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Codes         []string               `protobuf:"bytes,1,rep,name=codes,proto3" json:"codes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RecoveryCodes) Reset() {
+	*x = RecoveryCodes{}
+	mi := &file_v2_users_proto_msgTypes[27]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RecoveryCodes) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RecoveryCodes) ProtoMessage() {}
+
+func (x *RecoveryCodes) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_users_proto_msgTypes[27]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RecoveryCodes.ProtoReflect.Descriptor instead.
+func (*RecoveryCodes) Descriptor() ([]byte, []int) {
+	return file_v2_users_proto_rawDescGZIP(), []int{27}
+}
+
+func (x *RecoveryCodes) GetCodes() []string {
+	if x != nil {
+		return x.Codes
+	}
+	return nil
+}
+
+type AuthResult struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	User          *User                  `protobuf:"bytes,1,opt,name=user,proto3" json:"user,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AuthResult) Reset() {
+	*x = AuthResult{}
+	mi := &file_v2_users_proto_msgTypes[28]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AuthResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AuthResult) ProtoMessage() {}
+
+func (x *AuthResult) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_users_proto_msgTypes[28]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AuthResult.ProtoReflect.Descriptor instead.
+func (*AuthResult) Descriptor() ([]byte, []int) {
+	return file_v2_users_proto_rawDescGZIP(), []int{28}
+}
+
+func (x *AuthResult) GetUser() *User {
+	if x != nil {
+		return x.User
+	}
+	return nil
+}
+
+type PasswordResetRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Email         string                 `protobuf:"bytes,1,opt,name=email,proto3" json:"email,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PasswordResetRequest) Reset() {
+	*x = PasswordResetRequest{}
+	mi := &file_v2_users_proto_msgTypes[29]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PasswordResetRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PasswordResetRequest) ProtoMessage() {}
+
+func (x *PasswordResetRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_users_proto_msgTypes[29]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PasswordResetRequest.ProtoReflect.Descriptor instead.
+func (*PasswordResetRequest) Descriptor() ([]byte, []int) {
+	return file_v2_users_proto_rawDescGZIP(), []int{29}
+}
+
+func (x *PasswordResetRequest) GetEmail() string {
+	if x != nil {
+		return x.Email
+	}
+	return ""
+}
+
+type PasswordReset struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// token is the token sent to the user after a password reset was requested
+	Token           string `protobuf:"bytes,1,opt,name=token,proto3" json:"token,omitempty"`
+	Password        string `protobuf:"bytes,2,opt,name=password,proto3" json:"password,omitempty"`
+	ConfirmPassword string `protobuf:"bytes,3,opt,name=confirm_password,json=confirmPassword,proto3" json:"confirm_password,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *PasswordReset) Reset() {
+	*x = PasswordReset{}
+	mi := &file_v2_users_proto_msgTypes[30]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PasswordReset) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PasswordReset) ProtoMessage() {}
+
+func (x *PasswordReset) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_users_proto_msgTypes[30]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PasswordReset.ProtoReflect.Descriptor instead.
+func (*PasswordReset) Descriptor() ([]byte, []int) {
+	return file_v2_users_proto_rawDescGZIP(), []int{30}
+}
+
+func (x *PasswordReset) GetToken() string {
+	if x != nil {
+		return x.Token
+	}
+	return ""
+}
+
+func (x *PasswordReset) GetPassword() string {
+	if x != nil {
+		return x.Password
+	}
+	return ""
+}
+
+func (x *PasswordReset) GetConfirmPassword() string {
+	if x != nil {
+		return x.ConfirmPassword
+	}
+	return ""
+}
+
+type WatchRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// actions limits the events sent to those with a matching action. When empty, all events are sent
+	Actions       []Action `protobuf:"varint,1,rep,packed,name=actions,proto3,enum=users.v2.Action" json:"actions,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchRequest) Reset() {
+	*x = WatchRequest{}
+	mi := &file_v2_users_proto_msgTypes[31]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchRequest) ProtoMessage() {}
+
+func (x *WatchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_users_proto_msgTypes[31]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchRequest.ProtoReflect.Descriptor instead.
+func (*WatchRequest) Descriptor() ([]byte, []int) {
+	return file_v2_users_proto_rawDescGZIP(), []int{31}
+}
+
+func (x *WatchRequest) GetActions() []Action {
+	if x != nil {
+		return x.Actions
+	}
+	return nil
+}
+
+type UserEvent struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Id        string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Version   int64                  `protobuf:"varint,2,opt,name=version,proto3" json:"version,omitempty"`
+	Action    Action                 `protobuf:"varint,3,opt,name=action,proto3,enum=users.v2.Action" json:"action,omitempty"`
+	CreatedAt *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	SentAt    *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=sent_at,json=sentAt,proto3" json:"sent_at,omitempty"`
+	// data is not set for deleted events
+	Data          *User `protobuf:"bytes,6,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UserEvent) Reset() {
+	*x = UserEvent{}
+	mi := &file_v2_users_proto_msgTypes[32]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UserEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UserEvent) ProtoMessage() {}
+
+func (x *UserEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_users_proto_msgTypes[32]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UserEvent.ProtoReflect.Descriptor instead.
+func (*UserEvent) Descriptor() ([]byte, []int) {
+	return file_v2_users_proto_rawDescGZIP(), []int{32}
+}
+
+func (x *UserEvent) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *UserEvent) GetVersion() int64 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *UserEvent) GetAction() Action {
+	if x != nil {
+		return x.Action
+	}
+	return Action_ACTION_UNSPECIFIED
+}
+
+func (x *UserEvent) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *UserEvent) GetSentAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.SentAt
+	}
+	return nil
+}
+
+func (x *UserEvent) GetData() *User {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+// DeadLettersRequest selects the dead letters listed by ListDeadLetters. It has no fields yet
+type DeadLettersRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeadLettersRequest) Reset() {
+	*x = DeadLettersRequest{}
+	mi := &file_v2_users_proto_msgTypes[33]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeadLettersRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeadLettersRequest) ProtoMessage() {}
+
+func (x *DeadLettersRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_users_proto_msgTypes[33]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeadLettersRequest.ProtoReflect.Descriptor instead.
+func (*DeadLettersRequest) Descriptor() ([]byte, []int) {
+	return file_v2_users_proto_rawDescGZIP(), []int{33}
+}
+
+// DeadLetter is an event which failed to be published too many times
+type DeadLetter struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// id is the id of the user the event is for
+	Id      string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Version int64  `protobuf:"varint,2,opt,name=version,proto3" json:"version,omitempty"`
+	// action is unspecified for events which are only sent to the mailer, such as password reset requests
+	Action         Action                 `protobuf:"varint,3,opt,name=action,proto3,enum=users.v2.Action" json:"action,omitempty"`
+	CreatedAt      *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	DeadLetteredAt *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=dead_lettered_at,json=deadLetteredAt,proto3" json:"dead_lettered_at,omitempty"`
+	// attempts is the number of times the event was sent
+	Attempts      int64 `protobuf:"varint,6,opt,name=attempts,proto3" json:"attempts,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeadLetter) Reset() {
+	*x = DeadLetter{}
+	mi := &file_v2_users_proto_msgTypes[34]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeadLetter) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeadLetter) ProtoMessage() {}
+
+func (x *DeadLetter) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_users_proto_msgTypes[34]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeadLetter.ProtoReflect.Descriptor instead.
+func (*DeadLetter) Descriptor() ([]byte, []int) {
+	return file_v2_users_proto_rawDescGZIP(), []int{34}
+}
+
+func (x *DeadLetter) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *DeadLetter) GetVersion() int64 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *DeadLetter) GetAction() Action {
+	if x != nil {
+		return x.Action
+	}
+	return Action_ACTION_UNSPECIFIED
+}
+
+func (x *DeadLetter) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *DeadLetter) GetDeadLetteredAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.DeadLetteredAt
+	}
+	return nil
+}
+
+func (x *DeadLetter) GetAttempts() int64 {
+	if x != nil {
+		return x.Attempts
+	}
+	return 0
+}
+
+type DeadLetters struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	DeadLetters   []*DeadLetter          `protobuf:"bytes,1,rep,name=dead_letters,json=deadLetters,proto3" json:"dead_letters,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeadLetters) Reset() {
+	*x = DeadLetters{}
+	mi := &file_v2_users_proto_msgTypes[35]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeadLetters) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeadLetters) ProtoMessage() {}
+
+func (x *DeadLetters) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_users_proto_msgTypes[35]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeadLetters.ProtoReflect.Descriptor instead.
+func (*DeadLetters) Descriptor() ([]byte, []int) {
+	return file_v2_users_proto_rawDescGZIP(), []int{35}
+}
+
+func (x *DeadLetters) GetDeadLetters() []*DeadLetter {
+	if x != nil {
+		return x.DeadLetters
+	}
+	return nil
+}
+
+var File_v2_users_proto protoreflect.FileDescriptor
+
+const file_v2_users_proto_rawDesc = "" +
+	"\n" +
+	"\x0ev2/users.proto\x12\busers.v2\x1a\x1cgoogle/api/annotations.proto\x1a\x1bgoogle/protobuf/empty.proto\x1a google/protobuf/field_mask.proto\x1a\x1bbuf/validate/validate.proto\x1a\x1fgoogle/protobuf/timestamp.proto\"\xdb\x02\n" +
+	"\aNewUser\x12%\n" +
+	"\n" +
+	"first_name\x18\x01 \x01(\tB\x06\xbaH\x03\xc8\x01\x01R\tfirstName\x12#\n" +
+	"\tlast_name\x18\x02 \x01(\tB\x06\xbaH\x03\xc8\x01\x01R\blastName\x12\"\n" +
+	"\bnickname\x18\x03 \x01(\tB\x06\xbaH\x03\xc8\x01\x01R\bnickname\x12#\n" +
+	"\bpassword\x18\x04 \x01(\tB\a\xbaH\x04r\x02\x10\n" +
+	"R\bpassword\x12)\n" +
+	"\x10confirm_password\x18\x05 \x01(\tR\x0fconfirmPassword\x12\x1d\n" +
+	"\x05email\x18\x06 \x01(\tB\a\xbaH\x04r\x02`\x01R\x05email\x12q\n" +
+	"\acountry\x18\a \x01(\tBW\xbaHT\xba\x01Q\n" +
+	"\acountry\x12*must be an ISO 3166-1 alpha-2 country code\x1a\x1athis.matches('^[A-Z]{2}$')R\acountry\"\xa7\x04\n" +
+	"\x04User\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x1d\n" +
+	"\n" +
+	"first_name\x18\x02 \x01(\tR\tfirstName\x12\x1b\n" +
+	"\tlast_name\x18\x03 \x01(\tR\blastName\x12\x1a\n" +
+	"\bnickname\x18\x04 \x01(\tR\bnickname\x12\x14\n" +
+	"\x05email\x18\x05 \x01(\tR\x05email\x12\x18\n" +
+	"\acountry\x18\x06 \x01(\tR\acountry\x129\n" +
+	"\n" +
+	"created_at\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x129\n" +
+	"\n" +
+	"updated_at\x18\b \x01(\v2\x1a.google.protobuf.TimestampR\tupdatedAt\x12\x18\n" +
+	"\aversion\x18\t \x01(\x03R\aversion\x12,\n" +
+	"\x06status\x18\n" +
+	" \x01(\x0e2\x14.users.v2.UserStatusR\x06status\x12\x1d\n" +
+	"\n" +
+	"avatar_url\x18\v \x01(\tR\tavatarUrl\x12>\n" +
+	"\rlast_login_at\x18\f \x01(\v2\x1a.google.protobuf.TimestampR\vlastLoginAt\x12<\n" +
+	"\flast_seen_at\x18\r \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"lastSeenAt\x12,\n" +
+	"\x12two_factor_enabled\x18\x0e \x01(\bR\x10twoFactorEnabled\"\x9d\x03\n" +
+	"\x06Update\x12\x18\n" +
+	"\x02id\x18\x01 \x01(\tB\b\xbaH\x05r\x03\xb0\x01\x01R\x02id\x12\x1d\n" +
+	"\n" +
+	"first_name\x18\x02 \x01(\tR\tfirstName\x12\x1b\n" +
+	"\tlast_name\x18\x03 \x01(\tR\blastName\x12&\n" +
+	"\bpassword\x18\x04 \x01(\tB\n" +
+	"\xbaH\a\xd8\x01\x01r\x02\x10\n" +
+	"R\bpassword\x12)\n" +
+	"\x10confirm_password\x18\x05 \x01(\tR\x0fconfirmPassword\x12t\n" +
+	"\acountry\x18\x06 \x01(\tBZ\xbaHW\xba\x01Q\n" +
+	"\acountry\x12*must be an ISO 3166-1 alpha-2 country code\x1a\x1athis.matches('^[A-Z]{2}$')\xd8\x01\x01R\acountry\x12\x18\n" +
+	"\aversion\x18\a \x01(\x03R\aversion\x12;\n" +
+	"\vupdate_mask\x18\b \x01(\v2\x1a.google.protobuf.FieldMaskR\n" +
+	"updateMask\x12\x1d\n" +
+	"\n" +
+	"avatar_url\x18\t \x01(\tR\tavatarUrl\"\x1f\n" +
+	"\x03Ref\x12\x18\n" +
+	"\x02id\x18\x01 \x01(\tB\b\xbaH\x05r\x03\xb0\x01\x01R\x02id\"\x18\n" +
+	"\x04Refs\x12\x10\n" +
+	"\x03ids\x18\x01 \x03(\tR\x03ids\"8\n" +
+	"\fDeleteResult\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x18\n" +
+	"\adeleted\x18\x02 \x01(\bR\adeleted\"E\n" +
+	"\x11BatchDeleteResult\x120\n" +
+	"\aresults\x18\x01 \x03(\v2\x16.users.v2.DeleteResultR\aresults\"U\n" +
+	"\tGetResult\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x14\n" +
+	"\x05found\x18\x02 \x01(\bR\x05found\x12\"\n" +
+	"\x04user\x18\x03 \x01(\v2\x0e.users.v2.UserR\x04user\"?\n" +
+	"\x0eBatchGetResult\x12-\n" +
+	"\aresults\x18\x01 \x03(\v2\x13.users.v2.GetResultR\aresults\"\x85\x04\n" +
+	"\x05Query\x12?\n" +
+	"\rcreated_after\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\fcreatedAfter\x12\x18\n" +
+	"\acountry\x18\x02 \x01(\tR\acountry\x12\x16\n" +
+	"\x06length\x18\x03 \x01(\x05R\x06length\x12\x12\n" +
+	"\x04page\x18\x04 \x01(\x03R\x04page\x12,\n" +
+	"\asort_by\x18\x05 \x01(\x0e2\x13.users.v2.SortFieldR\x06sortBy\x12>\n" +
+	"\x0esort_direction\x18\x06 \x01(\x0e2\x17.users.v2.SortDirectionR\rsortDirection\x12,\n" +
+	"\x06status\x18\a \x01(\x0e2\x14.users.v2.UserStatusR\x06status\x12\x16\n" +
+	"\x06search\x18\b \x01(\tR\x06search\x12A\n" +
+	"\x0einactive_since\x18\t \x01(\v2\x1a.google.protobuf.TimestampR\rinactiveSince\x12\x1c\n" +
+	"\tcountries\x18\n" +
+	" \x03(\tR\tcountries\x12A\n" +
+	"\x0ecreated_before\x18\v \x01(\v2\x1a.google.protobuf.TimestampR\rcreatedBefore\x12\x1d\n" +
+	"\n" +
+	"skip_total\x18\f \x01(\bR\tskipTotal\"\x92\x01\n" +
+	"\x04Page\x12\x12\n" +
+	"\x04page\x18\x01 \x01(\x03R\x04page\x12\x14\n" +
+	"\x05total\x18\x02 \x01(\x03R\x05total\x12$\n" +
+	"\x05items\x18\x03 \x03(\v2\x0e.users.v2.UserR\x05items\x12\x19\n" +
+	"\bhas_next\x18\x04 \x01(\bR\ahasNext\x12\x1f\n" +
+	"\vtotal_pages\x18\x05 \x01(\x03R\n" +
+	"totalPages\"\x1d\n" +
+	"\x05Count\x12\x14\n" +
+	"\x05total\x18\x01 \x01(\x03R\x05total\"\xab\x02\n" +
+	"\n" +
+	"StatsQuery\x12?\n" +
+	"\rcreated_after\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\fcreatedAfter\x12A\n" +
+	"\x0ecreated_before\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\rcreatedBefore\x12\x18\n" +
+	"\acountry\x18\x03 \x01(\tR\acountry\x12\x1c\n" +
+	"\tcountries\x18\x04 \x03(\tR\tcountries\x12,\n" +
+	"\x06status\x18\x05 \x01(\x0e2\x14.users.v2.UserStatusR\x06status\x123\n" +
+	"\binterval\x18\x06 \x01(\x0e2\x17.users.v2.StatsIntervalR\binterval\">\n" +
+	"\fCountryCount\x12\x18\n" +
+	"\acountry\x18\x01 \x01(\tR\acountry\x12\x14\n" +
+	"\x05total\x18\x02 \x01(\x03R\x05total\"U\n" +
+	"\vSignupCount\x120\n" +
+	"\x05start\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\x05start\x12\x14\n" +
+	"\x05total\x18\x02 \x01(\x03R\x05total\"\x84\x01\n" +
+	"\x05Stats\x12\x14\n" +
+	"\x05total\x18\x01 \x01(\x03R\x05total\x124\n" +
+	"\tcountries\x18\x02 \x03(\v2\x16.users.v2.CountryCountR\tcountries\x12/\n" +
+	"\asignups\x18\x03 \x03(\v2\x15.users.v2.SignupCountR\asignups\"E\n" +
+	"\x06Lookup\x12\x16\n" +
+	"\x05email\x18\x01 \x01(\tH\x00R\x05email\x12\x1c\n" +
+	"\bnickname\x18\x02 \x01(\tH\x00R\bnicknameB\x05\n" +
+	"\x03key\"\xc7\x01\n" +
+	"\x0ePasswordChange\x12\x18\n" +
+	"\x02id\x18\x01 \x01(\tB\b\xbaH\x05r\x03\xb0\x01\x01R\x02id\x121\n" +
+	"\x10current_password\x18\x02 \x01(\tB\x06\xbaH\x03\xc8\x01\x01R\x0fcurrentPassword\x12#\n" +
+	"\bpassword\x18\x03 \x01(\tB\a\xbaH\x04r\x02\x10\n" +
+	"R\bpassword\x12)\n" +
+	"\x10confirm_password\x18\x04 \x01(\tR\x0fconfirmPassword\x12\x18\n" +
+	"\aversion\x18\x05 \x01(\x03R\aversion\"\x93\x01\n" +
+	"\vEmailChange\x12\x18\n" +
+	"\x02id\x18\x01 \x01(\tB\b\xbaH\x05r\x03\xb0\x01\x01R\x02id\x12\x1d\n" +
+	"\x05email\x18\x02 \x01(\tB\a\xbaH\x04r\x02`\x01R\x05email\x121\n" +
+	"\x10current_password\x18\x03 \x01(\tB\x06\xbaH\x03\xc8\x01\x01R\x0fcurrentPassword\x12\x18\n" +
+	"\aversion\x18\x04 \x01(\x03R\aversion\"h\n" +
+	"\x0eNicknameChange\x12\x18\n" +
+	"\x02id\x18\x01 \x01(\tB\b\xbaH\x05r\x03\xb0\x01\x01R\x02id\x12\"\n" +
+	"\bnickname\x18\x02 \x01(\tB\x06\xbaH\x03\xc8\x01\x01R\bnickname\x12\x18\n" +
+	"\aversion\x18\x03 \x01(\x03R\aversion\"1\n" +
+	"\x11EmailConfirmation\x12\x1c\n" +
+	"\x05token\x18\x01 \x01(\tB\x06\xbaH\x03\xc8\x01\x01R\x05token\"E\n" +
+	"\x11AvailabilityCheck\x12\x1a\n" +
+	"\bnickname\x18\x01 \x01(\tR\bnickname\x12\x14\n" +
+	"\x05email\x18\x02 \x01(\tR\x05email\"f\n" +
+	"\fAvailability\x12-\n" +
+	"\x12nickname_available\x18\x01 \x01(\bR\x11nicknameAvailable\x12'\n" +
+	"\x0femail_available\x18\x02 \x01(\bR\x0eemailAvailable\"&\n" +
+	"\bUserData\x12\x1a\n" +
+	"\bdocument\x18\x01 \x01(\tR\bdocument\"S\n" +
+	"\vCredentials\x12\x14\n" +
+	"\x05email\x18\x01 \x01(\tR\x05email\x12\x1a\n" +
+	"\bpassword\x18\x02 \x01(\tR\bpassword\x12\x12\n" +
+	"\x04code\x18\x03 \x01(\tR\x04code\"?\n" +
+	"\x13TwoFactorEnrollment\x12\x16\n" +
+	"\x06secret\x18\x01 \x01(\tR\x06secret\x12\x10\n" +
+	"\x03uri\x18\x02 \x01(\tR\x03uri\"E\n" +
+	"\rTwoFactorCode\x12\x18\n" +
+	"\x02id\x18\x01 \x01(\tB\b\xbaH\x05r\x03\xb0\x01\x01R\x02id\x12\x1a\n" +
+	"\x04code\x18\x02 \x01(\tB\x06\xbaH\x03\xc8\x01\x01R\x04code\"%\n" +
+	"\rRecoveryCodes\x12\x14\n" +
+	"\x05codes\x18\x01 \x03(\tR\x05codes\"0\n" +
+	"\n" +
+	"AuthResult\x12\"\n" +
+	"\x04user\x18\x01 \x01(\v2\x0e.users.v2.UserR\x04user\"5\n" +
+	"\x14PasswordResetRequest\x12\x1d\n" +
+	"\x05email\x18\x01 \x01(\tB\a\xbaH\x04r\x02`\x01R\x05email\"}\n" +
+	"\rPasswordReset\x12\x1c\n" +
+	"\x05token\x18\x01 \x01(\tB\x06\xbaH\x03\xc8\x01\x01R\x05token\x12#\n" +
+	"\bpassword\x18\x02 \x01(\tB\a\xbaH\x04r\x02\x10\n" +
+	"R\bpassword\x12)\n" +
+	"\x10confirm_password\x18\x03 \x01(\tR\x0fconfirmPassword\":\n" +
+	"\fWatchRequest\x12*\n" +
+	"\aactions\x18\x01 \x03(\x0e2\x10.users.v2.ActionR\aactions\"\xf3\x01\n" +
+	"\tUserEvent\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x18\n" +
+	"\aversion\x18\x02 \x01(\x03R\aversion\x12(\n" +
+	"\x06action\x18\x03 \x01(\x0e2\x10.users.v2.ActionR\x06action\x129\n" +
+	"\n" +
+	"created_at\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x123\n" +
+	"\asent_at\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\x06sentAt\x12\"\n" +
+	"\x04data\x18\x06 \x01(\v2\x0e.users.v2.UserR\x04data\"\x14\n" +
+	"\x12DeadLettersRequest\"\xfd\x01\n" +
+	"\n" +
+	"DeadLetter\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x18\n" +
+	"\aversion\x18\x02 \x01(\x03R\aversion\x12(\n" +
+	"\x06action\x18\x03 \x01(\x0e2\x10.users.v2.ActionR\x06action\x129\n" +
+	"\n" +
+	"created_at\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x12D\n" +
+	"\x10dead_lettered_at\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\x0edeadLetteredAt\x12\x1a\n" +
+	"\battempts\x18\x06 \x01(\x03R\battempts\"F\n" +
+	"\vDeadLetters\x127\n" +
+	"\fdead_letters\x18\x01 \x03(\v2\x14.users.v2.DeadLetterR\vdeadLetters*\x8d\x01\n" +
+	"\n" +
+	"UserStatus\x12\x1b\n" +
+	"\x17USER_STATUS_UNSPECIFIED\x10\x00\x12\x16\n" +
+	"\x12USER_STATUS_ACTIVE\x10\x01\x12\x19\n" +
+	"\x15USER_STATUS_SUSPENDED\x10\x02\x12\x16\n" +
+	"\x12USER_STATUS_BANNED\x10\x03\x12\x17\n" +
+	"\x13USER_STATUS_DORMANT\x10\x04*\x90\x01\n" +
+	"\tSortField\x12\x1a\n" +
+	"\x16SORT_FIELD_UNSPECIFIED\x10\x00\x12\x19\n" +
+	"\x15SORT_FIELD_CREATED_AT\x10\x01\x12\x19\n" +
+	"\x15SORT_FIELD_UPDATED_AT\x10\x02\x12\x18\n" +
+	"\x14SORT_FIELD_LAST_NAME\x10\x03\x12\x17\n" +
+	"\x13SORT_FIELD_NICKNAME\x10\x04*L\n" +
+	"\rSortDirection\x12\x1c\n" +
+	"\x18SORT_DIRECTION_ASCENDING\x10\x00\x12\x1d\n" +
+	"\x19SORT_DIRECTION_DESCENDING\x10\x01*\x8c\x03\n" +
+	"\x06Action\x12\x16\n" +
+	"\x12ACTION_UNSPECIFIED\x10\x00\x12\x12\n" +
+	"\x0eACTION_CREATED\x10\x01\x12\x12\n" +
+	"\x0eACTION_UPDATED\x10\x02\x12\x12\n" +
+	"\x0eACTION_DELETED\x10\x03\x12\x1b\n" +
+	"\x17ACTION_PASSWORD_CHANGED\x10\x04\x12\x18\n" +
+	"\x14ACTION_EMAIL_CHANGED\x10\x05\x12\x13\n" +
+	"\x0fACTION_RESTORED\x10\x06\x12\x15\n" +
+	"\x11ACTION_ANONYMIZED\x10\a\x12\x14\n" +
+	"\x10ACTION_SUSPENDED\x10\b\x12\x16\n" +
+	"\x12ACTION_REACTIVATED\x10\t\x12\x11\n" +
+	"\rACTION_BANNED\x10\n" +
+	"\x12\x1d\n" +
+	"\x19ACTION_TWO_FACTOR_ENABLED\x10\v\x12\x1e\n" +
+	"\x1aACTION_TWO_FACTOR_DISABLED\x10\f\x12\x19\n" +
+	"\x15ACTION_MARKED_DORMANT\x10\r\x12\x13\n" +
+	"\x0fACTION_REPLAYED\x10\x0e\x12\x1b\n" +
+	"\x17ACTION_NICKNAME_CHANGED\x10\x0f*z\n" +
+	"\rStatsInterval\x12\x1e\n" +
+	"\x1aSTATS_INTERVAL_UNSPECIFIED\x10\x00\x12\x16\n" +
+	"\x12STATS_INTERVAL_DAY\x10\x01\x12\x17\n" +
+	"\x13STATS_INTERVAL_WEEK\x10\x02\x12\x18\n" +
+	"\x14STATS_INTERVAL_MONTH\x10\x032\xee\x16\n" +
+	"\x05Users\x12E\n" +
+	"\n" +
+	"CreateUser\x12\x11.users.v2.NewUser\x1a\x0e.users.v2.User\"\x14\x82\xd3\xe4\x93\x02\x0e:\x01*\"\t/v2/users\x12I\n" +
+	"\n" +
+	"UpdateUser\x12\x10.users.v2.Update\x1a\x0e.users.v2.User\"\x19\x82\xd3\xe4\x93\x02\x13:\x01*\x1a\x0e/v2/users/{id}\x12@\n" +
+	"\aGetUser\x12\r.users.v2.Ref\x1a\x0e.users.v2.User\"\x16\x82\xd3\xe4\x93\x02\x10\x12\x0e/v2/users/{id}\x12K\n" +
+	"\n" +
+	"DeleteUser\x12\r.users.v2.Ref\x1a\x16.google.protobuf.Empty\"\x16\x82\xd3\xe4\x93\x02\x10*\x0e/v2/users/{id}\x12T\n" +
+	"\rTouchLastSeen\x12\r.users.v2.Ref\x1a\x16.google.protobuf.Empty\"\x1c\x82\xd3\xe4\x93\x02\x16\"\x14/v2/users/{id}:touch\x12L\n" +
+	"\vRestoreUser\x12\r.users.v2.Ref\x1a\x0e.users.v2.User\"\x1e\x82\xd3\xe4\x93\x02\x18\"\x16/v2/users/{id}:restore\x12V\n" +
+	"\x10ReplayUserEvents\x12\r.users.v2.Ref\x1a\x0e.users.v2.User\"#\x82\xd3\xe4\x93\x02\x1d\"\x1b/v2/users/{id}:replayEvents\x12_\n" +
+	"\x0fListDeadLetters\x12\x1c.users.v2.DeadLettersRequest\x1a\x15.users.v2.DeadLetters\"\x17\x82\xd3\xe4\x93\x02\x11\x12\x0f/v2/deadLetters\x12d\n" +
+	"\x11RequeueDeadLetter\x12\r.users.v2.Ref\x1a\x16.google.protobuf.Empty\"(\x82\xd3\xe4\x93\x02\"\" /v2/users/{id}:requeueDeadLetter\x12P\n" +
+	"\rAnonymizeUser\x12\r.users.v2.Ref\x1a\x0e.users.v2.User\" \x82\xd3\xe4\x93\x02\x1a\"\x18/v2/users/{id}:anonymize\x12L\n" +
+	"\vSuspendUser\x12\r.users.v2.Ref\x1a\x0e.users.v2.User\"\x1e\x82\xd3\xe4\x93\x02\x18\"\x16/v2/users/{id}:suspend\x12R\n" +
+	"\x0eReactivateUser\x12\r.users.v2.Ref\x1a\x0e.users.v2.User\"!\x82\xd3\xe4\x93\x02\x1b\"\x19/v2/users/{id}:reactivate\x12D\n" +
+	"\aBanUser\x12\r.users.v2.Ref\x1a\x0e.users.v2.User\"\x1a\x82\xd3\xe4\x93\x02\x14\"\x12/v2/users/{id}:ban\x12R\n" +
+	"\x0eExportUserData\x12\r.users.v2.Ref\x1a\x12.users.v2.UserData\"\x1d\x82\xd3\xe4\x93\x02\x17\x12\x15/v2/users/{id}:export\x12a\n" +
+	"\x10BatchDeleteUsers\x12\x0e.users.v2.Refs\x1a\x1b.users.v2.BatchDeleteResult\" \x82\xd3\xe4\x93\x02\x1a:\x01*\"\x15/v2/users:batchDelete\x12X\n" +
+	"\rBatchGetUsers\x12\x0e.users.v2.Refs\x1a\x18.users.v2.BatchGetResult\"\x1d\x82\xd3\xe4\x93\x02\x17:\x01*\"\x12/v2/users:batchGet\x12?\n" +
+	"\tFindUsers\x12\x0f.users.v2.Query\x1a\x0e.users.v2.Page\"\x11\x82\xd3\xe4\x93\x02\v\x12\t/v2/users\x12J\n" +
+	"\vExportUsers\x12\x0f.users.v2.Query\x1a\x0e.users.v2.User\"\x18\x82\xd3\xe4\x93\x02\x12\x12\x10/v2/users:export0\x01\x12G\n" +
+	"\n" +
+	"CountUsers\x12\x0f.users.v2.Query\x1a\x0f.users.v2.Count\"\x17\x82\xd3\xe4\x93\x02\x11\x12\x0f/v2/users:count\x12N\n" +
+	"\fGetUserStats\x12\x14.users.v2.StatsQuery\x1a\x0f.users.v2.Stats\"\x17\x82\xd3\xe4\x93\x02\x11\x12\x0f/v2/users:stats\x12H\n" +
+	"\n" +
+	"LookupUser\x12\x10.users.v2.Lookup\x1a\x0e.users.v2.User\"\x18\x82\xd3\xe4\x93\x02\x12\x12\x10/v2/users:lookup\x12m\n" +
+	"\x11CheckAvailability\x12\x1b.users.v2.AvailabilityCheck\x1a\x16.users.v2.Availability\"#\x82\xd3\xe4\x93\x02\x1d\x12\x1b/v2/users:checkAvailability\x12d\n" +
+	"\x0eChangePassword\x12\x18.users.v2.PasswordChange\x1a\x0e.users.v2.User\"(\x82\xd3\xe4\x93\x02\":\x01*\"\x1d/v2/users/{id}:changePassword\x12c\n" +
+	"\vChangeEmail\x12\x15.users.v2.EmailChange\x1a\x16.google.protobuf.Empty\"%\x82\xd3\xe4\x93\x02\x1f:\x01*\"\x1a/v2/users/{id}:changeEmail\x12j\n" +
+	"\x12ConfirmEmailChange\x12\x1b.users.v2.EmailConfirmation\x1a\x0e.users.v2.User\"'\x82\xd3\xe4\x93\x02!:\x01*\"\x1c/v2/users:confirmEmailChange\x12d\n" +
+	"\x0eChangeNickname\x12\x18.users.v2.NicknameChange\x1a\x0e.users.v2.User\"(\x82\xd3\xe4\x93\x02\":\x01*\"\x1d/v2/users/{id}:changeNickname\x12^\n" +
+	"\fAuthenticate\x12\x15.users.v2.Credentials\x1a\x14.users.v2.AuthResult\"!\x82\xd3\xe4\x93\x02\x1b:\x01*\"\x16/v2/users:authenticate\x12g\n" +
+	"\x0fEnrollTwoFactor\x12\r.users.v2.Ref\x1a\x1d.users.v2.TwoFactorEnrollment\"&\x82\xd3\xe4\x93\x02 \"\x1e/v2/users/{id}:enrollTwoFactor\x12p\n" +
+	"\x10ConfirmTwoFactor\x12\x17.users.v2.TwoFactorCode\x1a\x17.users.v2.RecoveryCodes\"*\x82\xd3\xe4\x93\x02$:\x01*\"\x1f/v2/users/{id}:confirmTwoFactor\x12g\n" +
+	"\x10DisableTwoFactor\x12\x17.users.v2.TwoFactorCode\x1a\x0e.users.v2.User\"*\x82\xd3\xe4\x93\x02$:\x01*\"\x1f/v2/users/{id}:disableTwoFactor\x12y\n" +
+	"\x14RequestPasswordReset\x12\x1e.users.v2.PasswordResetRequest\x1a\x16.google.protobuf.Empty\")\x82\xd3\xe4\x93\x02#:\x01*\"\x1e/v2/users:requestPasswordReset\x12\\\n" +
+	"\rResetPassword\x12\x17.users.v2.PasswordReset\x1a\x0e.users.v2.User\"\"\x82\xd3\xe4\x93\x02\x1c:\x01*\"\x17/v2/users:resetPassword\x12=\n" +
+	"\n" +
+	"WatchUsers\x12\x16.users.v2.WatchRequest\x1a\x13.users.v2.UserEvent\"\x000\x01B6Z4github.com/robotlovesyou/fitest/userspb/v2;userspbv2b\x06proto3"
+
+var (
+	file_v2_users_proto_rawDescOnce sync.Once
+	file_v2_users_proto_rawDescData []byte
+)
+
+func file_v2_users_proto_rawDescGZIP() []byte {
+	file_v2_users_proto_rawDescOnce.Do(func() {
+		file_v2_users_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_v2_users_proto_rawDesc), len(file_v2_users_proto_rawDesc)))
+	})
+	return file_v2_users_proto_rawDescData
+}
+
+var file_v2_users_proto_enumTypes = make([]protoimpl.EnumInfo, 5)
+var file_v2_users_proto_msgTypes = make([]protoimpl.MessageInfo, 36)
+var file_v2_users_proto_goTypes = []any{
+	(UserStatus)(0),               // 0: users.v2.UserStatus
+	(SortField)(0),                // 1: users.v2.SortField
+	(SortDirection)(0),            // 2: users.v2.SortDirection
+	(Action)(0),                   // 3: users.v2.Action
+	(StatsInterval)(0),            // 4: users.v2.StatsInterval
+	(*NewUser)(nil),               // 5: users.v2.NewUser
+	(*User)(nil),                  // 6: users.v2.User
+	(*Update)(nil),                // 7: users.v2.Update
+	(*Ref)(nil),                   // 8: users.v2.Ref
+	(*Refs)(nil),                  // 9: users.v2.Refs
+	(*DeleteResult)(nil),          // 10: users.v2.DeleteResult
+	(*BatchDeleteResult)(nil),     // 11: users.v2.BatchDeleteResult
+	(*GetResult)(nil),             // 12: users.v2.GetResult
+	(*BatchGetResult)(nil),        // 13: users.v2.BatchGetResult
+	(*Query)(nil),                 // 14: users.v2.Query
+	(*Page)(nil),                  // 15: users.v2.Page
+	(*Count)(nil),                 // 16: users.v2.Count
+	(*StatsQuery)(nil),            // 17: users.v2.StatsQuery
+	(*CountryCount)(nil),          // 18: users.v2.CountryCount
+	(*SignupCount)(nil),           // 19: users.v2.SignupCount
+	(*Stats)(nil),                 // 20: users.v2.Stats
+	(*Lookup)(nil),                // 21: users.v2.Lookup
+	(*PasswordChange)(nil),        // 22: users.v2.PasswordChange
+	(*EmailChange)(nil),           // 23: users.v2.EmailChange
+	(*NicknameChange)(nil),        // 24: users.v2.NicknameChange
+	(*EmailConfirmation)(nil),     // 25: users.v2.EmailConfirmation
+	(*AvailabilityCheck)(nil),     // 26: users.v2.AvailabilityCheck
+	(*Availability)(nil),          // 27: users.v2.Availability
+	(*UserData)(nil),              // 28: users.v2.UserData
+	(*Credentials)(nil),           // 29: users.v2.Credentials
+	(*TwoFactorEnrollment)(nil),   // 30: users.v2.TwoFactorEnrollment
+	(*TwoFactorCode)(nil),         // 31: users.v2.TwoFactorCode
+	(*RecoveryCodes)(nil),         // 32: users.v2.RecoveryCodes
+	(*AuthResult)(nil),            // 33: users.v2.AuthResult
+	(*PasswordResetRequest)(nil),  // 34: users.v2.PasswordResetRequest
+	(*PasswordReset)(nil),         // 35: users.v2.PasswordReset
+	(*WatchRequest)(nil),          // 36: users.v2.WatchRequest
+	(*UserEvent)(nil),             // 37: users.v2.UserEvent
+	(*DeadLettersRequest)(nil),    // 38: users.v2.DeadLettersRequest
+	(*DeadLetter)(nil),            // 39: users.v2.DeadLetter
+	(*DeadLetters)(nil),           // 40: users.v2.DeadLetters
+	(*timestamppb.Timestamp)(nil), // 41: google.protobuf.Timestamp
+	(*fieldmaskpb.FieldMask)(nil), // 42: google.protobuf.FieldMask
+	(*emptypb.Empty)(nil),         // 43: google.protobuf.Empty
+}
+var file_v2_users_proto_depIdxs = []int32{
+	41, // 0: users.v2.User.created_at:type_name -> google.protobuf.Timestamp
+	41, // 1: users.v2.User.updated_at:type_name -> google.protobuf.Timestamp
+	0,  // 2: users.v2.User.status:type_name -> users.v2.UserStatus
+	41, // 3: users.v2.User.last_login_at:type_name -> google.protobuf.Timestamp
+	41, // 4: users.v2.User.last_seen_at:type_name -> google.protobuf.Timestamp
+	42, // 5: users.v2.Update.update_mask:type_name -> google.protobuf.FieldMask
+	10, // 6: users.v2.BatchDeleteResult.results:type_name -> users.v2.DeleteResult
+	6,  // 7: users.v2.GetResult.user:type_name -> users.v2.User
+	12, // 8: users.v2.BatchGetResult.results:type_name -> users.v2.GetResult
+	41, // 9: users.v2.Query.created_after:type_name -> google.protobuf.Timestamp
+	1,  // 10: users.v2.Query.sort_by:type_name -> users.v2.SortField
+	2,  // 11: users.v2.Query.sort_direction:type_name -> users.v2.SortDirection
+	0,  // 12: users.v2.Query.status:type_name -> users.v2.UserStatus
+	41, // 13: users.v2.Query.inactive_since:type_name -> google.protobuf.Timestamp
+	41, // 14: users.v2.Query.created_before:type_name -> google.protobuf.Timestamp
+	6,  // 15: users.v2.Page.items:type_name -> users.v2.User
+	41, // 16: users.v2.StatsQuery.created_after:type_name -> google.protobuf.Timestamp
+	41, // 17: users.v2.StatsQuery.created_before:type_name -> google.protobuf.Timestamp
+	0,  // 18: users.v2.StatsQuery.status:type_name -> users.v2.UserStatus
+	4,  // 19: users.v2.StatsQuery.interval:type_name -> users.v2.StatsInterval
+	41, // 20: users.v2.SignupCount.start:type_name -> google.protobuf.Timestamp
+	18, // 21: users.v2.Stats.countries:type_name -> users.v2.CountryCount
+	19, // 22: users.v2.Stats.signups:type_name -> users.v2.SignupCount
+	6,  // 23: users.v2.AuthResult.user:type_name -> users.v2.User
+	3,  // 24: users.v2.WatchRequest.actions:type_name -> users.v2.Action
+	3,  // 25: users.v2.UserEvent.action:type_name -> users.v2.Action
+	41, // 26: users.v2.UserEvent.created_at:type_name -> google.protobuf.Timestamp
+	41, // 27: users.v2.UserEvent.sent_at:type_name -> google.protobuf.Timestamp
+	6,  // 28: users.v2.UserEvent.data:type_name -> users.v2.User
+	3,  // 29: users.v2.DeadLetter.action:type_name -> users.v2.Action
+	41, // 30: users.v2.DeadLetter.created_at:type_name -> google.protobuf.Timestamp
+	41, // 31: users.v2.DeadLetter.dead_lettered_at:type_name -> google.protobuf.Timestamp
+	39, // 32: users.v2.DeadLetters.dead_letters:type_name -> users.v2.DeadLetter
+	5,  // 33: users.v2.Users.CreateUser:input_type -> users.v2.NewUser
+	7,  // 34: users.v2.Users.UpdateUser:input_type -> users.v2.Update
+	8,  // 35: users.v2.Users.GetUser:input_type -> users.v2.Ref
+	8,  // 36: users.v2.Users.DeleteUser:input_type -> users.v2.Ref
+	8,  // 37: users.v2.Users.TouchLastSeen:input_type -> users.v2.Ref
+	8,  // 38: users.v2.Users.RestoreUser:input_type -> users.v2.Ref
+	8,  // 39: users.v2.Users.ReplayUserEvents:input_type -> users.v2.Ref
+	38, // 40: users.v2.Users.ListDeadLetters:input_type -> users.v2.DeadLettersRequest
+	8,  // 41: users.v2.Users.RequeueDeadLetter:input_type -> users.v2.Ref
+	8,  // 42: users.v2.Users.AnonymizeUser:input_type -> users.v2.Ref
+	8,  // 43: users.v2.Users.SuspendUser:input_type -> users.v2.Ref
+	8,  // 44: users.v2.Users.ReactivateUser:input_type -> users.v2.Ref
+	8,  // 45: users.v2.Users.BanUser:input_type -> users.v2.Ref
+	8,  // 46: users.v2.Users.ExportUserData:input_type -> users.v2.Ref
+	9,  // 47: users.v2.Users.BatchDeleteUsers:input_type -> users.v2.Refs
+	9,  // 48: users.v2.Users.BatchGetUsers:input_type -> users.v2.Refs
+	14, // 49: users.v2.Users.FindUsers:input_type -> users.v2.Query
+	14, // 50: users.v2.Users.ExportUsers:input_type -> users.v2.Query
+	14, // 51: users.v2.Users.CountUsers:input_type -> users.v2.Query
+	17, // 52: users.v2.Users.GetUserStats:input_type -> users.v2.StatsQuery
+	21, // 53: users.v2.Users.LookupUser:input_type -> users.v2.Lookup
+	26, // 54: users.v2.Users.CheckAvailability:input_type -> users.v2.AvailabilityCheck
+	22, // 55: users.v2.Users.ChangePassword:input_type -> users.v2.PasswordChange
+	23, // 56: users.v2.Users.ChangeEmail:input_type -> users.v2.EmailChange
+	25, // 57: users.v2.Users.ConfirmEmailChange:input_type -> users.v2.EmailConfirmation
+	24, // 58: users.v2.Users.ChangeNickname:input_type -> users.v2.NicknameChange
+	29, // 59: users.v2.Users.Authenticate:input_type -> users.v2.Credentials
+	8,  // 60: users.v2.Users.EnrollTwoFactor:input_type -> users.v2.Ref
+	31, // 61: users.v2.Users.ConfirmTwoFactor:input_type -> users.v2.TwoFactorCode
+	31, // 62: users.v2.Users.DisableTwoFactor:input_type -> users.v2.TwoFactorCode
+	34, // 63: users.v2.Users.RequestPasswordReset:input_type -> users.v2.PasswordResetRequest
+	35, // 64: users.v2.Users.ResetPassword:input_type -> users.v2.PasswordReset
+	36, // 65: users.v2.Users.WatchUsers:input_type -> users.v2.WatchRequest
+	6,  // 66: users.v2.Users.CreateUser:output_type -> users.v2.User
+	6,  // 67: users.v2.Users.UpdateUser:output_type -> users.v2.User
+	6,  // 68: users.v2.Users.GetUser:output_type -> users.v2.User
+	43, // 69: users.v2.Users.DeleteUser:output_type -> google.protobuf.Empty
+	43, // 70: users.v2.Users.TouchLastSeen:output_type -> google.protobuf.Empty
+	6,  // 71: users.v2.Users.RestoreUser:output_type -> users.v2.User
+	6,  // 72: users.v2.Users.ReplayUserEvents:output_type -> users.v2.User
+	40, // 73: users.v2.Users.ListDeadLetters:output_type -> users.v2.DeadLetters
+	43, // 74: users.v2.Users.RequeueDeadLetter:output_type -> google.protobuf.Empty
+	6,  // 75: users.v2.Users.AnonymizeUser:output_type -> users.v2.User
+	6,  // 76: users.v2.Users.SuspendUser:output_type -> users.v2.User
+	6,  // 77: users.v2.Users.ReactivateUser:output_type -> users.v2.User
+	6,  // 78: users.v2.Users.BanUser:output_type -> users.v2.User
+	28, // 79: users.v2.Users.ExportUserData:output_type -> users.v2.UserData
+	11, // 80: users.v2.Users.BatchDeleteUsers:output_type -> users.v2.BatchDeleteResult
+	13, // 81: users.v2.Users.BatchGetUsers:output_type -> users.v2.BatchGetResult
+	15, // 82: users.v2.Users.FindUsers:output_type -> users.v2.Page
+	6,  // 83: users.v2.Users.ExportUsers:output_type -> users.v2.User
+	16, // 84: users.v2.Users.CountUsers:output_type -> users.v2.Count
+	20, // 85: users.v2.Users.GetUserStats:output_type -> users.v2.Stats
+	6,  // 86: users.v2.Users.LookupUser:output_type -> users.v2.User
+	27, // 87: users.v2.Users.CheckAvailability:output_type -> users.v2.Availability
+	6,  // 88: users.v2.Users.ChangePassword:output_type -> users.v2.User
+	43, // 89: users.v2.Users.ChangeEmail:output_type -> google.protobuf.Empty
+	6,  // 90: users.v2.Users.ConfirmEmailChange:output_type -> users.v2.User
+	6,  // 91: users.v2.Users.ChangeNickname:output_type -> users.v2.User
+	33, // 92: users.v2.Users.Authenticate:output_type -> users.v2.AuthResult
+	30, // 93: users.v2.Users.EnrollTwoFactor:output_type -> users.v2.TwoFactorEnrollment
+	32, // 94: users.v2.Users.ConfirmTwoFactor:output_type -> users.v2.RecoveryCodes
+	6,  // 95: users.v2.Users.DisableTwoFactor:output_type -> users.v2.User
+	43, // 96: users.v2.Users.RequestPasswordReset:output_type -> google.protobuf.Empty
+	6,  // 97: users.v2.Users.ResetPassword:output_type -> users.v2.User
+	37, // 98: users.v2.Users.WatchUsers:output_type -> users.v2.UserEvent
+	66, // [66:99] is the sub-list for method output_type
+	33, // [33:66] is the sub-list for method input_type
+	33, // [33:33] is the sub-list for extension type_name
+	33, // [33:33] is the sub-list for extension extendee
+	0,  // [0:33] is the sub-list for field type_name
+}
+
+func init() { file_v2_users_proto_init() }
+func file_v2_users_proto_init() {
+	if File_v2_users_proto != nil {
+		return
+	}
+	file_v2_users_proto_msgTypes[16].OneofWrappers = []any{
+		(*Lookup_Email)(nil),
+		(*Lookup_Nickname)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_v2_users_proto_rawDesc), len(file_v2_users_proto_rawDesc)),
+			NumEnums:      5,
+			NumMessages:   36,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_v2_users_proto_goTypes,
+		DependencyIndexes: file_v2_users_proto_depIdxs,
+		EnumInfos:         file_v2_users_proto_enumTypes,
+		MessageInfos:      file_v2_users_proto_msgTypes,
+	}.Build()
+	File_v2_users_proto = out.File
+	file_v2_users_proto_goTypes = nil
+	file_v2_users_proto_depIdxs = nil
+}
@@ -0,0 +1,1433 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             v3.19.4
+// source: v2/users.proto
+
+package userspbv2
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	emptypb "google.golang.org/protobuf/types/known/emptypb"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// UsersClient is the client API for Users service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type UsersClient interface {
+	CreateUser(ctx context.Context, in *NewUser, opts ...grpc.CallOption) (*User, error)
+	UpdateUser(ctx context.Context, in *Update, opts ...grpc.CallOption) (*User, error)
+	// GetUser reads a single user by id. It fails with NOT_FOUND if there is no such user
+	GetUser(ctx context.Context, in *Ref, opts ...grpc.CallOption) (*User, error)
+	DeleteUser(ctx context.Context, in *Ref, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	// TouchLastSeen records that a user is active now, without changing the version of the user or publishing an
+	// event. It fails with NOT_FOUND if there is no such user
+	TouchLastSeen(ctx context.Context, in *Ref, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	// RestoreUser restores a deleted user, if users are soft deleted and the retention period has not passed. It fails
+	// with NOT_FOUND if there is no such user
+	RestoreUser(ctx context.Context, in *Ref, opts ...grpc.CallOption) (*User, error)
+	// ReplayUserEvents publishes the current state of a user again as an event with the Replayed action, without
+	// changing the user, so that consumers which have lost data can recover it. It fails with NOT_FOUND if there is no
+	// such user, and with FAILED_PRECONDITION if the user changed while the event was added
+	ReplayUserEvents(ctx context.Context, in *Ref, opts ...grpc.CallOption) (*User, error)
+	// ListDeadLetters lists the events of the users of the tenant, including deleted users, which failed to be
+	// published too many times, in the order they were dead lettered. The later events of their users are not
+	// published until they are requeued
+	ListDeadLetters(ctx context.Context, in *DeadLettersRequest, opts ...grpc.CallOption) (*DeadLetters, error)
+	// RequeueDeadLetter publishes the dead lettered event of a user again, followed by their later events. It fails
+	// with NOT_FOUND if the user has no dead lettered event
+	RequeueDeadLetter(ctx context.Context, in *Ref, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	// AnonymizeUser irreversibly replaces the names, nickname and email address of a user with placeholders, keeping
+	// the record so that references to the user remain valid. It fails with NOT_FOUND if there is no such user
+	AnonymizeUser(ctx context.Context, in *Ref, opts ...grpc.CallOption) (*User, error)
+	// SuspendUser suspends an active user. Suspended users cannot authenticate until they are reactivated. It fails
+	// with NOT_FOUND if there is no such user, and with FAILED_PRECONDITION if the user is not active
+	SuspendUser(ctx context.Context, in *Ref, opts ...grpc.CallOption) (*User, error)
+	// ReactivateUser makes a suspended or dormant user active again. It fails with NOT_FOUND if there is no such user,
+	// and with FAILED_PRECONDITION if the user is not suspended or dormant
+	ReactivateUser(ctx context.Context, in *Ref, opts ...grpc.CallOption) (*User, error)
+	// BanUser bans an active, suspended or dormant user. Banned users cannot authenticate and cannot be reactivated. It fails
+	// with NOT_FOUND if there is no such user, and with FAILED_PRECONDITION if the user is already banned
+	BanUser(ctx context.Context, in *Ref, opts ...grpc.CallOption) (*User, error)
+	// ExportUserData returns everything held about a user, including soft deleted users, for answering subject access
+	// requests. It fails with NOT_FOUND if there is no such user, and with PERMISSION_DENIED if the caller may only
+	// receive redacted users
+	ExportUserData(ctx context.Context, in *Ref, opts ...grpc.CallOption) (*UserData, error)
+	// BatchDeleteUsers deletes up to 500 users in a single call. If any id is invalid, no users are deleted
+	BatchDeleteUsers(ctx context.Context, in *Refs, opts ...grpc.CallOption) (*BatchDeleteResult, error)
+	// BatchGetUsers reads up to 500 users in a single call, so that lists of users can be enriched without reading
+	// each user separately. Users which do not exist are reported as not found rather than failing the call
+	BatchGetUsers(ctx context.Context, in *Refs, opts ...grpc.CallOption) (*BatchGetResult, error)
+	FindUsers(ctx context.Context, in *Query, opts ...grpc.CallOption) (*Page, error)
+	// ExportUsers streams every user matching the query, without paging. The page and length of the query are ignored
+	ExportUsers(ctx context.Context, in *Query, opts ...grpc.CallOption) (Users_ExportUsersClient, error)
+	// CountUsers counts the users matching the query, without fetching them. The page, length and sort of the
+	// query are ignored
+	CountUsers(ctx context.Context, in *Query, opts ...grpc.CallOption) (*Count, error)
+	// GetUserStats counts the users matching the query by country and by the period in which they signed up
+	GetUserStats(ctx context.Context, in *StatsQuery, opts ...grpc.CallOption) (*Stats, error)
+	// LookupUser finds a single user by email address or nickname. It fails with NOT_FOUND if there is no such user
+	LookupUser(ctx context.Context, in *Lookup, opts ...grpc.CallOption) (*User, error)
+	// CheckAvailability checks whether a nickname, an email address, or both, can be used by a new user. Results are
+	// cached briefly, so a value reported as available may still be taken when the user is created
+	CheckAvailability(ctx context.Context, in *AvailabilityCheck, opts ...grpc.CallOption) (*Availability, error)
+	// ChangePassword changes the password of a user after checking their current password. It fails with
+	// UNAUTHENTICATED if the current password is incorrect
+	ChangePassword(ctx context.Context, in *PasswordChange, opts ...grpc.CallOption) (*User, error)
+	// ChangeEmail sends a single use token to a new email address for a user, after checking their current password.
+	// The address is not changed until the change is confirmed with ConfirmEmailChange. It fails with
+	// UNAUTHENTICATED if the current password is incorrect and ALREADY_EXISTS if another user has the address
+	ChangeEmail(ctx context.Context, in *EmailChange, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	// ConfirmEmailChange changes the email address of the user an email change token was sent to. It fails with
+	// UNAUTHENTICATED if the token is unknown, has expired or has already been used, and ALREADY_EXISTS if another
+	// user has taken the address since the change was requested
+	ConfirmEmailChange(ctx context.Context, in *EmailConfirmation, opts ...grpc.CallOption) (*User, error)
+	// ChangeNickname changes the nickname of a user. The previous nickname is kept in the history of the user. It
+	// fails with ALREADY_EXISTS if another user has the nickname, and with FAILED_PRECONDITION and the reason
+	// NICKNAME_CHANGE_TOO_SOON if the user changed their nickname within the cooldown
+	ChangeNickname(ctx context.Context, in *NicknameChange, opts ...grpc.CallOption) (*User, error)
+	// Authenticate checks the password of the user with the given email address and returns the user if it is
+	// correct. It fails with UNAUTHENTICATED if the email address is unknown or the password is incorrect, and, for users
+	// with two factor authentication enabled, if the code is missing or incorrect
+	Authenticate(ctx context.Context, in *Credentials, opts ...grpc.CallOption) (*AuthResult, error)
+	// EnrollTwoFactor starts the enrollment of a user in two factor authentication, replacing any enrollment which has
+	// not been confirmed. It fails with FAILED_PRECONDITION if the user already has two factor authentication enabled,
+	// or the service is not configured for it
+	EnrollTwoFactor(ctx context.Context, in *Ref, opts ...grpc.CallOption) (*TwoFactorEnrollment, error)
+	// ConfirmTwoFactor enables two factor authentication for an enrolled user with the current code from their
+	// authenticator app, and returns their recovery codes. The recovery codes cannot be read again
+	ConfirmTwoFactor(ctx context.Context, in *TwoFactorCode, opts ...grpc.CallOption) (*RecoveryCodes, error)
+	// DisableTwoFactor turns two factor authentication off for a user, with the current code from their authenticator
+	// app or one of their recovery codes
+	DisableTwoFactor(ctx context.Context, in *TwoFactorCode, opts ...grpc.CallOption) (*User, error)
+	// RequestPasswordReset sends a single use password reset token to the user with the given email address. It
+	// succeeds whether or not the email address is registered, so that it cannot be used to discover users
+	RequestPasswordReset(ctx context.Context, in *PasswordResetRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	// ResetPassword sets the password of the user a password reset token was sent to. It fails with
+	// UNAUTHENTICATED if the token is unknown, has expired or has already been used
+	ResetPassword(ctx context.Context, in *PasswordReset, opts ...grpc.CallOption) (*User, error)
+	// WatchUsers streams change events to the caller as they are published by the service
+	WatchUsers(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (Users_WatchUsersClient, error)
+}
+
+type usersClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewUsersClient(cc grpc.ClientConnInterface) UsersClient {
+	return &usersClient{cc}
+}
+
+func (c *usersClient) CreateUser(ctx context.Context, in *NewUser, opts ...grpc.CallOption) (*User, error) {
+	out := new(User)
+	err := c.cc.Invoke(ctx, "/users.v2.Users/CreateUser", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersClient) UpdateUser(ctx context.Context, in *Update, opts ...grpc.CallOption) (*User, error) {
+	out := new(User)
+	err := c.cc.Invoke(ctx, "/users.v2.Users/UpdateUser", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersClient) GetUser(ctx context.Context, in *Ref, opts ...grpc.CallOption) (*User, error) {
+	out := new(User)
+	err := c.cc.Invoke(ctx, "/users.v2.Users/GetUser", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersClient) DeleteUser(ctx context.Context, in *Ref, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/users.v2.Users/DeleteUser", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersClient) TouchLastSeen(ctx context.Context, in *Ref, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/users.v2.Users/TouchLastSeen", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersClient) RestoreUser(ctx context.Context, in *Ref, opts ...grpc.CallOption) (*User, error) {
+	out := new(User)
+	err := c.cc.Invoke(ctx, "/users.v2.Users/RestoreUser", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersClient) ReplayUserEvents(ctx context.Context, in *Ref, opts ...grpc.CallOption) (*User, error) {
+	out := new(User)
+	err := c.cc.Invoke(ctx, "/users.v2.Users/ReplayUserEvents", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersClient) ListDeadLetters(ctx context.Context, in *DeadLettersRequest, opts ...grpc.CallOption) (*DeadLetters, error) {
+	out := new(DeadLetters)
+	err := c.cc.Invoke(ctx, "/users.v2.Users/ListDeadLetters", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersClient) RequeueDeadLetter(ctx context.Context, in *Ref, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/users.v2.Users/RequeueDeadLetter", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersClient) AnonymizeUser(ctx context.Context, in *Ref, opts ...grpc.CallOption) (*User, error) {
+	out := new(User)
+	err := c.cc.Invoke(ctx, "/users.v2.Users/AnonymizeUser", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersClient) SuspendUser(ctx context.Context, in *Ref, opts ...grpc.CallOption) (*User, error) {
+	out := new(User)
+	err := c.cc.Invoke(ctx, "/users.v2.Users/SuspendUser", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersClient) ReactivateUser(ctx context.Context, in *Ref, opts ...grpc.CallOption) (*User, error) {
+	out := new(User)
+	err := c.cc.Invoke(ctx, "/users.v2.Users/ReactivateUser", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersClient) BanUser(ctx context.Context, in *Ref, opts ...grpc.CallOption) (*User, error) {
+	out := new(User)
+	err := c.cc.Invoke(ctx, "/users.v2.Users/BanUser", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersClient) ExportUserData(ctx context.Context, in *Ref, opts ...grpc.CallOption) (*UserData, error) {
+	out := new(UserData)
+	err := c.cc.Invoke(ctx, "/users.v2.Users/ExportUserData", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersClient) BatchDeleteUsers(ctx context.Context, in *Refs, opts ...grpc.CallOption) (*BatchDeleteResult, error) {
+	out := new(BatchDeleteResult)
+	err := c.cc.Invoke(ctx, "/users.v2.Users/BatchDeleteUsers", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersClient) BatchGetUsers(ctx context.Context, in *Refs, opts ...grpc.CallOption) (*BatchGetResult, error) {
+	out := new(BatchGetResult)
+	err := c.cc.Invoke(ctx, "/users.v2.Users/BatchGetUsers", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersClient) FindUsers(ctx context.Context, in *Query, opts ...grpc.CallOption) (*Page, error) {
+	out := new(Page)
+	err := c.cc.Invoke(ctx, "/users.v2.Users/FindUsers", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersClient) ExportUsers(ctx context.Context, in *Query, opts ...grpc.CallOption) (Users_ExportUsersClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Users_ServiceDesc.Streams[0], "/users.v2.Users/ExportUsers", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &usersExportUsersClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Users_ExportUsersClient interface {
+	Recv() (*User, error)
+	grpc.ClientStream
+}
+
+type usersExportUsersClient struct {
+	grpc.ClientStream
+}
+
+func (x *usersExportUsersClient) Recv() (*User, error) {
+	m := new(User)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *usersClient) CountUsers(ctx context.Context, in *Query, opts ...grpc.CallOption) (*Count, error) {
+	out := new(Count)
+	err := c.cc.Invoke(ctx, "/users.v2.Users/CountUsers", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersClient) GetUserStats(ctx context.Context, in *StatsQuery, opts ...grpc.CallOption) (*Stats, error) {
+	out := new(Stats)
+	err := c.cc.Invoke(ctx, "/users.v2.Users/GetUserStats", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersClient) LookupUser(ctx context.Context, in *Lookup, opts ...grpc.CallOption) (*User, error) {
+	out := new(User)
+	err := c.cc.Invoke(ctx, "/users.v2.Users/LookupUser", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersClient) CheckAvailability(ctx context.Context, in *AvailabilityCheck, opts ...grpc.CallOption) (*Availability, error) {
+	out := new(Availability)
+	err := c.cc.Invoke(ctx, "/users.v2.Users/CheckAvailability", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersClient) ChangePassword(ctx context.Context, in *PasswordChange, opts ...grpc.CallOption) (*User, error) {
+	out := new(User)
+	err := c.cc.Invoke(ctx, "/users.v2.Users/ChangePassword", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersClient) ChangeEmail(ctx context.Context, in *EmailChange, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/users.v2.Users/ChangeEmail", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersClient) ConfirmEmailChange(ctx context.Context, in *EmailConfirmation, opts ...grpc.CallOption) (*User, error) {
+	out := new(User)
+	err := c.cc.Invoke(ctx, "/users.v2.Users/ConfirmEmailChange", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersClient) ChangeNickname(ctx context.Context, in *NicknameChange, opts ...grpc.CallOption) (*User, error) {
+	out := new(User)
+	err := c.cc.Invoke(ctx, "/users.v2.Users/ChangeNickname", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersClient) Authenticate(ctx context.Context, in *Credentials, opts ...grpc.CallOption) (*AuthResult, error) {
+	out := new(AuthResult)
+	err := c.cc.Invoke(ctx, "/users.v2.Users/Authenticate", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersClient) EnrollTwoFactor(ctx context.Context, in *Ref, opts ...grpc.CallOption) (*TwoFactorEnrollment, error) {
+	out := new(TwoFactorEnrollment)
+	err := c.cc.Invoke(ctx, "/users.v2.Users/EnrollTwoFactor", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersClient) ConfirmTwoFactor(ctx context.Context, in *TwoFactorCode, opts ...grpc.CallOption) (*RecoveryCodes, error) {
+	out := new(RecoveryCodes)
+	err := c.cc.Invoke(ctx, "/users.v2.Users/ConfirmTwoFactor", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersClient) DisableTwoFactor(ctx context.Context, in *TwoFactorCode, opts ...grpc.CallOption) (*User, error) {
+	out := new(User)
+	err := c.cc.Invoke(ctx, "/users.v2.Users/DisableTwoFactor", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersClient) RequestPasswordReset(ctx context.Context, in *PasswordResetRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/users.v2.Users/RequestPasswordReset", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersClient) ResetPassword(ctx context.Context, in *PasswordReset, opts ...grpc.CallOption) (*User, error) {
+	out := new(User)
+	err := c.cc.Invoke(ctx, "/users.v2.Users/ResetPassword", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usersClient) WatchUsers(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (Users_WatchUsersClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Users_ServiceDesc.Streams[1], "/users.v2.Users/WatchUsers", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &usersWatchUsersClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Users_WatchUsersClient interface {
+	Recv() (*UserEvent, error)
+	grpc.ClientStream
+}
+
+type usersWatchUsersClient struct {
+	grpc.ClientStream
+}
+
+func (x *usersWatchUsersClient) Recv() (*UserEvent, error) {
+	m := new(UserEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// UsersServer is the server API for Users service.
+// All implementations must embed UnimplementedUsersServer
+// for forward compatibility
+type UsersServer interface {
+	CreateUser(context.Context, *NewUser) (*User, error)
+	UpdateUser(context.Context, *Update) (*User, error)
+	// GetUser reads a single user by id. It fails with NOT_FOUND if there is no such user
+	GetUser(context.Context, *Ref) (*User, error)
+	DeleteUser(context.Context, *Ref) (*emptypb.Empty, error)
+	// TouchLastSeen records that a user is active now, without changing the version of the user or publishing an
+	// event. It fails with NOT_FOUND if there is no such user
+	TouchLastSeen(context.Context, *Ref) (*emptypb.Empty, error)
+	// RestoreUser restores a deleted user, if users are soft deleted and the retention period has not passed. It fails
+	// with NOT_FOUND if there is no such user
+	RestoreUser(context.Context, *Ref) (*User, error)
+	// ReplayUserEvents publishes the current state of a user again as an event with the Replayed action, without
+	// changing the user, so that consumers which have lost data can recover it. It fails with NOT_FOUND if there is no
+	// such user, and with FAILED_PRECONDITION if the user changed while the event was added
+	ReplayUserEvents(context.Context, *Ref) (*User, error)
+	// ListDeadLetters lists the events of the users of the tenant, including deleted users, which failed to be
+	// published too many times, in the order they were dead lettered. The later events of their users are not
+	// published until they are requeued
+	ListDeadLetters(context.Context, *DeadLettersRequest) (*DeadLetters, error)
+	// RequeueDeadLetter publishes the dead lettered event of a user again, followed by their later events. It fails
+	// with NOT_FOUND if the user has no dead lettered event
+	RequeueDeadLetter(context.Context, *Ref) (*emptypb.Empty, error)
+	// AnonymizeUser irreversibly replaces the names, nickname and email address of a user with placeholders, keeping
+	// the record so that references to the user remain valid. It fails with NOT_FOUND if there is no such user
+	AnonymizeUser(context.Context, *Ref) (*User, error)
+	// SuspendUser suspends an active user. Suspended users cannot authenticate until they are reactivated. It fails
+	// with NOT_FOUND if there is no such user, and with FAILED_PRECONDITION if the user is not active
+	SuspendUser(context.Context, *Ref) (*User, error)
+	// ReactivateUser makes a suspended or dormant user active again. It fails with NOT_FOUND if there is no such user,
+	// and with FAILED_PRECONDITION if the user is not suspended or dormant
+	ReactivateUser(context.Context, *Ref) (*User, error)
+	// BanUser bans an active, suspended or dormant user. Banned users cannot authenticate and cannot be reactivated. It fails
+	// with NOT_FOUND if there is no such user, and with FAILED_PRECONDITION if the user is already banned
+	BanUser(context.Context, *Ref) (*User, error)
+	// ExportUserData returns everything held about a user, including soft deleted users, for answering subject access
+	// requests. It fails with NOT_FOUND if there is no such user, and with PERMISSION_DENIED if the caller may only
+	// receive redacted users
+	ExportUserData(context.Context, *Ref) (*UserData, error)
+	// BatchDeleteUsers deletes up to 500 users in a single call. If any id is invalid, no users are deleted
+	BatchDeleteUsers(context.Context, *Refs) (*BatchDeleteResult, error)
+	// BatchGetUsers reads up to 500 users in a single call, so that lists of users can be enriched without reading
+	// each user separately. Users which do not exist are reported as not found rather than failing the call
+	BatchGetUsers(context.Context, *Refs) (*BatchGetResult, error)
+	FindUsers(context.Context, *Query) (*Page, error)
+	// ExportUsers streams every user matching the query, without paging. The page and length of the query are ignored
+	ExportUsers(*Query, Users_ExportUsersServer) error
+	// CountUsers counts the users matching the query, without fetching them. The page, length and sort of the
+	// query are ignored
+	CountUsers(context.Context, *Query) (*Count, error)
+	// GetUserStats counts the users matching the query by country and by the period in which they signed up
+	GetUserStats(context.Context, *StatsQuery) (*Stats, error)
+	// LookupUser finds a single user by email address or nickname. It fails with NOT_FOUND if there is no such user
+	LookupUser(context.Context, *Lookup) (*User, error)
+	// CheckAvailability checks whether a nickname, an email address, or both, can be used by a new user. Results are
+	// cached briefly, so a value reported as available may still be taken when the user is created
+	CheckAvailability(context.Context, *AvailabilityCheck) (*Availability, error)
+	// ChangePassword changes the password of a user after checking their current password. It fails with
+	// UNAUTHENTICATED if the current password is incorrect
+	ChangePassword(context.Context, *PasswordChange) (*User, error)
+	// ChangeEmail sends a single use token to a new email address for a user, after checking their current password.
+	// The address is not changed until the change is confirmed with ConfirmEmailChange. It fails with
+	// UNAUTHENTICATED if the current password is incorrect and ALREADY_EXISTS if another user has the address
+	ChangeEmail(context.Context, *EmailChange) (*emptypb.Empty, error)
+	// ConfirmEmailChange changes the email address of the user an email change token was sent to. It fails with
+	// UNAUTHENTICATED if the token is unknown, has expired or has already been used, and ALREADY_EXISTS if another
+	// user has taken the address since the change was requested
+	ConfirmEmailChange(context.Context, *EmailConfirmation) (*User, error)
+	// ChangeNickname changes the nickname of a user. The previous nickname is kept in the history of the user. It
+	// fails with ALREADY_EXISTS if another user has the nickname, and with FAILED_PRECONDITION and the reason
+	// NICKNAME_CHANGE_TOO_SOON if the user changed their nickname within the cooldown
+	ChangeNickname(context.Context, *NicknameChange) (*User, error)
+	// Authenticate checks the password of the user with the given email address and returns the user if it is
+	// correct. It fails with UNAUTHENTICATED if the email address is unknown or the password is incorrect, and, for users
+	// with two factor authentication enabled, if the code is missing or incorrect
+	Authenticate(context.Context, *Credentials) (*AuthResult, error)
+	// EnrollTwoFactor starts the enrollment of a user in two factor authentication, replacing any enrollment which has
+	// not been confirmed. It fails with FAILED_PRECONDITION if the user already has two factor authentication enabled,
+	// or the service is not configured for it
+	EnrollTwoFactor(context.Context, *Ref) (*TwoFactorEnrollment, error)
+	// ConfirmTwoFactor enables two factor authentication for an enrolled user with the current code from their
+	// authenticator app, and returns their recovery codes. The recovery codes cannot be read again
+	ConfirmTwoFactor(context.Context, *TwoFactorCode) (*RecoveryCodes, error)
+	// DisableTwoFactor turns two factor authentication off for a user, with the current code from their authenticator
+	// app or one of their recovery codes
+	DisableTwoFactor(context.Context, *TwoFactorCode) (*User, error)
+	// RequestPasswordReset sends a single use password reset token to the user with the given email address. It
+	// succeeds whether or not the email address is registered, so that it cannot be used to discover users
+	RequestPasswordReset(context.Context, *PasswordResetRequest) (*emptypb.Empty, error)
+	// ResetPassword sets the password of the user a password reset token was sent to. It fails with
+	// UNAUTHENTICATED if the token is unknown, has expired or has already been used
+	ResetPassword(context.Context, *PasswordReset) (*User, error)
+	// WatchUsers streams change events to the caller as they are published by the service
+	WatchUsers(*WatchRequest, Users_WatchUsersServer) error
+	mustEmbedUnimplementedUsersServer()
+}
+
+// UnimplementedUsersServer must be embedded to have forward compatible implementations.
+type UnimplementedUsersServer struct {
+}
+
+func (UnimplementedUsersServer) CreateUser(context.Context, *NewUser) (*User, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateUser not implemented")
+}
+func (UnimplementedUsersServer) UpdateUser(context.Context, *Update) (*User, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateUser not implemented")
+}
+func (UnimplementedUsersServer) GetUser(context.Context, *Ref) (*User, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetUser not implemented")
+}
+func (UnimplementedUsersServer) DeleteUser(context.Context, *Ref) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteUser not implemented")
+}
+func (UnimplementedUsersServer) TouchLastSeen(context.Context, *Ref) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method TouchLastSeen not implemented")
+}
+func (UnimplementedUsersServer) RestoreUser(context.Context, *Ref) (*User, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RestoreUser not implemented")
+}
+func (UnimplementedUsersServer) ReplayUserEvents(context.Context, *Ref) (*User, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReplayUserEvents not implemented")
+}
+func (UnimplementedUsersServer) ListDeadLetters(context.Context, *DeadLettersRequest) (*DeadLetters, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListDeadLetters not implemented")
+}
+func (UnimplementedUsersServer) RequeueDeadLetter(context.Context, *Ref) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RequeueDeadLetter not implemented")
+}
+func (UnimplementedUsersServer) AnonymizeUser(context.Context, *Ref) (*User, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AnonymizeUser not implemented")
+}
+func (UnimplementedUsersServer) SuspendUser(context.Context, *Ref) (*User, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SuspendUser not implemented")
+}
+func (UnimplementedUsersServer) ReactivateUser(context.Context, *Ref) (*User, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReactivateUser not implemented")
+}
+func (UnimplementedUsersServer) BanUser(context.Context, *Ref) (*User, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BanUser not implemented")
+}
+func (UnimplementedUsersServer) ExportUserData(context.Context, *Ref) (*UserData, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ExportUserData not implemented")
+}
+func (UnimplementedUsersServer) BatchDeleteUsers(context.Context, *Refs) (*BatchDeleteResult, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchDeleteUsers not implemented")
+}
+func (UnimplementedUsersServer) BatchGetUsers(context.Context, *Refs) (*BatchGetResult, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchGetUsers not implemented")
+}
+func (UnimplementedUsersServer) FindUsers(context.Context, *Query) (*Page, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method FindUsers not implemented")
+}
+func (UnimplementedUsersServer) ExportUsers(*Query, Users_ExportUsersServer) error {
+	return status.Errorf(codes.Unimplemented, "method ExportUsers not implemented")
+}
+func (UnimplementedUsersServer) CountUsers(context.Context, *Query) (*Count, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CountUsers not implemented")
+}
+func (UnimplementedUsersServer) GetUserStats(context.Context, *StatsQuery) (*Stats, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetUserStats not implemented")
+}
+func (UnimplementedUsersServer) LookupUser(context.Context, *Lookup) (*User, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method LookupUser not implemented")
+}
+func (UnimplementedUsersServer) CheckAvailability(context.Context, *AvailabilityCheck) (*Availability, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CheckAvailability not implemented")
+}
+func (UnimplementedUsersServer) ChangePassword(context.Context, *PasswordChange) (*User, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ChangePassword not implemented")
+}
+func (UnimplementedUsersServer) ChangeEmail(context.Context, *EmailChange) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ChangeEmail not implemented")
+}
+func (UnimplementedUsersServer) ConfirmEmailChange(context.Context, *EmailConfirmation) (*User, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ConfirmEmailChange not implemented")
+}
+func (UnimplementedUsersServer) ChangeNickname(context.Context, *NicknameChange) (*User, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ChangeNickname not implemented")
+}
+func (UnimplementedUsersServer) Authenticate(context.Context, *Credentials) (*AuthResult, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Authenticate not implemented")
+}
+func (UnimplementedUsersServer) EnrollTwoFactor(context.Context, *Ref) (*TwoFactorEnrollment, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method EnrollTwoFactor not implemented")
+}
+func (UnimplementedUsersServer) ConfirmTwoFactor(context.Context, *TwoFactorCode) (*RecoveryCodes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ConfirmTwoFactor not implemented")
+}
+func (UnimplementedUsersServer) DisableTwoFactor(context.Context, *TwoFactorCode) (*User, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DisableTwoFactor not implemented")
+}
+func (UnimplementedUsersServer) RequestPasswordReset(context.Context, *PasswordResetRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RequestPasswordReset not implemented")
+}
+func (UnimplementedUsersServer) ResetPassword(context.Context, *PasswordReset) (*User, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ResetPassword not implemented")
+}
+func (UnimplementedUsersServer) WatchUsers(*WatchRequest, Users_WatchUsersServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchUsers not implemented")
+}
+func (UnimplementedUsersServer) mustEmbedUnimplementedUsersServer() {}
+
+// UnsafeUsersServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to UsersServer will
+// result in compilation errors.
+type UnsafeUsersServer interface {
+	mustEmbedUnimplementedUsersServer()
+}
+
+func RegisterUsersServer(s grpc.ServiceRegistrar, srv UsersServer) {
+	s.RegisterService(&Users_ServiceDesc, srv)
+}
+
+func _Users_CreateUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(NewUser)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsersServer).CreateUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/users.v2.Users/CreateUser",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsersServer).CreateUser(ctx, req.(*NewUser))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Users_UpdateUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Update)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsersServer).UpdateUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/users.v2.Users/UpdateUser",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsersServer).UpdateUser(ctx, req.(*Update))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Users_GetUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Ref)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsersServer).GetUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/users.v2.Users/GetUser",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsersServer).GetUser(ctx, req.(*Ref))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Users_DeleteUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Ref)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsersServer).DeleteUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/users.v2.Users/DeleteUser",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsersServer).DeleteUser(ctx, req.(*Ref))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Users_TouchLastSeen_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Ref)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsersServer).TouchLastSeen(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/users.v2.Users/TouchLastSeen",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsersServer).TouchLastSeen(ctx, req.(*Ref))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Users_RestoreUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Ref)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsersServer).RestoreUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/users.v2.Users/RestoreUser",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsersServer).RestoreUser(ctx, req.(*Ref))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Users_ReplayUserEvents_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Ref)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsersServer).ReplayUserEvents(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/users.v2.Users/ReplayUserEvents",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsersServer).ReplayUserEvents(ctx, req.(*Ref))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Users_ListDeadLetters_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeadLettersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsersServer).ListDeadLetters(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/users.v2.Users/ListDeadLetters",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsersServer).ListDeadLetters(ctx, req.(*DeadLettersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Users_RequeueDeadLetter_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Ref)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsersServer).RequeueDeadLetter(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/users.v2.Users/RequeueDeadLetter",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsersServer).RequeueDeadLetter(ctx, req.(*Ref))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Users_AnonymizeUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Ref)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsersServer).AnonymizeUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/users.v2.Users/AnonymizeUser",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsersServer).AnonymizeUser(ctx, req.(*Ref))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Users_SuspendUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Ref)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsersServer).SuspendUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/users.v2.Users/SuspendUser",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsersServer).SuspendUser(ctx, req.(*Ref))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Users_ReactivateUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Ref)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsersServer).ReactivateUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/users.v2.Users/ReactivateUser",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsersServer).ReactivateUser(ctx, req.(*Ref))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Users_BanUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Ref)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsersServer).BanUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/users.v2.Users/BanUser",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsersServer).BanUser(ctx, req.(*Ref))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Users_ExportUserData_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Ref)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsersServer).ExportUserData(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/users.v2.Users/ExportUserData",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsersServer).ExportUserData(ctx, req.(*Ref))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Users_BatchDeleteUsers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Refs)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsersServer).BatchDeleteUsers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/users.v2.Users/BatchDeleteUsers",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsersServer).BatchDeleteUsers(ctx, req.(*Refs))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Users_BatchGetUsers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Refs)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsersServer).BatchGetUsers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/users.v2.Users/BatchGetUsers",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsersServer).BatchGetUsers(ctx, req.(*Refs))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Users_FindUsers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Query)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsersServer).FindUsers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/users.v2.Users/FindUsers",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsersServer).FindUsers(ctx, req.(*Query))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Users_ExportUsers_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(Query)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(UsersServer).ExportUsers(m, &usersExportUsersServer{stream})
+}
+
+type Users_ExportUsersServer interface {
+	Send(*User) error
+	grpc.ServerStream
+}
+
+type usersExportUsersServer struct {
+	grpc.ServerStream
+}
+
+func (x *usersExportUsersServer) Send(m *User) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Users_CountUsers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Query)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsersServer).CountUsers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/users.v2.Users/CountUsers",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsersServer).CountUsers(ctx, req.(*Query))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Users_GetUserStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StatsQuery)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsersServer).GetUserStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/users.v2.Users/GetUserStats",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsersServer).GetUserStats(ctx, req.(*StatsQuery))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Users_LookupUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Lookup)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsersServer).LookupUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/users.v2.Users/LookupUser",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsersServer).LookupUser(ctx, req.(*Lookup))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Users_CheckAvailability_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AvailabilityCheck)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsersServer).CheckAvailability(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/users.v2.Users/CheckAvailability",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsersServer).CheckAvailability(ctx, req.(*AvailabilityCheck))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Users_ChangePassword_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PasswordChange)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsersServer).ChangePassword(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/users.v2.Users/ChangePassword",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsersServer).ChangePassword(ctx, req.(*PasswordChange))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Users_ChangeEmail_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EmailChange)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsersServer).ChangeEmail(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/users.v2.Users/ChangeEmail",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsersServer).ChangeEmail(ctx, req.(*EmailChange))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Users_ConfirmEmailChange_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EmailConfirmation)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsersServer).ConfirmEmailChange(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/users.v2.Users/ConfirmEmailChange",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsersServer).ConfirmEmailChange(ctx, req.(*EmailConfirmation))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Users_ChangeNickname_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(NicknameChange)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsersServer).ChangeNickname(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/users.v2.Users/ChangeNickname",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsersServer).ChangeNickname(ctx, req.(*NicknameChange))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Users_Authenticate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Credentials)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsersServer).Authenticate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/users.v2.Users/Authenticate",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsersServer).Authenticate(ctx, req.(*Credentials))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Users_EnrollTwoFactor_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Ref)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsersServer).EnrollTwoFactor(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/users.v2.Users/EnrollTwoFactor",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsersServer).EnrollTwoFactor(ctx, req.(*Ref))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Users_ConfirmTwoFactor_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TwoFactorCode)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsersServer).ConfirmTwoFactor(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/users.v2.Users/ConfirmTwoFactor",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsersServer).ConfirmTwoFactor(ctx, req.(*TwoFactorCode))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Users_DisableTwoFactor_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TwoFactorCode)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsersServer).DisableTwoFactor(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/users.v2.Users/DisableTwoFactor",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsersServer).DisableTwoFactor(ctx, req.(*TwoFactorCode))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Users_RequestPasswordReset_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PasswordResetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsersServer).RequestPasswordReset(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/users.v2.Users/RequestPasswordReset",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsersServer).RequestPasswordReset(ctx, req.(*PasswordResetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Users_ResetPassword_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PasswordReset)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsersServer).ResetPassword(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/users.v2.Users/ResetPassword",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsersServer).ResetPassword(ctx, req.(*PasswordReset))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Users_WatchUsers_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(UsersServer).WatchUsers(m, &usersWatchUsersServer{stream})
+}
+
+type Users_WatchUsersServer interface {
+	Send(*UserEvent) error
+	grpc.ServerStream
+}
+
+type usersWatchUsersServer struct {
+	grpc.ServerStream
+}
+
+func (x *usersWatchUsersServer) Send(m *UserEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Users_ServiceDesc is the grpc.ServiceDesc for Users service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Users_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "users.v2.Users",
+	HandlerType: (*UsersServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateUser",
+			Handler:    _Users_CreateUser_Handler,
+		},
+		{
+			MethodName: "UpdateUser",
+			Handler:    _Users_UpdateUser_Handler,
+		},
+		{
+			MethodName: "GetUser",
+			Handler:    _Users_GetUser_Handler,
+		},
+		{
+			MethodName: "DeleteUser",
+			Handler:    _Users_DeleteUser_Handler,
+		},
+		{
+			MethodName: "TouchLastSeen",
+			Handler:    _Users_TouchLastSeen_Handler,
+		},
+		{
+			MethodName: "RestoreUser",
+			Handler:    _Users_RestoreUser_Handler,
+		},
+		{
+			MethodName: "ReplayUserEvents",
+			Handler:    _Users_ReplayUserEvents_Handler,
+		},
+		{
+			MethodName: "ListDeadLetters",
+			Handler:    _Users_ListDeadLetters_Handler,
+		},
+		{
+			MethodName: "RequeueDeadLetter",
+			Handler:    _Users_RequeueDeadLetter_Handler,
+		},
+		{
+			MethodName: "AnonymizeUser",
+			Handler:    _Users_AnonymizeUser_Handler,
+		},
+		{
+			MethodName: "SuspendUser",
+			Handler:    _Users_SuspendUser_Handler,
+		},
+		{
+			MethodName: "ReactivateUser",
+			Handler:    _Users_ReactivateUser_Handler,
+		},
+		{
+			MethodName: "BanUser",
+			Handler:    _Users_BanUser_Handler,
+		},
+		{
+			MethodName: "ExportUserData",
+			Handler:    _Users_ExportUserData_Handler,
+		},
+		{
+			MethodName: "BatchDeleteUsers",
+			Handler:    _Users_BatchDeleteUsers_Handler,
+		},
+		{
+			MethodName: "BatchGetUsers",
+			Handler:    _Users_BatchGetUsers_Handler,
+		},
+		{
+			MethodName: "FindUsers",
+			Handler:    _Users_FindUsers_Handler,
+		},
+		{
+			MethodName: "CountUsers",
+			Handler:    _Users_CountUsers_Handler,
+		},
+		{
+			MethodName: "GetUserStats",
+			Handler:    _Users_GetUserStats_Handler,
+		},
+		{
+			MethodName: "LookupUser",
+			Handler:    _Users_LookupUser_Handler,
+		},
+		{
+			MethodName: "CheckAvailability",
+			Handler:    _Users_CheckAvailability_Handler,
+		},
+		{
+			MethodName: "ChangePassword",
+			Handler:    _Users_ChangePassword_Handler,
+		},
+		{
+			MethodName: "ChangeEmail",
+			Handler:    _Users_ChangeEmail_Handler,
+		},
+		{
+			MethodName: "ConfirmEmailChange",
+			Handler:    _Users_ConfirmEmailChange_Handler,
+		},
+		{
+			MethodName: "ChangeNickname",
+			Handler:    _Users_ChangeNickname_Handler,
+		},
+		{
+			MethodName: "Authenticate",
+			Handler:    _Users_Authenticate_Handler,
+		},
+		{
+			MethodName: "EnrollTwoFactor",
+			Handler:    _Users_EnrollTwoFactor_Handler,
+		},
+		{
+			MethodName: "ConfirmTwoFactor",
+			Handler:    _Users_ConfirmTwoFactor_Handler,
+		},
+		{
+			MethodName: "DisableTwoFactor",
+			Handler:    _Users_DisableTwoFactor_Handler,
+		},
+		{
+			MethodName: "RequestPasswordReset",
+			Handler:    _Users_RequestPasswordReset_Handler,
+		},
+		{
+			MethodName: "ResetPassword",
+			Handler:    _Users_ResetPassword_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ExportUsers",
+			Handler:       _Users_ExportUsers_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "WatchUsers",
+			Handler:       _Users_WatchUsers_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "v2/users.proto",
+}